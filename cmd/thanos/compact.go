@@ -5,11 +5,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
+	"regexp"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -46,22 +48,38 @@ const (
 	metricIndexGenerateHelp = "Total number of generated indexes."
 )
 
-var (
-	compactions = compactionSet{
-		1 * time.Hour,
-		2 * time.Hour,
-		8 * time.Hour,
-		2 * 24 * time.Hour,
-		14 * 24 * time.Hour,
-	}
-)
+// shardIDRegexp matches valid compactor shard IDs, which are used as object names in the bucket.
+var shardIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
 
 type compactionSet []time.Duration
 
+// parseCompactionSet parses compaction time ranges and validates that every range is a multiple of the previous one.
+func parseCompactionSet(ranges []string) (compactionSet, error) {
+	if len(ranges) == 0 {
+		return nil, errors.New("no compaction time ranges specified")
+	}
+	cs := make(compactionSet, 0, len(ranges))
+	for i, r := range ranges {
+		d, err := model.ParseDuration(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse compaction time range %q", r)
+		}
+		c := time.Duration(d)
+		if c <= 0 {
+			return nil, errors.Errorf("compaction time range %s has to be positive", r)
+		}
+		if i > 0 && (c <= cs[i-1] || c%cs[i-1] != 0) {
+			return nil, errors.Errorf("compaction time range %s has to be a multiple of the previous range %s", r, model.Duration(cs[i-1]))
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
 func (cs compactionSet) String() string {
 	result := make([]string, len(cs))
 	for i, c := range cs {
-		result[i] = fmt.Sprintf("%d=%dh", i, int(c.Hours()))
+		result[i] = fmt.Sprintf("%d=%s", i, model.Duration(c))
 	}
 	return strings.Join(result, ", ")
 }
@@ -69,7 +87,7 @@ func (cs compactionSet) String() string {
 // levels returns set of compaction levels not higher than specified max compaction level.
 func (cs compactionSet) levels(maxLevel int) ([]int64, error) {
 	if maxLevel >= len(cs) {
-		return nil, errors.Errorf("level is bigger then default set of %d", len(cs))
+		return nil, errors.Errorf("level is bigger then the set of %d compaction time ranges", len(cs))
 	}
 
 	levels := make([]int64, maxLevel+1)
@@ -99,13 +117,21 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 		Default("./data").String()
 
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", true)
+	bandwidthLimits := regCompactBandwidthLimitFlags(cmd)
 
 	consistencyDelay := modelDuration(cmd.Flag("consistency-delay", fmt.Sprintf("Minimum age of fresh (non-compacted) blocks before they are being processed. Malformed blocks older than the maximum of consistency-delay and %v will be removed.", compact.PartialUploadThresholdAge)).
 		Default("30m"))
-
-	retentionRaw := modelDuration(cmd.Flag("retention.resolution-raw", "How long to retain raw samples in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d"))
-	retention5m := modelDuration(cmd.Flag("retention.resolution-5m", "How long to retain samples of resolution 1 (5 minutes) in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d"))
-	retention1h := modelDuration(cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d"))
+	quarantineDelay := modelDuration(cmd.Flag("block-quarantine-delay", "Minimum age of partial blocks, i.e. blocks without a valid meta.json, before they are quarantined: a quarantine-mark.json is uploaded into their directory, "+
+		"and they are not synced anymore. They are released once their meta.json is valid or the mark is removed, and deleted once they stay quarantined for longer than delete-delay. Has to be larger than consistency-delay. 0 disables quarantine.").
+		Default("0s"))
+	minBlockAge := modelDuration(cmd.Flag("compact.min-block-age", "Minimum age of the data of blocks before they are compacted, downsampled or deleted, i.e. blocks with max time later than now minus this age are ignored. "+
+		"Set it to e.g. 2h to never touch blocks which Sidecars or Receivers may still upload or retry uploading. 0 disables the check.").
+		Default("0s"))
+
+	retention := regRetentionFlags(cmd)
+	retentionDryRun := cmd.Flag("retention.dry-run", "Only log blocks past retention instead of marking them for deletion.").Default("false").Bool()
+	retentionConf := extflag.RegisterPathOrContent(cmd, "retention.config", "YAML file with a list of retention policies, each with a selector of external labels and a retention of matching blocks of all resolutions. "+
+		"The first policy matching a block overrides the --retention.resolution-* flags for it.", false)
 
 	// TODO(kakkoyun): https://github.com/thanos-io/thanos/issues/2266.
 	wait := cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
@@ -114,6 +140,10 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 	waitInterval := cmd.Flag("wait-interval", "Wait interval between consecutive compaction runs and bucket refreshes. Only works when --wait flag specified.").
 		Default("5m").Duration()
 
+	dryRun := cmd.Flag("dry-run", "Only plan the compactions, downsamplings and deletions of a single compaction run and print them as JSON to stdout, "+
+		"without modifying the bucket. The --wait flag is ignored.").
+		Default("false").Bool()
+
 	generateMissingIndexCacheFiles := cmd.Flag("index.generate-missing-cache-file", "DEPRECATED flag. Will be removed in next release. If enabled, on startup compactor runs an on-off job that scans all the blocks to find all blocks with missing index cache file. It generates those if needed and upload.").
 		Hidden().Default("false").Bool()
 
@@ -121,15 +151,40 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 		"as querying long time ranges without non-downsampled data is not efficient and useful e.g it is not possible to render all samples for a human eye anyway").
 		Default("false").Bool()
 
-	maxCompactionLevel := cmd.Flag("debug.max-compaction-level", fmt.Sprintf("Maximum compaction level, default is %d: %s", compactions.maxLevel(), compactions.String())).
-		Hidden().Default(strconv.Itoa(compactions.maxLevel())).Int()
+	downsamplingLevels := regDownsamplingLevelsFlag(cmd)
+
+	compactionRanges := cmd.Flag("compact.time-range", "Time range of blocks of a compaction level (repeated flag). Blocks are compacted level by level into blocks of the given ranges, "+
+		"so the last range is the maximum time range of compacted blocks. Every range has to be a multiple of the previous one. "+
+		"Larger ranges reduce the number of blocks of a long retention, but compacting them needs more disk space and time.").
+		Default("1h", "2h", "8h", "2d", "14d").Strings()
+
+	maxCompactionLevel := cmd.Flag("debug.max-compaction-level", "Maximum compaction level, default is the level of the last --compact.time-range.").
+		Hidden().Default("-1").Int()
 
 	blockSyncConcurrency := cmd.Flag("block-sync-concurrency", "Number of goroutines to use when syncing block metadata from object storage.").
 		Default("20").Int()
 
-	compactionConcurrency := cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
+	compactionConcurrency := cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups. Independent groups are compacted in parallel.").
 		Default("1").Int()
 
+	maxDiskSpace := cmd.Flag("compact.max-disk-space", "Maximum local disk space used by the group compactions or downsamplings running in parallel, see --compact.concurrency and --downsample.concurrency. "+
+		"Every compaction reserves twice the size of its source blocks before downloading them and waits if the limit would be exceeded. "+
+		"A compaction bigger than the limit runs alone. 0 means no limit.").
+		Default("0").Bytes()
+
+	maxIndexSize := cmd.Flag("compact.max-index-size", "Maximum size of the index of a compacted block. If a planned compaction could result in a bigger index, "+
+		"the biggest source block is marked to be excluded from compaction with no-compact-mark.json instead of failing the compaction. "+
+		"The default is the limit of the TSDB index format. 0 disables the check.").
+		Default("64GiB").Bytes()
+
+	splitIndexSize := cmd.Flag("compact.split-index-size", "Experimental. If a compacted block has index bigger than this size, it is split into --compact.split-shards blocks by series hash before upload. "+
+		"Shard blocks have the shard in meta.json and are compacted only with blocks of the same shard; they are not split again. 0 disables splitting.").
+		Default("0").Bytes()
+
+	splitShards := cmd.Flag("compact.split-shards", "Number of blocks a compacted block is split into, see --compact.split-index-size. "+
+		"Keep it constant, as blocks split into different number of shards are never compacted together.").
+		Default("4").Int()
+
 	deleteDelay := modelDuration(cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket. "+
 		"If delete-delay is non zero, blocks will be marked for deletion and compactor component will delete blocks marked for deletion from the bucket. "+
 		"If delete-delay is 0, blocks will be deleted straight away. "+
@@ -137,42 +192,113 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 		"or compactor is ignoring the deletion because it's compacting the block at the same time.").
 		Default("48h"))
 
-	dedupReplicaLabels := cmd.Flag("deduplication.replica-label", "Label to treat as a replica indicator of blocks that can be deduplicated (repeated flag). This will merge multiple replica blocks into one. This process is irreversible."+
-		"Experimental. When it is set to true, compactor will ignore the given labels so that vertical compaction can merge the blocks."+
-		"Please note that this uses a NAIVE algorithm for merging (no smart replica deduplication, just chaining samples together)."+
-		"This works well for deduplication of blocks with **precisely the same samples** like produced by Receiver replication.").
-		Hidden().Strings()
+	dedupReplicaLabels := cmd.Flag("deduplication.replica-label", "Label to treat as a replica indicator of blocks that can be deduplicated (repeated flag). This will merge multiple replica blocks into one. This process is irreversible. "+
+		"Experimental. When it is set, compactor will ignore the given labels so that vertical compaction can merge the blocks. "+
+		"The algorithm used for merging is chosen by --deduplication.func.").
+		Strings()
+
+	dedupFunc := cmd.Flag("deduplication.func", "Experimental. Deduplication algorithm for merging overlapping blocks of replicas, see --deduplication.replica-label. "+
+		"Default is the naive algorithm, just chaining samples together, which works well for blocks with **precisely the same samples** like produced by Receiver replication. "+
+		"'exact' is the same as the naive algorithm, keeping samples with exactly the same timestamp once. "+
+		"'penalty' uses the penalty based algorithm of the query time deduplication, which works for blocks of HA Prometheus pairs scraping the same targets at different times. "+
+		"'last-write-wins' chains samples together, keeping the sample of the most recently created block of samples with the same timestamp.").
+		Default(compact.DedupFuncNaive).Enum(compact.DedupFuncs...)
+
+	dedupConf := extflag.RegisterPathOrContent(cmd, "deduplication.config", "YAML file with a list of rules, each with replica_labels and a func, choosing the deduplication algorithm per replica label. "+
+		"Compactions of blocks with any of the replica labels of a rule use the algorithm of the first such rule instead of --deduplication.func. "+
+		"Every replica label of a rule has to be specified by --deduplication.replica-label.", false)
+
+	enableVerticalCompaction := cmd.Flag("compact.enable-vertical-compaction", "Experimental. When set to true, compactor will allow overlapping blocks within a group and vertically merge them into one, instead of halting. "+
+		"This is needed for blocks uploaded by Receivers, which routinely overlap in time. This process is irreversible. Always enabled when --deduplication.replica-label is specified.").
+		Default("false").Bool()
+
+	removeIdenticalBlocks := cmd.Flag("compact.remove-identical-blocks", "Experimental. When set to true, copies of blocks with exactly the same content, e.g. uploaded by multiple sidecars of the same Prometheus, are marked for deletion instead of being compacted together. "+
+		"Blocks are identical if they have the same time range, resolution, stats and external labels apart from --deduplication.replica-label labels, and the same file sizes and hashes recorded in their meta.json. Blocks without recorded file hashes are never removed. The oldest copy is kept.").
+		Default("false").Bool()
+
+	verifySeries := cmd.Flag("compact.verify-series", "Number of series sampled from every source block to verify that the compacted block has exactly the same samples, before it is uploaded and the source blocks are marked for deletion. "+
+		"Compactor halts on mismatch. Verification reads sampled series from all blocks, so it slows down compaction. Only raw blocks are verified. 0 disables verification.").
+		Default("0").Int()
+
+	blockErrorActions := cmd.Flag("compact.block-error-action", "Action taken when an issue of the given class is found in a block planned for compaction (repeated flag). "+
+		"Classes are 'critical-index' (chunks outside of the block time range), 'out-of-order-chunks' and 'malformed-meta' (meta.json inconsistent with the block or its group). "+
+		"Actions are 'halt' (halt the compactor), 'skip' (mark the block with no-compact-mark.json and compact the group without it) and 'retry' (retry in the next iteration). "+
+		"Issues of classes without action halt the compactor.").
+		PlaceHolder("<class>=<action>").Strings()
 
 	selectorRelabelConf := regSelectorRelabelFlags(cmd)
+	shardID := cmd.Flag("compact.shard-id", "ID of the compactor shard selecting blocks with --selector.relabel-config. Replicas of a shard use the same ID, different shards different IDs. "+
+		"If set, the compactor verifies that no other shard compacts the same groups. Allowed characters are letters, digits, '_', '-' and '.'.").
+		Default("").String()
 
 	webExternalPrefix := cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the bucket web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos bucket web UI to be served behind a reverse proxy that strips a URL sub-path.").Default("").String()
 	webPrefixHeaderName := cmd.Flag("web.prefix-header", "Name of HTTP request header used for dynamic prefixing of UI links and redirects. This option is ignored if web.external-prefix argument is set. Security risk: enable this option only if a reverse proxy in front of thanos is resetting the header. The --web.prefix-header=X-Forwarded-Prefix option can be useful, for example, if Thanos UI is served via Traefik reverse proxy with PathPrefixStrip option enabled, which sends the stripped prefix value in X-Forwarded-Prefix header. This allows thanos UI to be served on a sub-path.").Default("").String()
 	label := cmd.Flag("bucket-web-label", "Prometheus label to use as timeline title in the bucket web UI").String()
 
 	m[component.Compact.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		levels, err := downsamplingLevels.parse()
+		if err != nil {
+			return err
+		}
+		retentionByResolution, err := retention.retentionByResolution()
+		if err != nil {
+			return err
+		}
+		errorActions, err := compact.ParseErrorActions(*blockErrorActions)
+		if err != nil {
+			return errors.Wrap(err, "parse --compact.block-error-action")
+		}
+		compactions, err := parseCompactionSet(*compactionRanges)
+		if err != nil {
+			return errors.Wrap(err, "parse --compact.time-range")
+		}
+		if *splitIndexSize > 0 && *splitShards < 2 {
+			return errors.Errorf("--compact.split-shards must be at least 2, got %d", *splitShards)
+		}
+		if *shardID != "" && !shardIDRegexp.MatchString(*shardID) {
+			return errors.Errorf("invalid --compact.shard-id %q, allowed characters are letters, digits, '_', '-' and '.'", *shardID)
+		}
 		return runCompact(g, logger, reg,
 			*httpAddr,
 			time.Duration(*httpGracePeriod),
 			*dataDir,
 			objStoreConfig,
+			bandwidthLimits,
 			time.Duration(*consistencyDelay),
+			time.Duration(*quarantineDelay),
+			time.Duration(*minBlockAge),
 			time.Duration(*deleteDelay),
 			*haltOnError,
 			*acceptMalformedIndex,
 			*wait,
+			*dryRun,
 			*generateMissingIndexCacheFiles,
-			map[compact.ResolutionLevel]time.Duration{
-				compact.ResolutionLevelRaw: time.Duration(*retentionRaw),
-				compact.ResolutionLevel5m:  time.Duration(*retention5m),
-				compact.ResolutionLevel1h:  time.Duration(*retention1h),
-			},
+			retentionByResolution,
+			retentionConf,
+			*retentionDryRun,
 			component.Compact,
 			*disableDownsampling,
+			levels,
+			*downsamplingLevels.sketches,
+			*downsamplingLevels.concurrency,
+			*downsamplingLevels.checkpointSeries,
+			compactions,
 			*maxCompactionLevel,
 			*blockSyncConcurrency,
 			*compactionConcurrency,
+			int64(*maxDiskSpace),
+			int64(*maxIndexSize),
+			int64(*splitIndexSize),
+			*splitShards,
+			*verifySeries,
+			errorActions,
+			*enableVerticalCompaction,
+			*removeIdenticalBlocks,
 			*dedupReplicaLabels,
+			*dedupFunc,
+			dedupConf,
 			selectorRelabelConf,
+			*shardID,
 			*waitInterval,
 			*label,
 			*webExternalPrefix,
@@ -189,16 +315,37 @@ func runCompact(
 	httpGracePeriod time.Duration,
 	dataDir string,
 	objStoreConfig *extflag.PathOrContent,
+	bandwidthLimits *compactBandwidthLimits,
 	consistencyDelay time.Duration,
+	quarantineDelay time.Duration,
+	minBlockAge time.Duration,
 	deleteDelay time.Duration,
-	haltOnError, acceptMalformedIndex, wait, generateMissingIndexCacheFiles bool,
+	haltOnError, acceptMalformedIndex, wait, dryRun, generateMissingIndexCacheFiles bool,
 	retentionByResolution map[compact.ResolutionLevel]time.Duration,
+	retentionConf *extflag.PathOrContent,
+	retentionDryRun bool,
 	component component.Component,
 	disableDownsampling bool,
+	downsamplingLevels []downsample.Level,
+	downsamplingSketches bool,
+	downsamplingConcurrency int,
+	downsamplingCheckpointSeries int,
+	compactions compactionSet,
 	maxCompactionLevel, blockSyncConcurrency int,
 	concurrency int,
+	maxDiskSpace int64,
+	maxIndexSize int64,
+	splitIndexSize int64,
+	splitShards int,
+	verifySeries int,
+	blockErrorActions map[compact.ErrorClass]compact.ErrorAction,
+	enableVerticalCompaction bool,
+	removeIdenticalBlocks bool,
 	dedupReplicaLabels []string,
+	dedupFunc string,
+	dedupConf *extflag.PathOrContent,
 	selectorRelabelConf *extflag.PathOrContent,
+	shardID string,
 	waitInterval time.Duration,
 	label string,
 	externalPrefix, prefixHeader string,
@@ -228,10 +375,19 @@ func runCompact(
 		Name: "thanos_compactor_block_cleanup_failures_total",
 		Help: "Failures encountered while deleting blocks in compactor.",
 	})
+	blocksQuarantined := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compactor_blocks_quarantined_total",
+		Help: "Total number of partial blocks quarantined in compactor.",
+	})
 	blocksMarkedForDeletion := promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_compactor_blocks_marked_for_deletion_total",
 		Help: "Total number of blocks marked for deletion in compactor.",
 	})
+	blocksPendingDeletion := promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_compactor_blocks_pending_deletion",
+		Help: "Number of blocks marked for deletion, which are not deleted yet as the delete delay has not passed.",
+	})
+	retentionBlocksMarked := compact.NewRetentionBlocksMarkedCounter(reg)
 	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
 		Name: "thanos_delete_delay_seconds",
 		Help: "Configured delete delay in seconds.",
@@ -239,7 +395,7 @@ func runCompact(
 		return deleteDelay.Seconds()
 	})
 
-	downsampleMetrics := newDownsampleMetrics(reg)
+	downsampleMetrics := compact.NewDownsampleMetrics(reg)
 
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -273,6 +429,21 @@ func runCompact(
 		return err
 	}
 
+	// Block downloads and uploads of compactions and downsamplings are throttled, metadata is fetched without limits.
+	blocksBkt, err := bandwidthLimits.wrapBucket(bkt, reg)
+	if err != nil {
+		return errors.Wrap(err, "create bandwidth limited bucket")
+	}
+
+	retentionContentYaml, err := retentionConf.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of retention configuration")
+	}
+	retentionPolicies, err := compact.ParseRetentionPolicies(retentionContentYaml)
+	if err != nil {
+		return err
+	}
+
 	relabelContentYaml, err := selectorRelabelConf.Content()
 	if err != nil {
 		return errors.Wrap(err, "get content of relabel configuration")
@@ -282,6 +453,17 @@ func runCompact(
 	if err != nil {
 		return err
 	}
+	if err := compact.ValidateShardingRelabelConfig(relabelConfig, dedupReplicaLabels); err != nil {
+		return errors.Wrap(err, "invalid selector relabel configuration")
+	}
+
+	var shards *compact.ShardOwnershipChecker
+	if shardID != "" {
+		shards = compact.NewShardOwnershipChecker(logger, bkt, shardID)
+		level.Info(logger).Log("msg", "compactor sharding is enabled", "shard", shardID)
+	} else if len(relabelConfig) > 0 {
+		level.Warn(logger).Log("msg", "compactor selects blocks by relabel config without --compact.shard-id; overlaps with other compactor shards are not detected")
+	}
 
 	// Ensure we close up everything properly.
 	defer func() {
@@ -295,46 +477,97 @@ func runCompact(
 	// This is to make sure compactor will not accidentally perform compactions with gap instead.
 	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, deleteDelay/2)
 	duplicateBlocksFilter := block.NewDeduplicateFilter()
+	if removeIdenticalBlocks {
+		duplicateBlocksFilter = block.NewIdenticalBlocksDeduplicateFilter(dedupReplicaLabels)
+		level.Info(logger).Log("msg", "identical blocks will be marked for deletion", "dedupReplicaLabels", strings.Join(dedupReplicaLabels, ","))
+	}
+	noCompactMarkFilter := block.NewGatherNoCompactionMarkFilter(logger, bkt)
 
-	baseMetaFetcher, err := block.NewBaseFetcher(logger, 32, bkt, "", extprom.WrapRegistererWithPrefix("thanos_", reg))
+	if quarantineDelay != 0 && quarantineDelay <= consistencyDelay {
+		return errors.Errorf("block-quarantine-delay %v has to be larger than consistency-delay %v", quarantineDelay, consistencyDelay)
+	}
+	baseMetaFetcher, err := block.NewBaseFetcher(logger, 32, bkt, "", quarantineDelay, extprom.WrapRegistererWithPrefix("thanos_", reg))
 	if err != nil {
 		return errors.Wrap(err, "create meta fetcher")
 	}
 
-	enableVerticalCompaction := false
+	dedupContentYaml, err := dedupConf.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of deduplication configuration")
+	}
+	dedupRules, err := compact.ParseDedupRules(dedupContentYaml)
+	if err != nil {
+		return err
+	}
+	replicaLabels := map[string]struct{}{}
+	for _, l := range dedupReplicaLabels {
+		replicaLabels[l] = struct{}{}
+	}
+	for _, r := range dedupRules {
+		for _, l := range r.ReplicaLabels {
+			if _, ok := replicaLabels[l]; !ok {
+				return errors.Errorf("replica label %q of deduplication rule is not specified by deduplication.replica-label", l)
+			}
+		}
+		level.Info(logger).Log("msg", "deduplication rule configured", "replicaLabels", strings.Join(r.ReplicaLabels, ","), "dedupFunc", r.Func)
+	}
+
 	if len(dedupReplicaLabels) > 0 {
 		enableVerticalCompaction = true
-		level.Info(logger).Log("msg", "deduplication.replica-label specified, vertical compaction is enabled", "dedupReplicaLabels", strings.Join(dedupReplicaLabels, ","))
+		level.Info(logger).Log("msg", "deduplication.replica-label specified, vertical compaction is enabled", "dedupReplicaLabels", strings.Join(dedupReplicaLabels, ","), "dedupFunc", dedupFunc)
+	} else if dedupFunc != compact.DedupFuncNaive {
+		return errors.New("deduplication.func requires deduplication.replica-label to be specified")
+	} else if enableVerticalCompaction {
+		level.Info(logger).Log("msg", "vertical compaction is enabled, overlapping blocks will be merged")
 	}
 
-	compactorView := ui.NewBucketUI(logger, label, path.Join(externalPrefix, "/loaded"), prefixHeader)
+	progress := compact.NewProgress()
+	compactorView := ui.NewBucketUI(logger, label, path.Join(externalPrefix, "/loaded"), prefixHeader).WithCompactionProgress(progress)
 	var sy *compact.Syncer
 	{
 		// Make sure all compactor meta syncs are done through Syncer.SyncMeta for readability.
+		filters := []block.MetadataFilter{
+			block.NewLabelShardedMetaFilter(relabelConfig),
+			block.NewConsistencyDelayMetaFilter(logger, consistencyDelay, extprom.WrapRegistererWithPrefix("thanos_", reg)),
+		}
+		if minBlockAge > 0 {
+			filters = append(filters, block.NewMinBlockAgeMetaFilter(logger, minBlockAge, extprom.WrapRegistererWithPrefix("thanos_", reg)))
+		}
+		filters = append(filters, ignoreDeletionMarkFilter, duplicateBlocksFilter, noCompactMarkFilter)
 		cf := baseMetaFetcher.NewMetaFetcher(
-			extprom.WrapRegistererWithPrefix("thanos_", reg), []block.MetadataFilter{
-				block.NewLabelShardedMetaFilter(relabelConfig),
-				block.NewConsistencyDelayMetaFilter(logger, consistencyDelay, extprom.WrapRegistererWithPrefix("thanos_", reg)),
-				ignoreDeletionMarkFilter,
-				duplicateBlocksFilter,
-			}, []block.MetadataModifier{block.NewReplicaLabelRemover(logger, dedupReplicaLabels)},
+			extprom.WrapRegistererWithPrefix("thanos_", reg), filters,
+			[]block.MetadataModifier{block.NewReplicaLabelRemover(logger, dedupReplicaLabels)},
 		)
 		cf.UpdateOnChange(compactorView.Set)
 		sy, err = compact.NewSyncer(
 			logger,
 			reg,
-			bkt,
+			blocksBkt,
 			cf,
 			duplicateBlocksFilter,
 			ignoreDeletionMarkFilter,
+			noCompactMarkFilter,
 			blocksMarkedForDeletion,
 			blockSyncConcurrency,
-			acceptMalformedIndex, enableVerticalCompaction)
+			compact.GroupOptions{
+				AcceptMalformedIndex:     acceptMalformedIndex,
+				EnableVerticalCompaction: enableVerticalCompaction,
+				VerifySeries:             verifySeries,
+				MaxIndexSize:             maxIndexSize,
+				SplitIndexSize:           splitIndexSize,
+				SplitShards:              splitShards,
+				ErrorPolicy:              compact.NewErrorPolicy(reg, blockErrorActions),
+			},
+			compact.DefaultGrouper{},
+		)
 		if err != nil {
 			return errors.Wrap(err, "create syncer")
 		}
 	}
 
+	if maxCompactionLevel < 0 {
+		maxCompactionLevel = compactions.maxLevel()
+	}
 	levels, err := compactions.levels(maxCompactionLevel)
 	if err != nil {
 		return errors.Wrap(err, "get compaction levels")
@@ -343,19 +576,25 @@ func runCompact(
 	if maxCompactionLevel < compactions.maxLevel() {
 		level.Warn(logger).Log("msg", "Max compaction level is lower than should be", "current", maxCompactionLevel, "default", compactions.maxLevel())
 	}
+	level.Info(logger).Log("msg", "compaction levels configured", "levels", compactions.String())
 
 	ctx, cancel := context.WithCancel(context.Background())
 	// Instantiate the compactor with different time slices. Timestamps in TSDB
 	// are in milliseconds.
-	comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, levels, downsample.NewPool())
+	var comp tsdb.Compactor
+	comp, err = tsdb.NewLeveledCompactor(ctx, reg, logger, levels, downsample.NewPool())
 	if err != nil {
 		cancel()
 		return errors.Wrap(err, "create compactor")
 	}
+	if (dedupFunc != compact.DedupFuncNaive && dedupFunc != compact.DedupFuncExact) || len(dedupRules) > 0 {
+		comp = compact.NewDedupCompactor(logger, comp, dedupFunc, dedupRules)
+	}
 
 	var (
 		compactDir      = path.Join(dataDir, "compact")
 		downsamplingDir = path.Join(dataDir, "downsample")
+		checkpointDir   = path.Join(dataDir, "downsample-checkpoints")
 		indexCacheDir   = path.Join(dataDir, "index_cache")
 	)
 
@@ -364,21 +603,30 @@ func runCompact(
 		return errors.Wrap(err, "clean working downsample directory")
 	}
 
-	blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, deleteDelay, blocksCleaned, blockCleanupFailures)
-	compactor, err := compact.NewBucketCompactor(logger, sy, comp, compactDir, bkt, concurrency)
+	if err := os.MkdirAll(dataDir, 0777); err != nil {
+		cancel()
+		return errors.Wrap(err, "create data directory")
+	}
+
+	blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, deleteDelay, blocksCleaned, blockCleanupFailures, blocksPendingDeletion)
+	// Compactions and downsamplings never run at the same time, so they share the disk space limit.
+	diskSpace := compact.NewDiskSpaceLimiter(reg, maxDiskSpace, dataDir)
+	compactor, err := compact.NewBucketCompactor(logger, sy, comp, compactDir, blocksBkt, concurrency, diskSpace, progress, shards)
 	if err != nil {
 		cancel()
 		return errors.Wrap(err, "create bucket compactor")
 	}
 
-	if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
+	for res, d := range retentionByResolution {
+		if d.Seconds() != 0 {
+			level.Info(logger).Log("msg", "retention policy of resolution is enabled", "resolution", time.Duration(res)*time.Millisecond, "duration", d)
+		}
 	}
-	if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
+	for _, p := range retentionPolicies {
+		level.Info(logger).Log("msg", "retention policy of blocks matching selector is enabled", "selector", p.Selector, "duration", p.Retention)
 	}
-	if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
+	if retentionDryRun {
+		level.Info(logger).Log("msg", "retention dry run is enabled; blocks past retention will only be logged")
 	}
 
 	compactMainFn := func() error {
@@ -387,23 +635,26 @@ func runCompact(
 		}
 
 		if !disableDownsampling {
-			// After all compactions are done, work down the downsampling backlog.
-			// We run two passes of this to ensure that the 1h downsampling is generated
-			// for 5m downsamplings created in the first run.
-			level.Info(logger).Log("msg", "start first pass of downsampling")
-			if err := sy.SyncMetas(ctx); err != nil {
-				return errors.Wrap(err, "sync before first pass of downsampling")
-			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir); err != nil {
-				return errors.Wrap(err, "first pass of downsampling failed")
-			}
-
-			level.Info(logger).Log("msg", "start second pass of downsampling")
-			if err := sy.SyncMetas(ctx); err != nil {
-				return errors.Wrap(err, "sync before second pass of downsampling")
+			opts := compact.DownsampleOptions{
+				Dir:              downsamplingDir,
+				Levels:           downsamplingLevels,
+				Sketches:         downsamplingSketches,
+				Concurrency:      downsamplingConcurrency,
+				CheckpointSeries: downsamplingCheckpointSeries,
+				CheckpointDir:    checkpointDir,
+				DiskSpace:        diskSpace,
 			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir); err != nil {
-				return errors.Wrap(err, "second pass of downsampling failed")
+			// After all compactions are done, work down the downsampling backlog.
+			// We run a pass for every level to ensure that e.g. the 1h downsampling is generated
+			// for 5m downsamplings created in the first pass.
+			for i := range downsamplingLevels {
+				level.Info(logger).Log("msg", "start pass of downsampling", "pass", i+1)
+				if err := sy.SyncMetas(ctx); err != nil {
+					return errors.Wrapf(err, "sync before pass %d of downsampling", i+1)
+				}
+				if err := compact.DownsampleBucket(ctx, logger, downsampleMetrics, blocksBkt, sy.Metas(), opts); err != nil {
+					return errors.Wrapf(err, "pass %d of downsampling failed", i+1)
+				}
 			}
 			level.Info(logger).Log("msg", "downsampling iterations done")
 		} else {
@@ -415,12 +666,20 @@ func runCompact(
 			return errors.Wrap(err, "sync before first pass of downsampling")
 		}
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, sy.Metas(), retentionByResolution, blocksMarkedForDeletion); err != nil {
+		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, sy.Metas(), retentionByResolution, retentionPolicies, retentionDryRun, blocksMarkedForDeletion, retentionBlocksMarked); err != nil {
 			return errors.Wrap(err, "retention failed")
 		}
 
 		// No need to resync before partial uploads and delete marked blocks. Last sync should be valid.
-		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, sy.Partial(), bkt, partialUploadDeleteAttempts, blocksCleaned, blockCleanupFailures)
+		partial := sy.Partial()
+		if quarantineDelay > 0 {
+			partial = compact.BestEffortQuarantinePartialBlocks(ctx, logger, partial, bkt, quarantineDelay, blocksQuarantined)
+		}
+		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, partial, bkt, partialUploadDeleteAttempts, blocksCleaned, blockCleanupFailures)
+		if quarantineDelay > 0 {
+			// Quarantined blocks are deleted like blocks marked for deletion, once they stay quarantined for deleteDelay.
+			compact.BestEffortCleanQuarantinedBlocks(ctx, logger, baseMetaFetcher.Quarantined(), bkt, deleteDelay, partialUploadDeleteAttempts, blocksCleaned, blockCleanupFailures)
+		}
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "error cleaning blocks")
 		}
@@ -430,6 +689,16 @@ func runCompact(
 	g.Add(func() error {
 		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
 
+		if dryRun {
+			plan, err := planCompaction(ctx, logger, bkt, compactor, sy, baseMetaFetcher, blocksCleaner, disableDownsampling, downsamplingLevels, retentionByResolution, retentionPolicies, quarantineDelay, deleteDelay)
+			if err != nil {
+				return errors.Wrap(err, "plan compaction")
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(plan)
+		}
+
 		// Generate index files.
 		// TODO(bwplotka): Remove this in next release.
 		if generateMissingIndexCacheFiles {
@@ -613,3 +882,98 @@ func generateIndexCacheFile(
 	}
 	return nil
 }
+
+// compactPlan is the work of a single compaction run printed with --dry-run.
+type compactPlan struct {
+	Compactions   []compact.PlannedCompaction `json:"compactions"`
+	Downsamplings []plannedDownsampling       `json:"downsamplings"`
+	// Quarantines are partial blocks to quarantine.
+	Quarantines []ulid.ULID       `json:"quarantines"`
+	Deletions   []plannedDeletion `json:"deletions"`
+}
+
+type plannedDownsampling struct {
+	Block      ulid.ULID `json:"block"`
+	Resolution int64     `json:"resolution"`
+}
+
+type plannedDeletion struct {
+	Block ulid.ULID `json:"block"`
+	// Reason is "duplicate" for blocks garbage collected after compaction, "retention" for blocks past retention,
+	// "deletion-mark" for blocks marked for deletion longer than the delete delay, "aborted-partial-upload" for
+	// aborted partial uploads and "quarantine" for blocks quarantined longer than the delete delay.
+	Reason string `json:"reason"`
+}
+
+// planCompaction returns the work of a single compaction run for the current state of the bucket, without modifying it.
+// Work depending on results of the planned compactions and downsamplings is not included.
+func planCompaction(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.InstrumentedBucketReader,
+	compactor *compact.BucketCompactor,
+	sy *compact.Syncer,
+	fetcher *block.BaseFetcher,
+	blocksCleaner *compact.BlocksCleaner,
+	disableDownsampling bool,
+	downsamplingLevels []downsample.Level,
+	retentionByResolution map[compact.ResolutionLevel]time.Duration,
+	retentionPolicies []*compact.RetentionPolicy,
+	quarantineDelay, deleteDelay time.Duration,
+) (*compactPlan, error) {
+	plan := &compactPlan{
+		Compactions:   []compact.PlannedCompaction{},
+		Downsamplings: []plannedDownsampling{},
+		Quarantines:   []ulid.ULID{},
+		Deletions:     []plannedDeletion{},
+	}
+	compactions, err := compactor.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan.Compactions = append(plan.Compactions, compactions...)
+
+	for _, id := range sy.GarbageBlocks() {
+		plan.Deletions = append(plan.Deletions, plannedDeletion{Block: id, Reason: "duplicate"})
+	}
+	if !disableDownsampling {
+		for _, w := range compact.PlanDownsamplings(sy.Metas(), downsamplingLevels) {
+			plan.Downsamplings = append(plan.Downsamplings, plannedDownsampling{Block: w.Meta.ULID, Resolution: w.Resolution})
+		}
+	}
+	for _, id := range compact.BlocksPastRetention(sy.Metas(), retentionByResolution, retentionPolicies) {
+		plan.Deletions = append(plan.Deletions, plannedDeletion{Block: id, Reason: "retention"})
+	}
+	for _, id := range blocksCleaner.BlocksDueForDeletion() {
+		plan.Deletions = append(plan.Deletions, plannedDeletion{Block: id, Reason: "deletion-mark"})
+	}
+
+	// Partial blocks are quarantined first, so only the remaining ones can be deleted as aborted uploads.
+	partial := map[ulid.ULID]error{}
+	for id, err := range sy.Partial() {
+		partial[id] = err
+	}
+	if quarantineDelay > 0 {
+		for _, id := range compact.PartialBlocksToQuarantine(partial, quarantineDelay) {
+			plan.Quarantines = append(plan.Quarantines, id)
+			delete(partial, id)
+		}
+	}
+	aborted, err := compact.AbortedPartialUploads(ctx, bkt, partial, compact.PartialUploadThresholdAge)
+	if err != nil {
+		return nil, errors.Wrap(err, "find aborted partial uploads")
+	}
+	for _, id := range aborted {
+		plan.Deletions = append(plan.Deletions, plannedDeletion{Block: id, Reason: "aborted-partial-upload"})
+	}
+	if quarantineDelay > 0 {
+		quarantined, err := compact.QuarantinedBlocksToDelete(ctx, logger, bkt, fetcher.Quarantined(), deleteDelay)
+		if err != nil {
+			return nil, errors.Wrap(err, "find quarantined blocks to delete")
+		}
+		for _, id := range quarantined {
+			plan.Deletions = append(plan.Deletions, plannedDeletion{Block: id, Reason: "quarantine"})
+		}
+	}
+	return plan, nil
+}
@@ -6,8 +6,18 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/alecthomas/units"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/extflag"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/querylog"
+	"github.com/thanos-io/thanos/pkg/shipper"
 
 	"github.com/prometheus/common/model"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -20,6 +30,20 @@ func modelDuration(flags *kingpin.FlagClause) *model.Duration {
 	return value
 }
 
+// flagsMap returns the values of the flags of the given command by their names. Values of flags with configuration
+// content are hidden, as they may contain secrets.
+func flagsMap(cmd *kingpin.CmdClause) map[string]string {
+	m := map[string]string{}
+	for _, f := range cmd.Model().Flags {
+		v := f.Value.String()
+		if strings.HasSuffix(f.Name, "config") && v != "" {
+			v = "<hidden>"
+		}
+		m[f.Name] = v
+	}
+	return m
+}
+
 func regGRPCFlags(cmd *kingpin.CmdClause) (
 	grpcBindAddr *string,
 	grpcGracePeriod *model.Duration,
@@ -73,3 +97,192 @@ func regSelectorRelabelFlags(cmd *kingpin.CmdClause) *extflag.PathOrContent {
 		false,
 	)
 }
+
+type shipperUploadLimits struct {
+	concurrency       *int
+	bytesPerSecond    *units.Base2Bytes
+	requestsPerSecond *float64
+}
+
+func regShipperUploadLimitFlags(cmd *kingpin.CmdClause) *shipperUploadLimits {
+	return &shipperUploadLimits{
+		concurrency: cmd.Flag("shipper.upload-concurrency", "Maximum number of files of a block the shipper uploads concurrently.").
+			Default("1").Int(),
+		bytesPerSecond: cmd.Flag("shipper.upload-bytes-per-second", "Maximum number of bytes per second the shipper uploads to the object storage. 0 disables the limit.").
+			Default("0B").Bytes(),
+		requestsPerSecond: cmd.Flag("shipper.upload-requests-per-second", "Maximum number of upload requests per second the shipper issues against the object storage. 0 disables the limit.").
+			Default("0").Float64(),
+	}
+}
+
+func (l *shipperUploadLimits) options() shipper.UploadOptions {
+	return shipper.UploadOptions{
+		Concurrency:       *l.concurrency,
+		BytesPerSecond:    int64(*l.bytesPerSecond),
+		RequestsPerSecond: *l.requestsPerSecond,
+	}
+}
+
+type slowQueryLogFlags struct {
+	threshold    *model.Duration
+	path         *string
+	tenantHeader *string
+}
+
+func regSlowQueryLogFlags(cmd *kingpin.CmdClause) *slowQueryLogFlags {
+	return &slowQueryLogFlags{
+		threshold: modelDuration(cmd.Flag("slow-query-log.threshold", "Log queries taking at least this duration, with their fingerprint, time range, number of series and samples of their result, tenant and source IP. 0s disables the slow query log.").
+			Default("0s")),
+		path: cmd.Flag("slow-query-log.file", "File slow queries are appended to as JSON lines. Slow queries are logged if empty.").
+			Default("").String(),
+		tenantHeader: cmd.Flag("slow-query-log.tenant-header", "HTTP header the tenant of slow queries is determined from.").
+			Default("THANOS-TENANT").String(),
+	}
+}
+
+// slowQueryLog returns the slow query log of the flags or nil if it is disabled.
+func (f *slowQueryLogFlags) slowQueryLog(logger log.Logger, reg prometheus.Registerer) (*querylog.SlowQueryLog, error) {
+	if *f.threshold == 0 {
+		return nil, nil
+	}
+	return querylog.NewSlowQueryLog(logger, reg, querylog.Config{
+		Threshold:    time.Duration(*f.threshold),
+		Path:         *f.path,
+		TenantHeader: *f.tenantHeader,
+	})
+}
+
+type compactBandwidthLimits struct {
+	uploadBytesPerSecond   *units.Base2Bytes
+	downloadBytesPerSecond *units.Base2Bytes
+}
+
+func regCompactBandwidthLimitFlags(cmd *kingpin.CmdClause) *compactBandwidthLimits {
+	return &compactBandwidthLimits{
+		uploadBytesPerSecond: cmd.Flag("compact.upload-bytes-per-second", "Maximum number of bytes per second the compactor uploads to the object storage, shared by all compactions and downsamplings running in parallel. 0 disables the limit.").
+			Default("0B").Bytes(),
+		downloadBytesPerSecond: cmd.Flag("compact.download-bytes-per-second", "Maximum number of bytes per second the compactor downloads from the object storage, shared by all compactions and downsamplings running in parallel. 0 disables the limit.").
+			Default("0B").Bytes(),
+	}
+}
+
+// wrapBucket returns bucket throttling block uploads and downloads according to the configured limits.
+func (l *compactBandwidthLimits) wrapBucket(bkt objstore.Bucket, reg prometheus.Registerer) (objstore.Bucket, error) {
+	conf := objstore.RateLimitConfig{
+		Operations: map[string]objstore.RateLimit{
+			"upload": {BytesPerSecond: int64(*l.uploadBytesPerSecond)},
+		},
+		// Full and ranged downloads share the limit.
+		ReadBytesPerSecond: int64(*l.downloadBytesPerSecond),
+	}
+	if !conf.Enabled() {
+		return bkt, nil
+	}
+	return objstore.NewRateLimitedBucket("compact", bkt, conf, reg)
+}
+
+type downsamplingLevels struct {
+	levels           *[]string
+	sketches         *bool
+	concurrency      *int
+	checkpointSeries *int
+}
+
+// regDownsamplingLevelFlag registers the flag of the downsampling levels only, for commands which need to know the
+// levels without downsampling.
+func regDownsamplingLevelFlag(cmd *kingpin.CmdClause) *[]string {
+	return cmd.Flag("downsampling.level", "Downsampling level in the <resolution>:<min block range> format (repeated flag). "+
+		"Raw blocks are downsampled to the first level and blocks of every level to the next one, once they span at least the min block range of the target level. "+
+		"Every resolution has to be a multiple of the previous one. Changing the levels does not affect already downsampled blocks.").
+		Default("5m:40h", "1h:10d").Strings()
+}
+
+// parseDownsamplingLevels parses and validates the given downsampling levels.
+func parseDownsamplingLevels(strs []string) ([]downsample.Level, error) {
+	levels := make([]downsample.Level, 0, len(strs))
+	for _, s := range strs {
+		lvl, err := downsample.ParseLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, lvl)
+	}
+	if err := downsample.ValidateLevels(levels); err != nil {
+		return nil, errors.Wrap(err, "invalid downsampling levels")
+	}
+	return levels, nil
+}
+
+func regDownsamplingLevelsFlag(cmd *kingpin.CmdClause) *downsamplingLevels {
+	return &downsamplingLevels{
+		levels: regDownsamplingLevelFlag(cmd),
+		sketches: cmd.Flag("downsampling.sketches", "Compute a quantile sketch for every downsampling window of raw data, which allows to approximate quantile_over_time over downsampled data. "+
+			"Sketches of already downsampled blocks are always retained. Sketches increase the size of downsampled blocks.").
+			Default("false").Bool(),
+		concurrency: cmd.Flag("downsample.concurrency", "Number of goroutines to use when downsampling blocks. Independent blocks are downsampled in parallel. "+
+			"Every downsampling reserves twice the size of its source block on the local disk and keeps the block open, so disk and memory usage grow with the concurrency.").
+			Default("1").Int(),
+		checkpointSeries: cmd.Flag("downsample.checkpoint-series", "Number of series downsampled between progress checkpoints of blocks with more series. "+
+			"Checkpoints are kept in the data directory, so downsampling of huge blocks resumes after a crash or restart instead of starting from scratch. "+
+			"Checkpointed blocks are written twice, as the checkpointed parts are merged at the end, so their downsampling reserves three times the size of the source block. 0 disables checkpointing.").
+			Default("0").Int(),
+	}
+}
+
+// parse returns the configured downsampling levels.
+func (l *downsamplingLevels) parse() ([]downsample.Level, error) {
+	levels, err := parseDownsamplingLevels(*l.levels)
+	if err != nil {
+		return nil, err
+	}
+	if *l.concurrency < 1 {
+		return nil, errors.Errorf("--downsample.concurrency must be at least 1, got %d", *l.concurrency)
+	}
+	if *l.checkpointSeries < 0 {
+		return nil, errors.Errorf("--downsample.checkpoint-series cannot be negative, got %d", *l.checkpointSeries)
+	}
+	return levels, nil
+}
+
+type retentionFlags struct {
+	raw, res5m, res1h *model.Duration
+	resolutions       *[]string
+}
+
+func regRetentionFlags(cmd *kingpin.CmdClause) *retentionFlags {
+	return &retentionFlags{
+		raw:   modelDuration(cmd.Flag("retention.resolution-raw", "How long to retain raw samples in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d")),
+		res5m: modelDuration(cmd.Flag("retention.resolution-5m", "How long to retain samples of resolution 1 (5 minutes) in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d")),
+		res1h: modelDuration(cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").Default("0d")),
+		resolutions: cmd.Flag("retention.resolution", "Retention of blocks of a resolution in the <resolution>:<retention> format, e.g. 30m:90d for blocks of a custom downsampling level (repeated flag). "+
+			"Overrides the --retention.resolution-* flags for their resolutions. A retention of 0d retains blocks of the resolution forever.").Strings(),
+	}
+}
+
+// retentionByResolution returns the configured retention of every resolution, keyed by the resolution of blocks.
+func (f *retentionFlags) retentionByResolution() (map[compact.ResolutionLevel]time.Duration, error) {
+	res := map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevelRaw: time.Duration(*f.raw),
+		compact.ResolutionLevel5m:  time.Duration(*f.res5m),
+		compact.ResolutionLevel1h:  time.Duration(*f.res1h),
+	}
+	for _, s := range *f.resolutions {
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("retention %q is not in the <resolution>:<retention> format", s)
+		}
+		var resolution model.Duration
+		if parts[0] != "0" && parts[0] != "raw" {
+			var err error
+			if resolution, err = model.ParseDuration(parts[0]); err != nil {
+				return nil, errors.Wrapf(err, "parse resolution of retention %q", s)
+			}
+		}
+		retention, err := model.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse retention %q", s)
+		}
+		res[compact.ResolutionLevel(time.Duration(resolution)/time.Millisecond)] = time.Duration(retention)
+	}
+	return res, nil
+}
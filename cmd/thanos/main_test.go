@@ -13,10 +13,8 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
-	"github.com/oklog/ulid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -25,6 +23,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 func TestCleanupIndexCacheFolder(t *testing.T) {
@@ -90,42 +89,56 @@ func TestCleanupIndexCacheFolder(t *testing.T) {
 	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
 }
 
-func TestCleanupDownsampleCacheFolder(t *testing.T) {
-	logger := log.NewLogfmtLogger(os.Stderr)
-	dir, err := ioutil.TempDir("", "test-compact-cleanup")
+func TestParseCompactionSet(t *testing.T) {
+	cs, err := parseCompactionSet([]string{"1h", "2h", "8h", "2d", "14d"})
 	testutil.Ok(t, err)
-	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
-	var id ulid.ULID
-	{
-		id, err = e2eutil.CreateBlock(
-			ctx,
-			dir,
-			[]labels.Labels{{{Name: "a", Value: "1"}}},
-			1, 0, downsample.DownsampleRange0+1, // Pass the minimum DownsampleRange0 check.
-			labels.Labels{{Name: "e1", Value: "1"}},
-			downsample.ResLevel0)
-		testutil.Ok(t, err)
-		testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, id.String())))
-	}
+	testutil.Equals(t, compactionSet{time.Hour, 2 * time.Hour, 8 * time.Hour, 48 * time.Hour, 14 * 24 * time.Hour}, cs)
+	testutil.Equals(t, 4, cs.maxLevel())
 
-	meta, err := block.DownloadMeta(ctx, logger, bkt, id)
+	levels, err := cs.levels(2)
 	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{3600000, 7200000, 28800000}, levels)
+	_, err = cs.levels(5)
+	testutil.NotOk(t, err)
 
-	metrics := newDownsampleMetrics(prometheus.NewRegistry())
-	testutil.Equals(t, 0.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(compact.GroupKey(meta.Thanos))))
-	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, nil, nil)
+	// Compaction into blocks larger than 2 weeks for long retention.
+	cs, err = parseCompactionSet([]string{"2h", "8h", "2d", "14d", "28d", "84d"})
 	testutil.Ok(t, err)
+	testutil.Equals(t, 84*24*time.Hour, cs[cs.maxLevel()])
+
+	for _, ranges := range [][]string{
+		nil,
+		{"2h", "abc"},
+		{"0h", "2h"},
+		{"2h", "3h"},
+		{"2h", "2h"},
+		{"8h", "2h"},
+	} {
+		_, err := parseCompactionSet(ranges)
+		testutil.NotOk(t, err, "ranges %v", ranges)
+	}
+}
 
-	metas, _, err := metaFetcher.Fetch(ctx)
-	testutil.Ok(t, err)
-	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir))
-	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(compact.GroupKey(meta.Thanos))))
+func TestRetentionByResolution(t *testing.T) {
+	parse := func(args ...string) (map[compact.ResolutionLevel]time.Duration, error) {
+		app := kingpin.New("test", "")
+		f := regRetentionFlags(app.Command("compact", ""))
+		_, err := app.Parse(append([]string{"compact"}, args...))
+		testutil.Ok(t, err)
+		return f.retentionByResolution()
+	}
 
-	_, err = os.Stat(dir)
-	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
+	r, err := parse("--retention.resolution-raw=30d", "--retention.resolution=30m:90d", "--retention.resolution=1h:1y")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevelRaw:              30 * 24 * time.Hour,
+		compact.ResolutionLevel5m:               0,
+		compact.ResolutionLevel1h:               365 * 24 * time.Hour,
+		compact.ResolutionLevel(30 * 60 * 1000): 90 * 24 * time.Hour,
+	}, r)
+
+	_, err = parse("--retention.resolution=30m")
+	testutil.NotOk(t, err)
+	_, err = parse("--retention.resolution=abc:90d")
+	testutil.NotOk(t, err)
 }
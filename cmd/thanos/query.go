@@ -25,21 +25,29 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/thanos-io/thanos/pkg/alert"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	http_util "github.com/thanos-io/thanos/pkg/http"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
 	v1 "github.com/thanos-io/thanos/pkg/query/api"
+	"github.com/thanos-io/thanos/pkg/querylog"
+	"github.com/thanos-io/thanos/pkg/rules"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/tls"
+	"github.com/thanos-io/thanos/pkg/tracing"
 	"github.com/thanos-io/thanos/pkg/ui"
+	"google.golang.org/grpc"
 )
 
 // registerQuery registers a query command.
@@ -77,7 +85,7 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	stores := cmd.Flag("store", "Addresses of statically configured store API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect store API servers through respective DNS lookups.").
 		PlaceHolder("<store>").Strings()
 
-	strictStores := cmd.Flag("store-strict", "Addresses of only statically configured store API servers that are always used, even if the health check fails. Useful if you have a caching layer on top.").
+	strictStores := cmd.Flag("store-strict", "Addresses of only statically configured store API servers that are always used, even if the health check fails. Unlike stores discovered via --store or SD files, unreachable strict stores are never removed and are still queried, so their failures cause query errors or partial response warnings. Useful if you have a caching layer on top.").
 		PlaceHolder("<staticstore>").Strings()
 
 	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers. The path can be a glob pattern (repeatable).").
@@ -101,10 +109,25 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	enablePartialResponse := cmd.Flag("query.partial-response", "Enable partial response for queries if no partial_response param is specified. --no-query.partial-response for disabling.").
 		Default("true").Bool()
 
+	skipCorruptChunks := cmd.Flag("query.skip-corrupt-chunks", "Skip chunks that fail to decode instead of failing the whole series. Skipped chunks are logged as warnings, so queries may return partial data without notice.").
+		Default("false").Bool()
+
+	verifyChunkChecksums := cmd.Flag("query.verify-chunk-checksums", "Verify checksums of chunks sent by StoreAPIs that provide them. A StoreAPI sending a mismatching chunk is treated as failed for the query, so its response is dropped with a warning if partial response is enabled.").
+		Default("false").Bool()
+
 	defaultEvaluationInterval := modelDuration(cmd.Flag("query.default-evaluation-interval", "Set default evaluation interval for sub queries.").Default("1m"))
 
 	storeResponseTimeout := modelDuration(cmd.Flag("store.response-timeout", "If a Store doesn't send any data in this specified duration then a Store will be ignored and partial data will be returned if it's enabled. 0 disables timeout.").Default("0ms"))
 
+	maxQueryMemory := cmd.Flag("store.series-memory-limit", "Maximum approximate number of bytes of series received from StoreAPIs, but not yet merged, for a single Series call. The query fails once the limit is exceeded. 0 means no limit.").
+		Default("0").Bytes()
+
+	alertmgrsConfig := extflag.RegisterPathOrContent(cmd, "alertmanagers.config", "YAML file that contains Alertmanager clusters to aggregate alerts and silences from, in the format of the rule component alerting configuration. If defined, read-only /api/v2/alerts and /api/v2/silences endpoints are exposed under /alertmanager.", false)
+	alertmgrsDNSSDInterval := modelDuration(cmd.Flag("alertmanagers.sd-dns-interval", "Interval between DNS resolutions of Alertmanager hosts.").
+		Default("30s"))
+
+	slowQueryLogFlags := regSlowQueryLogFlags(cmd)
+
 	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		selectorLset, err := parseFlagLabels(*selectorLabels)
 		if err != nil {
@@ -131,6 +154,16 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 
 		promql.SetDefaultEvaluationInterval(time.Duration(*defaultEvaluationInterval))
 
+		alertmgrsConfigYAML, err := alertmgrsConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		slowQueryLog, err := slowQueryLogFlags.slowQueryLog(logger, reg)
+		if err != nil {
+			return err
+		}
+
 		return runQuery(
 			g,
 			logger,
@@ -151,20 +184,27 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 			*webRoutePrefix,
 			*webExternalPrefix,
 			*webPrefixHeaderName,
+			flagsMap(cmd),
 			*maxConcurrentQueries,
 			time.Duration(*queryTimeout),
 			time.Duration(*storeResponseTimeout),
+			uint64(*maxQueryMemory),
 			*replicaLabels,
 			selectorLset,
 			*stores,
 			*enableAutodownsampling,
 			*enablePartialResponse,
+			*skipCorruptChunks,
+			*verifyChunkChecksums,
 			fileSD,
 			time.Duration(*dnsSDInterval),
 			*dnsSDResolver,
 			time.Duration(*unhealthyStoreTimeout),
 			time.Duration(*instantDefaultMaxSourceResolution),
 			*strictStores,
+			alertmgrsConfigYAML,
+			time.Duration(*alertmgrsDNSSDInterval),
+			slowQueryLog,
 			component.Query,
 		)
 	}
@@ -192,20 +232,27 @@ func runQuery(
 	webRoutePrefix string,
 	webExternalPrefix string,
 	webPrefixHeaderName string,
+	flags map[string]string,
 	maxConcurrentQueries int,
 	queryTimeout time.Duration,
 	storeResponseTimeout time.Duration,
+	maxQueryMemoryBytes uint64,
 	replicaLabels []string,
 	selectorLset labels.Labels,
 	storeAddrs []string,
 	enableAutodownsampling bool,
 	enablePartialResponse bool,
+	skipCorruptChunks bool,
+	verifyChunkChecksums bool,
 	fileSD *file.Discovery,
 	dnsSDInterval time.Duration,
 	dnsSDResolver string,
 	unhealthyStoreTimeout time.Duration,
 	instantDefaultMaxSourceResolution time.Duration,
 	strictStores []string,
+	alertmgrsConfigYAML []byte,
+	alertmgrsDNSSDInterval time.Duration,
+	slowQueryLog *querylog.SlowQueryLog,
 	comp component.Component,
 ) error {
 	// TODO(bplotka in PR #513 review): Move arguments into struct.
@@ -253,8 +300,8 @@ func runQuery(
 			dialOpts,
 			unhealthyStoreTimeout,
 		)
-		proxy            = store.NewProxyStore(logger, reg, stores.Get, component.Query, selectorLset, storeResponseTimeout)
-		queryableCreator = query.NewQueryableCreator(logger, proxy)
+		proxy            = store.NewProxyStore(logger, reg, stores.Get, component.Query, selectorLset, storeResponseTimeout, verifyChunkChecksums, maxQueryMemoryBytes)
+		queryableCreator = query.NewQueryableCreator(logger, proxy, skipCorruptChunks)
 		engine           = promql.NewEngine(
 			promql.EngineOpts{
 				Logger:        logger,
@@ -327,6 +374,39 @@ func runQuery(
 		})
 	}
 
+	// Optionally proxy Alertmanager API reads to the configured Alertmanager clusters.
+	var alertmgrsProxy *alert.Proxy
+	if len(alertmgrsConfigYAML) > 0 {
+		alertingCfg, err := alert.LoadAlertingConfig(alertmgrsConfigYAML)
+		if err != nil {
+			return errors.Wrap(err, "parse alertmanagers config")
+		}
+
+		amProvider := dns.NewProvider(
+			logger,
+			extprom.WrapRegistererWithPrefix("thanos_querier_alertmanagers_", reg),
+			dns.ResolverType(dnsSDResolver),
+		)
+		var alertmgrs []*alert.Alertmanager
+		for _, cfg := range alertingCfg.Alertmanagers {
+			c, err := http_util.NewHTTPClient(cfg.HTTPClientConfig, "alertmanager")
+			if err != nil {
+				return err
+			}
+			c.Transport = tracing.HTTPTripperware(logger, c.Transport)
+			// Each Alertmanager client has a different list of targets thus each needs its own DNS provider.
+			amClient, err := http_util.NewClient(logger, cfg.EndpointsConfig, c, amProvider.Clone())
+			if err != nil {
+				return err
+			}
+			// Discover and resolve Alertmanager addresses.
+			addDiscoveryGroups(g, amClient, alertmgrsDNSSDInterval)
+
+			alertmgrs = append(alertmgrs, alert.NewAlertmanager(logger, amClient, time.Duration(cfg.Timeout), cfg.APIVersion))
+		}
+		alertmgrsProxy = alert.NewProxy(logger, alertmgrs)
+	}
+
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -352,11 +432,16 @@ func runQuery(
 
 		ins := extpromhttp.NewInstrumentationMiddleware(reg)
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
-		ui.NewQueryUI(logger, reg, stores, webExternalPrefix, webPrefixHeaderName).Register(router, ins)
+		ui.NewQueryUI(logger, reg, stores, flags, webExternalPrefix, webPrefixHeaderName).Register(router, ins)
 
-		api := v1.NewAPI(logger, reg, engine, queryableCreator, enableAutodownsampling, enablePartialResponse, replicaLabels, instantDefaultMaxSourceResolution)
+		api := v1.NewAPI(logger, reg, engine, queryableCreator, stores.Get, stores.GetStoreStatus, enableAutodownsampling, enablePartialResponse, replicaLabels, selectorLset, instantDefaultMaxSourceResolution, slowQueryLog)
 
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins)
+		api.RegisterFederation(router, tracer, logger, ins)
+
+		if alertmgrsProxy != nil {
+			alertmgrsProxy.Register(router.WithPrefix("/alertmanager"), ins)
+		}
 
 		srv := httpserver.New(logger, reg, comp, httpProbe,
 			httpserver.WithListen(httpBindAddr),
@@ -373,6 +458,9 @@ func runQuery(
 			defer statusProber.NotHealthy(err)
 
 			srv.Shutdown(err)
+			if slowQueryLog != nil {
+				runutil.CloseWithLogOnErr(logger, slowQueryLog, "slow query log")
+			}
 		})
 	}
 	// Start query (proxy) gRPC StoreAPI.
@@ -386,6 +474,9 @@ func runQuery(
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
+			grpcserver.WithServer(func(srv *grpc.Server) {
+				rulespb.RegisterRulesServer(srv, rules.NewProxy(logger, stores.GetRulesClients))
+			}),
 		)
 
 		g.Add(func() error {
@@ -0,0 +1,218 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/run"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/extflag"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/prober"
+	"github.com/thanos-io/thanos/pkg/queryfrontend"
+	"github.com/thanos-io/thanos/pkg/querylog"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+)
+
+func registerQueryFrontend(m map[string]setupFunc, app *kingpin.Application) {
+	comp := component.QueryFrontend
+	cmd := app.Command(comp.String(), "Query frontend in front of queriers, caching responses of range queries.")
+
+	httpBindAddr, httpGracePeriod := regHTTPFlags(cmd)
+
+	downstreamURL := cmd.Flag("query-frontend.downstream-url", "URL of the querier, or of a load balancer in front of queriers, queries are sent to.").
+		Default("http://localhost:9090").String()
+
+	splitInterval := modelDuration(cmd.Flag("query-range.split-interval", "Split range queries at multiples of this interval, so that long queries are executed in parallel and the responses of their parts are cached separately. 0 disables splitting.").
+		Default("24h"))
+	maxSplitConcurrency := cmd.Flag("query-range.max-split-concurrency", "Maximum number of parts of a split range query executed concurrently.").
+		Default("14").Int()
+
+	shards := cmd.Flag("query-range.shards", "Execute range queries whose aggregations group by common labels, e.g. sum by (pod), as this number of shards in parallel. Queriers must support sharding. 0 or 1 disables sharding.").
+		Default("0").Int()
+
+	maxRetries := cmd.Flag("query-range.max-retries", "Maximum number of retries of a range query failed by the querier with a retryable error, e.g. because the querier restarts. 0 disables retries.").
+		Default("5").Int()
+	retryMinBackoff := modelDuration(cmd.Flag("query-range.retry-min-backoff", "Backoff before the first retry of a range query. It doubles with every retry.").
+		Default("100ms"))
+	retryMaxBackoff := modelDuration(cmd.Flag("query-range.retry-max-backoff", "Maximum backoff before retries of a range query.").
+		Default("5s"))
+
+	instantSplitInterval := modelDuration(cmd.Flag("query-instant.split-interval", "Split instant queries of functions over time of a range longer than this interval, e.g. sum_over_time(up[30d]), into queries of parts of the range of this length executed in parallel. 0 disables splitting.").
+		Default("0s"))
+	instantSplitFunctions := cmd.Flag("query-instant.split-functions", "Functions over time instant queries are split by. Only count_over_time, max_over_time, min_over_time and sum_over_time are supported.").
+		Default(queryfrontend.SplittableFunctions()...).Strings()
+
+	metadataCacheAlignment := modelDuration(cmd.Flag("query-frontend.metadata-cache-alignment", "Cache responses of label names, label values and series requests in the response cache, extending their time range to multiples of this interval, so that requests at slightly different times share responses. 0 disables caching of these responses.").
+		Default("1h"))
+
+	slowQueryLogFlags := regSlowQueryLogFlags(cmd)
+
+	responseCacheConfig := extflag.RegisterPathOrContent(cmd, "query-range.response-cache-config", "YAML file that contains the configuration of the cache of range query responses. Responses are not cached if empty. See format details: https://thanos.io/components/query-frontend.md/#caching", false)
+
+	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		u, err := url.Parse(*downstreamURL)
+		if err != nil {
+			return errors.Wrap(err, "parse downstream URL")
+		}
+
+		if *maxSplitConcurrency <= 0 {
+			return errors.New("--query-range.max-split-concurrency must be positive")
+		}
+
+		retryConfig := queryfrontend.RetryConfig{
+			MaxRetries: *maxRetries,
+			MinBackoff: time.Duration(*retryMinBackoff),
+			MaxBackoff: time.Duration(*retryMaxBackoff),
+		}
+		if err := retryConfig.Validate(); err != nil {
+			return errors.Wrap(err, "validate retry flags")
+		}
+
+		slowQueryLog, err := slowQueryLogFlags.slowQueryLog(logger, reg)
+		if err != nil {
+			return err
+		}
+
+		cacheContentYaml, err := responseCacheConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		return runQueryFrontend(
+			g,
+			logger,
+			reg,
+			*httpBindAddr,
+			time.Duration(*httpGracePeriod),
+			u,
+			time.Duration(*splitInterval),
+			*maxSplitConcurrency,
+			*shards,
+			retryConfig,
+			queryfrontend.InstantSplitConfig{
+				Interval:    time.Duration(*instantSplitInterval),
+				Functions:   *instantSplitFunctions,
+				Concurrency: *maxSplitConcurrency,
+			},
+			slowQueryLog,
+			time.Duration(*metadataCacheAlignment),
+			cacheContentYaml,
+			comp,
+		)
+	}
+}
+
+func runQueryFrontend(
+	g *run.Group,
+	logger log.Logger,
+	reg *prometheus.Registry,
+	httpBindAddr string,
+	httpGracePeriod time.Duration,
+	downstreamURL *url.URL,
+	splitInterval time.Duration,
+	maxSplitConcurrency int,
+	shards int,
+	retryConfig queryfrontend.RetryConfig,
+	instantSplitConfig queryfrontend.InstantSplitConfig,
+	slowQueryLog *querylog.SlowQueryLog,
+	metadataCacheAlignment time.Duration,
+	cacheContentYaml []byte,
+	comp component.Component,
+) error {
+	var (
+		middlewares []queryfrontend.Middleware
+		cache       queryfrontend.Cache
+		cacheConfig queryfrontend.ResponseCacheConfig
+	)
+	// Queries are split before responses are cached, so that the responses of their parts are cached separately.
+	if splitInterval > 0 {
+		middlewares = append(middlewares, queryfrontend.NewSplitByIntervalMiddleware(reg, splitInterval, maxSplitConcurrency))
+	}
+	if len(cacheContentYaml) > 0 {
+		var err error
+		if cacheConfig, err = queryfrontend.ParseResponseCacheConfig(cacheContentYaml); err != nil {
+			return errors.Wrap(err, "parse response cache config")
+		}
+		if cache, err = queryfrontend.NewCache(logger, reg, cacheConfig); err != nil {
+			return err
+		}
+		middlewares = append(middlewares, queryfrontend.NewResultsCacheMiddleware(logger, reg, cache, cacheConfig))
+	}
+	// Queries are sharded after responses are cached, so that their merged responses are cached.
+	if shards > 1 {
+		middlewares = append(middlewares, queryfrontend.NewShardingMiddleware(logger, reg, shards))
+	}
+	// Queries are retried last, so that only failed parts or shards of queries are retried.
+	if retryConfig.MaxRetries > 0 {
+		middlewares = append(middlewares, queryfrontend.NewRetryMiddleware(logger, reg, retryConfig))
+	}
+
+	client := &http.Client{Transport: http.DefaultTransport}
+	var frontend http.Handler = queryfrontend.NewFrontend(
+		log.With(logger, "component", comp.String()),
+		downstreamURL,
+		client,
+		queryfrontend.MergeMiddlewares(middlewares...),
+	)
+	if cache != nil && metadataCacheAlignment > 0 {
+		frontend = queryfrontend.NewMetadataCache(logger, reg, cache, cacheConfig, metadataCacheAlignment, frontend)
+	}
+	if instantSplitConfig.Interval > 0 && len(instantSplitConfig.Functions) > 0 {
+		// Parts of split instant queries are executed as range queries through the same middlewares, so that they are
+		// retried and their responses cached.
+		rangeQueries := queryfrontend.MergeMiddlewares(middlewares...)(queryfrontend.NewDownstream(logger, client, downstreamURL))
+		var err error
+		if frontend, err = queryfrontend.NewInstantSplitter(logger, reg, rangeQueries, instantSplitConfig, frontend); err != nil {
+			return errors.Wrap(err, "create instant query splitter")
+		}
+	}
+	if slowQueryLog != nil {
+		frontend = queryfrontend.NewSlowQueryLogger(slowQueryLog, frontend)
+	}
+
+	httpProbe := prober.NewHTTP()
+	statusProber := prober.Combine(
+		httpProbe,
+		prober.NewInstrumentation(comp, logger, extprom.WrapRegistererWithPrefix("thanos_", reg)),
+	)
+
+	srv := httpserver.New(logger, reg, comp, httpProbe,
+		httpserver.WithListen(httpBindAddr),
+		httpserver.WithGracePeriod(httpGracePeriod),
+	)
+	srv.Handle("/", frontend)
+
+	g.Add(func() error {
+		statusProber.Healthy()
+		statusProber.Ready()
+
+		return srv.ListenAndServe()
+	}, func(err error) {
+		statusProber.NotReady(err)
+		defer statusProber.NotHealthy(err)
+
+		srv.Shutdown(err)
+		if cache != nil {
+			cache.Stop()
+		}
+		if slowQueryLog != nil {
+			runutil.CloseWithLogOnErr(logger, slowQueryLog, "slow query log")
+		}
+	})
+
+	level.Info(logger).Log("msg", "starting query frontend", "downstream", downstreamURL.String())
+	return nil
+}
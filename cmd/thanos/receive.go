@@ -6,25 +6,33 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/run"
+	"github.com/oklog/ulid"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage/tsdb"
+	"google.golang.org/grpc"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
-	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/receive"
@@ -34,8 +42,12 @@ import (
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/tls"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
+// shadowDNSInterval is the interval between DNS resolutions of shadow endpoints.
+const shadowDNSInterval = 30 * time.Second
+
 func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 	comp := component.Receive
 	cmd := app.Command(comp.String(), "Accept Prometheus remote write API requests and write to local tsdb (EXPERIMENTAL, this may change drastically without notice)")
@@ -56,9 +68,10 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 	dataDir := cmd.Flag("tsdb.path", "Data directory of TSDB.").
 		Default("./data").String()
 
-	labelStrs := cmd.Flag("label", "External labels to announce. This flag will be removed in the future when handling multiple tsdb instances is added.").PlaceHolder("key=\"value\"").Strings()
+	labelStrs := cmd.Flag("label", "External labels to announce. The tenant label is added to them for the TSDB of every tenant.").PlaceHolder("key=\"value\"").Strings()
 
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", false)
+	uploadLimits := regShipperUploadLimitFlags(cmd)
 
 	retention := modelDuration(cmd.Flag("tsdb.retention", "How long to retain raw samples on local storage. 0d - disables this retention").Default("15d"))
 
@@ -68,13 +81,48 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 	refreshInterval := modelDuration(cmd.Flag("receive.hashrings-file-refresh-interval", "Refresh interval to re-read the hashring configuration file. (used as a fallback)").
 		Default("5m"))
 
+	transitionPeriod := modelDuration(cmd.Flag("receive.hashrings-transition-period", "How long time series whose endpoint changed with a new hashring configuration are also written to their previous endpoint, while all receivers converge on the new configuration. Receivers which joined the hashring are not ready during this period, but keep accepting write requests. 0s disables dual routing.").
+		Default("1m"))
+
 	local := cmd.Flag("receive.local-endpoint", "Endpoint of local receive node. Used to identify the local node in the hashring configuration.").String()
 
 	tenantHeader := cmd.Flag("receive.tenant-header", "HTTP header to determine tenant for write requests.").Default(receive.DefaultTenantHeader).String()
 
+	defaultTenantID := cmd.Flag("receive.default-tenant-id", "Default tenant ID to use when none is provided via a header.").Default(receive.DefaultTenant).String()
+
+	tenantLabelName := cmd.Flag("receive.tenant-label-name", "Label name through which the tenant will be announced.").Default(receive.DefaultTenantLabel).String()
+
 	replicaHeader := cmd.Flag("receive.replica-header", "HTTP header specifying the replica number of a write request.").Default(receive.DefaultReplicaHeader).String()
 
-	replicationFactor := cmd.Flag("receive.replication-factor", "How many times to replicate incoming write requests.").Default("1").Uint64()
+	replicationFactor := cmd.Flag("receive.replication-factor", "How many times to replicate incoming write requests. A write request succeeds once a quorum of (replication factor / 2 + 1) replicas stored it, otherwise it fails with a retryable status code.").Default("1").Uint64()
+
+	limitsConfig := extflag.RegisterPathOrContent(cmd, "receive.limits-config", "YAML file that contains ingestion limits of tenants, enforced on write requests received from clients.", false)
+
+	maxConcurrentRequests := cmd.Flag("receive.max-concurrent-requests", "Maximum number of write requests handled at once. Requests above it are rejected with 429 before they are read. 0 means no limit.").Default("0").Int()
+
+	maxRequestBodySize := cmd.Flag("receive.max-request-body-size", "Maximum size of the compressed body of a write request. Larger requests are rejected with 429. Limits of tenants can be lower. 0 means no limit.").Default("0").Bytes()
+
+	shadowConfig := extflag.RegisterPathOrContent(cmd, "receive.shadow-config", "YAML file that contains remote write endpoints that write requests accepted from clients are additionally written to, e.g. to evaluate another storage or to migrate to it.", false)
+
+	tenantsConfig := extflag.RegisterPathOrContent(cmd, "receive.tenants-config", "YAML file that contains TSDB options of tenants, overriding the TSDB flags.", false)
+
+	tenantIdleTimeout := modelDuration(cmd.Flag("receive.tenant-idle-timeout", "How long a tenant can receive no writes before its TSDB is flushed, uploaded, closed and deleted locally. 0s disables it. Has effect only if uploads are enabled.").Default("0s"))
+
+	antiEntropyInterval := modelDuration(cmd.Flag("receive.anti-entropy.interval", "How often recently written series are compared with other replicas of the same hashring slot and data missing on them is replicated again. 0s disables anti-entropy. Has effect only with replication factor greater than 1.").Default("0s"))
+
+	antiEntropyWindow := modelDuration(cmd.Flag("receive.anti-entropy.window", "Length of the time range compared with other replicas on every anti-entropy run.").Default("10m"))
+
+	antiEntropyDelay := modelDuration(cmd.Flag("receive.anti-entropy.delay", "How old the newest data compared by anti-entropy is. Data more recent than this may still be in flight.").Default("2m"))
+
+	antiEntropyMaxTrackedSeries := cmd.Flag("receive.anti-entropy.max-tracked-series", "Maximum number of recently written series remembered for comparison with other replicas. Series written while the limit is reached are not compared.").
+		Default("1000000").Int()
+
+	forwardCompression := cmd.Flag("receive.forward.compression", "Compression algorithm of write requests forwarded to other receivers. All receivers must run a version that supports the algorithm.").
+		Default(receive.NoCompression).Enum(receive.ForwardCompressions...)
+
+	forwardKeepaliveTime := modelDuration(cmd.Flag("receive.forward.keepalive-time", "How long a connection to another receiver can be idle before it is checked with a ping, keeping it open for reuse by forwarded requests. Receivers accept pings of this frequency, so all receivers should use the same value. 0s disables pings.").Default("0s"))
+
+	forwardKeepaliveTimeout := modelDuration(cmd.Flag("receive.forward.keepalive-timeout", "How long to wait for a response to a ping before the connection to another receiver is closed.").Default("20s"))
 
 	tsdbMinBlockDuration := modelDuration(cmd.Flag("tsdb.min-block-duration", "Min duration for local TSDB blocks").Default("2h").Hidden())
 	tsdbMaxBlockDuration := modelDuration(cmd.Flag("tsdb.max-block-duration", "Max duration for local TSDB blocks").Default("2h").Hidden())
@@ -82,12 +130,20 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 
 	walCompression := cmd.Flag("tsdb.wal-compression", "Compress the tsdb WAL.").Default("true").Bool()
 
+	outOfOrderWindow := modelDuration(cmd.Flag("tsdb.out-of-order.time-window", "How much older than the newest sample of a tenant samples can be to be accepted, even if they are out of order or too old for the TSDB head. Such samples are logged to a WAL, buffered in memory and become queryable once written to separate blocks, after the head moved past them. These blocks overlap other blocks, so uploaded ones require vertical compaction to be enabled in the compactor. 0s disables it.").Default("0s"))
+
+	maxExemplars := cmd.Flag("tsdb.max-exemplars", "Maximum number of exemplars kept in memory per tenant. Once reached, every new exemplar evicts the oldest one. Exemplars are lost on restart. 0 disables storing exemplars.").Default("0").Int64()
+
 	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		lset, err := parseFlagLabels(*labelStrs)
 		if err != nil {
 			return errors.Wrap(err, "parse labels")
 		}
 
+		if *replicationFactor == 0 {
+			return errors.New("--receive.replication-factor must be at least 1")
+		}
+
 		var cw *receive.ConfigWatcher
 		if *hashringsFile != "" {
 			cw, err = receive.NewConfigWatcher(log.With(logger, "component", "config-watcher"), reg, *hashringsFile, *refreshInterval)
@@ -102,6 +158,8 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 			RetentionDuration: *retention,
 			NoLockfile:        true,
 			WALCompression:    *walCompression,
+			// Blocks of out-of-order samples overlap blocks cut from the head.
+			AllowOverlappingBlocks: *outOfOrderWindow > 0,
 		}
 
 		// Local is empty, so try to generate a local endpoint
@@ -116,6 +174,56 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 			*local = fmt.Sprintf("http://%s:%s/api/v1/receive", hostname, port)
 		}
 
+		limitsContentYaml, err := limitsConfig.Content()
+		if err != nil {
+			return err
+		}
+		var limits *receive.LimitsConfig
+		if len(limitsContentYaml) > 0 {
+			if limits, err = receive.ParseLimitsConfig(limitsContentYaml); err != nil {
+				return err
+			}
+		}
+
+		shadowContentYaml, err := shadowConfig.Content()
+		if err != nil {
+			return err
+		}
+		var shadows []receive.ShadowConfig
+		if len(shadowContentYaml) > 0 {
+			if shadows, err = receive.ParseShadowConfigs(shadowContentYaml); err != nil {
+				return err
+			}
+		}
+
+		tenantsContentYaml, err := tenantsConfig.Content()
+		if err != nil {
+			return err
+		}
+		var tenants *receive.TenantsConfig
+		if len(tenantsContentYaml) > 0 {
+			if tenants, err = receive.ParseTenantsConfig(tenantsContentYaml); err != nil {
+				return err
+			}
+		}
+
+		var antiEntropy *receive.AntiEntropyOptions
+		if *antiEntropyInterval != 0 && *replicationFactor > 1 {
+			antiEntropy = &receive.AntiEntropyOptions{
+				Interval:         time.Duration(*antiEntropyInterval),
+				Window:           time.Duration(*antiEntropyWindow),
+				Delay:            time.Duration(*antiEntropyDelay),
+				BatchSize:        receive.DefaultAntiEntropyBatchSize,
+				MaxTrackedSeries: *antiEntropyMaxTrackedSeries,
+			}
+		}
+
+		forward := &receive.ForwardOptions{
+			Compression:      *forwardCompression,
+			KeepaliveTime:    time.Duration(*forwardKeepaliveTime),
+			KeepaliveTimeout: time.Duration(*forwardKeepaliveTimeout),
+		}
+
 		return runReceive(
 			g,
 			logger,
@@ -138,14 +246,28 @@ func registerReceive(m map[string]setupFunc, app *kingpin.Application) {
 			*rwClientServerName,
 			*dataDir,
 			objStoreConfig,
+			uploadLimits,
 			tsdbOpts,
+			tenants,
+			*maxExemplars,
+			time.Duration(*outOfOrderWindow),
+			time.Duration(*tenantIdleTimeout),
 			*ignoreBlockSize,
 			lset,
 			cw,
 			*local,
 			*tenantHeader,
+			*defaultTenantID,
+			*tenantLabelName,
 			*replicaHeader,
 			*replicationFactor,
+			time.Duration(*transitionPeriod),
+			antiEntropy,
+			limits,
+			*maxConcurrentRequests,
+			int64(*maxRequestBodySize),
+			forward,
+			shadows,
 			comp,
 		)
 	}
@@ -173,20 +295,33 @@ func runReceive(
 	rwClientServerName string,
 	dataDir string,
 	objStoreConfig *extflag.PathOrContent,
+	uploadLimits *shipperUploadLimits,
 	tsdbOpts *tsdb.Options,
+	tenants *receive.TenantsConfig,
+	maxExemplars int64,
+	outOfOrderWindow time.Duration,
+	tenantIdleTimeout time.Duration,
 	ignoreBlockSize bool,
 	lset labels.Labels,
 	cw *receive.ConfigWatcher,
 	endpoint string,
 	tenantHeader string,
+	defaultTenantID string,
+	tenantLabelName string,
 	replicaHeader string,
 	replicationFactor uint64,
+	transitionPeriod time.Duration,
+	antiEntropy *receive.AntiEntropyOptions,
+	limits *receive.LimitsConfig,
+	maxConcurrentRequests int,
+	maxRequestBodyBytes int64,
+	forward *receive.ForwardOptions,
+	shadowConfigs []receive.ShadowConfig,
 	comp component.SourceStoreAPI,
 ) error {
 	logger = log.With(logger, "component", "receive")
 	level.Warn(logger).Log("msg", "setting up receive; the Thanos receive component is EXPERIMENTAL, it may break significantly without notice")
 
-	localStorage := &tsdb.ReadyStorage{}
 	rwTLSConfig, err := tls.NewServerConfig(log.With(logger, "protocol", "HTTP"), rwServerCert, rwServerKey, rwServerClientCA)
 	if err != nil {
 		return err
@@ -196,18 +331,6 @@ func runReceive(
 		return err
 	}
 
-	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
-		ListenAddress:     rwAddress,
-		Registry:          reg,
-		Endpoint:          endpoint,
-		TenantHeader:      tenantHeader,
-		ReplicaHeader:     replicaHeader,
-		ReplicationFactor: replicationFactor,
-		Tracer:            tracer,
-		TLSConfig:         rwTLSConfig,
-		DialOpts:          dialOpts,
-	})
-
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -226,14 +349,114 @@ func runReceive(
 		upload = false
 	}
 
-	if upload && tsdbOpts.MinBlockDuration != tsdbOpts.MaxBlockDuration {
-		if !ignoreBlockSize {
-			return errors.Errorf("found that TSDB Max time is %s and Min time is %s. "+
-				"Compaction needs to be disabled (tsdb.min-block-duration = tsdb.max-block-duration)", tsdbOpts.MaxBlockDuration, tsdbOpts.MinBlockDuration)
+	if upload {
+		for tenant, opts := range tenants.AllTSDBOptions(tsdbOpts) {
+			if opts.MinBlockDuration == opts.MaxBlockDuration {
+				continue
+			}
+			if !ignoreBlockSize {
+				if tenant != "" {
+					return errors.Errorf("found that TSDB Max time is %s and Min time is %s for tenant %s. "+
+						"Compaction needs to be disabled (min_block_duration = max_block_duration)", opts.MaxBlockDuration, opts.MinBlockDuration, tenant)
+				}
+				return errors.Errorf("found that TSDB Max time is %s and Min time is %s. "+
+					"Compaction needs to be disabled (tsdb.min-block-duration = tsdb.max-block-duration)", opts.MaxBlockDuration, opts.MinBlockDuration)
+			}
+			level.Warn(logger).Log("msg", "flag to ignore min/max block duration flags differing is being used. If the upload of a 2h block fails and a tsdb compaction happens that block may be missing from your Thanos bucket storage.")
+			break
+		}
+	} else if tenantIdleTimeout > 0 {
+		level.Warn(logger).Log("msg", "uploads are disabled, idle tenants will not be pruned")
+	}
+
+	var bkt objstore.Bucket
+	if upload {
+		// The background shipper continuously scans the data directories of all tenants and uploads
+		// new blocks to Google Cloud Storage or an S3-compatible storage service.
+		bkt, err = client.NewBucket(logger, confContentYaml, reg, comp.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Receivers without tenants stored their TSDB directly in the data directory.
+	if err := migrateLegacyStorage(logger, dataDir, defaultTenantID); err != nil {
+		return errors.Wrapf(err, "migrate legacy storage in %v to default tenant %v", dataDir, defaultTenantID)
+	}
+
+	dbs := receive.NewMultiTSDB(
+		dataDir,
+		log.With(logger, "component", "tsdb"),
+		reg,
+		tsdbOpts,
+		tenants,
+		maxExemplars,
+		outOfOrderWindow,
+		lset,
+		tenantLabelName,
+		bkt,
+		uploadLimits.options(),
+	)
+
+	var limiter *receive.Limiter
+	if limits != nil {
+		limiter = receive.NewLimiter(reg, limits, dbs)
+	}
+
+	var shadows []*receive.Shadow
+	if len(shadowConfigs) > 0 {
+		shadowProvider := dns.NewProvider(
+			logger,
+			extprom.WrapRegistererWithPrefix("thanos_receive_shadow_", reg),
+			dns.GolangResolverType,
+		)
+		for _, cfg := range shadowConfigs {
+			c, err := http_util.NewHTTPClient(cfg.RemoteWrite.HTTPClientConfig, "receive-shadow")
+			if err != nil {
+				return err
+			}
+			c.Transport = tracing.HTTPTripperware(logger, c.Transport)
+			shadowClient, err := http_util.NewClient(logger, cfg.RemoteWrite.EndpointsConfig, c, shadowProvider.Clone())
+			if err != nil {
+				return err
+			}
+			// Discover and resolve shadow addresses.
+			addDiscoveryGroups(g, shadowClient, shadowDNSInterval)
+
+			s := receive.NewShadow(logger, reg, cfg, shadowClient)
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				s.Run(ctx)
+				return nil
+			}, func(error) {
+				cancel()
+			})
+			shadows = append(shadows, s)
 		}
-		level.Warn(logger).Log("msg", "flag to ignore min/max block duration flags differing is being used. If the upload of a 2h block fails and a tsdb compaction happens that block may be missing from your Thanos bucket storage.")
 	}
 
+	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
+		ListenAddress:     rwAddress,
+		Registry:          reg,
+		Endpoint:          endpoint,
+		TenantHeader:      tenantHeader,
+		DefaultTenantID:   defaultTenantID,
+		ReplicaHeader:     replicaHeader,
+		ReplicationFactor: replicationFactor,
+		Tracer:            tracer,
+		TLSConfig:         rwTLSConfig,
+		DialOpts:          dialOpts,
+		AntiEntropy:       antiEntropy,
+		Limiter:           limiter,
+
+		MaxConcurrentRequests: maxConcurrentRequests,
+		MaxRequestBodyBytes:   maxRequestBodyBytes,
+
+		HashringTransitionPeriod: transitionPeriod,
+		Forward:                  forward,
+		Shadows:                  shadows,
+	})
+
 	// Start all components while we wait for TSDB to open but only load
 	// initial config and mark ourselves as ready after it completed.
 
@@ -250,24 +473,17 @@ func runReceive(
 	{
 		// TSDB.
 		cancel := make(chan struct{})
-		startTimeMargin := int64(2 * time.Duration(tsdbOpts.MinBlockDuration).Seconds() * 1000)
 		g.Add(func() error {
 			defer close(dbReady)
 			defer close(uploadC)
 
 			// Before actually starting, we need to make sure the
-			// WAL is flushed. The WAL is flushed after the
+			// WALs are flushed. The WALs are flushed after the
 			// hashring is loaded.
-			db := receive.NewFlushableStorage(
-				dataDir,
-				log.With(logger, "component", "tsdb"),
-				reg,
-				tsdbOpts,
-			)
 
-			// Before quitting, ensure the WAL is flushed and the DB is closed.
+			// Before quitting, ensure the WALs are flushed and the DBs are closed.
 			defer func() {
-				if err := db.Flush(); err != nil {
+				if err := dbs.Flush(); err != nil {
 					level.Warn(logger).Log("err", err, "msg", "failed to flush storage")
 				}
 			}()
@@ -283,10 +499,10 @@ func runReceive(
 
 					level.Info(logger).Log("msg", "updating DB")
 
-					if err := db.Flush(); err != nil {
+					if err := dbs.Flush(); err != nil {
 						return errors.Wrap(err, "flushing storage")
 					}
-					if err := db.Open(); err != nil {
+					if err := dbs.Open(); err != nil {
 						return errors.Wrap(err, "opening storage")
 					}
 					if upload {
@@ -294,10 +510,12 @@ func runReceive(
 						<-uploadDone
 					}
 					level.Info(logger).Log("msg", "tsdb started")
-					localStorage.Set(db.Get(), startTimeMargin)
-					webHandler.SetWriter(receive.NewWriter(log.With(logger, "component", "receive-writer"), localStorage))
-					statusProber.Ready()
-					level.Info(logger).Log("msg", "server is ready to receive web requests")
+					webHandler.SetWriter(receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs))
+					// A hashring changed meanwhile marks the server as ready once receivers converged on it.
+					if webHandler.Converged() {
+						statusProber.Ready()
+						level.Info(logger).Log("msg", "server is ready to receive web requests")
+					}
 					dbReady <- struct{}{}
 				}
 			}
@@ -343,18 +561,42 @@ func runReceive(
 		cancel := make(chan struct{})
 		g.Add(func() error {
 			defer close(updateDB)
+			var (
+				loaded    bool
+				converged <-chan time.Time
+			)
 			for {
 				select {
 				case h, ok := <-updates:
 					if !ok {
 						return nil
 					}
-					webHandler.SetWriter(nil)
-					webHandler.Hashring(h)
-					msg := "hashring has changed; server is not ready to receive web requests."
-					statusProber.NotReady(errors.New(msg))
-					level.Info(logger).Log("msg", msg)
+					joined := webHandler.Hashring(h)
+					// Later changes are applied without flushing the storage, so that in-flight
+					// requests are not dropped. A server which joined the hashring is marked as not
+					// ready until receivers converged on the new hashring, but keeps accepting write
+					// requests. Members of the previous hashring stay ready.
+					if loaded {
+						if joined {
+							msg := "joined the hashring; server is not ready until receivers converged on the new hashring"
+							statusProber.NotReady(errors.New(msg))
+							level.Info(logger).Log("msg", msg)
+							converged = time.After(transitionPeriod)
+							continue
+						}
+						level.Info(logger).Log("msg", "hashring has changed; routing write requests with the new hashring")
+						continue
+					}
+					loaded = true
+					level.Info(logger).Log("msg", "hashring has been loaded; opening storage")
 					updateDB <- struct{}{}
+				case <-converged:
+					converged = nil
+					// The storage marks the server as ready once it is open otherwise.
+					if webHandler.Converged() {
+						statusProber.Ready()
+						level.Info(logger).Log("msg", "receivers converged on the new hashring; server is ready to receive web requests")
+					}
 				case <-cancel:
 					return nil
 				}
@@ -397,9 +639,9 @@ func runReceive(
 				if s != nil {
 					s.Shutdown(errors.New("reload hashrings"))
 				}
-				tsdbStore := store.NewTSDBStore(log.With(logger, "component", "thanos-tsdb-store"), nil, localStorage.Get(), comp, lset)
+				multiStore := store.NewMultiTSDBStore(log.With(logger, "component", "thanos-multi-tsdb-store"), nil, comp, dbs.TSDBStores)
 				rw := store.ReadWriteTSDBStore{
-					StoreServer:          tsdbStore,
+					StoreServer:          multiStore,
 					WriteableStoreServer: webHandler,
 				}
 
@@ -407,6 +649,11 @@ func runReceive(
 					grpcserver.WithListen(grpcBindAddr),
 					grpcserver.WithGracePeriod(grpcGracePeriod),
 					grpcserver.WithTLSConfig(tlsCfg),
+					grpcserver.WithServerOptions(forward.ServerOptions()...),
+					grpcserver.WithServer(func(srv *grpc.Server) {
+						receive.RegisterChecksumServer(srv, receive.NewChecksumServer(log.With(logger, "component", "receive-checksum"), dbs))
+						exemplarspb.RegisterExemplarsServer(srv, exemplars.NewMultiTSDB(dbs.ExemplarsTSDBs))
+					}),
 				)
 				startGRPC <- struct{}{}
 			}
@@ -427,6 +674,16 @@ func runReceive(
 		}, func(error) {})
 	}
 
+	if antiEntropy != nil {
+		level.Debug(logger).Log("msg", "setting up receive anti-entropy")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return webHandler.RunAntiEntropy(ctx, dbs)
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	level.Debug(logger).Log("msg", "setting up receive http handler")
 	{
 		g.Add(
@@ -439,28 +696,48 @@ func runReceive(
 		)
 	}
 
-	if upload {
-		// The background shipper continuously scans the data directory and uploads
-		// new blocks to Google Cloud Storage or an S3-compatible storage service.
-		bkt, err := client.NewBucket(logger, confContentYaml, reg, comp.String())
-		if err != nil {
-			return err
-		}
+	if outOfOrderWindow > 0 {
+		// Write buffered out-of-order samples to blocks in a loop.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+				if err := dbs.FlushOutOfOrder(ctx); err != nil {
+					level.Warn(logger).Log("msg", "failed to flush out-of-order samples", "err", err)
+				}
 
-		s := shipper.New(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, metadata.ReceiveSource)
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
 
-		// Before starting, ensure any old blocks are uploaded.
-		if uploaded, err := s.Sync(context.Background()); err != nil {
-			level.Warn(logger).Log("err", err, "failed to upload", uploaded)
-		}
+	if upload {
+		// Old blocks of existing tenants are uploaded once their TSDBs are opened after the hashring is loaded.
 
 		{
 			// Run the uploader in a loop.
 			ctx, cancel := context.WithCancel(context.Background())
 			g.Add(func() error {
 				return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
-					if uploaded, err := s.Sync(ctx); err != nil {
-						level.Warn(logger).Log("err", err, "uploaded", uploaded)
+					if err := dbs.Sync(ctx); err != nil {
+						level.Warn(logger).Log("msg", "failed to upload", "err", err)
+					}
+
+					return nil
+				})
+			}, func(error) {
+				cancel()
+			})
+		}
+
+		if tenantIdleTimeout > 0 {
+			// Prune tenants that stopped writing, once their data is uploaded.
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+					if err := dbs.PruneIdle(ctx, tenantIdleTimeout); err != nil {
+						level.Warn(logger).Log("msg", "failed to prune idle tenants", "err", err)
 					}
 
 					return nil
@@ -481,8 +758,8 @@ func runReceive(
 				// Before quitting, ensure all blocks are uploaded.
 				defer func() {
 					<-uploadC
-					if uploaded, err := s.Sync(context.Background()); err != nil {
-						level.Warn(logger).Log("err", err, "failed to upload", uploaded)
+					if err := dbs.Sync(context.Background()); err != nil {
+						level.Warn(logger).Log("msg", "failed to upload", "err", err)
 					}
 				}()
 				defer close(uploadDone)
@@ -496,8 +773,8 @@ func runReceive(
 					case <-ctx.Done():
 						return nil
 					case <-uploadC:
-						if uploaded, err := s.Sync(ctx); err != nil {
-							level.Warn(logger).Log("err", err, "failed to upload", uploaded)
+						if err := dbs.Sync(ctx); err != nil {
+							level.Warn(logger).Log("msg", "failed to upload", "err", err)
 						}
 						uploadDone <- struct{}{}
 					}
@@ -511,3 +788,47 @@ func runReceive(
 	level.Info(logger).Log("msg", "starting receiver")
 	return nil
 }
+
+// migrateLegacyStorage moves the TSDB of a receiver without tenants, stored directly in the data directory, to the
+// data directory of the default tenant. Blocks, the WAL and the shipper meta file are moved.
+func migrateLegacyStorage(logger log.Logger, dataDir, defaultTenantID string) error {
+	defaultTenantDataDir := filepath.Join(dataDir, defaultTenantID)
+
+	if _, err := os.Stat(defaultTenantDataDir); !os.IsNotExist(err) {
+		return err
+	}
+	files, err := ioutil.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read data dir %v", dataDir)
+	}
+
+	var legacy []string
+	for _, f := range files {
+		if f.Name() == "wal" || f.Name() == shipper.MetaFilename {
+			legacy = append(legacy, f.Name())
+			continue
+		}
+		if _, err := ulid.Parse(f.Name()); err == nil && f.IsDir() {
+			legacy = append(legacy, f.Name())
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	level.Info(logger).Log("msg", "found legacy storage, migrating to default tenant", "tenant", defaultTenantID)
+	if err := os.MkdirAll(defaultTenantDataDir, 0777); err != nil {
+		return errors.Wrapf(err, "create default tenant data dir %v", defaultTenantDataDir)
+	}
+	for _, name := range legacy {
+		from := filepath.Join(dataDir, name)
+		to := filepath.Join(defaultTenantDataDir, name)
+		if err := os.Rename(from, to); err != nil {
+			return errors.Wrapf(err, "move %v to %v", from, to)
+		}
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ package main
 
 import (
 	"context"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -25,6 +24,7 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/storage/tsdb"
 	tsdberrors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/prometheus/prometheus/util/strutil"
@@ -35,13 +35,17 @@ import (
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/gate"
 	http_util "github.com/thanos-io/thanos/pkg/http"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/promclient"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/remotewrite"
 	thanosrule "github.com/thanos-io/thanos/pkg/rule"
 	v1 "github.com/thanos-io/thanos/pkg/rule/api"
+	ruleremotewrite "github.com/thanos-io/thanos/pkg/rule/remotewrite"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
@@ -51,6 +55,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"github.com/thanos-io/thanos/pkg/ui"
+	"google.golang.org/grpc"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -71,8 +76,14 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 		Default("rules/").Strings()
 	resendDelay := modelDuration(cmd.Flag("resend-delay", "Minimum amount of time to wait before resending an alert to Alertmanager.").
 		Default("1m"))
+	outageTolerance := modelDuration(cmd.Flag("for-outage-tolerance", "Max time to tolerate the Ruler being down to still restore the 'for' state of alerts.").
+		Default("1h"))
+	forGracePeriod := modelDuration(cmd.Flag("for-grace-period", "Minimum duration between alert and restored 'for' state. This is maintained only for alerts with configured 'for' time greater than the grace period.").
+		Default("10m"))
 	evalInterval := modelDuration(cmd.Flag("eval-interval", "The default evaluation interval to use.").
 		Default("30s"))
+	evalMaxConcurrent := cmd.Flag("eval.max-concurrent", "Maximum number of rule evaluation queries sent to query API servers concurrently, shared by all rule groups. Rule groups are evaluated in parallel, each in its own goroutine; this bounds the load they put on query API servers. 0 means no limit.").
+		Default("0").Int()
 	tsdbBlockDuration := modelDuration(cmd.Flag("tsdb.block-duration", "Block duration for TSDB block.").
 		Default("2h"))
 	tsdbRetention := modelDuration(cmd.Flag("tsdb.retention", "Block retention time on local disk.").
@@ -96,6 +107,9 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 	webPrefixHeaderName := cmd.Flag("web.prefix-header", "Name of HTTP request header used for dynamic prefixing of UI links and redirects. This option is ignored if web.external-prefix argument is set. Security risk: enable this option only if a reverse proxy in front of thanos is resetting the header. The --web.prefix-header=X-Forwarded-Prefix option can be useful, for example, if Thanos UI is served via Traefik reverse proxy with PathPrefixStrip option enabled, which sends the stripped prefix value in X-Forwarded-Prefix header. This allows thanos UI to be served on a sub-path.").Default("").String()
 
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", false)
+	uploadLimits := regShipperUploadLimitFlags(cmd)
+
+	remoteWriteConfig := extflag.RegisterPathOrContent(cmd, "remote-write.config", "YAML file that contains remote write configuration. If defined, ruler runs in stateless mode: evaluation results, including ALERTS and ALERTS_FOR_STATE series, are remote-written, e.g. to a receive hashring, instead of being stored in a local TSDB, and no Store API is served. See format details: https://thanos.io/components/rule.md/#stateless-mode", false)
 
 	queries := cmd.Flag("query", "Addresses of statically configured query API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect query API servers through respective DNS lookups.").
 		PlaceHolder("<query>").Strings()
@@ -114,11 +128,17 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 	dnsSDResolver := cmd.Flag("query.sd-dns-resolver", "Resolver to use. Possible options: [golang, miekgdns]").
 		Default("golang").Hidden().String()
 
+	queryHealthCheckInterval := modelDuration(cmd.Flag("query.health-check-interval", "Interval between health checks of query API servers. Servers failing a health check, or a rule evaluation query with a connection error or a 5xx response, are skipped until they pass a health check again, unless no server is healthy.").
+		Default("10s"))
+
 	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, reload <-chan struct{}, _ bool) error {
 		lset, err := parseFlagLabels(*labelStrs)
 		if err != nil {
 			return errors.Wrap(err, "parse labels")
 		}
+		if err := validateLabelNames(*alertExcludeLabels); err != nil {
+			return errors.Wrap(err, "parse --alert.label-drop")
+		}
 		alertQueryURL, err := url.Parse(*alertQueryURL)
 		if err != nil {
 			return errors.Wrap(err, "parse alert query url")
@@ -162,6 +182,21 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 			return errors.New("--alertmanagers.url and --alertmanagers.config* parameters cannot be defined at the same time")
 		}
 
+		// Parse and check remote write configuration.
+		remoteWriteConfigYAML, err := remoteWriteConfig.Content()
+		if err != nil {
+			return err
+		}
+		if len(remoteWriteConfigYAML) != 0 {
+			objStoreConfigYAML, err := objStoreConfig.Content()
+			if err != nil {
+				return err
+			}
+			if len(objStoreConfigYAML) != 0 {
+				return errors.New("--remote-write.config* and --objstore.config* parameters cannot be defined at the same time, there are no blocks to upload in stateless mode")
+			}
+		}
+
 		return runRule(g,
 			logger,
 			reg,
@@ -183,10 +218,15 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 			*webExternalPrefix,
 			*webPrefixHeaderName,
 			time.Duration(*resendDelay),
+			time.Duration(*outageTolerance),
+			time.Duration(*forGracePeriod),
 			time.Duration(*evalInterval),
+			*evalMaxConcurrent,
 			*dataDir,
 			*ruleFiles,
 			objStoreConfig,
+			uploadLimits,
+			remoteWriteConfigYAML,
 			tsdbOpts,
 			alertQueryURL,
 			*alertExcludeLabels,
@@ -196,6 +236,7 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application) {
 			queryConfigYAML,
 			time.Duration(*dnsSDInterval),
 			*dnsSDResolver,
+			time.Duration(*queryHealthCheckInterval),
 			comp,
 		)
 	}
@@ -269,10 +310,15 @@ func runRule(
 	webExternalPrefix string,
 	webPrefixHeaderName string,
 	resendDelay time.Duration,
+	outageTolerance time.Duration,
+	forGracePeriod time.Duration,
 	evalInterval time.Duration,
+	evalMaxConcurrent int,
 	dataDir string,
 	ruleFiles []string,
 	objStoreConfig *extflag.PathOrContent,
+	uploadLimits *shipperUploadLimits,
+	remoteWriteConfigYAML []byte,
 	tsdbOpts *tsdb.Options,
 	alertQueryURL *url.URL,
 	alertExcludeLabels []string,
@@ -282,6 +328,7 @@ func runRule(
 	queryConfigYAML []byte,
 	dnsSDInterval time.Duration,
 	dnsSDResolver string,
+	queryHealthCheckInterval time.Duration,
 	comp component.Component,
 ) error {
 	metrics := newRuleMetrics(reg)
@@ -338,20 +385,84 @@ func runRule(
 		addDiscoveryGroups(g, queryClient, dnsSDInterval)
 	}
 
-	db, err := tsdb.Open(dataDir, log.With(logger, "component", "tsdb"), reg, tsdbOpts)
-	if err != nil {
-		return errors.Wrap(err, "open TSDB")
-	}
+	queryEndpoints := thanosrule.NewQueryEndpoints(logger, reg, queryClients, metrics.duplicatedQuery)
 	{
-		done := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			<-done
-			return db.Close()
+			return runutil.Repeat(queryHealthCheckInterval, ctx.Done(), func() error {
+				checkCtx, checkCancel := context.WithTimeout(ctx, queryHealthCheckInterval)
+				defer checkCancel()
+
+				queryEndpoints.CheckHealth(checkCtx)
+				return nil
+			})
 		}, func(error) {
-			close(done)
+			cancel()
 		})
 	}
 
+	// Open the storage of evaluation results. In stateless mode they are remote-written instead of stored
+	// in a local TSDB served through the Store API.
+	var (
+		st       storage.Storage
+		storeSrv storepb.StoreServer
+	)
+	if len(remoteWriteConfigYAML) > 0 {
+		remoteWriteCfg, err := remotewrite.LoadConfigs(remoteWriteConfigYAML)
+		if err != nil {
+			return errors.Wrap(err, "load remote write config")
+		}
+
+		remoteWriteProvider := dns.NewProvider(
+			logger,
+			extprom.WrapRegistererWithPrefix("thanos_ruler_remote_write_", reg),
+			dns.ResolverType(dnsSDResolver),
+		)
+		var queues []*remotewrite.Queue
+		for _, cfg := range remoteWriteCfg {
+			c, err := http_util.NewHTTPClient(cfg.HTTPClientConfig, "remote-write")
+			if err != nil {
+				return err
+			}
+			c.Transport = tracing.HTTPTripperware(logger, c.Transport)
+			remoteWriteClient, err := http_util.NewClient(logger, cfg.EndpointsConfig, c, remoteWriteProvider.Clone())
+			if err != nil {
+				return err
+			}
+			// Discover and resolve remote write addresses.
+			addDiscoveryGroups(g, remoteWriteClient, dnsSDInterval)
+
+			q := remotewrite.NewQueue(logger, reg, "thanos_rule_remote_write", cfg, remoteWriteClient)
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				q.Run(ctx)
+				return nil
+			}, func(error) {
+				cancel()
+			})
+			queues = append(queues, q)
+		}
+		// The `for` state of alerts is restored from ALERTS_FOR_STATE series through the query API servers.
+		st = ruleremotewrite.NewStorage(lset, queues, thanosrule.NewRemoteQueryable(logger, queryEndpoints, lset))
+		level.Info(logger).Log("msg", "running in stateless mode, evaluation results are remote-written", "remote_writes", len(queues))
+	} else {
+		db, err := tsdb.Open(dataDir, log.With(logger, "component", "tsdb"), reg, tsdbOpts)
+		if err != nil {
+			return errors.Wrap(err, "open TSDB")
+		}
+		{
+			done := make(chan struct{})
+			g.Add(func() error {
+				<-done
+				return db.Close()
+			}, func(error) {
+				close(done)
+			})
+		}
+		st = tsdb.Adapter(db, 0)
+		storeSrv = store.NewTSDBStore(logger, reg, db, component.Rule, lset)
+	}
+
 	// Build the Alertmanager clients.
 	var alertingCfg alert.AlertingConfig
 	if len(alertmgrsConfigYAML) > 0 {
@@ -425,15 +536,20 @@ func runRule(
 			}
 			alertQ.Push(res)
 		}
-		st := tsdb.Adapter(db, 0)
-
 		opts := rules.ManagerOptions{
-			NotifyFunc:  notify,
-			Logger:      log.With(logger, "component", "rules"),
-			Appendable:  st,
-			ExternalURL: nil,
-			TSDB:        st,
-			ResendDelay: resendDelay,
+			NotifyFunc:      notify,
+			Logger:          log.With(logger, "component", "rules"),
+			Appendable:      st,
+			ExternalURL:     nil,
+			TSDB:            st,
+			ResendDelay:     resendDelay,
+			OutageTolerance: outageTolerance,
+			ForGracePeriod:  forGracePeriod,
+		}
+
+		var evalGate gate.Gater
+		if evalMaxConcurrent > 0 {
+			evalGate = gate.NewGate(evalMaxConcurrent, extprom.WrapRegistererWithPrefix("thanos_rule_eval_", reg))
 		}
 
 		// TODO(bwplotka): Hide this behind thanos rules.Manager.
@@ -446,7 +562,7 @@ func runRule(
 			opts := opts
 			opts.Registerer = extprom.WrapRegistererWith(prometheus.Labels{"strategy": strings.ToLower(s.String())}, reg)
 			opts.Context = ctx
-			opts.QueryFunc = queryFunc(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, s)
+			opts.QueryFunc = queryFunc(logger, queryEndpoints, evalGate, metrics.ruleEvalWarnings, s)
 
 			mgr := rules.NewManager(&opts)
 			ruleMgr.SetRuleManager(s, mgr)
@@ -523,19 +639,20 @@ func runRule(
 		prober.NewInstrumentation(comp, logger, extprom.WrapRegistererWithPrefix("thanos_", reg)),
 	)
 
-	// Start gRPC server.
+	// Start gRPC server serving Rules and Store APIs. There is no Store API to serve in stateless mode.
 	{
-		store := store.NewTSDBStore(logger, reg, db, component.Rule, lset)
-
 		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), grpcCert, grpcKey, grpcClientCA)
 		if err != nil {
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, store,
+		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, storeSrv,
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
+			grpcserver.WithServer(func(srv *grpc.Server) {
+				rulespb.RegisterRulesServer(srv, ruleMgr)
+			}),
 		)
 
 		g.Add(func() error {
@@ -615,7 +732,10 @@ func runRule(
 			}
 		}()
 
-		s := shipper.New(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, metadata.RulerSource)
+		s, err := shipper.NewWithOptions(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, metadata.RulerSource, false, uploadLimits.options())
+		if err != nil {
+			return err
+		}
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -658,6 +778,15 @@ func parseFlagLabels(s []string) (labels.Labels, error) {
 	return lset, nil
 }
 
+func validateLabelNames(names []string) error {
+	for _, n := range names {
+		if !model.LabelName(n).IsValid() {
+			return errors.Errorf("unsupported format for label name %q", n)
+		}
+	}
+	return nil
+}
+
 func labelsTSDBToProm(lset labels.Labels) (res labels.Labels) {
 	for _, l := range lset {
 		res = append(res, labels.Label{
@@ -668,27 +797,13 @@ func labelsTSDBToProm(lset labels.Labels) (res labels.Labels) {
 	return res
 }
 
-func removeDuplicateQueryEndpoints(logger log.Logger, duplicatedQueriers prometheus.Counter, urls []*url.URL) []*url.URL {
-	set := make(map[string]struct{})
-	deduplicated := make([]*url.URL, 0, len(urls))
-	for _, u := range urls {
-		if _, ok := set[u.String()]; ok {
-			level.Warn(logger).Log("msg", "duplicate query address is provided - %v", u.String())
-			duplicatedQueriers.Inc()
-			continue
-		}
-		deduplicated = append(deduplicated, u)
-		set[u.String()] = struct{}{}
-	}
-	return deduplicated
-}
-
-// queryFunc returns query function that hits the HTTP query API of query peers in randomized order until we get a result
-// back or the context get canceled.
+// queryFunc returns query function that hits the HTTP query API of healthy query peers in randomized order until we get
+// a result back or the context get canceled. Peers failing a query are skipped until they pass a health check again.
+// If evalGate is not nil, queries wait for their turn at it.
 func queryFunc(
 	logger log.Logger,
-	queriers []*http_util.Client,
-	duplicatedQuery prometheus.Counter,
+	queryEndpoints *thanosrule.QueryEndpoints,
+	evalGate gate.Gater,
 	ruleEvalWarnings *prometheus.CounterVec,
 	partialResponseStrategy storepb.PartialResponseStrategy,
 ) rules.QueryFunc {
@@ -704,34 +819,33 @@ func queryFunc(
 		panic(errors.Errorf("unknown partial response strategy %v", partialResponseStrategy).Error())
 	}
 
-	promClients := make([]*promclient.Client, 0, len(queriers))
-	for _, q := range queriers {
-		promClients = append(promClients, promclient.NewClient(logger, q))
-	}
-
 	return func(ctx context.Context, q string, t time.Time) (v promql.Vector, err error) {
-		for _, i := range rand.Perm(len(queriers)) {
-			promClient := promClients[i]
-			endpoints := removeDuplicateQueryEndpoints(logger, duplicatedQuery, queriers[i].Endpoints())
-			for _, i := range rand.Perm(len(endpoints)) {
-				var warns []string
-				tracing.DoInSpan(ctx, spanID, func(ctx context.Context) {
-					v, warns, err = promClient.PromqlQueryInstant(ctx, endpoints[i], q, t, promclient.QueryOptions{
-						Deduplicate:             true,
-						PartialResponseStrategy: partialResponseStrategy,
-					})
+		if evalGate != nil {
+			if err := evalGate.IsMyTurn(ctx); err != nil {
+				return nil, errors.Wrap(err, "wait for rule evaluation turn")
+			}
+			defer evalGate.Done()
+		}
+
+		for _, e := range queryEndpoints.Endpoints() {
+			var warns []string
+			tracing.DoInSpan(ctx, spanID, func(ctx context.Context) {
+				v, warns, err = promclient.NewClient(logger, e.Client).PromqlQueryInstant(ctx, e.URL, q, t, promclient.QueryOptions{
+					Deduplicate:             true,
+					PartialResponseStrategy: partialResponseStrategy,
 				})
-				if err != nil {
-					level.Error(logger).Log("err", err, "query", q)
-					continue
-				}
-				if len(warns) > 0 {
-					ruleEvalWarnings.WithLabelValues(strings.ToLower(partialResponseStrategy.String())).Inc()
-					// TODO(bwplotka): Propagate those to UI, probably requires changing rule manager code ):
-					level.Warn(logger).Log("warnings", strings.Join(warns, ", "), "query", q)
-				}
-				return v, nil
+			})
+			queryEndpoints.Report(e.URL, err)
+			if err != nil {
+				level.Error(logger).Log("err", err, "query", q, "endpoint", e.URL.String())
+				continue
+			}
+			if len(warns) > 0 {
+				ruleEvalWarnings.WithLabelValues(strings.ToLower(partialResponseStrategy.String())).Inc()
+				// TODO(bwplotka): Propagate those to UI, probably requires changing rule manager code ):
+				level.Warn(logger).Log("warnings", strings.Join(warns, ", "), "query", q)
 			}
+			return v, nil
 		}
 		return nil, errors.New("no query API server reachable")
 	}
@@ -770,19 +884,23 @@ func reloadRules(logger log.Logger,
 		fs, err := filepath.Glob(pat)
 		if err != nil {
 			// The only error can be a bad pattern.
-			errs.Add(errors.Wrapf(err, "retrieving rule files failed. Ignoring file. pattern %s", pat))
+			errs.Add(errors.Wrapf(err, "retrieving rule files failed. pattern %s", pat))
 			continue
 		}
 
 		files = append(files, fs...)
 	}
+	if err := errs.Err(); err != nil {
+		// Applying only the matched files would silently drop the rules of the others.
+		metrics.configSuccess.Set(0)
+		return errors.Wrap(err, "reloading rules failed, keeping previously loaded rules")
+	}
 
 	level.Info(logger).Log("msg", "reload rule files", "numFiles", len(files))
 
 	if err := ruleMgr.Update(evalInterval, files); err != nil {
 		metrics.configSuccess.Set(0)
-		errs.Add(errors.Wrap(err, "reloading rules failed"))
-		return errs.Err()
+		return errors.Wrap(err, "reloading rules failed")
 	}
 
 	metrics.configSuccess.Set(1)
@@ -792,5 +910,5 @@ func reloadRules(logger log.Logger,
 	for _, group := range ruleMgr.RuleGroups() {
 		metrics.rulesLoaded.WithLabelValues(group.PartialResponseStrategy.String(), group.File(), group.Name()).Set(float64(len(group.Rules())))
 	}
-	return errs.Err()
+	return nil
 }
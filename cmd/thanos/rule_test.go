@@ -4,8 +4,20 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	thanosrule "github.com/thanos-io/thanos/pkg/rule"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -48,3 +60,100 @@ func Test_parseFlagLabels(t *testing.T) {
 		testutil.Equals(t, err != nil, td.expectErr)
 	}
 }
+
+func Test_validateLabelNames(t *testing.T) {
+	testutil.Ok(t, validateLabelNames(nil))
+	testutil.Ok(t, validateLabelNames([]string{"replica", "_replica", "Rep1ica"}))
+	testutil.NotOk(t, validateLabelNames([]string{"replica", "rep-lica"}))
+	testutil.NotOk(t, validateLabelNames([]string{"1replica"}))
+	testutil.NotOk(t, validateLabelNames([]string{""}))
+}
+
+type staticAddrProvider []string
+
+func (p staticAddrProvider) Resolve(context.Context, []string) {}
+func (p staticAddrProvider) Addresses() []string               { return p }
+
+func Test_queryFunc_PartialResponseStrategy(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		forms <- r.Form
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	c, err := http_util.NewClient(nil, http_util.EndpointsConfig{Scheme: "http"}, http.DefaultClient, staticAddrProvider{u.Host})
+	testutil.Ok(t, err)
+	endpoints := thanosrule.NewQueryEndpoints(nil, prometheus.NewRegistry(), []*http_util.Client{c}, prometheus.NewCounter(prometheus.CounterOpts{}))
+	warnings := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"strategy"})
+
+	for _, tc := range []struct {
+		strategy storepb.PartialResponseStrategy
+		expected string
+	}{
+		{strategy: storepb.PartialResponseStrategy_WARN, expected: "true"},
+		{strategy: storepb.PartialResponseStrategy_ABORT, expected: "false"},
+	} {
+		t.Run(tc.strategy.String(), func(t *testing.T) {
+			_, err := queryFunc(log.NewNopLogger(), endpoints, nil, warnings, tc.strategy)(context.Background(), "up", time.Now())
+			testutil.Ok(t, err)
+			form := <-forms
+			testutil.Equals(t, "true", form.Get("dedup"))
+			testutil.Equals(t, tc.expected, form.Get("partial_response"))
+		})
+	}
+}
+
+func Test_queryFunc_EvalGate(t *testing.T) {
+	var (
+		started = make(chan struct{}, 2)
+		release = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	c, err := http_util.NewClient(nil, http_util.EndpointsConfig{Scheme: "http"}, http.DefaultClient, staticAddrProvider{u.Host})
+	testutil.Ok(t, err)
+	endpoints := thanosrule.NewQueryEndpoints(nil, prometheus.NewRegistry(), []*http_util.Client{c}, prometheus.NewCounter(prometheus.CounterOpts{}))
+	warnings := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"strategy"})
+
+	query := queryFunc(log.NewNopLogger(), endpoints, gate.NewGate(1, nil), warnings, storepb.PartialResponseStrategy_ABORT)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := query(context.Background(), "up", time.Now())
+			errs <- err
+		}()
+	}
+
+	// Only one query is sent at a time.
+	<-started
+	select {
+	case <-started:
+		t.Fatal("second query sent while the first one is in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Queries waiting for their turn are canceled with their context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = query(ctx, "up", time.Now())
+	testutil.NotOk(t, err)
+
+	close(release)
+	testutil.Ok(t, <-errs)
+	testutil.Ok(t, <-errs)
+	<-started
+}
@@ -22,9 +22,14 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/exthttp"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	meta "github.com/thanos-io/thanos/pkg/metadata"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	thanosmodel "github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
@@ -36,10 +41,14 @@ import (
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/tracing"
 
+	"google.golang.org/grpc"
 	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func registerSidecar(m map[string]setupFunc, app *kingpin.Application) {
@@ -60,6 +69,8 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application) {
 	dataDir := cmd.Flag("tsdb.path", "Data directory of TSDB.").
 		Default("./data").String()
 
+	readBlocks := cmd.Flag("tsdb.read-blocks", "Experimental: If true sidecar will read series of the time range covered by persisted Prometheus blocks directly from the blocks in --tsdb.path instead of using remote read. Blocks are opened read-only, recent data of the head block is still read through remote read.").Default("false").Bool()
+
 	reloaderCfgFile := cmd.Flag("reloader.config-file", "Config file watched by the reloader.").
 		Default("").String()
 
@@ -68,7 +79,22 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application) {
 
 	reloaderRuleDirs := cmd.Flag("reloader.rule-dir", "Rule directories for the reloader to refresh (repeated field).").Strings()
 
+	reloaderURL := cmd.Flag("reloader.url", "URL the reloader uses to trigger a Prometheus reload. Defaults to the reload endpoint of --prometheus.url. Useful if Prometheus is exposed behind a proxy.").
+		PlaceHolder("<url>").URL()
+
+	reloaderMethod := cmd.Flag("reloader.method", "HTTP method the reloader uses to trigger a Prometheus reload. Possible options: POST or PUT.").
+		Default(http.MethodPost).Enum(http.MethodPost, http.MethodPut)
+
+	reloaderHTTPConfig := extflag.RegisterPathOrContent(cmd, "reloader.http-config", "YAML file that contains the HTTP client configuration, i.e. TLS and authentication, the reloader uses to trigger a Prometheus reload. See format details: https://thanos.io/components/sidecar.md/#reloader-configuration ", false)
+
+	reloaderRetryInterval := cmd.Flag("reloader.retry-interval", "Interval at which the reloader retries a failed Prometheus reload. Reload is retried until it succeeds or the next watch interval starts.").
+		Default("5s").Duration()
+
+	reloaderWatchInterval := cmd.Flag("reloader.watch-interval", "Interval at which the reloader re-reads watched files and directories, in addition to watching them for changes.").
+		Default("3m").Duration()
+
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", false)
+	uploadLimits := regShipperUploadLimitFlags(cmd)
 
 	uploadCompacted := cmd.Flag("shipper.upload-compacted", "If true sidecar will try to upload compacted blocks as well. Useful for migration purposes. Works only if compaction is disabled on Prometheus. Do it once and then disable the flag when done.").Default("false").Bool()
 
@@ -78,13 +104,36 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application) {
 		Default("0000-01-01T00:00:00Z"))
 
 	m[component.Sidecar.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		reloadURL := reloader.ReloadURLFromBase(*promURL)
+		if *reloaderURL != nil {
+			reloadURL = *reloaderURL
+		}
 		rl := reloader.New(
 			log.With(logger, "component", "reloader"),
-			reloader.ReloadURLFromBase(*promURL),
+			reloadURL,
 			*reloaderCfgFile,
 			*reloaderCfgOutputFile,
 			*reloaderRuleDirs,
 		)
+		rl.WithReloadMethod(*reloaderMethod)
+		rl.WithRetryInterval(*reloaderRetryInterval)
+		rl.WithWatchInterval(*reloaderWatchInterval)
+
+		httpConfYAML, err := reloaderHTTPConfig.Content()
+		if err != nil {
+			return errors.Wrap(err, "getting reloader HTTP config")
+		}
+		if len(httpConfYAML) > 0 {
+			var httpConf http_util.ClientConfig
+			if err := yaml.UnmarshalStrict(httpConfYAML, &httpConf); err != nil {
+				return errors.Wrap(err, "parsing reloader HTTP config YAML")
+			}
+			c, err := http_util.NewHTTPClient(httpConf, "reloader")
+			if err != nil {
+				return errors.Wrap(err, "create reloader HTTP client")
+			}
+			rl.WithHTTPClient(c)
+		}
 
 		return runSidecar(
 			g,
@@ -101,8 +150,10 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application) {
 			*promURL,
 			*promReadyTimeout,
 			*dataDir,
+			*readBlocks,
 			objStoreConfig,
 			rl,
+			uploadLimits,
 			*uploadCompacted,
 			*ignoreBlockSize,
 			component.Sidecar,
@@ -128,8 +179,10 @@ func runSidecar(
 	promURL *url.URL,
 	promReadyTimeout time.Duration,
 	dataDir string,
+	readBlocks bool,
 	objStoreConfig *extflag.PathOrContent,
 	reloader *reloader.Reloader,
+	uploadLimits *shipperUploadLimits,
 	uploadCompacted bool,
 	ignoreBlockSize bool,
 	comp component.Component,
@@ -204,8 +257,8 @@ func runSidecar(
 				}
 			}
 
-			// Blocking query of external labels before joining as a Source Peer into gossip.
-			// We retry infinitely until we reach and fetch labels from our Prometheus.
+			// Blocking query of external labels and capabilities before serving.
+			// We retry infinitely until we reach our Prometheus and it has all capabilities we require.
 			err := runutil.Retry(2*time.Second, ctx.Done(), func() error {
 				if err := m.UpdateLabels(ctx, logger); err != nil {
 					level.Warn(logger).Log(
@@ -216,26 +269,37 @@ func runSidecar(
 					statusProber.NotReady(err)
 					return err
 				}
+				promUp.Set(1)
+				lastHeartbeat.SetToCurrentTime()
+
+				if err := m.UpdateCapabilities(ctx, logger); err != nil {
+					level.Warn(logger).Log("msg", "failed to detect Prometheus capabilities. Retrying", "err", err)
+					statusProber.NotReady(err)
+					return err
+				}
+				if err := m.ValidateCapabilities(); err != nil {
+					level.Warn(logger).Log("msg", "Prometheus misses capabilities required by sidecar. Retrying", "err", err)
+					statusProber.NotReady(err)
+					return err
+				}
 
+				c := m.Capabilities()
 				level.Info(logger).Log(
-					"msg", "successfully loaded prometheus external labels",
+					"msg", "successfully loaded prometheus external labels and capabilities",
 					"external_labels", m.Labels().String(),
+					"version", c.Version,
+					"streamed_remote_read", c.StreamedRemoteRead,
+					"exemplars", c.Exemplars,
 				)
-				promUp.Set(1)
 				statusProber.Ready()
-				lastHeartbeat.SetToCurrentTime()
 				return nil
 			})
 			if err != nil {
-				return errors.Wrap(err, "initial external labels query")
-			}
-
-			if len(m.Labels()) == 0 {
-				return errors.New("no external labels configured on Prometheus server, uniquely identifying external labels must be configured")
+				return errors.Wrap(err, "initial external labels and capabilities query")
 			}
 
 			// Periodically query the Prometheus config. We use this as a heartbeat as well as for updating
-			// the external labels we apply.
+			// the external labels we apply and the capabilities of Prometheus, which might have been upgraded.
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
 				iterCtx, iterCancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer iterCancel()
@@ -243,11 +307,20 @@ func runSidecar(
 				if err := m.UpdateLabels(iterCtx, logger); err != nil {
 					level.Warn(logger).Log("msg", "heartbeat failed", "err", err)
 					promUp.Set(0)
-				} else {
-					promUp.Set(1)
-					lastHeartbeat.SetToCurrentTime()
+					return nil
 				}
+				promUp.Set(1)
+				lastHeartbeat.SetToCurrentTime()
 
+				if err := m.UpdateCapabilities(iterCtx, logger); err != nil {
+					level.Warn(logger).Log("msg", "failed to detect Prometheus capabilities", "err", err)
+				}
+				if err := m.ValidateCapabilities(); err != nil {
+					level.Warn(logger).Log("msg", "Prometheus misses capabilities required by sidecar", "err", err)
+					statusProber.NotReady(err)
+					return nil
+				}
+				statusProber.Ready()
 				return nil
 			})
 		}, func(error) {
@@ -274,18 +347,52 @@ func runSidecar(
 			return errors.Wrap(err, "create Prometheus store")
 		}
 
+		promStore.WithStreamedRemoteRead(func() bool { return m.Capabilities().StreamedRemoteRead })
+
+		var storeSrv storepb.StoreServer = promStore
+		if readBlocks {
+			blocksStore := store.NewLocalBlocksStore(logger, dataDir, promStore, m.Labels)
+			if err := blocksStore.SyncBlocks(); err != nil {
+				level.Warn(logger).Log("msg", "initial sync of local blocks failed", "err", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				defer runutil.CloseWithLogOnErr(logger, blocksStore, "local blocks store")
+
+				return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
+					if err := blocksStore.SyncBlocks(); err != nil {
+						level.Warn(logger).Log("msg", "sync of local blocks failed", "err", err)
+					}
+					return nil
+				})
+			}, func(error) {
+				cancel()
+			})
+			storeSrv = blocksStore
+		}
+
 		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), grpcCert, grpcKey, grpcClientCA)
 		if err != nil {
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, promStore,
+		promClient := promclient.NewClient(logger, c)
+		exemplarsSrv := exemplars.NewPrometheus(promURL, promClient, m.Labels)
+		exemplarsSrv.WithSupported(func() bool { return m.Capabilities().Exemplars })
+
+		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, storeSrv,
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
+			grpcserver.WithServer(func(srv *grpc.Server) {
+				metadatapb.RegisterMetadataServer(srv, meta.NewPrometheus(promURL, promClient))
+				exemplarspb.RegisterExemplarsServer(srv, exemplarsSrv)
+				targetspb.RegisterTargetsServer(srv, targets.NewPrometheus(promURL, promClient))
+			}),
 		)
+		// Readiness is set once Prometheus is reachable and has all required capabilities.
 		g.Add(func() error {
-			statusProber.Ready()
 			return s.ListenAndServe()
 		}, func(err error) {
 			statusProber.NotReady(err)
@@ -328,11 +435,9 @@ func runSidecar(
 				return errors.Wrapf(err, "aborting as no external labels found after waiting %s", promReadyTimeout)
 			}
 
-			var s *shipper.Shipper
-			if uploadCompacted {
-				s = shipper.NewWithCompacted(logger, reg, dataDir, bkt, m.Labels, metadata.SidecarSource)
-			} else {
-				s = shipper.New(logger, reg, dataDir, bkt, m.Labels, metadata.SidecarSource)
+			s, err := shipper.NewWithOptions(logger, reg, dataDir, bkt, m.Labels, metadata.SidecarSource, uploadCompacted, uploadLimits.options())
+			if err != nil {
+				return err
 			}
 
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
@@ -397,10 +502,11 @@ func validatePrometheus(ctx context.Context, logger log.Logger, ignoreBlockSize
 type promMetadata struct {
 	promURL *url.URL
 
-	mtx    sync.Mutex
-	mint   int64
-	maxt   int64
-	labels labels.Labels
+	mtx          sync.Mutex
+	mint         int64
+	maxt         int64
+	labels       labels.Labels
+	capabilities promclient.Capabilities
 
 	limitMinTime thanosmodel.TimeOrDurationValue
 }
@@ -418,6 +524,41 @@ func (s *promMetadata) UpdateLabels(ctx context.Context, logger log.Logger) erro
 	return nil
 }
 
+// UpdateCapabilities detects the capabilities of Prometheus from its build information and configured flags.
+// Prometheus versions too old to expose them are handled gracefully.
+func (s *promMetadata) UpdateCapabilities(ctx context.Context, logger log.Logger) error {
+	version, err := promclient.BuildVersion(ctx, logger, s.promURL)
+	if err != nil && err != promclient.ErrBuildInfoEndpointNotFound {
+		return errors.Wrap(err, "fetch Prometheus build info")
+	}
+
+	flags, err := promclient.ConfiguredFlags(ctx, logger, s.promURL)
+	if err != nil && err != promclient.ErrFlagEndpointNotFound {
+		return errors.Wrap(err, "fetch Prometheus flags")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.capabilities = promclient.NewCapabilities(version, flags)
+	return nil
+}
+
+// ValidateCapabilities returns an error describing the first capability required by sidecar that Prometheus misses.
+func (s *promMetadata) ValidateCapabilities() error {
+	if len(s.Labels()) == 0 {
+		return errors.New("no external labels configured on Prometheus server, uniquely identifying external labels must be configured")
+	}
+	return nil
+}
+
+func (s *promMetadata) Capabilities() promclient.Capabilities {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.capabilities
+}
+
 func (s *promMetadata) UpdateTimestamps(mint int64, maxt int64) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
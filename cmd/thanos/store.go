@@ -62,8 +62,21 @@ func registerStore(m map[string]setupFunc, app *kingpin.Application) {
 		"Maximum amount of samples returned via a single Series call. 0 means no limit. NOTE: For efficiency we take 120 as the number of samples in chunk (it cannot be bigger than that), so the actual number of samples might be lower, even though the maximum could be hit.").
 		Default("0").Uint()
 
+	maxQueryMemory := cmd.Flag("store.grpc.series-memory-limit",
+		"Maximum approximate number of bytes of postings, series and chunks a single Series call holds at the same time. The Series call fails once the limit is exceeded. 0 means no limit.").
+		Default("0").Bytes()
+
 	maxConcurrent := cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of concurrent Series calls.").Default("20").Int()
 
+	fetchMaxGap := cmd.Flag("store.fetch.max-gap", "Maximum gap between ranges of index or chunks data that are still merged into a single object storage request. Larger values issue fewer requests, but fetch more bytes that are not needed.").
+		Default("512KiB").Bytes()
+
+	fetchSeriesBatchSize := cmd.Flag("store.fetch.series-batch-size", "Maximum number of series fetched from the index by a single object storage request. 0 means no limit.").
+		Default("0").Int()
+
+	fetchChunksBatchSize := cmd.Flag("store.fetch.chunks-batch-size", "Maximum number of chunks fetched by a single object storage request. 0 means no limit.").
+		Default("0").Int()
+
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", true)
 
 	syncInterval := cmd.Flag("sync-block-duration", "Repeat interval for syncing the blocks between local and remote view.").
@@ -98,6 +111,10 @@ func registerStore(m map[string]setupFunc, app *kingpin.Application) {
 	consistencyDelay := modelDuration(cmd.Flag("consistency-delay", "Minimum age of all blocks before they are being read. Set it to safe value (e.g 30m) if your object storage is eventually consistent. GCS and S3 are (roughly) strongly consistent.").
 		Default("0s"))
 
+	quarantineDelay := modelDuration(cmd.Flag("block-quarantine-delay", "Minimum age of partial blocks, i.e. blocks without a valid meta.json, before their quarantine-mark.json uploaded by compactor is honored: "+
+		"quarantined blocks are not synced anymore. Set it to the block-quarantine-delay of compactor. 0 disables quarantine.").
+		Default("0s"))
+
 	ignoreDeletionMarksDelay := modelDuration(cmd.Flag("ignore-deletion-marks-delay", "Duration after which the blocks marked for deletion will be filtered out while fetching blocks. "+
 		"The idea of ignore-deletion-marks-delay is to ignore blocks that are marked for deletion with some delay. This ensures store can still serve blocks that are meant to be deleted but do not have a replacement yet. "+
 		"If delete-delay duration is provided to compactor or bucket verify component, it will upload deletion-mark.json file to mark after what duration the block should be deleted rather than deleting the block straight away. "+
@@ -131,6 +148,7 @@ func registerStore(m map[string]setupFunc, app *kingpin.Application) {
 			uint64(*indexCacheSize),
 			uint64(*chunkPoolSize),
 			uint64(*maxSampleCount),
+			uint64(*maxQueryMemory),
 			*maxConcurrent,
 			component.Store,
 			debugLogging,
@@ -145,10 +163,16 @@ func registerStore(m map[string]setupFunc, app *kingpin.Application) {
 			*disableIndexHeader,
 			*enablePostingsCompression,
 			time.Duration(*consistencyDelay),
+			time.Duration(*quarantineDelay),
 			time.Duration(*ignoreDeletionMarksDelay),
 			*webExternalPrefix,
 			*webPrefixHeaderName,
 			*postingOffsetsInMemSampling,
+			store.PartitionerConfig{
+				MaxGapSize:      uint64(*fetchMaxGap),
+				SeriesBatchSize: *fetchSeriesBatchSize,
+				ChunksBatchSize: *fetchChunksBatchSize,
+			},
 		)
 	}
 }
@@ -166,7 +190,7 @@ func runStore(
 	grpcGracePeriod time.Duration,
 	grpcCert, grpcKey, grpcClientCA, httpBindAddr string,
 	httpGracePeriod time.Duration,
-	indexCacheSizeBytes, chunkPoolSizeBytes, maxSampleCount uint64,
+	indexCacheSizeBytes, chunkPoolSizeBytes, maxSampleCount, maxQueryMemoryBytes uint64,
 	maxConcurrency int,
 	component component.Component,
 	verbose bool,
@@ -176,9 +200,11 @@ func runStore(
 	selectorRelabelConf *extflag.PathOrContent,
 	advertiseCompatibilityLabel, disableIndexHeader, enablePostingsCompression bool,
 	consistencyDelay time.Duration,
+	quarantineDelay time.Duration,
 	ignoreDeletionMarksDelay time.Duration,
 	externalPrefix, prefixHeader string,
 	postingOffsetsInMemSampling int,
+	partitionerConfig store.PartitionerConfig,
 ) error {
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
@@ -252,7 +278,11 @@ func runStore(
 	}
 
 	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, ignoreDeletionMarksDelay)
-	metaFetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, dataDir, extprom.WrapRegistererWithPrefix("thanos_", reg),
+	baseMetaFetcher, err := block.NewBaseFetcher(logger, fetcherConcurrency, bkt, dataDir, quarantineDelay, extprom.WrapRegistererWithPrefix("thanos_", reg))
+	if err != nil {
+		return errors.Wrap(err, "meta fetcher")
+	}
+	metaFetcher := baseMetaFetcher.NewMetaFetcher(extprom.WrapRegistererWithPrefix("thanos_", reg),
 		[]block.MetadataFilter{
 			block.NewTimePartitionMetaFilter(filterConf.MinTime, filterConf.MaxTime),
 			block.NewLabelShardedMetaFilter(relabelConfig),
@@ -260,9 +290,6 @@ func runStore(
 			ignoreDeletionMarkFilter,
 			block.NewDeduplicateFilter(),
 		}, nil)
-	if err != nil {
-		return errors.Wrap(err, "meta fetcher")
-	}
 
 	if !disableIndexHeader {
 		level.Info(logger).Log("msg", "index-header instead of index-cache.json enabled")
@@ -276,6 +303,7 @@ func runStore(
 		indexCache,
 		chunkPoolSizeBytes,
 		maxSampleCount,
+		maxQueryMemoryBytes,
 		maxConcurrency,
 		verbose,
 		blockSyncConcurrency,
@@ -284,6 +312,7 @@ func runStore(
 		!disableIndexHeader,
 		enablePostingsCompression,
 		postingOffsetsInMemSampling,
+		partitionerConfig,
 		false,
 	)
 	if err != nil {
@@ -5,9 +5,14 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,8 +27,11 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/thanos-io/thanos/pkg/backfill"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
@@ -32,12 +40,15 @@ import (
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/replicate"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/tombstone"
+	tombstoneapi "github.com/thanos-io/thanos/pkg/tombstone/api"
 	"github.com/thanos-io/thanos/pkg/ui"
 	"github.com/thanos-io/thanos/pkg/verifier"
 	"golang.org/x/text/language"
@@ -48,20 +59,8 @@ import (
 const extpromPrefix = "thanos_bucket_"
 
 var (
-	issuesMap = map[string]verifier.Issue{
-		verifier.IndexIssueID:                verifier.IndexIssue,
-		verifier.OverlappedBlocksIssueID:     verifier.OverlappedBlocksIssue,
-		verifier.DuplicatedCompactionIssueID: verifier.DuplicatedCompactionIssue,
-	}
-	allIssues = func() (s []string) {
-		for id := range issuesMap {
-			s = append(s, id)
-		}
-
-		sort.Strings(s)
-		return s
-	}
 	inspectColumns = []string{"ULID", "FROM", "UNTIL", "RANGE", "UNTIL-DOWN", "#SERIES", "#SAMPLES", "#CHUNKS", "COMP-LEVEL", "COMP-FAILED", "LABELS", "RESOLUTION", "SOURCE"}
+	outputTypes    = []string{"table", "json", "csv", "tsv"}
 )
 
 func registerBucket(m map[string]setupFunc, app *kingpin.CmdClause, pre string) {
@@ -75,6 +74,12 @@ func registerBucket(m map[string]setupFunc, app *kingpin.CmdClause, pre string)
 	registerBucketWeb(m, cmd, pre, objStoreConfig)
 	registerBucketReplicate(m, cmd, pre, objStoreConfig)
 	registerBucketDownsample(m, cmd, pre, objStoreConfig)
+	registerBucketDownload(m, cmd, pre, objStoreConfig)
+	registerBucketCleanup(m, cmd, pre, objStoreConfig)
+	registerBucketMark(m, cmd, pre, objStoreConfig)
+	registerBucketTombstone(m, cmd, pre, objStoreConfig)
+	registerBucketBackfill(m, cmd, pre, objStoreConfig)
+	registerBucketLineage(m, cmd, pre, objStoreConfig)
 }
 
 func registerBucketVerify(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
@@ -82,7 +87,7 @@ func registerBucketVerify(m map[string]setupFunc, root *kingpin.CmdClause, name
 	objStoreBackupConfig := regCommonObjStoreFlags(cmd, "-backup", false, "Used for repair logic to backup blocks before removal.")
 	repair := cmd.Flag("repair", "Attempt to repair blocks for which issues were detected").
 		Short('r').Default("false").Bool()
-	issuesToVerify := cmd.Flag("issues", fmt.Sprintf("Issues to verify (and optionally repair). Possible values: %v", allIssues())).
+	issuesToVerify := cmd.Flag("issues", fmt.Sprintf("Issues to verify (and optionally repair). Possible values: %v", verifier.DefaultRegistry().IDs())).
 		Short('i').Default(verifier.IndexIssueID, verifier.OverlappedBlocksIssueID).Strings()
 	idWhitelist := cmd.Flag("id-whitelist", "Block IDs to verify (and optionally repair) only. "+
 		"If none is specified, all blocks will be verified. Repeated field").Strings()
@@ -128,17 +133,13 @@ func registerBucketVerify(m map[string]setupFunc, root *kingpin.CmdClause, name
 		g.Add(func() error { return nil }, func(error) {})
 
 		var (
-			ctx    = context.Background()
-			v      *verifier.Verifier
-			issues []verifier.Issue
+			ctx = context.Background()
+			v   *verifier.Verifier
 		)
 
-		for _, i := range *issuesToVerify {
-			issueFn, ok := issuesMap[i]
-			if !ok {
-				return errors.Errorf("no such issue name %s", i)
-			}
-			issues = append(issues, issueFn)
+		issues, err := verifier.DefaultRegistry().Issues(*issuesToVerify...)
+		if err != nil {
+			return err
 		}
 
 		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil, nil)
@@ -177,9 +178,20 @@ func registerBucketVerify(m map[string]setupFunc, root *kingpin.CmdClause, name
 
 func registerBucketLs(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
 	cmd := root.Command("ls", "List all blocks in the bucket")
-	output := cmd.Flag("output", "Optional format in which to print each block's information. Options are 'json', 'wide' or a custom template.").
+	output := cmd.Flag("output", "Optional format in which to print each block's information. Options are 'json', 'wide' or a custom template. By default, ULIDs of the blocks are printed, one per line.").
 		Short('o').Default("").String()
+	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range limit to list. Only blocks with data later than this value are listed. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("0000-01-01T00:00:00Z"))
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range limit to list. Only blocks with data earlier than this value are listed. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("9999-12-31T23:59:59Z"))
+	matcherStrs := cmd.Flag("matcher", "Only blocks whose external labels match this matcher will be listed. All matchers have to match. Repeated flag.").PlaceHolder("key=\"value\"").Strings()
+	resolutions := cmd.Flag("resolution", "Only blocks with these resolutions in milliseconds, 0 for raw blocks, will be listed. Repeated flag. All resolutions are listed if not specified.").Int64List()
 	m[name+" ls"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		matchers, err := replicate.ParseFlagMatchers(*matcherStrs)
+		if err != nil {
+			return errors.Wrap(err, "parse block label matchers")
+		}
+
 		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
@@ -190,7 +202,9 @@ func registerBucketLs(m map[string]setupFunc, root *kingpin.CmdClause, name stri
 			return err
 		}
 
-		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil, nil)
+		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), []block.MetadataFilter{
+			block.NewTimePartitionMetaFilter(*minTime, *maxTime),
+		}, nil)
 		if err != nil {
 			return err
 		}
@@ -253,9 +267,18 @@ func registerBucketLs(m map[string]setupFunc, root *kingpin.CmdClause, name stri
 			return err
 		}
 
-		for _, meta := range metas {
+		ids := make([]ulid.ULID, 0, len(metas))
+		for id, meta := range metas {
+			if !matchesBlock(meta, matchers, *resolutions) {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+
+		for _, id := range ids {
 			objects++
-			if err := printBlock(meta); err != nil {
+			if err := printBlock(metas[id]); err != nil {
 				return errors.Wrap(err, "iter")
 			}
 		}
@@ -264,15 +287,41 @@ func registerBucketLs(m map[string]setupFunc, root *kingpin.CmdClause, name stri
 	}
 }
 
+// matchesBlock returns true if the block external labels match all matchers and its resolution is one of the given
+// resolutions, if any.
+func matchesBlock(m *metadata.Meta, matchers []*labels.Matcher, resolutions []int64) bool {
+	if !labels.Selector(matchers).Matches(labels.FromMap(m.Thanos.Labels)) {
+		return false
+	}
+	if len(resolutions) == 0 {
+		return true
+	}
+	for _, r := range resolutions {
+		if m.Thanos.Downsample.Resolution == r {
+			return true
+		}
+	}
+	return false
+}
+
 func registerBucketInspect(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
 	cmd := root.Command("inspect", "Inspect all blocks in the bucket in detailed, table-like way")
 	selector := cmd.Flag("selector", "Selects blocks based on label, e.g. '-l key1=\\\"value1\\\" -l key2=\\\"value2\\\"'. All key value pairs must match.").Short('l').
 		PlaceHolder("<name>=\\\"<value>\\\"").Strings()
 	sortBy := cmd.Flag("sort-by", "Sort by columns. It's also possible to sort by multiple columns, e.g. '--sort-by FROM --sort-by UNTIL'. I.e., if the 'FROM' value is equal the rows are then further sorted by the 'UNTIL' value.").
 		Default("FROM", "UNTIL").Enums(inspectColumns...)
+	columns := cmd.Flag("columns", "Columns to print in the given order, e.g. '--columns ULID --columns #SERIES'. All columns are printed by default.").
+		Default(inspectColumns...).Enums(inspectColumns...)
+	output := cmd.Flag("output", "Format in which to print blocks. Options are 'table', 'json', 'csv' or 'tsv'. Numbers are not grouped by thousands in machine-readable formats.").
+		Short('o').Default("table").Enum(outputTypes...)
 	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
+	downsamplingLevels := regDownsamplingLevelFlag(cmd)
 
 	m[name+" inspect"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		levels, err := parseDownsamplingLevels(*downsamplingLevels)
+		if err != nil {
+			return err
+		}
 
 		// Parse selector.
 		selectorLabels, err := parseFlagLabels(*selector)
@@ -314,7 +363,7 @@ func registerBucketInspect(m map[string]setupFunc, root *kingpin.CmdClause, name
 			blockMetas = append(blockMetas, meta)
 		}
 
-		return printTable(blockMetas, selectorLabels, *sortBy)
+		return printBlocks(os.Stdout, blockMetas, selectorLabels, levels, *sortBy, *columns, *output)
 	}
 }
 
@@ -327,8 +376,9 @@ func registerBucketWeb(m map[string]setupFunc, root *kingpin.CmdClause, name str
 	interval := cmd.Flag("refresh", "Refresh interval to download metadata from remote storage").Default("30m").Duration()
 	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
 	label := cmd.Flag("label", "Prometheus label to use as timeline title").String()
+	enableTombstoneAPI := cmd.Flag("web.enable-tombstone-api", "Serve the API listing, adding and deleting global tombstones under /api/v1/tombstones. Security risk: tombstones delete data from all blocks in the bucket.").Default("false").Bool()
 
-	m[name+" web"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+	m[name+" web"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		comp := component.Bucket
 		httpProbe := prober.NewHTTP()
 		statusProber := prober.Combine(
@@ -342,9 +392,10 @@ func registerBucketWeb(m map[string]setupFunc, root *kingpin.CmdClause, name str
 		)
 
 		router := route.New()
+		ins := extpromhttp.NewInstrumentationMiddleware(reg)
 
 		bucketUI := ui.NewBucketUI(logger, *label, *webExternalPrefix, *webPrefixHeaderName)
-		bucketUI.Register(router, extpromhttp.NewInstrumentationMiddleware(reg))
+		bucketUI.Register(router, ins)
 		srv.Handle("/", router)
 
 		if *interval < 5*time.Minute {
@@ -369,6 +420,11 @@ func registerBucketWeb(m map[string]setupFunc, root *kingpin.CmdClause, name str
 			return errors.Wrap(err, "bucket client")
 		}
 
+		if *enableTombstoneAPI {
+			api := tombstoneapi.NewAPI(logger, bkt)
+			api.Register(router.WithPrefix(*webExternalPrefix+"/api/v1"), tracer, logger, ins)
+		}
+
 		// TODO(bwplotka): Allow Bucket UI to visualize the state of block as well.
 		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil, nil)
 		if err != nil {
@@ -411,23 +467,13 @@ func registerBucketWeb(m map[string]setupFunc, root *kingpin.CmdClause, name str
 	}
 }
 
-// Provide a list of resolution, can not use Enum directly, since string does not implement int64 function.
-func listResLevel() []string {
-	return []string{
-		strconv.FormatInt(downsample.ResLevel0, 10),
-		strconv.FormatInt(downsample.ResLevel1, 10),
-		strconv.FormatInt(downsample.ResLevel2, 10)}
-}
-
 func registerBucketReplicate(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
 	cmd := root.Command("replicate", fmt.Sprintf("Replicate data from one object storage to another. NOTE: Currently it works only with Thanos blocks (%v has to have Thanos metadata).", block.MetaFilename))
 	httpBindAddr, httpGracePeriod := regHTTPFlags(cmd)
 	toObjStoreConfig := regCommonObjStoreFlags(cmd, "-to", false, "The object storage which replicate data to.")
-	// TODO(bwplotka): Allow to replicate many resolution levels.
-	resolution := cmd.Flag("resolution", "Only blocks with this resolution will be replicated.").Default(strconv.FormatInt(downsample.ResLevel0, 10)).HintAction(listResLevel).Int64()
-	// TODO(bwplotka): Allow to replicate many compaction levels.
-	compaction := cmd.Flag("compaction", "Only blocks with this compaction level will be replicated.").Default("1").Int()
-	matcherStrs := cmd.Flag("matcher", "Only blocks whose external labels exactly match this matcher will be replicated.").PlaceHolder("key=\"value\"").Strings()
+	resolutions := cmd.Flag("resolution", "Only blocks with these resolutions in milliseconds, 0 for raw blocks, will be replicated. Repeated flag.").Default(strconv.FormatInt(downsample.ResLevel0, 10)).Int64List()
+	compactions := cmd.Flag("compaction", "Only blocks with these compaction levels will be replicated. Repeated flag.").Default("1").Ints()
+	matcherStrs := cmd.Flag("matcher", "Only blocks whose external labels match this matcher will be replicated. All matchers have to match. Repeated flag.").PlaceHolder("key=\"value\"").Strings()
 	singleRun := cmd.Flag("single-run", "Run replication only one time, then exit.").Default("false").Bool()
 
 	m[name+" replicate"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
@@ -436,6 +482,11 @@ func registerBucketReplicate(m map[string]setupFunc, root *kingpin.CmdClause, na
 			return errors.Wrap(err, "parse block label matchers")
 		}
 
+		resolutionLevels := make([]compact.ResolutionLevel, 0, len(*resolutions))
+		for _, r := range *resolutions {
+			resolutionLevels = append(resolutionLevels, compact.ResolutionLevel(r))
+		}
+
 		return replicate.RunReplicate(
 			g,
 			logger,
@@ -444,8 +495,8 @@ func registerBucketReplicate(m map[string]setupFunc, root *kingpin.CmdClause, na
 			*httpBindAddr,
 			time.Duration(*httpGracePeriod),
 			matchers,
-			compact.ResolutionLevel(*resolution),
-			*compaction,
+			resolutionLevels,
+			*compactions,
 			objStoreConfig,
 			toObjStoreConfig,
 			*singleRun,
@@ -463,16 +514,30 @@ func registerBucketDownsample(m map[string]setupFunc, root *kingpin.CmdClause, n
 	dataDir := cmd.Flag("data-dir", "Data directory in which to cache blocks and process downsamplings.").
 		Default("./data").String()
 
+	downsamplingLevels := regDownsamplingLevelsFlag(cmd)
+
 	m[name+" "+comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
-		return RunDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, comp)
+		levels, err := downsamplingLevels.parse()
+		if err != nil {
+			return err
+		}
+		return RunDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, comp, levels, *downsamplingLevels.sketches, *downsamplingLevels.concurrency, *downsamplingLevels.checkpointSeries)
 	}
 }
 
-func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortBy []string) error {
+// printBlocks prints blocks matching the selector, sorted by sortBy columns, with given columns in the output format.
+// The time until the next downsampling is computed with the given downsampling levels.
+func printBlocks(w io.Writer, blockMetas []*metadata.Meta, selectorLabels labels.Labels, levels []downsample.Level, sortBy, columns []string, output string) error {
 	header := inspectColumns
 
-	var lines [][]string
-	p := message.NewPrinter(language.English)
+	var (
+		lines       [][]string
+		formatCount = func(v interface{}) string { return fmt.Sprintf("%v", v) }
+	)
+	if output == "table" {
+		p := message.NewPrinter(language.English)
+		formatCount = func(v interface{}) string { return p.Sprintf("%d", v) }
+	}
 
 	for _, blockMeta := range blockMetas {
 		if !matchesSelector(blockMeta, selectorLabels) {
@@ -482,7 +547,7 @@ func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortB
 		timeRange := time.Duration((blockMeta.MaxTime - blockMeta.MinTime) * int64(time.Millisecond))
 
 		untilDown := "-"
-		if until, err := compact.UntilNextDownsampling(blockMeta); err == nil {
+		if until, err := compact.UntilNextDownsampling(blockMeta, levels); err == nil {
 			untilDown = until.String()
 		}
 		var labels []string
@@ -496,11 +561,11 @@ func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortB
 		line = append(line, time.Unix(blockMeta.MaxTime/1000, 0).Format("02-01-2006 15:04:05"))
 		line = append(line, timeRange.String())
 		line = append(line, untilDown)
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumSeries))
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumSamples))
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumChunks))
-		line = append(line, p.Sprintf("%d", blockMeta.Compaction.Level))
-		line = append(line, p.Sprintf("%t", blockMeta.Compaction.Failed))
+		line = append(line, formatCount(blockMeta.Stats.NumSeries))
+		line = append(line, formatCount(blockMeta.Stats.NumSamples))
+		line = append(line, formatCount(blockMeta.Stats.NumChunks))
+		line = append(line, formatCount(blockMeta.Compaction.Level))
+		line = append(line, fmt.Sprintf("%t", blockMeta.Compaction.Failed))
 		line = append(line, strings.Join(labels, ","))
 		line = append(line, time.Duration(blockMeta.Thanos.Downsample.Resolution*int64(time.Millisecond)).String())
 		line = append(line, string(blockMeta.Thanos.Source))
@@ -519,17 +584,51 @@ func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortB
 	t := Table{Header: header, Lines: lines, SortIndices: sortByColNum}
 	sort.Sort(t)
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(t.Header)
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
-	table.SetAutoWrapText(false)
-	table.SetReflowDuringAutoWrap(false)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.AppendBulk(t.Lines)
-	table.Render()
-
-	return nil
+	// Sort by all columns first, then keep only the selected ones.
+	t, err := t.selectColumns(columns)
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "table":
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(t.Header)
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+		table.SetAutoWrapText(false)
+		table.SetReflowDuringAutoWrap(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.AppendBulk(t.Lines)
+		table.Render()
+		return nil
+	case "json":
+		rows := make([]map[string]string, 0, len(t.Lines))
+		for _, line := range t.Lines {
+			row := make(map[string]string, len(t.Header))
+			for i, col := range t.Header {
+				row[col] = line[i]
+			}
+			rows = append(rows, row)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(rows)
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if output == "tsv" {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write(t.Header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.Lines); err != nil {
+			return errors.Wrapf(err, "write %s", output)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown output %s", output)
+	}
 }
 
 func getKeysAlphabetically(labels map[string]string) []string {
@@ -568,6 +667,31 @@ type Table struct {
 	SortIndices []int
 }
 
+// selectColumns returns a table with only the given columns, in the given order.
+func (t Table) selectColumns(columns []string) (Table, error) {
+	indices := make([]int, 0, len(columns))
+	for _, col := range columns {
+		index := getIndex(t.Header, col)
+		if index == -1 {
+			return Table{}, errors.Errorf("column %s not found", col)
+		}
+		indices = append(indices, index)
+	}
+
+	res := Table{Header: make([]string, 0, len(indices)), Lines: make([][]string, 0, len(t.Lines))}
+	for _, index := range indices {
+		res.Header = append(res.Header, t.Header[index])
+	}
+	for _, line := range t.Lines {
+		l := make([]string, 0, len(indices))
+		for _, index := range indices {
+			l = append(l, line[index])
+		}
+		res.Lines = append(res.Lines, l)
+	}
+	return res, nil
+}
+
 func (t Table) Len() int { return len(t.Lines) }
 
 func (t Table) Swap(i, j int) { t.Lines[i], t.Lines[j] = t.Lines[j], t.Lines[i] }
@@ -601,3 +725,386 @@ func compare(s1, s2 string) bool {
 	}
 	return s1Time.Before(s2Time)
 }
+
+func registerBucketDownload(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("download", "Download blocks from the bucket to a local directory. Big files are downloaded using concurrent range requests.")
+	ids := cmd.Flag("id", "ID (ULID) of the block to download. Can be specified multiple times.").Required().Strings()
+	outputDir := cmd.Flag("output-dir", "Directory to download blocks to. Each block is downloaded to a subdirectory named after its ID.").
+		Default("./data").String()
+	partSize := cmd.Flag("download.part-size", "Files bigger than this are downloaded by concurrent range requests of this size.").
+		Default("8MiB").Bytes()
+	concurrency := cmd.Flag("download.concurrency", "Maximum number of concurrent range requests per file.").
+		Default("4").Int()
+	timeout := cmd.Flag("timeout", "Timeout to download all blocks.").Default("30m").Duration()
+
+	m[name+" download"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		opts := objstore.ParallelDownloadOptions{PartSize: int64(*partSize), Concurrency: *concurrency}
+		for _, idStr := range *ids {
+			id, err := ulid.Parse(idStr)
+			if err != nil {
+				return errors.Wrapf(err, "invalid block ID %q", idStr)
+			}
+
+			dst := filepath.Join(*outputDir, id.String())
+			begin := time.Now()
+			if err := objstore.DownloadDirParallel(ctx, logger, bkt, id.String(), dst, opts); err != nil {
+				return errors.Wrapf(err, "download block %s", id)
+			}
+			level.Info(logger).Log("msg", "downloaded block", "id", id, "dir", dst, "duration", time.Since(begin))
+		}
+		return nil
+	}
+}
+
+func registerBucketCleanup(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("cleanup", "Delete aborted partial uploads, i.e. blocks without meta.json, but with a debug meta file uploaded at the beginning of the block upload.")
+	olderThan := modelDuration(cmd.Flag("older-than", "Minimum age of partially uploaded blocks to delete, based on the block creation time in its ULID. Keep it longer than the longest possible upload, as blocks still being uploaded would be deleted otherwise.").
+		Default("48h"))
+	dryRun := cmd.Flag("dry-run", "Only print aborted partial uploads, without deleting them.").Default("false").Bool()
+	m[name+" cleanup"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil, nil)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		ctx := context.Background()
+		_, partial, err := fetcher.Fetch(ctx)
+		if err != nil {
+			return errors.Wrap(err, "fetch metas")
+		}
+
+		ids, err := compact.AbortedPartialUploads(ctx, bkt, partial, time.Duration(*olderThan))
+		if err != nil {
+			return errors.Wrap(err, "find aborted partial uploads")
+		}
+		if *dryRun {
+			for _, id := range ids {
+				fmt.Fprintln(os.Stdout, id.String())
+			}
+			level.Info(logger).Log("msg", "cleanup dry run done", "partial", len(partial), "aborted", len(ids))
+			return nil
+		}
+
+		var (
+			deleteAttempts = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "thanos_bucket_aborted_partial_uploads_deletion_attempts_total",
+				Help: "Total number of started deletions of blocks that are assumed aborted and only partially uploaded.",
+			})
+			blocksCleaned = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "thanos_bucket_blocks_cleaned_total",
+				Help: "Total number of deleted aborted partial uploads.",
+			})
+			blockCleanupFailures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "thanos_bucket_block_cleanup_failures_total",
+				Help: "Failures encountered while deleting aborted partial uploads.",
+			})
+		)
+		failures := compact.CleanAbortedPartialUploads(ctx, logger, bkt, ids, deleteAttempts, blocksCleaned, blockCleanupFailures)
+		level.Info(logger).Log("msg", "cleanup done", "partial", len(partial), "aborted", len(ids), "deleted", len(ids)-failures)
+
+		if failures > 0 {
+			return errors.Errorf("failed to delete %d aborted partial uploads", failures)
+		}
+		return nil
+	}
+}
+
+func registerBucketMark(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("mark", "Mark blocks for deletion or no compaction, or remove such marks.")
+	ids := cmd.Flag("id", "ID (ULID) of the block to mark. Can be specified multiple times.").Required().Strings()
+	marker := cmd.Flag("marker", "Marker to set or remove. Blocks marked for deletion are deleted by compactor after its delete delay. Blocks marked for no compaction are excluded from compaction planning.").
+		Required().Enum(metadata.DeletionMarkFilename, metadata.NoCompactMarkFilename)
+	details := cmd.Flag("details", "Human readable reason of marking the block for no compaction.").String()
+	remove := cmd.Flag("remove", "Remove the marker instead of setting it.").Default("false").Bool()
+
+	m[name+" mark"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		blockIDs := make([]ulid.ULID, 0, len(*ids))
+		for _, id := range *ids {
+			u, err := ulid.Parse(id)
+			if err != nil {
+				return errors.Wrapf(err, "invalid ULID %q in --id flag", id)
+			}
+			blockIDs = append(blockIDs, u)
+		}
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		blocksMarked := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_bucket_blocks_marked_total",
+			Help: "Total number of blocks marked by marker file name.",
+		}, []string{"marker"}).WithLabelValues(*marker)
+
+		ctx := context.Background()
+		for _, id := range blockIDs {
+			if *remove {
+				if err := block.RemoveMark(ctx, logger, bkt, id, *marker); err != nil {
+					return errors.Wrapf(err, "remove %s of block %s", *marker, id)
+				}
+				continue
+			}
+
+			exists, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+			if err != nil {
+				return errors.Wrapf(err, "check meta of block %s", id)
+			}
+			if !exists {
+				return errors.Errorf("block %s not found in bucket", id)
+			}
+
+			switch *marker {
+			case metadata.DeletionMarkFilename:
+				err = block.MarkForDeletion(ctx, logger, bkt, id, blocksMarked)
+			case metadata.NoCompactMarkFilename:
+				err = block.MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, *details, blocksMarked)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "mark block %s with %s", id, *marker)
+			}
+		}
+		level.Info(logger).Log("msg", "marking done", "marker", *marker, "remove", *remove, "blocks", len(blockIDs))
+		return nil
+	}
+}
+
+func registerBucketTombstone(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("tombstone", "Upload a global tombstone deleting series from all blocks in the bucket. Store gateways mask deleted series at query time and compactors remove them from raw blocks when compacting them.")
+	matchers := cmd.Flag("matchers", "Series selector of the series to delete, e.g. '{__name__=\"up\", job=\"node\"}'. Matchers are matched against series labels including external labels.").Required().String()
+	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range of deleted samples. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("0000-01-01T00:00:00Z"))
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range of deleted samples. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("9999-12-31T23:59:59Z"))
+	author := cmd.Flag("author", "Human readable author of the deletion.").String()
+	reason := cmd.Flag("reason", "Human readable reason of the deletion.").String()
+
+	m[name+" tombstone"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		t, err := tombstone.NewTombstone(*matchers, minTime.PrometheusTimestamp(), maxTime.PrometheusTimestamp(), *author, *reason)
+		if err != nil {
+			return errors.Wrap(err, "create tombstone")
+		}
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if err := tombstone.Upload(ctx, bkt, t); err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "uploaded tombstone", "id", t.ID, "matchers", t.Matchers, "min_time", t.MinTime, "max_time", t.MaxTime)
+		return nil
+	}
+}
+
+func registerBucketBackfill(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("backfill", "Create blocks from OpenMetrics exposition files with timestamps and upload them to the bucket, e.g. to import historical data from other systems.")
+	inputs := cmd.Flag("input", "OpenMetrics exposition file to import. All samples must have timestamps. Repeated flag.").Required().ExistingFiles()
+	labelStrs := cmd.Flag("label", "External label to add to the created blocks. Series of the input must not have external labels. Repeated flag.").PlaceHolder("<name>=\"<value>\"").Strings()
+	blockDuration := modelDuration(cmd.Flag("block-duration", "Time range of the created blocks. Samples are split into blocks of aligned time ranges of this duration.").Default("2h"))
+	dataDir := cmd.Flag("data-dir", "Data directory in which to create blocks before uploading them.").Default("./data").String()
+
+	m[name+" backfill"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		extLset, err := parseFlagLabels(*labelStrs)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+		sort.Sort(extLset)
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		if err := os.MkdirAll(*dataDir, 0777); err != nil {
+			return errors.Wrap(err, "create data dir")
+		}
+
+		ctx := context.Background()
+		for _, input := range *inputs {
+			b, err := ioutil.ReadFile(input)
+			if err != nil {
+				return errors.Wrapf(err, "read input %s", input)
+			}
+			ids, err := backfill.CreateBlocks(ctx, logger, b, *dataDir, int64(time.Duration(*blockDuration)/time.Millisecond), extLset)
+			if err != nil {
+				return errors.Wrapf(err, "create blocks from input %s", input)
+			}
+			for _, id := range ids {
+				bdir := filepath.Join(*dataDir, id.String())
+				if err := block.Upload(ctx, logger, bkt, bdir); err != nil {
+					return errors.Wrapf(err, "upload block %s", id)
+				}
+				if err := os.RemoveAll(bdir); err != nil {
+					return errors.Wrapf(err, "remove block dir %s", bdir)
+				}
+			}
+			level.Info(logger).Log("msg", "backfilled input", "input", input, "blocks", len(ids))
+		}
+		return nil
+	}
+}
+
+func registerBucketLineage(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("lineage", "Print the tree of blocks the given block was compacted, downsampled or split from, as recorded in the meta.json of the block and of its ancestors. Parent blocks deleted from the bucket are printed without their own parents.")
+	id := cmd.Flag("id", "ID (ULID) of the block.").Required().String()
+	timeout := cmd.Flag("timeout", "Timeout to download the block meta.").Default("5m").Duration()
+
+	m[name+" lineage"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		blockID, err := ulid.Parse(*id)
+		if err != nil {
+			return errors.Wrapf(err, "invalid ULID %q in --id flag", *id)
+		}
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		meta, err := block.DownloadMeta(ctx, logger, bkt, blockID)
+		if err != nil {
+			return errors.Wrapf(err, "download meta of block %s", blockID)
+		}
+		return printLineage(os.Stdout, &meta, func(id ulid.ULID) (*metadata.Meta, error) {
+			ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+			if err != nil || !ok {
+				return nil, err
+			}
+			m, err := block.DownloadMeta(ctx, logger, bkt, id)
+			if err != nil {
+				return nil, errors.Wrapf(err, "download meta of block %s", id)
+			}
+			return &m, nil
+		})
+	}
+}
+
+// printLineage writes the lineage of the given block as a tree, one block per line. The metas of parents are
+// looked up with getMeta, which returns nil for parents which do not exist anymore.
+func printLineage(w io.Writer, m *metadata.Meta, getMeta func(ulid.ULID) (*metadata.Meta, error)) error {
+	lines, err := appendLineageParents([]string{formatLineageBlock(m)}, m.Thanos.Lineage, "", getMeta)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func appendLineageParents(lines []string, l *metadata.Lineage, indent string, getMeta func(ulid.ULID) (*metadata.Meta, error)) ([]string, error) {
+	if l == nil {
+		return lines, nil
+	}
+	for i, p := range l.Parents {
+		branch, next := "├── ", "│   "
+		if i == len(l.Parents)-1 {
+			branch, next = "└── ", "    "
+		}
+		m, err := getMeta(p.ULID)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			lines = append(lines, indent+branch+fmt.Sprintf("%s %s deleted", p.ULID, formatLineageRange(p.MinTime, p.MaxTime)))
+			continue
+		}
+		lines = append(lines, indent+branch+formatLineageBlock(m))
+		if lines, err = appendLineageParents(lines, m.Thanos.Lineage, indent+next, getMeta); err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+func formatLineageRange(mint, maxt int64) string {
+	return fmt.Sprintf("[%s, %s)", timestamp.Time(mint).UTC().Format(time.RFC3339), timestamp.Time(maxt).UTC().Format(time.RFC3339))
+}
+
+func formatLineageBlock(m *metadata.Meta) string {
+	s := fmt.Sprintf("%s %s resolution=%s",
+		m.ULID,
+		formatLineageRange(m.MinTime, m.MaxTime),
+		time.Duration(m.Thanos.Downsample.Resolution*int64(time.Millisecond)),
+	)
+	if m.Thanos.Shard != "" {
+		s += " shard=" + m.Thanos.Shard
+	}
+	if l := m.Thanos.Lineage; l != nil {
+		s += fmt.Sprintf(" <- %s by %s at %s", l.Operation, l.Source, timestamp.Time(l.CreationTime).UTC().Format(time.RFC3339))
+	}
+	return s
+}
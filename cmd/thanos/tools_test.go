@@ -4,9 +4,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -31,3 +39,92 @@ func Test_CheckRules(t *testing.T) {
 		testutil.NotOk(t, checkRulesFiles(logger, &fn))
 	}
 }
+
+func Test_PrintBlocks(t *testing.T) {
+	metas := []*metadata.Meta{
+		{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil), MinTime: 0, MaxTime: 7200000, Stats: tsdb.BlockStats{NumSeries: 2000}},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"a": "1"}},
+		},
+		{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: 0, MaxTime: 7200000, Stats: tsdb.BlockStats{NumSeries: 100}},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"a": "2"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	testutil.Ok(t, printBlocks(&buf, metas, nil, downsample.DefaultLevels, []string{"#SERIES"}, []string{"#SERIES", "LABELS"}, "csv"))
+	testutil.Equals(t, "#SERIES,LABELS\n100,a=2\n2000,a=1\n", buf.String())
+
+	buf.Reset()
+	testutil.Ok(t, printBlocks(&buf, metas, labels.FromStrings("a", "1"), downsample.DefaultLevels, []string{"FROM"}, []string{"ULID", "#SERIES"}, "tsv"))
+	testutil.Equals(t, "ULID\t#SERIES\n"+ulid.MustNew(2, nil).String()+"\t2000\n", buf.String())
+
+	buf.Reset()
+	testutil.Ok(t, printBlocks(&buf, metas, nil, downsample.DefaultLevels, []string{"#SERIES"}, []string{"#SERIES"}, "json"))
+	var rows []map[string]string
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &rows))
+	testutil.Equals(t, []map[string]string{{"#SERIES": "100"}, {"#SERIES": "2000"}}, rows)
+
+	// The time until the next downsampling depends on the configured levels.
+	buf.Reset()
+	testutil.Ok(t, printBlocks(&buf, metas[:1], nil, []downsample.Level{{Resolution: 60000, MinBlockRange: 4 * 3600000}}, []string{"FROM"}, []string{"UNTIL-DOWN"}, "csv"))
+	testutil.Equals(t, "UNTIL-DOWN\n2h0m0s\n", buf.String())
+
+	testutil.NotOk(t, printBlocks(&buf, metas, nil, downsample.DefaultLevels, []string{"FROM"}, []string{"UNKNOWN"}, "csv"))
+}
+
+func Test_PrintLineage(t *testing.T) {
+	a, b, c, d := ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil), ulid.MustNew(4, nil)
+	metas := map[ulid.ULID]*metadata.Meta{
+		a: {BlockMeta: tsdb.BlockMeta{ULID: a, MinTime: 0, MaxTime: 7200000}},
+		c: {
+			BlockMeta: tsdb.BlockMeta{ULID: c, MinTime: 0, MaxTime: 14400000},
+			Thanos: metadata.Thanos{
+				Lineage: &metadata.Lineage{
+					Operation:    metadata.LineageCompaction,
+					Source:       metadata.CompactorSource,
+					CreationTime: 43200000,
+					Parents: []metadata.LineageParent{
+						{ULID: a, MinTime: 0, MaxTime: 7200000},
+						{ULID: b, MinTime: 7200000, MaxTime: 14400000},
+					},
+				},
+			},
+		},
+	}
+	meta := &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: d, MinTime: 0, MaxTime: 14400000},
+		Thanos: metadata.Thanos{
+			Downsample: metadata.ThanosDownsample{Resolution: 300000},
+			Lineage: &metadata.Lineage{
+				Operation:    metadata.LineageDownsampling,
+				Source:       metadata.CompactorSource,
+				CreationTime: 86400000,
+				Parents:      []metadata.LineageParent{{ULID: c, MinTime: 0, MaxTime: 14400000}},
+			},
+		},
+	}
+	getMeta := func(id ulid.ULID) (*metadata.Meta, error) { return metas[id], nil }
+
+	var buf bytes.Buffer
+	testutil.Ok(t, printLineage(&buf, meta, getMeta))
+	testutil.Equals(t, d.String()+" [1970-01-01T00:00:00Z, 1970-01-01T04:00:00Z) resolution=5m0s <- downsampling by compactor at 1970-01-02T00:00:00Z\n"+
+		"└── "+c.String()+" [1970-01-01T00:00:00Z, 1970-01-01T04:00:00Z) resolution=0s <- compaction by compactor at 1970-01-01T12:00:00Z\n"+
+		"    ├── "+a.String()+" [1970-01-01T00:00:00Z, 1970-01-01T02:00:00Z) resolution=0s\n"+
+		"    └── "+b.String()+" [1970-01-01T02:00:00Z, 1970-01-01T04:00:00Z) deleted\n", buf.String())
+
+	testutil.NotOk(t, printLineage(&buf, meta, func(ulid.ULID) (*metadata.Meta, error) { return nil, errors.New("fail") }))
+}
+
+func Test_MatchesBlock(t *testing.T) {
+	m := &metadata.Meta{Thanos: metadata.Thanos{
+		Labels:     map[string]string{"cluster": "eu1", "replica": "a"},
+		Downsample: metadata.ThanosDownsample{Resolution: 300000},
+	}}
+
+	testutil.Assert(t, matchesBlock(m, nil, nil), "no filters should match")
+	testutil.Assert(t, matchesBlock(m, []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "cluster", "eu.*")}, []int64{0, 300000}), "matchers and resolution should match")
+	testutil.Assert(t, !matchesBlock(m, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "cluster", "us1")}, nil), "matcher should not match")
+	testutil.Assert(t, !matchesBlock(m, nil, []int64{0}), "resolution should not match")
+}
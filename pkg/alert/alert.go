@@ -283,12 +283,13 @@ func NewSender(
 	}
 	var (
 		versions       []APIVersion
-		versionPresent map[APIVersion]struct{}
+		versionPresent = map[APIVersion]struct{}{}
 	)
 	for _, am := range alertmanagers {
 		if _, found := versionPresent[am.version]; found {
 			continue
 		}
+		versionPresent[am.version] = struct{}{}
 		versions = append(versions, am.version)
 	}
 	s := &Sender{
@@ -5,6 +5,8 @@ package alert
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -166,3 +168,71 @@ func TestSenderSendsAllFail(t *testing.T) {
 	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.errs.WithLabelValues(poster.urls[1].Host))))
 	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.dropped)))
 }
+
+type recordingClient struct {
+	url    *url.URL
+	mtx    sync.Mutex
+	bodies map[string][]byte
+}
+
+func (r *recordingClient) Endpoints() []*url.URL {
+	return []*url.URL{r.url}
+}
+
+func (r *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.bodies[req.URL.Path] = b
+
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(http.StatusOK)
+	return rec.Result(), nil
+}
+
+func TestSenderSendsPerAPIVersion(t *testing.T) {
+	v1 := &recordingClient{url: &url.URL{Host: "am1:9090", Path: "/prefix"}, bodies: map[string][]byte{}}
+	v2 := &recordingClient{url: &url.URL{Host: "am2:9090"}, bodies: map[string][]byte{}}
+	s := NewSender(nil, nil, []*Alertmanager{
+		NewAlertmanager(nil, v1, time.Minute, APIv1),
+		NewAlertmanager(nil, v2, time.Minute, APIv2),
+		NewAlertmanager(nil, v2, time.Minute, APIv2),
+	})
+	// Alerts are encoded once per API version.
+	testutil.Equals(t, []APIVersion{APIv1, APIv2}, s.versions)
+
+	startsAt := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.Send(context.Background(), []*Alert{{
+		Labels:       labels.FromStrings("alertname", "Test", "severity", "page"),
+		Annotations:  labels.FromStrings("summary", "test alert"),
+		StartsAt:     startsAt,
+		EndsAt:       startsAt.Add(time.Hour),
+		GeneratorURL: "http://thanos-query/graph",
+	}})
+
+	testutil.Equals(t, []string{"/prefix/api/v1/alerts"}, keys(v1.bodies))
+	testutil.Equals(t, []string{"/api/v2/alerts"}, keys(v2.bodies))
+
+	var posted []map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(v2.bodies["/api/v2/alerts"], &posted))
+	testutil.Equals(t, []map[string]interface{}{{
+		"labels":       map[string]interface{}{"alertname": "Test", "severity": "page"},
+		"annotations":  map[string]interface{}{"summary": "test alert"},
+		"startsAt":     "2020-05-01T10:00:00.000Z",
+		"endsAt":       "2020-05-01T11:00:00.000Z",
+		"generatorURL": "http://thanos-query/graph",
+	}}, posted)
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.sent.WithLabelValues("am2:9090"))))
+}
+
+func keys(m map[string][]byte) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
@@ -24,6 +24,10 @@ func TestUnmarshalAPIVersion(t *testing.T) {
 			v:        "v1",
 			expected: APIv1,
 		},
+		{
+			v:        "v2",
+			expected: APIv2,
+		},
 		{
 			v:   "v3",
 			err: true,
@@ -144,3 +148,46 @@ func TestBuildAlertmanagerConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadAlertingConfig(t *testing.T) {
+	cfg, err := LoadAlertingConfig([]byte(`
+alertmanagers:
+- static_configs: ["dnssrv+_web._tcp.alertmanager.svc"]
+  scheme: https
+  api_version: v2
+  http_config:
+    bearer_token_file: /etc/token
+    tls_config:
+      ca_file: /etc/ca.crt
+      server_name: alertmanager
+- file_sd_configs:
+  - files: ["/etc/am.json"]
+  http_config:
+    basic_auth:
+      username: user
+      password_file: /etc/password
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(cfg.Alertmanagers))
+
+	v2 := DefaultAlertmanagerConfig()
+	v2.APIVersion = APIv2
+	v2.EndpointsConfig.Scheme = "https"
+	v2.EndpointsConfig.StaticAddresses = []string{"dnssrv+_web._tcp.alertmanager.svc"}
+	v2.HTTPClientConfig = http.ClientConfig{
+		BearerTokenFile: "/etc/token",
+		TLSConfig:       http.TLSConfig{CAFile: "/etc/ca.crt", ServerName: "alertmanager"},
+	}
+	testutil.Equals(t, v2, cfg.Alertmanagers[0])
+
+	testutil.Equals(t, APIv1, cfg.Alertmanagers[1].APIVersion)
+	testutil.Equals(t, []http.FileSDConfig{{Files: []string{"/etc/am.json"}}}, cfg.Alertmanagers[1].EndpointsConfig.FileSDConfigs)
+	testutil.Equals(t, http.BasicAuth{Username: "user", PasswordFile: "/etc/password"}, cfg.Alertmanagers[1].HTTPClientConfig.BasicAuth)
+
+	_, err = LoadAlertingConfig([]byte(`
+alertmanagers:
+- static_configs: ["localhost:9093"]
+  api_version: v3
+`))
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/common/route"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// Proxy exposes a read-only subset of the Alertmanager v2 API aggregated from multiple Alertmanager clusters.
+// Every endpoint of every cluster is queried. Alerts are merged by fingerprint and silences by ID, so replicas of the
+// same cluster do not produce duplicates.
+type Proxy struct {
+	logger        log.Logger
+	alertmanagers []*Alertmanager
+}
+
+// NewProxy returns a new Alertmanager API proxy for the given clients.
+// The v2 API is used for reads regardless of the configured API version of the clients.
+func NewProxy(logger log.Logger, alertmanagers []*Alertmanager) *Proxy {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Proxy{logger: logger, alertmanagers: alertmanagers}
+}
+
+// Register registers the proxy endpoints on the given router.
+// Endpoints mirror the Alertmanager API paths, e.g. /api/v2/alerts.
+func (p *Proxy) Register(r *route.Router, ins extpromhttp.InstrumentationMiddleware) {
+	instrf := func(name string, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+		return ins.NewHandler(name, http.HandlerFunc(next))
+	}
+
+	r.Get("/api/v2/alerts", instrf("alertmanager_alerts", p.alerts))
+	r.Get("/api/v2/silences", instrf("alertmanager_silences", p.silences))
+}
+
+func (p *Proxy) alerts(w http.ResponseWriter, r *http.Request) {
+	merged := map[string]*models.GettableAlert{}
+	if err := p.fanout(r, "/api/v2/alerts", func(body []byte) error {
+		var alerts models.GettableAlerts
+		if err := json.Unmarshal(body, &alerts); err != nil {
+			return err
+		}
+		for _, a := range alerts {
+			if a == nil || a.Fingerprint == nil {
+				continue
+			}
+			if prev, ok := merged[*a.Fingerprint]; ok && !newer(a.UpdatedAt, prev.UpdatedAt) {
+				continue
+			}
+			merged[*a.Fingerprint] = a
+		}
+		return nil
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	res := make(models.GettableAlerts, 0, len(merged))
+	for _, a := range merged {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return *res[i].Fingerprint < *res[j].Fingerprint })
+	p.respond(w, res)
+}
+
+func (p *Proxy) silences(w http.ResponseWriter, r *http.Request) {
+	merged := map[string]*models.GettableSilence{}
+	if err := p.fanout(r, "/api/v2/silences", func(body []byte) error {
+		var silences models.GettableSilences
+		if err := json.Unmarshal(body, &silences); err != nil {
+			return err
+		}
+		for _, s := range silences {
+			if s == nil || s.ID == nil {
+				continue
+			}
+			if prev, ok := merged[*s.ID]; ok && !newer(s.UpdatedAt, prev.UpdatedAt) {
+				continue
+			}
+			merged[*s.ID] = s
+		}
+		return nil
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	res := make(models.GettableSilences, 0, len(merged))
+	for _, s := range merged {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return *res[i].ID < *res[j].ID })
+	p.respond(w, res)
+}
+
+func (p *Proxy) respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Error(p.logger).Log("msg", "error writing alertmanager proxy response", "err", err)
+	}
+}
+
+// fanout sends the request to all endpoints of all Alertmanager clusters and calls merge with every successful response
+// body. Calls to merge are serialized. An error is returned only if no endpoint responded successfully.
+func (p *Proxy) fanout(r *http.Request, apiPath string, merge func(body []byte) error) error {
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		numTotal int
+		numOK    int
+		lastErr  error
+	)
+	for _, am := range p.alertmanagers {
+		for _, u := range am.dispatcher.Endpoints() {
+			numTotal++
+			wg.Add(1)
+			go func(am *Alertmanager, u url.URL) {
+				defer wg.Done()
+
+				u.Path = path.Join(u.Path, apiPath)
+				u.RawQuery = r.URL.RawQuery
+				body, err := am.get(r.Context(), u)
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				if err == nil {
+					err = errors.Wrapf(merge(body), "decode response from %q", u.Host)
+				}
+				if err != nil {
+					level.Warn(p.logger).Log("msg", "querying alertmanager failed", "alertmanager", u.Host, "err", err)
+					lastErr = err
+					return
+				}
+				numOK++
+			}(am, *u)
+		}
+	}
+	wg.Wait()
+
+	if numTotal == 0 {
+		return errors.New("no alertmanager endpoints available")
+	}
+	if numOK == 0 {
+		return errors.Wrap(lastErr, "all alertmanager endpoints failed")
+	}
+	return nil
+}
+
+// newer returns true if timestamp a is after b. Missing timestamps are considered the oldest.
+func newer(a, b *strfmt.DateTime) bool {
+	if a == nil {
+		return false
+	}
+	if b == nil {
+		return true
+	}
+	return time.Time(*a).After(time.Time(*b))
+}
+
+func (a *Alertmanager) get(ctx context.Context, u url.URL) ([]byte, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", contentTypeJSON)
+
+	resp, err := a.dispatcher.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "send request to %q", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(a.logger, resp.Body, "get from alertmanager")
+
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.Errorf("bad response status %v from %q", resp.Status, u.String())
+	}
+	return ioutil.ReadAll(resp.Body)
+}
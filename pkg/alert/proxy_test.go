@@ -0,0 +1,112 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/route"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestProxy(t *testing.T) {
+	respond := func(body string) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(http.StatusOK)
+		_, _ = rec.WriteString(body)
+		return rec.Result(), nil
+	}
+
+	// Cluster A has two replicas, one of which has a more recent state of alert "a1".
+	clusterA := &fakeClient{
+		urls: []*url.URL{{Host: "am-a1:9093"}, {Host: "am-a2:9093"}},
+		dof: func(u *url.URL) (*http.Response, error) {
+			if strings.HasSuffix(u.Path, "/silences") {
+				return respond(`[{"id":"s1","updatedAt":"2020-01-01T00:00:00Z"}]`)
+			}
+			if u.Host == "am-a1:9093" {
+				return respond(`[{"fingerprint":"a1","updatedAt":"2020-01-01T00:00:00Z","receivers":[{"name":"old"}]}]`)
+			}
+			return respond(`[{"fingerprint":"a1","updatedAt":"2020-01-01T00:01:00Z","receivers":[{"name":"new"}]},{"fingerprint":"a2","updatedAt":"2020-01-01T00:00:00Z"}]`)
+		},
+	}
+	clusterB := &fakeClient{
+		urls: []*url.URL{{Host: "am-b1:9093"}, {Host: "am-b2:9093"}},
+		dof: func(u *url.URL) (*http.Response, error) {
+			if u.Host == "am-b2:9093" {
+				return nil, errors.New("unavailable")
+			}
+			if u.RawQuery != "silenced=false" {
+				return nil, errors.Errorf("unexpected query %q", u.RawQuery)
+			}
+			if strings.HasSuffix(u.Path, "/silences") {
+				return respond(`[{"id":"s2","updatedAt":"2020-01-01T00:00:00Z"}]`)
+			}
+			return respond(`[{"fingerprint":"b1","updatedAt":"2020-01-01T00:00:00Z"}]`)
+		},
+	}
+
+	router := route.New()
+	NewProxy(nil, []*Alertmanager{
+		NewAlertmanager(nil, clusterA, time.Minute, APIv2),
+		NewAlertmanager(nil, clusterB, time.Minute, APIv1),
+	}).Register(router, extpromhttp.NewNopInstrumentationMiddleware())
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		b, err := ioutil.ReadAll(rec.Body)
+		testutil.Ok(t, err)
+		return rec.Code, string(b)
+	}
+
+	code, body := get("/api/v2/alerts?silenced=false")
+	testutil.Equals(t, http.StatusOK, code)
+	var alerts []struct {
+		Fingerprint string `json:"fingerprint"`
+		Receivers   []struct {
+			Name string `json:"name"`
+		} `json:"receivers"`
+	}
+	testutil.Ok(t, json.Unmarshal([]byte(body), &alerts))
+	testutil.Equals(t, 3, len(alerts))
+	testutil.Equals(t, "a1", alerts[0].Fingerprint)
+	testutil.Equals(t, "new", alerts[0].Receivers[0].Name)
+	testutil.Equals(t, "a2", alerts[1].Fingerprint)
+	testutil.Equals(t, "b1", alerts[2].Fingerprint)
+
+	code, body = get("/api/v2/silences?silenced=false")
+	testutil.Equals(t, http.StatusOK, code)
+	var silences []struct {
+		ID string `json:"id"`
+	}
+	testutil.Ok(t, json.Unmarshal([]byte(body), &silences))
+	testutil.Equals(t, 2, len(silences))
+	testutil.Equals(t, "s1", silences[0].ID)
+	testutil.Equals(t, "s2", silences[1].ID)
+
+	t.Run("all endpoints failed", func(t *testing.T) {
+		router := route.New()
+		NewProxy(nil, []*Alertmanager{
+			NewAlertmanager(nil, &fakeClient{
+				urls: []*url.URL{{Host: "am1:9093"}},
+				dof:  func(u *url.URL) (*http.Response, error) { return nil, errors.New("unavailable") },
+			}, time.Minute, APIv2),
+		}).Register(router, extpromhttp.NewNopInstrumentationMiddleware())
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v2/alerts", nil))
+		testutil.Equals(t, http.StatusBadGateway, rec.Code)
+	})
+}
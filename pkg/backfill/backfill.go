@@ -0,0 +1,182 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package backfill creates TSDB blocks from OpenMetrics exposition files with timestamps, e.g. to import
+// historical data from other systems.
+package backfill
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/textparse"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// commitBatchSize is the number of samples appended to the head before committing them.
+const commitBatchSize = 10000
+
+// sample is a sample of the series with the given index in the list of parsed series.
+type sample struct {
+	ref int
+	t   int64
+	v   float64
+}
+
+// CreateBlocks writes samples of the given OpenMetrics exposition into new TSDB blocks in dir, which get the given
+// external labels. Every block holds samples of one blockDuration aligned time range. All samples must have
+// timestamps. Samples do not have to be in timestamp order; of samples of a series with the same timestamp only
+// the first one in the input is kept.
+// It returns IDs of the created blocks.
+func CreateBlocks(ctx context.Context, logger log.Logger, input []byte, dir string, blockDuration int64, extLset labels.Labels) ([]ulid.ULID, error) {
+	if blockDuration <= 0 {
+		return nil, errors.Errorf("invalid block duration %d", blockDuration)
+	}
+	series, samples, err := parse(input, extLset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort samples by block, then by series and timestamp, so every block is written from a contiguous run of
+	// samples appended in order.
+	sort.SliceStable(samples, func(i, j int) bool {
+		bi, bj := alignDown(samples[i].t, blockDuration), alignDown(samples[j].t, blockDuration)
+		if bi != bj {
+			return bi < bj
+		}
+		if samples[i].ref != samples[j].ref {
+			return samples[i].ref < samples[j].ref
+		}
+		return samples[i].t < samples[j].t
+	})
+
+	var ids []ulid.ULID
+	for len(samples) > 0 {
+		if err := ctx.Err(); err != nil {
+			return ids, err
+		}
+		mint := alignDown(samples[0].t, blockDuration)
+		maxt := mint + blockDuration
+		n := sort.Search(len(samples), func(i int) bool { return samples[i].t >= maxt })
+
+		id, err := createBlock(ctx, logger, series, samples[:n], dir, mint, maxt, extLset)
+		if err != nil {
+			return ids, errors.Wrapf(err, "create block for time range [%d, %d)", mint, maxt)
+		}
+		level.Info(logger).Log("msg", "created block", "id", id, "mint", mint, "maxt", maxt)
+		ids = append(ids, id)
+		samples = samples[n:]
+	}
+	return ids, nil
+}
+
+// parse returns the series and samples of the input. It returns an error if the input is invalid, has samples
+// without timestamps or series with external labels.
+func parse(input []byte, extLset labels.Labels) ([]labels.Labels, []sample, error) {
+	var (
+		series  []labels.Labels
+		refs    = map[string]int{}
+		samples []sample
+	)
+	p := textparse.NewOpenMetricsParser(input)
+	for {
+		e, err := p.Next()
+		if err == io.EOF {
+			return series, samples, nil
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse input")
+		}
+		if e != textparse.EntrySeries {
+			continue
+		}
+		s, ts, v := p.Series()
+		if ts == nil {
+			return nil, nil, errors.Errorf("sample of series %s has no timestamp", s)
+		}
+
+		var lset labels.Labels
+		p.Metric(&lset)
+		sort.Sort(lset)
+		for _, l := range extLset {
+			if lset.Has(l.Name) {
+				return nil, nil, errors.Errorf("series %s has external label %s", s, l.Name)
+			}
+		}
+		ref, ok := refs[lset.String()]
+		if !ok {
+			ref = len(series)
+			refs[lset.String()] = ref
+			series = append(series, lset)
+		}
+		samples = append(samples, sample{ref: ref, t: *ts, v: v})
+	}
+}
+
+// createBlock writes the given samples within [mint, maxt), sorted by series and timestamp, into a new block in dir.
+func createBlock(ctx context.Context, logger log.Logger, series []labels.Labels, samples []sample, dir string, mint, maxt int64, extLset labels.Labels) (id ulid.ULID, err error) {
+	// The head accepts samples only within half of its chunk range before its max time, so the chunk range is
+	// twice the block range to accept samples of the whole block range in any order of series.
+	h, err := tsdb.NewHead(nil, logger, nil, 2*(maxt-mint))
+	if err != nil {
+		return id, errors.Wrap(err, "create head block")
+	}
+	defer runutil.CloseWithErrCapture(&err, h, "TSDB Head")
+
+	app := h.Appender()
+	for i, s := range samples {
+		// Samples are sorted, so duplicates of a timestamp follow each other.
+		if i > 0 && samples[i-1].ref == s.ref && samples[i-1].t == s.t {
+			continue
+		}
+		if _, err := app.Add(series[s.ref], s.t, s.v); err != nil {
+			if rerr := app.Rollback(); rerr != nil {
+				err = errors.Wrapf(err, "rollback failed: %v", rerr)
+			}
+			return id, errors.Wrapf(err, "add sample of series %s", series[s.ref])
+		}
+		if (i+1)%commitBatchSize == 0 {
+			if err := app.Commit(); err != nil {
+				return id, errors.Wrap(err, "commit")
+			}
+			app = h.Appender()
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return id, errors.Wrap(err, "commit")
+	}
+
+	c, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{maxt - mint}, nil)
+	if err != nil {
+		return id, errors.Wrap(err, "create compactor")
+	}
+	id, err = c.Write(dir, h, h.MinTime(), h.MaxTime()+1, nil)
+	if err != nil {
+		return id, errors.Wrap(err, "write block")
+	}
+	if _, err := metadata.InjectThanos(logger, filepath.Join(dir, id.String()), metadata.Thanos{
+		Labels:     extLset.Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.BackfillSource,
+	}, nil); err != nil {
+		return id, errors.Wrap(err, "inject thanos meta")
+	}
+	return id, nil
+}
+
+// alignDown returns the start of the range of the given width containing t.
+func alignDown(t, width int64) int64 {
+	if t >= 0 {
+		return t - t%width
+	}
+	return -((-t + width - 1) / width) * width
+}
@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package backfill
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCreateBlocks(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "test-backfill")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	extLset := labels.FromStrings("cluster", "eu1")
+	// Samples of the first series are within two 2h ranges and not in timestamp order, the last sample of up
+	// is a duplicate.
+	input := []byte(`# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 30 7260
+http_requests_total{code="200",method="get"} 10 3600
+http_requests_total{code="200",method="get"} 20 3660
+http_requests_total{code="500",method="get"} 2 3600
+http_requests_total{code="500",method="get"} 1 3500
+# TYPE up gauge
+up{job="node"} 1 3700.5
+up{job="node"} 2 3700.5
+# EOF
+`)
+
+	ids, err := CreateBlocks(ctx, log.NewNopLogger(), input, dir, 2*3600*1000, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+
+	meta, err := metadata.Read(filepath.Join(dir, ids[0].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(3500*1000), meta.MinTime)
+	testutil.Equals(t, int64(3700500+1), meta.MaxTime)
+	testutil.Equals(t, uint64(3), meta.Stats.NumSeries)
+	testutil.Equals(t, uint64(5), meta.Stats.NumSamples)
+	testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+	testutil.Equals(t, metadata.BackfillSource, meta.Thanos.Source)
+
+	meta, err = metadata.Read(filepath.Join(dir, ids[1].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(7260*1000), meta.MinTime)
+	testutil.Equals(t, uint64(1), meta.Stats.NumSamples)
+
+	// Empty input creates no blocks.
+	ids, err = CreateBlocks(ctx, log.NewNopLogger(), []byte("# EOF\n"), dir, 2*3600*1000, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(ids))
+
+	for _, input := range []string{
+		// Samples without timestamps.
+		"up{job=\"node\"} 1\n# EOF\n",
+		// Series with external labels.
+		"up{cluster=\"eu2\"} 1 3600\n# EOF\n",
+		// Input without EOF.
+		"up{job=\"node\"} 1 3600\n",
+	} {
+		_, err := CreateBlocks(ctx, log.NewNopLogger(), []byte(input), dir, 2*3600*1000, extLset)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestAlignDown(t *testing.T) {
+	testutil.Equals(t, int64(0), alignDown(0, 10))
+	testutil.Equals(t, int64(10), alignDown(19, 10))
+	testutil.Equals(t, int64(-10), alignDown(-1, 10))
+	testutil.Equals(t, int64(-10), alignDown(-10, 10))
+}
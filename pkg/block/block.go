@@ -14,7 +14,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -26,6 +25,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -69,46 +69,68 @@ func Download(ctx context.Context, logger log.Logger, bucket objstore.Bucket, id
 // It also verifies basic features of Thanos block.
 // TODO(bplotka): Ensure bucket operations have reasonable backoff retries.
 func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string) error {
-	df, err := os.Stat(bdir)
+	return UploadConcurrent(ctx, logger, bkt, bdir, 1)
+}
+
+// UploadConcurrent uploads block from given block dir like Upload does, but uploads up to the given number of block
+// files concurrently. Meta.json is still uploaded last, once all other files are uploaded.
+func UploadConcurrent(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string, concurrency int) error {
+	id, meta, err := readUploadableBlock(bdir)
 	if err != nil {
 		return err
 	}
-	if !df.IsDir() {
-		return errors.Errorf("%s is not a directory", bdir)
-	}
 
-	// Verify dir.
-	id, err := ulid.Parse(df.Name())
-	if err != nil {
-		return errors.Wrap(err, "not a block dir")
+	if err := objstore.UploadFile(ctx, logger, bkt, path.Join(bdir, MetaFilename), path.Join(DebugMetas, fmt.Sprintf("%s.json", id))); err != nil {
+		return errors.Wrap(err, "upload meta file to debug dir")
 	}
 
-	meta, err := metadata.Read(bdir)
-	if err != nil {
-		// No meta or broken meta file.
-		return errors.Wrap(err, "read meta")
+	var files []string
+	if err := filepath.Walk(filepath.Join(bdir, ChunksDirname), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	}); err != nil {
+		return cleanUp(logger, bkt, id, errors.Wrap(err, "list chunks"))
 	}
-
-	if meta.Thanos.Labels == nil || len(meta.Thanos.Labels) == 0 {
-		return errors.New("empty external labels are not allowed for Thanos block.")
+	files = append(files, filepath.Join(bdir, IndexFilename))
+	if meta.Thanos.Source == metadata.CompactorSource {
+		files = append(files, filepath.Join(bdir, IndexCacheFilename))
 	}
 
-	if err := objstore.UploadFile(ctx, logger, bkt, path.Join(bdir, MetaFilename), path.Join(DebugMetas, fmt.Sprintf("%s.json", id))); err != nil {
-		return errors.Wrap(err, "upload meta file to debug dir")
+	if concurrency < 1 {
+		concurrency = 1
 	}
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, concurrency)
+	for _, src := range files {
+		select {
+		case <-gctx.Done():
+		case sem <- struct{}{}:
+		}
+		if gctx.Err() != nil {
+			break
+		}
 
-	if err := objstore.UploadDir(ctx, logger, bkt, path.Join(bdir, ChunksDirname), path.Join(id.String(), ChunksDirname)); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload chunks"))
-	}
+		src := src
+		g.Go(func() error {
+			defer func() { <-sem }()
 
-	if err := objstore.UploadFile(ctx, logger, bkt, path.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename)); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
+			rel, err := filepath.Rel(bdir, src)
+			if err != nil {
+				return err
+			}
+			return objstore.UploadFile(gctx, logger, bkt, src, path.Join(id.String(), filepath.ToSlash(rel)))
+		})
 	}
-
-	if meta.Thanos.Source == metadata.CompactorSource {
-		if err := objstore.UploadFile(ctx, logger, bkt, path.Join(bdir, IndexCacheFilename), path.Join(id.String(), IndexCacheFilename)); err != nil {
-			return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index cache"))
-		}
+	if err := g.Wait(); err != nil {
+		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload block files"))
+	}
+	if err := ctx.Err(); err != nil {
+		return cleanUp(logger, bkt, id, err)
 	}
 
 	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file
@@ -120,6 +142,34 @@ func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 	return nil
 }
 
+// readUploadableBlock verifies basic features of Thanos block in the given block dir and returns its id and meta.
+func readUploadableBlock(bdir string) (ulid.ULID, *metadata.Meta, error) {
+	df, err := os.Stat(bdir)
+	if err != nil {
+		return ulid.ULID{}, nil, err
+	}
+	if !df.IsDir() {
+		return ulid.ULID{}, nil, errors.Errorf("%s is not a directory", bdir)
+	}
+
+	// Verify dir.
+	id, err := ulid.Parse(df.Name())
+	if err != nil {
+		return ulid.ULID{}, nil, errors.Wrap(err, "not a block dir")
+	}
+
+	meta, err := metadata.Read(bdir)
+	if err != nil {
+		// No meta or broken meta file.
+		return ulid.ULID{}, nil, errors.Wrap(err, "read meta")
+	}
+
+	if meta.Thanos.Labels == nil || len(meta.Thanos.Labels) == 0 {
+		return ulid.ULID{}, nil, errors.New("empty external labels are not allowed for Thanos block.")
+	}
+	return id, meta, nil
+}
+
 func cleanUp(logger log.Logger, bkt objstore.Bucket, id ulid.ULID, err error) error {
 	// Cleanup the dir with an uncancelable context.
 	cleanErr := Delete(context.Background(), logger, bkt, id)
@@ -158,12 +208,95 @@ func MarkForDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket
 	return nil
 }
 
+// MarkForNoCompact creates a file which stores information about when and why the block was marked to be excluded
+// from compaction.
+func MarkForNoCompact(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.NoCompactReason, details string, markedForNoCompact prometheus.Counter) error {
+	noCompactMarkFile := path.Join(id.String(), metadata.NoCompactMarkFilename)
+	noCompactMarkExists, err := bkt.Exists(ctx, noCompactMarkFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", noCompactMarkFile)
+	}
+	if noCompactMarkExists {
+		level.Warn(logger).Log("msg", "requested to mark for no compaction, but file already exists; this should not happen; investigate", "err", errors.Errorf("file %s already exists in bucket", noCompactMarkFile))
+		return nil
+	}
+
+	noCompactMark, err := json.Marshal(metadata.NoCompactMark{
+		ID:            id,
+		NoCompactTime: time.Now().Unix(),
+		Reason:        reason,
+		Details:       details,
+		Version:       metadata.NoCompactMarkVersion1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "json encode no-compact mark")
+	}
+
+	if err := bkt.Upload(ctx, noCompactMarkFile, bytes.NewBuffer(noCompactMark)); err != nil {
+		return errors.Wrapf(err, "upload file %s to bucket", noCompactMarkFile)
+	}
+	markedForNoCompact.Inc()
+	level.Info(logger).Log("msg", "block has been marked for no compaction", "block", id, "reason", reason)
+	return nil
+}
+
+// MarkQuarantined uploads a quarantine mark for the given partial block, so block.BaseFetcher with quarantine enabled
+// does not load it anymore. Unlike deletion marks, it is written into the directory of a block without valid meta.json.
+func MarkQuarantined(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, details string, quarantined prometheus.Counter) error {
+	quarantineMarkFile := path.Join(id.String(), metadata.QuarantineMarkFilename)
+	quarantineMarkExists, err := bkt.Exists(ctx, quarantineMarkFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", quarantineMarkFile)
+	}
+	if quarantineMarkExists {
+		level.Warn(logger).Log("msg", "requested to quarantine, but file already exists; this should not happen; investigate", "err", errors.Errorf("file %s already exists in bucket", quarantineMarkFile))
+		return nil
+	}
+
+	quarantineMark, err := json.Marshal(metadata.QuarantineMark{
+		ID:             id,
+		QuarantineTime: time.Now().Unix(),
+		Details:        details,
+		Version:        metadata.QuarantineMarkVersion1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "json encode quarantine mark")
+	}
+
+	if err := bkt.Upload(ctx, quarantineMarkFile, bytes.NewBuffer(quarantineMark)); err != nil {
+		return errors.Wrapf(err, "upload file %s to bucket", quarantineMarkFile)
+	}
+	quarantined.Inc()
+	level.Warn(logger).Log("msg", "partial block has been quarantined", "block", id, "details", details)
+	return nil
+}
+
+// RemoveMark deletes the given marker file, e.g. metadata.DeletionMarkFilename or metadata.NoCompactMarkFilename,
+// of the block. It is a no-op if the block is not marked.
+func RemoveMark(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, markFilename string) error {
+	markFile := path.Join(id.String(), markFilename)
+	ok, err := bkt.Exists(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", markFile)
+	}
+	if !ok {
+		level.Info(logger).Log("msg", "requested to remove mark, but block is not marked", "block", id, "mark", markFilename)
+		return nil
+	}
+
+	if err := bkt.Delete(ctx, markFile); err != nil {
+		return errors.Wrapf(err, "delete %s", markFile)
+	}
+	level.Info(logger).Log("msg", "mark has been removed", "block", id, "mark", markFilename)
+	return nil
+}
+
 // Delete removes directory that is meant to be block directory.
 // NOTE: Always prefer this method for deleting blocks.
-//  * We have to delete block's files in the certain order (meta.json first)
-//  to ensure we don't end up with malformed partial blocks. Thanos system handles well partial blocks
-//  only if they don't have meta.json. If meta.json is present Thanos assumes valid block.
-//  * This avoids deleting empty dir (whole bucket) by mistake.
+//   - We have to delete block's files in the certain order (meta.json first)
+//     to ensure we don't end up with malformed partial blocks. Thanos system handles well partial blocks
+//     only if they don't have meta.json. If meta.json is present Thanos assumes valid block.
+//   - This avoids deleting empty dir (whole bucket) by mistake.
 func Delete(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID) error {
 	metaFile := path.Join(id.String(), MetaFilename)
 	ok, err := bkt.Exists(ctx, metaFile)
@@ -188,10 +321,6 @@ func Delete(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid
 // NOTE: For objects removal use `block.Delete` strictly.
 func deleteDirRec(ctx context.Context, logger log.Logger, bkt objstore.Bucket, dir string, keep func(name string) bool) error {
 	return bkt.Iter(ctx, dir, func(name string) error {
-		// If we hit a directory, call DeleteDir recursively.
-		if strings.HasSuffix(name, objstore.DirDelim) {
-			return deleteDirRec(ctx, logger, bkt, name, keep)
-		}
 		if keep(name) {
 			return nil
 		}
@@ -200,7 +329,7 @@ func deleteDirRec(ctx context.Context, logger log.Logger, bkt objstore.Bucket, d
 		}
 		level.Debug(logger).Log("msg", "deleted file", "file", name, "bucket", bkt.Name())
 		return nil
-	})
+	}, objstore.WithRecursiveIter)
 }
 
 // DownloadMeta downloads only meta file from bucket by block ID.
@@ -161,6 +161,12 @@ func TestUpload(t *testing.T) {
 		testutil.Equals(t, 401, len(bkt.Objects()[path.Join(b1.String(), IndexFilename)]))
 		testutil.Equals(t, 365, len(bkt.Objects()[path.Join(b1.String(), MetaFilename)]))
 	}
+	{
+		// Concurrent upload results in the same objects.
+		cbkt := objstore.NewInMemBucket()
+		testutil.Ok(t, UploadConcurrent(ctx, log.NewNopLogger(), cbkt, path.Join(tmpDir, "test", b1.String()), 4))
+		testutil.Equals(t, bkt.Objects(), cbkt.Objects())
+	}
 	{
 		// Upload with no external labels should be blocked.
 		b2, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
@@ -281,3 +287,32 @@ func TestMarkForDeletion(t *testing.T) {
 		})
 	}
 }
+
+func TestMarkForNoCompact(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx := context.Background()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	id := ulid.MustNew(uint64(1), nil)
+	c := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+
+	testutil.Ok(t, MarkForNoCompact(ctx, log.NewNopLogger(), bkt, id, metadata.IndexSizeExceedingNoCompactReason, "index too big", c))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(c))
+
+	mark, err := metadata.ReadNoCompactMark(ctx, bkt, nil, id.String())
+	testutil.Ok(t, err)
+	testutil.Equals(t, id, mark.ID)
+	testutil.Equals(t, metadata.IndexSizeExceedingNoCompactReason, mark.Reason)
+	testutil.Equals(t, "index too big", mark.Details)
+
+	// Marking again is a no-op.
+	testutil.Ok(t, MarkForNoCompact(ctx, log.NewNopLogger(), bkt, id, metadata.ManualNoCompactReason, "other", c))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(c))
+
+	testutil.Ok(t, RemoveMark(ctx, log.NewNopLogger(), bkt, id, metadata.NoCompactMarkFilename))
+	_, err = metadata.ReadNoCompactMark(ctx, bkt, nil, id.String())
+	testutil.Equals(t, metadata.ErrorNoCompactMarkNotFound, err)
+
+	// Removing missing mark is a no-op.
+	testutil.Ok(t, RemoveMark(ctx, log.NewNopLogger(), bkt, id, metadata.NoCompactMarkFilename))
+}
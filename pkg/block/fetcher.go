@@ -6,6 +6,7 @@ package block
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -23,6 +24,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 	tsdberrors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
@@ -56,15 +58,17 @@ func (s *fetcherMetrics) resetTx() {
 const (
 	fetcherSubSys = "blocks_meta"
 
-	corruptedMeta = "corrupted-meta-json"
-	noMeta        = "no-meta-json"
-	loadedMeta    = "loaded"
-	failedMeta    = "failed"
+	corruptedMeta   = "corrupted-meta-json"
+	noMeta          = "no-meta-json"
+	quarantinedMeta = "quarantined"
+	loadedMeta      = "loaded"
+	failedMeta      = "failed"
 
 	// Synced label values.
 	labelExcludedMeta = "label-excluded"
 	timeExcludedMeta  = "time-excluded"
 	tooFreshMeta      = "too-fresh"
+	tooYoungMeta      = "too-young"
 	duplicateMeta     = "duplicate"
 	// Blocks that are marked for deletion can be loaded as well. This is done to make sure that we load blocks that are meant to be deleted,
 	// but don't have a replacement block yet.
@@ -103,8 +107,10 @@ func newFetcherMetrics(reg prometheus.Registerer) *fetcherMetrics {
 		[]string{"state"},
 		[]string{corruptedMeta},
 		[]string{noMeta},
+		[]string{quarantinedMeta},
 		[]string{loadedMeta},
 		[]string{tooFreshMeta},
+		[]string{tooYoungMeta},
 		[]string{failedMeta},
 		[]string{labelExcludedMeta},
 		[]string{timeExcludedMeta},
@@ -147,12 +153,22 @@ type BaseFetcher struct {
 	// Optional local directory to cache meta.json files.
 	cacheDir string
 	cached   map[ulid.ULID]*metadata.Meta
-	syncs    prometheus.Counter
-	g        singleflight.Group
+	// Versions of cached meta.json files, if the bucket supports conditional reads.
+	cachedVersions map[ulid.ULID]string
+	// Partial blocks older than quarantineAge are checked for a quarantine mark. 0 disables quarantine.
+	quarantineAge  time.Duration
+	quarantinedMtx sync.Mutex
+	quarantined    map[ulid.ULID]struct{}
+	syncs          prometheus.Counter
+	notModified    prometheus.Counter
+	g              singleflight.Group
 }
 
 // NewBaseFetcher constructs BaseFetcher.
-func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, reg prometheus.Registerer) (*BaseFetcher, error) {
+// Partial blocks created more than quarantineAge ago with a quarantine mark, see MarkQuarantined, are not returned as
+// partial anymore. Their meta.json is still checked on every sync, so they are released once it is fixed. 0 disables
+// quarantine.
+func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, quarantineAge time.Duration, reg prometheus.Registerer) (*BaseFetcher, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
@@ -163,25 +179,36 @@ func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.Instrumente
 		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
 			return nil, err
 		}
+		if err := checkMetaCacheVersion(logger, cacheDir); err != nil {
+			return nil, errors.Wrap(err, "check version of meta.json cache")
+		}
 	}
 
 	return &BaseFetcher{
-		logger:      log.With(logger, "component", "block.BaseFetcher"),
-		concurrency: concurrency,
-		bkt:         bkt,
-		cacheDir:    cacheDir,
-		cached:      map[ulid.ULID]*metadata.Meta{},
+		logger:         log.With(logger, "component", "block.BaseFetcher"),
+		concurrency:    concurrency,
+		bkt:            bkt,
+		cacheDir:       cacheDir,
+		cached:         map[ulid.ULID]*metadata.Meta{},
+		cachedVersions: map[ulid.ULID]string{},
+		quarantineAge:  quarantineAge,
+		quarantined:    map[ulid.ULID]struct{}{},
 		syncs: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Subsystem: fetcherSubSys,
 			Name:      "base_syncs_total",
 			Help:      "Total blocks metadata synchronization attempts by base Fetcher",
 		}),
+		notModified: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Subsystem: fetcherSubSys,
+			Name:      "base_not_modified_total",
+			Help:      "Total number of meta.json files not downloaded by base Fetcher as they did not change since the last synchronization",
+		}),
 	}, nil
 }
 
 // NewMetaFetcher returns meta fetcher.
 func NewMetaFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, reg prometheus.Registerer, filters []MetadataFilter, modifiers []MetadataModifier) (*MetaFetcher, error) {
-	b, err := NewBaseFetcher(logger, concurrency, bkt, dir, reg)
+	b, err := NewBaseFetcher(logger, concurrency, bkt, dir, 0, reg)
 	if err != nil {
 		return nil, err
 	}
@@ -193,39 +220,111 @@ func (f *BaseFetcher) NewMetaFetcher(reg prometheus.Registerer, filters []Metada
 	return &MetaFetcher{metrics: newFetcherMetrics(reg), wrapped: f, filters: filters, modifiers: modifiers, logger: log.With(f.logger, logTags...)}
 }
 
+const (
+	// metaCacheVersion is the version of the format of meta.json files cached in the local dir. Bump it on changes
+	// making cached files invalid, e.g. of the meta.json schema, so that they are downloaded again.
+	metaCacheVersion = 1
+	// metaCacheVersionFile is the file in the local dir recording the version of cached files.
+	metaCacheVersionFile = "cache.json"
+)
+
+type metaCache struct {
+	Version int `json:"version"`
+}
+
+// checkMetaCacheVersion removes meta.json files cached in the given dir if they were cached by another version of
+// the cache format, or the version is unknown, and records the current version.
+func checkMetaCacheVersion(logger log.Logger, cacheDir string) error {
+	versionFile := filepath.Join(cacheDir, metaCacheVersionFile)
+
+	var c metaCache
+	b, err := ioutil.ReadFile(versionFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "read %s", versionFile)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &c); err != nil {
+			level.Warn(logger).Log("msg", "version of meta.json cache is corrupted; invalidating cache", "file", versionFile, "err", err)
+		}
+	}
+	if c.Version == metaCacheVersion {
+		return nil
+	}
+
+	names, err := fileutil.ReadDir(cacheDir)
+	if err != nil {
+		return errors.Wrapf(err, "read dir %s", cacheDir)
+	}
+	var removed int
+	for _, n := range names {
+		if _, ok := IsBlockDir(n); !ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, n)); err != nil {
+			return errors.Wrapf(err, "remove cached meta.json of block %s", n)
+		}
+		removed++
+	}
+	if removed > 0 {
+		level.Info(logger).Log("msg", "invalidated meta.json cache of another version", "version", c.Version, "expected", metaCacheVersion, "removed", removed)
+	}
+
+	b, err = json.Marshal(metaCache{Version: metaCacheVersion})
+	if err != nil {
+		return errors.Wrap(err, "marshal version of meta.json cache")
+	}
+	return ioutil.WriteFile(versionFile, b, os.ModePerm)
+}
+
 var (
 	ErrorSyncMetaNotFound  = errors.New("meta.json not found")
 	ErrorSyncMetaCorrupted = errors.New("meta.json corrupted")
 )
 
-// loadMeta returns metadata from object storage or error.
+// loadMeta returns metadata from object storage and its version, if the bucket supports conditional reads, or error.
 // It returns `ErrorSyncMetaNotFound` and `ErrorSyncMetaCorrupted` sentinel errors in those cases.
-func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID) (*metadata.Meta, error) {
+func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID) (*metadata.Meta, string, error) {
 	var (
 		metaFile       = path.Join(id.String(), MetaFilename)
 		cachedBlockDir = filepath.Join(f.cacheDir, id.String())
 	)
 
+	if m, seen := f.cached[id]; seen {
+		if version := f.cachedVersions[id]; version != "" {
+			// Version of the cached meta.json is known, so download it only if it changed since the last sync.
+			newMeta, newVersion, err := f.downloadMeta(ctx, metaFile, version)
+			if err != nil {
+				return nil, "", err
+			}
+			if newMeta == nil {
+				f.notModified.Inc()
+				return m, version, nil
+			}
+			f.cacheMeta(cachedBlockDir, newMeta)
+			return newMeta, newVersion, nil
+		}
+	}
+
 	// TODO(bwplotka): If that causes problems (obj store rate limits), add longer ttl to cached items.
 	// For 1y and 100 block sources this generates ~1.5-3k HEAD RPM. AWS handles 330k RPM per prefix.
 	// TODO(bwplotka): Consider filtering by consistency delay here (can't do until compactor healthyOverride work).
 	ok, err := f.bkt.Exists(ctx, metaFile)
 	if err != nil {
-		return nil, errors.Wrapf(err, "meta.json file exists: %v", metaFile)
+		return nil, "", errors.Wrapf(err, "meta.json file exists: %v", metaFile)
 	}
 	if !ok {
-		return nil, ErrorSyncMetaNotFound
+		return nil, "", ErrorSyncMetaNotFound
 	}
 
 	if m, seen := f.cached[id]; seen {
-		return m, nil
+		return m, "", nil
 	}
 
 	// Best effort load from local dir.
 	if f.cacheDir != "" {
 		m, err := metadata.Read(cachedBlockDir)
 		if err == nil {
-			return m, nil
+			return m, "", nil
 		}
 
 		if !errors.Is(err, os.ErrNotExist) {
@@ -236,47 +335,92 @@ func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID) (*metadata.Met
 		}
 	}
 
-	r, err := f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr).Get(ctx, metaFile)
+	m, version, err := f.downloadMeta(ctx, metaFile, "")
+	if err != nil {
+		return nil, "", err
+	}
+	f.cacheMeta(cachedBlockDir, m)
+	return m, version, nil
+}
+
+// downloadMeta downloads meta.json from object storage if it changed since the given version. Empty version always
+// downloads it. It returns nil meta if meta.json did not change.
+func (f *BaseFetcher) downloadMeta(ctx context.Context, metaFile, version string) (*metadata.Meta, string, error) {
+	r, newVersion, err := objstore.GetIfChanged(ctx, f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr), metaFile, version)
 	if f.bkt.IsObjNotFoundErr(err) {
-		// Meta.json was deleted between bkt.Exists and here.
-		return nil, errors.Wrapf(ErrorSyncMetaNotFound, "%v", err)
+		// Meta.json was deleted after the bucket was listed.
+		return nil, "", errors.Wrapf(ErrorSyncMetaNotFound, "%v", err)
 	}
 	if err != nil {
-		return nil, errors.Wrapf(err, "get meta file: %v", metaFile)
+		return nil, "", errors.Wrapf(err, "get meta file: %v", metaFile)
+	}
+	if r == nil {
+		return nil, newVersion, nil
 	}
 
 	defer runutil.CloseWithLogOnErr(f.logger, r, "close bkt meta get")
 
 	metaContent, err := ioutil.ReadAll(r)
 	if err != nil {
-		return nil, errors.Wrapf(err, "read meta file: %v", metaFile)
+		return nil, "", errors.Wrapf(err, "read meta file: %v", metaFile)
 	}
 
 	m := &metadata.Meta{}
 	if err := json.Unmarshal(metaContent, m); err != nil {
-		return nil, errors.Wrapf(ErrorSyncMetaCorrupted, "meta.json %v unmarshal: %v", metaFile, err)
+		return nil, "", errors.Wrapf(ErrorSyncMetaCorrupted, "meta.json %v unmarshal: %v", metaFile, err)
 	}
 
 	if m.Version != metadata.MetaVersion1 {
-		return nil, errors.Errorf("unexpected meta file: %s version: %d", metaFile, m.Version)
+		return nil, "", errors.Errorf("unexpected meta file: %s version: %d", metaFile, m.Version)
 	}
+	return m, newVersion, nil
+}
 
-	// Best effort cache in local dir.
-	if f.cacheDir != "" {
-		if err := os.MkdirAll(cachedBlockDir, os.ModePerm); err != nil {
-			level.Warn(f.logger).Log("msg", "best effort mkdir of the meta.json block dir failed; ignoring", "dir", cachedBlockDir, "err", err)
-		}
+// Quarantined returns sorted IDs of partial blocks which were quarantined as of the last complete sync.
+func (f *BaseFetcher) Quarantined() []ulid.ULID {
+	f.quarantinedMtx.Lock()
+	defer f.quarantinedMtx.Unlock()
 
-		if err := metadata.Write(f.logger, cachedBlockDir, m); err != nil {
-			level.Warn(f.logger).Log("msg", "best effort save of the meta.json to local dir failed; ignoring", "dir", cachedBlockDir, "err", err)
-		}
+	ids := make([]ulid.ULID, 0, len(f.quarantined))
+	for id := range f.quarantined {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+	return ids
+}
+
+// isQuarantined returns true if the given partial block was created more than quarantineAge ago and has a quarantine mark.
+func (f *BaseFetcher) isQuarantined(ctx context.Context, id ulid.ULID) (bool, error) {
+	if f.quarantineAge <= 0 || ulid.Now()-id.Time() <= uint64(f.quarantineAge/time.Millisecond) {
+		return false, nil
+	}
+	markFile := path.Join(id.String(), metadata.QuarantineMarkFilename)
+	ok, err := f.bkt.Exists(ctx, markFile)
+	if err != nil {
+		return false, errors.Wrapf(err, "quarantine mark exists: %v", markFile)
+	}
+	return ok, nil
+}
+
+// cacheMeta saves meta.json to the local dir, if configured. Best effort.
+func (f *BaseFetcher) cacheMeta(cachedBlockDir string, m *metadata.Meta) {
+	if f.cacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(cachedBlockDir, os.ModePerm); err != nil {
+		level.Warn(f.logger).Log("msg", "best effort mkdir of the meta.json block dir failed; ignoring", "dir", cachedBlockDir, "err", err)
+	}
+
+	if err := metadata.Write(f.logger, cachedBlockDir, m); err != nil {
+		level.Warn(f.logger).Log("msg", "best effort save of the meta.json to local dir failed; ignoring", "dir", cachedBlockDir, "err", err)
 	}
-	return m, nil
 }
 
 type response struct {
-	metas   map[ulid.ULID]*metadata.Meta
-	partial map[ulid.ULID]error
+	metas       map[ulid.ULID]*metadata.Meta
+	versions    map[ulid.ULID]string
+	partial     map[ulid.ULID]error
+	quarantined map[ulid.ULID]struct{}
 	// If metaErr > 0 it means incomplete view, so some metas, failed to be loaded.
 	metaErrs tsdberrors.MultiError
 
@@ -289,8 +433,10 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 
 	var (
 		resp = response{
-			metas:   make(map[ulid.ULID]*metadata.Meta),
-			partial: make(map[ulid.ULID]error),
+			metas:       make(map[ulid.ULID]*metadata.Meta),
+			versions:    make(map[ulid.ULID]string),
+			partial:     make(map[ulid.ULID]error),
+			quarantined: make(map[ulid.ULID]struct{}),
 		}
 		eg  errgroup.Group
 		ch  = make(chan ulid.ULID, f.concurrency)
@@ -299,14 +445,30 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 	for i := 0; i < f.concurrency; i++ {
 		eg.Go(func() error {
 			for id := range ch {
-				meta, err := f.loadMeta(ctx, id)
+				// Quarantined blocks are loaded as well, so they are released as soon as their meta.json is valid.
+				meta, version, err := f.loadMeta(ctx, id)
 				if err == nil {
 					mtx.Lock()
 					resp.metas[id] = meta
+					if version != "" {
+						resp.versions[id] = version
+					}
 					mtx.Unlock()
 					continue
 				}
 
+				if cause := errors.Cause(err); cause == ErrorSyncMetaNotFound || cause == ErrorSyncMetaCorrupted {
+					quarantined, qerr := f.isQuarantined(ctx, id)
+					if qerr != nil {
+						err = qerr
+					} else if quarantined {
+						mtx.Lock()
+						resp.quarantined[id] = struct{}{}
+						mtx.Unlock()
+						continue
+					}
+				}
+
 				switch errors.Cause(err) {
 				default:
 					mtx.Lock()
@@ -357,6 +519,9 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 	if len(resp.metaErrs) > 0 {
 		return resp, nil
 	}
+	f.quarantinedMtx.Lock()
+	f.quarantined = resp.quarantined
+	f.quarantinedMtx.Unlock()
 
 	// Only for complete view of blocks update the cache.
 	cached := make(map[ulid.ULID]*metadata.Meta, len(resp.metas))
@@ -364,6 +529,7 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 		cached[id] = m
 	}
 	f.cached = cached
+	f.cachedVersions = resp.versions
 
 	// Best effort cleanup of disk-cached metas.
 	if f.cacheDir != "" {
@@ -424,6 +590,7 @@ func (f *BaseFetcher) fetch(ctx context.Context, metrics *fetcherMetrics, filter
 	metrics.synced.WithLabelValues(failedMeta).Set(float64(len(resp.metaErrs)))
 	metrics.synced.WithLabelValues(noMeta).Set(resp.noMetas)
 	metrics.synced.WithLabelValues(corruptedMeta).Set(resp.corruptedMetas)
+	metrics.synced.WithLabelValues(quarantinedMeta).Set(float64(len(resp.quarantined)))
 
 	for _, filter := range filters {
 		// NOTE: filter can update synced metric accordingly to the reason of the exclude.
@@ -521,15 +688,15 @@ func NewLabelShardedMetaFilter(relabelConfig []*relabel.Config) *LabelShardedMet
 	return &LabelShardedMetaFilter{relabelConfig: relabelConfig}
 }
 
-// Special label that will have an ULID of the meta.json being referenced to.
-const blockIDLabel = "__block_id"
+// BlockIDLabel is a special label that will have an ULID of the meta.json being referenced to.
+const BlockIDLabel = "__block_id"
 
 // Filter filters out blocks that have no labels after relabelling of each block external (Thanos) labels.
 func (f *LabelShardedMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) error {
 	var lbls labels.Labels
 	for id, m := range metas {
 		lbls = lbls[:0]
-		lbls = append(lbls, labels.Label{Name: blockIDLabel, Value: id.String()})
+		lbls = append(lbls, labels.Label{Name: BlockIDLabel, Value: id.String()})
 		for k, v := range m.Thanos.Labels {
 			lbls = append(lbls, labels.Label{Name: k, Value: v})
 		}
@@ -549,6 +716,9 @@ var _ MetadataFilter = &DeduplicateFilter{}
 type DeduplicateFilter struct {
 	duplicateIDs []ulid.ULID
 	mu           sync.Mutex
+
+	identical     bool
+	replicaLabels map[string]struct{}
 }
 
 // NewDeduplicateFilter creates DeduplicateFilter.
@@ -556,34 +726,169 @@ func NewDeduplicateFilter() *DeduplicateFilter {
 	return &DeduplicateFilter{}
 }
 
+// NewIdenticalBlocksDeduplicateFilter creates DeduplicateFilter which additionally filters out copies of blocks with
+// exactly the same content, e.g. blocks uploaded by multiple sidecars of the same TSDB which differ only by their ULID
+// and replica labels. The oldest copy is kept.
+func NewIdenticalBlocksDeduplicateFilter(replicaLabels []string) *DeduplicateFilter {
+	f := &DeduplicateFilter{identical: true, replicaLabels: make(map[string]struct{}, len(replicaLabels))}
+	for _, l := range replicaLabels {
+		f.replicaLabels[l] = struct{}{}
+	}
+	return f
+}
+
 // Filter filters out duplicate blocks that can be formed
 // from two or more overlapping blocks that fully submatches the source blocks of the older blocks.
 func (f *DeduplicateFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) error {
 	var wg sync.WaitGroup
 
-	metasByResolution := make(map[int64][]*metadata.Meta)
+	// Shards of a split block have the same sources, so only blocks of the same resolution and shard can be duplicates.
+	type partition struct {
+		resolution int64
+		shard      string
+	}
+	metasByPartition := make(map[partition][]*metadata.Meta)
 	for _, meta := range metas {
-		res := meta.Thanos.Downsample.Resolution
-		metasByResolution[res] = append(metasByResolution[res], meta)
+		p := partition{resolution: meta.Thanos.Downsample.Resolution, shard: meta.Thanos.Shard}
+		metasByPartition[p] = append(metasByPartition[p], meta)
 	}
 
-	for res := range metasByResolution {
+	for p := range metasByPartition {
 		wg.Add(1)
-		go func(res int64) {
+		go func(p partition) {
 			defer wg.Done()
 			f.filterForResolution(NewNode(&metadata.Meta{
 				BlockMeta: tsdb.BlockMeta{
 					ULID: ulid.MustNew(uint64(0), nil),
 				},
-			}), metasByResolution[res], metas, synced)
-		}(res)
+			}), metasByPartition[p], metas, synced)
+		}(p)
 	}
 
 	wg.Wait()
 
+	f.filterSplit(metas, synced)
+	if f.identical {
+		f.filterIdentical(metas, synced)
+	}
 	return nil
 }
 
+// filterIdentical filters out blocks with the same content as an older block. Blocks are considered identical if they
+// have the same resolution, shard, time range, stats and external labels apart from replica labels, and the same file
+// sizes and hashes. Blocks whose meta.json does not record hashes of all their files, e.g. uploaded by older versions,
+// are never considered identical, as marking them for deletion would lose data if they are not.
+func (f *DeduplicateFilter) filterIdentical(metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) {
+	candidates := map[string][]*metadata.Meta{}
+	for _, meta := range metas {
+		// Blocks without stats cannot be compared.
+		if meta.Stats.NumSamples == 0 {
+			continue
+		}
+		var lset labels.Labels
+		for k, v := range meta.Thanos.Labels {
+			if _, ok := f.replicaLabels[k]; ok {
+				continue
+			}
+			lset = append(lset, labels.Label{Name: k, Value: v})
+		}
+		sort.Sort(lset)
+
+		key := fmt.Sprintf("%d/%s/%d/%d/%+v/%s", meta.Thanos.Downsample.Resolution, meta.Thanos.Shard, meta.MinTime, meta.MaxTime, meta.Stats, lset)
+		candidates[key] = append(candidates[key], meta)
+	}
+
+	for _, metaSlice := range candidates {
+		if len(metaSlice) < 2 {
+			continue
+		}
+		sort.Slice(metaSlice, func(i, j int) bool {
+			return metaSlice[i].ULID.Compare(metaSlice[j].ULID) < 0
+		})
+
+		var kept []*metadata.Meta
+	Metas:
+		for _, meta := range metaSlice {
+			for _, k := range kept {
+				if sameFiles(k.Thanos.Files, meta.Thanos.Files) {
+					f.duplicateIDs = append(f.duplicateIDs, meta.ULID)
+					synced.WithLabelValues(duplicateMeta).Inc()
+					delete(metas, meta.ULID)
+					continue Metas
+				}
+			}
+			kept = append(kept, meta)
+		}
+	}
+}
+
+// sameFiles returns true if the given files have the same sizes and hashes. Files without hash are never the same.
+func sameFiles(a, b []metadata.File) bool {
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+	files := make(map[string]metadata.File, len(a))
+	for _, f := range a {
+		files[f.RelPath] = f
+	}
+	for _, f := range b {
+		o, ok := files[f.RelPath]
+		if !ok || o.SizeBytes != f.SizeBytes || o.SHA256 == "" || o.SHA256 != f.SHA256 {
+			return false
+		}
+	}
+	return true
+}
+
+// filterSplit filters out blocks which were not split, but whose sources are all contained in a complete set of shards
+// of a split block with the same resolution, e.g. blocks downsampled before their compacted block was split.
+func (f *DeduplicateFilter) filterSplit(metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) {
+	type shardSet struct {
+		resolution int64
+		sources    []ulid.ULID
+		shards     map[int]struct{}
+		complete   int
+	}
+	sets := map[string]*shardSet{}
+	for _, meta := range metas {
+		if meta.Thanos.Shard == "" {
+			continue
+		}
+		index, shards, err := metadata.ParseShardID(meta.Thanos.Shard)
+		if err != nil {
+			continue
+		}
+		sources := append([]ulid.ULID(nil), meta.Compaction.Sources...)
+		sort.Slice(sources, func(i, j int) bool { return sources[i].Compare(sources[j]) < 0 })
+
+		key := fmt.Sprintf("%d/%d/%v", meta.Thanos.Downsample.Resolution, shards, sources)
+		set, ok := sets[key]
+		if !ok {
+			set = &shardSet{resolution: meta.Thanos.Downsample.Resolution, sources: sources, shards: map[int]struct{}{}, complete: shards}
+			sets[key] = set
+		}
+		set.shards[index] = struct{}{}
+	}
+	if len(sets) == 0 {
+		return
+	}
+
+	for id, meta := range metas {
+		if meta.Thanos.Shard != "" {
+			continue
+		}
+		for _, set := range sets {
+			if set.resolution != meta.Thanos.Downsample.Resolution || len(set.shards) != set.complete || !contains(set.sources, meta.Compaction.Sources) {
+				continue
+			}
+			f.duplicateIDs = append(f.duplicateIDs, id)
+			synced.WithLabelValues(duplicateMeta).Inc()
+			delete(metas, id)
+			break
+		}
+	}
+}
+
 func (f *DeduplicateFilter) filterForResolution(root *Node, metaSlice []*metadata.Meta, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) {
 	sort.Slice(metaSlice, func(i, j int) bool {
 		ilen := len(metaSlice[i].Compaction.Sources)
@@ -736,6 +1041,48 @@ func (f *ConsistencyDelayMetaFilter) Filter(_ context.Context, metas map[ulid.UL
 	return nil
 }
 
+var _ MetadataFilter = &MinBlockAgeMetaFilter{}
+
+// MinBlockAgeMetaFilter is a BaseFetcher filter that filters out blocks whose data is younger than a specified minimum
+// age, i.e. blocks with max time later than now minus the minimum age. Unlike ConsistencyDelayMetaFilter it is based on
+// the data of the block, not on its creation time, so it also filters out blocks uploaded again or with a delay.
+// Not go-routine safe.
+type MinBlockAgeMetaFilter struct {
+	logger log.Logger
+	minAge time.Duration
+}
+
+// NewMinBlockAgeMetaFilter creates MinBlockAgeMetaFilter.
+func NewMinBlockAgeMetaFilter(logger log.Logger, minAge time.Duration, reg prometheus.Registerer) *MinBlockAgeMetaFilter {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "min_block_age_seconds",
+		Help: "Configured minimum age of block data in seconds.",
+	}, func() float64 {
+		return minAge.Seconds()
+	})
+
+	return &MinBlockAgeMetaFilter{
+		logger: logger,
+		minAge: minAge,
+	}
+}
+
+// Filter filters out blocks with max time later than now minus the minimum age.
+func (f *MinBlockAgeMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) error {
+	threshold := timestamp.FromTime(time.Now().Add(-f.minAge))
+	for id, meta := range metas {
+		if meta.MaxTime > threshold {
+			level.Debug(f.logger).Log("msg", "block is too young for now", "block", id, "maxTime", meta.MaxTime)
+			synced.WithLabelValues(tooYoungMeta).Inc()
+			delete(metas, id)
+		}
+	}
+	return nil
+}
+
 // IgnoreDeletionMarkFilter is a filter that filters out the blocks that are marked for deletion after a given delay.
 // The delay duration is to make sure that the replacement block can be fetched before we filter out the old block.
 // Delay is not considered when computing DeletionMarkBlocks map.
@@ -786,3 +1133,46 @@ func (f *IgnoreDeletionMarkFilter) Filter(ctx context.Context, metas map[ulid.UL
 	}
 	return nil
 }
+
+// GatherNoCompactionMarkFilter is a filter that gathers blocks marked to be excluded from compaction. It does not
+// filter out any blocks, as such blocks still have to be e.g. downsampled and deleted by retention.
+// Not go-routine safe.
+type GatherNoCompactionMarkFilter struct {
+	logger           log.Logger
+	bkt              objstore.InstrumentedBucketReader
+	noCompactMarkMap map[ulid.ULID]*metadata.NoCompactMark
+}
+
+// NewGatherNoCompactionMarkFilter creates GatherNoCompactionMarkFilter.
+func NewGatherNoCompactionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader) *GatherNoCompactionMarkFilter {
+	return &GatherNoCompactionMarkFilter{
+		logger: logger,
+		bkt:    bkt,
+	}
+}
+
+// NoCompactMarkedBlocks returns block ids that were marked to be excluded from compaction.
+func (f *GatherNoCompactionMarkFilter) NoCompactMarkedBlocks() map[ulid.ULID]*metadata.NoCompactMark {
+	return f.noCompactMarkMap
+}
+
+// Filter gathers blocks marked to be excluded from compaction.
+func (f *GatherNoCompactionMarkFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, _ *extprom.TxGaugeVec) error {
+	f.noCompactMarkMap = make(map[ulid.ULID]*metadata.NoCompactMark)
+
+	for id := range metas {
+		noCompactMark, err := metadata.ReadNoCompactMark(ctx, f.bkt, f.logger, id.String())
+		if err == metadata.ErrorNoCompactMarkNotFound {
+			continue
+		}
+		if errors.Cause(err) == metadata.ErrorUnmarshalNoCompactMark {
+			level.Warn(f.logger).Log("msg", "found partial no-compact-mark.json; if we will see it happening often for the same block, consider manually deleting no-compact-mark.json from the object storage", "block", id, "err", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f.noCompactMarkMap[id] = noCompactMark
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/extprom"
@@ -75,7 +76,7 @@ func TestMetaFetcher_Fetch(t *testing.T) {
 
 		var ulidToDelete ulid.ULID
 		r := prometheus.NewRegistry()
-		baseFetcher, err := NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), dir, r)
+		baseFetcher, err := NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), dir, 0, r)
 		testutil.Ok(t, err)
 
 		fetcher := baseFetcher.NewMetaFetcher(r, []MetadataFilter{
@@ -297,6 +298,142 @@ func TestMetaFetcher_Fetch(t *testing.T) {
 	})
 }
 
+func TestBaseFetcher_ConditionalMetaFetch(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	upload := func(minTime int64) {
+		var meta metadata.Meta
+		meta.Version = 1
+		meta.ULID = ULID(1)
+		meta.MinTime = minTime
+
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&meta))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(meta.ULID.String(), metadata.MetaFilename), &buf))
+	}
+	upload(1)
+
+	baseFetcher, err := NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(bkt), "", 0, nil)
+	testutil.Ok(t, err)
+	fetcher := baseFetcher.NewMetaFetcher(nil, nil, nil)
+
+	metas, _, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(1), metas[ULID(1)].MinTime)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(baseFetcher.notModified))
+
+	// Not changed meta.json is not downloaded again.
+	metas, _, err = fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(1), metas[ULID(1)].MinTime)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(baseFetcher.notModified))
+
+	// Changed meta.json is downloaded.
+	upload(2)
+	metas, _, err = fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2), metas[ULID(1)].MinTime)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(baseFetcher.notModified))
+}
+
+func TestBaseFetcher_InvalidatesMetaCacheOfOtherVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-meta-cache-version")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	cacheDir := filepath.Join(dir, "meta-syncer")
+	cacheMeta := func(id ulid.ULID) {
+		var meta metadata.Meta
+		meta.Version = 1
+		meta.ULID = id
+		testutil.Ok(t, os.MkdirAll(filepath.Join(cacheDir, id.String()), os.ModePerm))
+		testutil.Ok(t, metadata.Write(log.NewNopLogger(), filepath.Join(cacheDir, id.String()), &meta))
+	}
+	cached := func(id ulid.ULID) bool {
+		_, err := os.Stat(filepath.Join(cacheDir, id.String(), metadata.MetaFilename))
+		if os.IsNotExist(err) {
+			return false
+		}
+		testutil.Ok(t, err)
+		return true
+	}
+
+	// Files cached before the cache was versioned are invalidated.
+	cacheMeta(ULID(1))
+	_, err = NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(objstore.NewInMemBucket()), dir, 0, nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !cached(ULID(1)), "meta.json of unknown cache version not invalidated")
+
+	// Files cached with the current version are kept.
+	cacheMeta(ULID(2))
+	_, err = NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(objstore.NewInMemBucket()), dir, 0, nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, cached(ULID(2)), "meta.json of current cache version invalidated")
+
+	// Files cached with another version are invalidated.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(cacheDir, metaCacheVersionFile), []byte(fmt.Sprintf(`{"version":%d}`, metaCacheVersion+1)), os.ModePerm))
+	_, err = NewBaseFetcher(log.NewNopLogger(), 20, objstore.WithNoopInstr(objstore.NewInMemBucket()), dir, 0, nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !cached(ULID(2)), "meta.json of other cache version not invalidated")
+}
+
+func TestBaseFetcher_Quarantine(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := objstore.NewInMemBucket()
+
+	recent := ulid.MustNew(ulid.Now(), nil)
+	for _, id := range []ulid.ULID{ULID(1), recent} {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), "index"), bytes.NewBufferString("index")))
+	}
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(ULID(2).String(), metadata.MetaFilename), bytes.NewBufferString("{")))
+
+	baseFetcher, err := NewBaseFetcher(logger, 20, objstore.WithNoopInstr(bkt), "", time.Hour, nil)
+	testutil.Ok(t, err)
+	fetcher := baseFetcher.NewMetaFetcher(nil, nil, nil)
+
+	_, partial, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(partial))
+
+	quarantined := prometheus.NewCounter(prometheus.CounterOpts{})
+	for _, id := range []ulid.ULID{ULID(1), ULID(2), recent} {
+		testutil.Ok(t, MarkQuarantined(ctx, logger, bkt, id, partial[id].Error(), quarantined))
+	}
+	testutil.Equals(t, 3.0, promtest.ToFloat64(quarantined))
+
+	// Only blocks older than the quarantine age are quarantined.
+	for i := 0; i < 2; i++ {
+		_, partial, err = fetcher.Fetch(ctx)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []ulid.ULID{ULID(1), ULID(2)}, baseFetcher.Quarantined())
+		testutil.Equals(t, 1, len(partial))
+		_, ok := partial[recent]
+		testutil.Assert(t, ok, "expected recent block to be partial")
+	}
+
+	// Block is synced again once its quarantine mark is removed.
+	testutil.Ok(t, RemoveMark(ctx, logger, bkt, ULID(1), metadata.QuarantineMarkFilename))
+	_, partial, err = fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(partial))
+	_, ok := partial[ULID(1)]
+	testutil.Assert(t, ok, "expected block without quarantine mark to be partial")
+	testutil.Equals(t, []ulid.ULID{ULID(2)}, baseFetcher.Quarantined())
+
+	// Block is released as soon as its meta.json is fixed, even if the quarantine mark is still there.
+	var buf bytes.Buffer
+	testutil.Ok(t, json.NewEncoder(&buf).Encode(&metadata.Meta{BlockMeta: tsdb.BlockMeta{Version: 1, ULID: ULID(2)}}))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(ULID(2).String(), metadata.MetaFilename), &buf))
+	metas, partial, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	_, ok = metas[ULID(2)]
+	testutil.Assert(t, ok, "expected fixed block to be loaded")
+	testutil.Equals(t, 2, len(partial))
+	testutil.Equals(t, []ulid.ULID{}, baseFetcher.Quarantined())
+}
+
 func TestLabelShardedMetaFilter_Filter_Basic(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
@@ -378,7 +515,7 @@ func TestLabelShardedMetaFilter_Filter_Hashmod(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
 			var relabelConfig []*relabel.Config
-			testutil.Ok(t, yaml.Unmarshal([]byte(fmt.Sprintf(relabelContentYamlFmt, blockIDLabel, i)), &relabelConfig))
+			testutil.Ok(t, yaml.Unmarshal([]byte(fmt.Sprintf(relabelContentYamlFmt, BlockIDLabel, i)), &relabelConfig))
 
 			f := NewLabelShardedMetaFilter(relabelConfig)
 
@@ -527,6 +664,7 @@ func TestTimePartitionMetaFilter_Filter(t *testing.T) {
 type sourcesAndResolution struct {
 	sources    []ulid.ULID
 	resolution int64
+	shard      string
 }
 
 func TestDeduplicateFilter_Filter(t *testing.T) {
@@ -847,6 +985,72 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 				ULID(12),
 			},
 		},
+		{
+			name: "shards of split block with same sources",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(1): {
+					sources:    []ulid.ULID{ULID(1)},
+					resolution: 0,
+				},
+				ULID(2): {
+					sources:    []ulid.ULID{ULID(2)},
+					resolution: 0,
+				},
+				ULID(3): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 0,
+					shard:      "1_of_2",
+				},
+				ULID(4): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 0,
+					shard:      "2_of_2",
+				},
+				ULID(5): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 0,
+					shard:      "2_of_2",
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(3),
+				ULID(4),
+			},
+		},
+		{
+			name: "blocks downsampled before split with complete and incomplete shards",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(3): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 10000,
+				},
+				ULID(4): {
+					sources:    []ulid.ULID{ULID(1), ULID(2), ULID(5)},
+					resolution: 10000,
+					shard:      "1_of_2",
+				},
+				ULID(5): {
+					sources:    []ulid.ULID{ULID(1), ULID(2), ULID(5)},
+					resolution: 10000,
+					shard:      "2_of_2",
+				},
+				ULID(6): {
+					sources:    []ulid.ULID{ULID(7)},
+					resolution: 10000,
+				},
+				ULID(7): {
+					sources:    []ulid.ULID{ULID(7), ULID(8)},
+					resolution: 10000,
+					shard:      "1_of_2",
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(4),
+				ULID(5),
+				ULID(6),
+				ULID(7),
+			},
+		},
 	} {
 		f := NewDeduplicateFilter()
 		if ok := t.Run(tcase.name, func(t *testing.T) {
@@ -865,6 +1069,7 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 						Downsample: metadata.ThanosDownsample{
 							Resolution: metaInfo.resolution,
 						},
+						Shard: metaInfo.shard,
 					},
 				}
 			}
@@ -877,6 +1082,97 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 	}
 }
 
+func TestDeduplicateFilter_FilterIdentical(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	newMeta := func(id ulid.ULID, lset map[string]string, numSamples uint64, files []metadata.File) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       id,
+				MinTime:    0,
+				MaxTime:    7200000,
+				Stats:      tsdb.BlockStats{NumSeries: 10, NumChunks: 20, NumSamples: numSamples},
+				Compaction: tsdb.BlockMetaCompaction{Sources: []ulid.ULID{id}},
+			},
+			Thanos: metadata.Thanos{Labels: lset, Files: files},
+		}
+	}
+	files := func(hash string) []metadata.File {
+		return []metadata.File{{RelPath: "chunks/000001", SizeBytes: 100, SHA256: hash}, {RelPath: "index", SizeBytes: 50, SHA256: hash}}
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		input    []*metadata.Meta
+		expected []ulid.ULID
+	}{
+		{
+			name: "copies differing by replica label",
+			input: []*metadata.Meta{
+				newMeta(ULID(1), map[string]string{"a": "1", "replica": "0"}, 1000, files("aa")),
+				newMeta(ULID(2), map[string]string{"a": "1", "replica": "1"}, 1000, files("aa")),
+				newMeta(ULID(3), map[string]string{"a": "1"}, 1000, files("aa")),
+			},
+			expected: []ulid.ULID{ULID(1)},
+		},
+		{
+			name: "different stats or labels",
+			input: []*metadata.Meta{
+				newMeta(ULID(1), map[string]string{"a": "1", "replica": "0"}, 1000, files("aa")),
+				newMeta(ULID(2), map[string]string{"a": "1", "replica": "1"}, 1001, files("aa")),
+				newMeta(ULID(3), map[string]string{"a": "2", "replica": "0"}, 1000, files("aa")),
+				newMeta(ULID(4), map[string]string{"a": "1", "other": "0"}, 1000, files("aa")),
+			},
+			expected: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4)},
+		},
+		{
+			name: "blocks without stats",
+			input: []*metadata.Meta{
+				newMeta(ULID(1), map[string]string{"a": "1"}, 0, files("aa")),
+				newMeta(ULID(2), map[string]string{"a": "1"}, 0, files("aa")),
+			},
+			expected: []ulid.ULID{ULID(1), ULID(2)},
+		},
+		{
+			name: "different file hashes",
+			input: []*metadata.Meta{
+				newMeta(ULID(1), map[string]string{"a": "1", "replica": "0"}, 1000, files("aa")),
+				newMeta(ULID(2), map[string]string{"a": "1", "replica": "1"}, 1000, files("bb")),
+				newMeta(ULID(3), map[string]string{"a": "1", "replica": "2"}, 1000, files("")),
+				newMeta(ULID(4), map[string]string{"a": "1", "replica": "3"}, 1000, files("bb")),
+			},
+			expected: []ulid.ULID{ULID(1), ULID(2), ULID(3)},
+		},
+		{
+			name: "legacy metas without files or hashes",
+			input: []*metadata.Meta{
+				newMeta(ULID(1), map[string]string{"a": "1", "replica": "0"}, 1000, nil),
+				newMeta(ULID(2), map[string]string{"a": "1", "replica": "1"}, 1000, nil),
+				newMeta(ULID(3), map[string]string{"a": "1", "replica": "2"}, 1000, files("")),
+				newMeta(ULID(4), map[string]string{"a": "1", "replica": "3"}, 1000, files("")),
+				newMeta(ULID(5), map[string]string{"a": "1", "replica": "4"}, 1000, files("aa")),
+			},
+			expected: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+	} {
+		if ok := t.Run(tcase.name, func(t *testing.T) {
+			f := NewIdenticalBlocksDeduplicateFilter([]string{"replica"})
+			m := newTestFetcherMetrics()
+			metas := make(map[ulid.ULID]*metadata.Meta)
+			for _, meta := range tcase.input {
+				metas[meta.ULID] = meta
+			}
+			testutil.Ok(t, f.Filter(ctx, metas, m.synced))
+			compareSliceWithMapKeys(t, metas, tcase.expected)
+			testutil.Equals(t, len(tcase.input)-len(tcase.expected), len(f.DuplicateIDs()))
+			testutil.Equals(t, float64(len(tcase.input)-len(tcase.expected)), promtest.ToFloat64(m.synced.WithLabelValues(duplicateMeta)))
+		}); !ok {
+			return
+		}
+	}
+}
+
 func TestReplicaLabelRemover_Modify(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
@@ -1057,6 +1353,26 @@ func TestConsistencyDelayMetaFilter_Filter_0(t *testing.T) {
 	})
 }
 
+func TestMinBlockAgeMetaFilter_Filter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	now := timestamp.FromTime(time.Now())
+	hour := time.Hour.Milliseconds()
+	input := map[ulid.ULID]*metadata.Meta{
+		ULID(1): {BlockMeta: tsdb.BlockMeta{MinTime: now - 4*hour, MaxTime: now - 3*hour}},
+		ULID(2): {BlockMeta: tsdb.BlockMeta{MinTime: now - 4*hour, MaxTime: now - 2*hour - time.Minute.Milliseconds()}},
+		ULID(3): {BlockMeta: tsdb.BlockMeta{MinTime: now - 3*hour, MaxTime: now - hour}},
+		ULID(4): {BlockMeta: tsdb.BlockMeta{MinTime: now - 2*hour, MaxTime: now}},
+	}
+
+	m := newTestFetcherMetrics()
+	f := NewMinBlockAgeMetaFilter(nil, 2*time.Hour, nil)
+	testutil.Ok(t, f.Filter(ctx, input, m.synced))
+	compareSliceWithMapKeys(t, input, []ulid.ULID{ULID(1), ULID(2)})
+	testutil.Equals(t, 2.0, promtest.ToFloat64(m.synced.WithLabelValues(tooYoungMeta)))
+}
+
 func TestIgnoreDeletionMarkFilter_Filter(t *testing.T) {
 	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
@@ -1109,3 +1425,40 @@ func TestIgnoreDeletionMarkFilter_Filter(t *testing.T) {
 		testutil.Equals(t, expected, input)
 	})
 }
+
+func TestGatherNoCompactionMarkFilter_Filter(t *testing.T) {
+	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
+		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+		defer cancel()
+
+		f := NewGatherNoCompactionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt))
+
+		marked := &metadata.NoCompactMark{
+			ID:            ULID(1),
+			NoCompactTime: time.Now().Unix(),
+			Details:       "test",
+			Version:       metadata.NoCompactMarkVersion1,
+		}
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&marked))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(marked.ID.String(), metadata.NoCompactMarkFilename), &buf))
+
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(ULID(2).String(), metadata.NoCompactMarkFilename), bytes.NewBufferString("not a valid no-compact-mark.json")))
+
+		input := map[ulid.ULID]*metadata.Meta{
+			ULID(1): {},
+			ULID(2): {},
+			ULID(3): {},
+		}
+		expected := map[ulid.ULID]*metadata.Meta{
+			ULID(1): {},
+			ULID(2): {},
+			ULID(3): {},
+		}
+
+		m := newTestFetcherMetrics()
+		testutil.Ok(t, f.Filter(ctx, input, m.synced))
+		testutil.Equals(t, expected, input)
+		testutil.Equals(t, map[ulid.ULID]*metadata.NoCompactMark{ULID(1): marked}, f.NoCompactMarkedBlocks())
+	})
+}
@@ -201,7 +201,7 @@ func (r *chunkedIndexReader) readTOC() (*index.TOC, error) {
 }
 
 func (r *chunkedIndexReader) CopySymbols(w io.Writer, buf []byte) (err error) {
-	rc, err := r.bkt.GetRange(r.ctx, r.path, int64(r.toc.Symbols), int64(r.toc.Series-r.toc.Symbols))
+	rc, err := objstore.GetRangeParallel(r.ctx, r.bkt, r.path, int64(r.toc.Symbols), int64(r.toc.Series-r.toc.Symbols), objstore.DefaultParallelDownloadOptions)
 	if err != nil {
 		return errors.Wrapf(err, "get symbols from object storage of %s", r.path)
 	}
@@ -215,7 +215,7 @@ func (r *chunkedIndexReader) CopySymbols(w io.Writer, buf []byte) (err error) {
 }
 
 func (r *chunkedIndexReader) CopyPostingsOffsets(w io.Writer, buf []byte) (err error) {
-	rc, err := r.bkt.GetRange(r.ctx, r.path, int64(r.toc.PostingsTable), int64(r.size-r.toc.PostingsTable))
+	rc, err := objstore.GetRangeParallel(r.ctx, r.bkt, r.path, int64(r.toc.PostingsTable), int64(r.size-r.toc.PostingsTable), objstore.DefaultParallelDownloadOptions)
 	if err != nil {
 		return errors.Wrapf(err, "get posting offset table from object storage of %s", r.path)
 	}
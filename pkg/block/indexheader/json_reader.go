@@ -227,7 +227,7 @@ func NewJSONReader(ctx context.Context, logger log.Logger, bkt objstore.Instrume
 	// No cache exists on disk yet, build it from the downloaded index and retry.
 	fn := filepath.Join(dir, id.String(), block.IndexFilename)
 
-	if err := objstore.DownloadFile(ctx, logger, bkt, filepath.Join(id.String(), block.IndexFilename), fn); err != nil {
+	if err := objstore.DownloadFileParallel(ctx, logger, bkt, filepath.Join(id.String(), block.IndexFilename), fn, objstore.DefaultParallelDownloadOptions); err != nil {
 		return nil, errors.Wrap(err, "download index file")
 	}
 
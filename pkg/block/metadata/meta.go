@@ -10,12 +10,16 @@ package metadata
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/fileutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
@@ -31,6 +35,7 @@ const (
 	CompactorRepairSource SourceType = "compactor.repair"
 	RulerSource           SourceType = "ruler"
 	BucketRepairSource    SourceType = "bucket.repair"
+	BackfillSource        SourceType = "backfill"
 	TestSource            SourceType = "test"
 )
 
@@ -59,6 +64,89 @@ type Thanos struct {
 
 	// Source is a real upload source of the block.
 	Source SourceType `json:"source"`
+
+	// Shard identifies the shard of a block split by series hash, e.g. "1_of_4". Empty for blocks which were not split.
+	// Blocks of different shards are compacted separately.
+	Shard string `json:"shard,omitempty"`
+
+	// Files describe the files of the block besides meta.json. They are used to verify and resume block transfers.
+	// Empty for blocks uploaded without gathering file stats.
+	Files []File `json:"files,omitempty"`
+
+	// Lineage describes how the block was created from other blocks. Empty for blocks which were not created by
+	// compaction, downsampling or split, e.g. blocks uploaded by Sidecar.
+	Lineage *Lineage `json:"lineage,omitempty"`
+}
+
+// Operations which create blocks from other blocks.
+const (
+	LineageCompaction   = "compaction"
+	LineageDownsampling = "downsampling"
+	LineageSplit        = "split"
+)
+
+// Lineage describes the operation which created a block and the direct parent blocks it was created from. The
+// lineage of parents is recorded in their own meta.json, so that it does not grow with every compaction.
+type Lineage struct {
+	// Operation is the operation which created the block, e.g. "compaction".
+	Operation string `json:"operation"`
+	// Source is the component which created the block.
+	Source SourceType `json:"source"`
+	// CreationTime is the time the block was created at in milliseconds since epoch.
+	CreationTime int64 `json:"creation_time"`
+	// Parents are the blocks the block was created from.
+	Parents []LineageParent `json:"parents"`
+}
+
+// LineageParent describes a single parent block.
+type LineageParent struct {
+	ULID    ulid.ULID `json:"ulid"`
+	MinTime int64     `json:"min_time"`
+	MaxTime int64     `json:"max_time"`
+}
+
+// NewLineage returns the lineage of a block created now by the given operation of the given component from the given parents.
+func NewLineage(operation string, source SourceType, parents []*Meta) *Lineage {
+	l := &Lineage{
+		Operation:    operation,
+		Source:       source,
+		CreationTime: timestamp.FromTime(time.Now()),
+		Parents:      make([]LineageParent, 0, len(parents)),
+	}
+	for _, p := range parents {
+		l.Parents = append(l.Parents, LineageParent{
+			ULID:    p.ULID,
+			MinTime: p.MinTime,
+			MaxTime: p.MaxTime,
+		})
+	}
+	return l
+}
+
+// File describes a single file of the block.
+type File struct {
+	// RelPath is the slash separated path of the file relative to the block directory, e.g. "chunks/000001".
+	RelPath string `json:"rel_path"`
+	// SizeBytes is the size of the file in bytes.
+	SizeBytes int64 `json:"size_bytes"`
+	// SHA256 is the hex encoded SHA256 hash of the file content. Empty if not calculated.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ShardID returns the shard identifier of the shard with the given zero based index out of the given number of shards.
+func ShardID(index, shards int) string {
+	return fmt.Sprintf("%d_of_%d", index+1, shards)
+}
+
+// ParseShardID returns the zero based index and the number of shards of the given shard identifier.
+func ParseShardID(id string) (index, shards int, err error) {
+	if _, err := fmt.Sscanf(id, "%d_of_%d", &index, &shards); err != nil {
+		return 0, 0, errors.Wrapf(err, "parse shard %q", id)
+	}
+	if index < 1 || index > shards {
+		return 0, 0, errors.Errorf("invalid shard %q", id)
+	}
+	return index - 1, shards, nil
 }
 
 type ThanosDownsample struct {
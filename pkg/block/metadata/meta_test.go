@@ -0,0 +1,24 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestShardID(t *testing.T) {
+	testutil.Equals(t, "1_of_4", ShardID(0, 4))
+
+	index, shards, err := ParseShardID(ShardID(3, 4))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, index)
+	testutil.Equals(t, 4, shards)
+
+	for _, id := range []string{"", "1", "0_of_4", "5_of_4", "a_of_b"} {
+		_, _, err := ParseShardID(id)
+		testutil.NotOk(t, err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// NoCompactMarkFilename is the known json filename to store details about why block should not be compacted.
+	NoCompactMarkFilename = "no-compact-mark.json"
+
+	// NoCompactMarkVersion1 is the version of no-compact-mark file supported by Thanos.
+	NoCompactMarkVersion1 = 1
+)
+
+// NoCompactReason is a reason for a block to be excluded from compaction.
+type NoCompactReason string
+
+const (
+	// ManualNoCompactReason is a custom reason of excluding from compaction that should be added when no-compact mark is added for unknown/user specified reason.
+	ManualNoCompactReason NoCompactReason = "manual"
+	// IndexSizeExceedingNoCompactReason is a reason of index being too big (for example exceeding 64GB limit of the TSDB index format).
+	IndexSizeExceedingNoCompactReason NoCompactReason = "index-size-exceeding"
+)
+
+// ErrorNoCompactMarkNotFound is the error when no-compact-mark.json file is not found.
+var ErrorNoCompactMarkNotFound = errors.New("no-compact-mark.json not found")
+
+// ErrorUnmarshalNoCompactMark is the error when unmarshalling no-compact-mark.json file.
+// This error can occur because no-compact-mark.json has been partially uploaded to block storage
+// or the no-compact-mark.json file is not a valid json file.
+var ErrorUnmarshalNoCompactMark = errors.New("unmarshal no-compact-mark.json")
+
+// NoCompactMark stores block id, reason and when block was marked to be excluded from compaction.
+type NoCompactMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+
+	// NoCompactTime is a unix timestamp of when the block was marked to be excluded from compaction.
+	NoCompactTime int64 `json:"no_compact_time"`
+
+	// Reason is a machine readable reason of excluding the block from compaction.
+	Reason NoCompactReason `json:"reason,omitempty"`
+	// Details is a human readable reason of excluding the block from compaction.
+	Details string `json:"details,omitempty"`
+
+	// Version of the file.
+	Version int `json:"version"`
+}
+
+// ReadNoCompactMark reads the given no-compact mark file from <dir>/no-compact-mark.json in bucket.
+func ReadNoCompactMark(ctx context.Context, bkt objstore.InstrumentedBucketReader, logger log.Logger, dir string) (*NoCompactMark, error) {
+	noCompactMarkFile := path.Join(dir, NoCompactMarkFilename)
+
+	r, err := bkt.ReaderWithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, noCompactMarkFile)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, ErrorNoCompactMarkNotFound
+		}
+		return nil, errors.Wrapf(err, "get file: %s", noCompactMarkFile)
+	}
+
+	defer runutil.CloseWithLogOnErr(logger, r, "close bkt no-compact-mark reader")
+
+	metaContent, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file: %s", noCompactMarkFile)
+	}
+
+	noCompactMark := NoCompactMark{}
+	if err := json.Unmarshal(metaContent, &noCompactMark); err != nil {
+		return nil, errors.Wrapf(ErrorUnmarshalNoCompactMark, "file: %s; err: %v", noCompactMarkFile, err.Error())
+	}
+
+	if noCompactMark.Version != NoCompactMarkVersion1 {
+		return nil, errors.Errorf("unexpected no-compact-mark file version %d", noCompactMark.Version)
+	}
+
+	return &noCompactMark, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestReadNoCompactMark(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx := context.Background()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	{
+		blockWithoutMark := ulid.MustNew(uint64(1), nil)
+		_, err := ReadNoCompactMark(ctx, bkt, nil, blockWithoutMark.String())
+
+		testutil.NotOk(t, err)
+		testutil.Equals(t, ErrorNoCompactMarkNotFound, err)
+	}
+	{
+		blockWithPartialMark := ulid.MustNew(uint64(2), nil)
+
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(blockWithPartialMark.String(), NoCompactMarkFilename), bytes.NewBufferString("not a valid no-compact-mark.json")))
+		_, err := ReadNoCompactMark(ctx, bkt, nil, blockWithPartialMark.String())
+
+		testutil.NotOk(t, err)
+		testutil.Equals(t, ErrorUnmarshalNoCompactMark, errors.Cause(err))
+	}
+	{
+		blockWithDifferentVersionMark := ulid.MustNew(uint64(3), nil)
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&NoCompactMark{
+			ID:            blockWithDifferentVersionMark,
+			NoCompactTime: time.Now().Unix(),
+			Version:       2,
+		}))
+
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(blockWithDifferentVersionMark.String(), NoCompactMarkFilename), &buf))
+		_, err := ReadNoCompactMark(ctx, bkt, nil, blockWithDifferentVersionMark.String())
+
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "unexpected no-compact-mark file version 2", err.Error())
+	}
+	{
+		blockWithValidMark := ulid.MustNew(uint64(4), nil)
+		expected := NoCompactMark{
+			ID:            blockWithValidMark,
+			NoCompactTime: time.Now().Unix(),
+			Details:       "index too big",
+			Version:       NoCompactMarkVersion1,
+		}
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&expected))
+
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(blockWithValidMark.String(), NoCompactMarkFilename), &buf))
+		mark, err := ReadNoCompactMark(ctx, bkt, nil, blockWithValidMark.String())
+
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, *mark)
+	}
+}
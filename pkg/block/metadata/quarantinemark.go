@@ -0,0 +1,75 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// QuarantineMarkFilename is the known json filename to store details about why a partial block was quarantined.
+	QuarantineMarkFilename = "quarantine-mark.json"
+
+	// QuarantineMarkVersion1 is the version of quarantine-mark file supported by Thanos.
+	QuarantineMarkVersion1 = 1
+)
+
+// ErrorQuarantineMarkNotFound is the error when quarantine-mark.json file is not found.
+var ErrorQuarantineMarkNotFound = errors.New("quarantine-mark.json not found")
+
+// QuarantineMark stores block id, details and when the block was quarantined. Partial blocks, i.e. blocks without a
+// valid meta.json, are quarantined once they stay incomplete for too long, so they are not synced on every iteration.
+type QuarantineMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+
+	// QuarantineTime is a unix timestamp of when the block was quarantined.
+	QuarantineTime int64 `json:"quarantine_time"`
+
+	// Details is a human readable reason of quarantining the block, e.g. the error of loading its meta.json.
+	Details string `json:"details,omitempty"`
+
+	// Version of the file.
+	Version int `json:"version"`
+}
+
+// ReadQuarantineMark reads the given quarantine mark file from <dir>/quarantine-mark.json in bucket.
+func ReadQuarantineMark(ctx context.Context, bkt objstore.InstrumentedBucketReader, logger log.Logger, dir string) (*QuarantineMark, error) {
+	quarantineMarkFile := path.Join(dir, QuarantineMarkFilename)
+
+	r, err := bkt.ReaderWithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, quarantineMarkFile)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, ErrorQuarantineMarkNotFound
+		}
+		return nil, errors.Wrapf(err, "get file: %s", quarantineMarkFile)
+	}
+
+	defer runutil.CloseWithLogOnErr(logger, r, "close bkt quarantine-mark reader")
+
+	metaContent, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file: %s", quarantineMarkFile)
+	}
+
+	quarantineMark := QuarantineMark{}
+	if err := json.Unmarshal(metaContent, &quarantineMark); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal file: %s", quarantineMarkFile)
+	}
+
+	if quarantineMark.Version != QuarantineMarkVersion1 {
+		return nil, errors.Errorf("unexpected quarantine-mark file version %d", quarantineMark.Version)
+	}
+
+	return &quarantineMark, nil
+}
@@ -0,0 +1,351 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// isBlockFile returns true if the given slash separated path relative to the block directory
+// is a file transferred with the block, besides meta.json.
+func isBlockFile(relPath string) bool {
+	return relPath == IndexFilename || relPath == IndexCacheFilename || strings.HasPrefix(relPath, ChunksDirname+"/")
+}
+
+// GatherFileStats returns the stats of the block files in bdir besides meta.json, sorted by path.
+// If hash is true, SHA256 of every file content is calculated as well.
+func GatherFileStats(bdir string, hash bool) ([]metadata.File, error) {
+	var files []metadata.File
+	err := filepath.Walk(bdir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bdir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !isBlockFile(rel) {
+			return nil
+		}
+
+		f := metadata.File{RelPath: rel, SizeBytes: fi.Size()}
+		if hash {
+			if f.SHA256, err = hashFile(p); err != nil {
+				return errors.Wrapf(err, "hash %s", p)
+			}
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk block dir %s", bdir)
+	}
+	return files, nil
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer runutil.CloseWithLogOnErr(log.NewNopLogger(), f, "close hashed file")
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyFile returns true if the file at p matches the expected size and hash, if known.
+func verifyFile(p string, expected metadata.File) (bool, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if fi.Size() != expected.SizeBytes {
+		return false, nil
+	}
+	if expected.SHA256 == "" {
+		return true, nil
+	}
+	h, err := hashFile(p)
+	if err != nil {
+		return false, errors.Wrapf(err, "hash %s", p)
+	}
+	return h == expected.SHA256, nil
+}
+
+// UploadResumable uploads block from given block dir that ends with block id, like Upload does.
+// Unlike Upload, it records the sizes and hashes of the block files in the uploaded meta.json and skips the files
+// already present in the bucket with the expected size, e.g. uploaded by a previous interrupted attempt. Partial upload
+// is not cleaned on error, so the upload can be resumed by calling UploadResumable again. This is only useful for blocks
+// which keep their ID across retries, like the ones shipped from Prometheus. Blocks created with a fresh ID on each
+// attempt, like compacted, downsampled or repaired ones, should be uploaded with Upload, so that partial uploads are
+// cleaned up instead of being left behind.
+func UploadResumable(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string) error {
+	id, meta, err := readUploadableBlock(bdir)
+	if err != nil {
+		return err
+	}
+
+	files, err := GatherFileStats(bdir, true)
+	if err != nil {
+		return errors.Wrap(err, "gather file stats")
+	}
+	meta.Thanos.Files = files[:0]
+	for _, f := range files {
+		if f.RelPath == IndexCacheFilename && meta.Thanos.Source != metadata.CompactorSource {
+			continue
+		}
+		meta.Thanos.Files = append(meta.Thanos.Files, f)
+	}
+
+	// Collect what was already uploaded by previous attempts.
+	uploaded := map[string]int64{}
+	if err := bkt.Iter(ctx, id.String(), func(string) error { return nil }, objstore.WithRecursiveIter, objstore.WithObjectAttributes(func(name string, attrs objstore.ObjectAttributes) error {
+		uploaded[name] = attrs.Size
+		return nil
+	})); err != nil {
+		return errors.Wrap(err, "list uploaded block files")
+	}
+	if _, ok := uploaded[path.Join(id.String(), MetaFilename)]; ok {
+		level.Info(logger).Log("msg", "block already uploaded", "block", id)
+		return nil
+	}
+
+	metaContent, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "json encode meta")
+	}
+	if err := bkt.Upload(ctx, path.Join(DebugMetas, fmt.Sprintf("%s.json", id)), bytes.NewReader(metaContent)); err != nil {
+		return errors.Wrap(err, "upload meta file to debug dir")
+	}
+
+	for _, f := range meta.Thanos.Files {
+		dst := path.Join(id.String(), f.RelPath)
+		if size, ok := uploaded[dst]; ok && size == f.SizeBytes {
+			level.Debug(logger).Log("msg", "skipping already uploaded file", "file", dst)
+			continue
+		}
+		if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(bdir, filepath.FromSlash(f.RelPath)), dst); err != nil {
+			return errors.Wrapf(err, "upload %s", f.RelPath)
+		}
+	}
+
+	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file
+	// to be pending uploads.
+	if err := bkt.Upload(ctx, path.Join(id.String(), MetaFilename), bytes.NewReader(metaContent)); err != nil {
+		return errors.Wrap(err, "upload meta file")
+	}
+	return nil
+}
+
+// DownloadResumable downloads the block with the given id into dst, like Download does.
+// Files already present in dst are verified against the sizes and hashes recorded in the block meta.json, or against the
+// object sizes for blocks uploaded without them, and are skipped if matching. Partially downloaded files are resumed
+// from where the previous attempt stopped. Meta.json is written as a last item.
+func DownloadResumable(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, dst string) error {
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return errors.Wrap(err, "create dir")
+	}
+
+	meta, err := DownloadMeta(ctx, logger, bkt, id)
+	if err != nil {
+		return err
+	}
+
+	files := meta.Thanos.Files
+	if len(files) == 0 {
+		if files, err = listBlockFiles(ctx, bkt, id); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if err := downloadFileResumable(ctx, logger, bkt, path.Join(id.String(), f.RelPath), filepath.Join(dst, filepath.FromSlash(f.RelPath)), f); err != nil {
+			return err
+		}
+	}
+
+	// This can happen if block is empty. We cannot easily upload empty directory, so create one here.
+	if err := os.MkdirAll(filepath.Join(dst, ChunksDirname), 0777); err != nil {
+		return errors.Wrap(err, "create chunks dir")
+	}
+	return metadata.Write(logger, dst, &meta)
+}
+
+// listBlockFiles returns the stats of the block files in the bucket. Hashes are unknown.
+func listBlockFiles(ctx context.Context, bkt objstore.Bucket, id ulid.ULID) ([]metadata.File, error) {
+	var files []metadata.File
+	if err := bkt.Iter(ctx, id.String(), func(string) error { return nil }, objstore.WithRecursiveIter, objstore.WithObjectAttributes(func(name string, attrs objstore.ObjectAttributes) error {
+		rel := strings.TrimPrefix(name, id.String()+objstore.DirDelim)
+		if isBlockFile(rel) {
+			files = append(files, metadata.File{RelPath: rel, SizeBytes: attrs.Size})
+		}
+		return nil
+	})); err != nil {
+		return nil, errors.Wrapf(err, "list files of block %s", id)
+	}
+	return files, nil
+}
+
+// VerifyUploaded returns true if the block from the given block dir is completely uploaded to the bucket, i.e. its
+// meta.json and all its files are present in the bucket with the same sizes as in the block dir.
+func VerifyUploaded(ctx context.Context, bkt objstore.Bucket, bdir string) (bool, error) {
+	id, err := ulid.Parse(filepath.Base(bdir))
+	if err != nil {
+		return false, errors.Wrap(err, "not a block dir")
+	}
+
+	ok, err := bkt.Exists(ctx, path.Join(id.String(), MetaFilename))
+	if err != nil {
+		return false, errors.Wrapf(err, "check meta of block %s", id)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	local, err := GatherFileStats(bdir, false)
+	if err != nil {
+		return false, err
+	}
+	remote, err := listBlockFiles(ctx, bkt, id)
+	if err != nil {
+		return false, err
+	}
+	sizes := make(map[string]int64, len(remote))
+	for _, f := range remote {
+		sizes[f.RelPath] = f.SizeBytes
+	}
+	for _, f := range local {
+		if f.RelPath == IndexCacheFilename {
+			// Index cache is uploaded only for compacted blocks and can be rebuilt from the index.
+			continue
+		}
+		if size, ok := sizes[f.RelPath]; !ok || size != f.SizeBytes {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// FilesSize returns the total size of the block files in bytes, besides meta.json. Sizes recorded in the block meta.json
+// are used if present, otherwise the block files are listed in the bucket.
+func FilesSize(ctx context.Context, bkt objstore.Bucket, meta *metadata.Meta) (int64, error) {
+	files := meta.Thanos.Files
+	if len(files) == 0 {
+		var err error
+		if files, err = listBlockFiles(ctx, bkt, meta.ULID); err != nil {
+			return 0, err
+		}
+	}
+
+	var size int64
+	for _, f := range files {
+		size += f.SizeBytes
+	}
+	return size, nil
+}
+
+func downloadFileResumable(ctx context.Context, logger log.Logger, bkt objstore.Bucket, src, dst string, expected metadata.File) (err error) {
+	var offset int64
+	fi, err := os.Stat(dst)
+	switch {
+	case err == nil && fi.Size() == expected.SizeBytes:
+		ok, err := verifyFile(dst, expected)
+		if err != nil {
+			return err
+		}
+		if ok {
+			level.Debug(logger).Log("msg", "skipping already downloaded file", "file", dst)
+			return nil
+		}
+		level.Warn(logger).Log("msg", "downloaded file does not match expected hash; downloading again", "file", dst)
+	case err == nil && fi.Size() < expected.SizeBytes:
+		offset = fi.Size()
+		level.Debug(logger).Log("msg", "resuming partial file download", "file", dst, "offset", offset)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return errors.Wrap(err, "create dir")
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrap(err, "open file")
+	}
+	defer func() {
+		if f != nil {
+			runutil.CloseWithErrCapture(&err, f, "close downloaded file %s", dst)
+		}
+	}()
+	if err := f.Truncate(offset); err != nil {
+		return errors.Wrap(err, "truncate file")
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "seek file")
+	}
+
+	if expected.SizeBytes > offset {
+		var rc io.ReadCloser
+		if offset == 0 {
+			rc, err = bkt.Get(ctx, src)
+		} else {
+			rc, err = bkt.GetRange(ctx, src, offset, expected.SizeBytes-offset)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "get file %s", src)
+		}
+		defer runutil.CloseWithLogOnErr(logger, rc, "download block's file reader")
+
+		// Partially written file is kept on error, so the download can be resumed.
+		if _, err := io.Copy(f, rc); err != nil {
+			return errors.Wrapf(err, "copy object %s to file", src)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close file")
+	}
+	f = nil
+
+	ok, err := verifyFile(dst, expected)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if rerr := os.Remove(dst); rerr != nil {
+			level.Warn(logger).Log("msg", "failed to remove corrupted downloaded file", "file", dst, "err", rerr)
+		}
+		return errors.Errorf("downloaded file %s does not match expected size %d or hash %q", src, expected.SizeBytes, expected.SHA256)
+	}
+	return nil
+}
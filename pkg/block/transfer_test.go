@@ -0,0 +1,91 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestUploadDownloadResumable(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-block-transfer")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	b1, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+		{{Name: "a", Value: "2"}},
+		{{Name: "b", Value: "1"}},
+	}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "val1"}}, 124)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(tmpDir, b1.String())
+
+	chunkFile := path.Join(b1.String(), ChunksDirname, "000001")
+	chunks, err := ioutil.ReadFile(filepath.Join(bdir, ChunksDirname, "000001"))
+	testutil.Ok(t, err)
+	index, err := ioutil.ReadFile(filepath.Join(bdir, IndexFilename))
+	testutil.Ok(t, err)
+
+	// Simulate interrupted upload of the chunks file.
+	testutil.Ok(t, bkt.Upload(ctx, chunkFile, bytes.NewReader(chunks[:10])))
+
+	testutil.Ok(t, UploadResumable(ctx, log.NewNopLogger(), bkt, bdir))
+	testutil.Equals(t, 4, len(bkt.Objects()))
+	testutil.Equals(t, chunks, bkt.Objects()[chunkFile])
+	testutil.Equals(t, index, bkt.Objects()[path.Join(b1.String(), IndexFilename)])
+
+	var m metadata.Meta
+	testutil.Ok(t, json.Unmarshal(bkt.Objects()[path.Join(b1.String(), MetaFilename)], &m))
+	testutil.Equals(t, 2, len(m.Thanos.Files))
+	testutil.Equals(t, "chunks/000001", m.Thanos.Files[0].RelPath)
+	testutil.Equals(t, int64(len(chunks)), m.Thanos.Files[0].SizeBytes)
+	testutil.Equals(t, IndexFilename, m.Thanos.Files[1].RelPath)
+	testutil.Equals(t, int64(len(index)), m.Thanos.Files[1].SizeBytes)
+	testutil.Assert(t, m.Thanos.Files[1].SHA256 != "", "expected hash of the index file")
+
+	// Upload is idempotent.
+	testutil.Ok(t, UploadResumable(ctx, log.NewNopLogger(), bkt, bdir))
+	testutil.Equals(t, 4, len(bkt.Objects()))
+
+	dst := filepath.Join(tmpDir, "download", b1.String())
+	testutil.Ok(t, DownloadResumable(ctx, log.NewNopLogger(), bkt, b1, dst))
+	downloaded, err := GatherFileStats(dst, true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, m.Thanos.Files, downloaded)
+
+	// Simulate interrupted download of the index and corrupted chunks file of the same size.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dst, IndexFilename), index[:len(index)/2], os.ModePerm))
+	corrupted := append([]byte{}, chunks...)
+	corrupted[len(corrupted)-1]++
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dst, ChunksDirname, "000001"), corrupted, os.ModePerm))
+
+	testutil.Ok(t, DownloadResumable(ctx, log.NewNopLogger(), bkt, b1, dst))
+	downloaded, err = GatherFileStats(dst, true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, m.Thanos.Files, downloaded)
+
+	meta, err := metadata.Read(dst)
+	testutil.Ok(t, err)
+	testutil.Equals(t, b1, meta.ULID)
+}
@@ -0,0 +1,317 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cacheutil
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+var (
+	errRedisAsyncBufferFull = errors.New("the async buffer is full")
+	errRedisConfigNoAddr    = errors.New("no redis address provided")
+
+	defaultRedisClientConfig = RedisClientConfig{
+		Timeout:             500 * time.Millisecond,
+		MaxIdleConnections:  100,
+		MaxAsyncConcurrency: 20,
+		MaxAsyncBufferSize:  10000,
+		MaxItemSize:         model.Bytes(1024 * 1024),
+	}
+)
+
+// RedisClient is a high level client to interact with redis.
+type RedisClient interface {
+	// GetMulti fetches multiple keys at once from redis. In case of error,
+	// an empty map is returned and the error tracked/logged.
+	GetMulti(ctx context.Context, keys []string) map[string][]byte
+
+	// SetAsync enqueues an asynchronous operation to store a key into redis.
+	// Returns an error in case it fails to enqueue the operation. In case the
+	// underlying async operation will fail, the error will be tracked/logged.
+	SetAsync(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Stop client and release underlying resources.
+	Stop()
+}
+
+// RedisClientConfig is the config accepted by RedisClient.
+type RedisClientConfig struct {
+	// Address is the host:port address of the redis server.
+	Address string `yaml:"address"`
+
+	// Password is used to authenticate to the server if not empty.
+	Password string `yaml:"password"`
+
+	// DB is the database selected after connecting.
+	DB int `yaml:"db"`
+
+	// Timeout specifies the socket read/write timeout.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxIdleConnections specifies the maximum number of idle connections that
+	// will be maintained.
+	MaxIdleConnections int `yaml:"max_idle_connections"`
+
+	// MaxAsyncConcurrency specifies the maximum number of concurrent asynchronous
+	// operations can occur.
+	MaxAsyncConcurrency int `yaml:"max_async_concurrency"`
+
+	// MaxAsyncBufferSize specifies the maximum number of enqueued asynchronous
+	// operations allowed.
+	MaxAsyncBufferSize int `yaml:"max_async_buffer_size"`
+
+	// MaxItemSize specifies the maximum size of an item stored in redis. Bigger
+	// items are skipped to be stored by the client. If set to 0, no maximum size is
+	// enforced.
+	MaxItemSize model.Bytes `yaml:"max_item_size"`
+}
+
+func (c *RedisClientConfig) validate() error {
+	if c.Address == "" {
+		return errRedisConfigNoAddr
+	}
+	return nil
+}
+
+// parseRedisClientConfig unmarshals a buffer into a RedisClientConfig with default values.
+func parseRedisClientConfig(conf []byte) (RedisClientConfig, error) {
+	config := defaultRedisClientConfig
+	if err := yaml.Unmarshal(conf, &config); err != nil {
+		return RedisClientConfig{}, err
+	}
+
+	return config, nil
+}
+
+type redisClient struct {
+	logger log.Logger
+	config RedisClientConfig
+
+	// Pool of connections, authenticated and with the configured database selected.
+	pool *redis.Pool
+
+	// Channel used to notify internal goroutines when they should quit.
+	stop chan struct{}
+
+	// Channel used to enqueue async operations.
+	asyncQueue chan func()
+
+	// Wait group used to wait all workers on stopping.
+	workers sync.WaitGroup
+
+	// Tracked metrics.
+	operations *prometheus.CounterVec
+	failures   *prometheus.CounterVec
+	skipped    *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
+// NewRedisClient makes a new RedisClient.
+func NewRedisClient(logger log.Logger, name string, conf []byte, reg prometheus.Registerer) (*redisClient, error) {
+	config, err := parseRedisClientConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRedisClientWithConfig(logger, name, config, reg)
+}
+
+// NewRedisClientWithConfig makes a new RedisClient.
+func NewRedisClientWithConfig(logger log.Logger, name string, config RedisClientConfig, reg prometheus.Registerer) (*redisClient, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	return newRedisClient(logger, name, dialer.Dial, config, reg), nil
+}
+
+func newRedisClient(logger log.Logger, name string, dial func(network, addr string) (net.Conn, error), config RedisClientConfig, reg prometheus.Registerer) *redisClient {
+	c := &redisClient{
+		logger: logger,
+		config: config,
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", config.Address,
+					redis.DialNetDial(dial),
+					redis.DialReadTimeout(config.Timeout),
+					redis.DialWriteTimeout(config.Timeout),
+					redis.DialPassword(config.Password),
+					redis.DialDatabase(config.DB),
+				)
+			},
+			MaxIdle: config.MaxIdleConnections,
+		},
+		stop:       make(chan struct{}),
+		asyncQueue: make(chan func(), config.MaxAsyncBufferSize),
+	}
+
+	c.operations = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_redis_operations_total",
+		Help:        "Total number of operations against redis.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"operation"})
+	c.operations.WithLabelValues(opGetMulti)
+	c.operations.WithLabelValues(opSet)
+
+	c.failures = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_redis_operation_failures_total",
+		Help:        "Total number of operations against redis that failed.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"operation"})
+	c.failures.WithLabelValues(opGetMulti)
+	c.failures.WithLabelValues(opSet)
+
+	c.skipped = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_redis_operation_skipped_total",
+		Help:        "Total number of operations against redis that have been skipped.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"operation", "reason"})
+	c.skipped.WithLabelValues(opSet, reasonMaxItemSize)
+
+	c.duration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "thanos_redis_operation_duration_seconds",
+		Help:        "Duration of operations against redis.",
+		ConstLabels: prometheus.Labels{"name": name},
+		Buckets:     []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.5, 1, 3, 6, 10},
+	}, []string{"operation"})
+	c.duration.WithLabelValues(opGetMulti)
+	c.duration.WithLabelValues(opSet)
+
+	// Start a number of goroutines - processing async operations - equal
+	// to the max concurrency we have.
+	c.workers.Add(c.config.MaxAsyncConcurrency)
+	for i := 0; i < c.config.MaxAsyncConcurrency; i++ {
+		go c.asyncQueueProcessLoop()
+	}
+
+	return c
+}
+
+func (c *redisClient) Stop() {
+	close(c.stop)
+
+	// Wait until all workers have terminated.
+	c.workers.Wait()
+
+	runutil.CloseWithLogOnErr(c.logger, c.pool, "redis connection pool")
+}
+
+func (c *redisClient) SetAsync(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	// Skip hitting redis at all if the item is bigger than the max allowed size.
+	if c.config.MaxItemSize > 0 && uint64(len(value)) > uint64(c.config.MaxItemSize) {
+		c.skipped.WithLabelValues(opSet, reasonMaxItemSize).Inc()
+		return nil
+	}
+	// Expired items are not stored, and TTLs are rounded up to milliseconds, as redis rejects a TTL of 0.
+	if ttl <= 0 {
+		return nil
+	}
+	ttlMillis := int64((ttl + time.Millisecond - 1) / time.Millisecond)
+
+	return c.enqueueAsync(func() {
+		start := time.Now()
+		c.operations.WithLabelValues(opSet).Inc()
+
+		var err error
+		tracing.DoInSpan(ctx, "redis_set", func(ctx context.Context) {
+			_, err = c.do("SET", key, value, "PX", ttlMillis)
+		})
+		if err != nil {
+			c.failures.WithLabelValues(opSet).Inc()
+			level.Warn(c.logger).Log("msg", "failed to store item to redis", "key", key, "sizeBytes", len(value), "err", err)
+			return
+		}
+
+		c.duration.WithLabelValues(opSet).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (c *redisClient) GetMulti(ctx context.Context, keys []string) map[string][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	c.operations.WithLabelValues(opGetMulti).Inc()
+
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, k)
+	}
+
+	var (
+		values [][]byte
+		err    error
+	)
+	tracing.DoInSpan(ctx, "redis_getmulti", func(ctx context.Context) {
+		values, err = redis.ByteSlices(c.do("MGET", args...))
+	})
+	if err != nil {
+		c.failures.WithLabelValues(opGetMulti).Inc()
+		level.Warn(c.logger).Log("msg", "failed to fetch items from redis", "numKeys", len(keys), "firstKey", keys[0], "err", err)
+		return nil
+	}
+	c.duration.WithLabelValues(opGetMulti).Observe(time.Since(start).Seconds())
+
+	if len(values) != len(keys) {
+		c.failures.WithLabelValues(opGetMulti).Inc()
+		level.Warn(c.logger).Log("msg", "unexpected reply of redis MGET", "numKeys", len(keys), "firstKey", keys[0])
+		return nil
+	}
+
+	hits := map[string][]byte{}
+	for i, v := range values {
+		// Missing keys are replied as nil.
+		if v != nil {
+			hits[keys[i]] = v
+		}
+	}
+	return hits
+}
+
+func (c *redisClient) enqueueAsync(op func()) error {
+	select {
+	case c.asyncQueue <- op:
+		return nil
+	default:
+		return errRedisAsyncBufferFull
+	}
+}
+
+func (c *redisClient) asyncQueueProcessLoop() {
+	defer c.workers.Done()
+
+	for {
+		select {
+		case op := <-c.asyncQueue:
+			op()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// do sends a command on a connection of the pool and returns its reply.
+func (c *redisClient) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := c.pool.Get()
+	defer runutil.CloseWithLogOnErr(c.logger, conn, "redis connection")
+
+	return conn.Do(cmd, args...)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cacheutil
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// fakeRedis serves GET, MGET and SET commands from memory on connections of net.Pipe.
+type fakeRedis struct {
+	mtx   sync.Mutex
+	items map[string]string
+	ttls  map[string]string
+	conns int
+}
+
+func (f *fakeRedis) dial(string, string) (net.Conn, error) {
+	f.mtx.Lock()
+	f.conns++
+	f.mtx.Unlock()
+
+	client, server := net.Pipe()
+	go f.serve(server)
+	return client, nil
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var l int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &l); err != nil {
+			return nil, err
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:l])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mtx.Lock()
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "MGET":
+			reply = fmt.Sprintf("*%d\r\n", len(args)-1)
+			for _, k := range args[1:] {
+				v, ok := f.items[k]
+				if !ok {
+					reply += "$-1\r\n"
+					continue
+				}
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case "SET":
+			f.items[args[1]] = args[2]
+			f.ttls[args[1]] = args[4]
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mtx.Unlock()
+
+		if _, err := nc.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRedisClientConfig_validate(t *testing.T) {
+	testutil.Equals(t, errRedisConfigNoAddr, (&RedisClientConfig{}).validate())
+	testutil.Ok(t, (&RedisClientConfig{Address: "127.0.0.1:6379"}).validate())
+}
+
+func TestRedisClient_GetMultiSetAsync(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	f := &fakeRedis{items: map[string]string{"existing": "value"}, ttls: map[string]string{}}
+	config := defaultRedisClientConfig
+	config.MaxItemSize = 10
+	c := newRedisClient(log.NewNopLogger(), "test", f.dial, config, nil)
+	defer c.Stop()
+
+	ctx := context.Background()
+	testutil.Equals(t, map[string][]byte{"existing": []byte("value")}, c.GetMulti(ctx, []string{"existing", "missing"}))
+
+	testutil.Ok(t, c.SetAsync(ctx, "new", []byte("new value"), time.Minute))
+	// TTLs below a millisecond are rounded up, expired items are not stored.
+	testutil.Ok(t, c.SetAsync(ctx, "short", []byte("value"), time.Microsecond))
+	testutil.Ok(t, c.SetAsync(ctx, "expired", []byte("value"), 0))
+	// Items above the max item size are skipped.
+	testutil.Ok(t, c.SetAsync(ctx, "large", []byte("a large value"), time.Minute))
+	testutil.Equals(t, 1.0, prom_testutil.ToFloat64(c.skipped.WithLabelValues(opSet, reasonMaxItemSize)))
+
+	retryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, retryCtx.Done(), func() error {
+		if len(c.GetMulti(ctx, []string{"new", "short"})) < 2 {
+			return errors.New("items not stored yet")
+		}
+		return nil
+	}))
+	f.mtx.Lock()
+	testutil.Equals(t, map[string]string{"new": "60000", "short": "1"}, f.ttls)
+	f.mtx.Unlock()
+
+	// Server errors are returned, connections stay usable after them.
+	_, err := c.do("UNKNOWN")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, map[string][]byte{"new": []byte("new value")}, c.GetMulti(ctx, []string{"new", "expired"}))
+	testutil.Equals(t, 0.0, prom_testutil.ToFloat64(c.failures.WithLabelValues(opGetMulti)))
+}
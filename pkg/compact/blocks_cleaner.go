@@ -5,13 +5,16 @@ package compact
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
 )
 
@@ -23,10 +26,12 @@ type BlocksCleaner struct {
 	deleteDelay              time.Duration
 	blocksCleaned            prometheus.Counter
 	blockCleanupFailures     prometheus.Counter
+	blocksPendingDeletion    prometheus.Gauge
 }
 
 // NewBlocksCleaner creates a new BlocksCleaner.
-func NewBlocksCleaner(logger log.Logger, bkt objstore.Bucket, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, deleteDelay time.Duration, blocksCleaned prometheus.Counter, blockCleanupFailures prometheus.Counter) *BlocksCleaner {
+// The number of blocks marked for deletion, which were not deleted yet, is reported to blocksPendingDeletion.
+func NewBlocksCleaner(logger log.Logger, bkt objstore.Bucket, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, deleteDelay time.Duration, blocksCleaned prometheus.Counter, blockCleanupFailures prometheus.Counter, blocksPendingDeletion prometheus.Gauge) *BlocksCleaner {
 	return &BlocksCleaner{
 		logger:                   logger,
 		ignoreDeletionMarkFilter: ignoreDeletionMarkFilter,
@@ -34,22 +39,43 @@ func NewBlocksCleaner(logger log.Logger, bkt objstore.Bucket, ignoreDeletionMark
 		deleteDelay:              deleteDelay,
 		blocksCleaned:            blocksCleaned,
 		blockCleanupFailures:     blockCleanupFailures,
+		blocksPendingDeletion:    blocksPendingDeletion,
 	}
 }
 
+// BlocksDueForDeletion returns blocks which would be deleted by DeleteMarkedBlocks.
+func (s *BlocksCleaner) BlocksDueForDeletion() []ulid.ULID {
+	var res []ulid.ULID
+	for _, deletionMark := range s.ignoreDeletionMarkFilter.DeletionMarkBlocks() {
+		if s.dueForDeletion(deletionMark) {
+			res = append(res, deletionMark.ID)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	return res
+}
+
+func (s *BlocksCleaner) dueForDeletion(deletionMark *metadata.DeletionMark) bool {
+	return time.Since(time.Unix(deletionMark.DeletionTime, 0)).Seconds() > s.deleteDelay.Seconds()
+}
+
 // DeleteMarkedBlocks uses ignoreDeletionMarkFilter to gather the blocks that are marked for deletion and deletes those
 // if older than given deleteDelay.
 func (s *BlocksCleaner) DeleteMarkedBlocks(ctx context.Context) error {
 	level.Info(s.logger).Log("msg", "started cleaning of blocks marked for deletion")
 
 	deletionMarkMap := s.ignoreDeletionMarkFilter.DeletionMarkBlocks()
+	pending := len(deletionMarkMap)
+	defer func() { s.blocksPendingDeletion.Set(float64(pending)) }()
+
 	for _, deletionMark := range deletionMarkMap {
-		if time.Since(time.Unix(deletionMark.DeletionTime, 0)).Seconds() > s.deleteDelay.Seconds() {
+		if s.dueForDeletion(deletionMark) {
 			if err := block.Delete(ctx, s.logger, s.bkt, deletionMark.ID); err != nil {
 				s.blockCleanupFailures.Inc()
 				return errors.Wrap(err, "delete block")
 			}
 			s.blocksCleaned.Inc()
+			pending--
 			level.Info(s.logger).Log("msg", "deleted block marked for deletion", "block", deletionMark.ID)
 		}
 	}
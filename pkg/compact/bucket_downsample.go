@@ -0,0 +1,377 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	terrors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// DownsampleMetrics holds metrics of DownsampleBucket.
+type DownsampleMetrics struct {
+	downsamples        *prometheus.CounterVec
+	downsampleFailures *prometheus.CounterVec
+	downsampleSkipped  *prometheus.CounterVec
+}
+
+// NewDownsampleMetrics creates DownsampleMetrics registered in reg.
+func NewDownsampleMetrics(reg prometheus.Registerer) *DownsampleMetrics {
+	m := new(DownsampleMetrics)
+
+	m.downsamples = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_downsample_total",
+		Help: "Total number of downsampling attempts.",
+	}, []string{"group"})
+	m.downsampleFailures = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_downsample_failures_total",
+		Help: "Total number of failed downsampling attempts.",
+	}, []string{"group"})
+	m.downsampleSkipped = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_downsample_skipped_total",
+		Help: "Total number of downsamplings rescheduled due to insufficient free disk space.",
+	}, []string{"group"})
+
+	return m
+}
+
+// DownsampleOptions configures DownsampleBucket.
+type DownsampleOptions struct {
+	// Dir is the working directory blocks are downloaded into. It is cleaned before and after downsampling.
+	Dir string
+	// Levels are the downsampling levels, blocks are downsampled to the next of them.
+	Levels []downsample.Level
+	// Sketches enables writing sketch aggregates into downsampled blocks.
+	Sketches bool
+	// Concurrency is the number of blocks downsampled concurrently.
+	Concurrency int
+	// CheckpointSeries is the number of series of a block above which downsampling is checkpointed into
+	// CheckpointDir, so it resumes where it stopped if it is interrupted. 0 disables checkpointing.
+	CheckpointSeries int
+	CheckpointDir    string
+	// DiskSpace limits the disk space used for downsampling. Blocks which do not fit into the free disk space are
+	// skipped and downsampled by the next call.
+	DiskSpace *DiskSpaceLimiter
+}
+
+// DownsampleBucket downsamples blocks of the given metas as configured by opts and uploads the results into bkt.
+func DownsampleBucket(
+	ctx context.Context,
+	logger log.Logger,
+	metrics *DownsampleMetrics,
+	bkt objstore.Bucket,
+	metas map[ulid.ULID]*metadata.Meta,
+	opts DownsampleOptions,
+) error {
+	if err := os.RemoveAll(opts.Dir); err != nil {
+		return errors.Wrap(err, "clean working directory")
+	}
+	if err := os.MkdirAll(opts.Dir, 0777); err != nil {
+		return errors.Wrap(err, "create dir")
+	}
+
+	works := PlanDownsamplings(metas, opts.Levels)
+	if err := removeStaleCheckpoints(logger, opts.CheckpointDir, works); err != nil {
+		return errors.Wrap(err, "remove stale downsampling checkpoints")
+	}
+
+	defer func() {
+		if err := os.RemoveAll(opts.Dir); err != nil {
+			level.Error(logger).Log("msg", "failed to remove downsample cache directory", "path", opts.Dir, "err", err)
+		}
+	}()
+
+	var (
+		wg                     sync.WaitGroup
+		workCtx, workCtxCancel = context.WithCancel(ctx)
+		workChan               = make(chan PlannedDownsampling)
+		errChan                = make(chan error, opts.Concurrency)
+	)
+	defer workCtxCancel()
+
+	// Set up workers who will downsample the blocks. They stop once they encounter an error.
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range workChan {
+				if err := downsampleBlock(workCtx, logger, metrics, bkt, w.Meta, w.Resolution, opts); err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var errs terrors.MultiError
+workLoop:
+	for _, w := range works {
+		select {
+		case err := <-errChan:
+			errs.Add(err)
+			break workLoop
+		case workChan <- w:
+		}
+	}
+	close(workChan)
+	wg.Wait()
+
+	// Collect any other error reported by the workers.
+	close(errChan)
+	for err := range errChan {
+		errs.Add(err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// PlanDownsamplings returns blocks of the given metas which have to be downsampled to the next of the given levels,
+// ordered by block ID. Blocks whose sources are already downsampled to the next level are not returned.
+func PlanDownsamplings(metas map[ulid.ULID]*metadata.Meta, levels []downsample.Level) []PlannedDownsampling {
+	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
+	// if a downsampled version with the same hash already exists.
+	// Shards of a split block have the same sources, so sources are tracked per shard.
+	type resShard struct {
+		res   int64
+		shard string
+	}
+	sources := map[resShard]map[ulid.ULID]struct{}{}
+	for _, m := range metas {
+		res := m.Thanos.Downsample.Resolution
+		if res == downsample.ResLevel0 {
+			continue
+		}
+		k := resShard{res: res, shard: m.Thanos.Shard}
+		if _, ok := sources[k]; !ok {
+			sources[k] = map[ulid.ULID]struct{}{}
+		}
+		for _, id := range m.Compaction.Sources {
+			sources[k][id] = struct{}{}
+		}
+	}
+
+	var res []PlannedDownsampling
+	for _, m := range metas {
+		next, ok := downsample.NextLevel(levels, m.Thanos.Downsample.Resolution)
+		if !ok {
+			continue
+		}
+		missing := false
+		for _, id := range m.Compaction.Sources {
+			if _, ok := sources[resShard{res: next.Resolution, shard: m.Thanos.Shard}][id]; !ok {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			continue
+		}
+		// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
+		// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
+		// blocks. Otherwise we may never downsample some data.
+		if m.MaxTime-m.MinTime < next.MinBlockRange {
+			continue
+		}
+		res = append(res, PlannedDownsampling{Meta: m, Resolution: next.Resolution})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Meta.ULID.Compare(res[j].Meta.ULID) < 0 })
+	return res
+}
+
+// PlannedDownsampling is a block which has to be downsampled to the given resolution.
+type PlannedDownsampling struct {
+	Meta       *metadata.Meta
+	Resolution int64
+}
+
+// removeStaleCheckpoints removes checkpoints of blocks which are not going to be downsampled anymore, e.g. because
+// they were deleted or downsampled by another compactor.
+func removeStaleCheckpoints(logger log.Logger, checkpointDir string, works []PlannedDownsampling) error {
+	fis, err := ioutil.ReadDir(checkpointDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	planned := make(map[string]struct{}, len(works))
+	for _, w := range works {
+		planned[w.Meta.ULID.String()] = struct{}{}
+	}
+	for _, fi := range fis {
+		if _, ok := planned[fi.Name()]; ok {
+			continue
+		}
+		level.Info(logger).Log("msg", "removing stale downsampling checkpoint", "block", fi.Name())
+		if err := os.RemoveAll(filepath.Join(checkpointDir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downsampleBlock downsamples the block to the given resolution and uploads the result. It reserves the local disk
+// space needed first; if the free disk space is not enough, the block is skipped and downsampled by the next run.
+func downsampleBlock(
+	ctx context.Context,
+	logger log.Logger,
+	metrics *DownsampleMetrics,
+	bkt objstore.Bucket,
+	m *metadata.Meta,
+	resolution int64,
+	opts DownsampleOptions,
+) error {
+	size, err := block.FilesSize(ctx, bkt, m)
+	if err != nil {
+		return errors.Wrapf(err, "get size of block %s", m.ULID)
+	}
+	reserve, err := downsampleDiskSpace(m, size, opts)
+	if err != nil {
+		return errors.Wrapf(err, "get disk space needed for downsampling of block %s", m.ULID)
+	}
+	release, err := opts.DiskSpace.Reserve(ctx, reserve)
+	if errors.Cause(err) == ErrInsufficientDiskSpace {
+		level.Warn(logger).Log("msg", "not enough free disk space for downsampling; rescheduling it", "block", m.ULID, "err", err)
+		metrics.downsampleSkipped.WithLabelValues(GroupKey(m.Thanos)).Inc()
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "reserve disk space for downsampling of block %s", m.ULID)
+	}
+	defer release()
+
+	if err := processDownsampling(ctx, logger, bkt, m, opts.Dir, resolution, opts.Sketches, opts.CheckpointSeries, opts.CheckpointDir); err != nil {
+		metrics.downsampleFailures.WithLabelValues(GroupKey(m.Thanos)).Inc()
+		return errors.Wrapf(err, "downsampling to %s", time.Duration(resolution)*time.Millisecond)
+	}
+	metrics.downsamples.WithLabelValues(GroupKey(m.Thanos)).Inc()
+	return nil
+}
+
+// downsampleDiskSpace returns the disk space needed to downsample the block of the given size. Downloaded source block
+// and downsampled block are kept on disk at the same time. Checkpointed downsampling additionally writes the downsampled
+// series into part files first, minus the parts already written by interrupted runs, which are on disk already.
+func downsampleDiskSpace(m *metadata.Meta, size int64, opts DownsampleOptions) (int64, error) {
+	if !checkpointed(m, opts.CheckpointSeries) {
+		return 2 * size, nil
+	}
+	var written int64
+	err := filepath.Walk(filepath.Join(opts.CheckpointDir, m.ULID.String()), func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			written += fi.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrap(err, "get size of checkpoint")
+	}
+	if written > size {
+		written = size
+	}
+	return 3*size - written, nil
+}
+
+// checkpointed returns true if downsampling of the block is checkpointed.
+func checkpointed(m *metadata.Meta, checkpointSeries int) bool {
+	return checkpointSeries > 0 && m.Stats.NumSeries > uint64(checkpointSeries)
+}
+
+// processDownsampling downloads, downsamples and uploads the block. Downsampling of blocks with more than checkpointSeries
+// series is checkpointed into checkpointDir, so it resumes where it stopped if it is interrupted. 0 disables checkpointing.
+func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *metadata.Meta, dir string, resolution int64, sketches bool, checkpointSeries int, checkpointDir string) error {
+	begin := time.Now()
+	bdir := filepath.Join(dir, m.ULID.String())
+
+	err := block.DownloadResumable(ctx, logger, bkt, m.ULID, bdir)
+	if err != nil {
+		return errors.Wrapf(err, "download block %s", m.ULID)
+	}
+	level.Info(logger).Log("msg", "downloaded block", "id", m.ULID, "duration", time.Since(begin))
+
+	if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+		return errors.Wrap(err, "input block index not valid")
+	}
+
+	begin = time.Now()
+
+	var pool chunkenc.Pool
+	if m.Thanos.Downsample.Resolution == 0 {
+		pool = chunkenc.NewPool()
+	} else {
+		pool = downsample.NewPool()
+	}
+
+	b, err := tsdb.OpenBlock(logger, bdir, pool)
+	if err != nil {
+		return errors.Wrapf(err, "open block %s", m.ULID)
+	}
+	defer runutil.CloseWithLogOnErr(log.With(logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
+
+	var (
+		id           ulid.ULID
+		blockCkptDir = filepath.Join(checkpointDir, m.ULID.String())
+	)
+	if checkpointed(m, checkpointSeries) {
+		id, err = downsample.DownsampleCheckpointed(logger, m, b, dir, resolution, sketches, blockCkptDir, checkpointSeries)
+	} else {
+		id, err = downsample.Downsample(logger, m, b, dir, resolution, sketches)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "downsample block %s to window %d", m.ULID, resolution)
+	}
+	resdir := filepath.Join(dir, id.String())
+
+	level.Info(logger).Log("msg", "downsampled block",
+		"from", m.ULID, "to", id, "duration", time.Since(begin))
+
+	if err := block.VerifyIndex(logger, filepath.Join(resdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+		return errors.Wrap(err, "output block index not valid")
+	}
+
+	begin = time.Now()
+
+	err = block.Upload(ctx, logger, bkt, resdir)
+	if err != nil {
+		return errors.Wrapf(err, "upload downsampled block %s", id)
+	}
+
+	level.Info(logger).Log("msg", "uploaded block", "id", id, "duration", time.Since(begin))
+
+	// It is not harmful if these fails.
+	if err := os.RemoveAll(blockCkptDir); err != nil {
+		level.Warn(logger).Log("msg", "failed to clean directory", "dir", blockCkptDir, "err", err)
+	}
+	if err := os.RemoveAll(bdir); err != nil {
+		level.Warn(logger).Log("msg", "failed to clean directory", "dir", bdir, "err", err)
+	}
+	if err := os.RemoveAll(resdir); err != nil {
+		level.Warn(logger).Log("msg", "failed to clean directory", "resdir", bdir, "err", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestDownsampleBucket_CleanupCacheFolder(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stderr)
+	dir, err := ioutil.TempDir("", "test-compact-cleanup")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	var id ulid.ULID
+	{
+		id, err = e2eutil.CreateBlock(
+			ctx,
+			dir,
+			[]labels.Labels{{{Name: "a", Value: "1"}}},
+			1, 0, downsample.DownsampleRange0+1, // Pass the minimum DownsampleRange0 check.
+			labels.Labels{{Name: "e1", Value: "1"}},
+			downsample.ResLevel0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, id.String())))
+	}
+
+	meta, err := block.DownloadMeta(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+
+	metrics := NewDownsampleMetrics(prometheus.NewRegistry())
+	testutil.Equals(t, 0.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(GroupKey(meta.Thanos))))
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Ok(t, DownsampleBucket(ctx, logger, metrics, bkt, metas, DownsampleOptions{
+		Dir:           dir,
+		Levels:        downsample.DefaultLevels,
+		Concurrency:   2,
+		CheckpointDir: filepath.Join(dir, "checkpoints"),
+		DiskSpace:     NewDiskSpaceLimiter(nil, 0, dir),
+	}))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(GroupKey(meta.Thanos))))
+
+	_, err = os.Stat(dir)
+	testutil.Assert(t, os.IsNotExist(err), "downsample cache dir should not exist at the end of execution")
+}
+
+func TestDownsampleDiskSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "downsample-disk-space")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	m := &metadata.Meta{}
+	m.ULID = ulid.MustNew(1, nil)
+	m.Stats.NumSeries = 100
+
+	opts := DownsampleOptions{CheckpointDir: dir}
+	reserve, err := downsampleDiskSpace(m, 1000, opts)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2000), reserve)
+
+	// Checkpoint parts are written in addition to the downsampled block.
+	opts.CheckpointSeries = 10
+	reserve, err = downsampleDiskSpace(m, 1000, opts)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(3000), reserve)
+
+	// Parts checkpointed by interrupted runs are on disk already.
+	pdir := filepath.Join(dir, m.ULID.String(), "part-000000")
+	testutil.Ok(t, os.MkdirAll(pdir, 0777))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(pdir, "index"), make([]byte, 400), 0666))
+	reserve, err = downsampleDiskSpace(m, 1000, opts)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2600), reserve)
+
+	// Blocks with less series are not checkpointed.
+	opts.CheckpointSeries = 100
+	reserve, err = downsampleDiskSpace(m, 1000, opts)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(2000), reserve)
+}
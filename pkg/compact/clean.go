@@ -5,13 +5,18 @@ package compact
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"sort"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
 )
 
@@ -21,6 +26,63 @@ const (
 	PartialUploadThresholdAge = 2 * 24 * time.Hour
 )
 
+// AbortedPartialUploads returns sorted IDs of partial blocks that are assumed to be aborted uploads. Partial blocks are
+// blocks without valid meta.json, as returned by block.MetadataFetcher. A partial block is considered an aborted upload
+// if its debug meta file is present, which block.Upload uploads before any other file of the block, and if it was created
+// more than thresholdAge ago.
+// TODO(bwplotka): Use ModifiedTime of objects instead of ULID (block creation time), once available in objstore.
+func AbortedPartialUploads(ctx context.Context, bkt objstore.BucketReader, partial map[ulid.ULID]error, thresholdAge time.Duration) ([]ulid.ULID, error) {
+	var res []ulid.ULID
+	for id := range partial {
+		if ulid.Now()-id.Time() <= uint64(thresholdAge/time.Millisecond) {
+			// Minimum delay has not expired, ignore for now.
+			continue
+		}
+
+		debugMeta := path.Join(block.DebugMetas, fmt.Sprintf("%s.json", id))
+		ok, err := bkt.Exists(ctx, debugMeta)
+		if err != nil {
+			return nil, errors.Wrapf(err, "check exists %s", debugMeta)
+		}
+		if !ok {
+			// Not uploaded by block.Upload, so it might not be a block at all.
+			continue
+		}
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	return res, nil
+}
+
+// CleanAbortedPartialUploads deletes given aborted partial uploads from the bucket. Blocks that failed to be deleted
+// are logged and skipped. It returns the number of such blocks.
+func CleanAbortedPartialUploads(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	ids []ulid.ULID,
+	deleteAttempts prometheus.Counter,
+	blockCleanups prometheus.Counter,
+	blockCleanupFailures prometheus.Counter,
+) (failures int) {
+	for _, id := range ids {
+		deleteAttempts.Inc()
+		level.Info(logger).Log("msg", "found partially uploaded block; deleting", "block", id)
+		// We don't gather any information about deletion marks for partial blocks, so let's simply remove it. We waited
+		// long enough already.
+		// TODO(bwplotka): Fix some edge cases: https://github.com/thanos-io/thanos/issues/2470 .
+		if err := block.Delete(ctx, logger, bkt, id); err != nil {
+			failures++
+			blockCleanupFailures.Inc()
+			level.Warn(logger).Log("msg", "failed to delete aborted partial upload; will retry in next iteration", "block", id, "err", err)
+			continue
+		}
+		blockCleanups.Inc()
+		level.Info(logger).Log("msg", "deleted aborted partial upload", "block", id)
+	}
+	return failures
+}
+
 func BestEffortCleanAbortedPartialUploads(
 	ctx context.Context,
 	logger log.Logger,
@@ -37,25 +99,91 @@ func BestEffortCleanAbortedPartialUploads(
 	// * being uploaded longer than partialUploadThresholdAge
 	// * being uploaded and started after their partialUploadThresholdAge
 	// can be assumed in this case. Keep partialUploadThresholdAge long for now.
-	// Mitigate this by adding ModifiedTime to bkt and check that instead of ULID (block creation time).
+	ids, err := AbortedPartialUploads(ctx, bkt, partial, PartialUploadThresholdAge)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to find aborted partial uploads; will retry in next iteration", "thresholdAge", PartialUploadThresholdAge, "err", err)
+		return
+	}
+	CleanAbortedPartialUploads(ctx, logger, bkt, ids, deleteAttempts, blockCleanups, blockCleanupFailures)
+	level.Info(logger).Log("msg", "cleaning of aborted partial uploads done")
+}
+
+// PartialBlocksToQuarantine returns sorted IDs of the given partial blocks created more than thresholdAge ago.
+func PartialBlocksToQuarantine(partial map[ulid.ULID]error, thresholdAge time.Duration) []ulid.ULID {
+	var res []ulid.ULID
 	for id := range partial {
-		if ulid.Now()-id.Time() <= uint64(PartialUploadThresholdAge/time.Millisecond) {
-			// Minimum delay has not expired, ignore for now.
+		if ulid.Now()-id.Time() <= uint64(thresholdAge/time.Millisecond) {
 			continue
 		}
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	return res
+}
 
-		deleteAttempts.Inc()
-		level.Info(logger).Log("msg", "found partially uploaded block; marking for deletion", "block", id)
-		// We don't gather any information about deletion marks for partial blocks, so let's simply remove it. We waited
-		// long PartialUploadThresholdAge already.
-		// TODO(bwplotka): Fix some edge cases: https://github.com/thanos-io/thanos/issues/2470 .
-		if err := block.Delete(ctx, logger, bkt, id); err != nil {
-			blockCleanupFailures.Inc()
-			level.Warn(logger).Log("msg", "failed to delete aborted partial upload; will retry in next iteration", "block", id, "thresholdAge", PartialUploadThresholdAge, "err", err)
+// BestEffortQuarantinePartialBlocks quarantines partial blocks created more than thresholdAge ago, see
+// block.MarkQuarantined, and returns the partial blocks which were not quarantined. Blocks that failed to be
+// quarantined are logged and retried in the next iteration.
+func BestEffortQuarantinePartialBlocks(
+	ctx context.Context,
+	logger log.Logger,
+	partial map[ulid.ULID]error,
+	bkt objstore.Bucket,
+	thresholdAge time.Duration,
+	blocksQuarantined prometheus.Counter,
+) map[ulid.ULID]error {
+	res := make(map[ulid.ULID]error, len(partial))
+	for id, err := range partial {
+		res[id] = err
+	}
+	for _, id := range PartialBlocksToQuarantine(partial, thresholdAge) {
+		if err := block.MarkQuarantined(ctx, logger, bkt, id, partial[id].Error(), blocksQuarantined); err != nil {
+			level.Warn(logger).Log("msg", "failed to quarantine partial block; will retry in next iteration", "block", id, "err", err)
 			continue
 		}
-		blockCleanups.Inc()
-		level.Info(logger).Log("msg", "deleted aborted partial upload", "block", id, "thresholdAge", PartialUploadThresholdAge)
+		delete(res, id)
 	}
-	level.Info(logger).Log("msg", "cleaning of aborted partial uploads done")
+	return res
+}
+
+// QuarantinedBlocksToDelete returns sorted IDs of the given quarantined blocks which were quarantined more than
+// deleteDelay ago, according to their quarantine mark.
+func QuarantinedBlocksToDelete(ctx context.Context, logger log.Logger, bkt objstore.InstrumentedBucketReader, quarantined []ulid.ULID, deleteDelay time.Duration) ([]ulid.ULID, error) {
+	var res []ulid.ULID
+	for _, id := range quarantined {
+		m, err := metadata.ReadQuarantineMark(ctx, bkt, logger, id.String())
+		if err == metadata.ErrorQuarantineMarkNotFound {
+			// Mark was removed since the last sync, so the block is not quarantined anymore.
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read quarantine mark of block %s", id)
+		}
+		if time.Since(time.Unix(m.QuarantineTime, 0)) <= deleteDelay {
+			continue
+		}
+		res = append(res, id)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	return res, nil
+}
+
+// BestEffortCleanQuarantinedBlocks deletes quarantined blocks which were quarantined more than deleteDelay ago, like
+// BestEffortCleanAbortedPartialUploads does for aborted partial uploads.
+func BestEffortCleanQuarantinedBlocks(
+	ctx context.Context,
+	logger log.Logger,
+	quarantined []ulid.ULID,
+	bkt objstore.InstrumentedBucket,
+	deleteDelay time.Duration,
+	deleteAttempts prometheus.Counter,
+	blockCleanups prometheus.Counter,
+	blockCleanupFailures prometheus.Counter,
+) {
+	ids, err := QuarantinedBlocksToDelete(ctx, logger, bkt, quarantined, deleteDelay)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to find quarantined blocks to delete; will retry in next iteration", "deleteDelay", deleteDelay, "err", err)
+		return
+	}
+	CleanAbortedPartialUploads(ctx, logger, bkt, ids, deleteAttempts, blockCleanups, blockCleanupFailures)
 }
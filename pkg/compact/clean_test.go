@@ -13,6 +13,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
@@ -32,12 +33,13 @@ func TestBestEffortCleanAbortedPartialUploads(t *testing.T) {
 	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, nil, nil)
 	testutil.Ok(t, err)
 
-	// 1. No meta, old block, should be removed.
+	// 1. No meta, old block with debug meta, should be removed.
 	shouldDeleteID, err := ulid.New(uint64(time.Now().Add(-PartialUploadThresholdAge-1*time.Hour).Unix()*1000), nil)
 	testutil.Ok(t, err)
 
 	var fakeChunk bytes.Buffer
 	fakeChunk.Write([]byte{0, 1, 2, 3})
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(block.DebugMetas, shouldDeleteID.String()+".json"), bytes.NewReader([]byte("{}"))))
 	testutil.Ok(t, bkt.Upload(ctx, path.Join(shouldDeleteID.String(), "chunks", "000001"), &fakeChunk))
 
 	// 2.  Old block with meta, so should be kept.
@@ -56,14 +58,25 @@ func TestBestEffortCleanAbortedPartialUploads(t *testing.T) {
 	shouldIgnoreID2, err := ulid.New(uint64(time.Now().Add(-2*time.Hour).Unix()*1000), nil)
 	testutil.Ok(t, err)
 
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(block.DebugMetas, shouldIgnoreID2.String()+".json"), bytes.NewReader([]byte("{}"))))
 	testutil.Ok(t, bkt.Upload(ctx, path.Join(shouldIgnoreID2.String(), "chunks", "000001"), &fakeChunk))
 
+	// 4. No meta, old block without debug meta, so not uploaded by Thanos and should be kept.
+	shouldIgnoreID3, err := ulid.New(uint64(time.Now().Add(-PartialUploadThresholdAge-3*time.Hour).Unix()*1000), nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(shouldIgnoreID3.String(), "chunks", "000001"), &fakeChunk))
+
 	deleteAttempts := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	blockCleanups := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	blockCleanupFailures := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 	_, partial, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
 
+	ids, err := AbortedPartialUploads(ctx, bkt, partial, PartialUploadThresholdAge)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{shouldDeleteID}, ids)
+
 	BestEffortCleanAbortedPartialUploads(ctx, logger, partial, bkt, deleteAttempts, blockCleanups, blockCleanupFailures)
 	testutil.Equals(t, 1.0, promtest.ToFloat64(deleteAttempts))
 	testutil.Equals(t, 1.0, promtest.ToFloat64(blockCleanups))
@@ -80,4 +93,83 @@ func TestBestEffortCleanAbortedPartialUploads(t *testing.T) {
 	exists, err = bkt.Exists(ctx, path.Join(shouldIgnoreID2.String(), "chunks", "000001"))
 	testutil.Ok(t, err)
 	testutil.Equals(t, true, exists)
+
+	exists, err = bkt.Exists(ctx, path.Join(shouldIgnoreID3.String(), "chunks", "000001"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, exists)
+}
+
+func TestBestEffortCleanQuarantinedBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	logger := log.NewNopLogger()
+
+	upload := func(id ulid.ULID, quarantineTime time.Time) {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), "chunks", "000001"), bytes.NewReader([]byte{0, 1, 2, 3})))
+		mark, err := json.Marshal(metadata.QuarantineMark{ID: id, QuarantineTime: quarantineTime.Unix(), Version: metadata.QuarantineMarkVersion1})
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.QuarantineMarkFilename), bytes.NewReader(mark)))
+	}
+
+	// Quarantined longer than the delete delay, should be removed.
+	shouldDeleteID := ulid.MustNew(1, nil)
+	upload(shouldDeleteID, time.Now().Add(-3*time.Hour))
+	// Quarantined recently, should be kept.
+	shouldIgnoreID1 := ulid.MustNew(2, nil)
+	upload(shouldIgnoreID1, time.Now().Add(-1*time.Hour))
+	// Released since the last sync, should be kept.
+	shouldIgnoreID2 := ulid.MustNew(3, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(shouldIgnoreID2.String(), "chunks", "000001"), bytes.NewReader([]byte{0, 1, 2, 3})))
+
+	quarantined := []ulid.ULID{shouldDeleteID, shouldIgnoreID1, shouldIgnoreID2}
+	ids, err := QuarantinedBlocksToDelete(ctx, logger, bkt, quarantined, 2*time.Hour)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{shouldDeleteID}, ids)
+
+	deleteAttempts := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blockCleanups := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	blockCleanupFailures := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	BestEffortCleanQuarantinedBlocks(ctx, logger, quarantined, bkt, 2*time.Hour, deleteAttempts, blockCleanups, blockCleanupFailures)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(deleteAttempts))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blockCleanups))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(blockCleanupFailures))
+
+	exists, err := bkt.Exists(ctx, path.Join(shouldDeleteID.String(), "chunks", "000001"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, false, exists)
+
+	for _, id := range []ulid.ULID{shouldIgnoreID1, shouldIgnoreID2} {
+		exists, err = bkt.Exists(ctx, path.Join(id.String(), "chunks", "000001"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, true, exists)
+	}
+}
+
+func TestBestEffortQuarantinePartialBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bkt := objstore.NewInMemBucket()
+	logger := log.NewNopLogger()
+
+	oldID := ulid.MustNew(uint64(time.Now().Add(-3*time.Hour).Unix()*1000), nil)
+	newID := ulid.MustNew(uint64(time.Now().Add(-1*time.Hour).Unix()*1000), nil)
+	partial := map[ulid.ULID]error{oldID: errors.New("no meta.json"), newID: errors.New("no meta.json")}
+	for id := range partial {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), "chunks", "000001"), bytes.NewReader([]byte{0, 1, 2, 3})))
+	}
+
+	// The blocks planned for quarantine are exactly the ones quarantined.
+	testutil.Equals(t, []ulid.ULID{oldID}, PartialBlocksToQuarantine(partial, 2*time.Hour))
+
+	quarantined := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	rest := BestEffortQuarantinePartialBlocks(ctx, logger, partial, bkt, 2*time.Hour, quarantined)
+	testutil.Equals(t, map[ulid.ULID]error{newID: partial[newID]}, rest)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(quarantined))
+
+	exists, err := bkt.Exists(ctx, path.Join(oldID.String(), metadata.QuarantineMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, exists)
 }
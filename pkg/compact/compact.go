@@ -1,6 +1,10 @@
 // Copyright (c) The Thanos Authors.
 // Licensed under the Apache License 2.0.
 
+// Package compact compacts, downsamples and garbage collects blocks in an object storage bucket. Besides the compactor
+// command, it can be used by tools working with the same buckets, e.g. custom retention jobs: Syncer syncs metas of the
+// bucket and groups them into compaction groups with a Grouper, a Planner plans the next compaction of a group,
+// BucketCompactor runs the compactions and DownsampleBucket downsamples the blocks.
 package compact
 
 import (
@@ -8,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -27,6 +32,8 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tombstone"
 )
 
 type ResolutionLevel int64
@@ -49,10 +56,12 @@ type Syncer struct {
 	partial                  map[ulid.ULID]error
 	blockSyncConcurrency     int
 	metrics                  *syncerMetrics
-	acceptMalformedIndex     bool
-	enableVerticalCompaction bool
+	groupOpts                GroupOptions
+	grouper                  Grouper
 	duplicateBlocksFilter    *block.DeduplicateFilter
 	ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter
+	noCompactMarkFilter      *block.GatherNoCompactionMarkFilter
+	tombstones               []*tombstone.Tombstone
 }
 
 type syncerMetrics struct {
@@ -65,7 +74,10 @@ type syncerMetrics struct {
 	compactionRunsCompleted   *prometheus.CounterVec
 	compactionFailures        *prometheus.CounterVec
 	verticalCompactions       *prometheus.CounterVec
+	verificationFailures      *prometheus.CounterVec
+	compactionDuration        *prometheus.HistogramVec
 	blocksMarkedForDeletion   prometheus.Counter
+	blocksMarkedForNoCompact  prometheus.Counter
 }
 
 func newSyncerMetrics(reg prometheus.Registerer, blocksMarkedForDeletion prometheus.Counter) *syncerMetrics {
@@ -109,17 +121,71 @@ func newSyncerMetrics(reg prometheus.Registerer, blocksMarkedForDeletion prometh
 		Name: "thanos_compact_group_vertical_compactions_total",
 		Help: "Total number of group compaction attempts that resulted in a new block based on overlapping blocks.",
 	}, []string{"group"})
+	m.verificationFailures = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_group_compaction_verification_failures_total",
+		Help: "Total number of compacted blocks with sampled series not matching the source blocks.",
+	}, []string{"group"})
+	m.compactionDuration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "thanos_compact_group_compaction_duration_seconds",
+		Help:    "Time it took to run a group compaction, including waiting for disk space, download and upload of blocks.",
+		Buckets: []float64{1, 10, 60, 300, 900, 1800, 3600, 7200, 14400},
+	}, []string{"group"})
+	m.blocksMarkedForNoCompact = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_blocks_marked_for_no_compact_total",
+		Help: "Total number of blocks marked by compactor to be excluded from compaction.",
+	})
 	m.blocksMarkedForDeletion = blocksMarkedForDeletion
 
 	return &m
 }
 
+// groupMetrics returns the metrics of the group with the given key.
+func (m *syncerMetrics) groupMetrics(groupKey string) groupMetrics {
+	return groupMetrics{
+		compactions:              m.compactions.WithLabelValues(groupKey),
+		compactionRunsStarted:    m.compactionRunsStarted.WithLabelValues(groupKey),
+		compactionRunsCompleted:  m.compactionRunsCompleted.WithLabelValues(groupKey),
+		compactionFailures:       m.compactionFailures.WithLabelValues(groupKey),
+		verticalCompactions:      m.verticalCompactions.WithLabelValues(groupKey),
+		verificationFailures:     m.verificationFailures.WithLabelValues(groupKey),
+		compactionDuration:       m.compactionDuration.WithLabelValues(groupKey),
+		garbageCollectedBlocks:   m.garbageCollectedBlocks,
+		blocksMarkedForDeletion:  m.blocksMarkedForDeletion,
+		blocksMarkedForNoCompact: m.blocksMarkedForNoCompact,
+	}
+}
+
+// GroupOptions configures the compaction of groups.
+type GroupOptions struct {
+	// AcceptMalformedIndex accepts source blocks with index issues known to be safe to compact, like out of order labels.
+	AcceptMalformedIndex bool
+	// EnableVerticalCompaction enables merging of overlapping blocks of a group, which is needed for
+	// deduplication of replicas, blocks of Receivers and the Cortex compactor.
+	EnableVerticalCompaction bool
+	// If VerifySeries is positive, up to VerifySeries series of every source block are compared with the compacted block
+	// before it is uploaded.
+	VerifySeries int
+	// If MaxIndexSize is positive, blocks which would be compacted into a block with index bigger than MaxIndexSize bytes
+	// are marked to be excluded from compaction instead.
+	MaxIndexSize int64
+	// If SplitIndexSize is positive, compacted blocks with index bigger than SplitIndexSize bytes are split into
+	// SplitShards blocks by series hash.
+	SplitIndexSize int64
+	SplitShards    int
+	// ErrorPolicy decides how issues found in source blocks are handled. Nil policy halts on every issue.
+	ErrorPolicy *ErrorPolicy
+}
+
 // NewMetaSyncer returns a new Syncer for the given Bucket and directory.
 // Blocks must be at least as old as the sync delay for being considered.
-func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher block.MetadataFetcher, duplicateBlocksFilter *block.DeduplicateFilter, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, blocksMarkedForDeletion prometheus.Counter, blockSyncConcurrency int, acceptMalformedIndex bool, enableVerticalCompaction bool) (*Syncer, error) {
+// Groups returned by the syncer compact their blocks as configured by groupOpts.
+func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher block.MetadataFetcher, duplicateBlocksFilter *block.DeduplicateFilter, ignoreDeletionMarkFilter *block.IgnoreDeletionMarkFilter, noCompactMarkFilter *block.GatherNoCompactionMarkFilter, blocksMarkedForDeletion prometheus.Counter, blockSyncConcurrency int, groupOpts GroupOptions, grouper Grouper) (*Syncer, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
+	if grouper == nil {
+		grouper = DefaultGrouper{}
+	}
 	return &Syncer{
 		logger:                   logger,
 		reg:                      reg,
@@ -129,29 +195,22 @@ func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket
 		metrics:                  newSyncerMetrics(reg, blocksMarkedForDeletion),
 		duplicateBlocksFilter:    duplicateBlocksFilter,
 		ignoreDeletionMarkFilter: ignoreDeletionMarkFilter,
+		noCompactMarkFilter:      noCompactMarkFilter,
 		blockSyncConcurrency:     blockSyncConcurrency,
-		acceptMalformedIndex:     acceptMalformedIndex,
-		// The syncer offers an option to enable vertical compaction, even if it's
-		// not currently used by Thanos, because the compactor is also used by Cortex
-		// which needs vertical compaction.
-		enableVerticalCompaction: enableVerticalCompaction,
+		groupOpts:                groupOpts,
+		grouper:                  grouper,
 	}, nil
 }
 
-// UntilNextDownsampling calculates how long it will take until the next downsampling operation.
+// UntilNextDownsampling calculates how long it will take until the next downsampling operation with the given levels.
 // Returns an error if there will be no downsampling.
-func UntilNextDownsampling(m *metadata.Meta) (time.Duration, error) {
-	timeRange := time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond))
-	switch m.Thanos.Downsample.Resolution {
-	case downsample.ResLevel2:
+func UntilNextDownsampling(m *metadata.Meta, levels []downsample.Level) (time.Duration, error) {
+	next, ok := downsample.NextLevel(levels, m.Thanos.Downsample.Resolution)
+	if !ok {
 		return time.Duration(0), errors.New("no downsampling")
-	case downsample.ResLevel1:
-		return time.Duration(downsample.DownsampleRange1*time.Millisecond) - timeRange, nil
-	case downsample.ResLevel0:
-		return time.Duration(downsample.DownsampleRange0*time.Millisecond) - timeRange, nil
-	default:
-		panic(errors.Errorf("invalid resolution %v", m.Thanos.Downsample.Resolution))
 	}
+	timeRange := time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond))
+	return time.Duration(next.MinBlockRange)*time.Millisecond - timeRange, nil
 }
 
 // SyncMetas synchronises local state of block metas with what we have in the bucket.
@@ -163,8 +222,13 @@ func (s *Syncer) SyncMetas(ctx context.Context) error {
 	if err != nil {
 		return retry(err)
 	}
+	tombstones, err := tombstone.ReadAll(ctx, s.logger, s.bkt)
+	if err != nil {
+		return retry(err)
+	}
 	s.blocks = metas
 	s.partial = partial
+	s.tombstones = tombstones
 	return nil
 }
 
@@ -184,52 +248,60 @@ func (s *Syncer) Metas() map[ulid.ULID]*metadata.Meta {
 	return s.blocks
 }
 
-// GroupKey returns a unique identifier for the group the block belongs to. It considers
-// the downsampling resolution and the block's labels.
+// GroupKey returns a unique identifier for the group the block belongs to with the DefaultGrouper.
+// It considers the downsampling resolution and the block's labels.
 func GroupKey(meta metadata.Thanos) string {
-	return groupKey(meta.Downsample.Resolution, labels.FromMap(meta.Labels))
+	return groupKey(meta.Downsample.Resolution, labels.FromMap(meta.Labels), meta.Shard)
 }
 
-func groupKey(res int64, lbls labels.Labels) string {
-	return fmt.Sprintf("%d@%v", res, lbls.Hash())
+func groupKey(res int64, lbls labels.Labels, shard string) string {
+	if shard == "" {
+		return fmt.Sprintf("%d@%v", res, lbls.Hash())
+	}
+	return fmt.Sprintf("%d@%v@%s", res, lbls.Hash(), shard)
 }
 
 // Groups returns the compaction groups for all blocks currently known to the syncer.
+// Blocks marked for no compaction are excluded from compaction, but split the planning of their group, see Group.Plan.
 // It creates all groups from the scratch on every call.
 func (s *Syncer) Groups() (res []*Group, err error) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	var noCompactMarked map[ulid.ULID]*metadata.NoCompactMark
+	if s.noCompactMarkFilter != nil {
+		noCompactMarked = s.noCompactMarkFilter.NoCompactMarkedBlocks()
+	}
+
 	groups := map[string]*Group{}
 	for _, m := range s.blocks {
-		groupKey := GroupKey(m.Thanos)
+		lbls := s.grouper.GroupLabels(m.Thanos)
+		groupKey := groupKey(m.Thanos.Downsample.Resolution, lbls, m.Thanos.Shard)
 		g, ok := groups[groupKey]
 		if !ok {
-			lbls := labels.FromMap(m.Thanos.Labels)
 			g, err = newGroup(
 				log.With(s.logger, "group", fmt.Sprintf("%d@%v", m.Thanos.Downsample.Resolution, lbls.String()), "groupKey", groupKey),
 				s.bkt,
 				lbls,
 				m.Thanos.Downsample.Resolution,
-				s.acceptMalformedIndex,
-				s.enableVerticalCompaction,
-				s.metrics.compactions.WithLabelValues(groupKey),
-				s.metrics.compactionRunsStarted.WithLabelValues(groupKey),
-				s.metrics.compactionRunsCompleted.WithLabelValues(groupKey),
-				s.metrics.compactionFailures.WithLabelValues(groupKey),
-				s.metrics.verticalCompactions.WithLabelValues(groupKey),
-				s.metrics.garbageCollectedBlocks,
-				s.metrics.blocksMarkedForDeletion,
+				m.Thanos.Shard,
+				s.groupOpts,
+				s.metrics.groupMetrics(groupKey),
 			)
 			if err != nil {
 				return nil, errors.Wrap(err, "create compaction group")
 			}
+			g.grouper = s.grouper
+			g.tombstones = s.tombstones
 			groups[groupKey] = g
 			res = append(res, g)
 		}
 		if err := g.Add(m); err != nil {
 			return nil, errors.Wrap(err, "add compaction group")
 		}
+		if _, ok := noCompactMarked[m.ULID]; ok {
+			g.exclude(m.ULID)
+		}
 	}
 	sort.Slice(res, func(i, j int) bool {
 		return res[i].Key() < res[j].Key()
@@ -246,21 +318,7 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 
 	begin := time.Now()
 
-	// Ignore filter exists before deduplicate filter.
-	deletionMarkMap := s.ignoreDeletionMarkFilter.DeletionMarkBlocks()
-	duplicateIDs := s.duplicateBlocksFilter.DuplicateIDs()
-
-	// GarbageIDs contains the duplicateIDs, since these blocks can be replaced with other blocks.
-	// We also remove ids present in deletionMarkMap since these blocks are already marked for deletion.
-	garbageIDs := []ulid.ULID{}
-	for _, id := range duplicateIDs {
-		if _, exists := deletionMarkMap[id]; exists {
-			continue
-		}
-		garbageIDs = append(garbageIDs, id)
-	}
-
-	for _, id := range garbageIDs {
+	for _, id := range s.garbageBlocks() {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
@@ -286,24 +344,77 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 	return nil
 }
 
-// Group captures a set of blocks that have the same origin labels and downsampling resolution.
+// GarbageBlocks returns blocks which would be marked for deletion by GarbageCollect.
+// Call to SyncMetas function is required to populate duplicateIDs in duplicateBlocksFilter.
+func (s *Syncer) GarbageBlocks() []ulid.ULID {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.garbageBlocks()
+}
+
+func (s *Syncer) garbageBlocks() []ulid.ULID {
+	// Ignore filter exists before deduplicate filter.
+	deletionMarkMap := s.ignoreDeletionMarkFilter.DeletionMarkBlocks()
+	duplicateIDs := s.duplicateBlocksFilter.DuplicateIDs()
+
+	// GarbageIDs contains the duplicateIDs, since these blocks can be replaced with other blocks.
+	// We also remove ids present in deletionMarkMap since these blocks are already marked for deletion.
+	garbageIDs := []ulid.ULID{}
+	for _, id := range duplicateIDs {
+		if _, exists := deletionMarkMap[id]; exists {
+			continue
+		}
+		garbageIDs = append(garbageIDs, id)
+	}
+	return garbageIDs
+}
+
+// Group captures a set of blocks that have the same group labels, downsampling resolution and shard.
+// By default, group labels are the origin labels of blocks, see Grouper.
 // Those blocks generally contain the same series and can thus efficiently be compacted.
 type Group struct {
 	logger                      log.Logger
 	bkt                         objstore.Bucket
 	labels                      labels.Labels
 	resolution                  int64
+	shard                       string
 	mtx                         sync.Mutex
 	blocks                      map[ulid.ULID]*metadata.Meta
+	excluded                    map[ulid.ULID]*metadata.Meta
 	acceptMalformedIndex        bool
 	enableVerticalCompaction    bool
+	verifySeries                int
+	maxIndexSize                int64
+	splitIndexSize              int64
+	splitShards                 int
+	errorPolicy                 *ErrorPolicy
 	compactions                 prometheus.Counter
 	compactionRunsStarted       prometheus.Counter
 	compactionRunsCompleted     prometheus.Counter
 	compactionFailures          prometheus.Counter
 	verticalCompactions         prometheus.Counter
+	verificationFailures        prometheus.Counter
+	compactionDuration          prometheus.Observer
 	groupGarbageCollectedBlocks prometheus.Counter
 	blocksMarkedForDeletion     prometheus.Counter
+	blocksMarkedForNoCompact    prometheus.Counter
+	grouper                     Grouper
+	tombstones                  []*tombstone.Tombstone
+}
+
+// groupMetrics are the metrics of a compaction group.
+type groupMetrics struct {
+	compactions              prometheus.Counter
+	compactionRunsStarted    prometheus.Counter
+	compactionRunsCompleted  prometheus.Counter
+	compactionFailures       prometheus.Counter
+	verticalCompactions      prometheus.Counter
+	verificationFailures     prometheus.Counter
+	compactionDuration       prometheus.Observer
+	garbageCollectedBlocks   prometheus.Counter
+	blocksMarkedForDeletion  prometheus.Counter
+	blocksMarkedForNoCompact prometheus.Counter
 }
 
 // newGroup returns a new compaction group.
@@ -312,15 +423,9 @@ func newGroup(
 	bkt objstore.Bucket,
 	lset labels.Labels,
 	resolution int64,
-	acceptMalformedIndex bool,
-	enableVerticalCompaction bool,
-	compactions prometheus.Counter,
-	compactionRunsStarted prometheus.Counter,
-	compactionRunsCompleted prometheus.Counter,
-	compactionFailures prometheus.Counter,
-	verticalCompactions prometheus.Counter,
-	groupGarbageCollectedBlocks prometheus.Counter,
-	blocksMarkedForDeletion prometheus.Counter,
+	shard string,
+	opts GroupOptions,
+	metrics groupMetrics,
 ) (*Group, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -330,23 +435,41 @@ func newGroup(
 		bkt:                         bkt,
 		labels:                      lset,
 		resolution:                  resolution,
+		shard:                       shard,
 		blocks:                      map[ulid.ULID]*metadata.Meta{},
-		acceptMalformedIndex:        acceptMalformedIndex,
-		enableVerticalCompaction:    enableVerticalCompaction,
-		compactions:                 compactions,
-		compactionRunsStarted:       compactionRunsStarted,
-		compactionRunsCompleted:     compactionRunsCompleted,
-		compactionFailures:          compactionFailures,
-		verticalCompactions:         verticalCompactions,
-		groupGarbageCollectedBlocks: groupGarbageCollectedBlocks,
-		blocksMarkedForDeletion:     blocksMarkedForDeletion,
+		excluded:                    map[ulid.ULID]*metadata.Meta{},
+		acceptMalformedIndex:        opts.AcceptMalformedIndex,
+		enableVerticalCompaction:    opts.EnableVerticalCompaction,
+		verifySeries:                opts.VerifySeries,
+		maxIndexSize:                opts.MaxIndexSize,
+		splitIndexSize:              opts.SplitIndexSize,
+		splitShards:                 opts.SplitShards,
+		errorPolicy:                 opts.ErrorPolicy,
+		compactions:                 metrics.compactions,
+		compactionRunsStarted:       metrics.compactionRunsStarted,
+		compactionRunsCompleted:     metrics.compactionRunsCompleted,
+		compactionFailures:          metrics.compactionFailures,
+		verticalCompactions:         metrics.verticalCompactions,
+		verificationFailures:        metrics.verificationFailures,
+		compactionDuration:          metrics.compactionDuration,
+		groupGarbageCollectedBlocks: metrics.garbageCollectedBlocks,
+		blocksMarkedForDeletion:     metrics.blocksMarkedForDeletion,
+		blocksMarkedForNoCompact:    metrics.blocksMarkedForNoCompact,
 	}
 	return g, nil
 }
 
 // Key returns an identifier for the group.
 func (cg *Group) Key() string {
-	return groupKey(cg.resolution, cg.labels)
+	return groupKey(cg.resolution, cg.labels, cg.shard)
+}
+
+// groupLabels returns the group labels of the block with the given meta.
+func (cg *Group) groupLabels(meta metadata.Thanos) labels.Labels {
+	if cg.grouper == nil {
+		return DefaultGrouper{}.GroupLabels(meta)
+	}
+	return cg.grouper.GroupLabels(meta)
 }
 
 // Add the block with the given meta to the group.
@@ -354,17 +477,32 @@ func (cg *Group) Add(meta *metadata.Meta) error {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
 
-	if !labels.Equal(cg.labels, labels.FromMap(meta.Thanos.Labels)) {
+	if !labels.Equal(cg.labels, cg.groupLabels(meta.Thanos)) {
 		return errors.New("block and group labels do not match")
 	}
 	if cg.resolution != meta.Thanos.Downsample.Resolution {
 		return errors.New("block and group resolution do not match")
 	}
+	if cg.shard != meta.Thanos.Shard {
+		return errors.New("block and group shard do not match")
+	}
 	cg.blocks[meta.ULID] = meta
 	return nil
 }
 
-// IDs returns all sorted IDs of blocks in the group.
+// exclude excludes the block with the given ID from compaction. The block stays in the group as a planning boundary:
+// no compaction is planned across it, as the compacted block would overlap it.
+// It has to be called with the group lock held.
+func (cg *Group) exclude(id ulid.ULID) {
+	meta, ok := cg.blocks[id]
+	if !ok {
+		return
+	}
+	delete(cg.blocks, id)
+	cg.excluded[id] = meta
+}
+
+// IDs returns all sorted IDs of blocks in the group, except blocks excluded from compaction.
 func (cg *Group) IDs() (ids []ulid.ULID) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
@@ -388,27 +526,43 @@ func (cg *Group) Resolution() int64 {
 	return cg.resolution
 }
 
+// Shard returns the common shard of blocks in the group. It is empty for groups of blocks which were not split.
+func (cg *Group) Shard() string {
+	return cg.shard
+}
+
 // Compact plans and runs a single compaction against the group. The compacted result
 // is uploaded into the bucket the blocks were retrieved from.
-func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (bool, ulid.ULID, error) {
+// Local disk space needed by the compaction is reserved in the given DiskSpaceLimiter, if not nil.
+// The planned blocks are reported to the given Progress, if not nil.
+func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor, diskSpace *DiskSpaceLimiter, progress *Progress) (shouldRerun bool, compID ulid.ULID, err error) {
 	cg.compactionRunsStarted.Inc()
+	defer func(begin time.Time) { cg.compactionDuration.Observe(time.Since(begin).Seconds()) }(time.Now())
 
 	subDir := filepath.Join(dir, cg.Key())
 
 	defer func() {
+		// Keep downloaded blocks if the compaction is going to be retried, so their download can be resumed.
+		if IsRetryError(err) {
+			return
+		}
 		if err := os.RemoveAll(subDir); err != nil {
 			level.Error(cg.logger).Log("msg", "failed to remove compaction group work directory", "path", subDir, "err", err)
 		}
 	}()
 
-	if err := os.RemoveAll(subDir); err != nil {
+	keep := make(map[string]struct{}, len(cg.blocks))
+	for id := range cg.blocks {
+		keep[id.String()] = struct{}{}
+	}
+	if err := removeAllExcept(subDir, keep); err != nil {
 		return false, ulid.ULID{}, errors.Wrap(err, "clean compaction group dir")
 	}
 	if err := os.MkdirAll(subDir, 0777); err != nil {
 		return false, ulid.ULID{}, errors.Wrap(err, "create compaction group dir")
 	}
 
-	shouldRerun, compID, err := cg.compact(ctx, subDir, comp)
+	shouldRerun, compID, err = cg.compact(ctx, subDir, comp, diskSpace, progress)
 	if err != nil {
 		cg.compactionFailures.Inc()
 		return false, ulid.ULID{}, err
@@ -417,6 +571,93 @@ func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	return shouldRerun, compID, nil
 }
 
+// excludeExceedingIndexSize marks the block with the biggest index in the plan to be excluded from compaction, if the
+// sum of the index sizes of the planned blocks exceeds the configured limit. The sum is an upper bound of the index size
+// of the compacted block, as series and symbols shared by the blocks are stored only once.
+// It returns true if a block was marked.
+func (cg *Group) excludeExceedingIndexSize(ctx context.Context, plan []string) (bool, error) {
+	if cg.maxIndexSize <= 0 {
+		return false, nil
+	}
+
+	var (
+		totalSize   int64
+		biggestSize int64
+		biggest     ulid.ULID
+	)
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return false, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		meta, ok := cg.blocks[id]
+		if !ok {
+			return false, errors.Errorf("planned block %s not found in group", id)
+		}
+		size, err := indexSize(ctx, cg.bkt, meta)
+		if err != nil {
+			return false, retry(errors.Wrapf(err, "get index size of block %s", id))
+		}
+		totalSize += size
+		if size > biggestSize {
+			biggestSize, biggest = size, id
+		}
+	}
+	if totalSize <= cg.maxIndexSize {
+		return false, nil
+	}
+
+	level.Warn(cg.logger).Log("msg", "planned compaction would exceed index size limit; excluding biggest block from compaction",
+		"plan", fmt.Sprintf("%v", plan), "estimatedIndexSize", totalSize, "limit", cg.maxIndexSize, "block", biggest, "blockIndexSize", biggestSize)
+	if err := block.MarkForNoCompact(
+		ctx,
+		cg.logger,
+		cg.bkt,
+		biggest,
+		metadata.IndexSizeExceedingNoCompactReason,
+		fmt.Sprintf("compaction of %d blocks would result in index of up to %d bytes exceeding the limit of %d bytes; block index size is %d bytes", len(plan), totalSize, cg.maxIndexSize, biggestSize),
+		cg.blocksMarkedForNoCompact,
+	); err != nil {
+		return false, retry(errors.Wrapf(err, "mark block %s for no compaction", biggest))
+	}
+	cg.exclude(biggest)
+	return true, nil
+}
+
+// indexSize returns the size of the block index file in bytes, as recorded in meta.json or in the bucket otherwise.
+func indexSize(ctx context.Context, bkt objstore.Bucket, meta *metadata.Meta) (int64, error) {
+	for _, f := range meta.Thanos.Files {
+		if f.RelPath == block.IndexFilename {
+			return f.SizeBytes, nil
+		}
+	}
+	attrs, err := bkt.Attributes(ctx, path.Join(meta.ULID.String(), block.IndexFilename))
+	if err != nil {
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+// removeAllExcept removes everything in dir besides the entries with the given names.
+func removeAllExcept(dir string, keep map[string]struct{}) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if _, ok := keep[e.Name()]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Issue347Error is a type wrapper for errors that should invoke repair process for broken block.
 type Issue347Error struct {
 	err error
@@ -520,6 +761,10 @@ func (cg *Group) areBlocksOverlapping(include *metadata.Meta, excludeDirs ...str
 		}
 		metas = append(metas, m.BlockMeta)
 	}
+	// Blocks excluded from compaction are still in the bucket and must not be overlapped by compacted blocks.
+	for _, m := range cg.excluded {
+		metas = append(metas, m.BlockMeta)
+	}
 
 	if include != nil {
 		metas = append(metas, include.BlockMeta)
@@ -555,7 +800,7 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	}()
 
 	bdir := filepath.Join(tmpdir, ie.id.String())
-	if err := block.Download(ctx, logger, bkt, ie.id, bdir); err != nil {
+	if err := block.DownloadResumable(ctx, logger, bkt, ie.id, bdir); err != nil {
 		return retry(errors.Wrapf(err, "download block %s", ie.id))
 	}
 
@@ -592,44 +837,202 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	return nil
 }
 
-func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (shouldRerun bool, compID ulid.ULID, err error) {
+// Planner plans compactions of blocks in a directory based only on their meta files, e.g. tsdb.LeveledCompactor.
+type Planner interface {
+	// Plan returns directories of blocks in dir which should be compacted together. No directories are returned if
+	// there is nothing to compact.
+	Plan(dir string) ([]string, error)
+}
+
+// Plan returns blocks of the next compaction of the group, without downloading or modifying any blocks.
+// Meta files of the blocks are written to a group directory in dir for planning, which is removed afterwards.
+// No blocks are returned if the group has nothing to compact.
+func (cg *Group) Plan(dir string, planner Planner) ([]ulid.ULID, error) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
 
-	// Check for overlapped blocks.
-	overlappingBlocks := false
-	if err := cg.areBlocksOverlapping(nil); err != nil {
-		// TODO(bwplotka): It would really nice if we could still check for other overlaps than replica. In fact this should be checked
-		// in syncer itself. Otherwise with vertical compaction enabled we will sacrifice this important check.
-		if !cg.enableVerticalCompaction {
-			return false, ulid.ULID{}, halt(errors.Wrap(err, "pre compaction overlap check"))
+	subDir := filepath.Join(dir, cg.Key())
+	defer func() {
+		if err := os.RemoveAll(subDir); err != nil {
+			level.Error(cg.logger).Log("msg", "failed to remove compaction group planning directory", "path", subDir, "err", err)
 		}
-
-		overlappingBlocks = true
+	}()
+	if err := os.MkdirAll(subDir, 0777); err != nil {
+		return nil, errors.Wrap(err, "create compaction group dir")
+	}
+	plan, err := cg.plan(subDir, planner)
+	if err != nil {
+		return nil, err
 	}
+	ids := make([]ulid.ULID, 0, len(plan))
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return nil, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
 
+// plan returns directories of blocks of the next compaction of the group.
+// Blocks excluded from compaction split the group into ranges of blocks, which are planned separately in order of time,
+// so that no compaction covers blocks on both sides of an excluded block.
+func (cg *Group) plan(dir string, planner Planner) ([]string, error) {
 	// Planning a compaction works purely based on the meta.json files in our future group's dir.
 	// So we first dump all our memory block metas into the directory.
+	metas := make([]*metadata.Meta, 0, len(cg.blocks))
 	for _, meta := range cg.blocks {
+		metas = append(metas, meta)
+	}
+	if err := writePlanningMetas(cg.logger, dir, metas); err != nil {
+		return nil, err
+	}
+	if len(cg.excluded) == 0 {
+		return planDir(dir, planner)
+	}
+
+	for i, r := range cg.planningRanges() {
+		rdir := filepath.Join(dir, fmt.Sprintf("range-%d", i))
+		if err := writePlanningMetas(cg.logger, rdir, r); err != nil {
+			return nil, err
+		}
+		plan, err := planDir(rdir, planner)
+		if err := os.RemoveAll(rdir); err != nil {
+			return nil, errors.Wrap(err, "remove planning range dir")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(plan) == 0 {
+			continue
+		}
+		// Blocks are downloaded to the group dir, the range dir is for planning only.
+		for j, pdir := range plan {
+			plan[j] = filepath.Join(dir, filepath.Base(pdir))
+		}
+		return plan, nil
+	}
+	return nil, nil
+}
+
+// planningRanges returns the blocks of the group split by blocks excluded from compaction, sorted by time.
+// A block belongs to the range after every excluded block starting before it. Empty ranges are omitted.
+func (cg *Group) planningRanges() [][]*metadata.Meta {
+	ranges := make([][]*metadata.Meta, len(cg.excluded)+1)
+	for _, m := range cg.blocks {
+		i := 0
+		for _, e := range cg.excluded {
+			if e.MinTime < m.MinTime {
+				i++
+			}
+		}
+		ranges[i] = append(ranges[i], m)
+	}
+
+	res := ranges[:0]
+	for _, r := range ranges {
+		if len(r) == 0 {
+			continue
+		}
+		sort.Slice(r, func(i, j int) bool {
+			return r[i].MinTime < r[j].MinTime
+		})
+		res = append(res, r)
+	}
+	return res
+}
+
+// writePlanningMetas writes the given metas into block directories in dir.
+func writePlanningMetas(logger log.Logger, dir string, metas []*metadata.Meta) error {
+	for _, meta := range metas {
 		bdir := filepath.Join(dir, meta.ULID.String())
 		if err := os.MkdirAll(bdir, 0777); err != nil {
-			return false, ulid.ULID{}, errors.Wrap(err, "create planning block dir")
+			return errors.Wrap(err, "create planning block dir")
 		}
-		if err := metadata.Write(cg.logger, bdir, meta); err != nil {
-			return false, ulid.ULID{}, errors.Wrap(err, "write planning meta file")
+		if err := metadata.Write(logger, bdir, meta); err != nil {
+			return errors.Wrap(err, "write planning meta file")
+		}
+	}
+	return nil
+}
+
+// planDir plans a compaction against the meta.json files written in dir.
+func planDir(dir string, planner Planner) ([]string, error) {
+	plan, err := planner.Plan(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "plan compaction")
+	}
+	return plan, nil
+}
+
+func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor, diskSpace *DiskSpaceLimiter, progress *Progress) (shouldRerun bool, compID ulid.ULID, err error) {
+	cg.mtx.Lock()
+	defer cg.mtx.Unlock()
+
+	// Check for overlapped blocks.
+	overlappingBlocks := false
+	if err := cg.areBlocksOverlapping(nil); err != nil {
+		// TODO(bwplotka): It would really nice if we could still check for other overlaps than replica. In fact this should be checked
+		// in syncer itself. Otherwise with vertical compaction enabled we will sacrifice this important check.
+		if !cg.enableVerticalCompaction {
+			return false, ulid.ULID{}, halt(errors.Wrap(err, "pre compaction overlap check"))
 		}
+
+		overlappingBlocks = true
 	}
 
-	// Plan against the written meta.json files.
-	plan, err := comp.Plan(dir)
+	plan, err := cg.plan(dir, comp)
 	if err != nil {
-		return false, ulid.ULID{}, errors.Wrap(err, "plan compaction")
+		return false, ulid.ULID{}, err
 	}
 	if len(plan) == 0 {
 		// Nothing to do.
 		return false, ulid.ULID{}, nil
 	}
 
+	if excluded, err := cg.excludeExceedingIndexSize(ctx, plan); err != nil {
+		return false, ulid.ULID{}, err
+	} else if excluded {
+		// The group is planned again without the excluded block.
+		return true, ulid.ULID{}, nil
+	}
+	progress.planned(cg.Key(), plan)
+
+	// Source blocks and the compacted block are kept on disk at the same time, so reserve twice the size of the plan.
+	var planSize int64
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return false, ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		meta, ok := cg.blocks[id]
+		if !ok {
+			return false, ulid.ULID{}, errors.Errorf("planned block %s not found in group", id)
+		}
+		size, err := block.FilesSize(ctx, cg.bkt, meta)
+		if err != nil {
+			return false, ulid.ULID{}, retry(errors.Wrapf(err, "get size of block %s", id))
+		}
+		planSize += size
+	}
+	reserve := 2 * planSize
+	if cg.splitIndexSize > 0 && cg.shard == "" {
+		// Shards of a split compacted block are written next to it.
+		reserve += planSize
+	}
+	level.Debug(cg.logger).Log("msg", "reserving disk space for compaction", "bytes", reserve)
+	release, err := diskSpace.Reserve(ctx, reserve)
+	if errors.Cause(err) == ErrInsufficientDiskSpace {
+		// Refuse the compaction before downloading anything, it is planned again in the next compaction run.
+		level.Warn(cg.logger).Log("msg", "not enough free disk space for compaction; rescheduling it", "plan", fmt.Sprintf("%v", plan), "err", err)
+		return false, ulid.ULID{}, nil
+	}
+	if err != nil {
+		return false, ulid.ULID{}, errors.Wrap(err, "reserve disk space")
+	}
+	defer release()
+
 	level.Info(cg.logger).Log("msg", "compaction available and planned; downloading blocks", "plan", fmt.Sprintf("%v", plan))
 
 	// Due to #183 we verify that none of the blocks in the plan have overlapping sources.
@@ -638,16 +1041,24 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 
 	// Once we have a plan we need to download the actual data.
 	begin := time.Now()
+	tombstoned := map[string]bool{}
+	parents := make([]*metadata.Meta, 0, len(plan))
 
 	for _, pdir := range plan {
 		meta, err := metadata.Read(pdir)
 		if err != nil {
 			return false, ulid.ULID{}, errors.Wrapf(err, "read meta from %s", pdir)
 		}
+		parents = append(parents, meta)
 
-		cgKey, groupKey := cg.Key(), GroupKey(meta.Thanos)
-		if cgKey != groupKey {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "compact planned compaction for mixed groups. group: %s, planned block's group: %s", cgKey, groupKey))
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return false, ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+
+		if err := cg.validateMeta(meta, id); err != nil {
+			rerun, err := cg.handleBlockError(ctx, ErrorClassMalformedMeta, id, errors.Wrapf(err, "malformed meta of block %s", id))
+			return rerun, ulid.ULID{}, err
 		}
 
 		for _, s := range meta.Compaction.Sources {
@@ -657,16 +1068,7 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 			uniqueSources[s] = struct{}{}
 		}
 
-		id, err := ulid.Parse(filepath.Base(pdir))
-		if err != nil {
-			return false, ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
-		}
-
-		if meta.ULID.Compare(id) != 0 {
-			return false, ulid.ULID{}, errors.Errorf("mismatch between meta %s and dir %s", meta.ULID, id)
-		}
-
-		if err := block.Download(ctx, cg.logger, cg.bkt, id, pdir); err != nil {
+		if err := block.DownloadResumable(ctx, cg.logger, cg.bkt, id, pdir); err != nil {
 			return false, ulid.ULID{}, retry(errors.Wrapf(err, "download block %s", id))
 		}
 
@@ -676,8 +1078,14 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 			return false, ulid.ULID{}, errors.Wrapf(err, "gather index issues for block %s", pdir)
 		}
 
+		if err := stats.OutOfOrderChunksErr(); err != nil {
+			rerun, err := cg.handleBlockError(ctx, ErrorClassOutOfOrderChunks, id, errors.Wrapf(err, "block with out of order chunks found %s; Compaction level %v; Labels: %v", pdir, meta.Compaction.Level, meta.Thanos.Labels))
+			return rerun, ulid.ULID{}, err
+		}
+
 		if err := stats.CriticalErr(); err != nil {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", pdir, meta.Compaction.Level, meta.Thanos.Labels))
+			rerun, err := cg.handleBlockError(ctx, ErrorClassCriticalIndex, id, errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", pdir, meta.Compaction.Level, meta.Thanos.Labels))
+			return rerun, ulid.ULID{}, err
 		}
 
 		if err := stats.Issue347OutsideChunksErr(); err != nil {
@@ -688,6 +1096,10 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 			return false, ulid.ULID{}, errors.Wrapf(err,
 				"block id %s, try running with --debug.accept-malformed-index", id)
 		}
+
+		if tombstoned[pdir], err = cg.applyTombstones(pdir, meta); err != nil {
+			return false, ulid.ULID{}, errors.Wrapf(err, "apply tombstones to block %s", id)
+		}
 	}
 	level.Info(cg.logger).Log("msg", "downloaded and verified blocks; compacting blocks", "plan", fmt.Sprintf("%v", plan), "duration", time.Since(begin))
 
@@ -706,7 +1118,8 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 				level.Warn(cg.logger).Log("msg", "failed to read meta for block", "block", block)
 				continue
 			}
-			if meta.Stats.NumSamples == 0 {
+			// Blocks with tombstones applied have no samples left, if the compacted block is empty.
+			if meta.Stats.NumSamples == 0 || tombstoned[block] {
 				if err := cg.deleteBlock(block); err != nil {
 					level.Warn(cg.logger).Log("msg", "failed to delete empty block found during compaction", "block", block)
 				}
@@ -724,18 +1137,38 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 
 	bdir := filepath.Join(dir, compID.String())
 	index := filepath.Join(bdir, block.IndexFilename)
-	indexCache := filepath.Join(bdir, block.IndexCacheFilename)
+
+	// Ensure sampled series have the same samples as in the source blocks. Downsampled blocks contain
+	// aggregated chunks, which cannot be read as samples, so only raw blocks are verified. Penalty based and
+	// last-write-wins deduplication drop samples of overlapping blocks on purpose, so such compactions cannot be verified.
+	lossyDedup := false
+	if dc, ok := comp.(*DedupCompactor); ok && overlappingBlocks {
+		f, err := dc.Func(plan)
+		if err != nil {
+			return false, ulid.ULID{}, errors.Wrap(err, "get deduplication func")
+		}
+		lossyDedup = f == DedupFuncPenalty || f == DedupFuncLastWriteWins
+	}
+	if cg.verifySeries > 0 && cg.resolution == int64(ResolutionLevelRaw) && !lossyDedup {
+		if err := verifyCompaction(cg.logger, plan, bdir, cg.verifySeries); err != nil {
+			cg.verificationFailures.Inc()
+			return false, ulid.ULID{}, halt(errors.Wrapf(err, "verify compacted block %s against %v", bdir, plan))
+		}
+	}
 
 	newMeta, err := metadata.InjectThanos(cg.logger, bdir, metadata.Thanos{
 		Labels:     cg.labels.Map(),
 		Downsample: metadata.ThanosDownsample{Resolution: cg.resolution},
 		Source:     metadata.CompactorSource,
+		Shard:      cg.shard,
+		Lineage:    metadata.NewLineage(metadata.LineageCompaction, metadata.CompactorSource, parents),
 	}, nil)
 	if err != nil {
 		return false, ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
 	}
 
-	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
+	// Blocks written by DedupCompactor have no tombstones file.
+	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
 		return false, ulid.ULID{}, errors.Wrap(err, "remove tombstones")
 	}
 
@@ -752,16 +1185,37 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 		}
 	}
 
-	if err := indexheader.WriteJSON(cg.logger, index, indexCache); err != nil {
-		return false, ulid.ULID{}, errors.Wrap(err, "write index cache")
+	results := []string{bdir}
+	if split, err := cg.shouldSplit(index); err != nil {
+		return false, ulid.ULID{}, err
+	} else if split {
+		begin = time.Now()
+		results, err = cg.splitBlock(dir, bdir, newMeta, comp)
+		if err != nil {
+			return false, ulid.ULID{}, errors.Wrapf(err, "split compacted block %s", bdir)
+		}
+		if len(results) == 0 {
+			return false, ulid.ULID{}, halt(errors.Errorf("split of compacted block %s resulted in no blocks", bdir))
+		}
+		level.Info(cg.logger).Log("msg", "split compacted block", "block", compID, "shards", len(results), "duration", time.Since(begin))
+		if err := os.RemoveAll(bdir); err != nil {
+			return false, ulid.ULID{}, errors.Wrapf(err, "remove split block %s", bdir)
+		}
+		compID = ulid.MustParse(filepath.Base(results[0]))
 	}
 
-	begin = time.Now()
+	for _, rdir := range results {
+		if err := indexheader.WriteJSON(cg.logger, filepath.Join(rdir, block.IndexFilename), filepath.Join(rdir, block.IndexCacheFilename)); err != nil {
+			return false, ulid.ULID{}, errors.Wrap(err, "write index cache")
+		}
 
-	if err := block.Upload(ctx, cg.logger, cg.bkt, bdir); err != nil {
-		return false, ulid.ULID{}, retry(errors.Wrapf(err, "upload of %s failed", compID))
+		begin = time.Now()
+
+		if err := block.Upload(ctx, cg.logger, cg.bkt, rdir); err != nil {
+			return false, ulid.ULID{}, retry(errors.Wrapf(err, "upload of %s failed", filepath.Base(rdir)))
+		}
+		level.Info(cg.logger).Log("msg", "uploaded block", "result_block", filepath.Base(rdir), "duration", time.Since(begin))
 	}
-	level.Info(cg.logger).Log("msg", "uploaded block", "result_block", compID, "duration", time.Since(begin))
 
 	// Delete the blocks we just compacted from the group and bucket so they do not get included
 	// into the next planning cycle.
@@ -776,6 +1230,82 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	return true, compID, nil
 }
 
+// applyTombstones deletes samples of the downloaded block in bdir which are deleted by the global tombstones of the group,
+// by adding them to the local tombstones of the block. Compaction then drops those samples. It returns true if any
+// tombstone was applied.
+// Only raw blocks are rewritten, as samples cannot be deleted from aggregated chunks. Store gateways mask deleted samples
+// of downsampled blocks at query time.
+func (cg *Group) applyTombstones(bdir string, meta *metadata.Meta) (applied bool, err error) {
+	if cg.resolution != int64(ResolutionLevelRaw) || len(cg.tombstones) == 0 {
+		return false, nil
+	}
+
+	var b *tsdb.Block
+	defer func() {
+		if b != nil {
+			runutil.CloseWithErrCapture(&err, b, "close block")
+		}
+	}()
+	for _, t := range cg.tombstones {
+		if !t.Overlaps(meta.MinTime, meta.MaxTime-1) {
+			continue
+		}
+		// Matchers of external labels are evaluated against the block, as series in the block do not have them.
+		var ms []*labels.Matcher
+		matches := true
+		for _, m := range t.LabelMatchers() {
+			if v, ok := meta.Thanos.Labels[m.Name]; ok {
+				matches = matches && m.Matches(v)
+				continue
+			}
+			ms = append(ms, m)
+		}
+		if !matches {
+			continue
+		}
+		if len(ms) == 0 {
+			ms = append(ms, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+		}
+
+		if b == nil {
+			if b, err = tsdb.OpenBlock(cg.logger, bdir, nil); err != nil {
+				return false, errors.Wrap(err, "open block")
+			}
+		}
+		if err := b.Delete(t.MinTime, t.MaxTime, ms...); err != nil {
+			return false, errors.Wrapf(err, "delete series of tombstone %s", t.ID)
+		}
+		level.Info(cg.logger).Log("msg", "applied tombstone", "block", meta.ULID, "tombstone", t.ID, "matchers", t.Matchers)
+		applied = true
+	}
+	if !applied {
+		return false, nil
+	}
+
+	// TSDB rewrites meta.json without the Thanos section when deleting.
+	if err := metadata.Write(cg.logger, bdir, meta); err != nil {
+		return false, errors.Wrap(err, "write meta")
+	}
+	return true, nil
+}
+
+// validateMeta returns an error if the meta of the planned block with the given ID is inconsistent with the block or the group.
+func (cg *Group) validateMeta(meta *metadata.Meta, id ulid.ULID) error {
+	if meta.ULID.Compare(id) != 0 {
+		return errors.Errorf("mismatch between meta %s and dir %s", meta.ULID, id)
+	}
+	if cgKey, groupKey := cg.Key(), groupKey(meta.Thanos.Downsample.Resolution, cg.groupLabels(meta.Thanos), meta.Thanos.Shard); cgKey != groupKey {
+		return errors.Errorf("compact planned compaction for mixed groups. group: %s, planned block's group: %s", cgKey, groupKey)
+	}
+	if meta.MinTime >= meta.MaxTime {
+		return errors.Errorf("invalid time range [%d, %d)", meta.MinTime, meta.MaxTime)
+	}
+	if meta.Compaction.Level < 1 || len(meta.Compaction.Sources) == 0 {
+		return errors.Errorf("invalid compaction level %d with %d sources", meta.Compaction.Level, len(meta.Compaction.Sources))
+	}
+	return nil
+}
+
 func (cg *Group) deleteBlock(b string) error {
 	id, err := ulid.Parse(filepath.Base(b))
 	if err != nil {
@@ -804,9 +1334,15 @@ type BucketCompactor struct {
 	compactDir  string
 	bkt         objstore.Bucket
 	concurrency int
+	diskSpace   *DiskSpaceLimiter
+	progress    *Progress
+	shards      *ShardOwnershipChecker
 }
 
 // NewBucketCompactor creates a new bucket compactor.
+// Up to concurrency independent groups are compacted in parallel. If diskSpace is not nil, it limits the local disk
+// space used by the concurrent compactions. If progress is not nil, the state of all groups is tracked in it.
+// If shards is not nil, groups are compacted only after verifying that no other compactor shard owns them.
 func NewBucketCompactor(
 	logger log.Logger,
 	sy *Syncer,
@@ -814,6 +1350,9 @@ func NewBucketCompactor(
 	compactDir string,
 	bkt objstore.Bucket,
 	concurrency int,
+	diskSpace *DiskSpaceLimiter,
+	progress *Progress,
+	shards *ShardOwnershipChecker,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
 		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", concurrency)
@@ -825,17 +1364,55 @@ func NewBucketCompactor(
 		compactDir:  compactDir,
 		bkt:         bkt,
 		concurrency: concurrency,
+		diskSpace:   diskSpace,
+		progress:    progress,
+		shards:      shards,
 	}, nil
 }
 
+// PlannedCompaction is the next compaction of a group.
+type PlannedCompaction struct {
+	Group  string      `json:"group"`
+	Blocks []ulid.ULID `json:"blocks"`
+}
+
+// Plan syncs the metas and returns the next compaction of every group, without downloading or modifying any blocks.
+// Compactions of blocks produced by the planned ones are not known in advance, so they are not included.
+func (c *BucketCompactor) Plan(ctx context.Context) ([]PlannedCompaction, error) {
+	if err := c.sy.SyncMetas(ctx); err != nil {
+		return nil, errors.Wrap(err, "sync")
+	}
+	groups, err := c.sy.Groups()
+	if err != nil {
+		return nil, errors.Wrap(err, "build compaction groups")
+	}
+	var res []PlannedCompaction
+	for _, g := range groups {
+		plan, err := g.Plan(c.compactDir, c.comp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "plan group %s", g.Key())
+		}
+		if len(plan) > 0 {
+			res = append(res, PlannedCompaction{Group: g.Key(), Blocks: plan})
+		}
+	}
+	return res, nil
+}
+
 // Compact runs compaction over bucket.
-func (c *BucketCompactor) Compact(ctx context.Context) error {
+func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 	defer func() {
+		// Keep downloaded blocks if the compaction is going to be retried, so their download can be resumed.
+		if IsRetryError(rerr) {
+			return
+		}
 		if err := os.RemoveAll(c.compactDir); err != nil {
 			level.Error(c.logger).Log("msg", "failed to remove compaction work directory", "path", c.compactDir, "err", err)
 		}
 	}()
 
+	c.progress.start()
+
 	// Loop over bucket and compact until there's no work left.
 	for {
 		var (
@@ -855,7 +1432,9 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 			go func() {
 				defer wg.Done()
 				for g := range groupChan {
-					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.comp)
+					c.progress.started(g.Key())
+					shouldRerunGroup, compID, err := g.Compact(workCtx, c.compactDir, c.comp, c.diskSpace, c.progress)
+					c.progress.finished(g.Key(), compID != ulid.ULID{}, err)
 					if err == nil {
 						if shouldRerunGroup {
 							mtx.Lock()
@@ -879,11 +1458,6 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 			}()
 		}
 
-		// Clean up the compaction temporary directory at the beginning of every compaction loop.
-		if err := os.RemoveAll(c.compactDir); err != nil {
-			return errors.Wrap(err, "clean up the compaction temporary directory")
-		}
-
 		level.Info(c.logger).Log("msg", "start sync of metas")
 		if err := c.sy.SyncMetas(ctx); err != nil {
 			return errors.Wrap(err, "sync")
@@ -900,6 +1474,20 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 		if err != nil {
 			return errors.Wrap(err, "build compaction groups")
 		}
+		if err := c.shards.Check(ctx, groups); err != nil {
+			return errors.Wrap(err, "check ownership of compaction groups")
+		}
+
+		// Clean up the compaction temporary directory at the beginning of every compaction loop. Work directories of
+		// existing groups are kept, as they might contain blocks downloaded by a previous retried compaction.
+		keep := make(map[string]struct{}, len(groups))
+		for _, g := range groups {
+			keep[g.Key()] = struct{}{}
+		}
+		if err := removeAllExcept(c.compactDir, keep); err != nil {
+			return errors.Wrap(err, "clean up the compaction temporary directory")
+		}
+		c.progress.newPass(groups)
 
 		level.Info(c.logger).Log("msg", "start of compactions")
 
@@ -97,7 +97,7 @@ func TestSyncer_GarbageCollect_e2e(t *testing.T) {
 
 		blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
 		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(nil, nil, 48*time.Hour)
-		sy, err := NewSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, 1, false, false)
+		sy, err := NewSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, nil, blocksMarkedForDeletion, 1, GroupOptions{}, nil)
 		testutil.Ok(t, err)
 
 		// Do one initial synchronization with the bucket.
@@ -185,13 +185,13 @@ func TestGroup_Compact_e2e(t *testing.T) {
 		testutil.Ok(t, err)
 
 		blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
-		sy, err := NewSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, 5, false, false)
+		sy, err := NewSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, nil, blocksMarkedForDeletion, 5, GroupOptions{}, nil)
 		testutil.Ok(t, err)
 
 		comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, []int64{1000, 3000}, nil)
 		testutil.Ok(t, err)
 
-		bComp, err := NewBucketCompactor(logger, sy, comp, dir, bkt, 2)
+		bComp, err := NewBucketCompactor(logger, sy, comp, dir, bkt, 2, NewDiskSpaceLimiter(nil, 0, ""), nil, nil)
 		testutil.Ok(t, err)
 
 		// Compaction on empty should not fail.
@@ -284,6 +284,20 @@ func TestGroup_Compact_e2e(t *testing.T) {
 			},
 		})
 
+		// Planning should report the groups that are going to be compacted without touching the bucket.
+		plan, err := bComp.Plan(ctx)
+		testutil.Ok(t, err)
+		plannedGroups := map[string]struct{}{}
+		for _, p := range plan {
+			testutil.Assert(t, len(p.Blocks) > 1, "planned compaction of group %s has less than two blocks", p.Group)
+			plannedGroups[p.Group] = struct{}{}
+		}
+		testutil.Equals(t, map[string]struct{}{
+			GroupKey(metas[0].Thanos): {},
+			GroupKey(metas[7].Thanos): {},
+		}, plannedGroups)
+		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.garbageCollectedBlocks))
+
 		testutil.Ok(t, bComp.Compact(ctx))
 		testutil.Equals(t, 5.0, promtest.ToFloat64(sy.metrics.garbageCollectedBlocks))
 		testutil.Equals(t, 5.0, promtest.ToFloat64(sy.metrics.blocksMarkedForDeletion))
@@ -350,7 +364,7 @@ func TestGroup_Compact_e2e(t *testing.T) {
 		// We expect two compacted blocks only outside of what we expected in `nonCompactedExpected`.
 		testutil.Equals(t, 2, len(others))
 		{
-			meta, ok := others[groupKey(124, extLabels)]
+			meta, ok := others[groupKey(124, extLabels, "")]
 			testutil.Assert(t, ok, "meta not found")
 
 			testutil.Equals(t, int64(0), meta.MinTime)
@@ -365,7 +379,7 @@ func TestGroup_Compact_e2e(t *testing.T) {
 			testutil.Equals(t, int64(124), meta.Thanos.Downsample.Resolution)
 		}
 		{
-			meta, ok := others[groupKey(124, extLabels2)]
+			meta, ok := others[groupKey(124, extLabels2, "")]
 			testutil.Assert(t, ok, "meta not found")
 
 			testutil.Equals(t, int64(0), meta.MinTime)
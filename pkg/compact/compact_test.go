@@ -4,13 +4,28 @@
 package compact
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
 
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
 	terrors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"github.com/thanos-io/thanos/pkg/tombstone"
 )
 
 func TestHaltError(t *testing.T) {
@@ -109,3 +124,278 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// newTestGroupMetrics returns group metrics not registered anywhere.
+func newTestGroupMetrics() groupMetrics {
+	newCounter := func() prometheus.Counter { return promauto.With(nil).NewCounter(prometheus.CounterOpts{}) }
+	return groupMetrics{
+		compactions:              newCounter(),
+		compactionRunsStarted:    newCounter(),
+		compactionRunsCompleted:  newCounter(),
+		compactionFailures:       newCounter(),
+		verticalCompactions:      newCounter(),
+		verificationFailures:     newCounter(),
+		compactionDuration:       promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		garbageCollectedBlocks:   newCounter(),
+		blocksMarkedForDeletion:  newCounter(),
+		blocksMarkedForNoCompact: newCounter(),
+	}
+}
+
+// planAllPlanner plans all blocks in the planning dir to be compacted together, if there are at least two of them.
+type planAllPlanner struct{}
+
+func (planAllPlanner) Plan(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var plan []string
+	for _, fi := range fis {
+		if _, err := ulid.Parse(fi.Name()); err != nil {
+			continue
+		}
+		plan = append(plan, filepath.Join(dir, fi.Name()))
+	}
+	if len(plan) < 2 {
+		return nil, nil
+	}
+	return plan, nil
+}
+
+// testNoPlanSpans asserts that the planned blocks do not span the time range of the given block.
+func testNoPlanSpans(t *testing.T, metas map[ulid.ULID]*metadata.Meta, plan []ulid.ULID, id ulid.ULID) {
+	t.Helper()
+
+	if len(plan) == 0 {
+		return
+	}
+	mint, maxt := metas[plan[0]].MinTime, metas[plan[0]].MaxTime
+	for _, p := range plan {
+		testutil.Assert(t, p != id, "block %s planned", id)
+		if metas[p].MinTime < mint {
+			mint = metas[p].MinTime
+		}
+		if metas[p].MaxTime > maxt {
+			maxt = metas[p].MaxTime
+		}
+	}
+	testutil.Assert(t, maxt <= metas[id].MinTime || mint >= metas[id].MaxTime, "plan %v spans block %s", plan, id)
+}
+
+func TestSyncerGroups_NoCompactMark(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	dir, err := ioutil.TempDir("", "no-compact-mark")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := uint64(1); i <= 4; i++ {
+		id := ulid.MustNew(i, nil)
+		metas[id] = &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: int64(i) * 1000, MaxTime: int64(i+1) * 1000},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"a": "1"}},
+		}
+	}
+	marked := ulid.MustNew(2, nil)
+	testutil.Ok(t, block.MarkForNoCompact(ctx, log.NewNopLogger(), bkt, marked, metadata.ManualNoCompactReason, "test", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+
+	f := block.NewGatherNoCompactionMarkFilter(log.NewNopLogger(), bkt)
+	testutil.Ok(t, f.Filter(ctx, metas, nil))
+	testutil.Equals(t, 4, len(metas))
+
+	sy, err := NewSyncer(nil, nil, bkt, nil, nil, nil, f, nil, 1, GroupOptions{}, nil)
+	testutil.Ok(t, err)
+	sy.blocks = metas
+
+	groups, err := sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(groups))
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, groups[0].IDs())
+
+	// The marked block splits planning, so block 1 is not compacted with the blocks after it.
+	plan, err := groups[0].Plan(dir, planAllPlanner{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, plan)
+	testNoPlanSpans(t, metas, plan, marked)
+
+	delete(sy.blocks, ulid.MustNew(4, nil))
+	groups, err = sy.Groups()
+	testutil.Ok(t, err)
+	plan, err = groups[0].Plan(dir, planAllPlanner{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(plan))
+}
+
+func TestGroup_ExcludeExceedingIndexSize(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	metrics := newTestGroupMetrics()
+	g, err := newGroup(nil, bkt, nil, 0, "", GroupOptions{MaxIndexSize: 100}, metrics)
+	testutil.Ok(t, err)
+
+	dir, err := ioutil.TempDir("", "exclude-exceeding-index-size")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	var (
+		plan  []string
+		metas = map[ulid.ULID]*metadata.Meta{}
+	)
+	for i, size := range []int64{30, 50, 40, 10} {
+		id := ulid.MustNew(uint64(i+1), nil)
+		metas[id] = &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: int64(i) * 1000, MaxTime: int64(i+1) * 1000},
+			Thanos:    metadata.Thanos{Files: []metadata.File{{RelPath: block.IndexFilename, SizeBytes: size}}},
+		}
+		testutil.Ok(t, g.Add(metas[id]))
+		plan = append(plan, filepath.Join("dir", id.String()))
+	}
+	plan = plan[:3]
+
+	// Index sizes within the limit.
+	excluded, err := g.excludeExceedingIndexSize(ctx, plan[:2])
+	testutil.Ok(t, err)
+	testutil.Assert(t, !excluded, "expected no block to be excluded")
+
+	excluded, err = g.excludeExceedingIndexSize(ctx, plan)
+	testutil.Ok(t, err)
+	testutil.Assert(t, excluded, "expected block to be excluded")
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.blocksMarkedForNoCompact))
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, g.IDs())
+
+	mark, err := metadata.ReadNoCompactMark(ctx, objstore.WithNoopInstr(bkt), nil, ulid.MustNew(2, nil).String())
+	testutil.Ok(t, err)
+	testutil.Equals(t, metadata.IndexSizeExceedingNoCompactReason, mark.Reason)
+
+	// The excluded block is not compacted over by the next plan.
+	next, err := g.Plan(dir, planAllPlanner{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, next)
+	testNoPlanSpans(t, metas, next, ulid.MustNew(2, nil))
+}
+
+func TestGroup_ApplyTombstones(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "apply-tombstones")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "a", "1"),
+		labels.FromStrings("__name__", "up", "a", "2"),
+	}
+	extLset := labels.FromStrings("cluster", "eu1")
+
+	// Samples every 100ms from 0 to 9900.
+	id, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 10100, extLset, 0)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(dir, id.String())
+	meta, err := metadata.Read(bdir)
+	testutil.Ok(t, err)
+
+	g, err := newGroup(logger, objstore.NewInMemBucket(), extLset, 0, "", GroupOptions{}, newTestGroupMetrics())
+	testutil.Ok(t, err)
+
+	newTombstone := func(selector string, mint, maxt int64) *tombstone.Tombstone {
+		ts, err := tombstone.NewTombstone(selector, mint, maxt, "", "")
+		testutil.Ok(t, err)
+		return ts
+	}
+
+	// Tombstones not matching the external labels or the time range of the block are not applied.
+	g.tombstones = []*tombstone.Tombstone{newTombstone(`{cluster="us1"}`, 0, 10000), newTombstone(`{a="1"}`, 20000, 30000)}
+	applied, err := g.applyTombstones(bdir, meta)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !applied, "expected no tombstones to be applied")
+
+	g.tombstones = append(g.tombstones, newTombstone(`{cluster="eu1", a="1"}`, 0, 4999), newTombstone(`{cluster="eu1"}`, 9000, 20000))
+	applied, err = g.applyTombstones(bdir, meta)
+	testutil.Ok(t, err)
+	testutil.Assert(t, applied, "expected tombstones to be applied")
+
+	// Meta.json keeps the Thanos section.
+	meta, err = metadata.Read(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+
+	b, err := tsdb.OpenBlock(logger, bdir, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+
+	smpls, err := selectSamples(b, series[0], []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 40, len(smpls))
+	testutil.Equals(t, int64(5000), smpls[0].t)
+
+	smpls, err = selectSamples(b, series[1], []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "2")})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 90, len(smpls))
+	testutil.Equals(t, int64(8900), smpls[len(smpls)-1].t)
+}
+
+func TestGroup_Compact_OverlappingBlocks(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "compact-overlapping")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "a", "1"),
+		labels.FromStrings("__name__", "up", "a", "2"),
+	}
+	extLset := labels.FromStrings("receive", "true")
+
+	// Blocks like the ones of Receivers: samples every 100ms from 0 to 900 and from 500 to 1400, without replica labels.
+	bkt := objstore.NewInMemBucket()
+	var metas []*metadata.Meta
+	for _, mint := range []int64{0, 500} {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 10, mint, mint+1100, extLset, 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String())))
+		meta, err := metadata.Read(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		metas = append(metas, meta)
+	}
+
+	newTestGroup := func(enableVerticalCompaction bool) (*Group, prometheus.Counter) {
+		metrics := newTestGroupMetrics()
+		g, err := newGroup(logger, bkt, extLset, 0, "", GroupOptions{EnableVerticalCompaction: enableVerticalCompaction}, metrics)
+		testutil.Ok(t, err)
+		for _, m := range metas {
+			testutil.Ok(t, g.Add(m))
+		}
+		return g, metrics.verticalCompactions
+	}
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{2000}, nil)
+	testutil.Ok(t, err)
+
+	// Overlapping blocks halt the compactor, unless vertical compaction is enabled.
+	g, _ := newTestGroup(false)
+	_, _, err = g.Compact(ctx, filepath.Join(dir, "compact"), comp, NewDiskSpaceLimiter(nil, 0, ""), NewProgress())
+	testutil.NotOk(t, err)
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	g, verticalCompactions := newTestGroup(true)
+	_, compID, err := g.Compact(ctx, filepath.Join(dir, "compact"), comp, NewDiskSpaceLimiter(nil, 0, ""), NewProgress())
+	testutil.Ok(t, err)
+	testutil.Assert(t, compID != ulid.ULID{}, "expected compacted block")
+	testutil.Equals(t, 1.0, promtest.ToFloat64(verticalCompactions))
+
+	meta, err := block.DownloadMeta(ctx, logger, bkt, compID)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), meta.MinTime)
+	testutil.Equals(t, int64(1600), meta.MaxTime)
+	testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+	testutil.Equals(t, 2, len(meta.Compaction.Sources))
+	// Samples of the same timestamps are merged.
+	testutil.Equals(t, uint64(2*15), meta.Stats.NumSamples)
+}
@@ -0,0 +1,559 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/dedup"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DedupFuncNaive merges overlapping blocks by chaining samples of all replicas together.
+	DedupFuncNaive = ""
+	// DedupFuncExact is DedupFuncNaive: samples with exactly the same timestamp are kept once, all other samples are kept.
+	DedupFuncExact = "exact"
+	// DedupFuncPenalty merges overlapping blocks using the penalty based algorithm of the query time deduplication.
+	DedupFuncPenalty = "penalty"
+	// DedupFuncLastWriteWins merges overlapping blocks by chaining samples of all replicas together. Of samples with
+	// the same timestamp, the one of the most recently created block is kept.
+	DedupFuncLastWriteWins = "last-write-wins"
+)
+
+// DedupFuncs are all deduplication algorithms.
+var DedupFuncs = []string{DedupFuncNaive, DedupFuncExact, DedupFuncPenalty, DedupFuncLastWriteWins}
+
+func isValidDedupFunc(f string) bool {
+	for _, df := range DedupFuncs {
+		if f == df {
+			return true
+		}
+	}
+	return false
+}
+
+// DedupRule chooses the deduplication algorithm for compactions of blocks with any of the given replica labels.
+type DedupRule struct {
+	ReplicaLabels []string `yaml:"replica_labels"`
+	Func          string   `yaml:"func"`
+}
+
+// ParseDedupRules parses a YAML list of deduplication rules. Empty content means no rules.
+func ParseDedupRules(confYAML []byte) ([]*DedupRule, error) {
+	var rules []*DedupRule
+	if err := yaml.UnmarshalStrict(confYAML, &rules); err != nil {
+		return nil, errors.Wrap(err, "parse deduplication rules")
+	}
+	for i, r := range rules {
+		if len(r.ReplicaLabels) == 0 {
+			return nil, errors.Errorf("deduplication rule %d has no replica labels", i)
+		}
+		if !isValidDedupFunc(r.Func) {
+			return nil, errors.Errorf("unknown deduplication func %q of rule %d", r.Func, i)
+		}
+	}
+	return rules, nil
+}
+
+// matches returns true if any of the external labels is a replica label of the rule.
+func (r *DedupRule) matches(lset map[string]string) bool {
+	for _, l := range r.ReplicaLabels {
+		if _, ok := lset[l]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// samplesPerChunk is the number of samples per chunk of deduplicated series, same as in Prometheus head.
+const samplesPerChunk = 120
+
+// DedupCompactor is a tsdb.Compactor that merges overlapping raw blocks of replicas into one using the deduplication
+// algorithm chosen by the replica labels of the blocks. The penalty algorithm of the querier, e.g. for HA Prometheus
+// pairs, picks samples of one replica and switches to other replica only on gaps, so replicas with slightly different
+// timestamps do not result in exaggerated sampling frequency. The last-write-wins algorithm chains samples of all
+// replicas and keeps the sample of the most recently created block of samples with the same timestamp, e.g. for
+// backfilled blocks correcting existing data. All other compactions, including the ones of naive and exact algorithms,
+// are done by the wrapped compactor.
+type DedupCompactor struct {
+	tsdb.Compactor
+
+	logger      log.Logger
+	defaultFunc string
+	rules       []*DedupRule
+}
+
+// NewDedupCompactor returns DedupCompactor wrapping the given compactor. Compactions of blocks with a replica label
+// of any of the rules use the algorithm of the first such rule, others use the default algorithm.
+func NewDedupCompactor(logger log.Logger, comp tsdb.Compactor, defaultFunc string, rules []*DedupRule) *DedupCompactor {
+	return &DedupCompactor{Compactor: comp, logger: logger, defaultFunc: defaultFunc, rules: rules}
+}
+
+// Func returns the deduplication algorithm used for compaction of the blocks in the given dirs.
+func (c *DedupCompactor) Func(dirs []string) (string, error) {
+	metas, err := readMetas(dirs)
+	if err != nil {
+		return "", err
+	}
+	return c.funcFor(metas), nil
+}
+
+// funcFor returns the algorithm of the first rule with a replica label in external labels of any of the blocks.
+// Source blocks keep their replica labels, they are removed only from the compacted block.
+func (c *DedupCompactor) funcFor(metas []*metadata.Meta) string {
+	for _, r := range c.rules {
+		for _, m := range metas {
+			if r.matches(m.Thanos.Labels) {
+				return r.Func
+			}
+		}
+	}
+	return c.defaultFunc
+}
+
+// Compact compacts the blocks in the given dirs into a new block in dest and returns its ID. Empty ID is returned if
+// the new block would have no samples.
+func (c *DedupCompactor) Compact(dest string, dirs []string, open []*tsdb.Block) (ulid.ULID, error) {
+	metas, err := readMetas(dirs)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	f := c.funcFor(metas)
+	if f == DedupFuncNaive || f == DedupFuncExact || !dedupable(metas) {
+		return c.Compactor.Compact(dest, dirs, open)
+	}
+	return c.dedup(dest, dirs, metas, f)
+}
+
+func readMetas(dirs []string) ([]*metadata.Meta, error) {
+	metas := make([]*metadata.Meta, 0, len(dirs))
+	for _, d := range dirs {
+		m, err := metadata.Read(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read meta from %s", d)
+		}
+		metas = append(metas, m)
+	}
+	return metas, nil
+}
+
+// dedupable returns true if the given blocks are raw and overlap. Downsampled blocks contain aggregated chunks,
+// which cannot be deduplicated sample by sample.
+func dedupable(metas []*metadata.Meta) bool {
+	bms := make([]tsdb.BlockMeta, 0, len(metas))
+	for _, m := range metas {
+		if m.Thanos.Downsample.Resolution != int64(ResolutionLevelRaw) {
+			return false
+		}
+		bms = append(bms, m.BlockMeta)
+	}
+	sort.Slice(bms, func(i, j int) bool {
+		return bms[i].MinTime < bms[j].MinTime
+	})
+	return len(tsdb.OverlappingBlocks(bms)) > 0
+}
+
+func (c *DedupCompactor) dedup(dest string, dirs []string, metas []*metadata.Meta, f string) (id ulid.ULID, err error) {
+	begin := time.Now()
+
+	// Blocks are ordered by creation time, so replicas of the most recently created block come last.
+	dirs = append([]string(nil), dirs...)
+	sort.Sort(dirsByULID{dirs: dirs, metas: metas})
+
+	var blocks []*tsdb.Block
+	defer func() {
+		for _, b := range blocks {
+			runutil.CloseWithErrCapture(&err, b, "close source block")
+		}
+	}()
+	for _, d := range dirs {
+		b, err := tsdb.OpenBlock(c.logger, d, nil)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "open block %s", d)
+		}
+		blocks = append(blocks, b)
+	}
+
+	uid := ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	meta := compactedMeta(uid, metas)
+
+	tmp := filepath.Join(dest, uid.String()+".tmp")
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			level.Error(c.logger).Log("msg", "failed to remove tmp folder of deduplicated block", "dir", tmp, "err", err)
+		}
+	}()
+
+	if err := writeDedupBlock(tmp, blocks, meta, f); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write deduplicated block")
+	}
+	if meta.Stats.NumSamples == 0 {
+		return ulid.ULID{}, nil
+	}
+
+	if err := metadata.Write(c.logger, tmp, meta); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta")
+	}
+	if err := syncDir(tmp); err != nil {
+		return ulid.ULID{}, err
+	}
+	if err := fileutil.Replace(tmp, filepath.Join(dest, uid.String())); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "rename block dir")
+	}
+
+	level.Info(c.logger).Log("msg", "deduplicated overlapping blocks", "ulid", uid, "func", f, "mint", meta.MinTime, "maxt", meta.MaxTime,
+		"sources", len(dirs), "series", meta.Stats.NumSeries, "samples", meta.Stats.NumSamples, "duration", time.Since(begin))
+	return uid, nil
+}
+
+// dirsByULID sorts block dirs by ULIDs of their metas.
+type dirsByULID struct {
+	dirs  []string
+	metas []*metadata.Meta
+}
+
+func (s dirsByULID) Len() int           { return len(s.dirs) }
+func (s dirsByULID) Less(i, j int) bool { return s.metas[i].ULID.Compare(s.metas[j].ULID) < 0 }
+func (s dirsByULID) Swap(i, j int) {
+	s.dirs[i], s.dirs[j] = s.dirs[j], s.dirs[i]
+	s.metas[i], s.metas[j] = s.metas[j], s.metas[i]
+}
+
+// compactedMeta returns meta of the block compacted from the given blocks, like Prometheus compactor creates it.
+func compactedMeta(uid ulid.ULID, metas []*metadata.Meta) *metadata.Meta {
+	res := &metadata.Meta{BlockMeta: tsdb.BlockMeta{
+		ULID:    uid,
+		MinTime: math.MaxInt64,
+		MaxTime: math.MinInt64,
+		Version: metadata.MetaVersion1,
+	}}
+	sources := map[ulid.ULID]struct{}{}
+	for _, m := range metas {
+		if m.MinTime < res.MinTime {
+			res.MinTime = m.MinTime
+		}
+		if m.MaxTime > res.MaxTime {
+			res.MaxTime = m.MaxTime
+		}
+		if m.Compaction.Level > res.Compaction.Level {
+			res.Compaction.Level = m.Compaction.Level
+		}
+		for _, s := range m.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+		res.Compaction.Parents = append(res.Compaction.Parents, tsdb.BlockDesc{
+			ULID:    m.ULID,
+			MinTime: m.MinTime,
+			MaxTime: m.MaxTime,
+		})
+	}
+	res.Compaction.Level++
+
+	for s := range sources {
+		res.Compaction.Sources = append(res.Compaction.Sources, s)
+	}
+	sort.Slice(res.Compaction.Sources, func(i, j int) bool {
+		return res.Compaction.Sources[i].Compare(res.Compaction.Sources[j]) < 0
+	})
+	return res
+}
+
+// writeDedupBlock writes series of all blocks into dir, deduplicating series with the same labels using the given
+// algorithm. Stats of the written block are set in meta.
+func writeDedupBlock(dir string, blocks []*tsdb.Block, meta *metadata.Meta, f string) (err error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return errors.Wrap(err, "create block dir")
+	}
+
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, block.ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "open chunk writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkw, "close chunk writer")
+
+	indexw, err := index.NewWriter(context.Background(), filepath.Join(dir, block.IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexw, "close index writer")
+
+	symbols, err := mergedSymbols(blocks)
+	if err != nil {
+		return err
+	}
+	for _, s := range symbols {
+		if err := indexw.AddSymbol(s); err != nil {
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+
+	sets := make([]tsdb.SeriesSet, 0, len(blocks))
+	for _, b := range blocks {
+		q, qerr := tsdb.NewBlockQuerier(b, math.MinInt64, math.MaxInt64)
+		if qerr != nil {
+			return errors.Wrapf(qerr, "create querier for block %s", b.Meta().ULID)
+		}
+		defer runutil.CloseWithErrCapture(&err, q, "close querier")
+
+		set, err := q.Select(labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*"))
+		if err != nil {
+			return errors.Wrapf(err, "select series of block %s", b.Meta().ULID)
+		}
+		sets = append(sets, set)
+	}
+
+	var ref uint64
+	set := newReplicaSeriesSet(sets)
+	for set.Next() {
+		lset, replicas := set.At()
+		var it storage.SeriesIterator
+		if f == DedupFuncLastWriteWins {
+			it = newLastWriteWinsIterator(replicas)
+		} else {
+			it = dedup.NewSeries(lset, false, replicas...).Iterator()
+		}
+		chks, err := encodeChunks(it)
+		if err != nil {
+			return errors.Wrapf(err, "deduplicate series %s", lset)
+		}
+		if len(chks) == 0 {
+			continue
+		}
+
+		if err := chunkw.WriteChunks(chks...); err != nil {
+			return errors.Wrap(err, "write chunks")
+		}
+		if err := indexw.AddSeries(ref, lset, chks...); err != nil {
+			return errors.Wrap(err, "add series")
+		}
+		ref++
+
+		meta.Stats.NumSeries++
+		meta.Stats.NumChunks += uint64(len(chks))
+		for _, c := range chks {
+			meta.Stats.NumSamples += uint64(c.Chunk.NumSamples())
+		}
+	}
+	return set.Err()
+}
+
+// mergedSymbols returns sorted symbols of all blocks.
+func mergedSymbols(blocks []*tsdb.Block) (_ []string, err error) {
+	uniq := map[string]struct{}{}
+	for _, b := range blocks {
+		ir, ierr := b.Index()
+		if ierr != nil {
+			return nil, errors.Wrapf(ierr, "open index of block %s", b.Meta().ULID)
+		}
+		defer runutil.CloseWithErrCapture(&err, ir, "close index reader")
+
+		it := ir.Symbols()
+		for it.Next() {
+			uniq[it.At()] = struct{}{}
+		}
+		if err := it.Err(); err != nil {
+			return nil, errors.Wrapf(err, "read symbols of block %s", b.Meta().ULID)
+		}
+	}
+
+	res := make([]string, 0, len(uniq))
+	for s := range uniq {
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// encodeChunks encodes samples of the given iterator into XOR chunks.
+func encodeChunks(it storage.SeriesIterator) ([]chunks.Meta, error) {
+	var (
+		chks []chunks.Meta
+		app  chunkenc.Appender
+	)
+	for it.Next() {
+		t, v := it.At()
+		if len(chks) == 0 || chks[len(chks)-1].Chunk.NumSamples() >= samplesPerChunk {
+			c := chunkenc.NewXORChunk()
+			a, err := c.Appender()
+			if err != nil {
+				return nil, errors.Wrap(err, "create appender")
+			}
+			app = a
+			chks = append(chks, chunks.Meta{MinTime: t, Chunk: c})
+		}
+		app.Append(t, v)
+		chks[len(chks)-1].MaxTime = t
+	}
+	return chks, it.Err()
+}
+
+func syncDir(dir string) (err error) {
+	df, err := fileutil.OpenDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "open block dir")
+	}
+	defer runutil.CloseWithErrCapture(&err, df, "close block dir")
+
+	return errors.Wrap(fileutil.Fdatasync(df), "sync block dir")
+}
+
+// lastWriteWinsIterator merges samples of replicas in time order. Of samples with the same timestamp, the one of the
+// last replica is used.
+type lastWriteWinsIterator struct {
+	its []storage.SeriesIterator
+	oks []bool
+
+	valid bool
+	t     int64
+	v     float64
+}
+
+func newLastWriteWinsIterator(replicas []storage.Series) *lastWriteWinsIterator {
+	it := &lastWriteWinsIterator{
+		its: make([]storage.SeriesIterator, 0, len(replicas)),
+		oks: make([]bool, 0, len(replicas)),
+	}
+	for _, r := range replicas {
+		ri := r.Iterator()
+		it.its = append(it.its, ri)
+		it.oks = append(it.oks, ri.Next())
+	}
+	return it
+}
+
+func (it *lastWriteWinsIterator) Next() bool {
+	it.valid = false
+	for i, ri := range it.its {
+		if !it.oks[i] {
+			continue
+		}
+		if t, _ := ri.At(); !it.valid || t < it.t {
+			it.t = t
+			it.valid = true
+		}
+	}
+	if !it.valid {
+		return false
+	}
+	for i, ri := range it.its {
+		if !it.oks[i] {
+			continue
+		}
+		if t, v := ri.At(); t == it.t {
+			it.v = v
+			it.oks[i] = ri.Next()
+		}
+	}
+	return true
+}
+
+func (it *lastWriteWinsIterator) Seek(t int64) bool {
+	if it.valid && it.t >= t {
+		return true
+	}
+	for i, ri := range it.its {
+		if it.oks[i] {
+			it.oks[i] = ri.Seek(t)
+		}
+	}
+	return it.Next()
+}
+
+func (it *lastWriteWinsIterator) At() (int64, float64) {
+	return it.t, it.v
+}
+
+func (it *lastWriteWinsIterator) Err() error {
+	for _, ri := range it.its {
+		if err := ri.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicaSeries adapts tsdb.Series to storage.Series.
+type replicaSeries struct {
+	tsdb.Series
+}
+
+func (s replicaSeries) Iterator() storage.SeriesIterator {
+	return s.Series.Iterator()
+}
+
+// replicaSeriesSet merges sorted series sets, grouping series with the same labels, i.e. replicas of the same series.
+type replicaSeriesSet struct {
+	sets []tsdb.SeriesSet
+	oks  []bool
+
+	lset     labels.Labels
+	replicas []storage.Series
+}
+
+func newReplicaSeriesSet(sets []tsdb.SeriesSet) *replicaSeriesSet {
+	oks := make([]bool, len(sets))
+	for i, s := range sets {
+		oks[i] = s.Next()
+	}
+	return &replicaSeriesSet{sets: sets, oks: oks}
+}
+
+func (s *replicaSeriesSet) Next() bool {
+	s.lset, s.replicas = nil, s.replicas[:0]
+	for i, set := range s.sets {
+		if !s.oks[i] {
+			continue
+		}
+		if s.lset == nil || labels.Compare(set.At().Labels(), s.lset) < 0 {
+			s.lset = set.At().Labels()
+		}
+	}
+	if s.lset == nil {
+		return false
+	}
+
+	for i, set := range s.sets {
+		if !s.oks[i] || !labels.Equal(set.At().Labels(), s.lset) {
+			continue
+		}
+		s.replicas = append(s.replicas, replicaSeries{Series: set.At()})
+		s.oks[i] = set.Next()
+	}
+	return true
+}
+
+func (s *replicaSeriesSet) At() (labels.Labels, []storage.Series) {
+	return s.lset, s.replicas
+}
+
+func (s *replicaSeriesSet) Err() error {
+	for _, set := range s.sets {
+		if err := set.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestDedupCompactor_Penalty(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "penalty-dedup-compactor")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+	}
+	extLset := labels.FromStrings("ext", "1")
+
+	// Replicas scraping the same series with 100ms step, shifted by 50ms. Second replica has one more series.
+	replicaA, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 10100, extLset, 0)
+	testutil.Ok(t, err)
+	replicaB, err := e2eutil.CreateBlock(ctx, dir, append(series, labels.FromStrings("a", "3")), 100, 50, 10150, extLset, 0)
+	testutil.Ok(t, err)
+	later, err := e2eutil.CreateBlock(ctx, dir, series, 100, 10200, 20300, extLset, 0)
+	testutil.Ok(t, err)
+
+	leveled, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{10200, 40800}, nil)
+	testutil.Ok(t, err)
+	comp := NewDedupCompactor(logger, leveled, DedupFuncPenalty, nil)
+
+	id, err := comp.Compact(dir, []string{filepath.Join(dir, replicaA.String()), filepath.Join(dir, replicaB.String())}, nil)
+	testutil.Ok(t, err)
+
+	meta, err := metadata.Read(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), meta.MinTime)
+	testutil.Equals(t, int64(10150), meta.MaxTime)
+	testutil.Equals(t, 2, meta.Compaction.Level)
+	testutil.Equals(t, 2, len(meta.Compaction.Parents))
+	testutil.Equals(t, uint64(3), meta.Stats.NumSeries)
+	// Samples of the first replica are used for shared series, instead of doubling the sampling frequency.
+	testutil.Equals(t, uint64(3*100), meta.Stats.NumSamples)
+
+	b, err := tsdb.OpenBlock(logger, filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	smpls, err := selectSamples(b, series[0], []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")})
+	testutil.Ok(t, err)
+	testutil.Ok(t, b.Close())
+	testutil.Equals(t, 100, len(smpls))
+	for i, s := range smpls {
+		testutil.Equals(t, int64(i*100), s.t)
+	}
+
+	// Not overlapping blocks are compacted by the wrapped compactor.
+	id, err = comp.Compact(dir, []string{filepath.Join(dir, replicaA.String()), filepath.Join(dir, later.String())}, nil)
+	testutil.Ok(t, err)
+	testutil.Ok(t, verifyCompaction(logger, []string{filepath.Join(dir, replicaA.String()), filepath.Join(dir, later.String())}, filepath.Join(dir, id.String()), 10))
+}
+
+func TestDedupCompactor_LastWriteWins(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "last-write-wins-dedup-compactor")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+	}
+
+	// Backfilled block replacing samples of an older block with exactly the same timestamps.
+	older, err := e2eutil.CreateBlockWithBlockDelay(ctx, dir, series, 100, 0, 10100, time.Hour, labels.FromStrings("ext", "1", "backfill", "0"), 0)
+	testutil.Ok(t, err)
+	newer, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 10100, labels.FromStrings("ext", "1", "backfill", "1"), 0)
+	testutil.Ok(t, err)
+	dirs := []string{filepath.Join(dir, newer.String()), filepath.Join(dir, older.String())}
+
+	leveled, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{10200, 40800}, nil)
+	testutil.Ok(t, err)
+	comp := NewDedupCompactor(logger, leveled, DedupFuncPenalty, []*DedupRule{
+		{ReplicaLabels: []string{"prometheus_replica"}, Func: DedupFuncExact},
+		{ReplicaLabels: []string{"receive_replica", "backfill"}, Func: DedupFuncLastWriteWins},
+	})
+
+	f, err := comp.Func(dirs)
+	testutil.Ok(t, err)
+	testutil.Equals(t, DedupFuncLastWriteWins, f)
+
+	id, err := comp.Compact(dir, dirs, nil)
+	testutil.Ok(t, err)
+
+	meta, err := metadata.Read(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint64(2), meta.Stats.NumSeries)
+	testutil.Equals(t, uint64(2*100), meta.Stats.NumSamples)
+
+	b, err := tsdb.OpenBlock(logger, filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	nb, err := tsdb.OpenBlock(logger, filepath.Join(dir, newer.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, nb.Close()) }()
+
+	for _, lset := range series {
+		matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", lset.Get("a"))}
+		exp, err := selectSamples(nb, lset, matchers)
+		testutil.Ok(t, err)
+		smpls, err := selectSamples(b, lset, matchers)
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp, smpls)
+	}
+}
+
+func TestParseDedupRules(t *testing.T) {
+	rules, err := ParseDedupRules(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(rules))
+
+	rules, err = ParseDedupRules([]byte(`
+- replica_labels: ["prometheus_replica"]
+  func: penalty
+- replica_labels: ["receive_replica", "rule_replica"]
+  func: exact
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*DedupRule{
+		{ReplicaLabels: []string{"prometheus_replica"}, Func: DedupFuncPenalty},
+		{ReplicaLabels: []string{"receive_replica", "rule_replica"}, Func: DedupFuncExact},
+	}, rules)
+
+	_, err = ParseDedupRules([]byte(`- func: penalty`))
+	testutil.NotOk(t, err)
+	_, err = ParseDedupRules([]byte(`- replica_labels: ["replica"]
+  func: unknown`))
+	testutil.NotOk(t, err)
+	_, err = ParseDedupRules([]byte(`- replica_labels: ["replica"]
+  algorithm: penalty`))
+	testutil.NotOk(t, err)
+}
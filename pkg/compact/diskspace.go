@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrInsufficientDiskSpace is returned when the free disk space is not enough for a reservation, even with no other
+// space reserved.
+var ErrInsufficientDiskSpace = errors.New("insufficient free disk space")
+
+// DiskSpaceLimiter accounts the local disk space used by group compactions running concurrently.
+// Every compaction reserves the space it needs before downloading its blocks and waits until enough
+// space is released by other compactions, if the limit or the free disk space would be exceeded otherwise.
+type DiskSpaceLimiter struct {
+	limit     int64
+	freeSpace func() (int64, error)
+
+	mtx      sync.Mutex
+	reserved int64
+	// released is closed and replaced on every release to wake up the waiting reservations.
+	released chan struct{}
+
+	reservedBytes prometheus.Gauge
+	waiting       prometheus.Gauge
+	insufficient  prometheus.Counter
+}
+
+// NewDiskSpaceLimiter returns a new DiskSpaceLimiter allowing to reserve up to limit bytes in total.
+// Limit equal to 0 means no limit, the reserved space is still tracked.
+// If dir is not empty, reservations are also limited by the free disk space of its filesystem.
+func NewDiskSpaceLimiter(reg prometheus.Registerer, limit int64, dir string) *DiskSpaceLimiter {
+	l := &DiskSpaceLimiter{
+		limit:     limit,
+		freeSpace: func() (int64, error) { return -1, nil },
+		released:  make(chan struct{}),
+		reservedBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_compact_disk_space_reserved_bytes",
+			Help: "Local disk space in bytes reserved by the group compactions in progress.",
+		}),
+		waiting: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_compact_disk_space_waiting_compactions",
+			Help: "Number of group compactions waiting for local disk space to be released.",
+		}),
+		insufficient: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_compact_disk_space_insufficient_total",
+			Help: "Total number of reservations refused because of insufficient free disk space.",
+		}),
+	}
+	if dir != "" {
+		l.freeSpace = func() (int64, error) { return FreeDiskSpace(dir) }
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_compact_disk_space_limit_bytes",
+		Help: "Limit of the local disk space in bytes reserved by the group compactions in progress. 0 means no limit.",
+	}, func() float64 { return float64(limit) })
+	return l
+}
+
+// Reserve blocks until the given number of bytes can be reserved or the context is canceled.
+// Reservation bigger than the limit is granted once no other space is reserved, so it never waits forever.
+// Reservation bigger than the free disk space waits for other reservations to be released, as their space might not
+// be used yet, and fails with ErrInsufficientDiskSpace once no other space is reserved.
+// The returned function releases the reserved space and has to be called once the space is not used anymore.
+// Reserve on nil DiskSpaceLimiter returns immediately.
+func (l *DiskSpaceLimiter) Reserve(ctx context.Context, bytes int64) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	waiting := false
+	defer func() {
+		if waiting {
+			l.waiting.Dec()
+		}
+	}()
+	for {
+		free, err := l.freeSpace()
+		if err != nil {
+			return nil, errors.Wrap(err, "get free disk space")
+		}
+
+		l.mtx.Lock()
+		// Free disk space does not include space reserved, but not used yet by other reservations.
+		fitsFree := free < 0 || l.reserved+bytes <= free
+		if !fitsFree && l.reserved == 0 {
+			l.mtx.Unlock()
+			l.insufficient.Inc()
+			return nil, errors.Wrapf(ErrInsufficientDiskSpace, "requested %d bytes, free %d bytes", bytes, free)
+		}
+		if fitsFree && (l.limit <= 0 || l.reserved == 0 || l.reserved+bytes <= l.limit) {
+			l.reserved += bytes
+			l.reservedBytes.Set(float64(l.reserved))
+			l.mtx.Unlock()
+			return func() { l.release(bytes) }, nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		if !waiting {
+			waiting = true
+			l.waiting.Inc()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (l *DiskSpaceLimiter) release(bytes int64) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.reserved -= bytes
+	l.reservedBytes.Set(float64(l.reserved))
+	close(l.released)
+	l.released = make(chan struct{})
+}
@@ -0,0 +1,96 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestDiskSpaceLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewDiskSpaceLimiter(prometheus.NewRegistry(), 100, "")
+
+	release1, err := l.Reserve(ctx, 60)
+	testutil.Ok(t, err)
+	release2, err := l.Reserve(ctx, 40)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 100.0, promtest.ToFloat64(l.reservedBytes))
+
+	// Limit exceeded, reservation waits until the context is canceled.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Reserve(cctx, 1)
+	testutil.NotOk(t, err)
+
+	// Reservation proceeds once enough space is released.
+	reserved := make(chan error)
+	go func() {
+		release, err := l.Reserve(ctx, 50)
+		if err == nil {
+			release()
+		}
+		reserved <- err
+	}()
+	release2()
+	select {
+	case <-reserved:
+		t.Fatal("reservation should wait for more space to be released")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release1()
+	testutil.Ok(t, <-reserved)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(l.reservedBytes))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(l.waiting))
+
+	// Reservation bigger than the limit is granted if nothing else is reserved.
+	release, err := l.Reserve(ctx, 1000)
+	testutil.Ok(t, err)
+	release()
+
+	// Nil limiter does not limit anything.
+	var nl *DiskSpaceLimiter
+	release, err = nl.Reserve(ctx, 1000)
+	testutil.Ok(t, err)
+	release()
+}
+
+func TestDiskSpaceLimiter_FreeSpace(t *testing.T) {
+	ctx := context.Background()
+	l := NewDiskSpaceLimiter(prometheus.NewRegistry(), 0, "")
+	l.freeSpace = func() (int64, error) { return 100, nil }
+
+	// Reservation bigger than the free disk space fails if nothing else is reserved.
+	_, err := l.Reserve(ctx, 101)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, ErrInsufficientDiskSpace, errors.Cause(err))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(l.insufficient))
+
+	release, err := l.Reserve(ctx, 60)
+	testutil.Ok(t, err)
+
+	// Reservation exceeding the free disk space together with others waits until they are released.
+	reserved := make(chan error)
+	go func() {
+		release, err := l.Reserve(ctx, 50)
+		if err == nil {
+			release()
+		}
+		reserved <- err
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("reservation should wait for space to be released")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	testutil.Ok(t, <-reserved)
+	testutil.Equals(t, 0.0, promtest.ToFloat64(l.reservedBytes))
+}
@@ -20,11 +20,15 @@ type AggrChunk []byte
 
 // EncodeAggrChunk encodes a new aggregate chunk from the array of chunks for each aggregate.
 // Each array entry corresponds to the respective AggrType number.
-func EncodeAggrChunk(chks [5]chunkenc.Chunk) *AggrChunk {
+func EncodeAggrChunk(chks [6]chunkenc.Chunk) *AggrChunk {
 	var b []byte
 	buf := [8]byte{}
 
-	for _, c := range chks {
+	for i, c := range chks {
+		// Sketches are optional and left out entirely if unset, so the chunk stays readable by older versions.
+		if c == nil && AggrType(i) == AggrSketch {
+			break
+		}
 		// Unset aggregates are marked with a zero length entry.
 		if c == nil {
 			n := binary.PutUvarint(buf[:], 0)
@@ -74,6 +78,10 @@ func (c AggrChunk) Get(t AggrType) (chunkenc.Chunk, error) {
 	var x []byte
 
 	for i := AggrType(0); i <= t; i++ {
+		// Aggregates added later on may be missing at the end of chunks written before.
+		if len(b) == 0 {
+			return nil, ErrAggrNotExist
+		}
 		l, n := binary.Uvarint(b)
 		if n < 1 || len(b[n:]) < int(l)+1 {
 			return nil, errors.New("invalid size")
@@ -89,6 +97,9 @@ func (c AggrChunk) Get(t AggrType) (chunkenc.Chunk, error) {
 		x = b[:int(l)+1]
 		b = b[int(l)+1:]
 	}
+	if chunkenc.Encoding(x[0]) == ChunkEncSketch {
+		return SketchChunkFromData(x[1:])
+	}
 	return chunkenc.FromData(chunkenc.Encoding(x[0]), x[1:])
 }
 
@@ -102,6 +113,7 @@ const (
 	AggrMin
 	AggrMax
 	AggrCounter
+	AggrSketch
 )
 
 func (t AggrType) String() string {
@@ -116,6 +128,8 @@ func (t AggrType) String() string {
 		return "max"
 	case AggrCounter:
 		return "counter"
+	case AggrSketch:
+		return "sketch"
 	}
 	return "<unknown>"
 }
@@ -23,7 +23,7 @@ func TestAggrChunk(t *testing.T) {
 	// Maximum is absent.
 	input[AggrCounter] = []sample{{100, 5}, {200, 10}, {300, 10.1}, {400, 15}, {400, 3}}
 
-	var chks [5]chunkenc.Chunk
+	var chks [6]chunkenc.Chunk
 
 	for i, smpls := range input {
 		if len(smpls) == 0 {
@@ -0,0 +1,307 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	tsdberrors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// CheckpointFilename is the name of the file recording progress of a checkpointed downsampling.
+const CheckpointFilename = "checkpoint.json"
+
+// checkpoint records the progress of a checkpointed downsampling. Series of the source block are downsampled
+// in postings order into parts of SeriesPerPart series, every part is written as a separate block.
+type checkpoint struct {
+	Source        ulid.ULID `json:"source"`
+	Resolution    int64     `json:"resolution"`
+	Sketches      bool      `json:"sketches"`
+	SeriesPerPart int       `json:"series_per_part"`
+	// Parts is the number of completed parts.
+	Parts int `json:"parts"`
+}
+
+// matches returns true if both checkpoints are of the same downsampling.
+func (c *checkpoint) matches(o *checkpoint) bool {
+	return c.Source == o.Source && c.Resolution == o.Resolution && c.Sketches == o.Sketches && c.SeriesPerPart == o.SeriesPerPart
+}
+
+func readCheckpoint(dir string) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, CheckpointFilename))
+	if err != nil {
+		return nil, err
+	}
+	c := &checkpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal checkpoint")
+	}
+	return c, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file in dir.
+func writeCheckpoint(dir string, c *checkpoint) (err error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal checkpoint")
+	}
+	path := filepath.Join(dir, CheckpointFilename)
+	if err := ioutil.WriteFile(path+".tmp", b, 0666); err != nil {
+		return errors.Wrap(err, "write checkpoint")
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.Wrap(err, "rename checkpoint")
+	}
+	df, err := fileutil.OpenDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "open checkpoint dir")
+	}
+	defer runutil.CloseWithErrCapture(&err, df, "close checkpoint dir")
+	return errors.Wrap(fileutil.Fdatasync(df), "sync checkpoint dir")
+}
+
+func partDir(dir string, part int) string {
+	return filepath.Join(dir, fmt.Sprintf("part-%06d", part))
+}
+
+// DownsampleCheckpointed downsamples the given block like Downsample does, but checkpoints its progress into
+// checkpointDir every seriesPerPart series. If checkpointDir contains a checkpoint of the same downsampling, e.g. after
+// a crash, series of the completed parts are not downsampled again. The checkpoint is kept after the new block is
+// written, the caller is responsible for removing checkpointDir once the block is uploaded.
+func DownsampleCheckpointed(
+	logger log.Logger,
+	origMeta *metadata.Meta,
+	b tsdb.BlockReader,
+	dir string,
+	resolution int64,
+	sketches bool,
+	checkpointDir string,
+	seriesPerPart int,
+) (id ulid.ULID, err error) {
+	if origMeta.Thanos.Downsample.Resolution >= resolution {
+		return id, errors.New("target resolution not lower than existing one")
+	}
+	if seriesPerPart <= 0 {
+		return id, errors.Errorf("series per checkpoint has to be positive, got %d", seriesPerPart)
+	}
+
+	cp := &checkpoint{Source: origMeta.ULID, Resolution: resolution, Sketches: sketches, SeriesPerPart: seriesPerPart}
+	if prev, err := readCheckpoint(checkpointDir); err == nil && prev.matches(cp) {
+		cp.Parts = prev.Parts
+		level.Info(logger).Log("msg", "resuming downsampling from checkpoint", "block", origMeta.ULID, "resolution", resolution,
+			"completed_parts", cp.Parts, "series_per_part", seriesPerPart)
+	} else {
+		if err != nil && !os.IsNotExist(err) {
+			level.Warn(logger).Log("msg", "ignoring unreadable downsampling checkpoint", "dir", checkpointDir, "err", err)
+		}
+		if err := os.RemoveAll(checkpointDir); err != nil {
+			return id, errors.Wrap(err, "remove previous checkpoint")
+		}
+		if err := os.MkdirAll(checkpointDir, 0777); err != nil {
+			return id, errors.Wrap(err, "create checkpoint dir")
+		}
+		if err := writeCheckpoint(checkpointDir, cp); err != nil {
+			return id, err
+		}
+	}
+
+	indexr, err := b.Index()
+	if err != nil {
+		return id, errors.Wrap(err, "open index reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexr, "downsample index reader")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return id, errors.Wrap(err, "open chunk reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkr, "downsample chunk reader")
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return id, errors.Wrap(err, "get all postings list")
+	}
+
+	// Series of completed parts are skipped, a part that was being written during a crash is written again.
+	for i := 0; i < cp.Parts*seriesPerPart; i++ {
+		if !postings.Next() {
+			return id, errors.Errorf("checkpoint has %d parts of %d series, but block has only %d series", cp.Parts, seriesPerPart, i)
+		}
+	}
+	if err := os.RemoveAll(partDir(checkpointDir, cp.Parts)); err != nil {
+		return id, errors.Wrap(err, "remove incomplete part")
+	}
+
+	sd := newSeriesDownsampler(origMeta, indexr, chunkr, resolution, sketches)
+	for more := postings.Next(); more; {
+		pdir := partDir(checkpointDir, cp.Parts)
+		if more, err = writePart(origMeta, indexr, sd, postings, pdir, resolution, seriesPerPart); err != nil {
+			return id, errors.Wrapf(err, "write part %d", cp.Parts)
+		}
+		cp.Parts++
+		if err := writeCheckpoint(checkpointDir, cp); err != nil {
+			return id, err
+		}
+		level.Debug(logger).Log("msg", "checkpointed downsampling", "block", origMeta.ULID, "completed_parts", cp.Parts)
+	}
+	if postings.Err() != nil {
+		return id, errors.Wrap(postings.Err(), "iterate series set")
+	}
+
+	return mergeParts(logger, origMeta, indexr, dir, resolution, checkpointDir, cp.Parts)
+}
+
+// writePart downsamples up to seriesPerPart series starting at the current position of postings into a new block in
+// pdir. It returns whether postings have more series.
+func writePart(
+	origMeta *metadata.Meta,
+	indexr tsdb.IndexReader,
+	sd *seriesDownsampler,
+	postings index.Postings,
+	pdir string,
+	resolution int64,
+	seriesPerPart int,
+) (more bool, err error) {
+	if err := os.MkdirAll(pdir, 0777); err != nil {
+		return false, errors.Wrap(err, "mkdir part dir")
+	}
+	defer func() {
+		if err != nil {
+			var merr tsdberrors.MultiError
+			merr.Add(err)
+			merr.Add(os.RemoveAll(pdir))
+			err = merr.Err()
+		}
+	}()
+
+	meta := *origMeta
+	meta.Thanos.Downsample.Resolution = resolution
+	meta.Thanos.Files = nil
+	meta.ULID = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	// Parts are not logged when finalized, only the merged block is.
+	w, err := NewStreamedBlockWriter(pdir, indexr, log.NewNopLogger(), meta)
+	if err != nil {
+		return false, errors.Wrap(err, "get streamed block writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, w, "close part block writer")
+
+	more = true
+	for n := 0; more && n < seriesPerPart; n, more = n+1, postings.Next() {
+		lset, downsampledChunks, err := sd.downsample(postings.At())
+		if err != nil {
+			return false, err
+		}
+		if err := w.WriteSeries(lset, downsampledChunks); err != nil {
+			return false, errors.Wrapf(err, "write series: %d", postings.At())
+		}
+	}
+	return more, nil
+}
+
+// mergeParts writes series of all parts into a new block in dir. Parts contain disjoint ranges of series in postings
+// order, so they are copied one after another.
+func mergeParts(logger log.Logger, origMeta *metadata.Meta, indexr tsdb.IndexReader, dir string, resolution int64, checkpointDir string, parts int) (id ulid.ULID, err error) {
+	uid := ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	blockDir := filepath.Join(dir, uid.String())
+	if err := os.MkdirAll(blockDir, 0777); err != nil {
+		return id, errors.Wrap(err, "mkdir block dir")
+	}
+	defer func() {
+		if err != nil {
+			var merr tsdberrors.MultiError
+			merr.Add(err)
+			merr.Add(os.RemoveAll(blockDir))
+			err = merr.Err()
+		}
+	}()
+
+	newMeta := *origMeta
+	newMeta.Thanos.Downsample.Resolution = resolution
+	newMeta.Thanos.Files = nil
+	newMeta.Thanos.Lineage = metadata.NewLineage(metadata.LineageDownsampling, metadata.CompactorSource, []*metadata.Meta{origMeta})
+	newMeta.ULID = uid
+
+	w, err := NewStreamedBlockWriter(blockDir, indexr, logger, newMeta)
+	if err != nil {
+		return id, errors.Wrap(err, "get streamed block writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, w, "close stream block writer")
+
+	for i := 0; i < parts; i++ {
+		if err := copyPart(logger, partDir(checkpointDir, i), w); err != nil {
+			return id, errors.Wrapf(err, "copy part %d", i)
+		}
+	}
+
+	id = uid
+	return
+}
+
+// copyPart writes all series of the block in pdir into w.
+func copyPart(logger log.Logger, pdir string, w *streamedBlockWriter) (err error) {
+	b, err := tsdb.OpenBlock(logger, pdir, NewPool())
+	if err != nil {
+		return errors.Wrap(err, "open part block")
+	}
+	defer runutil.CloseWithErrCapture(&err, b, "part block")
+
+	indexr, err := b.Index()
+	if err != nil {
+		return errors.Wrap(err, "open index reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexr, "part index reader")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return errors.Wrap(err, "open chunk reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkr, "part chunk reader")
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "get all postings list")
+	}
+
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for postings.Next() {
+		lset = lset[:0]
+		chks = chks[:0]
+		if err := indexr.Series(postings.At(), &lset, &chks); err != nil {
+			return errors.Wrapf(err, "get series %d", postings.At())
+		}
+		for i, c := range chks {
+			chk, err := chunkr.Chunk(c.Ref)
+			if err != nil {
+				return errors.Wrapf(err, "get chunk %d, series %d", c.Ref, postings.At())
+			}
+			chks[i].Chunk = chk
+		}
+		if err := w.WriteSeries(lset, chks); err != nil {
+			return errors.Wrapf(err, "write series: %d", postings.At())
+		}
+	}
+	return errors.Wrap(postings.Err(), "iterate series set")
+}
@@ -0,0 +1,124 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestDownsampleCheckpointed(t *testing.T) {
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "downsample-checkpointed")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	mb := newMemBlock()
+	for i := 0; i < 5; i++ {
+		chk := chunkenc.NewXORChunk()
+		app, _ := chk.Appender()
+		for ts := int64(0); ts < 1000; ts += 10 {
+			app.Append(ts, float64(int64(i)*ts))
+		}
+		mb.addSeries(&series{
+			lset:   labels.FromStrings("__name__", "up", "a", fmt.Sprintf("%d", i)),
+			chunks: []chunks.Meta{{MinTime: 0, MaxTime: 990, Chunk: chk}},
+		})
+	}
+	meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: 0, MaxTime: 1000}}
+
+	id, err := Downsample(logger, meta, mb, dir, 100, false)
+	testutil.Ok(t, err)
+	exp := readSeriesChunks(t, filepath.Join(dir, id.String()))
+	testutil.Equals(t, 5, len(exp))
+
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	downsampleCheckpointed := func(seriesPerPart int) {
+		t.Helper()
+
+		id, err := DownsampleCheckpointed(logger, meta, mb, dir, 100, false, checkpointDir, seriesPerPart)
+		testutil.Ok(t, err)
+		bdir := filepath.Join(dir, id.String())
+		testutil.Equals(t, exp, readSeriesChunks(t, bdir))
+
+		m, err := metadata.Read(bdir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(100), m.Thanos.Downsample.Resolution)
+		testutil.Equals(t, uint64(5), m.Stats.NumSeries)
+		testutil.Ok(t, os.RemoveAll(bdir))
+	}
+
+	downsampleCheckpointed(2)
+	cp, err := readCheckpoint(checkpointDir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, cp.Parts)
+
+	// Simulate a crash while writing the second part. The first part is not written again.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(partDir(checkpointDir, 0), "marker"), nil, 0666))
+	testutil.Ok(t, os.RemoveAll(partDir(checkpointDir, 2)))
+	testutil.Ok(t, os.Remove(filepath.Join(partDir(checkpointDir, 1), block.IndexFilename)))
+	cp.Parts = 1
+	testutil.Ok(t, writeCheckpoint(checkpointDir, cp))
+
+	downsampleCheckpointed(2)
+	_, err = os.Stat(filepath.Join(partDir(checkpointDir, 0), "marker"))
+	testutil.Ok(t, err)
+	cp, err = readCheckpoint(checkpointDir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, cp.Parts)
+
+	// Checkpoint of a different downsampling is discarded.
+	downsampleCheckpointed(3)
+	_, err = os.Stat(filepath.Join(partDir(checkpointDir, 0), "marker"))
+	testutil.Assert(t, os.IsNotExist(err), "expected checkpoint to be discarded")
+	cp, err = readCheckpoint(checkpointDir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, cp.Parts)
+}
+
+// readSeriesChunks returns encoded chunks of all series of the block in bdir by their labels.
+func readSeriesChunks(t *testing.T, bdir string) map[string][][]byte {
+	t.Helper()
+
+	indexr, err := index.NewFileReader(filepath.Join(bdir, block.IndexFilename))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, indexr.Close()) }()
+
+	chunkr, err := chunks.NewDirReader(filepath.Join(bdir, block.ChunksDirname), NewPool())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, chunkr.Close()) }()
+
+	pall, err := indexr.Postings(index.AllPostingsKey())
+	testutil.Ok(t, err)
+
+	res := map[string][][]byte{}
+	for pall.Next() {
+		var lset labels.Labels
+		var chks []chunks.Meta
+		testutil.Ok(t, indexr.Series(pall.At(), &lset, &chks))
+
+		for _, c := range chks {
+			chk, err := chunkr.Chunk(c.Ref)
+			testutil.Ok(t, err)
+			res[lset.String()] = append(res[lset.String()], append([]byte(nil), chk.Bytes()...))
+		}
+	}
+	testutil.Ok(t, pall.Err())
+	return res
+}
@@ -4,15 +4,18 @@
 package downsample
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/tsdb"
@@ -37,13 +40,89 @@ const (
 	DownsampleRange1 = 10 * 24 * 60 * 60 * 1000 // 10 days.
 )
 
+// Level is a downsampling level. Blocks of the previous level, or raw blocks for the first level, are downsampled to
+// Resolution once they span at least MinBlockRange, so that roughly 2 chunks are produced for every series.
+type Level struct {
+	Resolution    int64 // In milliseconds.
+	MinBlockRange int64 // In milliseconds.
+}
+
+func (l Level) String() string {
+	return fmt.Sprintf("%s:%s", model.Duration(time.Duration(l.Resolution)*time.Millisecond), model.Duration(time.Duration(l.MinBlockRange)*time.Millisecond))
+}
+
+// DefaultLevels are the standard downsampling levels in Thanos.
+var DefaultLevels = []Level{
+	{Resolution: ResLevel1, MinBlockRange: DownsampleRange0},
+	{Resolution: ResLevel2, MinBlockRange: DownsampleRange1},
+}
+
+// ParseLevel parses a downsampling level in the <resolution>:<min block range> format, e.g. 5m:40h.
+func ParseLevel(s string) (Level, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Level{}, errors.Errorf("downsampling level %q is not in the <resolution>:<min block range> format", s)
+	}
+	res, err := model.ParseDuration(parts[0])
+	if err != nil {
+		return Level{}, errors.Wrapf(err, "parse resolution of downsampling level %q", s)
+	}
+	rng, err := model.ParseDuration(parts[1])
+	if err != nil {
+		return Level{}, errors.Wrapf(err, "parse min block range of downsampling level %q", s)
+	}
+	return Level{
+		Resolution:    int64(time.Duration(res) / time.Millisecond),
+		MinBlockRange: int64(time.Duration(rng) / time.Millisecond),
+	}, nil
+}
+
+// ValidateLevels checks that the resolutions of the given levels are increasing and every resolution is a multiple
+// of the previous one, so aggregation windows of the previous level are never split.
+func ValidateLevels(levels []Level) error {
+	if len(levels) == 0 {
+		return errors.New("no downsampling levels")
+	}
+	prev := int64(1)
+	for _, l := range levels {
+		if l.Resolution <= prev || l.Resolution%prev != 0 {
+			return errors.Errorf("resolution of downsampling level %s has to be bigger than and a multiple of the previous resolution %dms", l, prev)
+		}
+		if l.MinBlockRange <= 0 {
+			return errors.Errorf("min block range of downsampling level %s has to be positive", l)
+		}
+		prev = l.Resolution
+	}
+	return nil
+}
+
+// NextLevel returns the level blocks with the given resolution are downsampled to. It returns false if blocks with
+// the given resolution are not downsampled further.
+func NextLevel(levels []Level, resolution int64) (Level, bool) {
+	if len(levels) == 0 {
+		return Level{}, false
+	}
+	if resolution == ResLevel0 {
+		return levels[0], true
+	}
+	for i, l := range levels[:len(levels)-1] {
+		if l.Resolution == resolution {
+			return levels[i+1], true
+		}
+	}
+	return Level{}, false
+}
+
 // Downsample downsamples the given block. It writes a new block into dir and returns its ID.
+// If sketches is true, quantile sketches are computed for every window of raw data in addition to the
+// other aggregates. Sketches present in already downsampled blocks are always merged into the new block.
 func Downsample(
 	logger log.Logger,
 	origMeta *metadata.Meta,
 	b tsdb.BlockReader,
 	dir string,
 	resolution int64,
+	sketches bool,
 ) (id ulid.ULID, err error) {
 	if origMeta.Thanos.Downsample.Resolution >= resolution {
 		return id, errors.New("target resolution not lower than existing one")
@@ -81,8 +160,11 @@ func Downsample(
 	}()
 
 	// Copy original meta to the new one. Update downsampling resolution and ULID for a new block.
+	// File stats of the original block do not apply to the new one.
 	newMeta := *origMeta
 	newMeta.Thanos.Downsample.Resolution = resolution
+	newMeta.Thanos.Files = nil
+	newMeta.Thanos.Lineage = metadata.NewLineage(metadata.LineageDownsampling, metadata.CompactorSource, []*metadata.Meta{origMeta})
 	newMeta.ULID = uid
 
 	// Writes downsampled chunks right into the files, avoiding excess memory allocation.
@@ -98,63 +180,14 @@ func Downsample(
 		return id, errors.Wrap(err, "get all postings list")
 	}
 
-	var (
-		aggrChunks []*AggrChunk
-		all        []sample
-		chks       []chunks.Meta
-		lset       labels.Labels
-		reuseIt    chunkenc.Iterator
-	)
+	sd := newSeriesDownsampler(origMeta, indexr, chunkr, resolution, sketches)
 	for postings.Next() {
-		lset = lset[:0]
-		chks = chks[:0]
-		all = all[:0]
-		aggrChunks = aggrChunks[:0]
-
-		// Get series labels and chunks. Downsampled data is sensitive to chunk boundaries
-		// and we need to preserve them to properly downsample previously downsampled data.
-		if err := indexr.Series(postings.At(), &lset, &chks); err != nil {
-			return id, errors.Wrapf(err, "get series %d", postings.At())
-		}
-		// While #183 exists, we sanitize the chunks we retrieved from the block
-		// before retrieving their samples.
-		for i, c := range chks {
-			chk, err := chunkr.Chunk(c.Ref)
-			if err != nil {
-				return id, errors.Wrapf(err, "get chunk %d, series %d", c.Ref, postings.At())
-			}
-			chks[i].Chunk = chk
+		lset, downsampledChunks, err := sd.downsample(postings.At())
+		if err != nil {
+			return id, err
 		}
-
-		// Raw and already downsampled data need different processing.
-		if origMeta.Thanos.Downsample.Resolution == 0 {
-			for _, c := range chks {
-				if err := expandChunkIterator(c.Chunk.Iterator(reuseIt), &all); err != nil {
-					return id, errors.Wrapf(err, "expand chunk %d, series %d", c.Ref, postings.At())
-				}
-			}
-			if err := streamedBlockWriter.WriteSeries(lset, downsampleRaw(all, resolution)); err != nil {
-				return id, errors.Wrapf(err, "downsample raw data, series: %d", postings.At())
-			}
-		} else {
-			// Downsample a block that contains aggregated chunks already.
-			for _, c := range chks {
-				aggrChunks = append(aggrChunks, c.Chunk.(*AggrChunk))
-			}
-			downsampledChunks, err := downsampleAggr(
-				aggrChunks,
-				&all,
-				chks[0].MinTime,
-				chks[len(chks)-1].MaxTime,
-				origMeta.Thanos.Downsample.Resolution,
-				resolution,
-			)
-			if err != nil {
-				return id, errors.Wrapf(err, "downsample aggregate block, series: %d", postings.At())
-			}
-			if err := streamedBlockWriter.WriteSeries(lset, downsampledChunks); err != nil {
-				return id, errors.Wrapf(err, "write series: %d", postings.At())
-			}
+		if err := streamedBlockWriter.WriteSeries(lset, downsampledChunks); err != nil {
+			return id, errors.Wrapf(err, "write series: %d", postings.At())
 		}
 	}
 	if postings.Err() != nil {
@@ -165,6 +198,85 @@ func Downsample(
 	return
 }
 
+// seriesDownsampler downsamples series of a block one by one, reusing its buffers between series.
+type seriesDownsampler struct {
+	origMeta   *metadata.Meta
+	indexr     tsdb.IndexReader
+	chunkr     tsdb.ChunkReader
+	resolution int64
+	sketches   bool
+
+	aggrChunks []*AggrChunk
+	all        []sample
+	chks       []chunks.Meta
+	lset       labels.Labels
+}
+
+func newSeriesDownsampler(origMeta *metadata.Meta, indexr tsdb.IndexReader, chunkr tsdb.ChunkReader, resolution int64, sketches bool) *seriesDownsampler {
+	return &seriesDownsampler{
+		origMeta:   origMeta,
+		indexr:     indexr,
+		chunkr:     chunkr,
+		resolution: resolution,
+		sketches:   sketches,
+	}
+}
+
+// downsample returns labels and downsampled chunks of the series with the given reference. Returned labels
+// are only valid until the next call.
+func (sd *seriesDownsampler) downsample(ref uint64) (labels.Labels, []chunks.Meta, error) {
+	sd.lset = sd.lset[:0]
+	sd.chks = sd.chks[:0]
+	sd.all = sd.all[:0]
+	sd.aggrChunks = sd.aggrChunks[:0]
+
+	// Get series labels and chunks. Downsampled data is sensitive to chunk boundaries
+	// and we need to preserve them to properly downsample previously downsampled data.
+	if err := sd.indexr.Series(ref, &sd.lset, &sd.chks); err != nil {
+		return nil, nil, errors.Wrapf(err, "get series %d", ref)
+	}
+
+	// Raw and already downsampled data need different processing.
+	if sd.origMeta.Thanos.Downsample.Resolution == 0 {
+		// Raw chunks are read lazily batch by batch, so peak memory is bounded by the size of a single batch
+		// instead of all samples of the series.
+		downsampledChunks, err := downsampleRawStream(func() *rawSampleIterator {
+			return newRawSampleIterator(sd.chunkr, sd.chks)
+		}, &sd.all, sd.resolution, sd.sketches)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "downsample raw data, series: %d", ref)
+		}
+		return sd.lset, downsampledChunks, nil
+	}
+
+	// While #183 exists, we sanitize the chunks we retrieved from the block
+	// before retrieving their samples.
+	for i, c := range sd.chks {
+		chk, err := sd.chunkr.Chunk(c.Ref)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "get chunk %d, series %d", c.Ref, ref)
+		}
+		sd.chks[i].Chunk = chk
+	}
+
+	// Downsample a block that contains aggregated chunks already.
+	for _, c := range sd.chks {
+		sd.aggrChunks = append(sd.aggrChunks, c.Chunk.(*AggrChunk))
+	}
+	downsampledChunks, err := downsampleAggr(
+		sd.aggrChunks,
+		&sd.all,
+		sd.chks[0].MinTime,
+		sd.chks[len(sd.chks)-1].MaxTime,
+		sd.origMeta.Thanos.Downsample.Resolution,
+		sd.resolution,
+	)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "downsample aggregate block, series: %d", ref)
+	}
+	return sd.lset, downsampledChunks, nil
+}
+
 // currentWindow returns the end timestamp of the window that t falls into.
 func currentWindow(t, r int64) int64 {
 	// The next timestamp is the next number after s.t that's aligned with window.
@@ -210,6 +322,7 @@ type aggregator struct {
 	counter float64 // Total counter state since beginning.
 	resets  int     // Number of counter resets since beginning.
 	last    float64 // Last added value.
+	sketch  *Sketch // Quantile sketch of current window, if enabled.
 }
 
 // reset the stats to start a new aggregation window.
@@ -218,6 +331,9 @@ func (a *aggregator) reset() {
 	a.sum = 0
 	a.min = math.MaxFloat64
 	a.max = -math.MaxFloat64
+	if a.sketch != nil {
+		a.sketch.Reset()
+	}
 }
 
 func (a *aggregator) add(v float64) {
@@ -238,6 +354,9 @@ func (a *aggregator) add(v float64) {
 
 	a.sum += v
 	a.count++
+	if a.sketch != nil {
+		a.sketch.Add(v)
+	}
 	a.total++
 
 	if v < a.min {
@@ -253,11 +372,12 @@ type aggrChunkBuilder struct {
 	mint, maxt int64
 	added      int
 
-	chunks [5]chunkenc.Chunk
-	apps   [5]chunkenc.Appender
+	chunks   [6]chunkenc.Chunk
+	apps     [5]chunkenc.Appender
+	sketches *SketchChunk
 }
 
-func newAggrChunkBuilder() *aggrChunkBuilder {
+func newAggrChunkBuilder(sketches bool) *aggrChunkBuilder {
 	b := &aggrChunkBuilder{
 		mint: math.MaxInt64,
 		maxt: math.MinInt64,
@@ -273,6 +393,9 @@ func newAggrChunkBuilder() *aggrChunkBuilder {
 			b.apps[i], _ = c.Appender()
 		}
 	}
+	if sketches {
+		b.sketches = NewSketchChunk()
+	}
 	return b
 }
 
@@ -288,11 +411,17 @@ func (b *aggrChunkBuilder) add(t int64, aggr *aggregator) {
 	b.apps[AggrMax].Append(t, aggr.max)
 	b.apps[AggrCount].Append(t, float64(aggr.count))
 	b.apps[AggrCounter].Append(t, aggr.counter)
+	if b.sketches != nil && aggr.sketch != nil {
+		b.sketches.Add(t, aggr.sketch)
+	}
 
 	b.added++
 }
 
 func (b *aggrChunkBuilder) encode() chunks.Meta {
+	if b.sketches != nil && b.sketches.NumSamples() > 0 {
+		b.chunks[AggrSketch] = b.sketches
+	}
 	return chunks.Meta{
 		MinTime: b.mint,
 		MaxTime: b.maxt,
@@ -300,19 +429,6 @@ func (b *aggrChunkBuilder) encode() chunks.Meta {
 	}
 }
 
-// downsampleRaw create a series of aggregation chunks for the given sample data.
-func downsampleRaw(data []sample, resolution int64) []chunks.Meta {
-	if len(data) == 0 {
-		return nil
-	}
-
-	mint, maxt := data[0].t, data[len(data)-1].t
-	// We assume a raw resolution of 1 minute. In practice it will often be lower
-	// but this is sufficient for our heuristic to produce well-sized chunks.
-	numChunks := targetChunkCount(mint, maxt, 1*60*1000, resolution, len(data))
-	return downsampleRawLoop(data, resolution, numChunks)
-}
-
 func downsampleRawLoop(data []sample, resolution int64, numChunks int) []chunks.Meta {
 	batchSize := (len(data) / numChunks) + 1
 	chks := make([]chunks.Meta, 0, numChunks)
@@ -332,30 +448,172 @@ func downsampleRawLoop(data []sample, resolution int64, numChunks int) []chunks.
 		batch := data[:j]
 		data = data[j:]
 
-		ab := newAggrChunkBuilder()
+		chks = append(chks, downsampleRawBatch(batch, resolution, false))
+	}
+
+	return chks
+}
+
+// downsampleRawStream creates a series of aggregation chunks for the raw samples read from iterators returned by newIter,
+// without expanding all samples of the series at once. Samples are read twice: first to count them, then to aggregate
+// them batch by batch like downsampleRawLoop does. Only a single batch of samples is kept in buf at a time.
+func downsampleRawStream(newIter func() *rawSampleIterator, buf *[]sample, resolution int64, sketches bool) ([]chunks.Meta, error) {
+	var (
+		count      int
+		mint, maxt int64
+	)
+	it := newIter()
+	for it.Next() {
+		if count == 0 {
+			mint = it.At().t
+		}
+		maxt = it.At().t
+		count++
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	// We assume a raw resolution of 1 minute. In practice it will often be lower
+	// but this is sufficient for our heuristic to produce well-sized chunks.
+	numChunks := targetChunkCount(mint, maxt, 1*60*1000, resolution, count)
+	batchSize := (count / numChunks) + 1
+	chks := make([]chunks.Meta, 0, numChunks)
+
+	it = newIter()
+	ok := it.Next()
+	for ok {
+		batch := (*buf)[:0]
+		for ; ok && len(batch) < batchSize; ok = it.Next() {
+			batch = append(batch, it.At())
+		}
+		curW := currentWindow(batch[len(batch)-1].t, resolution)
+
+		// The batch we took might end in the middle of a downsampling window. We additionally grab
+		// all further samples in the window to keep our samples regular.
+		for ; ok && it.At().t <= curW; ok = it.Next() {
+			batch = append(batch, it.At())
+		}
+		*buf = batch
+
+		chks = append(chks, downsampleRawBatch(batch, resolution, sketches))
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	return chks, nil
+}
 
-		// Encode first raw value; see CounterSeriesIterator.
-		ab.apps[AggrCounter].Append(batch[0].t, batch[0].v)
+// downsampleRawBatch encodes a single aggregation chunk from the given batch of raw samples.
+func downsampleRawBatch(batch []sample, resolution int64, sketches bool) chunks.Meta {
+	ab := newAggrChunkBuilder(sketches)
 
-		lastT := downsampleBatch(batch, resolution, ab.add)
+	// Encode first raw value; see CounterSeriesIterator.
+	// Stale markers are skipped by CounterSeriesIterator, so the first and last values which are not stale
+	// are encoded. Otherwise counter resets at chunk boundaries are missed or reported where there are none.
+	first, last := nonStaleBounds(batch)
+	if first >= 0 {
+		ab.apps[AggrCounter].Append(batch[first].t, batch[first].v)
+	}
 
-		// Encode last raw value; see CounterSeriesIterator.
-		ab.apps[AggrCounter].Append(lastT, batch[len(batch)-1].v)
+	lastT := downsampleBatch(batch, resolution, sketches, ab.add)
 
-		chks = append(chks, ab.encode())
+	// Encode last raw value; see CounterSeriesIterator.
+	if last >= 0 {
+		ab.apps[AggrCounter].Append(lastT, batch[last].v)
 	}
 
-	return chks
+	return ab.encode()
+}
+
+// nonStaleBounds returns indexes of the first and last samples in data which are not stale markers, or -1 if
+// all samples are stale markers.
+func nonStaleBounds(data []sample) (first, last int) {
+	first, last = -1, -1
+	for i := range data {
+		if !value.IsStaleNaN(data[i].v) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return first, last
+}
+
+// rawSampleIterator iterates over the samples of the given raw chunks, reading every chunk only when its samples are needed.
+// Like expandChunkIterator, it skips stale markers and samples going back in time within a chunk.
+type rawSampleIterator struct {
+	chunkr tsdb.ChunkReader
+	chks   []chunks.Meta
+
+	it    chunkenc.Iterator
+	lastT int64
+	cur   sample
+	err   error
+}
+
+func newRawSampleIterator(chunkr tsdb.ChunkReader, chks []chunks.Meta) *rawSampleIterator {
+	return &rawSampleIterator{chunkr: chunkr, chks: chks}
+}
+
+// Next advances the iterator to the next sample and returns false if there are no more samples or an error happened.
+func (it *rawSampleIterator) Next() bool {
+	for {
+		if it.it != nil && it.it.Next() {
+			t, v := it.it.At()
+			if value.IsStaleNaN(v) || t < it.lastT {
+				continue
+			}
+			it.cur = sample{t, v}
+			it.lastT = t
+			return true
+		}
+		if it.it != nil {
+			if err := it.it.Err(); err != nil {
+				it.err = err
+				return false
+			}
+		}
+		if len(it.chks) == 0 {
+			return false
+		}
+
+		c, err := it.chunkr.Chunk(it.chks[0].Ref)
+		if err != nil {
+			it.err = errors.Wrapf(err, "get chunk %d", it.chks[0].Ref)
+			return false
+		}
+		it.it = c.Iterator(it.it)
+		it.lastT = 0
+		it.chks = it.chks[1:]
+	}
+}
+
+// At returns the current sample.
+func (it *rawSampleIterator) At() sample {
+	return it.cur
+}
+
+// Err returns the first error that happened during iteration.
+func (it *rawSampleIterator) Err() error {
+	return it.err
 }
 
 // downsampleBatch aggregates the data over the given resolution and calls add each time
-// the end of a resolution was reached.
-func downsampleBatch(data []sample, resolution int64, add func(int64, *aggregator)) int64 {
+// the end of a resolution was reached. If sketches is true, the aggregator also collects a quantile sketch.
+func downsampleBatch(data []sample, resolution int64, sketches bool, add func(int64, *aggregator)) int64 {
 	var (
 		aggr  aggregator
 		nextT = int64(-1)
 		lastT = data[len(data)-1].t
 	)
+	if sketches {
+		aggr.sketch = NewSketch()
+	}
 	// Fill up one aggregate chunk with up to m samples.
 	for _, s := range data {
 		if value.IsStaleNaN(s.v) {
@@ -466,7 +724,7 @@ func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (ch
 		ab.chunks[at] = chunkenc.NewXORChunk()
 		ab.apps[at], _ = ab.chunks[at].Appender()
 
-		downsampleBatch(*buf, resolution, func(t int64, a *aggregator) {
+		downsampleBatch(*buf, resolution, false, func(t int64, a *aggregator) {
 			if t < mint {
 				mint = t
 			} else if t > maxt {
@@ -499,6 +757,11 @@ func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (ch
 		return chk, err
 	}
 
+	// Sketches are merged into the windows of the target resolution instead of aggregating samples.
+	if ab.sketches, err = mergeSketches(chks, resolution); err != nil {
+		return chk, err
+	}
+
 	// Handle counters by reading them properly.
 	acs := make([]chunkenc.Iterator, 0, len(chks))
 	for _, achk := range chks {
@@ -527,7 +790,7 @@ func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (ch
 	// Retain first raw value; see CounterSeriesIterator.
 	ab.apps[AggrCounter].Append((*buf)[0].t, (*buf)[0].v)
 
-	lastT := downsampleBatch(*buf, resolution, func(t int64, a *aggregator) {
+	lastT := downsampleBatch(*buf, resolution, false, func(t int64, a *aggregator) {
 		if t < mint {
 			mint = t
 		} else if t > maxt {
@@ -544,6 +807,61 @@ func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (ch
 	return ab.encode(), nil
 }
 
+// mergeSketches merges the sketches of all windows of the given chunks that fall into the same window of the
+// given resolution. It returns nil if none of the chunks contains sketches.
+func mergeSketches(chks []*AggrChunk, resolution int64) (*SketchChunk, error) {
+	var (
+		res   *SketchChunk
+		aggr  = NewSketch()
+		nextT = int64(-1)
+		lastT = int64(-1)
+	)
+	for _, chk := range chks {
+		c, err := chk.Get(AggrSketch)
+		if err == ErrAggrNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sc, ok := c.(*SketchChunk)
+		if !ok {
+			return nil, errors.Errorf("unexpected encoding %d of sketch aggregate", c.Encoding())
+		}
+		if res == nil {
+			res = NewSketchChunk()
+		}
+		it := sc.Sketches()
+		for it.Next() {
+			t, s := it.At()
+			// For safety reasons, we skip windows going back in time like expandChunkIterator does.
+			if t <= lastT {
+				continue
+			}
+			if t > nextT {
+				if nextT != -1 {
+					res.Add(nextT, aggr)
+				}
+				aggr.Reset()
+				nextT = currentWindow(t, resolution)
+			}
+			aggr.Merge(s)
+			lastT = t
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if nextT == -1 {
+		return nil, nil
+	}
+	// Limit the last window to the batch like downsampleBatch does.
+	if nextT > lastT {
+		nextT = lastT
+	}
+	res.Add(nextT, aggr)
+	return res, nil
+}
+
 type sample struct {
 	t int64
 	v float64
@@ -561,10 +879,14 @@ type sample struct {
 // comparison between the last raw value of the earlier chunk and the first raw
 // value of the later chunk ensures that counter resets between chunks are
 // recognized and that the correct value delta is calculated.
+//
+// The special last sample is honored only within the chunk of the sample it follows. A sample of another, overlapping
+// chunk with the same timestamp is not a hint about the true last value and is skipped.
 type CounterSeriesIterator struct {
 	chks   []chunkenc.Iterator
 	i      int     // Current chunk.
 	total  int     // Total number of processed samples.
+	lastI  int     // Chunk of the last sample.
 	lastT  int64   // Timestamp of the last sample.
 	lastV  float64 // Value of the last sample.
 	totalV float64 // Total counter state since beginning of series.
@@ -594,7 +916,7 @@ func (it *CounterSeriesIterator) Next() bool {
 		// First sample sets the initial counter state.
 		if it.total == 0 {
 			it.total++
-			it.lastT, it.lastV = t, v
+			it.lastI, it.lastT, it.lastV = it.i, t, v
 			it.totalV = v
 			return true
 		}
@@ -605,13 +927,13 @@ func (it *CounterSeriesIterator) Next() bool {
 			} else {
 				it.totalV += v
 			}
-			it.lastT, it.lastV = t, v
+			it.lastI, it.lastT, it.lastV = it.i, t, v
 			it.total++
 			return true
 		}
 		// We hit a sample that indicates what the true last value was. For the
 		// next chunk we use it to determine whether there was a counter reset between them.
-		if t == it.lastT {
+		if t == it.lastT && it.i == it.lastI {
 			it.lastV = v
 		}
 		// Otherwise the series went back in time and we just keep moving forward.
@@ -145,6 +145,40 @@ func TestDownsampleCounterBoundaryReset(t *testing.T) {
 	doTest(t, &tests[0])
 }
 
+func TestLevels(t *testing.T) {
+	l, err := ParseLevel("30m:40h")
+	testutil.Ok(t, err)
+	testutil.Equals(t, Level{Resolution: 30 * 60 * 1000, MinBlockRange: 40 * 60 * 60 * 1000}, l)
+	l2, err := ParseLevel("6h:20d")
+	testutil.Ok(t, err)
+	testutil.Equals(t, Level{Resolution: 6 * 60 * 60 * 1000, MinBlockRange: 20 * 24 * 60 * 60 * 1000}, l2)
+
+	for _, s := range []string{"30m", "30m:", "x:40h", "30m:40h:1"} {
+		_, err := ParseLevel(s)
+		testutil.NotOk(t, err)
+	}
+
+	testutil.Ok(t, ValidateLevels(DefaultLevels))
+	testutil.Ok(t, ValidateLevels([]Level{l, l2}))
+	testutil.NotOk(t, ValidateLevels(nil))
+	testutil.NotOk(t, ValidateLevels([]Level{l2, l}))
+	testutil.NotOk(t, ValidateLevels([]Level{l, {Resolution: 45 * 60 * 1000, MinBlockRange: 1}}))
+	testutil.NotOk(t, ValidateLevels([]Level{{Resolution: ResLevel1}}))
+
+	next, ok := NextLevel([]Level{l, l2}, ResLevel0)
+	testutil.Assert(t, ok, "expected next level of raw blocks")
+	testutil.Equals(t, l, next)
+	next, ok = NextLevel([]Level{l, l2}, l.Resolution)
+	testutil.Assert(t, ok, "expected next level of 30m blocks")
+	testutil.Equals(t, l2, next)
+	_, ok = NextLevel([]Level{l, l2}, l2.Resolution)
+	testutil.Assert(t, !ok, "expected no next level of the last level")
+	_, ok = NextLevel([]Level{l, l2}, ResLevel1)
+	testutil.Assert(t, !ok, "expected no next level of not configured resolution")
+	_, ok = NextLevel(nil, ResLevel0)
+	testutil.Assert(t, !ok, "expected no next level without levels")
+}
+
 func TestExpandChunkIterator(t *testing.T) {
 	// Validate that expanding the chunk iterator filters out-of-order samples
 	// and staleness markers.
@@ -185,6 +219,63 @@ func TestDownsampleRaw(t *testing.T) {
 	testDownsample(t, input, &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 250}}, 100)
 }
 
+func TestDownsampleRawStream(t *testing.T) {
+	staleMarker := math.Float64frombits(value.StaleNaN)
+
+	// 3 days of samples scraped every 15s, with some stale markers, stored in chunks of 120 samples.
+	var (
+		raw      []sample
+		expected []sample
+	)
+	for i := int64(0); i < 3*24*60*4; i++ {
+		v := float64(i % 1000)
+		if i%777 == 0 {
+			v = staleMarker
+		} else {
+			expected = append(expected, sample{t: i * 15000, v: v})
+		}
+		raw = append(raw, sample{t: i * 15000, v: v})
+	}
+
+	mb := newMemBlock()
+	s := &series{lset: labels.FromStrings("__name__", "a")}
+	for i := 0; i < len(raw); i += 120 {
+		j := i + 120
+		if j > len(raw) {
+			j = len(raw)
+		}
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		testutil.Ok(t, err)
+		for _, smpl := range raw[i:j] {
+			app.Append(smpl.t, smpl.v)
+		}
+		s.chunks = append(s.chunks, chunks.Meta{MinTime: raw[i].t, MaxTime: raw[j-1].t, Chunk: c})
+	}
+	mb.addSeries(s)
+
+	var buf []sample
+	chks, err := downsampleRawStream(func() *rawSampleIterator { return newRawSampleIterator(mb, s.chunks) }, &buf, ResLevel1, false)
+	testutil.Ok(t, err)
+
+	// Result matches downsampling of all expanded samples at once.
+	numChunks := targetChunkCount(expected[0].t, expected[len(expected)-1].t, 1*60*1000, ResLevel1, len(expected))
+	testutil.Equals(t, downsampleRawLoop(expected, ResLevel1, numChunks), chks)
+	// Only a single batch of samples was buffered.
+	testutil.Assert(t, len(buf) < len(expected)/numChunks*2, "buffered %d samples, expected less than 2 batches", len(buf))
+
+	// Chunks without samples result in no chunks.
+	chks, err = downsampleRawStream(func() *rawSampleIterator { return newRawSampleIterator(mb, nil) }, &buf, ResLevel1, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(chks))
+
+	// Missing chunk is reported.
+	_, err = downsampleRawStream(func() *rawSampleIterator {
+		return newRawSampleIterator(mb, []chunks.Meta{{Ref: mb.numberOfChunks + 1}})
+	}, &buf, ResLevel1, false)
+	testutil.NotOk(t, err)
+}
+
 func TestDownsampleAggr(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -227,7 +318,7 @@ func TestDownsampleAggr(t *testing.T) {
 }
 
 func encodeTestAggrSeries(v map[AggrType][]sample) chunks.Meta {
-	b := newAggrChunkBuilder()
+	b := newAggrChunkBuilder(false)
 
 	for at, d := range v {
 		for _, s := range d {
@@ -282,7 +373,7 @@ func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta
 		mb.addSeries(ser)
 	}
 
-	id, err := Downsample(log.NewNopLogger(), meta, mb, dir, resolution)
+	id, err := Downsample(log.NewNopLogger(), meta, mb, dir, resolution, false)
 	testutil.Ok(t, err)
 
 	_, err = metadata.Read(filepath.Join(dir, id.String()))
@@ -393,6 +484,58 @@ func TestCounterSeriesIterator(t *testing.T) {
 	testutil.Equals(t, exp, res)
 }
 
+func TestCounterSeriesIterator_OverlappingChunks(t *testing.T) {
+	// The first sample of the second chunk has the timestamp of the last sample of the first chunk,
+	// but it is not the special last sample of the first chunk.
+	chunks := [][]sample{
+		{{100, 10}, {200, 20}, {300, 30}, {300, 5}},
+		{{300, 1}, {400, 15}},
+	}
+	exp := []sample{{100, 10}, {200, 20}, {300, 30}, {400, 40}}
+
+	var its []chunkenc.Iterator
+	for _, c := range chunks {
+		its = append(its, newSampleIterator(c))
+	}
+	x := NewCounterSeriesIterator(its...)
+
+	var res []sample
+	for x.Next() {
+		t, v := x.At()
+		res = append(res, sample{t, v})
+	}
+	testutil.Ok(t, x.Err())
+	testutil.Equals(t, exp, res)
+}
+
+func TestDownsampleRawBatch_StaleMarkers(t *testing.T) {
+	staleMarker := math.Float64frombits(value.StaleNaN)
+
+	// Series is reset within the first chunk and ends with a stale marker.
+	// The second chunk starts with a stale marker too.
+	cm := []chunks.Meta{
+		downsampleRawBatch([]sample{{10, 10}, {20, 20}, {30, 2}, {40, staleMarker}}, 50, false),
+		downsampleRawBatch([]sample{{60, staleMarker}, {70, 4}, {80, 6}}, 50, false),
+	}
+
+	var its []chunkenc.Iterator
+	for _, m := range cm {
+		chk, err := m.Chunk.(*AggrChunk).Get(AggrCounter)
+		testutil.Ok(t, err)
+		its = append(its, chk.Iterator(nil))
+	}
+	x := NewCounterSeriesIterator(its...)
+
+	var res []sample
+	for x.Next() {
+		t, v := x.At()
+		res = append(res, sample{t, v})
+	}
+	testutil.Ok(t, x.Err())
+	// No reset between the chunks, as the last raw value of the first chunk is 2.
+	testutil.Equals(t, []sample{{10, 10}, {40, 22}, {70, 24}, {80, 26}}, res)
+}
+
 func TestCounterSeriesIteratorSeek(t *testing.T) {
 	chunks := [][]sample{
 		{{100, 10}, {200, 20}, {300, 10}, {400, 20}, {400, 5}},
@@ -0,0 +1,428 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+const (
+	// SketchRelativeAccuracy is the relative accuracy guaranteed for quantiles estimated from a Sketch.
+	SketchRelativeAccuracy = 0.01
+
+	// sketchMinValue is the smallest absolute value not counted as zero.
+	sketchMinValue = 1e-9
+)
+
+var (
+	sketchGamma    = (1 + SketchRelativeAccuracy) / (1 - SketchRelativeAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// Sketch is a mergeable quantile sketch of a set of values, based on DDSketch (https://arxiv.org/abs/1908.10693).
+// Values are counted in logarithmically sized buckets, so every estimated quantile is within SketchRelativeAccuracy
+// of a value that was added. The number of buckets grows with the logarithm of the value range only.
+type Sketch struct {
+	pos   map[int32]uint64
+	neg   map[int32]uint64
+	zero  uint64
+	count uint64
+}
+
+// NewSketch returns a new empty Sketch.
+func NewSketch() *Sketch {
+	return &Sketch{
+		pos: map[int32]uint64{},
+		neg: map[int32]uint64{},
+	}
+}
+
+// Reset removes all values from the sketch.
+func (s *Sketch) Reset() {
+	for k := range s.pos {
+		delete(s.pos, k)
+	}
+	for k := range s.neg {
+		delete(s.neg, k)
+	}
+	s.zero = 0
+	s.count = 0
+}
+
+// Count returns the number of values added to the sketch.
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// Add adds the given value to the sketch. NaN and infinite values are ignored.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	switch {
+	case v > sketchMinValue:
+		s.pos[sketchIndex(v)]++
+	case v < -sketchMinValue:
+		s.neg[sketchIndex(-v)]++
+	default:
+		s.zero++
+	}
+	s.count++
+}
+
+// Merge adds all values of the other sketch to the sketch.
+func (s *Sketch) Merge(o *Sketch) {
+	for k, c := range o.pos {
+		s.pos[k] += c
+	}
+	for k, c := range o.neg {
+		s.neg[k] += c
+	}
+	s.zero += o.zero
+	s.count += o.count
+}
+
+// Quantile returns the estimated q-quantile of the added values. It returns NaN for an empty sketch.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		q = 0
+	}
+	if q > 1 {
+		q = 1
+	}
+	rank := q * float64(s.count-1)
+
+	var seen uint64
+	// Negative values are ordered from the biggest absolute value.
+	keys := sortedSketchKeys(s.neg)
+	for i := len(keys) - 1; i >= 0; i-- {
+		seen += s.neg[keys[i]]
+		if float64(seen) > rank {
+			return -sketchValue(keys[i])
+		}
+	}
+	seen += s.zero
+	if float64(seen) > rank {
+		return 0
+	}
+	keys = sortedSketchKeys(s.pos)
+	for _, k := range keys {
+		seen += s.pos[k]
+		if float64(seen) > rank {
+			return sketchValue(k)
+		}
+	}
+	// Unreachable, as the rank is always lower than the number of counted values.
+	return math.NaN()
+}
+
+// sketchBucket is a bucket of a Sketch with the value representing it and the number of values counted in it.
+type sketchBucket struct {
+	v     float64
+	count uint64
+}
+
+// appendBuckets appends all non-empty buckets of the sketch to buf in increasing order of their values.
+func (s *Sketch) appendBuckets(buf []sketchBucket) []sketchBucket {
+	keys := sortedSketchKeys(s.neg)
+	for i := len(keys) - 1; i >= 0; i-- {
+		buf = append(buf, sketchBucket{v: -sketchValue(keys[i]), count: s.neg[keys[i]]})
+	}
+	if s.zero > 0 {
+		buf = append(buf, sketchBucket{v: 0, count: s.zero})
+	}
+	for _, k := range sortedSketchKeys(s.pos) {
+		buf = append(buf, sketchBucket{v: sketchValue(k), count: s.pos[k]})
+	}
+	return buf
+}
+
+// Bytes returns the encoded sketch.
+func (s *Sketch) Bytes() []byte {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+2*binary.MaxVarintLen32*(len(s.pos)+len(s.neg)))
+	buf = putUvarint(buf, s.zero)
+	buf = putSketchBuckets(buf, s.pos)
+	buf = putSketchBuckets(buf, s.neg)
+	return buf
+}
+
+// SketchFromBytes decodes a sketch encoded by Sketch.Bytes.
+func SketchFromBytes(b []byte) (*Sketch, error) {
+	s := NewSketch()
+	if err := s.decode(b); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sketch) decode(b []byte) error {
+	zero, n := binary.Uvarint(b)
+	if n < 1 {
+		return errors.New("invalid sketch zero count")
+	}
+	b = b[n:]
+	s.zero = zero
+	s.count = zero
+
+	var err error
+	if b, err = s.decodeBuckets(b, s.pos); err != nil {
+		return errors.Wrap(err, "positive buckets")
+	}
+	if b, err = s.decodeBuckets(b, s.neg); err != nil {
+		return errors.Wrap(err, "negative buckets")
+	}
+	if len(b) > 0 {
+		return errors.Errorf("%d trailing bytes in sketch", len(b))
+	}
+	return nil
+}
+
+func (s *Sketch) decodeBuckets(b []byte, buckets map[int32]uint64) ([]byte, error) {
+	num, n := binary.Uvarint(b)
+	if n < 1 {
+		return nil, errors.New("invalid bucket number")
+	}
+	b = b[n:]
+
+	var k int64
+	for i := uint64(0); i < num; i++ {
+		d, n := binary.Varint(b)
+		if n < 1 {
+			return nil, errors.New("invalid bucket index")
+		}
+		b = b[n:]
+		c, n := binary.Uvarint(b)
+		if n < 1 {
+			return nil, errors.New("invalid bucket count")
+		}
+		b = b[n:]
+
+		k += d
+		buckets[int32(k)] += c
+		s.count += c
+	}
+	return b, nil
+}
+
+// sketchIndex returns the index of the bucket the given positive value falls into.
+func sketchIndex(v float64) int32 {
+	return int32(math.Ceil(math.Log(v) / sketchLogGamma))
+}
+
+// sketchValue returns the value representing the bucket with the given index.
+func sketchValue(k int32) float64 {
+	return 2 * math.Exp(float64(k)*sketchLogGamma) / (sketchGamma + 1)
+}
+
+func sortedSketchKeys(buckets map[int32]uint64) []int32 {
+	keys := make([]int32, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func putSketchBuckets(buf []byte, buckets map[int32]uint64) []byte {
+	buf = putUvarint(buf, uint64(len(buckets)))
+
+	var prev int64
+	for _, k := range sortedSketchKeys(buckets) {
+		buf = putVarint(buf, int64(k)-prev)
+		buf = putUvarint(buf, buckets[k])
+		prev = int64(k)
+	}
+	return buf
+}
+
+func putUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	return append(buf, b[:n]...)
+}
+
+func putVarint(buf []byte, x int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], x)
+	return append(buf, b[:n]...)
+}
+
+// ChunkEncSketch is the encoding byte of the SketchChunk within an AggrChunk.
+// It is picked right below ChunkEncAggr to prevent future collisions with wrapped encodings.
+const ChunkEncSketch = chunkenc.Encoding(0xfe)
+
+// SketchChunk is a chunk of quantile sketches, holding one Sketch for each downsampling window.
+// It starts with the number of windows encoded as a 2 byte big endian integer. Each window is then
+// encoded as the varint delta of its timestamp, the uvarint length of its sketch and the sketch itself.
+type SketchChunk struct {
+	b     []byte
+	lastT int64
+}
+
+// NewSketchChunk returns a new empty SketchChunk.
+func NewSketchChunk() *SketchChunk {
+	return &SketchChunk{b: make([]byte, 2, 128)}
+}
+
+// SketchChunkFromData returns the SketchChunk encoded in the given bytes. The returned chunk is meant for reading only.
+func SketchChunkFromData(b []byte) (*SketchChunk, error) {
+	if len(b) < 2 {
+		return nil, errors.New("invalid sketch chunk size")
+	}
+	return &SketchChunk{b: b}, nil
+}
+
+// Add appends the sketch of the window ending at t. Windows have to be added in increasing order of time.
+func (c *SketchChunk) Add(t int64, s *Sketch) {
+	num := c.NumSamples()
+	if num == 0 {
+		c.b = putVarint(c.b, t)
+	} else {
+		c.b = putVarint(c.b, t-c.lastT)
+	}
+	sb := s.Bytes()
+	c.b = putUvarint(c.b, uint64(len(sb)))
+	c.b = append(c.b, sb...)
+
+	c.lastT = t
+	binary.BigEndian.PutUint16(c.b, uint16(num+1))
+}
+
+func (c *SketchChunk) Bytes() []byte {
+	return c.b
+}
+
+func (c *SketchChunk) Encoding() chunkenc.Encoding {
+	return ChunkEncSketch
+}
+
+func (c *SketchChunk) Appender() (chunkenc.Appender, error) {
+	return nil, errors.New("not implemented")
+}
+
+// Iterator returns an iterator expanding every window into one sample for each value counted in its sketch.
+// The samples of a window ending at t are ordered by value and get consecutive timestamps up to t, so functions
+// like quantile_over_time approximate the quantiles of the original samples if evaluated over whole windows.
+// Samples that would overlap with the previous window are dropped.
+func (c *SketchChunk) Iterator(_ chunkenc.Iterator) chunkenc.Iterator {
+	return &sketchSampleIterator{it: c.Sketches(), t: math.MinInt64, prevT: math.MinInt64, windowT: math.MinInt64}
+}
+
+// NumSamples returns the number of windows in the chunk.
+func (c *SketchChunk) NumSamples() int {
+	return int(binary.BigEndian.Uint16(c.b))
+}
+
+// Sketches returns an iterator over the windows of the chunk.
+func (c *SketchChunk) Sketches() *SketchIterator {
+	return &SketchIterator{b: c.b[2:], num: c.NumSamples(), s: NewSketch()}
+}
+
+// SketchIterator iterates over the windows of a SketchChunk.
+type SketchIterator struct {
+	b   []byte
+	num int
+	i   int
+
+	t   int64
+	s   *Sketch
+	err error
+}
+
+func (it *SketchIterator) Next() bool {
+	if it.err != nil || it.i >= it.num {
+		return false
+	}
+	d, n := binary.Varint(it.b)
+	if n < 1 {
+		it.err = errors.New("invalid window timestamp")
+		return false
+	}
+	it.b = it.b[n:]
+	l, n := binary.Uvarint(it.b)
+	if n < 1 || uint64(len(it.b[n:])) < l {
+		it.err = errors.New("invalid sketch size")
+		return false
+	}
+	it.b = it.b[n:]
+
+	it.s.Reset()
+	if err := it.s.decode(it.b[:l]); err != nil {
+		it.err = errors.Wrapf(err, "decode sketch of window %d", it.i)
+		return false
+	}
+	it.b = it.b[l:]
+
+	if it.i == 0 {
+		it.t = d
+	} else {
+		it.t += d
+	}
+	it.i++
+	return true
+}
+
+// At returns the end timestamp and the sketch of the current window.
+// The sketch is only valid until the next call of Next.
+func (it *SketchIterator) At() (int64, *Sketch) {
+	return it.t, it.s
+}
+
+func (it *SketchIterator) Err() error {
+	return it.err
+}
+
+// sketchSampleIterator expands the windows of a SketchChunk into samples; see SketchChunk.Iterator.
+type sketchSampleIterator struct {
+	it *SketchIterator
+
+	buckets []sketchBucket
+	i       int    // Current bucket.
+	left    uint64 // Samples left in the current bucket.
+
+	t, prevT, windowT int64
+}
+
+func (it *sketchSampleIterator) Next() bool {
+	for {
+		for it.left == 0 {
+			if it.i+1 < len(it.buckets) {
+				it.i++
+				it.left = it.buckets[it.i].count
+				continue
+			}
+			if !it.it.Next() {
+				return false
+			}
+			t, s := it.it.At()
+			it.buckets = s.appendBuckets(it.buckets[:0])
+			it.i = -1
+			it.prevT = it.windowT
+			it.windowT = t
+			it.t = t - int64(s.Count())
+		}
+		it.left--
+		it.t++
+
+		if it.t > it.prevT {
+			return true
+		}
+	}
+}
+
+func (it *sketchSampleIterator) At() (int64, float64) {
+	return it.t, it.buckets[it.i].v
+}
+
+func (it *sketchSampleIterator) Err() error {
+	return it.it.Err()
+}
@@ -0,0 +1,103 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"math"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSketch(t *testing.T) {
+	s := NewSketch()
+	testutil.Assert(t, math.IsNaN(s.Quantile(0.5)), "expected NaN for empty sketch")
+
+	a, b := NewSketch(), NewSketch()
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+		if i%2 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	s.Add(math.NaN())
+	testutil.Equals(t, uint64(1000), s.Count())
+
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 1} {
+		exp := 1 + q*999
+		got := s.Quantile(q)
+		testutil.Assert(t, math.Abs(got-exp) <= exp*SketchRelativeAccuracy+1, "quantile %v: expected %v, got %v", q, exp, got)
+	}
+
+	// Merged sketches estimate the same quantiles as a single one.
+	a.Merge(b)
+	testutil.Equals(t, s.Quantile(0.9), a.Quantile(0.9))
+
+	// Encoded sketches retain all buckets.
+	s.Add(0)
+	s.Add(-10)
+	dec, err := SketchFromBytes(s.Bytes())
+	testutil.Ok(t, err)
+	testutil.Equals(t, s, dec)
+	testutil.Assert(t, math.Abs(dec.Quantile(0)+10) <= 10*SketchRelativeAccuracy, "unexpected minimum %v", dec.Quantile(0))
+
+	_, err = SketchFromBytes(append(s.Bytes(), 1))
+	testutil.NotOk(t, err)
+}
+
+func TestDownsampleSketches(t *testing.T) {
+	var raw []sample
+	for i := int64(0); i < 1000; i++ {
+		raw = append(raw, sample{t: i, v: float64(i % 100)})
+	}
+
+	expandSketches := func(t *testing.T, c *AggrChunk) (res []sample) {
+		sc, err := c.Get(AggrSketch)
+		testutil.Ok(t, err)
+		testutil.Ok(t, expandChunkIterator(sc.Iterator(nil), &res))
+		return res
+	}
+
+	// Without sketches enabled, no sketch aggregate is written.
+	chk := downsampleRawBatch(raw, 100, false).Chunk.(*AggrChunk)
+	_, err := chk.Get(AggrSketch)
+	testutil.Equals(t, ErrAggrNotExist, err)
+
+	chk = downsampleRawBatch(raw, 100, true).Chunk.(*AggrChunk)
+	c, err := chk.Get(AggrSketch)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 10, c.NumSamples())
+
+	// Every window expands into one sample per raw sample, ending at the window.
+	res := expandSketches(t, chk)
+	testutil.Equals(t, len(raw), len(res))
+	testutil.Equals(t, int64(99), res[99].t)
+	testutil.Equals(t, int64(999), res[len(res)-1].t)
+	for i, s := range res {
+		exp := float64(i % 100)
+		testutil.Assert(t, math.Abs(s.v-exp) <= exp*SketchRelativeAccuracy, "sample %d: expected %v, got %v", i, exp, s.v)
+	}
+
+	// Sketches of aggregated chunks are merged into the windows of the lower resolution.
+	var buf []sample
+	chk2 := downsampleRawBatch(raw[500:], 100, true).Chunk.(*AggrChunk)
+	chk1 := downsampleRawBatch(raw[:500], 100, true).Chunk.(*AggrChunk)
+	agg, err := downsampleAggrBatch([]*AggrChunk{chk1, chk2}, &buf, 500)
+	testutil.Ok(t, err)
+
+	c, err = agg.Chunk.(*AggrChunk).Get(AggrSketch)
+	testutil.Ok(t, err)
+	it := c.(*SketchChunk).Sketches()
+	for _, exp := range []int64{499, 999} {
+		testutil.Assert(t, it.Next(), "expected window %d", exp)
+		wt, s := it.At()
+		testutil.Equals(t, exp, wt)
+		testutil.Equals(t, uint64(500), s.Count())
+	}
+	testutil.Assert(t, !it.Next(), "unexpected window")
+	testutil.Ok(t, it.Err())
+	testutil.Equals(t, len(raw), len(expandSketches(t, agg.Chunk.(*AggrChunk))))
+}
@@ -0,0 +1,133 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// ErrorClass is a class of issues of blocks planned for compaction.
+type ErrorClass string
+
+const (
+	// ErrorClassCriticalIndex means the block index has chunks outside of the block time range.
+	ErrorClassCriticalIndex ErrorClass = "critical-index"
+	// ErrorClassOutOfOrderChunks means the block index has series with out of order chunks.
+	ErrorClassOutOfOrderChunks ErrorClass = "out-of-order-chunks"
+	// ErrorClassMalformedMeta means the block meta.json is inconsistent with the block or its compaction group.
+	ErrorClassMalformedMeta ErrorClass = "malformed-meta"
+)
+
+// ErrorClasses are all classes of block issues.
+var ErrorClasses = []ErrorClass{ErrorClassCriticalIndex, ErrorClassOutOfOrderChunks, ErrorClassMalformedMeta}
+
+// ErrorAction is the action taken by the compactor when it finds an issue in a block planned for compaction.
+type ErrorAction string
+
+const (
+	// ErrorActionHalt returns a HaltError, which halts the compactor.
+	ErrorActionHalt ErrorAction = "halt"
+	// ErrorActionSkip marks the block for no compaction, with the error class as reason, and plans the group again without it.
+	ErrorActionSkip ErrorAction = "skip"
+	// ErrorActionRetry returns a RetryError, so the compaction is retried in the next iteration.
+	ErrorActionRetry ErrorAction = "retry"
+)
+
+// ParseErrorActions parses actions for block issue classes given as <class>=<action>.
+func ParseErrorActions(specs []string) (map[ErrorClass]ErrorAction, error) {
+	actions := make(map[ErrorClass]ErrorAction, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid block error action %q, expected <class>=<action>", spec)
+		}
+		class, action := ErrorClass(parts[0]), ErrorAction(parts[1])
+
+		known := false
+		for _, c := range ErrorClasses {
+			known = known || c == class
+		}
+		if !known {
+			return nil, errors.Errorf("unknown block error class %q in %q", class, spec)
+		}
+		switch action {
+		case ErrorActionHalt, ErrorActionSkip, ErrorActionRetry:
+		default:
+			return nil, errors.Errorf("unknown block error action %q in %q", action, spec)
+		}
+		if _, ok := actions[class]; ok {
+			return nil, errors.Errorf("duplicated action for block error class %q", class)
+		}
+		actions[class] = action
+	}
+	return actions, nil
+}
+
+// ErrorPolicy decides how the compactor handles issues of blocks planned for compaction, depending on their class.
+// Issues of classes without configured action, or found with nil ErrorPolicy, halt the compactor.
+type ErrorPolicy struct {
+	actions   map[ErrorClass]ErrorAction
+	decisions *prometheus.CounterVec
+}
+
+// NewErrorPolicy returns a new ErrorPolicy taking the given actions.
+func NewErrorPolicy(reg prometheus.Registerer, actions map[ErrorClass]ErrorAction) *ErrorPolicy {
+	p := &ErrorPolicy{
+		actions: actions,
+		decisions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_block_error_decisions_total",
+			Help: "Total number of issues found in blocks planned for compaction by issue class and the action taken.",
+		}, []string{"class", "action"}),
+	}
+	for _, c := range ErrorClasses {
+		p.decisions.WithLabelValues(string(c), string(p.action(c)))
+	}
+	return p
+}
+
+func (p *ErrorPolicy) action(class ErrorClass) ErrorAction {
+	if p == nil {
+		return ErrorActionHalt
+	}
+	if a, ok := p.actions[class]; ok {
+		return a
+	}
+	return ErrorActionHalt
+}
+
+func (p *ErrorPolicy) decide(class ErrorClass) ErrorAction {
+	a := p.action(class)
+	if p != nil {
+		p.decisions.WithLabelValues(string(class), string(a)).Inc()
+	}
+	return a
+}
+
+// handleBlockError takes the action configured for the class of the given issue of the block. It returns true, if the block
+// was excluded from compaction, so the group has to be planned again. The excluded block stays a planning boundary of the group.
+// It has to be called with the group lock held.
+func (cg *Group) handleBlockError(ctx context.Context, class ErrorClass, id ulid.ULID, err error) (bool, error) {
+	switch cg.errorPolicy.decide(class) {
+	case ErrorActionSkip:
+		level.Warn(cg.logger).Log("msg", "excluding block with issue from compaction", "block", id, "class", class, "err", err)
+		if err := block.MarkForNoCompact(ctx, cg.logger, cg.bkt, id, metadata.NoCompactReason(class), err.Error(), cg.blocksMarkedForNoCompact); err != nil {
+			return false, retry(errors.Wrapf(err, "mark block %s for no compaction", id))
+		}
+		cg.exclude(id)
+		return true, nil
+	case ErrorActionRetry:
+		return false, retry(err)
+	default:
+		return false, halt(err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseErrorActions(t *testing.T) {
+	actions, err := ParseErrorActions(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[ErrorClass]ErrorAction{}, actions)
+
+	actions, err = ParseErrorActions([]string{"out-of-order-chunks=skip", "malformed-meta=retry", "critical-index=halt"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[ErrorClass]ErrorAction{
+		ErrorClassOutOfOrderChunks: ErrorActionSkip,
+		ErrorClassMalformedMeta:    ErrorActionRetry,
+		ErrorClassCriticalIndex:    ErrorActionHalt,
+	}, actions)
+
+	for _, specs := range [][]string{
+		{"out-of-order-chunks"},
+		{"unknown=skip"},
+		{"out-of-order-chunks=ignore"},
+		{"out-of-order-chunks=skip", "out-of-order-chunks=halt"},
+	} {
+		_, err := ParseErrorActions(specs)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestGroup_HandleBlockError(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	reg := prometheus.NewRegistry()
+	policy := NewErrorPolicy(reg, map[ErrorClass]ErrorAction{
+		ErrorClassOutOfOrderChunks: ErrorActionSkip,
+		ErrorClassMalformedMeta:    ErrorActionRetry,
+	})
+
+	metrics := newTestGroupMetrics()
+	newTestGroup := func(policy *ErrorPolicy) *Group {
+		g, err := newGroup(nil, bkt, nil, 0, "", GroupOptions{ErrorPolicy: policy}, metrics)
+		testutil.Ok(t, err)
+		for i := 0; i < 2; i++ {
+			testutil.Ok(t, g.Add(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(uint64(i+1), nil)}}))
+		}
+		return g
+	}
+
+	// Nil policy halts on every issue.
+	g := newTestGroup(nil)
+	rerun, err := g.handleBlockError(ctx, ErrorClassOutOfOrderChunks, ulid.MustNew(1, nil), errors.New("issue"))
+	testutil.Assert(t, !rerun, "unexpected rerun")
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	g = newTestGroup(policy)
+	rerun, err = g.handleBlockError(ctx, ErrorClassCriticalIndex, ulid.MustNew(1, nil), errors.New("issue"))
+	testutil.Assert(t, !rerun, "unexpected rerun")
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	rerun, err = g.handleBlockError(ctx, ErrorClassMalformedMeta, ulid.MustNew(1, nil), errors.New("issue"))
+	testutil.Assert(t, !rerun, "unexpected rerun")
+	testutil.Assert(t, IsRetryError(err), "expected retry error, got %v", err)
+
+	// Skipped blocks are marked and excluded from the group.
+	rerun, err = g.handleBlockError(ctx, ErrorClassOutOfOrderChunks, ulid.MustNew(1, nil), errors.New("issue"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, rerun, "expected rerun")
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(2, nil)}, g.IDs())
+	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.blocksMarkedForNoCompact))
+
+	mark, err := metadata.ReadNoCompactMark(ctx, objstore.WithNoopInstr(bkt), nil, ulid.MustNew(1, nil).String())
+	testutil.Ok(t, err)
+	testutil.Equals(t, metadata.NoCompactReason(ErrorClassOutOfOrderChunks), mark.Reason)
+	testutil.Equals(t, "issue", mark.Details)
+
+	for _, c := range []struct {
+		class  ErrorClass
+		action ErrorAction
+	}{
+		{ErrorClassCriticalIndex, ErrorActionHalt},
+		{ErrorClassMalformedMeta, ErrorActionRetry},
+		{ErrorClassOutOfOrderChunks, ErrorActionSkip},
+	} {
+		testutil.Equals(t, 1.0, promtest.ToFloat64(policy.decisions.WithLabelValues(string(c.class), string(c.action))))
+	}
+}
+
+func TestGroup_HandleBlockError_SkippedBlockBetweenBlocks(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "handle-block-error")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	policy := NewErrorPolicy(nil, map[ErrorClass]ErrorAction{ErrorClassOutOfOrderChunks: ErrorActionSkip})
+	g, err := newGroup(nil, objstore.NewInMemBucket(), nil, 0, "", GroupOptions{ErrorPolicy: policy}, newTestGroupMetrics())
+	testutil.Ok(t, err)
+
+	for i := uint64(1); i <= 3; i++ {
+		testutil.Ok(t, g.Add(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(i, nil), MinTime: int64(i) * 1000, MaxTime: int64(i+1) * 1000}}))
+	}
+
+	plan, err := g.Plan(dir, planAllPlanner{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(plan))
+
+	skipped := ulid.MustNew(2, nil)
+	rerun, err := g.handleBlockError(ctx, ErrorClassOutOfOrderChunks, skipped, errors.New("issue"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, rerun, "expected rerun")
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(3, nil)}, g.IDs())
+
+	// The blocks around the skipped one must not be compacted together, as the result would overlap it.
+	plan, err = g.Plan(dir, planAllPlanner{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(plan))
+}
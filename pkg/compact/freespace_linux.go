@@ -0,0 +1,19 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FreeDiskSpace returns the number of bytes available to unprivileged users in the filesystem of the given directory.
+func FreeDiskSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, errors.Wrapf(err, "statfs %s", dir)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Grouper computes the compaction group of blocks. Blocks with the same downsampling resolution and group labels
+// are compacted together, and blocks produced by the group get the group labels as external labels.
+//
+// Grouping blocks with different external labels together drops the labels not in the group labels, so series
+// differing only in those labels are merged. This is intended for labels like replica labels. Overlapping blocks of
+// such groups require vertical compaction to be enabled.
+type Grouper interface {
+	// GroupLabels returns the labels of the compaction group of the block with the given meta.
+	GroupLabels(meta metadata.Thanos) labels.Labels
+}
+
+// DefaultGrouper groups blocks by all their external labels.
+type DefaultGrouper struct{}
+
+// GroupLabels returns all external labels of the block.
+func (DefaultGrouper) GroupLabels(meta metadata.Thanos) labels.Labels {
+	return labels.FromMap(meta.Labels)
+}
+
+type byLabelsGrouper struct {
+	names map[string]struct{}
+	keep  bool
+}
+
+// NewByLabelsGrouper returns a Grouper, which groups blocks only by the given external labels, e.g. by tenant label.
+func NewByLabelsGrouper(names ...string) Grouper {
+	return newByLabelsGrouper(names, true)
+}
+
+// NewIgnoreLabelsGrouper returns a Grouper, which groups blocks by their external labels except the given ones,
+// e.g. replica labels.
+func NewIgnoreLabelsGrouper(names ...string) Grouper {
+	return newByLabelsGrouper(names, false)
+}
+
+func newByLabelsGrouper(names []string, keep bool) *byLabelsGrouper {
+	g := &byLabelsGrouper{names: make(map[string]struct{}, len(names)), keep: keep}
+	for _, n := range names {
+		g.names[n] = struct{}{}
+	}
+	return g
+}
+
+func (g *byLabelsGrouper) GroupLabels(meta metadata.Thanos) labels.Labels {
+	lbls := make(map[string]string, len(meta.Labels))
+	for n, v := range meta.Labels {
+		if _, ok := g.names[n]; ok == g.keep {
+			lbls[n] = v
+		}
+	}
+	return labels.FromMap(lbls)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestGroupers(t *testing.T) {
+	meta := metadata.Thanos{Labels: map[string]string{"tenant": "a", "cluster": "eu1", "replica": "0"}}
+
+	testutil.Equals(t, labels.FromStrings("tenant", "a", "cluster", "eu1", "replica", "0"), DefaultGrouper{}.GroupLabels(meta))
+	testutil.Equals(t, labels.FromStrings("tenant", "a"), NewByLabelsGrouper("tenant", "missing").GroupLabels(meta))
+	testutil.Equals(t, labels.FromStrings("tenant", "a", "cluster", "eu1"), NewIgnoreLabelsGrouper("replica").GroupLabels(meta))
+}
+
+func TestSyncerGroups_Grouper(t *testing.T) {
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i, lbls := range []map[string]string{
+		{"tenant": "a", "replica": "0"},
+		{"tenant": "a", "replica": "1"},
+		{"tenant": "b", "replica": "0"},
+		{"tenant": "a", "replica": "0"},
+	} {
+		id := ulid.MustNew(uint64(i+1), nil)
+		metas[id] = &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       id,
+				MinTime:    int64(i) * 1000,
+				MaxTime:    int64(i+1) * 1000,
+				Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{id}},
+			},
+			Thanos: metadata.Thanos{Labels: lbls},
+		}
+	}
+	// Downsampled blocks are never grouped with raw blocks.
+	metas[ulid.MustNew(5, nil)] = &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(5, nil), MinTime: 0, MaxTime: 1000},
+		Thanos:    metadata.Thanos{Labels: map[string]string{"tenant": "a", "replica": "0"}, Downsample: metadata.ThanosDownsample{Resolution: 1000}},
+	}
+
+	sy, err := NewSyncer(nil, nil, bkt, nil, nil, nil, nil, nil, 1, GroupOptions{EnableVerticalCompaction: true}, NewByLabelsGrouper("tenant"))
+	testutil.Ok(t, err)
+	sy.blocks = metas
+
+	groups, err := sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(groups))
+
+	byKey := map[string]*Group{}
+	for _, g := range groups {
+		byKey[g.Key()] = g
+	}
+	ga := byKey[groupKey(0, labels.FromStrings("tenant", "a"), "")]
+	testutil.Assert(t, ga != nil, "missing group of tenant a")
+	testutil.Equals(t, labels.FromStrings("tenant", "a"), ga.Labels())
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(4, nil)}, ga.IDs())
+
+	gb := byKey[groupKey(0, labels.FromStrings("tenant", "b"), "")]
+	testutil.Assert(t, gb != nil, "missing group of tenant b")
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(3, nil)}, gb.IDs())
+
+	gd := byKey[groupKey(1000, labels.FromStrings("tenant", "a"), "")]
+	testutil.Assert(t, gd != nil, "missing downsampled group of tenant a")
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(5, nil)}, gd.IDs())
+
+	// Blocks of the group pass meta validation despite their different external labels.
+	testutil.Ok(t, ga.validateMeta(metas[ulid.MustNew(2, nil)], ulid.MustNew(2, nil)))
+	testutil.NotOk(t, ga.validateMeta(metas[ulid.MustNew(3, nil)], ulid.MustNew(3, nil)))
+}
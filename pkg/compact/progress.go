@@ -0,0 +1,179 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// GroupState is the state of a compaction group within the current compaction run.
+type GroupState string
+
+const (
+	// GroupStateWaiting means the group is planned for compaction in the current pass, but was not picked up yet.
+	GroupStateWaiting GroupState = "waiting"
+	// GroupStateCompacting means the group is being compacted.
+	GroupStateCompacting GroupState = "compacting"
+	// GroupStateDone means the last compaction of the group succeeded or there was nothing to compact.
+	GroupStateDone GroupState = "done"
+	// GroupStateFailed means the last compaction of the group failed.
+	GroupStateFailed GroupState = "failed"
+	// GroupStateHalted means the last compaction of the group failed with a critical error, which halts the compactor.
+	GroupStateHalted GroupState = "halted"
+)
+
+// GroupProgress is the JSON view of the compaction progress of a single group.
+type GroupProgress struct {
+	Key        string            `json:"key"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Blocks     int               `json:"blocks"`
+	State      GroupState        `json:"state"`
+	// Plan contains the blocks of the compaction in progress or of the last planned one.
+	Plan        []ulid.ULID `json:"plan,omitempty"`
+	StartedAt   time.Time   `json:"startedAt,omitempty"`
+	FinishedAt  time.Time   `json:"finishedAt,omitempty"`
+	Compactions int         `json:"compactions"`
+	Err         string      `json:"err,omitempty"`
+}
+
+// Progress tracks the state of all compaction groups of a BucketCompactor, so it can be shown to operators.
+// All methods are safe to be called on nil Progress, in which case nothing is tracked.
+type Progress struct {
+	mtx       sync.Mutex
+	startedAt time.Time
+	pass      int
+	groups    map[string]*GroupProgress
+}
+
+// NewProgress returns a new empty Progress.
+func NewProgress() *Progress {
+	return &Progress{groups: map[string]*GroupProgress{}}
+}
+
+// ProgressInfo is the JSON view of a Progress.
+type ProgressInfo struct {
+	StartedAt time.Time       `json:"startedAt"`
+	Pass      int             `json:"pass"`
+	Groups    []GroupProgress `json:"groups"`
+}
+
+// Info returns the current state of all groups sorted by their key.
+func (p *Progress) Info() *ProgressInfo {
+	info := &ProgressInfo{Groups: []GroupProgress{}}
+	if p == nil {
+		return info
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	info.StartedAt = p.startedAt
+	info.Pass = p.pass
+	for _, g := range p.groups {
+		gp := *g
+		gp.Plan = append([]ulid.ULID(nil), g.Plan...)
+		info.Groups = append(info.Groups, gp)
+	}
+	sort.Slice(info.Groups, func(i, j int) bool { return info.Groups[i].Key < info.Groups[j].Key })
+	return info
+}
+
+// start resets the progress at the beginning of a compaction run.
+func (p *Progress) start() {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.startedAt = time.Now()
+	p.pass = 0
+	p.groups = map[string]*GroupProgress{}
+}
+
+// newPass marks the given groups as waiting for compaction in a new pass. Groups not present anymore are removed.
+func (p *Progress) newPass(groups []*Group) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.pass++
+	res := make(map[string]*GroupProgress, len(groups))
+	for _, g := range groups {
+		gp, ok := p.groups[g.Key()]
+		if !ok {
+			gp = &GroupProgress{
+				Key:        g.Key(),
+				Labels:     g.Labels().Map(),
+				Resolution: g.Resolution(),
+			}
+		}
+		gp.Blocks = len(g.IDs())
+		gp.State = GroupStateWaiting
+		gp.Err = ""
+		res[g.Key()] = gp
+	}
+	p.groups = res
+}
+
+// started marks the group as being compacted.
+func (p *Progress) started(key string) {
+	p.update(key, func(gp *GroupProgress) {
+		gp.State = GroupStateCompacting
+		gp.Plan = nil
+		gp.StartedAt = time.Now()
+	})
+}
+
+// planned records the block directories planned for the compaction of the group.
+func (p *Progress) planned(key string, plan []string) {
+	p.update(key, func(gp *GroupProgress) {
+		gp.Plan = gp.Plan[:0]
+		for _, pdir := range plan {
+			if id, err := ulid.Parse(filepath.Base(pdir)); err == nil {
+				gp.Plan = append(gp.Plan, id)
+			}
+		}
+	})
+}
+
+// finished records the outcome of the compaction of the group.
+func (p *Progress) finished(key string, compacted bool, err error) {
+	p.update(key, func(gp *GroupProgress) {
+		gp.FinishedAt = time.Now()
+		switch {
+		case err == nil:
+			gp.State = GroupStateDone
+			if compacted {
+				gp.Compactions++
+			}
+		case IsHaltError(err):
+			gp.State = GroupStateHalted
+			gp.Err = err.Error()
+		default:
+			gp.State = GroupStateFailed
+			gp.Err = err.Error()
+		}
+	})
+}
+
+func (p *Progress) update(key string, f func(gp *GroupProgress)) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if gp, ok := p.groups[key]; ok {
+		f(gp)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestProgress(t *testing.T) {
+	newTestGroup := func(cluster string, blocks int) *Group {
+		lset := labels.FromStrings("cluster", cluster)
+		g, err := newGroup(nil, objstore.NewInMemBucket(), lset, 0, "", GroupOptions{}, newTestGroupMetrics())
+		testutil.Ok(t, err)
+		for i := 0; i < blocks; i++ {
+			testutil.Ok(t, g.Add(&metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(uint64(i+1), nil)},
+				Thanos:    metadata.Thanos{Labels: lset.Map()},
+			}))
+		}
+		return g
+	}
+
+	// Nil progress tracks nothing.
+	var p *Progress
+	p.start()
+	p.started("a")
+	testutil.Equals(t, &ProgressInfo{Groups: []GroupProgress{}}, p.Info())
+
+	a, b := newTestGroup("a", 3), newTestGroup("b", 1)
+	p = NewProgress()
+	p.start()
+	p.newPass([]*Group{b, a})
+
+	info := p.Info()
+	testutil.Equals(t, 1, info.Pass)
+	testutil.Equals(t, 2, len(info.Groups))
+	testutil.Equals(t, a.Key(), info.Groups[0].Key)
+	testutil.Equals(t, GroupStateWaiting, info.Groups[0].State)
+	testutil.Equals(t, 3, info.Groups[0].Blocks)
+
+	p.started(a.Key())
+	p.planned(a.Key(), []string{filepath.Join("dir", ulid.MustNew(1, nil).String()), filepath.Join("dir", ulid.MustNew(2, nil).String())})
+	info = p.Info()
+	testutil.Equals(t, GroupStateCompacting, info.Groups[0].State)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}, info.Groups[0].Plan)
+
+	p.finished(a.Key(), true, nil)
+	p.finished(b.Key(), false, halt(errors.New("overlap")))
+	info = p.Info()
+	testutil.Equals(t, GroupStateDone, info.Groups[0].State)
+	testutil.Equals(t, 1, info.Groups[0].Compactions)
+	testutil.Equals(t, GroupStateHalted, info.Groups[1].State)
+	testutil.Equals(t, "overlap", info.Groups[1].Err)
+
+	// A new pass keeps the number of compactions, but resets the state of remaining groups.
+	p.newPass([]*Group{a})
+	info = p.Info()
+	testutil.Equals(t, 2, info.Pass)
+	testutil.Equals(t, 1, len(info.Groups))
+	testutil.Equals(t, GroupStateWaiting, info.Groups[0].State)
+	testutil.Equals(t, 1, info.Groups[0].Compactions)
+}
@@ -5,6 +5,7 @@ package compact
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -12,34 +13,172 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"gopkg.in/yaml.v2"
 )
 
-// ApplyRetentionPolicyByResolution removes blocks depending on the specified retentionByResolution based on blocks MaxTime.
-// A value of 0 disables the retention for its resolution.
+// RetentionPolicy overrides the retention by resolution for blocks with external labels matching its selector.
+type RetentionPolicy struct {
+	// Selector of external labels of blocks, e.g. {cluster="dev"}.
+	Selector string `yaml:"selector"`
+	// Retention of blocks of all resolutions. 0 retains the blocks forever.
+	Retention model.Duration `yaml:"retention"`
+
+	matchers []*labels.Matcher
+}
+
+// ParseRetentionPolicies parses a YAML list of retention policies. Empty content means no policies.
+func ParseRetentionPolicies(confYAML []byte) ([]*RetentionPolicy, error) {
+	var policies []*RetentionPolicy
+	if err := yaml.UnmarshalStrict(confYAML, &policies); err != nil {
+		return nil, errors.Wrap(err, "parse retention policies")
+	}
+	for i, p := range policies {
+		ms, err := promql.ParseMetricSelector(p.Selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse selector %q of retention policy %d", p.Selector, i)
+		}
+		p.matchers = ms
+	}
+	return policies, nil
+}
+
+// Matches returns true if the external labels match the selector of the policy.
+func (p *RetentionPolicy) Matches(lset labels.Labels) bool {
+	for _, m := range p.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchingRetentionPolicy returns the first policy matching the external labels or nil if none matches.
+func matchingRetentionPolicy(policies []*RetentionPolicy, lset labels.Labels) *RetentionPolicy {
+	for _, p := range policies {
+		if p.Matches(lset) {
+			return p
+		}
+	}
+	return nil
+}
+
+// resolutionLabel returns the value of the resolution label used in retention metrics.
+func resolutionLabel(r ResolutionLevel) string {
+	switch r {
+	case ResolutionLevelRaw:
+		return "raw"
+	case ResolutionLevel5m:
+		return "5m"
+	case ResolutionLevel1h:
+		return "1h"
+	}
+	return model.Duration(time.Duration(r) * time.Millisecond).String()
+}
+
+// NewRetentionBlocksMarkedCounter returns a counter of blocks marked for deletion by retention, by resolution.
+func NewRetentionBlocksMarkedCounter(reg prometheus.Registerer) *prometheus.CounterVec {
+	c := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compactor_retention_blocks_marked_for_deletion_total",
+		Help: "Total number of blocks marked for deletion by retention, by resolution.",
+	}, []string{"resolution"})
+	for _, r := range []ResolutionLevel{ResolutionLevelRaw, ResolutionLevel5m, ResolutionLevel1h} {
+		c.WithLabelValues(resolutionLabel(r))
+	}
+	return c
+}
+
+// multiCounter is a counter which increments other counters along with itself.
+type multiCounter struct {
+	prometheus.Counter
+	others []prometheus.Counter
+}
+
+func (c multiCounter) Inc() {
+	c.Counter.Inc()
+	for _, o := range c.others {
+		o.Inc()
+	}
+}
+
+func (c multiCounter) Add(v float64) {
+	c.Counter.Add(v)
+	for _, o := range c.others {
+		o.Add(v)
+	}
+}
+
+// blockRetention returns the retention of the block and the selector of the policy it comes from, or "resolution"
+// if it comes from retentionByResolution.
+func blockRetention(m *metadata.Meta, retentionByResolution map[ResolutionLevel]time.Duration, policies []*RetentionPolicy) (time.Duration, string) {
+	if p := matchingRetentionPolicy(policies, labels.FromMap(m.Thanos.Labels)); p != nil {
+		return time.Duration(p.Retention), p.Selector
+	}
+	return retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)], "resolution"
+}
+
+// pastRetention returns true if the block is past the given retention. A retention of 0 retains the block forever.
+func pastRetention(m *metadata.Meta, retention time.Duration) bool {
+	if retention.Seconds() == 0 {
+		return false
+	}
+	return time.Now().After(time.Unix(m.MaxTime/1000, 0).Add(retention))
+}
+
+// BlocksPastRetention returns blocks which would be marked for deletion by ApplyRetentionPolicyByResolution.
+func BlocksPastRetention(metas map[ulid.ULID]*metadata.Meta, retentionByResolution map[ResolutionLevel]time.Duration, policies []*RetentionPolicy) []ulid.ULID {
+	var res []ulid.ULID
+	for id, m := range metas {
+		if retention, _ := blockRetention(m, retentionByResolution, policies); pastRetention(m, retention) {
+			res = append(res, id)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Compare(res[j]) < 0 })
+	return res
+}
+
+// ApplyRetentionPolicyByResolution marks blocks for deletion depending on the specified retentionByResolution based on blocks MaxTime.
+// A value of 0 disables the retention for its resolution. The first of policies matching external labels of a block
+// overrides the retention by resolution for the block. If dryRun is true, blocks past retention are only logged.
 func ApplyRetentionPolicyByResolution(
 	ctx context.Context,
 	logger log.Logger,
 	bkt objstore.Bucket,
 	metas map[ulid.ULID]*metadata.Meta,
 	retentionByResolution map[ResolutionLevel]time.Duration,
+	policies []*RetentionPolicy,
+	dryRun bool,
 	blocksMarkedForDeletion prometheus.Counter,
+	retentionBlocksMarked *prometheus.CounterVec,
 ) error {
-	level.Info(logger).Log("msg", "start optional retention")
+	level.Info(logger).Log("msg", "start optional retention", "dryRun", dryRun)
 	for id, m := range metas {
-		retentionDuration := retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
-		if retentionDuration.Seconds() == 0 {
+		retentionDuration, policy := blockRetention(m, retentionByResolution, policies)
+		if !pastRetention(m, retentionDuration) {
 			continue
 		}
-
+		lset := labels.FromMap(m.Thanos.Labels)
 		maxTime := time.Unix(m.MaxTime/1000, 0)
-		if time.Now().After(maxTime.Add(retentionDuration)) {
-			level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", id, "maxTime", maxTime.String())
-			if err := block.MarkForDeletion(ctx, logger, bkt, id, blocksMarkedForDeletion); err != nil {
-				return errors.Wrap(err, "delete block")
-			}
+
+		resolution := resolutionLabel(ResolutionLevel(m.Thanos.Downsample.Resolution))
+		if dryRun {
+			level.Info(logger).Log("msg", "dry run: block past retention would be marked for deletion", "id", id, "resolution", resolution,
+				"labels", lset.String(), "policy", policy, "retention", retentionDuration, "maxTime", maxTime.String())
+			continue
+		}
+
+		level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", id, "resolution", resolution,
+			"labels", lset.String(), "policy", policy, "retention", retentionDuration, "maxTime", maxTime.String())
+		// Counters are only incremented if the block was not marked already.
+		marked := multiCounter{Counter: blocksMarkedForDeletion, others: []prometheus.Counter{retentionBlocksMarked.WithLabelValues(resolution)}}
+		if err := block.MarkForDeletion(ctx, logger, bkt, id, marked); err != nil {
+			return errors.Wrap(err, "delete block")
 		}
 	}
 	level.Info(logger).Log("msg", "optional retention apply done")
@@ -241,20 +241,31 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
 			for _, b := range tt.blocks {
-				uploadMockBlock(t, bkt, b.id, b.minTime, b.maxTime, int64(b.resolution))
+				uploadMockBlock(t, bkt, b.id, b.minTime, b.maxTime, int64(b.resolution), nil)
 			}
 
 			metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
 			testutil.Ok(t, err)
 
 			blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			retentionBlocksMarked := compact.NewRetentionBlocksMarkedCounter(nil)
 
 			metas, _, err := metaFetcher.Fetch(ctx)
 			testutil.Ok(t, err)
 
-			if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, tt.retentionByResolution, blocksMarkedForDeletion); (err != nil) != tt.wantErr {
+			// Dry run must not mark any block.
+			if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, tt.retentionByResolution, nil, true, blocksMarkedForDeletion, retentionBlocksMarked); (err != nil) != tt.wantErr {
+				t.Errorf("ApplyRetentionPolicyByResolution() dry run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			testutil.Equals(t, 0.0, promtest.ToFloat64(blocksMarkedForDeletion))
+
+			if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, tt.retentionByResolution, nil, false, blocksMarkedForDeletion, retentionBlocksMarked); (err != nil) != tt.wantErr {
 				t.Errorf("ApplyRetentionPolicyByResolution() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			// Blocks marked already must not be counted again.
+			if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, tt.retentionByResolution, nil, false, blocksMarkedForDeletion, retentionBlocksMarked); (err != nil) != tt.wantErr {
+				t.Errorf("ApplyRetentionPolicyByResolution() second run error = %v, wantErr %v", err, tt.wantErr)
+			}
 
 			got := []string{}
 			gotMarkedBlocksCount := 0.0
@@ -273,11 +284,77 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 
 			testutil.Equals(t, got, tt.want)
 			testutil.Equals(t, gotMarkedBlocksCount, promtest.ToFloat64(blocksMarkedForDeletion))
+			testutil.Equals(t, gotMarkedBlocksCount, promtest.ToFloat64(retentionBlocksMarked.WithLabelValues("raw"))+
+				promtest.ToFloat64(retentionBlocksMarked.WithLabelValues("5m"))+
+				promtest.ToFloat64(retentionBlocksMarked.WithLabelValues("1h")))
 		})
 	}
 }
 
-func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64) {
+func TestApplyRetentionPolicyByResolution_Policies(t *testing.T) {
+	logger := log.NewNopLogger()
+	ctx := context.TODO()
+
+	policies, err := compact.ParseRetentionPolicies([]byte(`
+- selector: '{cluster="dev"}'
+  retention: 1d
+- selector: '{cluster=~"prod|staging"}'
+  retention: 0d
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(policies))
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	// Blocks of the dev cluster are past retention of their policy, blocks of prod are kept forever.
+	// Blocks of other clusters use the retention by resolution.
+	uploadMockBlock(t, bkt, "01CPHBEX20729MJQZXE3W0BW40", time.Now().Add(-3*24*time.Hour), time.Now().Add(-2*24*time.Hour), 0, map[string]string{"cluster": "dev"})
+	uploadMockBlock(t, bkt, "01CPHBEX20729MJQZXE3W0BW41", time.Now().Add(-10*24*time.Hour), time.Now().Add(-9*24*time.Hour), 0, map[string]string{"cluster": "prod"})
+	uploadMockBlock(t, bkt, "01CPHBEX20729MJQZXE3W0BW42", time.Now().Add(-10*24*time.Hour), time.Now().Add(-9*24*time.Hour), 0, map[string]string{"cluster": "test"})
+	uploadMockBlock(t, bkt, "01CPHBEX20729MJQZXE3W0BW43", time.Now().Add(-3*24*time.Hour), time.Now().Add(-2*24*time.Hour), 0, map[string]string{"cluster": "test"})
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	retentionByResolution := map[compact.ResolutionLevel]time.Duration{compact.ResolutionLevelRaw: 7 * 24 * time.Hour}
+	testutil.Ok(t, compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, retentionByResolution, policies, false,
+		promauto.With(nil).NewCounter(prometheus.CounterOpts{}), compact.NewRetentionBlocksMarkedCounter(nil)))
+
+	var marked []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		exists, err := bkt.Exists(ctx, filepath.Join(name, metadata.DeletionMarkFilename))
+		if err != nil {
+			return err
+		}
+		if exists {
+			marked = append(marked, name)
+		}
+		return nil
+	}))
+	testutil.Equals(t, []string{"01CPHBEX20729MJQZXE3W0BW40/", "01CPHBEX20729MJQZXE3W0BW42/"}, marked)
+	testutil.Equals(t, []ulid.ULID{
+		ulid.MustParse("01CPHBEX20729MJQZXE3W0BW40"),
+		ulid.MustParse("01CPHBEX20729MJQZXE3W0BW42"),
+	}, compact.BlocksPastRetention(metas, retentionByResolution, policies))
+}
+
+func TestParseRetentionPolicies(t *testing.T) {
+	policies, err := compact.ParseRetentionPolicies(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(policies))
+
+	for _, conf := range []string{
+		"- selector: '{cluster=}'\n  retention: 1d\n",
+		"- selector: '{cluster=\"dev\"}'\n  retention: 1x\n",
+		"- selector: '{cluster=\"dev\"}'\n  unknown: 1d\n",
+	} {
+		_, err := compact.ParseRetentionPolicies([]byte(conf))
+		testutil.NotOk(t, err)
+	}
+}
+
+func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64, lset map[string]string) {
 	t.Helper()
 	meta1 := metadata.Meta{
 		BlockMeta: tsdb.BlockMeta{
@@ -287,6 +364,7 @@ func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxT
 			Version: 1,
 		},
 		Thanos: metadata.Thanos{
+			Labels: lset,
 			Downsample: metadata.ThanosDownsample{
 				Resolution: resolutionLevel,
 			},
@@ -0,0 +1,138 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// ShardOwnershipDir is the bucket directory holding a file with the groups owned by every compactor shard.
+	ShardOwnershipDir = "compactor-shards"
+
+	// ShardOwnershipTTL is the time after which the groups owned by a shard that stopped updating them are ignored,
+	// so changing the sharding of compactors does not halt them forever.
+	ShardOwnershipTTL = 24 * time.Hour
+)
+
+// ValidateShardingRelabelConfig returns an error if the given relabel config used to shard compactors could assign
+// blocks of the same compaction group to different shards. That happens if a relabel rule reads the block ID or one of
+// the replica labels ignored by deduplication, as blocks of a group differ in those.
+func ValidateShardingRelabelConfig(relabelConfig []*relabel.Config, replicaLabels []string) error {
+	for i, c := range relabelConfig {
+		for _, l := range c.SourceLabels {
+			if string(l) == block.BlockIDLabel {
+				return errors.Errorf("relabel rule %d: label %s splits compaction groups and cannot be used to shard compactors", i, block.BlockIDLabel)
+			}
+			for _, rl := range replicaLabels {
+				if string(l) == rl {
+					return errors.Errorf("relabel rule %d: replica label %s splits deduplicated compaction groups and cannot be used to shard compactors", i, rl)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// shardOwnership is the content of the file of a shard in ShardOwnershipDir.
+type shardOwnership struct {
+	Shard string `json:"shard"`
+	// Groups are the keys of the groups owned by the shard.
+	Groups []string `json:"groups"`
+	// UpdatedAt is the unix time in seconds of the last update of the file.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// ShardOwnershipChecker ensures that no two compactor shards own the same compaction group. Every shard uploads the keys of
+// its groups to ShardOwnershipDir before compacting them and verifies that none of them is owned by another shard.
+type ShardOwnershipChecker struct {
+	logger log.Logger
+	bkt    objstore.Bucket
+	shard  string
+}
+
+// NewShardOwnershipChecker returns a new ShardOwnershipChecker for the shard with the given name. Every compactor
+// shard needs a unique name, shared by its replicas.
+func NewShardOwnershipChecker(logger log.Logger, bkt objstore.Bucket, shard string) *ShardOwnershipChecker {
+	return &ShardOwnershipChecker{logger: logger, bkt: bkt, shard: shard}
+}
+
+// Check uploads the given groups as owned by the shard and returns a HaltError, if any of them is also owned by another
+// shard that updated its ownership within ShardOwnershipTTL.
+// Check on nil ShardOwnershipChecker returns immediately.
+func (c *ShardOwnershipChecker) Check(ctx context.Context, groups []*Group) error {
+	if c == nil {
+		return nil
+	}
+
+	own := shardOwnership{Shard: c.shard, UpdatedAt: time.Now().Unix()}
+	owned := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		own.Groups = append(own.Groups, g.Key())
+		owned[g.Key()] = struct{}{}
+	}
+	sort.Strings(own.Groups)
+
+	b, err := json.Marshal(own)
+	if err != nil {
+		return errors.Wrap(err, "json encode shard ownership")
+	}
+	ownFile := path.Join(ShardOwnershipDir, c.shard+".json")
+	if err := c.bkt.Upload(ctx, ownFile, bytes.NewReader(b)); err != nil {
+		return retry(errors.Wrapf(err, "upload file %s to bucket", ownFile))
+	}
+
+	return c.bkt.Iter(ctx, ShardOwnershipDir+objstore.DirDelim, func(name string) error {
+		if name == ownFile || !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		other, err := c.read(ctx, name)
+		if err != nil {
+			return retry(err)
+		}
+		if time.Since(time.Unix(other.UpdatedAt, 0)) > ShardOwnershipTTL {
+			level.Debug(c.logger).Log("msg", "ignoring ownership of stale compactor shard", "shard", other.Shard)
+			return nil
+		}
+		for _, key := range other.Groups {
+			if _, ok := owned[key]; ok {
+				return halt(errors.Errorf("group %s is owned by compactor shards %s and %s; compactor sharding configs overlap", key, c.shard, other.Shard))
+			}
+		}
+		return nil
+	})
+}
+
+func (c *ShardOwnershipChecker) read(ctx context.Context, name string) (*shardOwnership, error) {
+	r, err := c.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get file %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(c.logger, r, "close shard ownership reader")
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file %s", name)
+	}
+	var o shardOwnership
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal file %s", name)
+	}
+	return &o, nil
+}
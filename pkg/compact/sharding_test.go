@@ -0,0 +1,68 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestValidateShardingRelabelConfig(t *testing.T) {
+	cfg := func(lbls ...string) []*relabel.Config {
+		var src model.LabelNames
+		for _, l := range lbls {
+			src = append(src, model.LabelName(l))
+		}
+		return []*relabel.Config{{SourceLabels: src, Action: relabel.HashMod, Modulus: 2, TargetLabel: "shard"}}
+	}
+
+	testutil.Ok(t, ValidateShardingRelabelConfig(nil, []string{"replica"}))
+	testutil.Ok(t, ValidateShardingRelabelConfig(cfg("cluster"), []string{"replica"}))
+	testutil.NotOk(t, ValidateShardingRelabelConfig(cfg("cluster", block.BlockIDLabel), nil))
+	testutil.NotOk(t, ValidateShardingRelabelConfig(cfg("cluster", "replica"), []string{"replica"}))
+}
+
+func TestShardOwnershipChecker(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	newTestGroup := func(cluster string) *Group {
+		g, err := newGroup(nil, bkt, labels.FromStrings("cluster", cluster), 0, "", GroupOptions{}, newTestGroupMetrics())
+		testutil.Ok(t, err)
+		return g
+	}
+	a, b, c := newTestGroup("a"), newTestGroup("b"), newTestGroup("c")
+
+	var nop *ShardOwnershipChecker
+	testutil.Ok(t, nop.Check(ctx, []*Group{a}))
+
+	shard1 := NewShardOwnershipChecker(log.NewNopLogger(), bkt, "1")
+	shard2 := NewShardOwnershipChecker(log.NewNopLogger(), bkt, "2")
+	testutil.Ok(t, shard1.Check(ctx, []*Group{a, b}))
+	testutil.Ok(t, shard2.Check(ctx, []*Group{c}))
+	// Checks are repeatable.
+	testutil.Ok(t, shard1.Check(ctx, []*Group{a, b}))
+
+	err := shard2.Check(ctx, []*Group{b, c})
+	testutil.NotOk(t, err)
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	// Ownership of stale shards is ignored.
+	stale, err := json.Marshal(shardOwnership{Shard: "1", Groups: []string{b.Key()}, UpdatedAt: time.Now().Add(-ShardOwnershipTTL - time.Hour).Unix()})
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(ShardOwnershipDir, "1.json"), bytes.NewReader(stale)))
+	testutil.Ok(t, shard2.Check(ctx, []*Group{b, c}))
+}
@@ -0,0 +1,162 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// shouldSplit returns true if the compacted block with the given index has to be split into shards.
+// Blocks which are shards already are never split again, so shards of all blocks of the group stay aligned.
+func (cg *Group) shouldSplit(index string) (bool, error) {
+	if cg.splitIndexSize <= 0 || cg.splitShards < 2 {
+		return false, nil
+	}
+	fi, err := os.Stat(index)
+	if err != nil {
+		return false, errors.Wrapf(err, "stat index %s", index)
+	}
+	if fi.Size() <= cg.splitIndexSize {
+		return false, nil
+	}
+	if cg.shard != "" {
+		level.Warn(cg.logger).Log("msg", "compacted block of a shard exceeds the split index size; shards are not split again",
+			"index", index, "indexSize", fi.Size(), "limit", cg.splitIndexSize, "shard", cg.shard)
+		return false, nil
+	}
+	level.Info(cg.logger).Log("msg", "compacted block exceeds the split index size; splitting it into shards",
+		"index", index, "indexSize", fi.Size(), "limit", cg.splitIndexSize, "shards", cg.splitShards)
+	return true, nil
+}
+
+// splitBlock writes series of the compacted block in bdir into splitShards new blocks in dir by series hash. Shard
+// blocks get the shard in meta.json and keep the compaction details, e.g. sources, of the split block. It returns
+// directories of shard blocks; shards without series are not written.
+func (cg *Group) splitBlock(dir, bdir string, meta *metadata.Meta, comp tsdb.Compactor) (res []string, err error) {
+	var pool chunkenc.Pool
+	if cg.resolution != int64(ResolutionLevelRaw) {
+		pool = downsample.NewPool()
+	}
+	b, err := tsdb.OpenBlock(cg.logger, bdir, pool)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open block %s", bdir)
+	}
+	defer runutil.CloseWithLogOnErr(log.With(cg.logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
+
+	for i := 0; i < cg.splitShards; i++ {
+		id, err := comp.Write(dir, &shardBlockReader{BlockReader: b, shard: uint64(i), shards: uint64(cg.splitShards)}, meta.MinTime, meta.MaxTime, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "write shard %d", i)
+		}
+		if id == (ulid.ULID{}) {
+			continue
+		}
+		sdir := filepath.Join(dir, id.String())
+		if _, err := metadata.InjectThanos(cg.logger, sdir, metadata.Thanos{
+			Labels:     meta.Thanos.Labels,
+			Downsample: meta.Thanos.Downsample,
+			Source:     metadata.CompactorSource,
+			Shard:      metadata.ShardID(i, cg.splitShards),
+			Lineage:    metadata.NewLineage(metadata.LineageSplit, metadata.CompactorSource, []*metadata.Meta{meta}),
+		}, &meta.BlockMeta); err != nil {
+			return nil, errors.Wrapf(err, "finalize shard block %s", sdir)
+		}
+		if err := os.Remove(filepath.Join(sdir, "tombstones")); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "remove tombstones")
+		}
+		if err := block.VerifyIndex(cg.logger, filepath.Join(sdir, block.IndexFilename), meta.MinTime, meta.MaxTime); !cg.acceptMalformedIndex && err != nil {
+			return nil, halt(errors.Wrapf(err, "invalid shard block %s", sdir))
+		}
+		res = append(res, sdir)
+	}
+	return res, nil
+}
+
+// shardBlockReader is a tsdb.BlockReader exposing only series of the block, whose label hash belongs to the shard.
+type shardBlockReader struct {
+	tsdb.BlockReader
+
+	shard, shards uint64
+}
+
+func (r *shardBlockReader) Index() (tsdb.IndexReader, error) {
+	ir, err := r.BlockReader.Index()
+	if err != nil {
+		return nil, err
+	}
+	return &shardIndexReader{IndexReader: ir, shard: r.shard, shards: r.shards}, nil
+}
+
+type shardIndexReader struct {
+	tsdb.IndexReader
+
+	shard, shards uint64
+}
+
+func (r *shardIndexReader) Postings(name string, values ...string) (index.Postings, error) {
+	p, err := r.IndexReader.Postings(name, values...)
+	if err != nil {
+		return nil, err
+	}
+	return &shardPostings{Postings: p, r: r}, nil
+}
+
+// shardPostings filters postings to series of the shard.
+type shardPostings struct {
+	index.Postings
+
+	r    *shardIndexReader
+	lset labels.Labels
+	chks []chunks.Meta
+	err  error
+}
+
+func (p *shardPostings) inShard() bool {
+	if err := p.r.IndexReader.Series(p.Postings.At(), &p.lset, &p.chks); err != nil {
+		p.err = errors.Wrapf(err, "get series %d", p.Postings.At())
+		return false
+	}
+	return p.lset.Hash()%p.r.shards == p.r.shard
+}
+
+func (p *shardPostings) Next() bool {
+	for p.err == nil && p.Postings.Next() {
+		if p.inShard() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *shardPostings) Seek(v uint64) bool {
+	if p.err != nil || !p.Postings.Seek(v) {
+		return false
+	}
+	if p.inShard() {
+		return true
+	}
+	return p.Next()
+}
+
+func (p *shardPostings) Err() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.Postings.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestGroup_SplitBlock(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "test-split")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	var series []labels.Labels
+	for i := 0; i < 100; i++ {
+		series = append(series, labels.FromStrings("__name__", "up", "a", fmt.Sprintf("%d", i)))
+	}
+	extLset := labels.FromStrings("cluster", "eu1")
+
+	id, err := e2eutil.CreateBlock(ctx, dir, series, 10, 0, 1100, extLset, 0)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(dir, id.String())
+	meta, err := metadata.Read(bdir)
+	testutil.Ok(t, err)
+
+	newTestGroup := func(shard string, splitIndexSize int64) *Group {
+		g, err := newGroup(logger, objstore.NewInMemBucket(), extLset, 0, shard, GroupOptions{SplitIndexSize: splitIndexSize, SplitShards: 2}, newTestGroupMetrics())
+		testutil.Ok(t, err)
+		return g
+	}
+
+	index := filepath.Join(bdir, block.IndexFilename)
+	split, err := newTestGroup("", 0).shouldSplit(index)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !split, "unexpected split with disabled splitting")
+	split, err = newTestGroup("", 1<<30).shouldSplit(index)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !split, "unexpected split of small block")
+	split, err = newTestGroup(metadata.ShardID(0, 2), 1).shouldSplit(index)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !split, "unexpected split of shard")
+
+	g := newTestGroup("", 1)
+	split, err = g.shouldSplit(index)
+	testutil.Ok(t, err)
+	testutil.Assert(t, split, "expected split")
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1100}, nil)
+	testutil.Ok(t, err)
+	res, err := g.splitBlock(dir, bdir, meta, comp)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(res))
+
+	var numSeries, numSamples uint64
+	for i, sdir := range res {
+		smeta, err := metadata.Read(sdir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, metadata.ShardID(i, 2), smeta.Thanos.Shard)
+		testutil.Equals(t, extLset.Map(), smeta.Thanos.Labels)
+		testutil.Equals(t, meta.Compaction, smeta.Compaction)
+		testutil.Equals(t, meta.MinTime, smeta.MinTime)
+		testutil.Equals(t, meta.MaxTime, smeta.MaxTime)
+		testutil.Assert(t, smeta.Stats.NumSeries > 0, "expected series in shard %d", i)
+
+		numSeries += smeta.Stats.NumSeries
+		numSamples += smeta.Stats.NumSamples
+	}
+	testutil.Equals(t, meta.Stats.NumSeries, numSeries)
+	testutil.Equals(t, meta.Stats.NumSamples, numSamples)
+}
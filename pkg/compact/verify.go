@@ -0,0 +1,203 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+type verificationSample struct {
+	t int64
+	v float64
+}
+
+// verifyCompaction checks that series sampled randomly from the source block dirs have exactly the same samples
+// in the compacted block dir. Up to seriesPerBlock series are sampled from every source block, so compaction
+// mangling data is likely, but not guaranteed to be caught.
+// Samples with the same timestamp in multiple sources, i.e. from overlapping blocks, are expected once with
+// a value from any of the sources.
+func verifyCompaction(logger log.Logger, sourceDirs []string, compactedDir string, seriesPerBlock int) (err error) {
+	begin := time.Now()
+
+	var sources []*tsdb.Block
+	defer func() {
+		for _, b := range sources {
+			runutil.CloseWithErrCapture(&err, b, "close source block")
+		}
+	}()
+	for _, dir := range sourceDirs {
+		b, err := tsdb.OpenBlock(logger, dir, nil)
+		if err != nil {
+			return errors.Wrapf(err, "open source block %s", dir)
+		}
+		sources = append(sources, b)
+	}
+
+	compacted, err := tsdb.OpenBlock(logger, compactedDir, nil)
+	if err != nil {
+		return errors.Wrapf(err, "open compacted block %s", compactedDir)
+	}
+	defer runutil.CloseWithErrCapture(&err, compacted, "close compacted block")
+
+	var (
+		sampled = map[string]labels.Labels{}
+		keys    []string
+	)
+	for _, b := range sources {
+		lsets, err := sampleSeries(b, seriesPerBlock)
+		if err != nil {
+			return errors.Wrapf(err, "sample series of block %s", b.Meta().ULID)
+		}
+		for _, lset := range lsets {
+			k := lset.String()
+			if _, ok := sampled[k]; ok {
+				continue
+			}
+			sampled[k] = lset
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		lset := sampled[k]
+		matchers := make([]*labels.Matcher, 0, len(lset))
+		for _, l := range lset {
+			matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, l.Name, l.Value))
+		}
+
+		var expected []verificationSample
+		for _, b := range sources {
+			smpls, err := selectSamples(b, lset, matchers)
+			if err != nil {
+				return errors.Wrapf(err, "select series %s from source block %s", k, b.Meta().ULID)
+			}
+			expected = append(expected, smpls...)
+		}
+		sort.SliceStable(expected, func(i, j int) bool { return expected[i].t < expected[j].t })
+
+		got, err := selectSamples(compacted, lset, matchers)
+		if err != nil {
+			return errors.Wrapf(err, "select series %s from compacted block", k)
+		}
+		if err := compareSamples(expected, got); err != nil {
+			return errors.Wrapf(err, "series %s", k)
+		}
+	}
+
+	level.Info(logger).Log("msg", "verified compacted block", "block", compactedDir, "series", len(keys), "duration", time.Since(begin))
+	return nil
+}
+
+// sampleSeries returns label sets of up to n series chosen randomly from the block.
+func sampleSeries(b *tsdb.Block, n int) (_ []labels.Labels, err error) {
+	ir, err := b.Index()
+	if err != nil {
+		return nil, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "close index reader")
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "get all postings")
+	}
+	var refs []uint64
+	for p.Next() {
+		refs = append(refs, p.At())
+	}
+	if err := p.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterate postings")
+	}
+
+	rand.Shuffle(len(refs), func(i, j int) { refs[i], refs[j] = refs[j], refs[i] })
+	if len(refs) > n {
+		refs = refs[:n]
+	}
+
+	res := make([]labels.Labels, 0, len(refs))
+	for _, ref := range refs {
+		var (
+			lset labels.Labels
+			chks []chunks.Meta
+		)
+		if err := ir.Series(ref, &lset, &chks); err != nil {
+			return nil, errors.Wrapf(err, "read series %d", ref)
+		}
+		res = append(res, lset)
+	}
+	return res, nil
+}
+
+// selectSamples returns all samples of the series with exactly the given labels in the block.
+func selectSamples(b *tsdb.Block, lset labels.Labels, matchers []*labels.Matcher) (_ []verificationSample, err error) {
+	q, err := tsdb.NewBlockQuerier(b, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, errors.Wrap(err, "create querier")
+	}
+	defer runutil.CloseWithErrCapture(&err, q, "close querier")
+
+	set, err := q.Select(matchers...)
+	if err != nil {
+		return nil, errors.Wrap(err, "select")
+	}
+
+	var res []verificationSample
+	for set.Next() {
+		s := set.At()
+		// Matchers select also series with additional labels.
+		if !labels.Equal(s.Labels(), lset) {
+			continue
+		}
+		it := s.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			res = append(res, verificationSample{t: t, v: v})
+		}
+		if err := it.Err(); err != nil {
+			return nil, errors.Wrap(err, "iterate samples")
+		}
+	}
+	return res, set.Err()
+}
+
+// compareSamples returns an error if got does not contain exactly one sample for every timestamp of expected,
+// with a value equal to any of the expected values for that timestamp.
+func compareSamples(expected, got []verificationSample) error {
+	var i int
+	for j := 0; j < len(expected); {
+		if i >= len(got) {
+			return errors.Errorf("sample at %d missing in compacted block", expected[j].t)
+		}
+		if got[i].t != expected[j].t {
+			return errors.Errorf("expected sample at %d, got sample at %d in compacted block", expected[j].t, got[i].t)
+		}
+
+		matched := false
+		for ; j < len(expected) && expected[j].t == got[i].t; j++ {
+			if math.Float64bits(expected[j].v) == math.Float64bits(got[i].v) {
+				matched = true
+			}
+		}
+		if !matched {
+			return errors.Errorf("unexpected value %v of sample at %d in compacted block", got[i].v, got[i].t)
+		}
+		i++
+	}
+	if i < len(got) {
+		return errors.Errorf("unexpected sample at %d in compacted block", got[i].t)
+	}
+	return nil
+}
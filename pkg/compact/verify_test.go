@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestVerifyCompaction(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "verify-compaction")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+		labels.FromStrings("a", "2", "b", "1"),
+	}
+	extLset := labels.FromStrings("ext", "1")
+
+	var sources []string
+	for _, r := range [][2]int64{{0, 1000}, {1000, 2000}} {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 100, r[0], r[1], extLset, 0)
+		testutil.Ok(t, err)
+		sources = append(sources, filepath.Join(dir, id.String()))
+	}
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 2000}, nil)
+	testutil.Ok(t, err)
+	id, err := comp.Compact(dir, sources, nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, verifyCompaction(logger, sources, filepath.Join(dir, id.String()), 10))
+
+	// Block with the same series, but different sample values is not a valid result of the compaction.
+	id, err = e2eutil.CreateBlock(ctx, dir, series, 200, 0, 2000, extLset, 0)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, verifyCompaction(logger, sources, filepath.Join(dir, id.String()), 10))
+
+	// Missing series are detected as well.
+	id, err = comp.Compact(dir, sources[:1], nil)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, verifyCompaction(logger, sources, filepath.Join(dir, id.String()), 10))
+}
+
+func TestCompareSamples(t *testing.T) {
+	staleNaN := math.Float64frombits(value.StaleNaN)
+
+	for _, tcase := range []struct {
+		name     string
+		expected []verificationSample
+		got      []verificationSample
+		ok       bool
+	}{
+		{name: "empty", ok: true},
+		{
+			name:     "equal",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 2, v: staleNaN}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 2, v: staleNaN}},
+			ok:       true,
+		},
+		{
+			name:     "overlapping sources",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 2, v: 2}, {t: 2, v: 3}, {t: 3, v: 3}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 2, v: 3}, {t: 3, v: 3}},
+			ok:       true,
+		},
+		{
+			name:     "missing sample",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 2, v: 2}},
+			got:      []verificationSample{{t: 1, v: 1}},
+		},
+		{
+			name:     "additional sample",
+			expected: []verificationSample{{t: 1, v: 1}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 2, v: 2}},
+		},
+		{
+			name:     "different timestamp",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 2, v: 2}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 3, v: 2}},
+		},
+		{
+			name:     "different value",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 2, v: 2}, {t: 2, v: 3}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 2, v: 4}},
+		},
+		{
+			name:     "duplicated sample",
+			expected: []verificationSample{{t: 1, v: 1}, {t: 1, v: 1}},
+			got:      []verificationSample{{t: 1, v: 1}, {t: 1, v: 1}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := compareSamples(tcase.expected, tcase.got)
+			if tcase.ok {
+				testutil.Ok(t, err)
+				return
+			}
+			testutil.NotOk(t, err)
+		})
+	}
+}
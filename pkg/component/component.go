@@ -87,13 +87,14 @@ func FromProto(storeType storepb.StoreType) StoreAPI {
 }
 
 var (
-	Bucket     = source{component: component{name: "bucket"}}
-	Compact    = source{component: component{name: "compact"}}
-	Downsample = source{component: component{name: "downsample"}}
-	Query      = sourceStoreAPI{component: component{name: "query"}}
-	Rule       = sourceStoreAPI{component: component{name: "rule"}}
-	Sidecar    = sourceStoreAPI{component: component{name: "sidecar"}}
-	Store      = sourceStoreAPI{component: component{name: "store"}}
-	Receive    = sourceStoreAPI{component: component{name: "receive"}}
-	Replicate  = sourceStoreAPI{component: component{name: "replicate"}}
+	Bucket        = source{component: component{name: "bucket"}}
+	Compact       = source{component: component{name: "compact"}}
+	Downsample    = source{component: component{name: "downsample"}}
+	Query         = sourceStoreAPI{component: component{name: "query"}}
+	Rule          = sourceStoreAPI{component: component{name: "rule"}}
+	Sidecar       = sourceStoreAPI{component: component{name: "sidecar"}}
+	Store         = sourceStoreAPI{component: component{name: "store"}}
+	Receive       = sourceStoreAPI{component: component{name: "receive"}}
+	Replicate     = sourceStoreAPI{component: component{name: "replicate"}}
+	QueryFrontend = component{name: "query-frontend"}
 )
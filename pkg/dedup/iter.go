@@ -0,0 +1,182 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package dedup merges replicas of the same series into one, as done by the querier deduplication and by the
+// compactor for overlapping replica blocks.
+package dedup
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+type series struct {
+	lset     labels.Labels
+	replicas []storage.Series
+	counter  bool
+}
+
+// NewSeries returns series merging the given replicas of the same series into one with the penalty based algorithm
+// of NewSeriesIterator. If counter is true, the replicas are counters and the merged series never decreases when
+// switching replicas.
+func NewSeries(lset labels.Labels, counter bool, replicas ...storage.Series) storage.Series {
+	return &series{lset: lset, replicas: replicas, counter: counter}
+}
+
+func (s *series) Labels() labels.Labels {
+	return s.lset
+}
+
+func (s *series) Iterator() (it storage.SeriesIterator) {
+	it = s.replicas[0].Iterator()
+	for _, o := range s.replicas[1:] {
+		it = NewSeriesIterator(it, o.Iterator(), s.counter)
+	}
+	return it
+}
+
+type seriesIterator struct {
+	a, b storage.SeriesIterator
+
+	aok, bok   bool
+	lastT      int64
+	penA, penB int64
+	useA       bool
+
+	// counter makes the iterator adjust values of counters when switching replicas.
+	counter    bool
+	lastV      float64
+	adjA, adjB float64
+}
+
+// NewSeriesIterator returns an iterator merging the samples of two replicas of the same series. It sticks to one
+// replica and switches to the other one only if a gap longer than twice the last sampling interval appears.
+// If counter is true, values of the replicas are adjusted so that the merged counter never decreases on a switch.
+func NewSeriesIterator(a, b storage.SeriesIterator, counter bool) storage.SeriesIterator {
+	return &seriesIterator{
+		a:       a,
+		b:       b,
+		lastT:   math.MinInt64,
+		aok:     true,
+		bok:     true,
+		counter: counter,
+	}
+}
+
+func (it *seriesIterator) Next() bool {
+	started, useA := it.lastT != math.MinInt64, it.useA
+	if !it.next() {
+		return false
+	}
+	if it.counter {
+		it.adjustCounter(started && useA != it.useA)
+	}
+	return true
+}
+
+// adjustCounter keeps the deduplicated counter from decreasing when switching to another replica. Replicas
+// restarted at different times, or normalized from different first samples, have different counter values, so
+// the switch to a replica with a lower value would look like a counter reset and cause a spike in rate and increase.
+func (it *seriesIterator) adjustCounter(switched bool) {
+	_, v := it.At()
+	if switched && v < it.lastV {
+		if it.useA {
+			it.adjA += it.lastV - v
+		} else {
+			it.adjB += it.lastV - v
+		}
+		v = it.lastV
+	}
+	it.lastV = v
+}
+
+func (it *seriesIterator) next() bool {
+	// Advance both iterators to at least the next highest timestamp plus the potential penalty.
+	if it.aok {
+		it.aok = it.a.Seek(it.lastT + 1 + it.penA)
+	}
+	if it.bok {
+		it.bok = it.b.Seek(it.lastT + 1 + it.penB)
+	}
+	// Handle basic cases where one iterator is exhausted before the other.
+	if !it.aok {
+		it.useA = false
+		if it.bok {
+			it.lastT, _ = it.b.At()
+			it.penB = 0
+		}
+		return it.bok
+	}
+	if !it.bok {
+		it.useA = true
+		it.lastT, _ = it.a.At()
+		it.penA = 0
+		return true
+	}
+	// General case where both iterators still have data. We pick the one
+	// with the smaller timestamp.
+	// The applied penalty potentially already skipped potential samples already
+	// that would have resulted in exaggerated sampling frequency.
+	ta, _ := it.a.At()
+	tb, _ := it.b.At()
+
+	it.useA = ta <= tb
+
+	// For the series we didn't pick, add a penalty twice as high as the delta of the last two
+	// samples to the next seek against it.
+	// This ensures that we don't pick a sample too close, which would increase the overall
+	// sample frequency. It also guards against clock drift and inaccuracies during
+	// timestamp assignment.
+	// If we don't know a delta yet, we pick 5000 as a constant, which is based on the knowledge
+	// that timestamps are in milliseconds and sampling frequencies typically multiple seconds long.
+	const initialPenality = 5000
+
+	if it.useA {
+		if it.lastT != math.MinInt64 {
+			it.penB = 2 * (ta - it.lastT)
+		} else {
+			it.penB = initialPenality
+		}
+		it.penA = 0
+		it.lastT = ta
+		return true
+	}
+	if it.lastT != math.MinInt64 {
+		it.penA = 2 * (tb - it.lastT)
+	} else {
+		it.penA = initialPenality
+	}
+	it.penB = 0
+	it.lastT = tb
+	return true
+}
+
+func (it *seriesIterator) Seek(t int64) bool {
+	for {
+		ts, _ := it.At()
+		if ts > 0 && ts >= t {
+			return true
+		}
+		if !it.Next() {
+			return false
+		}
+	}
+}
+
+func (it *seriesIterator) At() (int64, float64) {
+	if it.useA {
+		t, v := it.a.At()
+		return t, v + it.adjA
+	}
+	t, v := it.b.At()
+	return t, v + it.adjB
+}
+
+func (it *seriesIterator) Err() error {
+	if it.a.Err() != nil {
+		return it.a.Err()
+	}
+	return it.b.Err()
+}
@@ -0,0 +1,177 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSeriesIterator(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	// The deltas between timestamps should be at least 10000 to not be affected
+	// by the initial penalty of 5000, that will cause the second iterator to seek
+	// ahead this far at least once.
+	cases := []struct {
+		a, b, exp []sample
+	}{
+		{ // Generally prefer the first series.
+			a:   []sample{{10000, 10}, {20000, 11}, {30000, 12}, {40000, 13}},
+			b:   []sample{{10000, 20}, {20000, 21}, {30000, 22}, {40000, 23}},
+			exp: []sample{{10000, 10}, {20000, 11}, {30000, 12}, {40000, 13}},
+		},
+		{ // Prefer b if it starts earlier.
+			a:   []sample{{10100, 1}, {20100, 1}, {30100, 1}, {40100, 1}},
+			b:   []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
+			exp: []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
+		},
+		{ // Don't switch series on a single delta sized gap.
+			a:   []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+			b:   []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
+			exp: []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+		},
+		{
+			a:   []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+			b:   []sample{{15000, 2}, {25000, 2}, {35000, 2}, {45000, 2}},
+			exp: []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+		},
+		{ // Once the gap gets bigger than 2 deltas, switch and stay with the new series.
+			a:   []sample{{10000, 1}, {20000, 1}, {30000, 1}, {60000, 1}, {70000, 1}},
+			b:   []sample{{10100, 2}, {20100, 2}, {30100, 2}, {40100, 2}, {50100, 2}, {60100, 2}},
+			exp: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {50100, 2}, {60100, 2}},
+		},
+	}
+	for i, c := range cases {
+		t.Logf("case %d:", i)
+		it := NewSeriesIterator(
+			&sampleIterator{l: c.a, i: -1},
+			&sampleIterator{l: c.b, i: -1},
+			false,
+		)
+		res := expandSeries(t, it)
+		testutil.Equals(t, c.exp, res)
+	}
+}
+
+func TestSeriesIterator_Counter(t *testing.T) {
+	// Replica b has lower counter values, switching to it must not look like a counter reset.
+	a := []sample{{10000, 10}, {20000, 11}, {30000, 12}, {60000, 15}, {70000, 16}}
+	b := []sample{{10100, 5}, {20100, 6}, {30100, 7}, {40100, 8}, {50100, 9}, {60100, 10}}
+
+	it := NewSeriesIterator(&sampleIterator{l: a, i: -1}, &sampleIterator{l: b, i: -1}, false)
+	testutil.Equals(t, []sample{{10000, 10}, {20000, 11}, {30000, 12}, {50100, 9}, {60100, 10}}, expandSeries(t, it))
+
+	it = NewSeriesIterator(&sampleIterator{l: a, i: -1}, &sampleIterator{l: b, i: -1}, true)
+	testutil.Equals(t, []sample{{10000, 10}, {20000, 11}, {30000, 12}, {50100, 12}, {60100, 13}}, expandSeries(t, it))
+}
+
+func BenchmarkSeriesIterator(b *testing.B) {
+	run := func(b *testing.B, s1, s2 []sample) {
+		it := NewSeriesIterator(
+			&sampleIterator{l: s1, i: -1},
+			&sampleIterator{l: s2, i: -1},
+			false,
+		)
+		b.ResetTimer()
+		var total int64
+
+		for it.Next() {
+			t, _ := it.At()
+			total += t
+		}
+		fmt.Fprint(ioutil.Discard, total)
+	}
+	b.Run("equal", func(b *testing.B) {
+		var s1, s2 []sample
+
+		for i := 0; i < b.N; i++ {
+			s1 = append(s1, sample{t: int64(i * 10000), v: 1})
+		}
+		for i := 0; i < b.N; i++ {
+			s2 = append(s2, sample{t: int64(i * 10000), v: 2})
+		}
+		run(b, s1, s2)
+	})
+	b.Run("fixed-delta", func(b *testing.B) {
+		var s1, s2 []sample
+
+		for i := 0; i < b.N; i++ {
+			s1 = append(s1, sample{t: int64(i * 10000), v: 1})
+		}
+		for i := 0; i < b.N; i++ {
+			s2 = append(s2, sample{t: int64(i*10000) + 10, v: 2})
+		}
+		run(b, s1, s2)
+	})
+	b.Run("minor-rand-delta", func(b *testing.B) {
+		var s1, s2 []sample
+
+		for i := 0; i < b.N; i++ {
+			s1 = append(s1, sample{t: int64(i*10000) + rand.Int63n(5000), v: 1})
+		}
+		for i := 0; i < b.N; i++ {
+			s2 = append(s2, sample{t: int64(i*10000) + +rand.Int63n(5000), v: 2})
+		}
+		run(b, s1, s2)
+	})
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func expandSeries(t testing.TB, it storage.SeriesIterator) (res []sample) {
+	for it.Next() {
+		t, v := it.At()
+		res = append(res, sample{t, v})
+	}
+	testutil.Ok(t, it.Err())
+	return res
+}
+
+type sampleIterator struct {
+	l []sample
+	i int
+}
+
+func (s *sampleIterator) Err() error {
+	return nil
+}
+
+func (s *sampleIterator) At() (int64, float64) {
+	return s.l[s.i].t, s.l[s.i].v
+}
+
+func (s *sampleIterator) Next() bool {
+	if s.i >= len(s.l) {
+		return false
+	}
+	s.i++
+	return s.i < len(s.l)
+}
+
+func (s *sampleIterator) Seek(t int64) bool {
+	if s.i < 0 {
+		s.i = 0
+	}
+	for {
+		if s.i >= len(s.l) {
+			return false
+		}
+		if s.l[s.i].t >= t {
+			return true
+		}
+		s.i++
+	}
+}
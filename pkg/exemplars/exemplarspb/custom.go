@@ -0,0 +1,20 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package exemplarspb
+
+func NewExemplarsResponse(data *ExemplarData) *ExemplarsResponse {
+	return &ExemplarsResponse{
+		Result: &ExemplarsResponse_Data{
+			Data: data,
+		},
+	}
+}
+
+func NewWarnExemplarsResponse(warning error) *ExemplarsResponse {
+	return &ExemplarsResponse{
+		Result: &ExemplarsResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
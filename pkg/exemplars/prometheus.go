@@ -0,0 +1,157 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package exemplars
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus implements exemplarspb.ExemplarsServer by proxying the exemplars API of a Prometheus server.
+type Prometheus struct {
+	base           *url.URL
+	client         *promclient.Client
+	externalLabels func() labels.Labels
+	supported      func() bool
+}
+
+// NewPrometheus returns a new Prometheus exemplars server. The given external labels are attached to the labels of
+// all returned series, the same way the store API does.
+func NewPrometheus(base *url.URL, client *promclient.Client, externalLabels func() labels.Labels) *Prometheus {
+	return &Prometheus{
+		base:           base,
+		client:         client,
+		externalLabels: externalLabels,
+	}
+}
+
+// WithSupported sets the function telling whether Prometheus serves exemplars. If it returns false, requests fail
+// with codes.Unimplemented instead of being proxied. By default all requests are proxied.
+func (p *Prometheus) WithSupported(supported func() bool) {
+	p.supported = supported
+}
+
+// Exemplars returns exemplars of series selected by the requested query.
+func (p *Prometheus) Exemplars(r *exemplarspb.ExemplarsRequest, s exemplarspb.Exemplars_ExemplarsServer) error {
+	if p.supported != nil && !p.supported() {
+		return status.Error(codes.Unimplemented, "exemplars are not supported by Prometheus; v2.26 or newer with exemplar-storage feature enabled is required")
+	}
+
+	extLset := p.externalLabels()
+	data, err := p.client.ExemplarsInGRPC(s.Context(), p.base, stripExternalLabelMatchers(r.Query, extLset), r.Start, r.End)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range data {
+		d.SeriesLabels.Labels = extendLabels(d.SeriesLabels.Labels, extLset)
+		if err := s.Send(exemplarspb.NewExemplarsResponse(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripExternalLabelMatchers returns the given query with the matchers on the given external labels removed from its
+// series selectors, as Prometheus does not know its external labels. Selectors with a matcher not matching the value
+// of its external label select no series. Queries which cannot be parsed are returned as they are, so that Prometheus
+// reports the error.
+func stripExternalLabelMatchers(query string, extLset labels.Labels) string {
+	if len(extLset) == 0 {
+		return query
+	}
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return query
+	}
+
+	var stripErr error
+	promql.Inspect(expr, func(node promql.Node, _ []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.VectorSelector:
+			n.LabelMatchers = stripMatchers(n.LabelMatchers, extLset)
+		case *promql.Call:
+			// Matrix selectors are only function arguments. They are replaced by matrix selectors of the stripped
+			// matchers and the same range and offset.
+			for i, arg := range n.Args {
+				m, ok := arg.(*promql.MatrixSelector)
+				if !ok {
+					continue
+				}
+				str := m.String()
+				ms, err := promql.ParseMetricSelector(str[:strings.LastIndex(str, "[")])
+				if err != nil {
+					stripErr = err
+					return err
+				}
+				vs := &promql.VectorSelector{LabelMatchers: stripMatchers(ms, extLset)}
+				if n.Args[i], err = promql.ParseExpr(vs.String() + str[strings.LastIndex(str, "["):]); err != nil {
+					stripErr = err
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if stripErr != nil {
+		return query
+	}
+	return expr.String()
+}
+
+// stripMatchers returns the given matchers without the matchers on the given external labels. If one of them does not
+// match the value of its external label, a matcher selecting no series is returned instead.
+func stripMatchers(ms []*labels.Matcher, extLset labels.Labels) []*labels.Matcher {
+	res := make([]*labels.Matcher, 0, len(ms))
+	for _, m := range ms {
+		v := extLset.Get(m.Name)
+		if v == "" {
+			res = append(res, m)
+			continue
+		}
+		if !m.Matches(v) {
+			return []*labels.Matcher{noSeriesMatcher}
+		}
+	}
+	for _, m := range res {
+		if !m.Matches("") {
+			return res
+		}
+	}
+	// Selectors need a matcher not matching the empty string.
+	return append(res, anySeriesMatcher)
+}
+
+var (
+	noSeriesMatcher  = mustNewMatcher(labels.MatchNotRegexp, labels.MetricName, ".*")
+	anySeriesMatcher = mustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+")
+)
+
+func mustNewMatcher(t labels.MatchType, name, value string) *labels.Matcher {
+	m, err := labels.NewMatcher(t, name, value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// extendLabels sets the given external labels on the given labels, overriding labels with the same name.
+func extendLabels(lset []storepb.Label, extLset labels.Labels) []storepb.Label {
+	if len(extLset) == 0 {
+		return lset
+	}
+	b := labels.NewBuilder(storepb.LabelsToPromLabels(lset))
+	for _, l := range extLset {
+		b.Set(l.Name, l.Value)
+	}
+	return storepb.PromLabelsToLabels(b.Labels())
+}
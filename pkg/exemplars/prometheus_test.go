@@ -0,0 +1,157 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package exemplars
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type exemplarsServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	exemplarspb.Exemplars_ExemplarsServer
+	ctx context.Context
+
+	data []*exemplarspb.ExemplarData
+}
+
+func (s *exemplarsServer) Send(r *exemplarspb.ExemplarsResponse) error {
+	s.data = append(s.data, r.GetData())
+	return nil
+}
+
+func (s *exemplarsServer) Context() context.Context {
+	return s.ctx
+}
+
+func TestPrometheus_Exemplars(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/query_exemplars", r.URL.Path)
+		query = r.URL.Query()
+		_, _ = w.Write([]byte(`{"status":"success","data":[{"seriesLabels":{"__name__":"http_requests_total","region":"us"},"exemplars":[{"labels":{"trace_id":"abc"},"value":"6","timestamp":1600096945.479}]}]}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	p := NewPrometheus(u, promclient.NewClient(nil, http.DefaultClient), func() labels.Labels {
+		return labels.FromStrings("region", "eu", "replica", "a")
+	})
+	s := &exemplarsServer{ctx: context.Background()}
+	testutil.Ok(t, p.Exemplars(&exemplarspb.ExemplarsRequest{Query: `http_requests_total{region="eu"}`, Start: 1600096000000, End: 1600097000500}, s))
+
+	// Matchers on external labels are not forwarded to Prometheus.
+	testutil.Equals(t, "http_requests_total", query.Get("query"))
+	testutil.Equals(t, "1600096000", query.Get("start"))
+	testutil.Equals(t, "1600097000.5", query.Get("end"))
+
+	testutil.Equals(t, []*exemplarspb.ExemplarData{
+		{
+			// External labels override labels of the series.
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{
+				{Name: "__name__", Value: "http_requests_total"},
+				{Name: "region", Value: "eu"},
+				{Name: "replica", Value: "a"},
+			}},
+			Exemplars: []exemplarspb.Exemplar{
+				{
+					Labels: storepb.LabelSet{Labels: []storepb.Label{{Name: "trace_id", Value: "abc"}}},
+					Value:  6,
+					Ts:     1600096945479,
+				},
+			},
+		},
+	}, s.data)
+}
+
+func TestPrometheus_ExemplarsNotSupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("unexpected request to %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	p := NewPrometheus(u, promclient.NewClient(nil, http.DefaultClient), func() labels.Labels { return nil })
+	p.WithSupported(func() bool { return false })
+
+	err = p.Exemplars(&exemplarspb.ExemplarsRequest{Query: "http_requests_total"}, &exemplarsServer{ctx: context.Background()})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestStripExternalLabelMatchers(t *testing.T) {
+	extLset := labels.FromStrings("region", "eu", "replica", "a")
+
+	for _, tcase := range []struct {
+		query    string
+		expected [][]string
+	}{
+		{
+			query:    `http_requests_total{job="api"}`,
+			expected: [][]string{{`__name__="http_requests_total"`, `job="api"`}},
+		},
+		{
+			query:    `http_requests_total{region="eu",job="api"}`,
+			expected: [][]string{{`__name__="http_requests_total"`, `job="api"`}},
+		},
+		{
+			query: `rate(http_requests_total{region=~"eu|us",replica!="b"}[5m]) / on(job) http_requests_total{region="us"}`,
+			expected: [][]string{
+				{`__name__="http_requests_total"`},
+				// Selectors not matching the external labels select no series.
+				{`__name__!~".*"`, `__name__="http_requests_total"`},
+			},
+		},
+		{
+			// Selectors need a matcher not matching the empty string.
+			query:    `{region="eu"}`,
+			expected: [][]string{{`__name__=~".+"`}},
+		},
+		{
+			// Invalid queries are forwarded as they are.
+			query:    `sum(`,
+			expected: nil,
+		},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			stripped := stripExternalLabelMatchers(tcase.query, extLset)
+			if tcase.expected == nil {
+				testutil.Equals(t, tcase.query, stripped)
+				return
+			}
+
+			selectors, err := parseSelectors(stripped)
+			testutil.Ok(t, err)
+			var res [][]string
+			for _, ms := range selectors {
+				var strs []string
+				for _, m := range ms {
+					strs = append(strs, m.String())
+				}
+				sort.Strings(strs)
+				res = append(res, strs)
+			}
+			testutil.Equals(t, tcase.expected, res)
+		})
+	}
+
+	// Queries are forwarded as they are without external labels.
+	testutil.Equals(t, `http_requests_total{region="eu"}`, stripExternalLabelMatchers(`http_requests_total{region="eu"}`, nil))
+}
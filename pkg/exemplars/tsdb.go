@@ -0,0 +1,138 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package exemplars
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Querier returns exemplars of series matching any of the given sets of matchers within [mint, maxt].
+type Querier interface {
+	Select(mint, maxt int64, matchers ...[]*labels.Matcher) ([]*exemplarspb.ExemplarData, error)
+}
+
+// TSDB implements exemplarspb.ExemplarsServer against a local exemplar storage.
+type TSDB struct {
+	querier        Querier
+	externalLabels labels.Labels
+}
+
+// NewTSDB returns a new TSDB exemplars server. The given external labels are attached to the labels of all returned
+// series, the same way the store API does.
+func NewTSDB(querier Querier, externalLabels labels.Labels) *TSDB {
+	return &TSDB{
+		querier:        querier,
+		externalLabels: externalLabels,
+	}
+}
+
+// Exemplars returns exemplars of series selected by the requested query.
+func (t *TSDB) Exemplars(r *exemplarspb.ExemplarsRequest, s exemplarspb.Exemplars_ExemplarsServer) error {
+	selectors, err := parseSelectors(r.Query)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	data, err := t.selectExemplars(r.Start, r.End, selectors)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, d := range data {
+		if err := s.Send(exemplarspb.NewExemplarsResponse(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TSDB) selectExemplars(mint, maxt int64, selectors [][]*labels.Matcher) ([]*exemplarspb.ExemplarData, error) {
+	data, err := t.querier.Select(mint, maxt, selectors...)
+	if err != nil {
+		return nil, errors.Wrap(err, "select exemplars")
+	}
+	for _, d := range data {
+		d.SeriesLabels.Labels = extendLabels(d.SeriesLabels.Labels, t.externalLabels)
+	}
+	return data, nil
+}
+
+// MultiTSDB implements exemplarspb.ExemplarsServer against the exemplar storages of many tenants, e.g. of a receiver.
+type MultiTSDB struct {
+	tsdbs func() map[string]*TSDB
+}
+
+// NewMultiTSDB returns a new MultiTSDB exemplars server of the TSDB exemplars servers returned by the given
+// function, by tenant.
+func NewMultiTSDB(tsdbs func() map[string]*TSDB) *MultiTSDB {
+	return &MultiTSDB{tsdbs: tsdbs}
+}
+
+// Exemplars returns exemplars of series selected by the requested query from all tenants, sorted by series labels.
+func (m *MultiTSDB) Exemplars(r *exemplarspb.ExemplarsRequest, s exemplarspb.Exemplars_ExemplarsServer) error {
+	selectors, err := parseSelectors(r.Query)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var res []*exemplarspb.ExemplarData
+	for tenant, t := range m.tsdbs() {
+		data, err := t.selectExemplars(r.Start, r.End, selectors)
+		if err != nil {
+			return status.Error(codes.Internal, errors.Wrapf(err, "tenant %s", tenant).Error())
+		}
+		res = append(res, data...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return storepb.CompareLabels(res[i].SeriesLabels.Labels, res[j].SeriesLabels.Labels) < 0
+	})
+
+	for _, d := range res {
+		if err := s.Send(exemplarspb.NewExemplarsResponse(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSelectors returns the label matchers of all series selectors of the given PromQL query.
+func parseSelectors(query string) ([][]*labels.Matcher, error) {
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse query")
+	}
+
+	var (
+		selectors [][]*labels.Matcher
+		parseErr  error
+	)
+	promql.Inspect(expr, func(node promql.Node, _ []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.VectorSelector:
+			selectors = append(selectors, n.LabelMatchers)
+		case *promql.MatrixSelector:
+			// Only the part of a matrix selector before its range selects series.
+			str := n.String()
+			ms, err := promql.ParseMetricSelector(str[:strings.LastIndex(str, "[")])
+			if err != nil {
+				parseErr = err
+				return err
+			}
+			selectors = append(selectors, ms)
+		}
+		return nil
+	})
+	if parseErr != nil {
+		return nil, errors.Wrap(parseErr, "parse matrix selector")
+	}
+	return selectors, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package exemplars
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type fakeQuerier struct {
+	data []*exemplarspb.ExemplarData
+
+	mint, maxt int64
+	matchers   [][]*labels.Matcher
+}
+
+func (f *fakeQuerier) Select(mint, maxt int64, matchers ...[]*labels.Matcher) ([]*exemplarspb.ExemplarData, error) {
+	f.mint, f.maxt, f.matchers = mint, maxt, matchers
+	return f.data, nil
+}
+
+func TestParseSelectors(t *testing.T) {
+	selectors, err := parseSelectors(`histogram_quantile(0.9, sum by (le) (rate(foo_bucket{a="b"}[5m] offset 1m))) / bar`)
+	testutil.Ok(t, err)
+
+	var res []string
+	for _, ms := range selectors {
+		var s []string
+		for _, m := range ms {
+			s = append(s, m.String())
+		}
+		sort.Strings(s)
+		res = append(res, `{`+strings.Join(s, ",")+`}`)
+	}
+	// Depending on the PromQL version, the vector selector of a matrix selector is inspected on its own as well.
+	testutil.Assert(t, len(res) >= 2, "expected at least two selectors, got %v", res)
+	testutil.Equals(t, `{__name__="foo_bucket",a="b"}`, res[0])
+	testutil.Equals(t, `{__name__="bar"}`, res[len(res)-1])
+
+	_, err = parseSelectors(`foo{`)
+	testutil.NotOk(t, err)
+}
+
+func TestMultiTSDB_Exemplars(t *testing.T) {
+	exemplar := exemplarspb.Exemplar{Labels: storepb.LabelSet{Labels: []storepb.Label{{Name: "trace_id", Value: "abc"}}}, Value: 1, Ts: 10}
+	newQuerier := func() *fakeQuerier {
+		return &fakeQuerier{data: []*exemplarspb.ExemplarData{{
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__name__", Value: "foo"}}},
+			Exemplars:    []exemplarspb.Exemplar{exemplar},
+		}}}
+	}
+	qa, qb := newQuerier(), newQuerier()
+	m := NewMultiTSDB(func() map[string]*TSDB {
+		return map[string]*TSDB{
+			"b": NewTSDB(qb, labels.FromStrings("tenant_id", "b")),
+			"a": NewTSDB(qa, labels.FromStrings("tenant_id", "a")),
+		}
+	})
+
+	srv := &exemplarsServer{ctx: context.Background()}
+	testutil.Ok(t, m.Exemplars(&exemplarspb.ExemplarsRequest{Query: `foo`, Start: 5, End: 15}, srv))
+	testutil.Equals(t, []*exemplarspb.ExemplarData{
+		{
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__name__", Value: "foo"}, {Name: "tenant_id", Value: "a"}}},
+			Exemplars:    []exemplarspb.Exemplar{exemplar},
+		},
+		{
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__name__", Value: "foo"}, {Name: "tenant_id", Value: "b"}}},
+			Exemplars:    []exemplarspb.Exemplar{exemplar},
+		},
+	}, srv.data)
+	testutil.Equals(t, int64(5), qa.mint)
+	testutil.Equals(t, int64(15), qa.maxt)
+	testutil.Equals(t, 1, len(qa.matchers))
+
+	testutil.NotOk(t, m.Exemplars(&exemplarspb.ExemplarsRequest{Query: `foo{`}, srv))
+}
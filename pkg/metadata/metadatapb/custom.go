@@ -0,0 +1,29 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadatapb
+
+func NewMetricMetadataResponse(metadata *MetricMetadata) *MetricMetadataResponse {
+	return &MetricMetadataResponse{
+		Result: &MetricMetadataResponse_Metadata{
+			Metadata: metadata,
+		},
+	}
+}
+
+func NewWarnMetadataResponse(warning error) *MetricMetadataResponse {
+	return &MetricMetadataResponse{
+		Result: &MetricMetadataResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
+
+// FromMetadataMap converts metadata keyed by metric name to MetricMetadata.
+func FromMetadataMap(m map[string][]Meta) *MetricMetadata {
+	md := &MetricMetadata{Metadata: make(map[string]*MetricMetadataEntry, len(m))}
+	for name, metas := range m {
+		md.Metadata[name] = &MetricMetadataEntry{Metas: metas}
+	}
+	return md
+}
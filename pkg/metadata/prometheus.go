@@ -0,0 +1,34 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"net/url"
+
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+)
+
+// Prometheus implements metadatapb.MetadataServer by proxying the metadata API of a Prometheus server.
+type Prometheus struct {
+	base   *url.URL
+	client *promclient.Client
+}
+
+// NewPrometheus returns a new Prometheus metadata server.
+func NewPrometheus(base *url.URL, client *promclient.Client) *Prometheus {
+	return &Prometheus{
+		base:   base,
+		client: client,
+	}
+}
+
+// MetricMetadata returns metric metadata of the Prometheus server.
+func (p *Prometheus) MetricMetadata(r *metadatapb.MetricMetadataRequest, s metadatapb.Metadata_MetricMetadataServer) error {
+	md, err := p.client.MetricMetadataInGRPC(s.Context(), p.base, r.Metric, int(r.Limit))
+	if err != nil {
+		return err
+	}
+	return s.Send(metadatapb.NewMetricMetadataResponse(metadatapb.FromMetadataMap(md)))
+}
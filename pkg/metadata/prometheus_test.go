@@ -0,0 +1,68 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type metadataServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	metadatapb.Metadata_MetricMetadataServer
+	ctx context.Context
+
+	metadata []*metadatapb.MetricMetadata
+}
+
+func (s *metadataServer) Send(r *metadatapb.MetricMetadataResponse) error {
+	s.metadata = append(s.metadata, r.GetMetadata())
+	return nil
+}
+
+func (s *metadataServer) Context() context.Context {
+	return s.ctx
+}
+
+func TestPrometheus_MetricMetadata(t *testing.T) {
+	var (
+		path  string
+		query url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.Query()
+		_, _ = w.Write([]byte(`{"status":"success","data":{"http_requests_total":[{"type":"counter","help":"Total number of requests.","unit":""},{"type":"counter","help":"Number of requests.","unit":""}]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	p := NewPrometheus(u, promclient.NewClient(nil, http.DefaultClient))
+	s := &metadataServer{ctx: context.Background()}
+	testutil.Ok(t, p.MetricMetadata(&metadatapb.MetricMetadataRequest{Metric: "http_requests_total", Limit: 10}, s))
+
+	testutil.Equals(t, "/api/v1/metadata", path)
+	testutil.Equals(t, "http_requests_total", query.Get("metric"))
+	testutil.Equals(t, "10", query.Get("limit"))
+	testutil.Equals(t, []*metadatapb.MetricMetadata{{
+		Metadata: map[string]*metadatapb.MetricMetadataEntry{
+			"http_requests_total": {Metas: []metadatapb.Meta{
+				{Type: "counter", Help: "Total number of requests."},
+				{Type: "counter", Help: "Number of requests."},
+			}},
+		},
+	}}, s.metadata)
+
+	// Metadata of all metrics is requested without limit by default.
+	testutil.Ok(t, p.MetricMetadata(&metadatapb.MetricMetadataRequest{}, &metadataServer{ctx: context.Background()}))
+	testutil.Equals(t, url.Values{}, query)
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	blob "github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/go-kit/kit/log"
@@ -30,7 +31,9 @@ type Config struct {
 	StorageAccountKey  string `yaml:"storage_account_key"`
 	ContainerName      string `yaml:"container"`
 	Endpoint           string `yaml:"endpoint"`
-	MaxRetries         int    `yaml:"max_retries"`
+	// Deprecated: MaxRetries is ignored, failed operations are retried according to the retries of the bucket
+	// configuration.
+	MaxRetries int `yaml:"max_retries"`
 }
 
 // Bucket implements the store.Bucket interface against Azure APIs.
@@ -58,9 +61,6 @@ func (conf *Config) validate() error {
 	if conf.Endpoint == "" {
 		conf.Endpoint = azureDefaultEndpoint
 	}
-	if conf.MaxRetries < 0 {
-		return errors.New("the value of maxretries must be greater than or equal to 0 in the config file")
-	}
 	return nil
 }
 
@@ -76,6 +76,9 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 	if err := conf.validate(); err != nil {
 		return nil, err
 	}
+	if conf.MaxRetries != 0 {
+		level.Warn(logger).Log("msg", "max_retries of the Azure configuration is deprecated and ignored, configure retries of the bucket instead")
+	}
 
 	ctx := context.Background()
 	container, err := createContainer(ctx, conf)
@@ -107,7 +110,8 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
 
 	prefix := dir
 	if prefix != "" && !strings.HasSuffix(prefix, DirDelim) {
@@ -117,27 +121,51 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 	marker := blob.Marker{}
 
 	for i := 1; ; i++ {
-		list, err := b.containerURL.ListBlobsHierarchySegment(ctx, marker, DirDelim, blob.ListBlobsSegmentOptions{
-			Prefix: prefix,
-		})
+		var (
+			listNames []string
+			listAttrs = map[string]objstore.ObjectAttributes{}
+		)
+
+		if params.Recursive {
+			list, err := b.containerURL.ListBlobsFlatSegment(ctx, marker, blob.ListBlobsSegmentOptions{
+				Prefix: prefix,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "cannot list blobs in directory %s (iteration #%d)", dir, i)
+			}
 
-		if err != nil {
-			return errors.Wrapf(err, "cannot list blobs in directory %s (iteration #%d)", dir, i)
-		}
+			marker = list.NextMarker
 
-		marker = list.NextMarker
+			for _, blob := range list.Segment.BlobItems {
+				listNames = append(listNames, blob.Name)
+				listAttrs[blob.Name] = blobAttributes(blob.Properties.ContentLength, blob.Properties.LastModified)
+			}
+		} else {
+			list, err := b.containerURL.ListBlobsHierarchySegment(ctx, marker, DirDelim, blob.ListBlobsSegmentOptions{
+				Prefix: prefix,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "cannot list blobs in directory %s (iteration #%d)", dir, i)
+			}
 
-		var listNames []string
+			marker = list.NextMarker
 
-		for _, blob := range list.Segment.BlobItems {
-			listNames = append(listNames, blob.Name)
-		}
+			for _, blob := range list.Segment.BlobItems {
+				listNames = append(listNames, blob.Name)
+				listAttrs[blob.Name] = blobAttributes(blob.Properties.ContentLength, blob.Properties.LastModified)
+			}
 
-		for _, blobPrefix := range list.Segment.BlobPrefixes {
-			listNames = append(listNames, blobPrefix.Name)
+			for _, blobPrefix := range list.Segment.BlobPrefixes {
+				listNames = append(listNames, blobPrefix.Name)
+			}
 		}
 
 		for _, name := range listNames {
+			if attrs, ok := listAttrs[name]; ok && params.AttributesFunc != nil {
+				if err := params.AttributesFunc(name, attrs); err != nil {
+					return err
+				}
+			}
 			if err := f(name); err != nil {
 				return err
 			}
@@ -154,6 +182,14 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 	return nil
 }
 
+func blobAttributes(contentLength *int64, lastModified time.Time) objstore.ObjectAttributes {
+	attrs := objstore.ObjectAttributes{LastModified: lastModified}
+	if contentLength != nil {
+		attrs.Size = *contentLength
+	}
+	return attrs
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	if err == nil {
@@ -210,9 +246,6 @@ func (b *Bucket) getBlobReader(ctx context.Context, name string, offset, length
 			BlockSize:   blob.BlobDefaultDownloadBlockSize,
 			Parallelism: uint16(3),
 			Progress:    nil,
-			RetryReaderOptionsPerBlock: blob.RetryReaderOptions{
-				MaxRetryRequests: b.config.MaxRetries,
-			},
 		},
 	); err != nil {
 		return nil, errors.Wrapf(err, "cannot download blob, address: %s", blobURL.BlobURL)
@@ -245,6 +278,19 @@ func (b *Bucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
 	return uint64(props.ContentLength()), nil
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	blobURL, err := getBlobURL(ctx, *b.config, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "cannot get Azure blob URL, blob: %s", name)
+	}
+	props, err := blobURL.GetProperties(ctx, blob.BlobAccessConditions{})
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{Size: props.ContentLength(), LastModified: props.LastModified()}, nil
+}
+
 // Exists checks if the given object exists.
 func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	level.Debug(b.logger).Log("msg", "check if blob exists", "blob", name)
@@ -29,7 +29,6 @@ func TestConfig_validate(t *testing.T) {
 				StorageAccountName: "foo",
 				StorageAccountKey:  "bar",
 				ContainerName:      "roo",
-				MaxRetries:         3,
 			},
 			wantErr:      false,
 			wantEndpoint: azureDefaultEndpoint,
@@ -45,6 +44,17 @@ func TestConfig_validate(t *testing.T) {
 			wantErr:      false,
 			wantEndpoint: "blob.core.chinacloudapi.cn",
 		},
+		{
+			name: "deprecated max retries are ignored",
+			fields: fields{
+				StorageAccountName: "foo",
+				StorageAccountKey:  "bar",
+				ContainerName:      "roo",
+				MaxRetries:         -3,
+			},
+			wantErr:      false,
+			wantEndpoint: azureDefaultEndpoint,
+		},
 		{
 			name: "no account key but account name",
 			fields: fields{
@@ -72,17 +82,6 @@ func TestConfig_validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
-		{
-			name: "invalid max retries (negative)",
-			fields: fields{
-				StorageAccountName: "foo",
-				StorageAccountKey:  "bar",
-				ContainerName:      "roo",
-				MaxRetries:         -3,
-			},
-			wantErr:      true,
-			wantEndpoint: azureDefaultEndpoint,
-		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -24,8 +24,9 @@ func getContainerURL(ctx context.Context, conf Config) (blob.ContainerURL, error
 		return blob.ContainerURL{}, err
 	}
 
+	// Failed requests are retried by objstore.RetryBucket, not by the pipeline.
 	retryOptions := blob.RetryOptions{
-		MaxTries: int32(conf.MaxRetries),
+		MaxTries: 1,
 	}
 	if deadline, ok := ctx.Deadline(); ok {
 		retryOptions.TryTimeout = time.Until(deadline)
@@ -17,6 +17,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore/cos"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/objstore/gcs"
+	"github.com/thanos-io/thanos/pkg/objstore/hdfs"
 	"github.com/thanos-io/thanos/pkg/objstore/oss"
 	"github.com/thanos-io/thanos/pkg/objstore/s3"
 	"github.com/thanos-io/thanos/pkg/objstore/swift"
@@ -33,22 +34,32 @@ const (
 	SWIFT      ObjProvider = "SWIFT"
 	COS        ObjProvider = "COS"
 	ALIYUNOSS  ObjProvider = "ALIYUNOSS"
+	HDFS       ObjProvider = "HDFS"
 )
 
 type BucketConfig struct {
 	Type   ObjProvider `yaml:"type"`
 	Config interface{} `yaml:"config"`
+	// Prefix is a path prefix all objects are stored under. Allows multiple installations to share one bucket.
+	Prefix     string                   `yaml:"prefix"`
+	RateLimits objstore.RateLimitConfig `yaml:"rate_limits"`
+	Retries    objstore.RetryConfig     `yaml:"retries"`
+	Metrics    objstore.MetricsConfig   `yaml:"metrics"`
 }
 
 // NewBucket initializes and returns new object storage clients.
 // NOTE: confContentYaml can contain secrets.
 func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registerer, component string) (objstore.InstrumentedBucket, error) {
 	level.Info(logger).Log("msg", "loading bucket configuration")
-	bucketConf := &BucketConfig{}
+	bucketConf := &BucketConfig{Retries: objstore.DefaultRetryConfig}
 	if err := yaml.UnmarshalStrict(confContentYaml, bucketConf); err != nil {
 		return nil, errors.Wrap(err, "parsing config YAML file")
 	}
 
+	if err := bucketConf.Retries.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate retries")
+	}
+
 	config, err := yaml.Marshal(bucketConf.Config)
 	if err != nil {
 		return nil, errors.Wrap(err, "marshal content of bucket configuration")
@@ -68,6 +79,8 @@ func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registe
 		bucket, err = cos.NewBucket(logger, config, component)
 	case string(ALIYUNOSS):
 		bucket, err = oss.NewBucket(logger, config, component)
+	case string(HDFS):
+		bucket, err = hdfs.NewBucket(logger, config)
 	case string(FILESYSTEM):
 		bucket, err = filesystem.NewBucketFromConfig(config)
 	default:
@@ -76,5 +89,24 @@ func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registe
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("create %s client", bucketConf.Type))
 	}
-	return objstore.BucketWithMetrics(bucket.Name(), bucket, reg), nil
+	// Retries are rate limited as well, as every attempt is a request against the provider.
+	if bucketConf.RateLimits.Enabled() {
+		bucket, err = objstore.NewRateLimitedBucket("bucket", bucket, bucketConf.RateLimits, reg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if bucketConf.Retries.MaxRetries > 0 && !objstore.RetriesRequests(bucket) {
+		bucket, err = objstore.NewRetryBucket(logger, bucket, bucketConf.Retries, reg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bucket = objstore.NewPrefixedBucket(bucket, bucketConf.Prefix)
+	bucket = objstore.NewTracingBucket(bucket, strings.ToUpper(string(bucketConf.Type)))
+	instrumented, err := objstore.BucketWithMetricsConfig(bucket.Name(), bucket, bucketConf.Metrics, reg)
+	if err != nil {
+		return nil, err
+	}
+	return instrumented, nil
 }
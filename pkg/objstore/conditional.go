@@ -0,0 +1,28 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+)
+
+// ConditionalBucketReader is implemented by buckets able to get an object only if it changed since its given version,
+// e.g. using ETags or object generations.
+type ConditionalBucketReader interface {
+	// GetIfChanged returns a reader for the given object name and its current version, if the object version differs
+	// from the given one. An empty version always gets the object. If the object has not changed, the returned
+	// reader is nil.
+	GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error)
+}
+
+// GetIfChanged gets the object only if it changed since the given version, if bkt supports conditional reads.
+// Otherwise the object is always returned and the returned version is empty.
+func GetIfChanged(ctx context.Context, bkt BucketReader, name, version string) (io.ReadCloser, string, error) {
+	if c, ok := bkt.(ConditionalBucketReader); ok {
+		return c.GetIfChanged(ctx, name, version)
+	}
+	rc, err := bkt.Get(ctx, name)
+	return rc, "", err
+}
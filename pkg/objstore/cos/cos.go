@@ -112,6 +112,23 @@ func (b *Bucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
 	return 0, errors.New("content-length header not found")
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	resp, err := b.client.Object.Head(ctx, name, nil)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrap(err, "convert content-length")
+	}
+	mod, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrap(err, "parse last-modified")
+	}
+	return objstore.ObjectAttributes{Size: size, LastModified: mod}, nil
+}
+
 // Upload the contents of the reader as an object into the bucket.
 func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	if _, err := b.client.Object.Put(ctx, name, r, nil); err != nil {
@@ -128,20 +145,31 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
-// Iter calls f for each entry in the given directory (not recursive.). The argument to f is the full
+// Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, dirDelim) + dirDelim
 	}
 
-	for object := range b.listObjects(ctx, dir) {
+	for object := range b.listObjects(ctx, dir, params.Recursive) {
 		if object.err != nil {
 			return object.err
 		}
 		if object.key == "" {
 			continue
 		}
+		// Listing does not return parsed attributes, so get them for each object.
+		if params.AttributesFunc != nil && !strings.HasSuffix(object.key, dirDelim) {
+			attrs, err := b.Attributes(ctx, object.key)
+			if err != nil {
+				return errors.Wrapf(err, "get attributes of %s", object.key)
+			}
+			if err := params.AttributesFunc(object.key, attrs); err != nil {
+				return err
+			}
+		}
 		if err := f(object.key); err != nil {
 			return err
 		}
@@ -217,9 +245,14 @@ type objectInfo struct {
 	err error
 }
 
-func (b *Bucket) listObjects(ctx context.Context, objectPrefix string) <-chan objectInfo {
+func (b *Bucket) listObjects(ctx context.Context, objectPrefix string, recursive bool) <-chan objectInfo {
 	objectsCh := make(chan objectInfo, 1)
 
+	delimiter := dirDelim
+	if recursive {
+		delimiter = ""
+	}
+
 	go func(objectsCh chan<- objectInfo) {
 		defer close(objectsCh)
 		var marker string
@@ -228,7 +261,7 @@ func (b *Bucket) listObjects(ctx context.Context, objectPrefix string) <-chan ob
 				Prefix:    objectPrefix,
 				MaxKeys:   1000,
 				Marker:    marker,
-				Delimiter: dirDelim,
+				Delimiter: delimiter,
 			})
 			if err != nil {
 				select {
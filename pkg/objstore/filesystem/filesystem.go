@@ -54,7 +54,8 @@ func NewBucket(rootDir string) (*Bucket, error) {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
 	absDir := filepath.Join(b.rootDir, dir)
 	info, err := os.Stat(absDir)
 	if err != nil {
@@ -67,6 +68,22 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		return nil
 	}
 
+	if params.Recursive {
+		return filepath.Walk(absDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(b.rootDir, path)
+			if err != nil {
+				return err
+			}
+			return b.iterFile(filepath.ToSlash(rel), info, params, f)
+		})
+	}
+
 	files, err := ioutil.ReadDir(absDir)
 	if err != nil {
 		return err
@@ -74,30 +91,68 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 	for _, file := range files {
 		name := filepath.Join(dir, file.Name())
 
-		if file.IsDir() {
-			empty, err := isDirEmpty(filepath.Join(absDir, file.Name()))
-			if err != nil {
+		if !file.IsDir() {
+			if err := b.iterFile(name, file, params, f); err != nil {
 				return err
 			}
+			continue
+		}
 
-			if empty {
-				// Skip empty directories.
-				continue
-			}
-			name += objstore.DirDelim
+		empty, err := isDirEmpty(filepath.Join(absDir, file.Name()))
+		if err != nil {
+			return err
+		}
+		if empty {
+			// Skip empty directories.
+			continue
 		}
-		if err := f(name); err != nil {
+		if err := f(name + objstore.DirDelim); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// iterFile calls Iter callbacks for the given file.
+func (b *Bucket) iterFile(name string, info os.FileInfo, params objstore.IterParams, f func(string) error) error {
+	if params.AttributesFunc != nil {
+		if err := params.AttributesFunc(name, objstore.ObjectAttributes{Size: info.Size(), LastModified: info.ModTime()}); err != nil {
+			return err
+		}
+	}
+	return f(name)
+}
+
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	return b.GetRange(ctx, name, 0, -1)
 }
 
+// GetIfChanged returns a reader for the given object name if its version, based on modification time and size,
+// differs from the given one.
+func (b *Bucket) GetIfChanged(_ context.Context, name, version string) (io.ReadCloser, string, error) {
+	if name == "" {
+		return nil, "", errors.New("object name is empty")
+	}
+
+	file := filepath.Join(b.rootDir, name)
+	f, err := os.OpenFile(file, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "open %s", file)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		runutil.CloseWithErrCapture(&err, f, "close file")
+		return nil, "", errors.Wrapf(err, "stat %s", file)
+	}
+
+	newVersion := fmt.Sprintf("%d-%d", st.ModTime().UnixNano(), st.Size())
+	if newVersion == version {
+		return nil, newVersion, f.Close()
+	}
+	return f, newVersion, nil
+}
+
 type rangeReaderCloser struct {
 	io.Reader
 	f *os.File
@@ -117,6 +172,16 @@ func (b *Bucket) ObjectSize(_ context.Context, name string) (uint64, error) {
 	return uint64(st.Size()), nil
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
+	file := filepath.Join(b.rootDir, name)
+	st, err := os.Stat(file)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat %s", file)
+	}
+	return objstore.ObjectAttributes{Size: st.Size(), LastModified: st.ModTime()}, nil
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(_ context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	if name == "" {
@@ -8,7 +8,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/prometheus/common/version"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"gopkg.in/yaml.v2"
@@ -30,13 +33,17 @@ const DirDelim = "/"
 type Config struct {
 	Bucket         string `yaml:"bucket"`
 	ServiceAccount string `yaml:"service_account"`
+	// KMSKeyName is the Cloud KMS key used to encrypt uploaded objects (CMEK), in the form of
+	// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>. Bucket default encryption is used if empty.
+	KMSKeyName string `yaml:"kms_key_name"`
 }
 
 // Bucket implements the store.Bucket and shipper.Bucket interfaces against GCS.
 type Bucket struct {
-	logger log.Logger
-	bkt    *storage.BucketHandle
-	name   string
+	logger     log.Logger
+	bkt        *storage.BucketHandle
+	name       string
+	kmsKeyName string
 
 	closer io.Closer
 }
@@ -71,10 +78,11 @@ func NewBucket(ctx context.Context, logger log.Logger, conf []byte, component st
 		return nil, err
 	}
 	bkt := &Bucket{
-		logger: logger,
-		bkt:    gcsClient.Bucket(gc.Bucket),
-		closer: gcsClient,
-		name:   gc.Bucket,
+		logger:     logger,
+		bkt:        gcsClient.Bucket(gc.Bucket),
+		closer:     gcsClient,
+		name:       gc.Bucket,
+		kmsKeyName: gc.KMSKeyName,
 	}
 	return bkt, nil
 }
@@ -86,15 +94,21 @@ func (b *Bucket) Name() string {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
+	delimiter := DirDelim
+	if params.Recursive {
+		delimiter = ""
+	}
 	it := b.bkt.Objects(ctx, &storage.Query{
 		Prefix:    dir,
-		Delimiter: DirDelim,
+		Delimiter: delimiter,
 	})
 	for {
 		select {
@@ -109,6 +123,12 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if err != nil {
 			return err
 		}
+		// Directories are returned with Prefix only.
+		if params.AttributesFunc != nil && attrs.Prefix == "" {
+			if err := params.AttributesFunc(attrs.Name, objstore.ObjectAttributes{Size: attrs.Size, LastModified: attrs.Updated}); err != nil {
+				return err
+			}
+		}
 		if err := f(attrs.Prefix + attrs.Name); err != nil {
 			return err
 		}
@@ -120,6 +140,25 @@ func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	return b.bkt.Object(name).NewReader(ctx)
 }
 
+// GetIfChanged returns a reader for the given object name if its generation differs from the given one.
+func (b *Bucket) GetIfChanged(ctx context.Context, name, objVersion string) (io.ReadCloser, string, error) {
+	attrs, err := b.bkt.Object(name).Attrs(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	generation := strconv.FormatInt(attrs.Generation, 10)
+	if generation == objVersion {
+		return nil, generation, nil
+	}
+	// Read exactly the generation we got attributes of, even if the object is overwritten in the meantime.
+	rc, err := b.bkt.Object(name).Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return rc, generation, nil
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	return b.bkt.Object(name).NewRangeReader(ctx, off, length)
@@ -134,6 +173,15 @@ func (b *Bucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
 	return uint64(obj.Size), nil
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	attrs, err := b.bkt.Object(name).Attrs(ctx)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{Size: attrs.Size, LastModified: attrs.Updated}, nil
+}
+
 // Handle returns the underlying GCS bucket handle.
 // Used for testing purposes (we return handle, so it is not instrumented).
 func (b *Bucket) Handle() *storage.BucketHandle {
@@ -151,8 +199,10 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 }
 
 // Upload writes the file specified in src to remote GCS location specified as target.
+// No object ACLs are set, so uploads work with uniform bucket-level access enabled.
 func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	w := b.bkt.Object(name).NewWriter(ctx)
+	w.KMSKeyName = b.kmsKeyName
 
 	if _, err := io.Copy(w, r); err != nil {
 		return err
@@ -170,6 +220,15 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	return err == storage.ErrObjectNotExist
 }
 
+// IsRetryableErr returns true if error means that the request was rate limited or failed on the server side.
+func (b *Bucket) IsRetryableErr(err error) bool {
+	apiErr, ok := errors.Cause(err).(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+}
+
 func (b *Bucket) Close() error {
 	return b.closer.Close()
 }
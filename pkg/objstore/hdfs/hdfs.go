@@ -0,0 +1,442 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package hdfs implements the objstore.Bucket interface against HDFS using the WebHDFS REST API.
+package hdfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"gopkg.in/yaml.v2"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+const (
+	webHDFSPrefix = "/webhdfs/v1"
+
+	fileNotFoundException = "FileNotFoundException"
+)
+
+// Config stores the configuration for storing and accessing blobs in HDFS.
+type Config struct {
+	// Endpoint is the HTTP address of the NameNode, e.g. http://namenode:9870.
+	Endpoint string `yaml:"endpoint"`
+	// Directory is the absolute HDFS path all objects are stored under.
+	Directory string `yaml:"directory"`
+	// User is the name of the user to act as using simple (pseudo) authentication.
+	User string `yaml:"user"`
+}
+
+func (c Config) validate() error {
+	if c.Endpoint == "" {
+		return errors.New("no HDFS endpoint in config file")
+	}
+	if !path.IsAbs(c.Directory) {
+		return errors.Errorf("HDFS directory %q is not an absolute path", c.Directory)
+	}
+	return nil
+}
+
+// Bucket implements the objstore.Bucket interface against HDFS using the WebHDFS REST API.
+type Bucket struct {
+	logger   log.Logger
+	client   *http.Client
+	endpoint *url.URL
+	dir      string
+	user     string
+}
+
+// NewBucket returns a new Bucket using the provided HDFS configuration.
+func NewBucket(logger log.Logger, conf []byte) (*Bucket, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(conf, &c); err != nil {
+		return nil, errors.Wrap(err, "parsing HDFS configuration")
+	}
+	return NewBucketWithConfig(logger, c)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided HDFS configuration.
+func NewBucketWithConfig(logger log.Logger, c Config) (*Bucket, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if err := c.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate HDFS configuration")
+	}
+
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse HDFS endpoint")
+	}
+
+	return &Bucket{
+		logger: logger,
+		client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				// Data of created files is sent to the DataNode the NameNode redirects to, see Upload.
+				if req.Method == http.MethodPut {
+					return http.ErrUseLastResponse
+				}
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return nil
+			},
+		},
+		endpoint: endpoint,
+		dir:      path.Clean(c.Directory),
+		user:     c.User,
+	}, nil
+}
+
+// Name returns the bucket name.
+func (b *Bucket) Name() string {
+	return fmt.Sprintf("hdfs: %s", b.dir)
+}
+
+// remoteError is an error returned by the WebHDFS REST API.
+type remoteError struct {
+	StatusCode int    `json:"-"`
+	Exception  string `json:"exception"`
+	Message    string `json:"message"`
+}
+
+func (e remoteError) Error() string {
+	return fmt.Sprintf("webhdfs: status %d: %s: %s", e.StatusCode, e.Exception, e.Message)
+}
+
+func newRemoteError(resp *http.Response) error {
+	var r struct {
+		RemoteException remoteError `json:"RemoteException"`
+	}
+	// Not all responses have a JSON body, e.g. when returned by a proxy in front of the NameNode.
+	_ = json.NewDecoder(resp.Body).Decode(&r)
+
+	e := r.RemoteException
+	e.StatusCode = resp.StatusCode
+	return e
+}
+
+// fileStatus is the WebHDFS FileStatus JSON object.
+type fileStatus struct {
+	PathSuffix       string `json:"pathSuffix"`
+	Type             string `json:"type"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+}
+
+func (s fileStatus) attributes() objstore.ObjectAttributes {
+	return objstore.ObjectAttributes{
+		Size:         s.Length,
+		LastModified: time.Unix(0, s.ModificationTime*int64(time.Millisecond)),
+	}
+}
+
+func (b *Bucket) url(name, op string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	if b.user != "" {
+		params.Set("user.name", b.user)
+	}
+
+	u := *b.endpoint
+	u.Path = path.Join(webHDFSPrefix, b.dir, name)
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// do executes the WebHDFS operation on the given object name. It returns an error for any non successful status code.
+func (b *Bucket) do(ctx context.Context, method, name, op string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(name, op, params), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", op, name)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs error response")
+		return nil, errors.Wrapf(newRemoteError(resp), "%s %s", op, name)
+	}
+	return resp, nil
+}
+
+func (b *Bucket) decode(ctx context.Context, name, op string, params url.Values, v interface{}) error {
+	resp, err := b.do(ctx, http.MethodGet, name, op, params)
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs response")
+
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "decode %s %s response", op, name)
+}
+
+func (b *Bucket) listStatus(ctx context.Context, dir string) ([]fileStatus, error) {
+	var r struct {
+		FileStatuses struct {
+			FileStatus []fileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	if err := b.decode(ctx, dir, "LISTSTATUS", nil, &r); err != nil {
+		return nil, err
+	}
+	return r.FileStatuses.FileStatus, nil
+}
+
+func (b *Bucket) fileStatus(ctx context.Context, name string) (fileStatus, error) {
+	var r struct {
+		FileStatus fileStatus `json:"FileStatus"`
+	}
+	if err := b.decode(ctx, name, "GETFILESTATUS", nil, &r); err != nil {
+		return fileStatus{}, err
+	}
+	return r.FileStatus, nil
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+	return b.iter(ctx, dir, objstore.ApplyIterOptions(options...), f)
+}
+
+func (b *Bucket) iter(ctx context.Context, dir string, params objstore.IterParams, f func(string) error) error {
+	statuses, err := b.listStatus(ctx, dir)
+	if err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, s := range statuses {
+		// Listing a file returns the file itself without path suffix.
+		if s.PathSuffix == "" {
+			continue
+		}
+
+		name := dir + s.PathSuffix
+		if s.Type == "DIRECTORY" {
+			if params.Recursive {
+				if err := b.iter(ctx, name+DirDelim, params, f); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := f(name + DirDelim); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if params.AttributesFunc != nil {
+			if err := params.AttributesFunc(name, s.attributes()); err != nil {
+				return err
+			}
+		}
+		if err := f(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+
+	params := url.Values{}
+	if off > 0 {
+		params.Set("offset", strconv.FormatInt(off, 10))
+	}
+	if length != -1 {
+		params.Set("length", strconv.FormatInt(length, 10))
+	}
+
+	// NameNode redirects to a DataNode serving the data.
+	resp, err := b.do(ctx, http.MethodGet, name, "OPEN", params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Exists checks if the given object exists.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if _, err := b.fileStatus(ctx, name); err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ObjectSize returns the size of the specified object.
+func (b *Bucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
+	s, err := b.fileStatus(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(s.Length), nil
+}
+
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	s, err := b.fileStatus(ctx, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return s.attributes(), nil
+}
+
+// Upload writes the contents of the reader as an object into the bucket. Existing object is overwritten.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	// Creating a file takes two requests: the NameNode redirects to a DataNode the data is then sent to.
+	resp, err := b.do(ctx, http.MethodPut, name, "CREATE", url.Values{"overwrite": {"true"}})
+	if err != nil {
+		return err
+	}
+	runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs create redirect response")
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusTemporaryRedirect || location == "" {
+		return errors.Errorf("CREATE %s: expected redirect to DataNode, got status %s", name, resp.Status)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, location, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err = b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "upload %s", name)
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs upload response")
+
+	if resp.StatusCode != http.StatusCreated {
+		return errors.Wrapf(newRemoteError(resp), "upload %s", name)
+	}
+	return nil
+}
+
+// Delete removes the object with the given name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	if err := b.delete(ctx, name); err != nil {
+		return err
+	}
+
+	// HDFS has real directories. Remove those left empty, so they are not listed by Iter.
+	for dir := path.Dir(name); dir != "." && dir != DirDelim; dir = path.Dir(dir) {
+		statuses, err := b.listStatus(ctx, dir)
+		if err != nil || len(statuses) > 0 {
+			break
+		}
+		// Directory might be used by concurrent upload in the meantime, so best effort only.
+		if err := b.delete(ctx, dir); err != nil {
+			level.Debug(b.logger).Log("msg", "failed to remove empty directory", "dir", dir, "err", err)
+			break
+		}
+	}
+	return nil
+}
+
+func (b *Bucket) delete(ctx context.Context, name string) error {
+	resp, err := b.do(ctx, http.MethodDelete, name, "DELETE", url.Values{"recursive": {"false"}})
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs delete response")
+
+	var r struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return errors.Wrapf(err, "decode DELETE %s response", name)
+	}
+	if !r.Boolean {
+		return remoteError{StatusCode: http.StatusNotFound, Exception: fileNotFoundException, Message: fmt.Sprintf("%s does not exist", name)}
+	}
+	return nil
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
+func (b *Bucket) IsObjNotFoundErr(err error) bool {
+	e, ok := errors.Cause(err).(remoteError)
+	return ok && (e.StatusCode == http.StatusNotFound || e.Exception == fileNotFoundException)
+}
+
+func (b *Bucket) Close() error { return nil }
+
+func configFromEnv() Config {
+	return Config{
+		Endpoint: os.Getenv("HDFS_ENDPOINT"),
+		User:     os.Getenv("HDFS_USER"),
+	}
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary directory.
+// In a close function it empties and deletes the directory.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.Endpoint == "" {
+		return nil, nil, errors.New("HDFS_ENDPOINT is required for testing against HDFS")
+	}
+	c.Directory = fmt.Sprintf("/tmp/thanos-test-%s-%x", strings.ToLower(strings.Replace(t.Name(), "/", "-", -1)), rand.Int63())
+
+	b, err := NewBucketWithConfig(log.NewNopLogger(), c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	resp, err := b.do(ctx, http.MethodPut, "", "MKDIRS", nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "create test directory %s", c.Directory)
+	}
+	runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs mkdirs response")
+	t.Log("created temporary HDFS directory for HDFS tests with name", c.Directory)
+
+	return b, func() {
+		objstore.EmptyBucket(t, ctx, b)
+		resp, err := b.do(ctx, http.MethodDelete, "", "DELETE", url.Values{"recursive": {"true"}})
+		if err != nil {
+			t.Logf("deleting test directory %s failed: %s", c.Directory, err)
+			return
+		}
+		runutil.ExhaustCloseWithLogOnErr(b.logger, resp.Body, "webhdfs delete response")
+	}, nil
+}
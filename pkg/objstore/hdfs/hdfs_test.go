@@ -0,0 +1,63 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package hdfs
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNewBucket_Validate(t *testing.T) {
+	_, err := NewBucket(nil, []byte(`directory: /thanos`))
+	testutil.NotOk(t, err)
+
+	_, err = NewBucket(nil, []byte("endpoint: http://namenode:9870\ndirectory: thanos"))
+	testutil.NotOk(t, err)
+
+	b, err := NewBucket(nil, []byte("endpoint: http://namenode:9870\ndirectory: /thanos/\nuser: hdfs"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "hdfs: /thanos", b.Name())
+	testutil.Equals(t, "http://namenode:9870/webhdfs/v1/thanos/01/index?length=10&offset=5&op=OPEN&user.name=hdfs", b.url("01/index", "OPEN", map[string][]string{"offset": {"5"}, "length": {"10"}}))
+}
+
+func TestBucket_GetRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/webhdfs/v1/thanos/obj" && r.URL.Query().Get("op") == "OPEN":
+			// NameNode redirects reads to a DataNode.
+			http.Redirect(w, r, "/datanode?"+r.URL.RawQuery, http.StatusTemporaryRedirect)
+		case r.URL.Path == "/datanode":
+			testutil.Equals(t, "3", r.URL.Query().Get("offset"))
+			testutil.Equals(t, "4", r.URL.Query().Get("length"))
+			_, _ = w.Write([]byte("data"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"RemoteException":{"exception":"FileNotFoundException","message":"File does not exist"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	b, err := NewBucketWithConfig(nil, Config{Endpoint: srv.URL, Directory: "/thanos"})
+	testutil.Ok(t, err)
+
+	rc, err := b.GetRange(context.Background(), "obj", 3, 4)
+	testutil.Ok(t, err)
+	data, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "data", string(data))
+
+	_, err = b.Get(context.Background(), "missing")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, b.IsObjNotFoundErr(err), "expected not found error, got %v", err)
+
+	ok, err := b.Exists(context.Background(), "missing")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object to not exist")
+}
@@ -9,8 +9,10 @@ import (
 	"io"
 	"io/ioutil"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -20,14 +22,15 @@ var errNotFound = errors.New("inmem: object not found")
 // InMemBucket implements the objstore.Bucket interfaces against local memory.
 // Methods from Bucket interface are thread-safe. Objects are assumed to be immutable.
 type InMemBucket struct {
-	mtx     sync.RWMutex
-	objects map[string][]byte
+	mtx          sync.RWMutex
+	objects      map[string][]byte
+	lastModified map[string]time.Time
 }
 
 // NewInMemBucket returns a new in memory Bucket.
 // NOTE: Returned bucket is just a naive in memory bucket implementation. For test use cases only.
 func NewInMemBucket() *InMemBucket {
-	return &InMemBucket{objects: map[string][]byte{}}
+	return &InMemBucket{objects: map[string][]byte{}, lastModified: map[string]time.Time{}}
 }
 
 // Objects returns internally stored objects.
@@ -38,8 +41,10 @@ func (b *InMemBucket) Objects() map[string][]byte {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error) error {
+func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error, options ...IterOption) error {
+	params := ApplyIterOptions(options...)
 	unique := map[string]struct{}{}
+	attrs := map[string]ObjectAttributes{}
 
 	var dirPartsCount int
 	dirParts := strings.SplitAfter(dir, DirDelim)
@@ -56,8 +61,15 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error)
 			continue
 		}
 
-		parts := strings.SplitAfter(filename, DirDelim)
-		unique[strings.Join(parts[:dirPartsCount+1], "")] = struct{}{}
+		name := filename
+		if !params.Recursive {
+			parts := strings.SplitAfter(filename, DirDelim)
+			name = strings.Join(parts[:dirPartsCount+1], "")
+		}
+		unique[name] = struct{}{}
+		if name == filename {
+			attrs[name] = ObjectAttributes{Size: int64(len(b.objects[filename])), LastModified: b.lastModified[filename]}
+		}
 	}
 	b.mtx.RUnlock()
 
@@ -80,6 +92,11 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error)
 	})
 
 	for _, k := range keys {
+		if a, ok := attrs[k]; ok && params.AttributesFunc != nil {
+			if err := params.AttributesFunc(k, a); err != nil {
+				return err
+			}
+		}
 		if err := f(k); err != nil {
 			return err
 		}
@@ -103,6 +120,28 @@ func (b *InMemBucket) Get(_ context.Context, name string) (io.ReadCloser, error)
 	return ioutil.NopCloser(bytes.NewReader(file)), nil
 }
 
+// GetIfChanged returns a reader for the given object name if its version, based on the upload time and size,
+// differs from the given one.
+func (b *InMemBucket) GetIfChanged(_ context.Context, name, version string) (io.ReadCloser, string, error) {
+	if name == "" {
+		return nil, "", errors.New("inmem: object name is empty")
+	}
+
+	b.mtx.RLock()
+	file, ok := b.objects[name]
+	lastModified := b.lastModified[name]
+	b.mtx.RUnlock()
+	if !ok {
+		return nil, "", errNotFound
+	}
+
+	newVersion := strconv.FormatInt(lastModified.UnixNano(), 10) + "-" + strconv.Itoa(len(file))
+	if newVersion == version {
+		return nil, newVersion, nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(file)), newVersion, nil
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *InMemBucket) GetRange(_ context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	if name == "" {
@@ -155,6 +194,17 @@ func (b *InMemBucket) ObjectSize(_ context.Context, name string) (uint64, error)
 	return uint64(len(file)), nil
 }
 
+// Attributes returns information about the specified object.
+func (b *InMemBucket) Attributes(_ context.Context, name string) (ObjectAttributes, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	file, ok := b.objects[name]
+	if !ok {
+		return ObjectAttributes{}, errNotFound
+	}
+	return ObjectAttributes{Size: int64(len(file)), LastModified: b.lastModified[name]}, nil
+}
+
 // Upload writes the file specified in src to into the memory.
 func (b *InMemBucket) Upload(_ context.Context, name string, r io.Reader) error {
 	b.mtx.Lock()
@@ -164,6 +214,7 @@ func (b *InMemBucket) Upload(_ context.Context, name string, r io.Reader) error
 		return err
 	}
 	b.objects[name] = body
+	b.lastModified[name] = time.Now()
 	return nil
 }
 
@@ -175,6 +226,7 @@ func (b *InMemBucket) Delete(_ context.Context, name string) error {
 		return errNotFound
 	}
 	delete(b.objects, name)
+	delete(b.lastModified, name)
 	return nil
 }
 
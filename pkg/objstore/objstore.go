@@ -56,7 +56,8 @@ type InstrumentedBucket interface {
 type BucketReader interface {
 	// Iter calls f for each entry in the given directory (not recursive.). The argument to f is the full
 	// object name including the prefix of the inspected directory.
-	Iter(ctx context.Context, dir string, f func(string) error) error
+	// Entries are listed recursively with WithRecursiveIter option, in which case directories are not passed to f.
+	Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error
 
 	// Get returns a reader for the given object name.
 	Get(ctx context.Context, name string) (io.ReadCloser, error)
@@ -72,6 +73,51 @@ type BucketReader interface {
 
 	// ObjectSize returns the size of the specified object.
 	ObjectSize(ctx context.Context, name string) (uint64, error)
+
+	// Attributes returns information about the specified object.
+	Attributes(ctx context.Context, name string) (ObjectAttributes, error)
+}
+
+// ObjectAttributes contains information about an object.
+type ObjectAttributes struct {
+	// Size is the object size in bytes.
+	Size int64 `json:"size"`
+
+	// LastModified is the timestamp the object was last modified.
+	LastModified time.Time `json:"last_modified"`
+}
+
+// IterOption configures the provided params.
+type IterOption func(params *IterParams)
+
+// IterParams holds the Iter() parameters and is used by objstore clients implementations.
+type IterParams struct {
+	// Recursive lists all objects prefixed with the directory instead of only its direct entries.
+	Recursive bool
+	// AttributesFunc, if set, is called with attributes of each object (not directory) right before f.
+	AttributesFunc func(name string, attrs ObjectAttributes) error
+}
+
+// WithRecursiveIter is an option that can be applied to Iter() to recursively list objects in the bucket.
+func WithRecursiveIter(params *IterParams) {
+	params.Recursive = true
+}
+
+// WithObjectAttributes is an option that can be applied to Iter() to get attributes of each listed object.
+// Providers returning attributes as part of the listing avoid an extra Attributes() call per object.
+func WithObjectAttributes(f func(name string, attrs ObjectAttributes) error) IterOption {
+	return func(params *IterParams) {
+		params.AttributesFunc = f
+	}
+}
+
+// ApplyIterOptions returns IterParams with all given options applied.
+func ApplyIterOptions(options ...IterOption) IterParams {
+	out := IterParams{}
+	for _, opt := range options {
+		opt(&out)
+	}
+	return out
 }
 
 // InstrumentedBucket is a BucketReader with optional instrumentation control.
@@ -83,6 +129,11 @@ type InstrumentedBucketReader interface {
 	ReaderWithExpectedErrs(IsOpFailureExpectedFunc) BucketReader
 }
 
+// upstreamReader is implemented by readers wrapping another reader without changing its content.
+type upstreamReader interface {
+	upstream() io.Reader
+}
+
 // TryToGetSize tries to get upfront size from reader.
 // TODO(https://github.com/thanos-io/thanos/issues/678): Remove guessing length when minio provider will support multipart upload without this.
 func TryToGetSize(r io.Reader) (int64, error) {
@@ -97,6 +148,8 @@ func TryToGetSize(r io.Reader) (int64, error) {
 		return int64(f.Len()), nil
 	case *strings.Reader:
 		return f.Size(), nil
+	case upstreamReader:
+		return TryToGetSize(f.upstream())
 	}
 	return 0, errors.New("unsupported type of io.Reader")
 }
@@ -213,6 +266,7 @@ func DownloadDir(ctx context.Context, logger log.Logger, bkt BucketReader, src,
 const (
 	iterOp     = "iter"
 	sizeOp     = "objectsize"
+	attrsOp    = "attributes"
 	getOp      = "get"
 	getRangeOp = "get_range"
 	existsOp   = "exists"
@@ -220,14 +274,69 @@ const (
 	deleteOp   = "delete"
 )
 
+var allOps = []string{
+	iterOp,
+	sizeOp,
+	attrsOp,
+	getOp,
+	getRangeOp,
+	existsOp,
+	uploadOp,
+	deleteOp,
+}
+
 // IsOpFailureExpectedFunc allows to mark certain errors as expected, so they will not increment thanos_objstore_bucket_operation_failures_total metric.
 type IsOpFailureExpectedFunc func(error) bool
 
 var _ InstrumentedBucket = &metricBucket{}
 
+// DefaultDurationBuckets are default buckets of the thanos_objstore_bucket_operation_duration_seconds histogram.
+var DefaultDurationBuckets = []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120}
+
+// DefaultBytesBuckets are default buckets of the thanos_objstore_bucket_operation_transferred_bytes histogram,
+// from 1KiB to 256MiB.
+var DefaultBytesBuckets = prometheus.ExponentialBuckets(1024, 4, 10)
+
+// MetricsConfig configures histograms of the instrumented bucket.
+type MetricsConfig struct {
+	// DurationBuckets are buckets of operation durations in seconds. DefaultDurationBuckets are used if empty.
+	DurationBuckets []float64 `yaml:"duration_buckets"`
+	// BytesBuckets are buckets of bytes transferred by get, get_range and upload operations. DefaultBytesBuckets are used if empty.
+	BytesBuckets []float64 `yaml:"bytes_buckets"`
+}
+
+// Validate returns error if configuration is invalid.
+func (c MetricsConfig) Validate() error {
+	for name, buckets := range map[string][]float64{"duration_buckets": c.DurationBuckets, "bytes_buckets": c.BytesBuckets} {
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return errors.Errorf("%s have to be sorted in increasing order", name)
+			}
+		}
+	}
+	return nil
+}
+
 // BucketWithMetrics takes a bucket and registers metrics with the given registry for
 // operations run against the bucket.
 func BucketWithMetrics(name string, b Bucket, reg prometheus.Registerer) *metricBucket {
+	// Default config is always valid.
+	bkt, _ := BucketWithMetricsConfig(name, b, MetricsConfig{}, reg)
+	return bkt
+}
+
+// BucketWithMetricsConfig is like BucketWithMetrics, but allows to configure histogram buckets.
+func BucketWithMetricsConfig(name string, b Bucket, conf MetricsConfig, reg prometheus.Registerer) (*metricBucket, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate metrics config")
+	}
+	if len(conf.DurationBuckets) == 0 {
+		conf.DurationBuckets = DefaultDurationBuckets
+	}
+	if len(conf.BytesBuckets) == 0 {
+		conf.BytesBuckets = DefaultBytesBuckets
+	}
+
 	bkt := &metricBucket{
 		bkt:                 b,
 		isOpFailureExpected: func(err error) bool { return false },
@@ -247,28 +356,34 @@ func BucketWithMetrics(name string, b Bucket, reg prometheus.Registerer) *metric
 			Name:        "thanos_objstore_bucket_operation_duration_seconds",
 			Help:        "Duration of successful operations against the bucket",
 			ConstLabels: prometheus.Labels{"bucket": name},
-			Buckets:     []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+			Buckets:     conf.DurationBuckets,
+		}, []string{"operation"}),
+		opsTransferredBytes: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "thanos_objstore_bucket_operation_transferred_bytes",
+			Help:        "Number of bytes transferred by successful get, get_range and upload operations against the bucket.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+			Buckets:     conf.BytesBuckets,
 		}, []string{"operation"}),
+		abortedUploads: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_aborted_uploads_total",
+			Help:        "Total number of uploads that failed after part of the data was already sent. Depending on the provider those can leave incomplete multipart uploads behind.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}),
 		lastSuccessfulUploadTime: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "thanos_objstore_bucket_last_successful_upload_time",
 			Help: "Second timestamp of the last successful upload to the bucket.",
 		}, []string{"bucket"}),
 	}
-	for _, op := range []string{
-		iterOp,
-		sizeOp,
-		getOp,
-		getRangeOp,
-		existsOp,
-		uploadOp,
-		deleteOp,
-	} {
+	for _, op := range allOps {
 		bkt.ops.WithLabelValues(op)
 		bkt.opsFailures.WithLabelValues(op)
 		bkt.opsDuration.WithLabelValues(op)
 	}
+	for _, op := range []string{getOp, getRangeOp, uploadOp} {
+		bkt.opsTransferredBytes.WithLabelValues(op)
+	}
 	bkt.lastSuccessfulUploadTime.WithLabelValues(b.Name())
-	return bkt
+	return bkt, nil
 }
 
 type metricBucket struct {
@@ -279,29 +394,26 @@ type metricBucket struct {
 	isOpFailureExpected IsOpFailureExpectedFunc
 
 	opsDuration              *prometheus.HistogramVec
+	opsTransferredBytes      *prometheus.HistogramVec
+	abortedUploads           prometheus.Counter
 	lastSuccessfulUploadTime *prometheus.GaugeVec
 }
 
 func (b *metricBucket) WithExpectedErrs(fn IsOpFailureExpectedFunc) Bucket {
-	return &metricBucket{
-		bkt:                      b.bkt,
-		ops:                      b.ops,
-		opsFailures:              b.opsFailures,
-		isOpFailureExpected:      fn,
-		opsDuration:              b.opsDuration,
-		lastSuccessfulUploadTime: b.lastSuccessfulUploadTime,
-	}
+	wb := *b
+	wb.isOpFailureExpected = fn
+	return &wb
 }
 
 func (b *metricBucket) ReaderWithExpectedErrs(fn IsOpFailureExpectedFunc) BucketReader {
 	return b.WithExpectedErrs(fn)
 }
 
-func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string) error) error {
+func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string) error, options ...IterOption) error {
 	const op = iterOp
 	b.ops.WithLabelValues(op).Inc()
 
-	err := b.bkt.Iter(ctx, dir, f)
+	err := b.bkt.Iter(ctx, dir, f, options...)
 	if err != nil && !b.isOpFailureExpected(err) {
 		b.opsFailures.WithLabelValues(op).Inc()
 	}
@@ -324,6 +436,22 @@ func (b *metricBucket) ObjectSize(ctx context.Context, name string) (uint64, err
 	return rc, nil
 }
 
+func (b *metricBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	const op = attrsOp
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	attrs, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		if !b.isOpFailureExpected(err) {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return attrs, err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return attrs, nil
+}
+
 func (b *metricBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	const op = getOp
 	b.ops.WithLabelValues(op).Inc()
@@ -339,11 +467,36 @@ func (b *metricBucket) Get(ctx context.Context, name string) (io.ReadCloser, err
 		rc,
 		op,
 		b.opsDuration,
+		b.opsTransferredBytes,
 		b.opsFailures,
 		b.isOpFailureExpected,
 	), nil
 }
 
+func (b *metricBucket) GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error) {
+	const op = getOp
+	b.ops.WithLabelValues(op).Inc()
+
+	rc, newVersion, err := GetIfChanged(ctx, b.bkt, name, version)
+	if err != nil {
+		if !b.isOpFailureExpected(err) {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return nil, "", err
+	}
+	if rc == nil {
+		return nil, newVersion, nil
+	}
+	return newTimingReadCloser(
+		rc,
+		op,
+		b.opsDuration,
+		b.opsTransferredBytes,
+		b.opsFailures,
+		b.isOpFailureExpected,
+	), newVersion, nil
+}
+
 func (b *metricBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	const op = getRangeOp
 	b.ops.WithLabelValues(op).Inc()
@@ -359,6 +512,7 @@ func (b *metricBucket) GetRange(ctx context.Context, name string, off, length in
 		rc,
 		op,
 		b.opsDuration,
+		b.opsTransferredBytes,
 		b.opsFailures,
 		b.isOpFailureExpected,
 	), nil
@@ -385,14 +539,19 @@ func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) err
 	b.ops.WithLabelValues(op).Inc()
 
 	start := time.Now()
-	if err := b.bkt.Upload(ctx, name, r); err != nil {
+	cr := &countingReader{r: r}
+	if err := b.bkt.Upload(ctx, name, cr); err != nil {
 		if !b.isOpFailureExpected(err) {
 			b.opsFailures.WithLabelValues(op).Inc()
 		}
+		if cr.n > 0 {
+			b.abortedUploads.Inc()
+		}
 		return err
 	}
 	b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
 	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	b.opsTransferredBytes.WithLabelValues(op).Observe(float64(cr.n))
 	return nil
 }
 
@@ -428,23 +587,27 @@ type timingReadCloser struct {
 	io.ReadCloser
 
 	alreadyGotErr bool
+	readBytes     int64
 
 	start             time.Time
 	op                string
 	duration          *prometheus.HistogramVec
+	transferred       *prometheus.HistogramVec
 	failed            *prometheus.CounterVec
 	isFailureExpected IsOpFailureExpectedFunc
 }
 
-func newTimingReadCloser(rc io.ReadCloser, op string, dur *prometheus.HistogramVec, failed *prometheus.CounterVec, isFailureExpected IsOpFailureExpectedFunc) *timingReadCloser {
+func newTimingReadCloser(rc io.ReadCloser, op string, dur, transferred *prometheus.HistogramVec, failed *prometheus.CounterVec, isFailureExpected IsOpFailureExpectedFunc) *timingReadCloser {
 	// Initialize the metrics with 0.
 	dur.WithLabelValues(op)
+	transferred.WithLabelValues(op)
 	failed.WithLabelValues(op)
 	return &timingReadCloser{
 		ReadCloser:        rc,
 		start:             time.Now(),
 		op:                op,
 		duration:          dur,
+		transferred:       transferred,
 		failed:            failed,
 		isFailureExpected: isFailureExpected,
 	}
@@ -457,6 +620,7 @@ func (rc *timingReadCloser) Close() error {
 	}
 	if !rc.alreadyGotErr && err == nil {
 		rc.duration.WithLabelValues(rc.op).Observe(time.Since(rc.start).Seconds())
+		rc.transferred.WithLabelValues(rc.op).Observe(float64(rc.readBytes))
 		rc.alreadyGotErr = true
 	}
 	return err
@@ -464,6 +628,7 @@ func (rc *timingReadCloser) Close() error {
 
 func (rc *timingReadCloser) Read(b []byte) (n int, err error) {
 	n, err = rc.ReadCloser.Read(b)
+	rc.readBytes += int64(n)
 	// Report metric just once.
 	if !rc.alreadyGotErr && err != nil && err != io.EOF {
 		if !rc.isFailureExpected(err) {
@@ -473,3 +638,20 @@ func (rc *timingReadCloser) Read(b []byte) (n int, err error) {
 	}
 	return n, err
 }
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// upstream returns the wrapped reader, so upfront size can be still guessed.
+func (r *countingReader) upstream() io.Reader {
+	return r.r
+}
@@ -4,61 +4,124 @@
 package objstore
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
 func TestMetricBucket_Close(t *testing.T) {
 	bkt := BucketWithMetrics("abc", NewInMemBucket(), nil)
 	// Expected initialized metrics.
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 3, promtest.CollectAndCount(bkt.opsTransferredBytes))
 
 	AcceptanceTest(t, bkt.WithExpectedErrs(bkt.IsObjNotFoundErr))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(iterOp)))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.ops.WithLabelValues(iterOp)))
 	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(sizeOp)))
-	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(getOp)))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(attrsOp)))
+	testutil.Equals(t, float64(5), promtest.ToFloat64(bkt.ops.WithLabelValues(getOp)))
 	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(getRangeOp)))
 	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(existsOp)))
 	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(uploadOp)))
 	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(deleteOp)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(iterOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(sizeOp)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(attrsOp)))
 	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(getOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(getRangeOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(existsOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(uploadOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(deleteOp)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
 	lastUpload := promtest.ToFloat64(bkt.lastSuccessfulUploadTime)
 	testutil.Assert(t, lastUpload > 0, "last upload not greater than 0, val: %f", lastUpload)
 
 	// Clear bucket, but don't clear metrics to ensure we use same.
 	bkt.bkt = NewInMemBucket()
 	AcceptanceTest(t, bkt)
-	testutil.Equals(t, float64(12), promtest.ToFloat64(bkt.ops.WithLabelValues(iterOp)))
+	testutil.Equals(t, float64(16), promtest.ToFloat64(bkt.ops.WithLabelValues(iterOp)))
 	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(sizeOp)))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(getOp)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(attrsOp)))
+	testutil.Equals(t, float64(10), promtest.ToFloat64(bkt.ops.WithLabelValues(getOp)))
 	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(getRangeOp)))
 	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(existsOp)))
 	testutil.Equals(t, float64(12), promtest.ToFloat64(bkt.ops.WithLabelValues(uploadOp)))
 	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(deleteOp)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.ops))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(iterOp)))
 	// Not expected not found error here.
 	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(sizeOp)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(attrsOp)))
 	// Not expected not found errors, this should increment failure metric on get for not found as well, so +2.
 	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(getOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(getRangeOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(existsOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(uploadOp)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(deleteOp)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 8, promtest.CollectAndCount(bkt.opsDuration))
 	testutil.Assert(t, promtest.ToFloat64(bkt.lastSuccessfulUploadTime) > lastUpload)
 }
+
+// failingUploadBucket reads part of the uploaded content and fails.
+type failingUploadBucket struct {
+	Bucket
+}
+
+func (b failingUploadBucket) Upload(_ context.Context, _ string, r io.Reader) error {
+	_, _ = io.CopyN(ioutil.Discard, r, 2)
+	return errors.New("connection lost")
+}
+
+func TestMetricBucket_TransferredBytes(t *testing.T) {
+	ctx := context.Background()
+
+	bkt, err := BucketWithMetricsConfig("abc", NewInMemBucket(), MetricsConfig{BytesBuckets: []float64{4, 16}}, nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	rc, err = bkt.GetRange(ctx, "obj", 1, 3)
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+
+	for op, expected := range map[string]float64{uploadOp: 7, getOp: 7, getRangeOp: 3} {
+		h := histogram(t, bkt.opsTransferredBytes.WithLabelValues(op))
+		testutil.Equals(t, uint64(1), h.GetSampleCount())
+		testutil.Equals(t, expected, h.GetSampleSum())
+		testutil.Equals(t, []float64{4, 16}, []float64{h.Bucket[0].GetUpperBound(), h.Bucket[1].GetUpperBound()})
+	}
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.abortedUploads))
+
+	bkt.bkt = failingUploadBucket{Bucket: NewInMemBucket()}
+	testutil.NotOk(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.abortedUploads))
+	testutil.Equals(t, uint64(1), histogram(t, bkt.opsTransferredBytes.WithLabelValues(uploadOp)).GetSampleCount())
+
+	_, err = BucketWithMetricsConfig("abc", NewInMemBucket(), MetricsConfig{DurationBuckets: []float64{1, 0.1}}, nil)
+	testutil.NotOk(t, err)
+}
+
+func histogram(t *testing.T, o prometheus.Observer) *dto.Histogram {
+	m := &dto.Metric{}
+	testutil.Ok(t, o.(prometheus.Metric).Write(m))
+	return m.GetHistogram()
+}
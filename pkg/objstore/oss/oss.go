@@ -150,6 +150,23 @@ func (b *Bucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
 	return 0, errors.New("content-length header not found")
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	m, err := b.bucket.GetObjectMeta(name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	size, err := strconv.ParseInt(m.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrap(err, "convert content-length")
+	}
+	mod, err := http.ParseTime(m.Get("Last-Modified"))
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrap(err, "parse last-modified")
+	}
+	return objstore.ObjectAttributes{Size: size, LastModified: mod}, nil
+}
+
 // NewBucket returns a new Bucket using the provided oss config values.
 func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error) {
 	var config Config
@@ -181,25 +198,36 @@ func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error
 	return bkt, nil
 }
 
-// Iter calls f for each entry in the given directory (not recursive). The argument to f is the full
+// Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, objstore.DirDelim) + objstore.DirDelim
 	}
 
+	listOptions := []alioss.Option{alioss.Prefix(dir)}
+	if !params.Recursive {
+		listOptions = append(listOptions, alioss.Delimiter(objstore.DirDelim))
+	}
+
 	marker := alioss.Marker("")
 	for {
 		if err := ctx.Err(); err != nil {
 			return errors.Wrap(err, "context closed while iterating bucket")
 		}
-		objects, err := b.bucket.ListObjects(alioss.Prefix(dir), alioss.Delimiter(objstore.DirDelim), marker)
+		objects, err := b.bucket.ListObjects(append(listOptions, marker)...)
 		if err != nil {
 			return errors.Wrap(err, "listing aliyun oss bucket failed")
 		}
 		marker = alioss.Marker(objects.NextMarker)
 
 		for _, object := range objects.Objects {
+			if params.AttributesFunc != nil {
+				if err := params.AttributesFunc(object.Key, objstore.ObjectAttributes{Size: object.Size, LastModified: object.LastModified}); err != nil {
+					return errors.Wrapf(err, "attributes callback func invoke for object %s failed", object.Key)
+				}
+			}
 			if err := f(object.Key); err != nil {
 				return errors.Wrapf(err, "callback func invoke for object %s failed ", object.Key)
 			}
@@ -0,0 +1,319 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// ParallelDownloadOptions configures splitting of big objects into ranges downloaded concurrently.
+type ParallelDownloadOptions struct {
+	// PartSize is the size of a single range request. Objects not bigger than PartSize are downloaded with a single request.
+	PartSize int64
+	// Concurrency is the maximum number of range requests in flight for a single object.
+	Concurrency int
+	// Limiter bounds the bytes fetched or buffered by all downloads sharing it. Nil means no bound beyond
+	// Concurrency * PartSize per object.
+	Limiter *InFlightBytesLimiter
+}
+
+// DefaultParallelDownloadOptions are used for index files by the store gateway. All downloads using them share
+// a budget of 64MiB in flight, however many blocks are loaded concurrently.
+var DefaultParallelDownloadOptions = ParallelDownloadOptions{
+	PartSize:    8 * 1024 * 1024,
+	Concurrency: 4,
+	Limiter:     NewInFlightBytesLimiter(64 * 1024 * 1024),
+}
+
+// InFlightBytesLimiter bounds the total size of ranges fetched or buffered by parallel downloads sharing it.
+type InFlightBytesLimiter struct {
+	max int64
+	sem *semaphore.Weighted
+}
+
+// NewInFlightBytesLimiter returns a limiter allowing up to max bytes in flight.
+func NewInFlightBytesLimiter(max int64) *InFlightBytesLimiter {
+	return &InFlightBytesLimiter{max: max, sem: semaphore.NewWeighted(max)}
+}
+
+// acquire waits until n bytes can be fetched and returns the number of bytes to release afterwards. Parts bigger than
+// the limit take the whole limit. It returns immediately on nil limiter.
+func (l *InFlightBytesLimiter) acquire(ctx context.Context, n int64) (int64, error) {
+	if l == nil {
+		return 0, nil
+	}
+	if n > l.max {
+		n = l.max
+	}
+	if err := l.sem.Acquire(ctx, n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (l *InFlightBytesLimiter) release(n int64) {
+	if l == nil || n == 0 {
+		return
+	}
+	l.sem.Release(n)
+}
+
+func (o ParallelDownloadOptions) enabled(length int64) bool {
+	return o.Concurrency > 1 && o.PartSize > 0 && length > o.PartSize
+}
+
+// GetRangeParallel returns a reader of the given object range which is fetched by up to opts.Concurrency concurrent range
+// requests of opts.PartSize bytes and reassembled in order. At most opts.Concurrency parts are buffered in memory,
+// and parts count towards opts.Limiter until they are read. Reader has to be closed to release resources.
+func GetRangeParallel(ctx context.Context, bkt BucketReader, name string, off, length int64, opts ParallelDownloadOptions) (io.ReadCloser, error) {
+	if !opts.enabled(length) {
+		return bkt.GetRange(ctx, name, off, length)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelRangeReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		sem:     make(chan struct{}, opts.Concurrency),
+		limiter: opts.Limiter,
+	}
+	for o := off; o < off+length; o += opts.PartSize {
+		partLen := opts.PartSize
+		if o+partLen > off+length {
+			partLen = off + length - o
+		}
+		r.parts = append(r.parts, part{off: o, length: partLen, res: make(chan partResult, 1)})
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		for i := range r.parts {
+			select {
+			case <-ctx.Done():
+				return
+			case r.sem <- struct{}{}:
+			}
+			// Parts acquire the limiter in order, so the part read next never waits for later ones.
+			held, err := r.limiter.acquire(ctx, r.parts[i].length)
+			if err != nil {
+				return
+			}
+
+			r.wg.Add(1)
+			go func(p part) {
+				defer r.wg.Done()
+				b, err := getRangeBytes(ctx, bkt, name, p.off, p.length)
+				p.res <- partResult{b: b, held: held, err: errors.Wrapf(err, "get range [%d, %d) of %s", p.off, p.off+p.length, name)}
+			}(r.parts[i])
+		}
+	}()
+	return r, nil
+}
+
+func getRangeBytes(ctx context.Context, bkt BucketReader, name string, off, length int64) (_ []byte, err error) {
+	rc, err := bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "close range reader")
+
+	buf := bytes.NewBuffer(make([]byte, 0, length))
+	if _, err := io.Copy(buf, rc); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != length {
+		return nil, errors.Errorf("expected %d bytes, got %d", length, buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+type part struct {
+	off, length int64
+	res         chan partResult
+}
+
+type partResult struct {
+	b []byte
+	// held is the number of bytes the part holds of the limiter.
+	held int64
+	err  error
+}
+
+type parallelRangeReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// sem limits number of parts fetched or buffered, but not yet read.
+	sem     chan struct{}
+	limiter *InFlightBytesLimiter
+	parts   []part
+	next    int
+	cur     *bytes.Reader
+	curHeld int64
+	err     error
+}
+
+func (r *parallelRangeReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.next >= len(r.parts) {
+			return 0, io.EOF
+		}
+
+		var res partResult
+		select {
+		case <-r.ctx.Done():
+			res.err = r.ctx.Err()
+		case res = <-r.parts[r.next].res:
+		}
+		r.limiter.release(r.curHeld)
+		r.curHeld = 0
+		if res.err != nil {
+			r.limiter.release(res.held)
+			r.err = res.err
+			return 0, r.err
+		}
+		r.next++
+		r.cur, r.curHeld = bytes.NewReader(res.b), res.held
+		// Allow fetching next part, while the current one is being read.
+		<-r.sem
+	}
+	return r.cur.Read(p)
+}
+
+func (r *parallelRangeReader) Close() error {
+	r.cancel()
+	r.wg.Wait()
+
+	// Release parts fetched, but not read.
+	r.limiter.release(r.curHeld)
+	r.curHeld = 0
+	for ; r.next < len(r.parts); r.next++ {
+		select {
+		case res := <-r.parts[r.next].res:
+			r.limiter.release(res.held)
+		default:
+		}
+	}
+	return nil
+}
+
+// DownloadFileParallel is like DownloadFile, but objects bigger than opts.PartSize are downloaded by concurrent range requests
+// written directly to their position in the destination file.
+func DownloadFileParallel(ctx context.Context, logger log.Logger, bkt BucketReader, src, dst string, opts ParallelDownloadOptions) (err error) {
+	size, err := bkt.ObjectSize(ctx, src)
+	if err != nil {
+		return errors.Wrapf(err, "get size of %s", src)
+	}
+	if !opts.enabled(int64(size)) {
+		return DownloadFile(ctx, logger, bkt, src, dst)
+	}
+
+	if fi, err := os.Stat(dst); err == nil {
+		if fi.IsDir() {
+			dst = filepath.Join(dst, filepath.Base(src))
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrap(err, "create file")
+	}
+	defer func() {
+		if err != nil {
+			if rerr := os.Remove(dst); rerr != nil {
+				level.Warn(logger).Log("msg", "failed to remove partially downloaded file", "file", dst, "err", rerr)
+			}
+		}
+	}()
+	defer runutil.CloseWithErrCapture(&err, f, "download block's output file")
+
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, opts.Concurrency)
+	for off := int64(0); off < int64(size); off += opts.PartSize {
+		length := opts.PartSize
+		if off+length > int64(size) {
+			length = int64(size) - off
+		}
+
+		select {
+		case <-gctx.Done():
+		case sem <- struct{}{}:
+		}
+		if gctx.Err() != nil {
+			break
+		}
+		held, err := opts.Limiter.acquire(gctx, length)
+		if err != nil {
+			<-sem
+			break
+		}
+
+		off := off
+		g.Go(func() error {
+			defer func() { <-sem }()
+			defer opts.Limiter.release(held)
+
+			b, err := getRangeBytes(gctx, bkt, src, off, length)
+			if err != nil {
+				return errors.Wrapf(err, "get range [%d, %d) of %s", off, off+length, src)
+			}
+			_, err = f.WriteAt(b, off)
+			return errors.Wrapf(err, "write range [%d, %d) to %s", off, off+length, dst)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// DownloadDirParallel is like DownloadDir, but uses DownloadFileParallel to download files.
+func DownloadDirParallel(ctx context.Context, logger log.Logger, bkt BucketReader, src, dst string, opts ParallelDownloadOptions) error {
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return errors.Wrap(err, "create dir")
+	}
+
+	var downloadedFiles []string
+	if err := bkt.Iter(ctx, src, func(name string) error {
+		if strings.HasSuffix(name, DirDelim) {
+			return DownloadDirParallel(ctx, logger, bkt, name, filepath.Join(dst, filepath.Base(name)), opts)
+		}
+		if err := DownloadFileParallel(ctx, logger, bkt, name, dst, opts); err != nil {
+			return err
+		}
+
+		downloadedFiles = append(downloadedFiles, filepath.Join(dst, filepath.Base(name)))
+		return nil
+	}); err != nil {
+		// Best-effort cleanup if the download failed.
+		for _, f := range downloadedFiles {
+			if rerr := os.Remove(f); rerr != nil {
+				level.Warn(logger).Log("msg", "failed to remove file on partial dir download error", "file", f, "err", rerr)
+			}
+		}
+		return err
+	}
+	return nil
+}
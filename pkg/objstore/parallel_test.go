@@ -0,0 +1,162 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// rangeCountingBucket counts GetRange calls and tracks maximum number of concurrent ones.
+type rangeCountingBucket struct {
+	Bucket
+
+	mtx                  sync.Mutex
+	calls, inflight, max int
+	failOff              int64
+}
+
+func (b *rangeCountingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	b.calls++
+	b.inflight++
+	if b.inflight > b.max {
+		b.max = b.inflight
+	}
+	b.mtx.Unlock()
+	defer func() {
+		b.mtx.Lock()
+		b.inflight--
+		b.mtx.Unlock()
+	}()
+
+	if b.failOff > 0 && off == b.failOff {
+		return nil, errors.New("range failed")
+	}
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func TestGetRangeParallel(t *testing.T) {
+	ctx := context.Background()
+	content := make([]byte, 1000)
+	_, err := rand.New(rand.NewSource(1)).Read(content)
+	testutil.Ok(t, err)
+
+	inmem := NewInMemBucket()
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(content)))
+
+	for _, tcase := range []struct {
+		off, length   int64
+		opts          ParallelDownloadOptions
+		expectedCalls int
+	}{
+		{off: 0, length: 1000, opts: ParallelDownloadOptions{PartSize: 100, Concurrency: 3}, expectedCalls: 10},
+		{off: 50, length: 901, opts: ParallelDownloadOptions{PartSize: 100, Concurrency: 3}, expectedCalls: 10},
+		{off: 10, length: 100, opts: ParallelDownloadOptions{PartSize: 100, Concurrency: 3}, expectedCalls: 1},
+		{off: 0, length: 1000, opts: ParallelDownloadOptions{PartSize: 100, Concurrency: 1}, expectedCalls: 1},
+	} {
+		bkt := &rangeCountingBucket{Bucket: inmem}
+		rc, err := GetRangeParallel(ctx, bkt, "obj", tcase.off, tcase.length, tcase.opts)
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+
+		testutil.Equals(t, content[tcase.off:tcase.off+tcase.length], b)
+		testutil.Equals(t, tcase.expectedCalls, bkt.calls)
+		testutil.Assert(t, bkt.max <= tcase.opts.Concurrency, "expected at most %d concurrent requests, got %d", tcase.opts.Concurrency, bkt.max)
+	}
+
+	t.Run("limiter", func(t *testing.T) {
+		limiter := NewInFlightBytesLimiter(200)
+		opts := ParallelDownloadOptions{PartSize: 100, Concurrency: 4, Limiter: limiter}
+
+		bkt := &rangeCountingBucket{Bucket: inmem}
+		rc, err := GetRangeParallel(ctx, bkt, "obj", 0, 1000, opts)
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, content, b)
+		testutil.Assert(t, bkt.max <= 2, "expected at most 2 concurrent requests, got %d", bkt.max)
+
+		// Parts fetched, but not read, are released on close.
+		rc, err = GetRangeParallel(ctx, bkt, "obj", 0, 1000, opts)
+		testutil.Ok(t, err)
+		_, err = rc.Read(make([]byte, 10))
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Assert(t, limiter.sem.TryAcquire(200), "expected all bytes to be released")
+	})
+
+	t.Run("failed part", func(t *testing.T) {
+		bkt := &rangeCountingBucket{Bucket: inmem, failOff: 300}
+		rc, err := GetRangeParallel(ctx, bkt, "obj", 0, 1000, ParallelDownloadOptions{PartSize: 100, Concurrency: 3})
+		testutil.Ok(t, err)
+		_, err = ioutil.ReadAll(rc)
+		testutil.NotOk(t, err)
+		testutil.Ok(t, rc.Close())
+	})
+}
+
+func TestDownloadDirParallel(t *testing.T) {
+	ctx := context.Background()
+	content := make([]byte, 1000)
+	_, err := rand.New(rand.NewSource(1)).Read(content)
+	testutil.Ok(t, err)
+
+	inmem := NewInMemBucket()
+	testutil.Ok(t, inmem.Upload(ctx, "block/index", bytes.NewReader(content)))
+	testutil.Ok(t, inmem.Upload(ctx, "block/meta.json", bytes.NewReader([]byte("{}"))))
+	testutil.Ok(t, inmem.Upload(ctx, "block/chunks/000001", bytes.NewReader(content[:250])))
+
+	dir, err := ioutil.TempDir("", "download-parallel")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := &rangeCountingBucket{Bucket: inmem}
+	testutil.Ok(t, DownloadDirParallel(ctx, log.NewNopLogger(), bkt, "block", dir, ParallelDownloadOptions{PartSize: 100, Concurrency: 4}))
+	testutil.Equals(t, 13, bkt.calls)
+
+	for name, expected := range map[string][]byte{
+		"index":         content,
+		"meta.json":     []byte("{}"),
+		"chunks/000001": content[:250],
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		testutil.Ok(t, err)
+		testutil.Equals(t, expected, b)
+	}
+
+	t.Run("limiter", func(t *testing.T) {
+		limiter := NewInFlightBytesLimiter(200)
+		bkt := &rangeCountingBucket{Bucket: inmem}
+		testutil.Ok(t, DownloadFileParallel(ctx, log.NewNopLogger(), bkt, "block/index", filepath.Join(dir, "limited"), ParallelDownloadOptions{PartSize: 100, Concurrency: 4, Limiter: limiter}))
+		testutil.Assert(t, bkt.max <= 2, "expected at most 2 concurrent requests, got %d", bkt.max)
+		testutil.Assert(t, limiter.sem.TryAcquire(200), "expected all bytes to be released")
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "limited"))
+		testutil.Ok(t, err)
+		testutil.Equals(t, content, b)
+	})
+
+	t.Run("failed part", func(t *testing.T) {
+		bkt := &rangeCountingBucket{Bucket: inmem, failOff: 500}
+		dst := filepath.Join(dir, "failed")
+		testutil.NotOk(t, DownloadFileParallel(ctx, log.NewNopLogger(), bkt, "block/index", dst, ParallelDownloadOptions{PartSize: 100, Concurrency: 4}))
+		_, err := os.Stat(dst)
+		testutil.Assert(t, os.IsNotExist(err), "expected partially downloaded file to be removed")
+	})
+}
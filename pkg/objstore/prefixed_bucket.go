@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// PrefixedBucket is a Bucket that keeps all objects under the given path prefix of the wrapped bucket.
+// This allows multiple Thanos installations or tenants to share a single physical bucket.
+type PrefixedBucket struct {
+	bkt    Bucket
+	prefix string
+}
+
+// NewPrefixedBucket returns a new PrefixedBucket. If prefix is empty or contains only delimiters, the given bucket
+// is returned as is.
+func NewPrefixedBucket(bkt Bucket, prefix string) Bucket {
+	prefix = strings.Trim(prefix, DirDelim)
+	if prefix == "" {
+		return bkt
+	}
+	return &PrefixedBucket{bkt: bkt, prefix: prefix + DirDelim}
+}
+
+// withPrefix returns the object name within the wrapped bucket. Empty names are passed as is,
+// so the underlying provider can report them as invalid.
+func (p *PrefixedBucket) withPrefix(name string) string {
+	if name == "" {
+		return name
+	}
+	return p.prefix + name
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory, but without the bucket prefix.
+func (p *PrefixedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	if attrsFn := ApplyIterOptions(options...).AttributesFunc; attrsFn != nil {
+		options = append(options[:len(options):len(options)], WithObjectAttributes(func(name string, attrs ObjectAttributes) error {
+			return attrsFn(strings.TrimPrefix(name, p.prefix), attrs)
+		}))
+	}
+	return p.bkt.Iter(ctx, p.prefix+dir, func(name string) error {
+		return f(strings.TrimPrefix(name, p.prefix))
+	}, options...)
+}
+
+func (p *PrefixedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return p.bkt.Get(ctx, p.withPrefix(name))
+}
+
+func (p *PrefixedBucket) GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error) {
+	return GetIfChanged(ctx, p.bkt, p.withPrefix(name), version)
+}
+
+func (p *PrefixedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return p.bkt.GetRange(ctx, p.withPrefix(name), off, length)
+}
+
+func (p *PrefixedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return p.bkt.Exists(ctx, p.withPrefix(name))
+}
+
+func (p *PrefixedBucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
+	return p.bkt.ObjectSize(ctx, p.withPrefix(name))
+}
+
+func (p *PrefixedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	return p.bkt.Attributes(ctx, p.withPrefix(name))
+}
+
+func (p *PrefixedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	return p.bkt.Upload(ctx, p.withPrefix(name), r)
+}
+
+func (p *PrefixedBucket) Delete(ctx context.Context, name string) error {
+	return p.bkt.Delete(ctx, p.withPrefix(name))
+}
+
+func (p *PrefixedBucket) IsObjNotFoundErr(err error) bool {
+	return p.bkt.IsObjNotFoundErr(err)
+}
+
+func (p *PrefixedBucket) Close() error {
+	return p.bkt.Close()
+}
+
+// Name returns the bucket name for the provider.
+func (p *PrefixedBucket) Name() string {
+	return p.bkt.Name()
+}
@@ -0,0 +1,62 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPrefixedBucket(t *testing.T) {
+	for _, prefix := range []string{"tenant", "/tenant/", "a/b/tenant"} {
+		t.Run(prefix, func(t *testing.T) {
+			bkt := NewInMemBucket()
+			AcceptanceTest(t, NewPrefixedBucket(bkt, prefix))
+
+			expectedPrefix := strings.Trim(prefix, DirDelim) + DirDelim
+			for name := range bkt.Objects() {
+				testutil.Assert(t, strings.HasPrefix(name, expectedPrefix), "object %s not stored under prefix %s", name, expectedPrefix)
+			}
+		})
+	}
+}
+
+func TestPrefixedBucket_SharedBucket(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewInMemBucket()
+
+	a := NewPrefixedBucket(bkt, "a")
+	b := NewPrefixedBucket(bkt, "b")
+	testutil.Ok(t, a.Upload(ctx, "dir/obj", strings.NewReader("a")))
+	testutil.Ok(t, b.Upload(ctx, "dir/obj", strings.NewReader("b")))
+
+	var seen []string
+	testutil.Ok(t, a.Iter(ctx, "dir/", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/obj"}, seen)
+
+	testutil.Ok(t, b.Delete(ctx, "dir/obj"))
+	ok, err := a.Exists(ctx, "dir/obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "object of other prefix was deleted")
+
+	var names []string
+	for name := range bkt.Objects() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	testutil.Equals(t, []string{"a/dir/obj"}, names)
+}
+
+func TestNewPrefixedBucket_EmptyPrefix(t *testing.T) {
+	bkt := NewInMemBucket()
+	testutil.Equals(t, Bucket(bkt), NewPrefixedBucket(bkt, ""))
+	testutil.Equals(t, Bucket(bkt), NewPrefixedBucket(bkt, "/"))
+}
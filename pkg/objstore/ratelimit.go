@@ -0,0 +1,316 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit specifies limits for a single operation type. Zero value means no limit.
+type RateLimit struct {
+	// OpsPerSecond is the maximum number of operations started per second.
+	OpsPerSecond float64 `yaml:"ops_per_second"`
+	// BytesPerSecond is the maximum number of bytes transferred per second. Applies only to operations that
+	// transfer object content (get, get_range and upload).
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+}
+
+// RateLimitConfig configures rate limits for operations against a bucket.
+type RateLimitConfig struct {
+	// Default limit applied to every operation type that does not have a dedicated entry in Operations.
+	Default RateLimit `yaml:"default"`
+	// Operations contains limits per operation type. Keys are operation names as used in
+	// thanos_objstore_bucket_operations_total metric e.g get, get_range, upload.
+	Operations map[string]RateLimit `yaml:"operations"`
+	// ReadBytesPerSecond is the maximum number of bytes read per second by get and get_range operations together.
+	// Applies in addition to the limits of the operations. Zero value means no limit.
+	ReadBytesPerSecond int64 `yaml:"read_bytes_per_second"`
+}
+
+// Validate returns error if configuration is invalid.
+func (c RateLimitConfig) Validate() error {
+	if c.ReadBytesPerSecond < 0 {
+		return errors.New("read_bytes_per_second cannot be negative")
+	}
+	if err := c.Default.validate(); err != nil {
+		return errors.Wrap(err, "default")
+	}
+	for op, l := range c.Operations {
+		if !isValidOp(op) {
+			return errors.Errorf("unknown operation %q", op)
+		}
+		if err := l.validate(); err != nil {
+			return errors.Wrap(err, op)
+		}
+	}
+	return nil
+}
+
+// Enabled returns true if any limit is configured.
+func (c RateLimitConfig) Enabled() bool {
+	if c.Default != (RateLimit{}) || c.ReadBytesPerSecond > 0 {
+		return true
+	}
+	for _, l := range c.Operations {
+		if l != (RateLimit{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l RateLimit) validate() error {
+	if l.OpsPerSecond < 0 {
+		return errors.New("ops_per_second cannot be negative")
+	}
+	if l.BytesPerSecond < 0 {
+		return errors.New("bytes_per_second cannot be negative")
+	}
+	return nil
+}
+
+func isValidOp(op string) bool {
+	for _, o := range allOps {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+type opLimiters struct {
+	ops   *rate.Limiter
+	bytes *rate.Limiter
+}
+
+// RateLimitedBucket is a Bucket that throttles operations according to the given RateLimitConfig.
+// Operations block until they are allowed to proceed or until the context is canceled.
+type RateLimitedBucket struct {
+	bkt Bucket
+
+	limiters  map[string]opLimiters
+	readBytes *rate.Limiter
+	waitTime  *prometheus.CounterVec
+}
+
+// NewRateLimitedBucket returns a new RateLimitedBucket wrapping the given bucket. Name identifies the limiter in metrics,
+// so multiple limiters can be applied to the same bucket.
+func NewRateLimitedBucket(name string, bkt Bucket, conf RateLimitConfig, reg prometheus.Registerer) (*RateLimitedBucket, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate rate limit config")
+	}
+
+	b := &RateLimitedBucket{
+		bkt:      bkt,
+		limiters: make(map[string]opLimiters, len(allOps)),
+		waitTime: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_rate_limit_wait_seconds_total",
+			Help:        "Total time operations against a bucket spent waiting for the rate limiter.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name(), "limiter": name},
+		}, []string{"operation"}),
+	}
+	for _, op := range allOps {
+		l, ok := conf.Operations[op]
+		if !ok {
+			l = conf.Default
+		}
+		b.limiters[op] = newOpLimiters(l)
+		b.waitTime.WithLabelValues(op)
+	}
+	if conf.ReadBytesPerSecond > 0 {
+		b.readBytes = newBytesLimiter(conf.ReadBytesPerSecond)
+	}
+	return b, nil
+}
+
+// IsRetryableErr implements RetryableErrClassifier, so that a RetryBucket wrapping the rate limited bucket classifies
+// errors the same way as for the wrapped bucket.
+func (b *RateLimitedBucket) IsRetryableErr(err error) bool {
+	if c, ok := b.bkt.(RetryableErrClassifier); ok {
+		return c.IsRetryableErr(err)
+	}
+	return IsRetryableErr(err)
+}
+
+// RetriesRequests implements RetryingClient.
+func (b *RateLimitedBucket) RetriesRequests() bool {
+	return RetriesRequests(b.bkt)
+}
+
+func newOpLimiters(l RateLimit) opLimiters {
+	var ls opLimiters
+	if l.OpsPerSecond > 0 {
+		ls.ops = rate.NewLimiter(rate.Limit(l.OpsPerSecond), int(math.Max(1, math.Ceil(l.OpsPerSecond))))
+	}
+	if l.BytesPerSecond > 0 {
+		ls.bytes = newBytesLimiter(l.BytesPerSecond)
+	}
+	return ls
+}
+
+func newBytesLimiter(bytesPerSecond int64) *rate.Limiter {
+	// Burst of one second worth of bytes, reads and writes are split to not exceed it.
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+func (b *RateLimitedBucket) waitOp(ctx context.Context, op string) error {
+	l := b.limiters[op].ops
+	if l == nil {
+		return nil
+	}
+	start := time.Now()
+	defer func() { b.waitTime.WithLabelValues(op).Add(time.Since(start).Seconds()) }()
+	return errors.Wrapf(l.Wait(ctx), "rate limit %s", op)
+}
+
+func (b *RateLimitedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	if err := b.waitOp(ctx, iterOp); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (b *RateLimitedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.waitOp(ctx, getOp); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b.limitReadCloser(ctx, getOp, rc), nil
+}
+
+func (b *RateLimitedBucket) GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error) {
+	if err := b.waitOp(ctx, getOp); err != nil {
+		return nil, "", err
+	}
+	rc, newVersion, err := GetIfChanged(ctx, b.bkt, name, version)
+	if err != nil || rc == nil {
+		return nil, newVersion, err
+	}
+	return b.limitReadCloser(ctx, getOp, rc), newVersion, nil
+}
+
+func (b *RateLimitedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.waitOp(ctx, getRangeOp); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return b.limitReadCloser(ctx, getRangeOp, rc), nil
+}
+
+func (b *RateLimitedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.waitOp(ctx, existsOp); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *RateLimitedBucket) ObjectSize(ctx context.Context, name string) (uint64, error) {
+	if err := b.waitOp(ctx, sizeOp); err != nil {
+		return 0, err
+	}
+	return b.bkt.ObjectSize(ctx, name)
+}
+
+func (b *RateLimitedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	if err := b.waitOp(ctx, attrsOp); err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *RateLimitedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.waitOp(ctx, uploadOp); err != nil {
+		return err
+	}
+	if l := b.limiters[uploadOp].bytes; l != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: l, op: uploadOp, waitTime: b.waitTime}
+	}
+	return b.bkt.Upload(ctx, name, r)
+}
+
+func (b *RateLimitedBucket) Delete(ctx context.Context, name string) error {
+	if err := b.waitOp(ctx, deleteOp); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *RateLimitedBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *RateLimitedBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RateLimitedBucket) Name() string {
+	return b.bkt.Name()
+}
+
+func (b *RateLimitedBucket) limitReadCloser(ctx context.Context, op string, rc io.ReadCloser) io.ReadCloser {
+	var r io.Reader = rc
+	if l := b.limiters[op].bytes; l != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: l, op: op, waitTime: b.waitTime}
+	}
+	if b.readBytes != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: b.readBytes, op: op, waitTime: b.waitTime}
+	}
+	if r == io.Reader(rc) {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: r,
+		Closer: rc,
+	}
+}
+
+// rateLimitedReader throttles reads from the underlying reader to the rate of the given limiter.
+type rateLimitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiter  *rate.Limiter
+	op       string
+	waitTime *prometheus.CounterVec
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// Never read more than the limiter allows at once, otherwise WaitN would fail.
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	start := time.Now()
+	werr := r.limiter.WaitN(r.ctx, n)
+	r.waitTime.WithLabelValues(r.op).Add(time.Since(start).Seconds())
+	if werr != nil {
+		return n, errors.Wrapf(werr, "rate limit %s", r.op)
+	}
+	return n, err
+}
+
+// upstream returns the wrapped reader, so upfront size can be still guessed.
+func (r *rateLimitedReader) upstream() io.Reader {
+	return r.r
+}
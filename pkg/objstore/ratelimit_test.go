@@ -0,0 +1,88 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRateLimitConfig_Validate(t *testing.T) {
+	testutil.Ok(t, RateLimitConfig{}.Validate())
+	testutil.Ok(t, RateLimitConfig{
+		Default:    RateLimit{OpsPerSecond: 10},
+		Operations: map[string]RateLimit{getRangeOp: {BytesPerSecond: 1024}},
+	}.Validate())
+	testutil.NotOk(t, RateLimitConfig{Default: RateLimit{OpsPerSecond: -1}}.Validate())
+	testutil.NotOk(t, RateLimitConfig{ReadBytesPerSecond: -1}.Validate())
+	testutil.NotOk(t, RateLimitConfig{Operations: map[string]RateLimit{"list": {OpsPerSecond: 1}}}.Validate())
+}
+
+func TestRateLimitedBucket(t *testing.T) {
+	bkt, err := NewRateLimitedBucket("test", NewInMemBucket(), RateLimitConfig{Default: RateLimit{OpsPerSecond: 1000}}, nil)
+	testutil.Ok(t, err)
+	AcceptanceTest(t, bkt)
+
+	t.Run("bytes are throttled", func(t *testing.T) {
+		bkt, err := NewRateLimitedBucket("test", NewInMemBucket(), RateLimitConfig{
+			Operations: map[string]RateLimit{getOp: {BytesPerSecond: 100}},
+		}, nil)
+		testutil.Ok(t, err)
+
+		ctx := context.Background()
+		testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(make([]byte, 200))))
+
+		start := time.Now()
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, 200, len(b))
+		// First 100 bytes are within burst, the rest has to wait for around a second.
+		testutil.Assert(t, time.Since(start) > 500*time.Millisecond, "expected get to be throttled")
+	})
+
+	t.Run("read bytes are throttled across get and get_range", func(t *testing.T) {
+		bkt, err := NewRateLimitedBucket("test", NewInMemBucket(), RateLimitConfig{ReadBytesPerSecond: 100}, nil)
+		testutil.Ok(t, err)
+
+		ctx := context.Background()
+		testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(make([]byte, 100))))
+
+		start := time.Now()
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, 100, len(b))
+
+		rc, err = bkt.GetRange(ctx, "obj", 0, 100)
+		testutil.Ok(t, err)
+		b, err = ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, 100, len(b))
+		// Get uses up the burst, so get_range has to wait for around a second.
+		testutil.Assert(t, time.Since(start) > 500*time.Millisecond, "expected get_range to be throttled")
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		bkt, err := NewRateLimitedBucket("test", NewInMemBucket(), RateLimitConfig{Default: RateLimit{OpsPerSecond: 0.001}}, nil)
+		testutil.Ok(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+		_, err = bkt.Exists(ctx, "obj")
+		testutil.NotOk(t, err)
+	})
+}
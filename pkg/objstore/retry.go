@@ -0,0 +1,323 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+// RetryConfig configures retries of failed operations against a bucket.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries of a single operation. 0 disables retries.
+	MaxRetries int            `yaml:"max_retries"`
+	MinBackoff model.Duration `yaml:"min_backoff"`
+	MaxBackoff model.Duration `yaml:"max_backoff"`
+}
+
+// DefaultRetryConfig is the retry configuration of buckets which do not specify one. Its backoff is also used to fill
+// backoff of RetryConfig when not specified.
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries: 3,
+	MinBackoff: model.Duration(100 * time.Millisecond),
+	MaxBackoff: model.Duration(10 * time.Second),
+}
+
+// Validate returns error if configuration is invalid.
+func (c RetryConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return errors.New("max_retries cannot be negative")
+	}
+	if c.MinBackoff < 0 || c.MaxBackoff < 0 {
+		return errors.New("backoff cannot be negative")
+	}
+	if c.MaxBackoff != 0 && c.MinBackoff > c.MaxBackoff {
+		return errors.New("min_backoff cannot be greater than max_backoff")
+	}
+	return nil
+}
+
+// RetryableErrClassifier is implemented by buckets that are able to tell if an error returned by the provider
+// is transient (e.g throttling, server errors) and the operation is worth retrying, or terminal (e.g access denied).
+type RetryableErrClassifier interface {
+	IsRetryableErr(err error) bool
+}
+
+// RetryingClient is implemented by buckets whose client retries failed requests itself and can't be configured not
+// to. They are not wrapped in a RetryBucket, so that retries are not multiplied.
+type RetryingClient interface {
+	RetriesRequests() bool
+}
+
+// RetriesRequests returns true if the client of the given bucket retries failed requests itself.
+func RetriesRequests(bkt Bucket) bool {
+	c, ok := bkt.(RetryingClient)
+	return ok && c.RetriesRequests()
+}
+
+// IsRetryableErr returns true if err looks like a transient network error. It is used for buckets
+// that do not implement RetryableErrClassifier and as a fallback for those that do.
+func IsRetryableErr(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	// Some clients flatten transport errors into strings.
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// RetryBucket is a Bucket that retries failed operations with exponential backoff and jitter.
+// Only errors classified as retryable are retried, not found errors and canceled contexts are never retried.
+//
+// Get and GetRange are retried only until the reader is obtained, Upload only if the given reader implements io.Seeker
+// and Iter only if no entry was passed to the callback yet.
+type RetryBucket struct {
+	logger log.Logger
+	bkt    Bucket
+	conf   RetryConfig
+
+	isRetryable func(error) bool
+	retries     *prometheus.CounterVec
+}
+
+// NewRetryBucket returns a new RetryBucket wrapping the given bucket.
+func NewRetryBucket(logger log.Logger, bkt Bucket, conf RetryConfig, reg prometheus.Registerer) (*RetryBucket, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate retry config")
+	}
+	if conf.MinBackoff == 0 {
+		conf.MinBackoff = DefaultRetryConfig.MinBackoff
+	}
+	if conf.MaxBackoff == 0 {
+		conf.MaxBackoff = DefaultRetryConfig.MaxBackoff
+	}
+
+	b := &RetryBucket{
+		logger:      logger,
+		bkt:         bkt,
+		conf:        conf,
+		isRetryable: IsRetryableErr,
+		retries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_operation_retries_total",
+			Help:        "Total number of retried operations against a bucket.",
+			ConstLabels: prometheus.Labels{"bucket": bkt.Name()},
+		}, []string{"operation"}),
+	}
+	if c, ok := bkt.(RetryableErrClassifier); ok {
+		b.isRetryable = func(err error) bool { return c.IsRetryableErr(err) || IsRetryableErr(err) }
+	}
+	for _, op := range allOps {
+		b.retries.WithLabelValues(op)
+	}
+	return b, nil
+}
+
+// backoff returns time to wait before the given retry attempt, starting from 0.
+func (b *RetryBucket) backoff(attempt int) time.Duration {
+	d := time.Duration(b.conf.MinBackoff)
+	for i := 0; i < attempt && d < time.Duration(b.conf.MaxBackoff); i++ {
+		d *= 2
+	}
+	if d > time.Duration(b.conf.MaxBackoff) {
+		d = time.Duration(b.conf.MaxBackoff)
+	}
+	// Jitter the backoff to [d/2, d) to not synchronize retries of concurrent callers.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// do runs f until it succeeds, returns a terminal error or retries are exhausted.
+func (b *RetryBucket) do(ctx context.Context, op, name string, f func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		if _, ok := err.(terminalErr); ok {
+			return err
+		}
+		if attempt >= b.conf.MaxRetries || b.bkt.IsObjNotFoundErr(err) || !b.isRetryable(err) {
+			return err
+		}
+
+		backoff := b.backoff(attempt)
+		level.Debug(b.logger).Log("msg", "retrying bucket operation", "operation", op, "name", name, "attempt", attempt+1, "backoff", backoff, "err", err)
+		b.retries.WithLabelValues(op).Inc()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// iterCallbackErr marks errors returned by the Iter callback, which are never retried.
+type iterCallbackErr struct{ error }
+
+func (b *RetryBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	called := false
+	if attrsFn := ApplyIterOptions(options...).AttributesFunc; attrsFn != nil {
+		options = append(options[:len(options):len(options)], WithObjectAttributes(func(name string, attrs ObjectAttributes) error {
+			called = true
+			if err := attrsFn(name, attrs); err != nil {
+				return iterCallbackErr{err}
+			}
+			return nil
+		}))
+	}
+
+	err := b.do(ctx, iterOp, dir, func() error {
+		err := b.bkt.Iter(ctx, dir, func(name string) error {
+			called = true
+			if err := f(name); err != nil {
+				return iterCallbackErr{err}
+			}
+			return nil
+		}, options...)
+		if err == nil {
+			return nil
+		}
+		if _, ok := errors.Cause(err).(iterCallbackErr); ok || called {
+			// Retrying now would call f again with the same entries.
+			return terminalErr{err}
+		}
+		return err
+	})
+	return unwrapRetryErr(err)
+}
+
+// terminalErr marks errors that must not be retried regardless of their cause.
+type terminalErr struct{ error }
+
+func unwrapRetryErr(err error) error {
+	if t, ok := err.(terminalErr); ok {
+		err = t.error
+	}
+	if c, ok := errors.Cause(err).(iterCallbackErr); ok {
+		return c.error
+	}
+	return err
+}
+
+func (b *RetryBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, getOp, name, func() error {
+		rc, err = b.bkt.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+func (b *RetryBucket) GetIfChanged(ctx context.Context, name, version string) (rc io.ReadCloser, newVersion string, err error) {
+	err = b.do(ctx, getOp, name, func() error {
+		rc, newVersion, err = GetIfChanged(ctx, b.bkt, name, version)
+		return err
+	})
+	return rc, newVersion, err
+}
+
+func (b *RetryBucket) GetRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.do(ctx, getRangeOp, name, func() error {
+		rc, err = b.bkt.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+func (b *RetryBucket) Exists(ctx context.Context, name string) (ok bool, err error) {
+	err = b.do(ctx, existsOp, name, func() error {
+		ok, err = b.bkt.Exists(ctx, name)
+		return err
+	})
+	return ok, err
+}
+
+func (b *RetryBucket) ObjectSize(ctx context.Context, name string) (size uint64, err error) {
+	err = b.do(ctx, sizeOp, name, func() error {
+		size, err = b.bkt.ObjectSize(ctx, name)
+		return err
+	})
+	return size, err
+}
+
+func (b *RetryBucket) Attributes(ctx context.Context, name string) (attrs ObjectAttributes, err error) {
+	err = b.do(ctx, attrsOp, name, func() error {
+		attrs, err = b.bkt.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+func (b *RetryBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	s, ok := seekerOf(r)
+	if !ok {
+		// Reader can't be rewound, so the upload can't be retried.
+		return b.bkt.Upload(ctx, name, r)
+	}
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.bkt.Upload(ctx, name, r)
+	}
+
+	first := true
+	return unwrapRetryErr(b.do(ctx, uploadOp, name, func() error {
+		if !first {
+			if _, err := s.Seek(start, io.SeekStart); err != nil {
+				return terminalErr{errors.Wrap(err, "rewind reader")}
+			}
+		}
+		first = false
+		return b.bkt.Upload(ctx, name, r)
+	}))
+}
+
+// seekerOf returns the given reader or the reader it wraps if it implements io.Seeker. Wrapping readers
+// implementing upstreamReader pass the content through unchanged, so rewinding the upstream rewinds them too.
+func seekerOf(r io.Reader) (io.Seeker, bool) {
+	for {
+		if s, ok := r.(io.Seeker); ok {
+			return s, true
+		}
+		u, ok := r.(upstreamReader)
+		if !ok {
+			return nil, false
+		}
+		r = u.upstream()
+	}
+}
+
+func (b *RetryBucket) Delete(ctx context.Context, name string) error {
+	return b.do(ctx, deleteOp, name, func() error {
+		return b.bkt.Delete(ctx, name)
+	})
+}
+
+func (b *RetryBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+func (b *RetryBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RetryBucket) Name() string {
+	return b.bkt.Name()
+}
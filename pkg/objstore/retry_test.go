@@ -0,0 +1,162 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+var errAccessDenied = errors.New("access denied")
+
+// flakyBucket fails the first failures calls of each operation with the given error.
+type flakyBucket struct {
+	Bucket
+
+	err      error
+	failures int
+	calls    map[string]int
+}
+
+func (b *flakyBucket) fail(op string) error {
+	b.calls[op]++
+	if b.calls[op] <= b.failures {
+		return b.err
+	}
+	return nil
+}
+
+func (b *flakyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail(getOp); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *flakyBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.fail(uploadOp); err != nil {
+		// Consume part of the reader to make sure it is rewound before retry.
+		_, _ = io.CopyN(ioutil.Discard, r, 1)
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func (b *flakyBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	if err := b.fail(iterOp); err != nil {
+		return err
+	}
+	return b.Bucket.Iter(ctx, dir, f, options...)
+}
+
+func (b *flakyBucket) IsRetryableErr(err error) bool {
+	return errors.Cause(err) != errAccessDenied
+}
+
+func TestRetryBucket(t *testing.T) {
+	ctx := context.Background()
+	conf := RetryConfig{MaxRetries: 3, MinBackoff: model.Duration(time.Millisecond), MaxBackoff: model.Duration(10 * time.Millisecond)}
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), err: syscall.ECONNRESET, failures: 2, calls: map[string]int{}}
+		bkt, err := NewRetryBucket(log.NewNopLogger(), flaky, conf, nil)
+		testutil.Ok(t, err)
+
+		testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("content")))
+		rc, err := bkt.Get(ctx, "dir/obj")
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, "content", string(b))
+
+		var names []string
+		testutil.Ok(t, bkt.Iter(ctx, "dir/", func(name string) error {
+			names = append(names, name)
+			return nil
+		}))
+		testutil.Equals(t, []string{"dir/obj"}, names)
+
+		testutil.Equals(t, 3, flaky.calls[uploadOp])
+		testutil.Equals(t, 3, flaky.calls[getOp])
+		testutil.Equals(t, 3, flaky.calls[iterOp])
+		testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.retries.WithLabelValues(uploadOp)))
+	})
+
+	t.Run("retries are exhausted", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), err: syscall.ECONNRESET, failures: 10, calls: map[string]int{}}
+		bkt, err := NewRetryBucket(log.NewNopLogger(), flaky, conf, nil)
+		testutil.Ok(t, err)
+
+		_, err = bkt.Get(ctx, "obj")
+		testutil.NotOk(t, err)
+		testutil.Equals(t, 4, flaky.calls[getOp])
+	})
+
+	t.Run("terminal errors are not retried", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), err: errAccessDenied, failures: 1, calls: map[string]int{}}
+		bkt, err := NewRetryBucket(log.NewNopLogger(), flaky, conf, nil)
+		testutil.Ok(t, err)
+
+		testutil.NotOk(t, bkt.Upload(ctx, "obj", bytes.NewReader([]byte("content"))))
+		testutil.Equals(t, 1, flaky.calls[uploadOp])
+	})
+
+	t.Run("not found errors are not retried", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), calls: map[string]int{}}
+		bkt, err := NewRetryBucket(log.NewNopLogger(), flaky, conf, nil)
+		testutil.Ok(t, err)
+
+		_, err = bkt.Get(ctx, "obj")
+		testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error")
+		testutil.Equals(t, 1, flaky.calls[getOp])
+	})
+
+	t.Run("callback errors are not retried", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), calls: map[string]int{}}
+		bkt, err := NewRetryBucket(log.NewNopLogger(), flaky, conf, nil)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("content")))
+
+		cbErr := syscall.ECONNRESET
+		testutil.Equals(t, cbErr, bkt.Iter(ctx, "dir/", func(string) error { return cbErr }))
+		testutil.Equals(t, 1, flaky.calls[iterOp])
+	})
+	t.Run("rate limited attempts", func(t *testing.T) {
+		flaky := &flakyBucket{Bucket: NewInMemBucket(), err: errAccessDenied, failures: 1, calls: map[string]int{}}
+		rl, err := NewRateLimitedBucket("test", flaky, RateLimitConfig{Default: RateLimit{OpsPerSecond: 1000}}, nil)
+		testutil.Ok(t, err)
+		bkt, err := NewRetryBucket(log.NewNopLogger(), rl, conf, nil)
+		testutil.Ok(t, err)
+
+		// Errors are classified by the rate limited bucket.
+		testutil.NotOk(t, bkt.Upload(ctx, "obj", bytes.NewReader([]byte("content"))))
+		testutil.Equals(t, 1, flaky.calls[uploadOp])
+
+		flaky.err, flaky.failures = syscall.ECONNRESET, 2
+		testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+		testutil.Equals(t, 3, flaky.calls[iterOp])
+	})
+}
+
+func TestRetryConfig_Validate(t *testing.T) {
+	testutil.Ok(t, RetryConfig{}.Validate())
+	testutil.Ok(t, DefaultRetryConfig.Validate())
+	testutil.NotOk(t, RetryConfig{MaxRetries: -1}.Validate())
+	testutil.NotOk(t, RetryConfig{MinBackoff: model.Duration(-time.Second)}.Validate())
+	testutil.NotOk(t, RetryConfig{MaxBackoff: model.Duration(-time.Second)}.Validate())
+	testutil.NotOk(t, RetryConfig{MinBackoff: model.Duration(time.Second), MaxBackoff: model.Duration(time.Millisecond)}.Validate())
+}
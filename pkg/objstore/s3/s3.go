@@ -43,6 +43,9 @@ var DefaultConfig = Config{
 	// Minimum file size after which an HTTP multipart request should be used to upload objects to storage.
 	// Set to 128 MiB as in the minio client.
 	PartSize: 1024 * 1024 * 128,
+	STSConfig: STSConfig{
+		Duration: model.Duration(1 * time.Hour),
+	},
 }
 
 // Config stores the configuration for s3 bucket.
@@ -59,7 +62,8 @@ type Config struct {
 	HTTPConfig      HTTPConfig        `yaml:"http_config"`
 	TraceConfig     TraceConfig       `yaml:"trace"`
 	// PartSize used for multipart upload. Only used if uploaded object size is known and larger than configured PartSize.
-	PartSize uint64 `yaml:"part_size"`
+	PartSize  uint64    `yaml:"part_size"`
+	STSConfig STSConfig `yaml:"sts"`
 }
 
 type TraceConfig struct {
@@ -124,6 +128,8 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 				SignerType:      signature,
 			},
 		}}
+	} else if config.STSConfig.WebIdentityTokenFile != "" {
+		chain = []credentials.Provider{newWebIdentityProvider(logger, config.STSConfig, config.Region, component)}
 	} else {
 		chain = []credentials.Provider{
 			&credentials.EnvAWS{},
@@ -136,6 +142,13 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 		}
 	}
 
+	// Assume role on top of the credentials found above.
+	if config.STSConfig.RoleARN != "" && config.STSConfig.WebIdentityTokenFile == "" {
+		chain = []credentials.Provider{
+			newAssumeRoleProvider(logger, config.STSConfig, config.Region, component, credentials.NewChainCredentials(chain)),
+		}
+	}
+
 	client, err := minio.NewWithCredentials(config.Endpoint, credentials.NewChainCredentials(chain), !config.Insecure, config.Region)
 	if err != nil {
 		return nil, errors.Wrap(err, "initialize s3 client")
@@ -206,7 +219,11 @@ func validate(conf Config) error {
 	if conf.AccessKey != "" && conf.SecretKey == "" {
 		return errors.New("no s3 secret_key specified while access_key is present in config file; either both should be present in config or envvars/IAM should be used.")
 	}
-	return nil
+
+	if conf.AccessKey != "" && conf.STSConfig.WebIdentityTokenFile != "" {
+		return errors.New("s3 access_key and sts.web_identity_token_file cannot be used together")
+	}
+	return conf.STSConfig.validate()
 }
 
 // ValidateForTests checks to see the config options for tests are set.
@@ -221,14 +238,16 @@ func ValidateForTests(conf Config) error {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
 
-	for object := range b.client.ListObjects(b.name, dir, false, ctx.Done()) {
+	for object := range b.client.ListObjects(b.name, dir, params.Recursive, ctx.Done()) {
 		// Catch the error when failed to list objects.
 		if object.Err != nil {
 			return object.Err
@@ -241,6 +260,12 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if object.Key == dir {
 			continue
 		}
+		// Directories are listed as common prefixes without attributes.
+		if params.AttributesFunc != nil && !strings.HasSuffix(object.Key, DirDelim) {
+			if err := params.AttributesFunc(object.Key, objstore.ObjectAttributes{Size: object.Size, LastModified: object.LastModified}); err != nil {
+				return err
+			}
+		}
 		if err := f(object.Key); err != nil {
 			return err
 		}
@@ -282,6 +307,34 @@ func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	return b.getRange(ctx, name, 0, -1)
 }
 
+// GetIfChanged returns a reader for the given object name if its ETag differs from the given one.
+func (b *Bucket) GetIfChanged(ctx context.Context, name, objVersion string) (io.ReadCloser, string, error) {
+	objInfo, err := b.client.StatObject(b.name, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	if objInfo.ETag == objVersion {
+		return nil, objInfo.ETag, nil
+	}
+
+	// Read exactly the object we got the ETag of, the request fails if it was overwritten in the meantime.
+	opts := &minio.GetObjectOptions{ServerSideEncryption: b.sse}
+	if err := opts.SetMatchETag(objInfo.ETag); err != nil {
+		return nil, "", err
+	}
+	r, err := b.client.GetObjectWithContext(ctx, b.name, name, *opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// NotFoundObject error is revealed only after first Read. This does the initial GetRequest.
+	if _, err := r.Read(nil); err != nil {
+		runutil.CloseWithLogOnErr(b.logger, r, "s3 get if changed obj close")
+		return nil, "", err
+	}
+	return r, objInfo.ETag, nil
+}
+
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	return b.getRange(ctx, name, off, length)
@@ -341,6 +394,15 @@ func (b *Bucket) ObjectSize(_ context.Context, name string) (uint64, error) {
 	return uint64(objInfo.Size), nil
 }
 
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
+	objInfo, err := b.client.StatObject(b.name, name, minio.StatObjectOptions{})
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{Size: objInfo.Size, LastModified: objInfo.LastModified}, nil
+}
+
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(_ context.Context, name string) error {
 	return b.client.RemoveObject(b.name, name)
@@ -351,6 +413,10 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	return minio.ToErrorResponse(err).Code == "NoSuchKey"
 }
 
+// RetriesRequests implements objstore.RetryingClient. The minio client retries failed requests itself, up to
+// minio.MaxRetry times, which can't be configured per client.
+func (b *Bucket) RetriesRequests() bool { return true }
+
 func (b *Bucket) Close() error { return nil }
 
 func configFromEnv() Config {
@@ -0,0 +1,242 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/signer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	defaultSTSEndpoint = "https://sts.amazonaws.com"
+	defaultSTSRegion   = "us-east-1"
+	stsAPIVersion      = "2011-06-15"
+)
+
+// STSConfig configures temporary credentials obtained by assuming a role through AWS Security Token Service.
+type STSConfig struct {
+	// RoleARN is the role to assume. With WebIdentityTokenFile it is assumed by AssumeRoleWithWebIdentity,
+	// otherwise by AssumeRole signed with the credentials found in the usual way.
+	RoleARN string `yaml:"role_arn"`
+	// ExternalID is passed to AssumeRole. It is not used for web identities.
+	ExternalID  string `yaml:"external_id"`
+	SessionName string `yaml:"session_name"`
+	// WebIdentityTokenFile is a path to an OIDC token, e.g. a Kubernetes projected service account token.
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+	// Endpoint defaults to the regional STS endpoint if region is set or to the global one otherwise.
+	Endpoint string         `yaml:"endpoint"`
+	Duration model.Duration `yaml:"duration"`
+}
+
+func (c STSConfig) validate() error {
+	if c.WebIdentityTokenFile != "" && c.RoleARN == "" {
+		return errors.New("s3 sts.role_arn has to be specified when sts.web_identity_token_file is set")
+	}
+	if c.ExternalID != "" && c.RoleARN == "" {
+		return errors.New("s3 sts.role_arn has to be specified when sts.external_id is set")
+	}
+	if c.ExternalID != "" && c.WebIdentityTokenFile != "" {
+		return errors.New("s3 sts.external_id cannot be used together with sts.web_identity_token_file")
+	}
+	if c.Duration < 0 {
+		return errors.New("s3 sts.duration cannot be negative")
+	}
+	return nil
+}
+
+// stsClient sends requests to the AWS STS API.
+type stsClient struct {
+	logger   log.Logger
+	client   *http.Client
+	endpoint string
+	region   string
+}
+
+func newSTSClient(logger log.Logger, conf STSConfig, region string) stsClient {
+	if region == "" {
+		region = defaultSTSRegion
+	}
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = defaultSTSEndpoint
+		if region != defaultSTSRegion {
+			endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+		}
+	}
+	return stsClient{
+		logger:   logger,
+		client:   &http.Client{Transport: http.DefaultTransport, Timeout: 1 * time.Minute},
+		endpoint: endpoint,
+		region:   region,
+	}
+}
+
+// do sends the given STS action and decodes the response into res. The request is signed with the given credentials
+// unless they are nil.
+func (c stsClient) do(params url.Values, creds *credentials.Value, res interface{}) error {
+	action := params.Get("Action")
+	params.Set("Version", stsAPIVersion)
+	body := params.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if creds != nil {
+		sum := sha256.Sum256([]byte(body))
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+		// The session token of temporary credentials is signed along with the request.
+		if creds.SessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		}
+		req = signer.SignV4STS(*req, creds.AccessKeyID, creds.SecretAccessKey, c.region)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s request", action)
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(c.logger, resp.Body, "sts response")
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("%s request failed with status %s: %s", action, resp.Status, string(b))
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(res); err != nil {
+		return errors.Wrapf(err, "decode %s response", action)
+	}
+	return nil
+}
+
+func sessionName(conf STSConfig, component string) string {
+	if conf.SessionName != "" {
+		return conf.SessionName
+	}
+	return fmt.Sprintf("thanos-%s-%d", component, time.Now().UnixNano())
+}
+
+func durationSeconds(conf STSConfig) string {
+	if conf.Duration <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(time.Duration(conf.Duration).Seconds()))
+}
+
+// assumeRoleProvider is a credentials.Provider that assumes a role with AWS STS AssumeRole. The request is signed with
+// credentials taken from another provider on every refresh, so that the source credentials can rotate as well.
+// Temporary source credentials are supported, their session token is sent along.
+type assumeRoleProvider struct {
+	credentials.Expiry
+
+	sts         stsClient
+	conf        STSConfig
+	sessionName string
+	source      *credentials.Credentials
+}
+
+func newAssumeRoleProvider(logger log.Logger, conf STSConfig, region, component string, source *credentials.Credentials) *assumeRoleProvider {
+	return &assumeRoleProvider{
+		sts:         newSTSClient(logger, conf, region),
+		conf:        conf,
+		sessionName: sessionName(conf, component),
+		source:      source,
+	}
+}
+
+// Retrieve implements credentials.Provider.
+func (p *assumeRoleProvider) Retrieve() (credentials.Value, error) {
+	src, err := p.source.Get()
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "get source credentials to assume role")
+	}
+
+	params := url.Values{}
+	params.Set("Action", "AssumeRole")
+	params.Set("RoleArn", p.conf.RoleARN)
+	params.Set("RoleSessionName", p.sessionName)
+	if d := durationSeconds(p.conf); d != "" {
+		params.Set("DurationSeconds", d)
+	}
+	if p.conf.ExternalID != "" {
+		params.Set("ExternalId", p.conf.ExternalID)
+	}
+
+	var res credentials.AssumeRoleResponse
+	if err := p.sts.do(params, &src, &res); err != nil {
+		return credentials.Value{}, errors.Wrap(err, "assume role")
+	}
+	c := res.Result.Credentials
+	p.SetExpiration(c.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     c.AccessKey,
+		SecretAccessKey: c.SecretKey,
+		SessionToken:    c.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// webIdentityProvider is a credentials.Provider that assumes a role with AWS STS AssumeRoleWithWebIdentity. The token
+// file is read on every refresh, so that rotated tokens are picked up.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	sts         stsClient
+	conf        STSConfig
+	sessionName string
+}
+
+func newWebIdentityProvider(logger log.Logger, conf STSConfig, region, component string) *webIdentityProvider {
+	return &webIdentityProvider{
+		sts:         newSTSClient(logger, conf, region),
+		conf:        conf,
+		sessionName: sessionName(conf, component),
+	}
+}
+
+// Retrieve implements credentials.Provider.
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.conf.WebIdentityTokenFile)
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "read web identity token")
+	}
+
+	params := url.Values{}
+	params.Set("Action", "AssumeRoleWithWebIdentity")
+	params.Set("RoleArn", p.conf.RoleARN)
+	params.Set("RoleSessionName", p.sessionName)
+	params.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	if d := durationSeconds(p.conf); d != "" {
+		params.Set("DurationSeconds", d)
+	}
+
+	// AssumeRoleWithWebIdentity is authenticated by the token, not signed.
+	var res credentials.AssumeRoleWithWebIdentityResponse
+	if err := p.sts.do(params, nil, &res); err != nil {
+		return credentials.Value{}, errors.Wrap(err, "assume role with web identity")
+	}
+	c := res.Result.Credentials
+	p.SetExpiration(c.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     c.AccessKey,
+		SecretAccessKey: c.SecretKey,
+		SessionToken:    c.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
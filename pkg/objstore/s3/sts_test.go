@@ -0,0 +1,227 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestAssumeRoleProvider(t *testing.T) {
+	var (
+		lastReq  *http.Request
+		lastForm map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lastReq = r
+		lastForm = map[string]string{}
+		for k := range r.PostForm {
+			lastForm[k] = r.PostForm.Get(k)
+		}
+		if r.PostForm.Get("RoleArn") == "arn:aws:iam::123:role/denied" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>
+  <AccessKeyId>AKID</AccessKeyId>
+  <SecretAccessKey>SECRET</SecretAccessKey>
+  <SessionToken>TOKEN</SessionToken>
+  <Expiration>%s</Expiration>
+</Credentials></AssumeRoleResult></AssumeRoleResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	t.Run("assume role", func(t *testing.T) {
+		p := newAssumeRoleProvider(log.NewNopLogger(), STSConfig{
+			RoleARN:  "arn:aws:iam::123:role/thanos",
+			Endpoint: srv.URL,
+			Duration: model.Duration(2 * time.Hour),
+		}, "eu-west-1", "store", credentials.NewStaticV4("source-key", "source-secret", ""))
+
+		testutil.Assert(t, p.IsExpired(), "provider should be expired before first retrieval")
+		v, err := p.Retrieve()
+		testutil.Ok(t, err)
+		testutil.Equals(t, credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN", SignerType: credentials.SignatureV4}, v)
+		testutil.Assert(t, !p.IsExpired(), "provider should not be expired after retrieval")
+
+		testutil.Equals(t, "AssumeRole", lastForm["Action"])
+		testutil.Equals(t, "arn:aws:iam::123:role/thanos", lastForm["RoleArn"])
+		testutil.Equals(t, "7200", lastForm["DurationSeconds"])
+		testutil.Assert(t, strings.HasPrefix(lastForm["RoleSessionName"], "thanos-store-"), "unexpected session name %s", lastForm["RoleSessionName"])
+		auth := lastReq.Header.Get("Authorization")
+		testutil.Assert(t, strings.Contains(auth, "Credential=source-key/") && strings.Contains(auth, "/eu-west-1/sts/"), "unexpected authorization header %s", auth)
+	})
+
+	t.Run("temporary source credentials", func(t *testing.T) {
+		p := newAssumeRoleProvider(log.NewNopLogger(), STSConfig{
+			RoleARN:  "arn:aws:iam::123:role/thanos",
+			Endpoint: srv.URL,
+		}, "", "store", credentials.NewStaticV4("source-key", "source-secret", "source-token"))
+
+		v, err := p.Retrieve()
+		testutil.Ok(t, err)
+		testutil.Equals(t, "AKID", v.AccessKeyID)
+
+		testutil.Equals(t, "source-token", lastReq.Header.Get("X-Amz-Security-Token"))
+		auth := lastReq.Header.Get("Authorization")
+		testutil.Assert(t, strings.Contains(auth, "x-amz-security-token"), "session token should be signed: %s", auth)
+		_, ok := lastForm["ExternalId"]
+		testutil.Assert(t, !ok, "external ID should not be sent if not configured")
+	})
+
+	t.Run("external ID", func(t *testing.T) {
+		p := newAssumeRoleProvider(log.NewNopLogger(), STSConfig{
+			RoleARN:    "arn:aws:iam::123:role/thanos",
+			ExternalID: "external",
+			Endpoint:   srv.URL,
+		}, "", "store", credentials.NewStaticV4("source-key", "source-secret", ""))
+
+		_, err := p.Retrieve()
+		testutil.Ok(t, err)
+		testutil.Equals(t, "external", lastForm["ExternalId"])
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		p := newAssumeRoleProvider(log.NewNopLogger(), STSConfig{
+			RoleARN:     "arn:aws:iam::123:role/denied",
+			SessionName: "session",
+			Endpoint:    srv.URL,
+		}, "", "store", credentials.NewStaticV4("source-key", "source-secret", ""))
+
+		_, err := p.Retrieve()
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "session", lastForm["RoleSessionName"])
+		testutil.Assert(t, p.IsExpired(), "provider should stay expired after failed retrieval")
+	})
+}
+
+func TestWebIdentityProvider(t *testing.T) {
+	var (
+		lastReq  *http.Request
+		lastForm map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lastReq = r
+		lastForm = map[string]string{}
+		for k := range r.PostForm {
+			lastForm[k] = r.PostForm.Get(k)
+		}
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult><Credentials>
+  <AccessKeyId>AKID</AccessKeyId>
+  <SecretAccessKey>SECRET</SecretAccessKey>
+  <SessionToken>TOKEN</SessionToken>
+  <Expiration>%s</Expiration>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "sts-web-identity")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	tokenFile := filepath.Join(dir, "token")
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("token-1\n"), 0600))
+
+	p := newWebIdentityProvider(log.NewNopLogger(), STSConfig{
+		RoleARN:              "arn:aws:iam::123:role/thanos",
+		WebIdentityTokenFile: tokenFile,
+		Endpoint:             srv.URL,
+	}, "eu-west-1", "sidecar")
+
+	v, err := p.Retrieve()
+	testutil.Ok(t, err)
+	testutil.Equals(t, credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN", SignerType: credentials.SignatureV4}, v)
+	testutil.Assert(t, !p.IsExpired(), "provider should not be expired after retrieval")
+
+	testutil.Equals(t, "AssumeRoleWithWebIdentity", lastForm["Action"])
+	testutil.Equals(t, "arn:aws:iam::123:role/thanos", lastForm["RoleArn"])
+	testutil.Equals(t, "token-1", lastForm["WebIdentityToken"])
+	testutil.Assert(t, strings.HasPrefix(lastForm["RoleSessionName"], "thanos-sidecar-"), "unexpected session name %s", lastForm["RoleSessionName"])
+	testutil.Equals(t, "", lastReq.Header.Get("Authorization"))
+
+	// Rotated tokens are picked up on the next refresh.
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("token-2"), 0600))
+	_, err = p.Retrieve()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token-2", lastForm["WebIdentityToken"])
+
+	testutil.Ok(t, os.Remove(tokenFile))
+	_, err = p.Retrieve()
+	testutil.NotOk(t, err)
+}
+
+func TestSTSConfig_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{
+			name: "assume role",
+			conf: Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{RoleARN: "arn"}},
+		},
+		{
+			name: "assume role with external ID",
+			conf: Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{RoleARN: "arn", ExternalID: "id"}},
+		},
+		{
+			name: "web identity",
+			conf: Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{RoleARN: "arn", WebIdentityTokenFile: "/token"}},
+		},
+		{
+			name:    "external ID without role",
+			conf:    Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{ExternalID: "id"}},
+			wantErr: true,
+		},
+		{
+			name:    "web identity without role",
+			conf:    Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{WebIdentityTokenFile: "/token"}},
+			wantErr: true,
+		},
+		{
+			name:    "web identity with external ID",
+			conf:    Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{RoleARN: "arn", ExternalID: "id", WebIdentityTokenFile: "/token"}},
+			wantErr: true,
+		},
+		{
+			name:    "web identity with access key",
+			conf:    Config{Bucket: "b", Endpoint: "e", AccessKey: "ak", SecretKey: "sk", STSConfig: STSConfig{RoleARN: "arn", WebIdentityTokenFile: "/token"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			conf:    Config{Bucket: "b", Endpoint: "e", STSConfig: STSConfig{RoleARN: "arn", Duration: model.Duration(-time.Hour)}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validate(tc.conf)
+			if tc.wantErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+		})
+	}
+}
@@ -86,20 +86,35 @@ func (c *Container) Name() string {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (c *Container) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (c *Container) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	params := objstore.ApplyIterOptions(options...)
+
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
 
-	options := &objects.ListOpts{Full: false, Prefix: dir, Delimiter: DirDelim}
-	return objects.List(c.client, c.name, options).EachPage(func(page pagination.Page) (bool, error) {
+	listOpts := &objects.ListOpts{Full: false, Prefix: dir, Delimiter: DirDelim}
+	if params.Recursive {
+		listOpts.Delimiter = ""
+	}
+	return objects.List(c.client, c.name, listOpts).EachPage(func(page pagination.Page) (bool, error) {
 		objectNames, err := objects.ExtractNames(page)
 		if err != nil {
 			return false, err
 		}
 		for _, objectName := range objectNames {
+			// Names-only listing does not contain attributes, so get them for each object.
+			if params.AttributesFunc != nil && !strings.HasSuffix(objectName, DirDelim) {
+				attrs, err := c.Attributes(ctx, objectName)
+				if err != nil {
+					return false, errors.Wrapf(err, "get attributes of %s", objectName)
+				}
+				if err := params.AttributesFunc(objectName, attrs); err != nil {
+					return false, err
+				}
+			}
 			if err := f(objectName); err != nil {
 				return false, err
 			}
@@ -138,6 +153,16 @@ func (c *Container) ObjectSize(ctx context.Context, name string) (uint64, error)
 	return uint64(headers.ContentLength), nil
 }
 
+// Attributes returns information about the specified object.
+func (c *Container) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	response := objects.Get(c.client, c.name, name, nil)
+	headers, err := response.Extract()
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{Size: headers.ContentLength, LastModified: headers.LastModified}, nil
+}
+
 // Exists checks if the given object exists.
 func (c *Container) Exists(ctx context.Context, name string) (bool, error) {
 	err := objects.Get(c.client, c.name, name, nil).Err
@@ -6,6 +6,7 @@ package objstore
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"sort"
@@ -79,6 +80,10 @@ func (b noopInstrumentedBucket) ReaderWithExpectedErrs(IsOpFailureExpectedFunc)
 	return b
 }
 
+func (b noopInstrumentedBucket) GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error) {
+	return GetIfChanged(ctx, b.Bucket, name, version)
+}
+
 func AcceptanceTest(t *testing.T, bkt Bucket) {
 	ctx := context.Background()
 
@@ -98,6 +103,10 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	testutil.NotOk(t, err)
 	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
 
+	_, err = bkt.Attributes(ctx, "id1/obj_1.some")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+
 	// Upload first object.
 	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_1.some", strings.NewReader("@test-data@")))
 
@@ -114,6 +123,11 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	testutil.Ok(t, err)
 	testutil.Assert(t, sz == 11, "expected size to be equal to 11")
 
+	attrs, err := bkt.Attributes(ctx, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(11), attrs.Size)
+	testutil.Assert(t, !attrs.LastModified.IsZero(), "expected last modified time to be set")
+
 	rc2, err := bkt.GetRange(ctx, "id1/obj_1.some", 1, 3)
 	testutil.Ok(t, err)
 	defer func() { testutil.Ok(t, rc2.Close()) }()
@@ -148,6 +162,20 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	testutil.Ok(t, err)
 	testutil.Assert(t, ok, "expected exits")
 
+	// Can we get the object only if it changed?
+	rc, version, err := GetIfChanged(ctx, bkt, "id1/obj_1.some", "")
+	testutil.Ok(t, err)
+	content, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "@test-data@", string(content))
+	if version != "" {
+		rc, newVersion, err := GetIfChanged(ctx, bkt, "id1/obj_1.some", version)
+		testutil.Ok(t, err)
+		testutil.Assert(t, rc == nil, "expected object not to be got as it did not change")
+		testutil.Equals(t, version, newVersion)
+	}
+
 	// Upload other objects.
 	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_2.some", strings.NewReader("@test-data2@")))
 	// Upload should be idempotent.
@@ -191,6 +219,25 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 		return nil
 	}))
 
+	// Can we iter over all items recursively?
+	seen = []string{}
+	testutil.Ok(t, bkt.Iter(ctx, "", func(fn string) error {
+		seen = append(seen, fn)
+		return nil
+	}, WithRecursiveIter))
+	expected = []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some", "id2/obj_4.some", "obj_5.some"}
+	sort.Strings(seen)
+	testutil.Equals(t, expected, seen)
+
+	// Can we get attributes of objects while iterating?
+	sizes := map[string]int64{}
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }, WithObjectAttributes(func(name string, attrs ObjectAttributes) error {
+		testutil.Assert(t, !attrs.LastModified.IsZero(), "expected last modified time of %s", name)
+		sizes[name] = attrs.Size
+		return nil
+	})))
+	testutil.Equals(t, map[string]int64{"obj_5.some": 12}, sizes)
+
 	testutil.Ok(t, bkt.Delete(ctx, "id1/obj_2.some"))
 
 	// Delete is expected to fail on non existing object.
@@ -0,0 +1,171 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// TracingBucket is a Bucket wrapper creating a span for every operation, so that object storage requests show up
+// in traces of requests causing them, e.g. Series calls of the store gateway. Spans are created only if a tracer is
+// propagated in the context. Spans of Get and GetRange are finished when the returned reader is closed.
+type TracingBucket struct {
+	bkt      Bucket
+	provider string
+}
+
+// NewTracingBucket returns a new TracingBucket. Provider is added as a tag to all spans.
+func NewTracingBucket(bkt Bucket, provider string) *TracingBucket {
+	return &TracingBucket{bkt: bkt, provider: provider}
+}
+
+func (t *TracingBucket) startSpan(ctx context.Context, op string, tags opentracing.Tags) (opentracing.Span, context.Context) {
+	span, ctx := tracing.StartSpan(ctx, "bucket_"+op, tags)
+	span.SetTag("objstore.provider", t.provider)
+	span.SetTag("objstore.bucket", t.bkt.Name())
+	return span, ctx
+}
+
+// finishSpan finishes the span marking it as failed if err is not nil. Object not found errors are only tagged,
+// as they are expected e.g. when checking for optional files.
+func (t *TracingBucket) finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		if t.bkt.IsObjNotFoundErr(err) {
+			span.SetTag("objstore.not_found", true)
+		} else {
+			ext.Error.Set(span, true)
+			span.LogKV("err", err.Error())
+		}
+	}
+	span.Finish()
+}
+
+func (t *TracingBucket) Iter(ctx context.Context, dir string, f func(name string) error, options ...IterOption) (err error) {
+	span, ctx := t.startSpan(ctx, iterOp, opentracing.Tags{"objstore.dir": dir})
+	defer func() { t.finishSpan(span, err) }()
+
+	return t.bkt.Iter(ctx, dir, f, options...)
+}
+
+func (t *TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	span, ctx := t.startSpan(ctx, getOp, opentracing.Tags{"objstore.name": name})
+	rc, err := t.bkt.Get(ctx, name)
+	if err != nil {
+		t.finishSpan(span, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, t: t, span: span}, nil
+}
+
+func (t *TracingBucket) GetIfChanged(ctx context.Context, name, version string) (io.ReadCloser, string, error) {
+	span, ctx := t.startSpan(ctx, getOp, opentracing.Tags{"objstore.name": name, "objstore.version": version})
+	rc, newVersion, err := GetIfChanged(ctx, t.bkt, name, version)
+	if err != nil || rc == nil {
+		t.finishSpan(span, err)
+		return nil, newVersion, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, t: t, span: span}, newVersion, nil
+}
+
+func (t *TracingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	span, ctx := t.startSpan(ctx, getRangeOp, opentracing.Tags{"objstore.name": name, "objstore.offset": off, "objstore.length": length})
+	rc, err := t.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		t.finishSpan(span, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, t: t, span: span}, nil
+}
+
+func (t *TracingBucket) Exists(ctx context.Context, name string) (_ bool, err error) {
+	span, ctx := t.startSpan(ctx, existsOp, opentracing.Tags{"objstore.name": name})
+	defer func() { t.finishSpan(span, err) }()
+
+	return t.bkt.Exists(ctx, name)
+}
+
+func (t *TracingBucket) ObjectSize(ctx context.Context, name string) (_ uint64, err error) {
+	span, ctx := t.startSpan(ctx, sizeOp, opentracing.Tags{"objstore.name": name})
+	defer func() { t.finishSpan(span, err) }()
+
+	return t.bkt.ObjectSize(ctx, name)
+}
+
+func (t *TracingBucket) Attributes(ctx context.Context, name string) (_ ObjectAttributes, err error) {
+	span, ctx := t.startSpan(ctx, attrsOp, opentracing.Tags{"objstore.name": name})
+	defer func() { t.finishSpan(span, err) }()
+
+	return t.bkt.Attributes(ctx, name)
+}
+
+func (t *TracingBucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+	span, ctx := t.startSpan(ctx, uploadOp, opentracing.Tags{"objstore.name": name})
+	cr := &countingReader{r: r}
+	defer func() {
+		span.SetTag("objstore.bytes", cr.n)
+		t.finishSpan(span, err)
+	}()
+
+	return t.bkt.Upload(ctx, name, cr)
+}
+
+func (t *TracingBucket) Delete(ctx context.Context, name string) (err error) {
+	span, ctx := t.startSpan(ctx, deleteOp, opentracing.Tags{"objstore.name": name})
+	defer func() { t.finishSpan(span, err) }()
+
+	return t.bkt.Delete(ctx, name)
+}
+
+func (t *TracingBucket) IsObjNotFoundErr(err error) bool {
+	return t.bkt.IsObjNotFoundErr(err)
+}
+
+func (t *TracingBucket) Close() error {
+	return t.bkt.Close()
+}
+
+func (t *TracingBucket) Name() string {
+	return t.bkt.Name()
+}
+
+// tracingReadCloser finishes the span of a read operation when closed.
+type tracingReadCloser struct {
+	io.ReadCloser
+
+	t      *TracingBucket
+	span   opentracing.Span
+	n      int64
+	err    error
+	closed bool
+}
+
+func (rc *tracingReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	rc.n += int64(n)
+	if err != nil && err != io.EOF && rc.err == nil {
+		rc.err = err
+	}
+	return n, err
+}
+
+func (rc *tracingReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if rc.closed {
+		return err
+	}
+	rc.closed = true
+
+	if rc.err == nil {
+		rc.err = err
+	}
+	rc.span.SetTag("objstore.bytes", rc.n)
+	rc.t.finishSpan(rc.span, rc.err)
+	return err
+}
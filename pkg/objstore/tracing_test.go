@@ -0,0 +1,64 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/basictracer-go"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+func TestTracingBucket(t *testing.T) {
+	rec := &basictracer.InMemorySpanRecorder{}
+	tracer := basictracer.NewWithOptions(basictracer.Options{
+		ShouldSample:   func(traceID uint64) bool { return true },
+		Recorder:       rec,
+		MaxLogsPerSpan: 100,
+	})
+	ctx := tracing.ContextWithTracer(context.Background(), tracer)
+	bkt := NewTracingBucket(NewInMemBucket(), "INMEM")
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("content")))
+
+	rc, err := bkt.GetRange(ctx, "dir/obj", 1, 3)
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "ont", string(b))
+	// Span is not finished until the reader is closed.
+	testutil.Equals(t, 1, len(rec.GetSpans()))
+	testutil.Ok(t, rc.Close())
+
+	_, err = bkt.Get(ctx, "dir/missing")
+	testutil.NotOk(t, err)
+	testutil.Ok(t, bkt.Iter(ctx, "dir/", func(string) error { return nil }))
+
+	spans := rec.GetSpans()
+	testutil.Equals(t, 4, len(spans))
+
+	testutil.Equals(t, "bucket_upload", spans[0].Operation)
+	testutil.Equals(t, "dir/obj", spans[0].Tags["objstore.name"])
+	testutil.Equals(t, int64(7), spans[0].Tags["objstore.bytes"])
+	testutil.Equals(t, "INMEM", spans[0].Tags["objstore.provider"])
+	testutil.Equals(t, "inmem", spans[0].Tags["objstore.bucket"])
+
+	testutil.Equals(t, "bucket_get_range", spans[1].Operation)
+	testutil.Equals(t, int64(1), spans[1].Tags["objstore.offset"])
+	testutil.Equals(t, int64(3), spans[1].Tags["objstore.length"])
+	testutil.Equals(t, int64(3), spans[1].Tags["objstore.bytes"])
+
+	testutil.Equals(t, "bucket_get", spans[2].Operation)
+	testutil.Equals(t, true, spans[2].Tags["objstore.not_found"])
+	_, failed := spans[2].Tags["error"]
+	testutil.Assert(t, !failed, "not found error should not mark span as failed")
+
+	testutil.Equals(t, "bucket_iter", spans[3].Operation)
+	testutil.Equals(t, "dir/", spans[3].Tags["objstore.dir"])
+}
@@ -18,6 +18,9 @@ type check func() bool
 type HTTPProbe struct {
 	ready   uint32
 	healthy uint32
+
+	// notReadyReason holds the error message given as a cause of the last NotReady call.
+	notReadyReason atomic.Value
 }
 
 // NewHTTP returns HTTPProbe representing readiness and healthiness of given component.
@@ -27,18 +30,22 @@ func NewHTTP() *HTTPProbe {
 
 // HealthyHandler returns a HTTP Handler which responds health checks.
 func (p *HTTPProbe) HealthyHandler(logger log.Logger) http.HandlerFunc {
-	return p.handler(logger, p.isHealthy)
+	return p.handler(logger, p.isHealthy, func() string { return "" })
 }
 
 // ReadyHandler returns a HTTP Handler which responds readiness checks.
 func (p *HTTPProbe) ReadyHandler(logger log.Logger) http.HandlerFunc {
-	return p.handler(logger, p.isReady)
+	return p.handler(logger, p.isReady, p.NotReadyReason)
 }
 
-func (p *HTTPProbe) handler(logger log.Logger, c check) http.HandlerFunc {
+func (p *HTTPProbe) handler(logger log.Logger, c check, reason func() string) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		if !c() {
-			http.Error(w, "NOT OK", http.StatusServiceUnavailable)
+			msg := "NOT OK"
+			if r := reason(); r != "" {
+				msg += ": " + r
+			}
+			http.Error(w, msg, http.StatusServiceUnavailable)
 			return
 		}
 		if _, err := io.WriteString(w, "OK"); err != nil {
@@ -59,15 +66,26 @@ func (p *HTTPProbe) isHealthy() bool {
 	return healthy > 0
 }
 
+// NotReadyReason returns the cause given to the last NotReady call, or empty string if there was none.
+func (p *HTTPProbe) NotReadyReason() string {
+	r, _ := p.notReadyReason.Load().(string)
+	return r
+}
+
 // Ready sets components status to ready.
 func (p *HTTPProbe) Ready() {
 	atomic.SwapUint32(&p.ready, 1)
 }
 
 // NotReady sets components status to not ready with given error as a cause.
+// The cause is reported by the readiness handler.
 func (p *HTTPProbe) NotReady(err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	p.notReadyReason.Store(reason)
 	atomic.SwapUint32(&p.ready, 0)
-
 }
 
 // Healthy sets components status to healthy.
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"path"
 	"testing"
 
@@ -133,3 +134,19 @@ func doGet(ctx context.Context, url string) (*http.Response, error) {
 
 	return http.DefaultClient.Do(req.WithContext(ctx))
 }
+
+func TestHTTPProberNotReadyReason(t *testing.T) {
+	p := NewHTTP()
+	testutil.Equals(t, "", p.NotReadyReason())
+
+	p.NotReady(errors.New("missing capability"))
+	testutil.Equals(t, "missing capability", p.NotReadyReason())
+
+	rec := httptest.NewRecorder()
+	p.ReadyHandler(log.NewNopLogger())(rec, httptest.NewRequest("GET", "/-/ready", nil))
+	testutil.Equals(t, http.StatusServiceUnavailable, rec.Code)
+	testutil.Equals(t, "NOT OK: missing capability\n", rec.Body.String())
+
+	p.NotReady(nil)
+	testutil.Equals(t, "", p.NotReadyReason())
+}
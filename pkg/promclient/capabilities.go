@@ -0,0 +1,67 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package promclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExemplarStorageFeature is the name of the Prometheus feature flag that enables exemplar storage.
+const ExemplarStorageFeature = "exemplar-storage"
+
+// Capabilities describes the features of a Prometheus server that Thanos components depend on.
+type Capabilities struct {
+	// Version is the version of Prometheus. Empty if it is unknown, e.g. because Prometheus is older than v2.14.
+	Version string
+
+	// StreamedRemoteRead is true if remote read can respond with streamed XOR chunks. Added to Prometheus from v2.13.
+	StreamedRemoteRead bool
+	// Exemplars is true if exemplars are stored and the exemplars query API is available. Added to Prometheus from
+	// v2.26 and requires the exemplar-storage feature to be enabled.
+	Exemplars bool
+}
+
+// NewCapabilities returns the capabilities of a Prometheus server with the given version and configured flags.
+// Unknown versions are treated as older than v2.14, the first version exposing its build information.
+func NewCapabilities(version string, flags Flags) Capabilities {
+	c := Capabilities{Version: version}
+	if version == "" {
+		// Remote read response type is negotiated, so streaming is requested and sampled responses are still handled.
+		c.StreamedRemoteRead = true
+		return c
+	}
+
+	c.StreamedRemoteRead = versionAtLeast(version, 2, 13)
+	if versionAtLeast(version, 2, 26) {
+		for _, f := range flags.EnableFeatures {
+			if f == ExemplarStorageFeature {
+				c.Exemplars = true
+				break
+			}
+		}
+	}
+	return c
+}
+
+// versionAtLeast returns true if the given semantic version is at least major.minor. Versions that cannot be parsed,
+// e.g. builds from a branch, are assumed to be recent.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	maj, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return true
+	}
+	mnr, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return true
+	}
+	if maj != major {
+		return maj > major
+	}
+	return mnr >= minor
+}
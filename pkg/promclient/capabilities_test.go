@@ -0,0 +1,69 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package promclient
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNewCapabilities(t *testing.T) {
+	withExemplars := Flags{EnableFeatures: []string{"promql-at-modifier", ExemplarStorageFeature}}
+
+	for _, tcase := range []struct {
+		version  string
+		flags    Flags
+		expected Capabilities
+	}{
+		{
+			version:  "",
+			expected: Capabilities{StreamedRemoteRead: true},
+		},
+		{
+			version:  "2.12.0",
+			flags:    withExemplars,
+			expected: Capabilities{Version: "2.12.0"},
+		},
+		{
+			version:  "2.13.1",
+			expected: Capabilities{Version: "2.13.1", StreamedRemoteRead: true},
+		},
+		{
+			version:  "2.26.0",
+			expected: Capabilities{Version: "2.26.0", StreamedRemoteRead: true},
+		},
+		{
+			version:  "2.26.0-rc.0",
+			flags:    withExemplars,
+			expected: Capabilities{Version: "2.26.0-rc.0", StreamedRemoteRead: true, Exemplars: true},
+		},
+		{
+			version:  "3.0.0",
+			flags:    withExemplars,
+			expected: Capabilities{Version: "3.0.0", StreamedRemoteRead: true, Exemplars: true},
+		},
+		{
+			version:  "main",
+			flags:    withExemplars,
+			expected: Capabilities{Version: "main", StreamedRemoteRead: true, Exemplars: true},
+		},
+	} {
+		t.Run(tcase.version, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, NewCapabilities(tcase.version, tcase.flags))
+		})
+	}
+}
+
+func TestFlags_UnmarshalEnableFeatures(t *testing.T) {
+	for _, input := range []string{
+		`{"storage.tsdb.min-block-duration": "2h", "enable-feature": "exemplar-storage,promql-at-modifier"}`,
+		`{"storage.tsdb.min-block-duration": "2h", "enable-feature": "[exemplar-storage promql-at-modifier]"}`,
+	} {
+		var f Flags
+		testutil.Ok(t, json.Unmarshal([]byte(input), &f))
+		testutil.Equals(t, []string{"exemplar-storage", "promql-at-modifier"}, f.EnableFeatures)
+	}
+}
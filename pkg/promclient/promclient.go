@@ -31,14 +31,21 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	promlabels "github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/textparse"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	yaml "gopkg.in/yaml.v2"
 )
 
-var ErrFlagEndpointNotFound = errors.New("no flag endpoint found")
+var (
+	ErrFlagEndpointNotFound      = errors.New("no flag endpoint found")
+	ErrBuildInfoEndpointNotFound = errors.New("no build info endpoint found")
+)
 
 // IsWALDirAccessible returns no error if WAL dir can be found. This helps to tell
 // if we have access to Prometheus TSDB directory.
@@ -108,6 +115,7 @@ type Flags struct {
 	TSDBMaxTime        model.Duration `json:"storage.tsdb.max-block-duration"`
 	WebEnableAdminAPI  bool           `json:"web.enable-admin-api"`
 	WebEnableLifecycle bool           `json:"web.enable-lifecycle"`
+	EnableFeatures     []string       `json:"enable-feature"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
@@ -122,6 +130,7 @@ func (f *Flags) UnmarshalJSON(b []byte) error {
 		TSDBMaxTime        modelDuration `json:"storage.tsdb.max-block-duration"`
 		WebEnableAdminAPI  modelBool     `json:"web.enable-admin-api"`
 		WebEnableLifecycle modelBool     `json:"web.enable-lifecycle"`
+		EnableFeatures     string        `json:"enable-feature"`
 	}{}
 
 	if err := json.Unmarshal(b, &parsableFlags); err != nil {
@@ -135,10 +144,19 @@ func (f *Flags) UnmarshalJSON(b []byte) error {
 		TSDBMaxTime:        model.Duration(parsableFlags.TSDBMaxTime),
 		WebEnableAdminAPI:  bool(parsableFlags.WebEnableAdminAPI),
 		WebEnableLifecycle: bool(parsableFlags.WebEnableLifecycle),
+		EnableFeatures:     parseFeatureList(parsableFlags.EnableFeatures),
 	}
 	return nil
 }
 
+// parseFeatureList parses the stringified value of the repeated enable-feature flag. Depending on the Prometheus
+// version features are either comma separated or printed as a list, e.g. "[exemplar-storage memory-snapshot-on-shutdown]".
+func parseFeatureList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '[' || r == ']' || r == ' '
+	})
+}
+
 type modelDuration model.Duration
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
@@ -214,6 +232,48 @@ func ConfiguredFlags(ctx context.Context, logger log.Logger, base *url.URL) (Fla
 
 }
 
+// BuildVersion returns the version of Prometheus from /api/v1/status/buildinfo Prometheus endpoint.
+// Added to Prometheus from v2.14.
+func BuildVersion(ctx context.Context, logger log.Logger, base *url.URL) (string, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/status/buildinfo")
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "create request")
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "request build info against %s", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(logger, resp.Body, "query body")
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.New("failed to read body")
+	}
+
+	switch resp.StatusCode {
+	case 404:
+		return "", ErrBuildInfoEndpointNotFound
+	case 200:
+		var d struct {
+			Data struct {
+				Version string `json:"version"`
+			} `json:"data"`
+		}
+
+		if err := json.Unmarshal(b, &d); err != nil {
+			return "", errors.Wrapf(err, "unmarshal response: %v", string(b))
+		}
+
+		return d.Data.Version, nil
+	default:
+		return "", errors.Errorf("got non-200 response code: %v, response: %v", resp.StatusCode, string(b))
+	}
+}
+
 // Snapshot will request Prometheus to perform snapshot in directory returned by this function.
 // Returned directory is relative to Prometheus data-dir.
 // NOTE: `--web.enable-admin-api` flag has to be set on Prometheus.
@@ -318,16 +378,33 @@ func defaultClient(logger log.Logger) *Client {
 	)
 }
 
-// QueryInstant performs an instant query and returns results in model.Vector type.
-func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string, t time.Time, opts QueryOptions) (model.Vector, []string, error) {
+// StatusError is returned for queries the server responded to, but which did not succeed.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+
+// queryResult is the result of an instant query.
+type queryResult struct {
+	statusCode int
+	resultType string
+	result     json.RawMessage
+	warnings   []string
+}
+
+// query performs an instant query and returns the raw result.
+// Errors returned once the server responded are of type *StatusError.
+func (c *Client) query(ctx context.Context, base *url.URL, query string, t time.Time, opts QueryOptions) (_ queryResult, err error) {
 	params, err := url.ParseQuery(base.RawQuery)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "parse raw query %s", base.RawQuery)
+		return queryResult{}, errors.Wrapf(err, "parse raw query %s", base.RawQuery)
 	}
 	params.Add("query", query)
 	params.Add("time", t.Format(time.RFC3339Nano))
 	if err := opts.AddTo(params); err != nil {
-		return nil, nil, errors.Wrap(err, "add thanos opts query params")
+		return queryResult{}, errors.Wrap(err, "add thanos opts query params")
 	}
 
 	u := *base
@@ -338,22 +415,28 @@ func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string,
 
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "create GET request")
+		return queryResult{}, errors.Wrap(err, "create GET request")
 	}
 
 	req = req.WithContext(ctx)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "perform GET request against %s", u.String())
+		return queryResult{}, errors.Wrapf(err, "perform GET request against %s", u.String())
 	}
 	defer runutil.ExhaustCloseWithLogOnErr(c.logger, resp.Body, "query body")
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "read query instant response")
+		return queryResult{}, errors.Wrap(err, "read query instant response")
 	}
 
+	defer func() {
+		if err != nil {
+			err = &StatusError{StatusCode: resp.StatusCode, Err: err}
+		}
+	}()
+
 	// Decode only ResultType and load Result only as RawJson since we don't know
 	// structure of the Result yet.
 	var m struct {
@@ -369,34 +452,64 @@ func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string,
 	}
 
 	if err = json.Unmarshal(body, &m); err != nil {
-		return nil, nil, errors.Wrap(err, "unmarshal query instant response")
+		return queryResult{}, errors.Wrap(err, "unmarshal query instant response")
+	}
+
+	switch m.Data.ResultType {
+	case promql.ValueTypeVector, promql.ValueTypeScalar, promql.ValueTypeMatrix:
+		return queryResult{statusCode: resp.StatusCode, resultType: m.Data.ResultType, result: m.Data.Result, warnings: m.Warnings}, nil
+	}
+	if m.Warnings != nil {
+		return queryResult{}, errors.Errorf("error: %s, type: %s, warning: %s", m.Error, m.ErrorType, strings.Join(m.Warnings, ", "))
+	}
+	if m.Error != "" {
+		return queryResult{}, errors.Errorf("error: %s, type: %s", m.Error, m.ErrorType)
+	}
+	return queryResult{}, errors.Errorf("received status code: %d, unknown response type: '%q'", resp.StatusCode, m.Data.ResultType)
+}
+
+// QueryInstant performs an instant query and returns results in model.Vector type.
+func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string, t time.Time, opts QueryOptions) (model.Vector, []string, error) {
+	res, err := c.query(ctx, base, query, t, opts)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var vectorResult model.Vector
 
 	// Decode the Result depending on the ResultType
 	// Currently only `vector` and `scalar` types are supported.
-	switch m.Data.ResultType {
+	switch res.resultType {
 	case promql.ValueTypeVector:
-		if err = json.Unmarshal(m.Data.Result, &vectorResult); err != nil {
-			return nil, nil, errors.Wrap(err, "decode result into ValueTypeVector")
+		if err = json.Unmarshal(res.result, &vectorResult); err != nil {
+			return nil, nil, &StatusError{StatusCode: res.statusCode, Err: errors.Wrap(err, "decode result into ValueTypeVector")}
 		}
 	case promql.ValueTypeScalar:
-		vectorResult, err = convertScalarJSONToVector(m.Data.Result)
+		vectorResult, err = convertScalarJSONToVector(res.result)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "decode result into ValueTypeScalar")
+			return nil, nil, &StatusError{StatusCode: res.statusCode, Err: errors.Wrap(err, "decode result into ValueTypeScalar")}
 		}
 	default:
-		if m.Warnings != nil {
-			return nil, nil, errors.Errorf("error: %s, type: %s, warning: %s", m.Error, m.ErrorType, strings.Join(m.Warnings, ", "))
-		}
-		if m.Error != "" {
-			return nil, nil, errors.Errorf("error: %s, type: %s", m.Error, m.ErrorType)
-		}
+		return nil, nil, &StatusError{StatusCode: res.statusCode, Err: errors.Errorf("unsupported response type: '%q'", res.resultType)}
+	}
+	return vectorResult, res.warnings, nil
+}
+
+// QueryInstantMatrix performs an instant query of a range selector, e.g. `up[5m]`, and returns results in model.Matrix type.
+func (c *Client) QueryInstantMatrix(ctx context.Context, base *url.URL, query string, t time.Time, opts QueryOptions) (model.Matrix, []string, error) {
+	res, err := c.query(ctx, base, query, t, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.resultType != promql.ValueTypeMatrix {
+		return nil, nil, &StatusError{StatusCode: res.statusCode, Err: errors.Errorf("unsupported response type: '%q'", res.resultType)}
+	}
 
-		return nil, nil, errors.Errorf("received status code: %d, unknown response type: '%q'", resp.StatusCode, m.Data.ResultType)
+	var matrixResult model.Matrix
+	if err := json.Unmarshal(res.result, &matrixResult); err != nil {
+		return nil, nil, &StatusError{StatusCode: res.statusCode, Err: errors.Wrap(err, "decode result into ValueTypeMatrix")}
 	}
-	return vectorResult, m.Warnings, nil
+	return matrixResult, res.warnings, nil
 }
 
 // QueryInstant performs an instant query using a default HTTP client and returns results in model.Vector type.
@@ -540,3 +653,167 @@ func MetricValues(ctx context.Context, logger log.Logger, base *url.URL, perMetr
 		}
 	}
 }
+
+// getAPIData performs a GET request against the given Prometheus API URL and decodes the data of a successful
+// response into the given value.
+func (c *Client) getAPIData(ctx context.Context, u *url.URL, data interface{}) error {
+	level.Debug(c.logger).Log("msg", "querying API", "url", u.String())
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "create GET request")
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "perform GET request against %s", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(c.logger, resp.Body, "api body")
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.Errorf("API %s not found; is Prometheus too old to support it?", u.Path)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read API response")
+	}
+
+	var m struct {
+		Status    string          `json:"status"`
+		Data      json.RawMessage `json:"data"`
+		Error     string          `json:"error,omitempty"`
+		ErrorType string          `json:"errorType,omitempty"`
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return errors.Wrapf(err, "unmarshal API response, received status code: %d", resp.StatusCode)
+	}
+	if m.Status != "success" {
+		return errors.Errorf("error: %s, type: %s, received status code: %d", m.Error, m.ErrorType, resp.StatusCode)
+	}
+	return errors.Wrap(json.Unmarshal(m.Data, data), "unmarshal API response data")
+}
+
+// MetricMetadataInGRPC returns metadata of the given metric, or of all metrics if empty, keyed by metric name.
+// Non-positive limit means no limit.
+func (c *Client) MetricMetadataInGRPC(ctx context.Context, base *url.URL, metric string, limit int) (map[string][]metadatapb.Meta, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/metadata")
+	q := u.Query()
+	if metric != "" {
+		q.Add("metric", metric)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	u.RawQuery = q.Encode()
+
+	var md map[string][]metadatapb.Meta
+	if err := c.getAPIData(ctx, &u, &md); err != nil {
+		return nil, errors.Wrap(err, "get metric metadata")
+	}
+	return md, nil
+}
+
+// ExemplarsInGRPC returns exemplars of series selected by the given query within [mint, maxt] in milliseconds.
+func (c *Client) ExemplarsInGRPC(ctx context.Context, base *url.URL, query string, mint, maxt int64) ([]*exemplarspb.ExemplarData, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/query_exemplars")
+	q := u.Query()
+	q.Add("query", query)
+	q.Add("start", formatTime(timestamp.Time(mint)))
+	q.Add("end", formatTime(timestamp.Time(maxt)))
+	u.RawQuery = q.Encode()
+
+	var data []struct {
+		SeriesLabels labels.Labels `json:"seriesLabels"`
+		Exemplars    []struct {
+			Labels    labels.Labels     `json:"labels"`
+			Value     model.SampleValue `json:"value"`
+			Timestamp model.Time        `json:"timestamp"`
+		} `json:"exemplars"`
+	}
+	if err := c.getAPIData(ctx, &u, &data); err != nil {
+		return nil, errors.Wrap(err, "get exemplars")
+	}
+
+	res := make([]*exemplarspb.ExemplarData, 0, len(data))
+	for _, d := range data {
+		ed := &exemplarspb.ExemplarData{
+			SeriesLabels: storepb.LabelSet{Labels: storepb.PromLabelsToLabels(d.SeriesLabels)},
+			Exemplars:    make([]exemplarspb.Exemplar, 0, len(d.Exemplars)),
+		}
+		for _, e := range d.Exemplars {
+			ed.Exemplars = append(ed.Exemplars, exemplarspb.Exemplar{
+				Labels: storepb.LabelSet{Labels: storepb.PromLabelsToLabels(e.Labels)},
+				Value:  float64(e.Value),
+				Ts:     int64(e.Timestamp),
+			})
+		}
+		res = append(res, ed)
+	}
+	return res, nil
+}
+
+// TargetsInGRPC returns scrape targets in the given state, i.e. "active", "dropped" or "any".
+func (c *Client) TargetsInGRPC(ctx context.Context, base *url.URL, state string) (*targetspb.TargetDiscovery, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/targets")
+	q := u.Query()
+	q.Add("state", state)
+	u.RawQuery = q.Encode()
+
+	var data struct {
+		ActiveTargets []struct {
+			DiscoveredLabels   labels.Labels `json:"discoveredLabels"`
+			Labels             labels.Labels `json:"labels"`
+			ScrapePool         string        `json:"scrapePool"`
+			ScrapeURL          string        `json:"scrapeUrl"`
+			LastError          string        `json:"lastError"`
+			LastScrape         time.Time     `json:"lastScrape"`
+			LastScrapeDuration float64       `json:"lastScrapeDuration"`
+			Health             string        `json:"health"`
+		} `json:"activeTargets"`
+		DroppedTargets []struct {
+			DiscoveredLabels labels.Labels `json:"discoveredLabels"`
+		} `json:"droppedTargets"`
+	}
+	if err := c.getAPIData(ctx, &u, &data); err != nil {
+		return nil, errors.Wrap(err, "get targets")
+	}
+
+	res := &targetspb.TargetDiscovery{}
+	for _, t := range data.ActiveTargets {
+		health := targetspb.ActiveTarget_UNKNOWN
+		switch t.Health {
+		case "up":
+			health = targetspb.ActiveTarget_UP
+		case "down":
+			health = targetspb.ActiveTarget_DOWN
+		}
+		at := &targetspb.ActiveTarget{
+			DiscoveredLabels:   storepb.LabelSet{Labels: storepb.PromLabelsToLabels(t.DiscoveredLabels)},
+			Labels:             storepb.LabelSet{Labels: storepb.PromLabelsToLabels(t.Labels)},
+			ScrapePool:         t.ScrapePool,
+			ScrapeUrl:          t.ScrapeURL,
+			LastError:          t.LastError,
+			LastScrapeDuration: t.LastScrapeDuration,
+			Health:             health,
+		}
+		if !t.LastScrape.IsZero() {
+			at.LastScrape = timestamp.FromTime(t.LastScrape)
+		}
+		res.ActiveTargets = append(res.ActiveTargets, at)
+	}
+	for _, t := range data.DroppedTargets {
+		res.DroppedTargets = append(res.DroppedTargets, &targetspb.DroppedTarget{
+			DiscoveredLabels: storepb.LabelSet{Labels: storepb.PromLabelsToLabels(t.DiscoveredLabels)},
+		})
+	}
+	return res, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64)
+}
@@ -0,0 +1,273 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file is a modified copy from
+// github.com/prometheus/prometheus/web/federate.go@1e64d757f711.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// federationLookbackDelta is the maximum age of the latest sample of a series to be still federated.
+// It is the same as the default lookback delta of the PromQL engine.
+const federationLookbackDelta = 5 * time.Minute
+
+// RegisterFederation registers the Prometheus compatible /federate endpoint in the given router.
+func (api *API) RegisterFederation(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware) {
+	r.Get("/federate", ins.NewHandler("federate", tracing.HTTPMiddleware(tracer, "federate", logger, http.HandlerFunc(api.federate))))
+}
+
+// federate writes the latest sample of every series matching any of the match[] selectors in the Prometheus
+// exposition format, so that the global view can be scraped by Prometheus federation.
+// Series are deduplicated according to the dedup and replicaLabels[] parameters the same way as for queries.
+// External labels of the querier, i.e. its selector labels, are attached to series that do not have them yet.
+func (api *API) federate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing form values: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var matcherSets [][]*labels.Matcher
+	for _, s := range r.Form["match[]"] {
+		matchers, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	enableDedup, apiErr := api.parseEnableDedupParam(r)
+	if apiErr != nil {
+		http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	replicaLabels, apiErr := api.parseReplicaLabelsParam(r)
+	if apiErr != nil {
+		http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
+	if apiErr != nil {
+		http.Error(w, apiErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		now    = api.now()
+		mint   = timestamp.FromTime(now.Add(-federationLookbackDelta))
+		maxt   = timestamp.FromTime(now)
+		format = expfmt.Negotiate(r.Header)
+		enc    = expfmt.NewEncoder(w, format)
+	)
+	w.Header().Set("Content-Type", string(format))
+
+	q, err := api.queryableCreate(enableDedup, replicaLabels, 0, enablePartialResponse, false, false).Querier(r.Context(), mint, maxt)
+	if err != nil {
+		api.federationErrors.Inc()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer runutil.CloseWithLogOnErr(api.logger, q, "queryable federate")
+
+	params := &storage.SelectParams{
+		Start: mint,
+		End:   maxt,
+	}
+
+	var sets []storage.SeriesSet
+	for _, mset := range matcherSets {
+		s, warns, err := q.Select(params, mset...)
+		if len(warns) > 0 {
+			level.Debug(api.logger).Log("msg", "federation select returned warnings", "warnings", fmt.Sprintf("%v", warns))
+			api.federationWarnings.Add(float64(len(warns)))
+		}
+		if err != nil {
+			api.federationErrors.Inc()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sets = append(sets, s)
+	}
+
+	var (
+		vec = make(promql.Vector, 0, 8000)
+		set = storage.NewMergeSeriesSet(sets, nil)
+	)
+	for set.Next() {
+		s := set.At()
+
+		var (
+			t  int64
+			v  float64
+			ok bool
+			it = s.Iterator()
+		)
+		for it.Next() {
+			st, sv := it.At()
+			if st > maxt {
+				break
+			}
+			t, v, ok = st, sv, true
+		}
+		if err := it.Err(); err != nil {
+			api.federationErrors.Inc()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The exposition formats do not support stale markers, so drop them. This
+		// is good enough for staleness handling of federated data, as the
+		// interval-based limits on staleness will do the right thing for supported
+		// use cases (which is to say federating aggregated time series).
+		if !ok || value.IsStaleNaN(v) {
+			continue
+		}
+
+		vec = append(vec, promql.Sample{
+			Metric: s.Labels(),
+			Point:  promql.Point{T: t, V: v},
+		})
+	}
+	if set.Err() != nil {
+		api.federationErrors.Inc()
+		http.Error(w, set.Err().Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Sort(byName(vec))
+
+	externalLabels := api.externalLabels.Map()
+	if _, ok := externalLabels[model.InstanceLabel]; !ok {
+		externalLabels[model.InstanceLabel] = ""
+	}
+	externalLabelNames := make([]string, 0, len(externalLabels))
+	for ln := range externalLabels {
+		externalLabelNames = append(externalLabelNames, ln)
+	}
+	sort.Strings(externalLabelNames)
+
+	var (
+		lastMetricName string
+		protMetricFam  *dto.MetricFamily
+	)
+	for _, s := range vec {
+		nameSeen := false
+		globalUsed := map[string]struct{}{}
+		protMetric := &dto.Metric{
+			Untyped: &dto.Untyped{},
+		}
+
+		for _, l := range s.Metric {
+			if l.Value == "" {
+				// No value means unset. Never consider those labels.
+				// This is also important to protect against nameless metrics.
+				continue
+			}
+			if l.Name == labels.MetricName {
+				nameSeen = true
+				if l.Value == lastMetricName {
+					// We already have the name in the current MetricFamily,
+					// and we ignore nameless metrics.
+					continue
+				}
+				// Need to start a new MetricFamily. Ship off the old one (if any) before
+				// creating the new one.
+				if protMetricFam != nil {
+					if err := enc.Encode(protMetricFam); err != nil {
+						api.federationErrors.Inc()
+						level.Error(api.logger).Log("msg", "federation failed", "err", err)
+						return
+					}
+				}
+				protMetricFam = &dto.MetricFamily{
+					Type: dto.MetricType_UNTYPED.Enum(),
+					Name: proto.String(l.Value),
+				}
+				lastMetricName = l.Value
+				continue
+			}
+			protMetric.Label = append(protMetric.Label, &dto.LabelPair{
+				Name:  proto.String(l.Name),
+				Value: proto.String(l.Value),
+			})
+			if _, ok := externalLabels[l.Name]; ok {
+				globalUsed[l.Name] = struct{}{}
+			}
+		}
+		if !nameSeen {
+			level.Warn(api.logger).Log("msg", "ignoring nameless metric during federation", "metric", s.Metric)
+			continue
+		}
+		// Attach external labels if they do not exist yet.
+		for _, ln := range externalLabelNames {
+			lv := externalLabels[ln]
+			if _, ok := globalUsed[ln]; !ok {
+				protMetric.Label = append(protMetric.Label, &dto.LabelPair{
+					Name:  proto.String(ln),
+					Value: proto.String(lv),
+				})
+			}
+		}
+
+		protMetric.TimestampMs = proto.Int64(s.T)
+		protMetric.Untyped.Value = proto.Float64(s.V)
+
+		protMetricFam.Metric = append(protMetricFam.Metric, protMetric)
+	}
+	// Still have to ship off the last MetricFamily, if any.
+	if protMetricFam != nil {
+		if err := enc.Encode(protMetricFam); err != nil {
+			api.federationErrors.Inc()
+			level.Error(api.logger).Log("msg", "federation failed", "err", err)
+		}
+	}
+}
+
+// byName makes a model.Vector sortable by metric name.
+type byName promql.Vector
+
+func (vec byName) Len() int      { return len(vec) }
+func (vec byName) Swap(i, j int) { vec[i], vec[j] = vec[j], vec[i] }
+
+func (vec byName) Less(i, j int) bool {
+	ni := vec[i].Metric.Get(labels.MetricName)
+	nj := vec[j].Metric.Get(labels.MetricName)
+	return ni < nj
+}
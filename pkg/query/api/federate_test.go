@@ -0,0 +1,117 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestFederate(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	now := time.Now()
+	app := db.Appender()
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "test_metric1", "foo", "bar", "replica", "a"),
+		labels.FromStrings("__name__", "test_metric1", "foo", "bar", "replica", "b"),
+		labels.FromStrings("__name__", "test_metric2", "ext", "2", "foo", "boo"),
+		labels.FromStrings("__name__", "other_metric", "foo", "bar"),
+	} {
+		for i := 0; i < 10; i++ {
+			_, err := app.Add(lset, timestamp.FromTime(now.Add(-time.Duration(10-i)*30*time.Second)), float64(i))
+			testutil.Ok(t, err)
+		}
+	}
+	// Series without samples within the lookback delta are not federated.
+	_, err = app.Add(labels.FromStrings("__name__", "test_metric3"), timestamp.FromTime(now.Add(-time.Hour)), 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	api := &API{
+		logger:             log.NewNopLogger(),
+		queryableCreate:    query.NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), false),
+		externalLabels:     labels.FromStrings("ext", "1"),
+		federationErrors:   prometheus.NewCounter(prometheus.CounterOpts{}),
+		federationWarnings: prometheus.NewCounter(prometheus.CounterOpts{}),
+		now:                func() time.Time { return now },
+	}
+
+	ts := timestamp.FromTime(now.Add(-30 * time.Second))
+	for _, tcase := range []struct {
+		name     string
+		query    string
+		code     int
+		expected string
+	}{
+		{
+			name:  "deduplicated",
+			query: `match[]={__name__=~"test_.*"}&replicaLabels[]=replica`,
+			code:  http.StatusOK,
+			expected: fmt.Sprintf(`# TYPE test_metric1 untyped
+test_metric1{foo="bar",ext="1",instance=""} 9 %[1]d
+# TYPE test_metric2 untyped
+test_metric2{ext="2",foo="boo",instance=""} 9 %[1]d
+`, ts),
+		},
+		{
+			name:  "not deduplicated",
+			query: `match[]=test_metric1&dedup=false`,
+			code:  http.StatusOK,
+			expected: fmt.Sprintf(`# TYPE test_metric1 untyped
+test_metric1{foo="bar",replica="a",ext="1",instance=""} 9 %[1]d
+test_metric1{foo="bar",replica="b",ext="1",instance=""} 9 %[1]d
+`, ts),
+		},
+		{
+			name:  "multiple matchers",
+			query: `match[]=test_metric2&match[]=other_metric`,
+			code:  http.StatusOK,
+			expected: fmt.Sprintf(`# TYPE other_metric untyped
+other_metric{foo="bar",ext="1",instance=""} 9 %[1]d
+# TYPE test_metric2 untyped
+test_metric2{ext="2",foo="boo",instance=""} 9 %[1]d
+`, ts),
+		},
+		{
+			name:     "no matchers",
+			code:     http.StatusOK,
+			expected: "",
+		},
+		{
+			name:  "invalid matcher",
+			query: `match[]={foo`,
+			code:  http.StatusBadRequest,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "http://example.org/federate?"+tcase.query, nil)
+			testutil.Ok(t, err)
+
+			rec := httptest.NewRecorder()
+			api.federate(rec, req)
+
+			testutil.Equals(t, tcase.code, rec.Code)
+			if tcase.code != http.StatusOK {
+				return
+			}
+			testutil.Equals(t, tcase.expected, rec.Body.String())
+		})
+	}
+}
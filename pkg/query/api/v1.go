@@ -33,6 +33,7 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -41,7 +42,11 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/querylog"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
@@ -59,7 +64,8 @@ const (
 	errorTimeout  ErrorType = "timeout"
 	errorCanceled ErrorType = "canceled"
 	errorExec     ErrorType = "execution"
-	errorBadData  ErrorType = "bad_data"
+	ErrorBadData  ErrorType = "bad_data"
+	ErrorNotFound ErrorType = "not_found"
 	ErrorInternal ErrorType = "internal"
 )
 
@@ -102,13 +108,21 @@ type API struct {
 	logger          log.Logger
 	queryableCreate query.QueryableCreator
 	queryEngine     *promql.Engine
+	stores          func() []store.Client
+	storeStatuses   func() []query.StoreStatus
 
 	enableAutodownsampling                 bool
 	enablePartialResponse                  bool
 	replicaLabels                          []string
+	externalLabels                         labels.Labels
 	reg                                    prometheus.Registerer
 	defaultInstantQueryMaxSourceResolution time.Duration
 
+	federationErrors   prometheus.Counter
+	federationWarnings prometheus.Counter
+
+	slowQueryLog *querylog.SlowQueryLog
+
 	now func() time.Time
 }
 
@@ -118,20 +132,37 @@ func NewAPI(
 	reg *prometheus.Registry,
 	qe *promql.Engine,
 	c query.QueryableCreator,
+	stores func() []store.Client,
+	storeStatuses func() []query.StoreStatus,
 	enableAutodownsampling bool,
 	enablePartialResponse bool,
 	replicaLabels []string,
+	externalLabels labels.Labels,
 	defaultInstantQueryMaxSourceResolution time.Duration,
+	slowQueryLog *querylog.SlowQueryLog,
 ) *API {
 	return &API{
 		logger:                                 logger,
 		queryEngine:                            qe,
 		queryableCreate:                        c,
+		stores:                                 stores,
+		storeStatuses:                          storeStatuses,
 		enableAutodownsampling:                 enableAutodownsampling,
 		enablePartialResponse:                  enablePartialResponse,
 		replicaLabels:                          replicaLabels,
+		externalLabels:                         externalLabels,
 		reg:                                    reg,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
+		slowQueryLog:                           slowQueryLog,
+
+		federationErrors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_query_federation_errors_total",
+			Help: "Total number of errors that occurred while sending federation responses.",
+		}),
+		federationWarnings: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_query_federation_warnings_total",
+			Help: "Total number of warnings that occurred while sending federation responses.",
+		}),
 
 		now: time.Now,
 	}
@@ -168,6 +199,10 @@ func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.
 
 	r.Get("/labels", instr("label_names", api.labelNames))
 	r.Post("/labels", instr("label_names", api.labelNames))
+
+	r.Get("/duplicate_series", instr("duplicate_series", api.duplicateSeries))
+
+	r.Get("/stores", instr("stores", api.storesStatus))
 }
 
 type queryData struct {
@@ -186,7 +221,7 @@ func (api *API) parseEnableDedupParam(r *http.Request) (enableDeduplication bool
 		var err error
 		enableDeduplication, err = strconv.ParseBool(val)
 		if err != nil {
-			return false, &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", dedupParam)}
+			return false, &ApiError{ErrorBadData, errors.Wrapf(err, "'%s' parameter", dedupParam)}
 		}
 	}
 	return enableDeduplication, nil
@@ -218,12 +253,12 @@ func (api *API) parseDownsamplingParamMillis(r *http.Request, defaultVal time.Du
 		var err error
 		maxSourceResolution, err = parseDuration(val)
 		if err != nil {
-			return 0, &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", maxSourceResolutionParam)}
+			return 0, &ApiError{ErrorBadData, errors.Wrapf(err, "'%s' parameter", maxSourceResolutionParam)}
 		}
 	}
 
 	if maxSourceResolution < 0 {
-		return 0, &ApiError{errorBadData, errors.Errorf("negative '%s' is not accepted. Try a positive integer", maxSourceResolutionParam)}
+		return 0, &ApiError{ErrorBadData, errors.Errorf("negative '%s' is not accepted. Try a positive integer", maxSourceResolutionParam)}
 	}
 
 	return int64(maxSourceResolution / time.Millisecond), nil
@@ -238,12 +273,57 @@ func (api *API) parsePartialResponseParam(r *http.Request) (enablePartialRespons
 		var err error
 		enablePartialResponse, err = strconv.ParseBool(val)
 		if err != nil {
-			return false, &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", partialResponseParam)}
+			return false, &ApiError{ErrorBadData, errors.Wrapf(err, "'%s' parameter", partialResponseParam)}
 		}
 	}
 	return enablePartialResponse, nil
 }
 
+// logSlowQuery logs the query of the given request begun at the given time with its result, if it was slow.
+func (api *API) logSlowQuery(r *http.Request, start, end time.Time, step time.Duration, begin time.Time, res promql.Value) {
+	if api.slowQueryLog == nil {
+		return
+	}
+	series, samples := querylog.ResultStats(res)
+	api.slowQueryLog.LogRequest(r, querylog.Entry{
+		Query:    r.FormValue("query"),
+		Start:    start,
+		End:      end,
+		Step:     step,
+		Duration: time.Since(begin),
+		Series:   series,
+		Samples:  samples,
+	})
+}
+
+// parseShardParam returns a context restricting the query to the series of the shard of the request, if any.
+func (api *API) parseShardParam(ctx context.Context, r *http.Request) (context.Context, *ApiError) {
+	const shardParam = "shard"
+
+	val := r.FormValue(shardParam)
+	if val == "" {
+		return ctx, nil
+	}
+	shard, err := querysharding.ParseShard(val)
+	if err != nil {
+		return nil, &ApiError{ErrorBadData, errors.Wrapf(err, "'%s' parameter", shardParam)}
+	}
+	return querysharding.ContextWithShard(ctx, shard), nil
+}
+
+func (api *API) parseStaleGapsParam(r *http.Request) (staleGaps bool, _ *ApiError) {
+	const staleGapsParam = "stale_gaps"
+
+	if val := r.FormValue(staleGapsParam); val != "" {
+		var err error
+		staleGaps, err = strconv.ParseBool(val)
+		if err != nil {
+			return false, &ApiError{ErrorBadData, errors.Wrapf(err, "'%s' parameter", staleGapsParam)}
+		}
+	}
+	return staleGaps, nil
+}
+
 func (api *API) options(r *http.Request) (interface{}, []error, *ApiError) {
 	return nil, nil, nil
 }
@@ -252,9 +332,9 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 	var ts time.Time
 	if t := r.FormValue("time"); t != "" {
 		var err error
-		ts, err = parseTime(t)
+		ts, err = ParseTime(t)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 	} else {
 		ts = api.now()
@@ -265,7 +345,7 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 		var cancel context.CancelFunc
 		timeout, err := parseDuration(to)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 
 		ctx, cancel = context.WithTimeout(ctx, timeout)
@@ -292,16 +372,29 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, apiErr
 	}
 
+	staleGaps, apiErr := api.parseStaleGapsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, apiErr = api.parseShardParam(ctx, r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	begin := time.Now()
+
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_instant_query")
 	defer span.Finish()
 
-	qry, err := api.queryEngine.NewInstantQuery(api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false), r.FormValue("query"), ts)
+	qry, err := api.queryEngine.NewInstantQuery(api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false, staleGaps), r.FormValue("query"), ts)
 	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 
 	res := qry.Exec(ctx)
+	api.logSlowQuery(r, ts, ts, 0, begin, res.Value)
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -321,34 +414,34 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 }
 
 func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
-	start, err := parseTime(r.FormValue("start"))
+	start, err := ParseTime(r.FormValue("start"))
 	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
-	end, err := parseTime(r.FormValue("end"))
+	end, err := ParseTime(r.FormValue("end"))
 	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 	if end.Before(start) {
 		err := errors.New("end timestamp must not be before start time")
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 
 	step, err := parseDuration(r.FormValue("step"))
 	if err != nil {
-		return nil, nil, &ApiError{errorBadData, errors.Wrap(err, "param step")}
+		return nil, nil, &ApiError{ErrorBadData, errors.Wrap(err, "param step")}
 	}
 
 	if step <= 0 {
 		err := errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 
 	// For safety, limit the number of returned points per timeseries.
 	// This is sufficient for 60s resolution for a week or 1h resolution for a year.
 	if end.Sub(start)/step > 11000 {
 		err := errors.New("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 
 	ctx := r.Context()
@@ -356,7 +449,7 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
 		var cancel context.CancelFunc
 		timeout, err := parseDuration(to)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 
 		ctx, cancel = context.WithTimeout(ctx, timeout)
@@ -384,22 +477,35 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, apiErr
 	}
 
+	staleGaps, apiErr := api.parseStaleGapsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, apiErr = api.parseShardParam(ctx, r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	begin := time.Now()
+
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_range_query")
 	defer span.Finish()
 
 	qry, err := api.queryEngine.NewRangeQuery(
-		api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false),
+		api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false, staleGaps),
 		r.FormValue("query"),
 		start,
 		end,
 		step,
 	)
 	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+		return nil, nil, &ApiError{ErrorBadData, err}
 	}
 
 	res := qry.Exec(ctx)
+	api.logSlowQuery(r, start, end, step, begin, res.Value)
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -421,7 +527,7 @@ func (api *API) labelValues(r *http.Request) (interface{}, []error, *ApiError) {
 	name := route.Param(ctx, "name")
 
 	if !model.LabelNameRE.MatchString(name) {
-		return nil, nil, &ApiError{errorBadData, errors.Errorf("invalid label name: %q", name)}
+		return nil, nil, &ApiError{ErrorBadData, errors.Errorf("invalid label name: %q", name)}
 	}
 
 	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
@@ -429,7 +535,7 @@ func (api *API) labelValues(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, apiErr
 	}
 
-	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false).Querier(ctx, math.MinInt64, math.MaxInt64)
+	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false, false).Querier(ctx, math.MinInt64, math.MaxInt64)
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
 	}
@@ -456,15 +562,15 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 	}
 
 	if len(r.Form["match[]"]) == 0 {
-		return nil, nil, &ApiError{errorBadData, errors.New("no match[] parameter provided")}
+		return nil, nil, &ApiError{ErrorBadData, errors.New("no match[] parameter provided")}
 	}
 
 	var start time.Time
 	if t := r.FormValue("start"); t != "" {
 		var err error
-		start, err = parseTime(t)
+		start, err = ParseTime(t)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 	} else {
 		start = minTime
@@ -473,9 +579,9 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 	var end time.Time
 	if t := r.FormValue("end"); t != "" {
 		var err error
-		end, err = parseTime(t)
+		end, err = ParseTime(t)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 	} else {
 		end = maxTime
@@ -485,7 +591,7 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 	for _, s := range r.Form["match[]"] {
 		matchers, err := promql.ParseMetricSelector(s)
 		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
+			return nil, nil, &ApiError{ErrorBadData, err}
 		}
 		matcherSets = append(matcherSets, matchers)
 	}
@@ -505,7 +611,7 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, apiErr
 	}
 
-	q, err := api.queryableCreate(enableDedup, replicaLabels, math.MaxInt64, enablePartialResponse, true).
+	q, err := api.queryableCreate(enableDedup, replicaLabels, math.MaxInt64, enablePartialResponse, true, false).
 		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
@@ -559,8 +665,10 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 
 	var code int
 	switch apiErr.Typ {
-	case errorBadData:
+	case ErrorBadData:
 		code = http.StatusBadRequest
+	case ErrorNotFound:
+		code = http.StatusNotFound
 	case errorExec:
 		code = 422
 	case errorCanceled, errorTimeout:
@@ -580,7 +688,8 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 	})
 }
 
-func parseTime(s string) (time.Time, error) {
+// ParseTime parses a unix timestamp in seconds, possibly fractional, or an RFC 3339 timestamp.
+func ParseTime(s string) (time.Time, error) {
 	if t, err := strconv.ParseFloat(s, 64); err == nil {
 		s, ns := math.Modf(t)
 		return time.Unix(int64(s), int64(ns*float64(time.Second))), nil
@@ -613,7 +722,7 @@ func (api *API) labelNames(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, apiErr
 	}
 
-	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false).Querier(ctx, math.MinInt64, math.MaxInt64)
+	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false, false).Querier(ctx, math.MinInt64, math.MaxInt64)
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
 	}
@@ -626,3 +735,100 @@ func (api *API) labelNames(r *http.Request) (interface{}, []error, *ApiError) {
 
 	return names, warnings, nil
 }
+
+// duplicateSeries reports series that are returned by more than one store after removing replica labels.
+func (api *API) duplicateSeries(r *http.Request) (interface{}, []error, *ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &ApiError{ErrorInternal, errors.Wrap(err, "parse form")}
+	}
+
+	if len(r.Form["match[]"]) == 0 {
+		return nil, nil, &ApiError{ErrorBadData, errors.New("no match[] parameter provided")}
+	}
+
+	start, end := minTime, maxTime
+	if t := r.FormValue("start"); t != "" {
+		var err error
+		start, err = ParseTime(t)
+		if err != nil {
+			return nil, nil, &ApiError{ErrorBadData, err}
+		}
+	}
+	if t := r.FormValue("end"); t != "" {
+		var err error
+		end, err = ParseTime(t)
+		if err != nil {
+			return nil, nil, &ApiError{ErrorBadData, err}
+		}
+	}
+	if end.Before(start) {
+		return nil, nil, &ApiError{ErrorBadData, errors.New("end timestamp must not be before start time")}
+	}
+
+	replicaLabels, apiErr := api.parseReplicaLabelsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	var stores []store.Client
+	if api.stores != nil {
+		stores = api.stores()
+	}
+
+	var (
+		warnings []error
+		res      = []query.DuplicateSeries{}
+	)
+	for _, s := range r.Form["match[]"] {
+		matchers, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			return nil, nil, &ApiError{ErrorBadData, err}
+		}
+
+		dups, warns, err := query.FindDuplicateSeries(r.Context(), stores, timestamp.FromTime(start), timestamp.FromTime(end), replicaLabels, matchers...)
+		if err != nil {
+			return nil, nil, &ApiError{errorExec, err}
+		}
+		warnings = append(warnings, warns...)
+		res = append(res, dups...)
+	}
+	return res, warnings, nil
+}
+
+// storeStatus is the status of a store API server of the querier, as returned by the stores endpoint.
+type storeStatus struct {
+	Name      string             `json:"name"`
+	LastCheck time.Time          `json:"lastCheck"`
+	LastError string             `json:"lastError,omitempty"`
+	LabelSets []storepb.LabelSet `json:"labelSets"`
+	MinTime   int64              `json:"minTime"`
+	MaxTime   int64              `json:"maxTime"`
+}
+
+// storesStatus returns the statuses of store API servers known to the querier, grouped by their type, so that it can
+// be checked which stores are used by queries. Stores whose last health check failed have the error of the check.
+func (api *API) storesStatus(_ *http.Request) (interface{}, []error, *ApiError) {
+	res := map[string][]storeStatus{}
+	if api.storeStatuses == nil {
+		return res, nil, nil
+	}
+
+	for _, s := range api.storeStatuses() {
+		storeType := "unknown"
+		if s.StoreType != nil {
+			storeType = s.StoreType.String()
+		}
+		status := storeStatus{
+			Name:      s.Name,
+			LastCheck: s.LastCheck,
+			LabelSets: s.LabelSets,
+			MinTime:   s.MinTime,
+			MaxTime:   s.MaxTime,
+		}
+		if s.LastError != nil {
+			status.LastError = s.LastError.Error()
+		}
+		res[storeType] = append(res[storeType], status)
+	}
+	return res, nil, nil
+}
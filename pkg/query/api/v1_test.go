@@ -44,6 +44,7 @@ import (
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
@@ -101,7 +102,7 @@ func TestEndpoints(t *testing.T) {
 
 	now := time.Now()
 	api := &API{
-		queryableCreate: query.NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, nil)),
+		queryableCreate: query.NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), false),
 		queryEngine: promql.NewEngine(promql.EngineOpts{
 			Logger:        nil,
 			Reg:           nil,
@@ -389,7 +390,7 @@ func TestEndpoints(t *testing.T) {
 				"query": []string{"0.333"},
 				"dedup": []string{"sdfsf"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.queryRange,
@@ -421,7 +422,7 @@ func TestEndpoints(t *testing.T) {
 				"end":   []string{"2"},
 				"step":  []string{"1"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.queryRange,
@@ -430,7 +431,7 @@ func TestEndpoints(t *testing.T) {
 				"start": []string{"0"},
 				"step":  []string{"1"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.queryRange,
@@ -439,7 +440,7 @@ func TestEndpoints(t *testing.T) {
 				"start": []string{"0"},
 				"end":   []string{"2"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		// Bad query expression.
 		{
@@ -448,7 +449,7 @@ func TestEndpoints(t *testing.T) {
 				"query": []string{"invalid][query"},
 				"time":  []string{"1970-01-01T01:02:03+01:00"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.queryRange,
@@ -458,7 +459,7 @@ func TestEndpoints(t *testing.T) {
 				"end":   []string{"100"},
 				"step":  []string{"1"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		// Invalid step.
 		{
@@ -469,7 +470,7 @@ func TestEndpoints(t *testing.T) {
 				"end":   []string{"2"},
 				"step":  []string{"0"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		// Start after end.
 		{
@@ -480,7 +481,7 @@ func TestEndpoints(t *testing.T) {
 				"end":   []string{"1"},
 				"step":  []string{"1"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		// Start overflows int64 internally.
 		{
@@ -491,7 +492,7 @@ func TestEndpoints(t *testing.T) {
 				"end":   []string{"1489667272.372"},
 				"step":  []string{"1"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		// Bad dedup parameter.
 		{
@@ -503,7 +504,7 @@ func TestEndpoints(t *testing.T) {
 				"step":  []string{"1"},
 				"dedup": []string{"sdfsf-range"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.labelValues,
@@ -532,7 +533,7 @@ func TestEndpoints(t *testing.T) {
 			params: map[string]string{
 				"name": "not!!!allowed",
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.series,
@@ -649,7 +650,7 @@ func TestEndpoints(t *testing.T) {
 		// Missing match[] query params in series requests.
 		{
 			endpoint: api.series,
-			errType:  errorBadData,
+			errType:  ErrorBadData,
 		},
 		{
 			endpoint: api.series,
@@ -657,7 +658,7 @@ func TestEndpoints(t *testing.T) {
 				"match[]": []string{`test_metric2`},
 				"dedup":   []string{"sdfsf-series"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 		},
 		{
 			endpoint: api.series,
@@ -774,7 +775,7 @@ func TestEndpoints(t *testing.T) {
 		// Missing match[] query params in series requests.
 		{
 			endpoint: api.series,
-			errType:  errorBadData,
+			errType:  ErrorBadData,
 			method:   http.MethodPost,
 		},
 		{
@@ -783,7 +784,7 @@ func TestEndpoints(t *testing.T) {
 				"match[]": []string{`test_metric2`},
 				"dedup":   []string{"sdfsf-series"},
 			},
-			errType: errorBadData,
+			errType: ErrorBadData,
 			method:  http.MethodPost,
 		},
 	}
@@ -952,7 +953,7 @@ func TestParseTime(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		ts, err := parseTime(test.input)
+		ts, err := ParseTime(test.input)
 		if err != nil && !test.fail {
 			t.Errorf("Unexpected error for %q: %s", test.input, err)
 			continue
@@ -1050,6 +1051,45 @@ func TestOptionsMethod(t *testing.T) {
 	}
 }
 
+func TestStoresEndpoint(t *testing.T) {
+	lastCheck := time.Unix(100, 0)
+	api := &API{
+		storeStatuses: func() []query.StoreStatus {
+			return []query.StoreStatus{
+				{
+					Name:      "sidecar:10901",
+					LastCheck: lastCheck,
+					LabelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "replica", Value: "a"}}}},
+					StoreType: component.Sidecar,
+					MinTime:   1000,
+					MaxTime:   2000,
+				},
+				{
+					Name:      "store:10901",
+					LastError: errors.New("connection refused"),
+				},
+			}
+		},
+	}
+
+	res, warnings, apiErr := api.storesStatus(nil)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Equals(t, 0, len(warnings))
+	testutil.Equals(t, map[string][]storeStatus{
+		"sidecar": {{
+			Name:      "sidecar:10901",
+			LastCheck: lastCheck,
+			LabelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "replica", Value: "a"}}}},
+			MinTime:   1000,
+			MaxTime:   2000,
+		}},
+		"unknown": {{
+			Name:      "store:10901",
+			LastError: "connection refused",
+		}},
+	}, res)
+}
+
 func BenchmarkQueryResultEncoding(b *testing.B) {
 	var mat promql.Matrix
 	for i := 0; i < 1000; i++ {
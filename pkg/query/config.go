@@ -5,12 +5,14 @@ package query
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	http_util "github.com/thanos-io/thanos/pkg/http"
 )
 
@@ -46,6 +48,8 @@ func LoadConfigs(confYAML []byte) ([]Config, error) {
 }
 
 // BuildQueryConfig returns a query client configuration from a static address.
+// The scheme may be prefixed with 'dns+' or 'dnssrv+', e.g. 'dnssrv+https://_http._tcp.querier', to discover query
+// API servers through respective DNS lookups. Addresses without scheme default to http, e.g. 'dns+querier:9090'.
 func BuildQueryConfig(queryAddrs []string) ([]Config, error) {
 	configs := make([]Config, 0, len(queryAddrs))
 	for i, addr := range queryAddrs {
@@ -60,13 +64,29 @@ func BuildQueryConfig(queryAddrs []string) ([]Config, error) {
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to parse addr %q", addr)
 		}
-		if u.Scheme != "http" && u.Scheme != "https" {
+
+		scheme, host := u.Scheme, u.Host
+		for _, qType := range []dns.QType{dns.A, dns.SRV, dns.SRVNoA} {
+			prefix := string(qType) + "+"
+			if strings.HasPrefix(strings.ToLower(scheme), prefix) {
+				// Scheme is of the form "<dns type>+<http scheme>".
+				scheme = strings.TrimPrefix(strings.ToLower(scheme), prefix)
+				host = prefix + u.Host
+				break
+			}
+		}
+		if scheme != "http" && scheme != "https" {
 			return nil, errors.Errorf("%q is not supported scheme for querier address", u.Scheme)
 		}
+		if qType, name := dns.GetQTypeName(host); qType == string(dns.A) {
+			if _, _, err := net.SplitHostPort(name); err != nil {
+				return nil, errors.Wrapf(err, "missing port in querier address %q, required for %s lookups", addr, qType)
+			}
+		}
 		configs = append(configs, Config{
 			EndpointsConfig: http_util.EndpointsConfig{
-				Scheme:          u.Scheme,
-				StaticAddresses: []string{u.Host},
+				Scheme:          scheme,
+				StaticAddresses: []string{host},
 				PathPrefix:      u.Path,
 			},
 		})
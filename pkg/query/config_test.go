@@ -66,6 +66,47 @@ func TestBuildQueryConfig(t *testing.T) {
 				},
 			}},
 		},
+		{
+			desc:      "dns lookup without scheme",
+			addresses: []string{"dns+querier:9090"},
+			expected: []Config{{
+				EndpointsConfig: http.EndpointsConfig{
+					StaticAddresses: []string{"dns+querier:9090"},
+					Scheme:          "http",
+				},
+			}},
+		},
+		{
+			desc:      "dns lookup with scheme and path",
+			addresses: []string{"dns+https://querier:9090/prefix"},
+			expected: []Config{{
+				EndpointsConfig: http.EndpointsConfig{
+					StaticAddresses: []string{"dns+querier:9090"},
+					Scheme:          "https",
+					PathPrefix:      "/prefix",
+				},
+			}},
+		},
+		{
+			desc:      "dnssrv lookup with scheme",
+			addresses: []string{"dnssrv+http://_http._tcp.querier"},
+			expected: []Config{{
+				EndpointsConfig: http.EndpointsConfig{
+					StaticAddresses: []string{"dnssrv+_http._tcp.querier"},
+					Scheme:          "http",
+				},
+			}},
+		},
+		{
+			desc:      "dns lookup without port",
+			addresses: []string{"dns+http://querier"},
+			err:       true,
+		},
+		{
+			desc:      "dns lookup with not supported scheme",
+			addresses: []string{"dns+ttp://querier:9090"},
+			err:       true,
+		},
 		{
 			desc:      "not supported scheme",
 			addresses: []string{"ttp://localhost:9093"},
@@ -0,0 +1,239 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// DuplicateSeries is a series (after removing replica labels) returned by more than one store.
+type DuplicateSeries struct {
+	Labels   labels.Labels   `json:"labels"`
+	Sources  []SeriesSource  `json:"sources"`
+	Overlaps []SeriesOverlap `json:"overlaps"`
+}
+
+// SeriesSource describes data of a series returned by a single store.
+type SeriesSource struct {
+	Store string `json:"store"`
+	// Labels as returned by the store, including replica labels.
+	Labels  labels.Labels `json:"labels"`
+	MinTime int64         `json:"minTime"`
+	MaxTime int64         `json:"maxTime"`
+}
+
+// SeriesOverlap describes for how long two stores returned data for the same series.
+type SeriesOverlap struct {
+	StoreA string `json:"storeA"`
+	StoreB string `json:"storeB"`
+	// Millis is the total overlap of chunks time ranges in milliseconds.
+	Millis int64 `json:"overlapMillis"`
+}
+
+type interval struct{ mint, maxt int64 }
+
+type storeSeries struct {
+	store     string
+	lset      labels.Labels
+	intervals []interval
+}
+
+// FindDuplicateSeries queries all given stores for series matching the matchers within the given time range and returns
+// series that were returned by more than one store, after removing the replica labels. Series are sorted by labels.
+// It is meant as a diagnostic tool e.g to spot blocks being uploaded twice. Failures of individual stores are returned
+// as warnings.
+func FindDuplicateSeries(
+	ctx context.Context,
+	stores []store.Client,
+	mint, maxt int64,
+	replicaLabels []string,
+	matchers ...*labels.Matcher,
+) ([]DuplicateSeries, []error, error) {
+	sms, err := translateMatchers(matchers...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "convert matchers")
+	}
+	replicas := make(map[string]struct{}, len(replicaLabels))
+	for _, l := range replicaLabels {
+		replicas[l] = struct{}{}
+	}
+
+	var (
+		mtx      sync.Mutex
+		wg       sync.WaitGroup
+		warnings []error
+		bySeries = map[string][]storeSeries{}
+		keyLsets = map[string]labels.Labels{}
+	)
+	for _, st := range stores {
+		storeMint, storeMaxt := st.TimeRange()
+		if mint > storeMaxt || maxt < storeMint {
+			continue
+		}
+
+		wg.Add(1)
+		go func(st store.Client) {
+			defer wg.Done()
+
+			series, err := fetchStoreSeries(ctx, st, &storepb.SeriesRequest{
+				MinTime:                 mint,
+				MaxTime:                 maxt,
+				Matchers:                sms,
+				Aggregates:              []storepb.Aggr{storepb.Aggr_RAW},
+				PartialResponseDisabled: true,
+			})
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			if err != nil {
+				warnings = append(warnings, errors.Wrapf(err, "fetch series from store %s", st.Addr()))
+				return
+			}
+			for _, s := range series {
+				dedupLset := withoutLabels(s.lset, replicas)
+				key := dedupLset.String()
+				keyLsets[key] = dedupLset
+				bySeries[key] = append(bySeries[key], s)
+			}
+		}(st)
+	}
+	wg.Wait()
+
+	var res []DuplicateSeries
+	for key, ss := range bySeries {
+		sort.Slice(ss, func(i, j int) bool {
+			if ss[i].store != ss[j].store {
+				return ss[i].store < ss[j].store
+			}
+			return labels.Compare(ss[i].lset, ss[j].lset) < 0
+		})
+		// A single store can return the series of several replicas, e.g. a store gateway. This is expected.
+		if ss[0].store == ss[len(ss)-1].store {
+			continue
+		}
+
+		d := DuplicateSeries{Labels: keyLsets[key]}
+		for i, a := range ss {
+			d.Sources = append(d.Sources, SeriesSource{
+				Store:   a.store,
+				Labels:  a.lset,
+				MinTime: a.intervals[0].mint,
+				MaxTime: a.intervals[len(a.intervals)-1].maxt,
+			})
+			for _, b := range ss[i+1:] {
+				if a.store == b.store {
+					continue
+				}
+				d.Overlaps = append(d.Overlaps, SeriesOverlap{
+					StoreA: a.store,
+					StoreB: b.store,
+					Millis: overlapMillis(a.intervals, b.intervals),
+				})
+			}
+		}
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return labels.Compare(res[i].Labels, res[j].Labels) < 0 })
+	return res, warnings, nil
+}
+
+// fetchStoreSeries returns series from the given store with merged time ranges of their chunks.
+func fetchStoreSeries(ctx context.Context, st store.Client, req *storepb.SeriesRequest) ([]storeSeries, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc, err := st.Series(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []storeSeries
+	for {
+		resp, err := sc.Recv()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if w := resp.GetWarning(); w != "" {
+			return nil, errors.New(w)
+		}
+		s := resp.GetSeries()
+		if s == nil || len(s.Chunks) == 0 {
+			continue
+		}
+
+		intervals := make([]interval, 0, len(s.Chunks))
+		for _, c := range s.Chunks {
+			intervals = append(intervals, interval{mint: c.MinTime, maxt: c.MaxTime})
+		}
+		res = append(res, storeSeries{
+			store:     st.Addr(),
+			lset:      storepb.LabelsToPromLabels(s.Labels),
+			intervals: mergeIntervals(intervals),
+		})
+	}
+}
+
+func withoutLabels(lset labels.Labels, names map[string]struct{}) labels.Labels {
+	res := make(labels.Labels, 0, len(lset))
+	for _, l := range lset {
+		if _, ok := names[l.Name]; ok {
+			continue
+		}
+		res = append(res, l)
+	}
+	return res
+}
+
+// mergeIntervals sorts and merges overlapping or adjacent intervals.
+func mergeIntervals(in []interval) []interval {
+	sort.Slice(in, func(i, j int) bool { return in[i].mint < in[j].mint })
+
+	res := in[:1]
+	for _, iv := range in[1:] {
+		last := &res[len(res)-1]
+		if iv.mint <= last.maxt+1 {
+			if iv.maxt > last.maxt {
+				last.maxt = iv.maxt
+			}
+			continue
+		}
+		res = append(res, iv)
+	}
+	return res
+}
+
+// overlapMillis returns the total length of intersection of two sorted and merged interval lists.
+func overlapMillis(a, b []interval) int64 {
+	var total int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		mint, maxt := a[i].mint, a[i].maxt
+		if b[j].mint > mint {
+			mint = b[j].mint
+		}
+		if b[j].maxt < maxt {
+			maxt = b[j].maxt
+		}
+		if maxt > mint {
+			total += maxt - mint
+		}
+		if a[i].maxt < b[j].maxt {
+			i++
+		} else {
+			j++
+		}
+	}
+	return total
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
+)
+
+type seriesStoreClient struct {
+	storepb.StoreClient
+
+	addr   string
+	series []storepb.Series
+	err    error
+}
+
+func (c *seriesStoreClient) Series(ctx context.Context, _ *storepb.SeriesRequest, _ ...grpc.CallOption) (storepb.Store_SeriesClient, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &seriesRecvClient{series: c.series}, nil
+}
+
+func (c *seriesStoreClient) LabelSets() []storepb.LabelSet { return nil }
+func (c *seriesStoreClient) TimeRange() (int64, int64)     { return math.MinInt64, math.MaxInt64 }
+func (c *seriesStoreClient) String() string                { return c.addr }
+func (c *seriesStoreClient) Addr() string                  { return c.addr }
+
+type seriesRecvClient struct {
+	storepb.Store_SeriesClient
+
+	series []storepb.Series
+	i      int
+}
+
+func (c *seriesRecvClient) Recv() (*storepb.SeriesResponse, error) {
+	if c.i >= len(c.series) {
+		return nil, io.EOF
+	}
+	s := c.series[c.i]
+	c.i++
+	return storepb.NewSeriesResponse(&s), nil
+}
+
+func testSeries(lset labels.Labels, ranges ...[2]int64) storepb.Series {
+	s := storepb.Series{Labels: storepb.PromLabelsToLabels(lset)}
+	for _, r := range ranges {
+		s.Chunks = append(s.Chunks, storepb.AggrChunk{MinTime: r[0], MaxTime: r[1]})
+	}
+	return s
+}
+
+func TestFindDuplicateSeries(t *testing.T) {
+	stores := []store.Client{
+		&seriesStoreClient{addr: "sidecar-1", series: []storepb.Series{
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "a", "replica", "1"), [2]int64{0, 100}, [2]int64{101, 200}),
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "b", "replica", "1"), [2]int64{0, 100}),
+		}},
+		&seriesStoreClient{addr: "sidecar-2", series: []storepb.Series{
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "a", "replica", "2"), [2]int64{150, 300}),
+		}},
+		&seriesStoreClient{addr: "store", series: []storepb.Series{
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "a", "replica", "1"), [2]int64{0, 50}, [2]int64{180, 190}),
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "a", "replica", "2"), [2]int64{0, 50}),
+			// Replicas of a series only returned by one store are not duplicates.
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "c", "replica", "1"), [2]int64{0, 50}),
+			testSeries(labels.FromStrings("__name__", "up", "cluster", "c", "replica", "2"), [2]int64{0, 50}),
+		}},
+		&seriesStoreClient{addr: "broken", err: errors.New("unavailable")},
+	}
+
+	dups, warns, err := FindDuplicateSeries(context.Background(), stores, 0, 300, []string{"replica"}, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(warns))
+	testutil.Equals(t, []DuplicateSeries{
+		{
+			Labels: labels.FromStrings("__name__", "up", "cluster", "a"),
+			Sources: []SeriesSource{
+				{Store: "sidecar-1", Labels: labels.FromStrings("__name__", "up", "cluster", "a", "replica", "1"), MinTime: 0, MaxTime: 200},
+				{Store: "sidecar-2", Labels: labels.FromStrings("__name__", "up", "cluster", "a", "replica", "2"), MinTime: 150, MaxTime: 300},
+				{Store: "store", Labels: labels.FromStrings("__name__", "up", "cluster", "a", "replica", "1"), MinTime: 0, MaxTime: 190},
+				{Store: "store", Labels: labels.FromStrings("__name__", "up", "cluster", "a", "replica", "2"), MinTime: 0, MaxTime: 50},
+			},
+			Overlaps: []SeriesOverlap{
+				{StoreA: "sidecar-1", StoreB: "sidecar-2", Millis: 50},
+				{StoreA: "sidecar-1", StoreB: "store", Millis: 60},
+				{StoreA: "sidecar-1", StoreB: "store", Millis: 50},
+				{StoreA: "sidecar-2", StoreB: "store", Millis: 10},
+				{StoreA: "sidecar-2", StoreB: "store", Millis: 0},
+			},
+		},
+	}, dups)
+}
+
+func TestOverlapMillis(t *testing.T) {
+	for _, tcase := range []struct {
+		a, b     []interval
+		expected int64
+	}{
+		{a: []interval{{0, 10}}, b: []interval{{20, 30}}, expected: 0},
+		{a: []interval{{0, 10}}, b: []interval{{5, 30}}, expected: 5},
+		{a: []interval{{0, 10}, {20, 30}}, b: []interval{{5, 25}}, expected: 10},
+		{a: []interval{{0, 100}}, b: []interval{{10, 20}, {30, 40}}, expected: 20},
+	} {
+		testutil.Equals(t, tcase.expected, overlapMillis(tcase.a, tcase.b))
+		testutil.Equals(t, tcase.expected, overlapMillis(tcase.b, tcase.a))
+	}
+}
@@ -9,9 +9,11 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -25,6 +27,9 @@ type promSeriesSet struct {
 	mint, maxt int64
 	aggr       resAggr
 
+	// onCorruptChunk, if not nil, makes iterators skip chunks that fail to decode or iterate and report them here.
+	onCorruptChunk func(lset labels.Labels, err error)
+
 	currLset   []storepb.Label
 	currChunks []storepb.AggrChunk
 }
@@ -59,7 +64,9 @@ func (s *promSeriesSet) At() storage.Series {
 	if !s.initiated || s.set.Err() != nil {
 		return nil
 	}
-	return newChunkSeries(s.currLset, s.currChunks, s.mint, s.maxt, s.aggr)
+	cs := newChunkSeries(s.currLset, s.currChunks, s.mint, s.maxt, s.aggr)
+	cs.onCorruptChunk = s.onCorruptChunk
+	return cs
 }
 
 func (s *promSeriesSet) Err() error {
@@ -129,6 +136,8 @@ type chunkSeries struct {
 	chunks     []storepb.AggrChunk
 	mint, maxt int64
 	aggr       resAggr
+
+	onCorruptChunk func(lset labels.Labels, err error)
 }
 
 func newChunkSeries(lset []storepb.Label, chunks []storepb.AggrChunk, mint, maxt int64, aggr resAggr) *chunkSeries {
@@ -151,55 +160,95 @@ func (s *chunkSeries) Labels() labels.Labels {
 
 func (s *chunkSeries) Iterator() storage.SeriesIterator {
 	var sit storage.SeriesIterator
-	its := make([]chunkenc.Iterator, 0, len(s.chunks))
 
 	switch s.aggr {
 	case resAggrCount:
-		for _, c := range s.chunks {
-			its = append(its, getFirstIterator(c.Count, c.Raw))
-		}
-		sit = newChunkSeriesIterator(its)
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
+			return getFirstIterator(c.Count, c.Raw)
+		})
 	case resAggrSum:
-		for _, c := range s.chunks {
-			its = append(its, getFirstIterator(c.Sum, c.Raw))
-		}
-		sit = newChunkSeriesIterator(its)
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
+			return getFirstIterator(c.Sum, c.Raw)
+		})
 	case resAggrMin:
-		for _, c := range s.chunks {
-			its = append(its, getFirstIterator(c.Min, c.Raw))
-		}
-		sit = newChunkSeriesIterator(its)
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
+			return getFirstIterator(c.Min, c.Raw)
+		})
 	case resAggrMax:
-		for _, c := range s.chunks {
-			its = append(its, getFirstIterator(c.Max, c.Raw))
-		}
-		sit = newChunkSeriesIterator(its)
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
+			return getFirstIterator(c.Max, c.Raw)
+		})
 	case resAggrCounter:
-		for _, c := range s.chunks {
-			its = append(its, getFirstIterator(c.Counter, c.Raw))
-		}
-		sit = downsample.NewCounterSeriesIterator(its...)
+		sit = downsample.NewCounterSeriesIterator(s.chunkIterators(func(c storepb.AggrChunk) chunkenc.Iterator {
+			return getFirstIterator(c.Counter, c.Raw)
+		})...)
 	case resAggrAvg:
-		for _, c := range s.chunks {
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
 			if c.Raw != nil {
-				its = append(its, getFirstIterator(c.Raw))
-			} else {
-				sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
-				its = append(its, downsample.NewAverageChunkIterator(cnt, sum))
+				return getFirstIterator(c.Raw)
 			}
-		}
-		sit = newChunkSeriesIterator(its)
+			sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
+			return downsample.NewAverageChunkIterator(cnt, sum)
+		})
+	case resAggrSketch:
+		sit = s.newChunkSeriesIterator(func(c storepb.AggrChunk) chunkenc.Iterator {
+			if c.Raw != nil || c.Sketch != nil {
+				return getFirstIterator(c.Sketch, c.Raw)
+			}
+			// Without sketches, the average of every window is the best we have.
+			sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
+			return downsample.NewAverageChunkIterator(cnt, sum)
+		})
 	default:
 		return errSeriesIterator{err: errors.Errorf("unexpected result aggregate type %v", s.aggr)}
 	}
 	return newBoundedSeriesIterator(sit, s.mint, s.maxt)
 }
 
+// chunkIterators returns iterators created by f for all chunks of the series.
+func (s *chunkSeries) chunkIterators(f func(c storepb.AggrChunk) chunkenc.Iterator) []chunkenc.Iterator {
+	its := make([]chunkenc.Iterator, 0, len(s.chunks))
+	for i, c := range s.chunks {
+		its = append(its, chunkIterator{Iterator: f(c), i: i, mint: c.MinTime, maxt: c.MaxTime})
+	}
+	return its
+}
+
+func (s *chunkSeries) newChunkSeriesIterator(f func(c storepb.AggrChunk) chunkenc.Iterator) storage.SeriesIterator {
+	var onSkip func(error)
+	if s.onCorruptChunk != nil {
+		onSkip = func(err error) { s.onCorruptChunk(s.lset, err) }
+	}
+	return newChunkSeriesIterator(s.chunkIterators(f), onSkip)
+}
+
+// chunkIterator annotates errors of a chunk iterator with the chunk position and time range.
+type chunkIterator struct {
+	chunkenc.Iterator
+
+	i          int
+	mint, maxt int64
+}
+
+func (it chunkIterator) Err() error {
+	if err := it.Iterator.Err(); err != nil {
+		return errors.Wrapf(err, "chunk %d [%d, %d]", it.i, it.mint, it.maxt)
+	}
+	return nil
+}
+
 func getFirstIterator(cs ...*storepb.Chunk) chunkenc.Iterator {
 	for _, c := range cs {
 		if c == nil {
 			continue
 		}
+		if c.Type == storepb.Chunk_SKETCH {
+			chk, err := downsample.SketchChunkFromData(c.Data)
+			if err != nil {
+				return errSeriesIterator{err}
+			}
+			return chk.Iterator(nil)
+		}
 		chk, err := chunkenc.FromData(chunkEncoding(c.Type), c.Data)
 		if err != nil {
 			return errSeriesIterator{err}
@@ -274,33 +323,40 @@ func (it *boundedSeriesIterator) Err() error {
 
 // chunkSeriesIterator implements a series iterator on top
 // of a list of time-sorted, non-overlapping chunks.
+// Iteration stops on the first chunk that fails, unless onSkip is set. In that case failed chunks are
+// reported to onSkip and skipped.
 type chunkSeriesIterator struct {
 	chunks []chunkenc.Iterator
 	i      int
+
+	// lastT is the timestamp of the last returned sample.
+	lastT  int64
+	onSkip func(error)
+	err    error
 }
 
-func newChunkSeriesIterator(cs []chunkenc.Iterator) storage.SeriesIterator {
+func newChunkSeriesIterator(cs []chunkenc.Iterator, onSkip func(error)) storage.SeriesIterator {
 	if len(cs) == 0 {
 		// This should not happen. StoreAPI implementations should not send empty results.
 		// NOTE(bplotka): Metric, err log here?
 		return errSeriesIterator{}
 	}
-	return &chunkSeriesIterator{chunks: cs}
+	return &chunkSeriesIterator{chunks: cs, lastT: math.MinInt64, onSkip: onSkip}
 }
 
 func (it *chunkSeriesIterator) Seek(t int64) (ok bool) {
 	// We generally expect the chunks already to be cut down
 	// to the range we are interested in. There's not much to be gained from
 	// hopping across chunks so we just call next until we reach t.
-	for {
-		ct, _ := it.At()
-		if ct >= t {
+	if it.lastT != math.MinInt64 && it.lastT >= t {
+		return true
+	}
+	for it.Next() {
+		if it.lastT >= t {
 			return true
 		}
-		if !it.Next() {
-			return false
-		}
 	}
+	return false
 }
 
 func (it *chunkSeriesIterator) At() (t int64, v float64) {
@@ -308,30 +364,45 @@ func (it *chunkSeriesIterator) At() (t int64, v float64) {
 }
 
 func (it *chunkSeriesIterator) Next() bool {
-	lastT, _ := it.At()
-
-	if it.chunks[it.i].Next() {
-		return true
-	}
-	if it.Err() != nil {
+	if it.err != nil {
 		return false
 	}
-	if it.i >= len(it.chunks)-1 {
-		return false
+
+	for {
+		if it.chunks[it.i].Next() {
+			t, _ := it.chunks[it.i].At()
+			// Chunks are guaranteed to be ordered but not generally guaranteed to not overlap.
+			// We must ensure to skip any overlapping range between adjacent chunks.
+			if t <= it.lastT {
+				continue
+			}
+			it.lastT = t
+			return true
+		}
+
+		if err := it.chunks[it.i].Err(); err != nil {
+			if it.onSkip == nil {
+				it.err = err
+				return false
+			}
+			it.onSkip(err)
+		}
+		if it.i >= len(it.chunks)-1 {
+			return false
+		}
+		it.i++
 	}
-	// Chunks are guaranteed to be ordered but not generally guaranteed to not overlap.
-	// We must ensure to skip any overlapping range between adjacent chunks.
-	it.i++
-	return it.Seek(lastT + 1)
 }
 
 func (it *chunkSeriesIterator) Err() error {
-	return it.chunks[it.i].Err()
+	return it.err
 }
 
 type dedupSeriesSet struct {
 	set           storage.SeriesSet
 	replicaLabels map[string]struct{}
+	staleGaps     bool
+	counter       bool
 
 	replicas []storage.Series
 	lset     labels.Labels
@@ -339,8 +410,12 @@ type dedupSeriesSet struct {
 	ok       bool
 }
 
-func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}) storage.SeriesSet {
-	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels}
+// newDedupSeriesSet returns a series set deduplicating replicas of the same series along the replica labels.
+// If staleGaps is true, a staleness marker is inserted into every gap of the deduplicated series, so that
+// PromQL considers the series absent promptly instead of repeating the last value for the lookback delta.
+// If counter is true, the series are counters and the deduplicated series never decreases when switching replicas.
+func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, staleGaps, counter bool) storage.SeriesSet {
+	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels, staleGaps: staleGaps, counter: counter}
 	s.ok = s.set.Next()
 	if s.ok {
 		s.peek = s.set.At()
@@ -397,14 +472,20 @@ func (s *dedupSeriesSet) next() bool {
 }
 
 func (s *dedupSeriesSet) At() storage.Series {
+	var series storage.Series
 	if len(s.replicas) == 1 {
-		return seriesWithLabels{Series: s.replicas[0], lset: s.lset}
+		series = seriesWithLabels{Series: s.replicas[0], lset: s.lset}
+	} else {
+		// Clients may store the series, so we must make a copy of the slice
+		// before advancing.
+		repl := make([]storage.Series, len(s.replicas))
+		copy(repl, s.replicas)
+		series = dedup.NewSeries(s.lset, s.counter, repl...)
 	}
-	// Clients may store the series, so we must make a copy of the slice
-	// before advancing.
-	repl := make([]storage.Series, len(s.replicas))
-	copy(repl, s.replicas)
-	return newDedupSeries(s.lset, repl...)
+	if s.staleGaps {
+		return staleGapsSeries{Series: series}
+	}
+	return series
 }
 
 func (s *dedupSeriesSet) Err() error {
@@ -418,112 +499,60 @@ type seriesWithLabels struct {
 
 func (s seriesWithLabels) Labels() labels.Labels { return s.lset }
 
-type dedupSeries struct {
-	lset     labels.Labels
-	replicas []storage.Series
-}
-
-func newDedupSeries(lset labels.Labels, replicas ...storage.Series) *dedupSeries {
-	return &dedupSeries{lset: lset, replicas: replicas}
-}
-
-func (s *dedupSeries) Labels() labels.Labels {
-	return s.lset
+type staleGapsSeries struct {
+	storage.Series
 }
 
-func (s *dedupSeries) Iterator() (it storage.SeriesIterator) {
-	it = s.replicas[0].Iterator()
-	for _, o := range s.replicas[1:] {
-		it = newDedupSeriesIterator(it, o.Iterator())
-	}
-	return it
+func (s staleGapsSeries) Iterator() storage.SeriesIterator {
+	return newStaleGapsSeriesIterator(s.Series.Iterator())
 }
 
-type dedupSeriesIterator struct {
-	a, b storage.SeriesIterator
+// staleGapsSeriesIterator inserts a staleness marker into every gap of the underlying iterator.
+// A gap is a delta between two samples more than twice as long as the previous delta, the same
+// heuristic as the one used by dedup.NewSeriesIterator to skip samples of other replicas.
+// The marker is placed where the next sample was expected.
+type staleGapsSeriesIterator struct {
+	it storage.SeriesIterator
 
-	aok, bok   bool
-	lastT      int64
-	penA, penB int64
-	useA       bool
+	lastT, delta int64
+	// stale is true if the current sample is an inserted marker. The underlying
+	// iterator is already positioned at the sample after the gap.
+	stale bool
 }
 
-func newDedupSeriesIterator(a, b storage.SeriesIterator) *dedupSeriesIterator {
-	return &dedupSeriesIterator{
-		a:     a,
-		b:     b,
-		lastT: math.MinInt64,
-		aok:   true,
-		bok:   true,
-	}
+func newStaleGapsSeriesIterator(it storage.SeriesIterator) *staleGapsSeriesIterator {
+	return &staleGapsSeriesIterator{it: it, lastT: math.MinInt64}
 }
 
-func (it *dedupSeriesIterator) Next() bool {
-	// Advance both iterators to at least the next highest timestamp plus the potential penalty.
-	if it.aok {
-		it.aok = it.a.Seek(it.lastT + 1 + it.penA)
-	}
-	if it.bok {
-		it.bok = it.b.Seek(it.lastT + 1 + it.penB)
-	}
-	// Handle basic cases where one iterator is exhausted before the other.
-	if !it.aok {
-		it.useA = false
-		if it.bok {
-			it.lastT, _ = it.b.At()
-			it.penB = 0
-		}
-		return it.bok
-	}
-	if !it.bok {
-		it.useA = true
-		it.lastT, _ = it.a.At()
-		it.penA = 0
+func (it *staleGapsSeriesIterator) Next() bool {
+	if it.stale {
+		it.stale = false
+		it.lastT, _ = it.it.At()
+		// The sampling interval after the gap is not known yet.
+		it.delta = 0
 		return true
 	}
-	// General case where both iterators still have data. We pick the one
-	// with the smaller timestamp.
-	// The applied penalty potentially already skipped potential samples already
-	// that would have resulted in exaggerated sampling frequency.
-	ta, _ := it.a.At()
-	tb, _ := it.b.At()
-
-	it.useA = ta <= tb
-
-	// For the series we didn't pick, add a penalty twice as high as the delta of the last two
-	// samples to the next seek against it.
-	// This ensures that we don't pick a sample too close, which would increase the overall
-	// sample frequency. It also guards against clock drift and inaccuracies during
-	// timestamp assignment.
-	// If we don't know a delta yet, we pick 5000 as a constant, which is based on the knowledge
-	// that timestamps are in milliseconds and sampling frequencies typically multiple seconds long.
-	const initialPenality = 5000
-
-	if it.useA {
-		if it.lastT != math.MinInt64 {
-			it.penB = 2 * (ta - it.lastT)
-		} else {
-			it.penB = initialPenality
-		}
-		it.penA = 0
-		it.lastT = ta
+	if !it.it.Next() {
+		return false
+	}
+	t, _ := it.it.At()
+	if it.delta > 0 && t-it.lastT > 2*it.delta {
+		it.stale = true
 		return true
 	}
 	if it.lastT != math.MinInt64 {
-		it.penA = 2 * (tb - it.lastT)
-	} else {
-		it.penA = initialPenality
+		it.delta = t - it.lastT
 	}
-	it.penB = 0
-	it.lastT = tb
+	it.lastT = t
 	return true
 }
 
-func (it *dedupSeriesIterator) Seek(t int64) bool {
+func (it *staleGapsSeriesIterator) Seek(t int64) bool {
 	for {
-		ts, _ := it.At()
-		if ts > 0 && ts >= t {
-			return true
+		if it.lastT != math.MinInt64 {
+			if ts, _ := it.At(); ts >= t {
+				return true
+			}
 		}
 		if !it.Next() {
 			return false
@@ -531,16 +560,13 @@ func (it *dedupSeriesIterator) Seek(t int64) bool {
 	}
 }
 
-func (it *dedupSeriesIterator) At() (int64, float64) {
-	if it.useA {
-		return it.a.At()
+func (it *staleGapsSeriesIterator) At() (int64, float64) {
+	if it.stale {
+		return it.lastT + it.delta, math.Float64frombits(value.StaleNaN)
 	}
-	return it.b.At()
+	return it.it.At()
 }
 
-func (it *dedupSeriesIterator) Err() error {
-	if it.a.Err() != nil {
-		return it.a.Err()
-	}
-	return it.b.Err()
+func (it *staleGapsSeriesIterator) Err() error {
+	return it.it.Err()
 }
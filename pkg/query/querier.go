@@ -9,10 +9,12 @@ import (
 	"strings"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
@@ -23,19 +25,23 @@ import (
 // replicaLabels at query time.
 // maxResolutionMillis controls downsampling resolution that is allowed (specified in milliseconds).
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behaviour of proxy.
-type QueryableCreator func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable
+// staleGaps controls whether gaps in deduplicated series, where all replicas are missing, end with a staleness marker.
+type QueryableCreator func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks, staleGaps bool) storage.Queryable
 
 // NewQueryableCreator creates QueryableCreator.
-func NewQueryableCreator(logger log.Logger, proxy storepb.StoreServer) QueryableCreator {
-	return func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable {
+// If skipCorruptChunks is true, chunks that fail to decode are skipped and logged instead of failing the query.
+func NewQueryableCreator(logger log.Logger, proxy storepb.StoreServer, skipCorruptChunks bool) QueryableCreator {
+	return func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks, staleGaps bool) storage.Queryable {
 		return &queryable{
 			logger:              logger,
+			skipCorruptChunks:   skipCorruptChunks,
 			replicaLabels:       replicaLabels,
 			proxy:               proxy,
 			deduplicate:         deduplicate,
 			maxResolutionMillis: maxResolutionMillis,
 			partialResponse:     partialResponse,
 			skipChunks:          skipChunks,
+			staleGaps:           staleGaps,
 		}
 	}
 }
@@ -48,11 +54,13 @@ type queryable struct {
 	maxResolutionMillis int64
 	partialResponse     bool
 	skipChunks          bool
+	skipCorruptChunks   bool
+	staleGaps           bool
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.proxy, q.deduplicate, int64(q.maxResolutionMillis), q.partialResponse, q.skipChunks), nil
+	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.proxy, q.deduplicate, int64(q.maxResolutionMillis), q.partialResponse, q.skipChunks, q.skipCorruptChunks, q.staleGaps), nil
 }
 
 type querier struct {
@@ -66,6 +74,8 @@ type querier struct {
 	maxResolutionMillis int64
 	partialResponse     bool
 	skipChunks          bool
+	skipCorruptChunks   bool
+	staleGaps           bool
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -80,6 +90,8 @@ func newQuerier(
 	maxResolutionMillis int64,
 	partialResponse bool,
 	skipChunks bool,
+	skipCorruptChunks bool,
+	staleGaps bool,
 ) *querier {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -102,6 +114,8 @@ func newQuerier(
 		maxResolutionMillis: maxResolutionMillis,
 		partialResponse:     partialResponse,
 		skipChunks:          skipChunks,
+		skipCorruptChunks:   skipCorruptChunks,
+		staleGaps:           staleGaps,
 	}
 }
 
@@ -109,6 +123,16 @@ func (q *querier) isDedupEnabled() bool {
 	return q.deduplicate && len(q.replicaLabels) > 0
 }
 
+// onCorruptChunk returns function logging skipped corrupted chunks or nil if those should fail the query.
+func (q *querier) onCorruptChunk() func(labels.Labels, error) {
+	if !q.skipCorruptChunks {
+		return nil
+	}
+	return func(lset labels.Labels, err error) {
+		level.Warn(q.logger).Log("msg", "skipping corrupted chunk", "series", lset.String(), "err", err)
+	}
+}
+
 type seriesServer struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
 	storepb.Store_SeriesServer
@@ -146,6 +170,7 @@ const (
 	resAggrMin
 	resAggrMax
 	resAggrCounter
+	resAggrSketch
 )
 
 // aggrsFromFunc infers aggregates of the underlying data based on the wrapping
@@ -167,6 +192,10 @@ func aggrsFromFunc(f string) ([]storepb.Aggr, resAggr) {
 	if f == "increase" || f == "rate" {
 		return []storepb.Aggr{storepb.Aggr_COUNTER}, resAggrCounter
 	}
+	// Quantiles are approximated from sketches. Count and sum are used for blocks downsampled without sketches.
+	if f == "quantile_over_time" {
+		return []storepb.Aggr{storepb.Aggr_SKETCH, storepb.Aggr_COUNT, storepb.Aggr_SUM}, resAggrSketch
+	}
 	// In the default case, we retrieve count and sum to compute an average.
 	return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}, resAggrAvg
 }
@@ -197,8 +226,7 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 
 	queryAggrs, resAggr := aggrsFromFunc(params.Func)
 
-	resp := &seriesServer{ctx: ctx}
-	if err := q.proxy.Series(&storepb.SeriesRequest{
+	req := &storepb.SeriesRequest{
 		MinTime:                 params.Start,
 		MaxTime:                 params.End,
 		Matchers:                sms,
@@ -206,10 +234,22 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 		Aggregates:              queryAggrs,
 		PartialResponseDisabled: !q.partialResponse,
 		SkipChunks:              q.skipChunks,
-	}, resp); err != nil {
+	}
+	shard, sharded := querysharding.ShardFromContext(q.ctx)
+	if sharded {
+		req.ShardInfo = shard.Proto()
+	}
+
+	resp := &seriesServer{ctx: ctx}
+	if err := q.proxy.Series(req, resp); err != nil {
 		return nil, nil, errors.Wrap(err, "proxy Series()")
 	}
 
+	if sharded {
+		// Stores not supporting sharding return series of all shards.
+		resp.seriesSet = shardSeries(resp.seriesSet, shard)
+	}
+
 	var warns storage.Warnings
 	for _, w := range resp.warnings {
 		warns = append(warns, errors.New(w))
@@ -218,10 +258,11 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 	if !q.isDedupEnabled() {
 		// Return data without any deduplication.
 		return &promSeriesSet{
-			mint: q.mint,
-			maxt: q.maxt,
-			set:  newStoreSeriesSet(resp.seriesSet),
-			aggr: resAggr,
+			mint:           q.mint,
+			maxt:           q.maxt,
+			set:            newStoreSeriesSet(resp.seriesSet),
+			aggr:           resAggr,
+			onCorruptChunk: q.onCorruptChunk(),
 		}, warns, nil
 	}
 
@@ -230,16 +271,28 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 	sortDedupLabels(resp.seriesSet, q.replicaLabels)
 
 	set := &promSeriesSet{
-		mint: q.mint,
-		maxt: q.maxt,
-		set:  newStoreSeriesSet(resp.seriesSet),
-		aggr: resAggr,
+		mint:           q.mint,
+		maxt:           q.maxt,
+		set:            newStoreSeriesSet(resp.seriesSet),
+		aggr:           resAggr,
+		onCorruptChunk: q.onCorruptChunk(),
 	}
 
 	// The merged series set assembles all potentially-overlapping time ranges
 	// of the same series into a single one. The series are ordered so that equal series
 	// from different replicas are sequential. We can now deduplicate those.
-	return newDedupSeriesSet(set, q.replicaLabels), warns, nil
+	return newDedupSeriesSet(set, q.replicaLabels, q.staleGaps, resAggr == resAggrCounter), warns, nil
+}
+
+// shardSeries returns the series of the given set belonging to the given shard.
+func shardSeries(set []storepb.Series, shard querysharding.Shard) []storepb.Series {
+	res := set[:0]
+	for _, s := range set {
+		if shard.Matches(storepb.LabelsToPromLabelsUnsafe(s.Labels)) {
+			res = append(res, s)
+		}
+	}
+	return res
 }
 
 // sortDedupLabels re-sorts the set so that the same series with different replica
@@ -5,12 +5,10 @@ package query
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
 	"math"
-	"math/rand"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"time"
@@ -18,9 +16,11 @@ import (
 	"github.com/fortytw2/leaktest"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -28,10 +28,10 @@ import (
 func TestQueryableCreator_MaxResolution(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 	testProxy := &storeServer{resps: []*storepb.SeriesResponse{}}
-	queryableCreator := NewQueryableCreator(nil, testProxy)
+	queryableCreator := NewQueryableCreator(nil, testProxy, false)
 
 	oneHourMillis := int64(1*time.Hour) / int64(time.Millisecond)
-	queryable := queryableCreator(false, nil, oneHourMillis, false, false)
+	queryable := queryableCreator(false, nil, oneHourMillis, false, false, false)
 
 	q, err := queryable.Querier(context.Background(), 0, 42)
 	testutil.Ok(t, err)
@@ -58,7 +58,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 		},
 	}
 
-	q := NewQueryableCreator(nil, testProxy)(false, nil, 9999999, false, false)
+	q := NewQueryableCreator(nil, testProxy, false)(false, nil, 9999999, false, false, false)
 
 	engine := promql.NewEngine(
 		promql.EngineOpts{
@@ -179,7 +179,7 @@ func TestQuerier_Series(t *testing.T) {
 
 	// Querier clamps the range to [1,300], which should drop some samples of the result above.
 	// The store API allows endpoints to send more data then initially requested.
-	q := newQuerier(context.Background(), nil, 1, 300, []string{""}, testProxy, false, 0, true, false)
+	q := newQuerier(context.Background(), nil, 1, 300, []string{""}, testProxy, false, 0, true, false, false, false)
 	defer func() { testutil.Ok(t, q.Close()) }()
 
 	res, _, err := q.Select(&storage.SelectParams{})
@@ -220,6 +220,40 @@ func TestQuerier_Series(t *testing.T) {
 	testutil.Equals(t, len(expected), i)
 }
 
+func TestQuerier_Shard(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	var resps []*storepb.SeriesResponse
+	for _, pod := range []string{"a", "b", "c", "d", "e", "f"} {
+		resps = append(resps,
+			storeSeriesResponse(t, labels.FromStrings("container", "x", "pod", pod), []sample{{1, 1}}),
+			storeSeriesResponse(t, labels.FromStrings("container", "y", "pod", pod), []sample{{1, 1}}),
+		)
+	}
+
+	// Every series is in exactly one shard, together with all series of the same pod.
+	seen := map[string]int{}
+	for i := uint64(0); i < 3; i++ {
+		shard := querysharding.Shard{Index: i, Total: 3, By: []string{"pod"}}
+		ctx := querysharding.ContextWithShard(context.Background(), shard)
+		st := &storeServer{resps: resps}
+		q := newQuerier(ctx, nil, 0, 10, nil, st, false, 0, true, false, false, false)
+
+		// The store ignores the shard of the request, so the querier has to filter series itself.
+		res, _, err := q.Select(&storage.SelectParams{})
+		testutil.Ok(t, err)
+		testutil.Equals(t, shard.Proto(), st.req.ShardInfo)
+		for res.Next() {
+			lset := res.At().Labels()
+			testutil.Assert(t, shard.Matches(lset), "series %s not in shard %s", lset, shard)
+			seen[lset.Get("pod")]++
+		}
+		testutil.Ok(t, res.Err())
+		testutil.Ok(t, q.Close())
+	}
+	testutil.Equals(t, map[string]int{"a": 2, "b": 2, "c": 2, "d": 2, "e": 2, "f": 2}, seen)
+}
+
 func TestSortReplicaLabel(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -367,6 +401,42 @@ func expandSeries(t testing.TB, it storage.SeriesIterator) (res []sample) {
 	return res
 }
 
+func TestChunkSeries_CorruptChunks(t *testing.T) {
+	lset := labels.FromStrings("a", "1")
+	newSeries := func() *chunkSeries {
+		s := storeSeriesResponse(t, lset, []sample{{1, 1}, {2, 2}}, []sample{{3, 3}}, []sample{{5, 5}, {6, 6}}, []sample{{7, 7}}).GetSeries()
+		// Unknown encoding fails already when the chunk is decoded.
+		s.Chunks[1].Raw.Type = storepb.Chunk_Encoding(100)
+		// Missing samples fail during iteration.
+		s.Chunks[3].Raw.Data = []byte{0, 1}
+		return newChunkSeries(s.Labels, s.Chunks, math.MinInt64, math.MaxInt64, resAggrAvg)
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		it := newSeries().Iterator()
+		var res []sample
+		for it.Next() {
+			t, v := it.At()
+			res = append(res, sample{t, v})
+		}
+		testutil.Equals(t, []sample{{1, 1}, {2, 2}}, res)
+		testutil.NotOk(t, it.Err())
+		testutil.Assert(t, strings.HasPrefix(it.Err().Error(), "chunk 1 [3, 3]: "), "unexpected error %v", it.Err())
+	})
+	t.Run("skip", func(t *testing.T) {
+		s := newSeries()
+		var skipped []string
+		s.onCorruptChunk = func(l labels.Labels, err error) {
+			testutil.Equals(t, lset, l)
+			skipped = append(skipped, err.Error())
+		}
+		testutil.Equals(t, []sample{{1, 1}, {2, 2}, {5, 5}, {6, 6}}, expandSeries(t, s.Iterator()))
+		testutil.Equals(t, 2, len(skipped))
+		testutil.Assert(t, strings.HasPrefix(skipped[0], "chunk 1 [3, 3]: "), "unexpected error %v", skipped[0])
+		testutil.Assert(t, strings.HasPrefix(skipped[1], "chunk 3 [7, 7]: "), "unexpected error %v", skipped[1])
+	})
+}
+
 func TestDedupSeriesSet(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -552,7 +622,7 @@ func TestDedupSeriesSet(t *testing.T) {
 				maxt: math.MaxInt64,
 				set:  newStoreSeriesSet(series),
 			}
-			dedupSet := newDedupSeriesSet(set, test.dedupLabels)
+			dedupSet := newDedupSeriesSet(set, test.dedupLabels, false, false)
 
 			i := 0
 			for dedupSet.Next() {
@@ -566,100 +636,51 @@ func TestDedupSeriesSet(t *testing.T) {
 	}
 }
 
-func TestDedupSeriesIterator(t *testing.T) {
-	defer leaktest.CheckTimeout(t, 10*time.Second)()
+func TestStaleGapsSeriesIterator(t *testing.T) {
+	// Staleness markers are NaN, which is never equal to itself, so they are represented as -1 in expected samples.
+	expand := func(it storage.SeriesIterator) []sample {
+		res := expandSeries(t, it)
+		for i := range res {
+			if value.IsStaleNaN(res[i].v) {
+				res[i].v = -1
+			}
+		}
+		return res
+	}
 
-	// The deltas between timestamps should be at least 10000 to not be affected
-	// by the initial penalty of 5000, that will cause the second iterator to seek
-	// ahead this far at least once.
-	cases := []struct {
-		a, b, exp []sample
+	for i, c := range []struct {
+		in, exp []sample
 	}{
-		{ // Generally prefer the first series.
-			a:   []sample{{10000, 10}, {20000, 11}, {30000, 12}, {40000, 13}},
-			b:   []sample{{10000, 20}, {20000, 21}, {30000, 22}, {40000, 23}},
-			exp: []sample{{10000, 10}, {20000, 11}, {30000, 12}, {40000, 13}},
-		},
-		{ // Prefer b if it starts earlier.
-			a:   []sample{{10100, 1}, {20100, 1}, {30100, 1}, {40100, 1}},
-			b:   []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
-			exp: []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
+		{ // Regular sampling has no gaps.
+			in:  []sample{{10000, 1}, {20000, 2}, {30000, 3}},
+			exp: []sample{{10000, 1}, {20000, 2}, {30000, 3}},
 		},
-		{ // Don't switch series on a single delta sized gap.
-			a:   []sample{{10000, 1}, {20000, 1}, {40000, 1}},
-			b:   []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}},
-			exp: []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+		{ // A single missed sample is not a gap.
+			in:  []sample{{10000, 1}, {20000, 2}, {40000, 3}, {50000, 4}},
+			exp: []sample{{10000, 1}, {20000, 2}, {40000, 3}, {50000, 4}},
 		},
-		{
-			a:   []sample{{10000, 1}, {20000, 1}, {40000, 1}},
-			b:   []sample{{15000, 2}, {25000, 2}, {35000, 2}, {45000, 2}},
-			exp: []sample{{10000, 1}, {20000, 1}, {40000, 1}},
+		{ // A marker is placed where the next sample was expected.
+			in:  []sample{{10000, 1}, {20000, 2}, {30000, 3}, {80000, 4}, {90000, 5}},
+			exp: []sample{{10000, 1}, {20000, 2}, {30000, 3}, {40000, -1}, {80000, 4}, {90000, 5}},
 		},
-		{ // Once the gap gets bigger than 2 deltas, switch and stay with the new series.
-			a:   []sample{{10000, 1}, {20000, 1}, {30000, 1}, {60000, 1}, {70000, 1}},
-			b:   []sample{{10100, 2}, {20100, 2}, {30100, 2}, {40100, 2}, {50100, 2}, {60100, 2}},
-			exp: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {50100, 2}, {60100, 2}},
+		{ // The interval is learned again after a gap.
+			in:  []sample{{10000, 1}, {20000, 2}, {60000, 3}, {61000, 4}, {70000, 5}},
+			exp: []sample{{10000, 1}, {20000, 2}, {30000, -1}, {60000, 3}, {61000, 4}, {62000, -1}, {70000, 5}},
 		},
-	}
-	for i, c := range cases {
+	} {
 		t.Logf("case %d:", i)
-		it := newDedupSeriesIterator(
-			&SampleIterator{l: c.a, i: -1},
-			&SampleIterator{l: c.b, i: -1},
-		)
-		res := expandSeries(t, it)
-		testutil.Equals(t, c.exp, res)
-	}
-}
-
-func BenchmarkDedupSeriesIterator(b *testing.B) {
-	run := func(b *testing.B, s1, s2 []sample) {
-		it := newDedupSeriesIterator(
-			&SampleIterator{l: s1, i: -1},
-			&SampleIterator{l: s2, i: -1},
-		)
-		b.ResetTimer()
-		var total int64
-
-		for it.Next() {
-			t, _ := it.At()
-			total += t
-		}
-		fmt.Fprint(ioutil.Discard, total)
+		testutil.Equals(t, c.exp, expand(newStaleGapsSeriesIterator(&SampleIterator{l: c.in, i: -1})))
 	}
-	b.Run("equal", func(b *testing.B) {
-		var s1, s2 []sample
-
-		for i := 0; i < b.N; i++ {
-			s1 = append(s1, sample{t: int64(i * 10000), v: 1})
-		}
-		for i := 0; i < b.N; i++ {
-			s2 = append(s2, sample{t: int64(i * 10000), v: 2})
-		}
-		run(b, s1, s2)
-	})
-	b.Run("fixed-delta", func(b *testing.B) {
-		var s1, s2 []sample
-
-		for i := 0; i < b.N; i++ {
-			s1 = append(s1, sample{t: int64(i * 10000), v: 1})
-		}
-		for i := 0; i < b.N; i++ {
-			s2 = append(s2, sample{t: int64(i*10000) + 10, v: 2})
-		}
-		run(b, s1, s2)
-	})
-	b.Run("minor-rand-delta", func(b *testing.B) {
-		var s1, s2 []sample
 
-		for i := 0; i < b.N; i++ {
-			s1 = append(s1, sample{t: int64(i*10000) + rand.Int63n(5000), v: 1})
-		}
-		for i := 0; i < b.N; i++ {
-			s2 = append(s2, sample{t: int64(i*10000) + +rand.Int63n(5000), v: 2})
-		}
-		run(b, s1, s2)
-	})
+	it := newStaleGapsSeriesIterator(&SampleIterator{l: []sample{{10000, 1}, {20000, 2}, {30000, 3}, {80000, 4}}, i: -1})
+	testutil.Assert(t, it.Seek(35000), "expected marker to be found")
+	ts, v := it.At()
+	testutil.Equals(t, int64(40000), ts)
+	testutil.Assert(t, value.IsStaleNaN(v), "expected staleness marker")
+	testutil.Assert(t, it.Seek(50000), "expected sample after gap to be found")
+	ts, _ = it.At()
+	testutil.Equals(t, int64(80000), ts)
+	testutil.Assert(t, !it.Seek(90000), "expected iterator to be exhausted")
 }
 
 type sample struct {
@@ -685,7 +706,7 @@ func (s *SampleIterator) Next() bool {
 		return false
 	}
 	s.i++
-	return true
+	return s.i < len(s.l)
 }
 
 func (s *SampleIterator) Seek(t int64) bool {
@@ -708,9 +729,11 @@ type storeServer struct {
 	storepb.StoreServer
 
 	resps []*storepb.SeriesResponse
+	req   *storepb.SeriesRequest
 }
 
 func (s *storeServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.req = r
 	for _, resp := range s.resps {
 		err := srv.Send(resp)
 		if err != nil {
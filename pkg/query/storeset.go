@@ -6,6 +6,7 @@ package query
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -17,6 +18,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -202,6 +204,7 @@ func NewStoreSet(
 
 type storeRef struct {
 	storepb.StoreClient
+	rules rulespb.RulesClient
 
 	mtx  sync.RWMutex
 	cc   *grpc.ClientConn
@@ -367,8 +370,8 @@ func (s *StoreSet) Update(ctx context.Context) {
 		}
 		stats[st.StoreType()][st.LabelSetsString()]++
 
+		// Status was already updated while checking the store. Strict stores might be added even if unreachable.
 		stores[addr] = st
-		s.updateStoreStatus(st, nil)
 		level.Info(s.logger).Log("msg", "adding new storeAPI to query storeset", "address", addr, "extLset", extLset)
 	}
 
@@ -414,23 +417,29 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 					level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr)
 					return
 				}
-				st = &storeRef{StoreClient: storepb.NewStoreClient(conn), cc: conn, addr: addr, logger: s.logger}
+				st = &storeRef{StoreClient: storepb.NewStoreClient(conn), rules: rulespb.NewRulesClient(conn), cc: conn, addr: addr, logger: s.logger}
 			}
 
 			// Check existing or new store. Is it healthy? What are current metadata?
 			labelSets, minTime, maxTime, storeType, err := spec.Metadata(ctx, st.StoreClient)
 			if err != nil {
-				if !seenAlready {
-					// Close only if new. Unactive `s.stores` will be closed later on.
-					st.Close()
-				}
 				s.updateStoreStatus(st, err)
 				level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "getting metadata"), "address", addr)
 
 				if !spec.StrictStatic() {
+					if !seenAlready {
+						// Close only if new. Unactive `s.stores` will be closed later on.
+						st.Close()
+					}
 					return
 				}
 
+				if !seenAlready {
+					// Strict store was never reachable, so we don't know what data it has. Assume it can have any,
+					// so it's always queried and its failure is surfaced instead of the store being silently skipped.
+					st.Update(nil, math.MinInt64, math.MaxInt64, nil)
+				}
+
 				// Still keep it around if static & strict mode enabled.
 				mtx.Lock()
 				defer mtx.Unlock()
@@ -439,8 +448,10 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 				return
 			}
 
-			s.updateStoreStatus(st, nil)
+			// Fill in metadata before the store is published in the status or the active set, so it's never
+			// visible with stale or empty labels and time range.
 			st.Update(labelSets, minTime, maxTime, storeType)
+			s.updateStoreStatus(st, nil)
 
 			mtx.Lock()
 			defer mtx.Unlock()
@@ -504,6 +515,20 @@ func (s *StoreSet) Get() []store.Client {
 	return stores
 }
 
+// GetRulesClients returns a list of Rules API clients of all active rulers.
+func (s *StoreSet) GetRulesClients() []rulespb.RulesClient {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	var rules []rulespb.RulesClient
+	for _, st := range s.stores {
+		if st.StoreType() == component.Rule && st.rules != nil {
+			rules = append(rules, st.rules)
+		}
+	}
+	return rules
+}
+
 func (s *StoreSet) Close() {
 	s.storesMtx.Lock()
 	defer s.storesMtx.Unlock()
@@ -610,6 +610,14 @@ func TestQuerierStrict(t *testing.T) {
 	testutil.Equals(t, int64(12345), curMin, "got incorrect minimum time")
 	testutil.Equals(t, int64(54321), curMax, "got incorrect minimum time")
 
+	// Status of the new store must already have its metadata.
+	status := storeSet.storeStatuses[staticStoreAddr]
+	testutil.Ok(t, status.LastError)
+	testutil.Equals(t, int64(12345), status.MinTime)
+	testutil.Equals(t, int64(54321), status.MaxTime)
+	testutil.Equals(t, component.Sidecar, status.StoreType)
+	testutil.Equals(t, storeSet.stores[staticStoreAddr].LabelSets(), status.LabelSets)
+
 	// Turn off the stores.
 	st.Close()
 
@@ -624,3 +632,35 @@ func TestQuerierStrict(t *testing.T) {
 	testutil.Equals(t, curMax, storeSet.stores[staticStoreAddr].maxTime, "minimum time reported by the store node is different")
 	testutil.NotOk(t, storeSet.storeStatuses[staticStoreAddr].LastError)
 }
+
+// TestQuerierStrict_NeverReachable tests that strict store that was never reachable is kept and matches any time range,
+// so queries fail loudly instead of silently skipping it.
+func TestQuerierStrict_NeverReachable(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 5*time.Second)()
+
+	// Grab a free address and release it, so nothing is listening there.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	unreachableAddr := l.Addr().String()
+	testutil.Ok(t, l.Close())
+
+	storeSet := NewStoreSet(nil, nil, func() (specs []StoreSpec) {
+		return []StoreSpec{
+			NewGRPCStoreSpec(unreachableAddr, true),
+		}
+	}, testGRPCOpts, time.Minute)
+	defer storeSet.Close()
+	storeSet.gRPCInfoCallTimeout = 1 * time.Second
+
+	storeSet.Update(context.Background())
+	testutil.Equals(t, 1, len(storeSet.stores), "strict store must be kept even if it was never reachable")
+
+	mint, maxt := storeSet.stores[unreachableAddr].TimeRange()
+	testutil.Equals(t, int64(math.MinInt64), mint)
+	testutil.Equals(t, int64(math.MaxInt64), maxt)
+	testutil.NotOk(t, storeSet.storeStatuses[unreachableAddr].LastError)
+
+	// Another update must not change anything.
+	storeSet.Update(context.Background())
+	testutil.Equals(t, 1, len(storeSet.stores))
+}
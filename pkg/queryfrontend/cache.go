@@ -0,0 +1,312 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/cacheutil"
+	"github.com/thanos-io/thanos/pkg/model"
+)
+
+type ResponseCacheProvider string
+
+const (
+	INMEMORY  ResponseCacheProvider = "IN-MEMORY"
+	MEMCACHED ResponseCacheProvider = "MEMCACHED"
+	REDIS     ResponseCacheProvider = "REDIS"
+)
+
+// ResponseCacheConfig specifies the cache of range query responses.
+type ResponseCacheConfig struct {
+	Type   ResponseCacheProvider `yaml:"type"`
+	Config interface{}           `yaml:"config"`
+	// Validity is how long responses are cached.
+	Validity time.Duration `yaml:"validity"`
+	// MaxFreshness is how recent the end of a range query may be for its response to be cached. Responses of
+	// queries ending more recently may still change, e.g. because of late samples.
+	MaxFreshness time.Duration `yaml:"max_freshness"`
+	// TenantHeaders are HTTP headers determining the tenant of requests. Responses are cached by their values, as
+	// well as by the Authorization and Cookie headers, so that they are not shared between tenants.
+	TenantHeaders []string `yaml:"tenant_headers"`
+}
+
+// DefaultResponseCacheConfig is the default configuration of the response cache.
+var DefaultResponseCacheConfig = ResponseCacheConfig{
+	Validity:      24 * time.Hour,
+	MaxFreshness:  time.Minute,
+	TenantHeaders: []string{"X-Scope-OrgID", "THANOS-TENANT"},
+}
+
+// authHeaders are HTTP headers forwarded to the querier which may authorize access to different data.
+var authHeaders = []string{"Authorization", "Cookie"}
+
+// writeTenant writes the values of the headers of the given request determining its tenant to the given hash of a
+// cache key.
+func writeTenant(h hash.Hash, header http.Header, tenantHeaders []string) {
+	names := make([]string, 0, len(authHeaders)+len(tenantHeaders))
+	for _, n := range authHeaders {
+		names = append(names, http.CanonicalHeaderKey(n))
+	}
+	for _, n := range tenantHeaders {
+		names = append(names, http.CanonicalHeaderKey(n))
+	}
+	sort.Strings(names)
+
+	prev := ""
+	for _, n := range names {
+		if n == prev {
+			continue
+		}
+		prev = n
+		_, _ = h.Write([]byte(n))
+		for _, v := range header[n] {
+			_, _ = h.Write([]byte{1})
+			_, _ = h.Write([]byte(v))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+}
+
+// ParseResponseCacheConfig parses and validates the response cache configuration.
+func ParseResponseCacheConfig(content []byte) (ResponseCacheConfig, error) {
+	config := DefaultResponseCacheConfig
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return ResponseCacheConfig{}, errors.Wrap(err, "parsing config YAML file")
+	}
+	if config.Validity <= 0 {
+		return ResponseCacheConfig{}, errors.New("validity must be positive")
+	}
+	if config.MaxFreshness < 0 {
+		return ResponseCacheConfig{}, errors.New("max freshness must not be negative")
+	}
+	return config, nil
+}
+
+// Cache stores encoded responses.
+type Cache interface {
+	// Fetch returns the items of the given keys found in the cache.
+	Fetch(ctx context.Context, keys []string) map[string][]byte
+	// Store stores the given item for the given duration. Errors are tracked and logged, as a response not being
+	// cached must not fail the query.
+	Store(ctx context.Context, key string, data []byte, ttl time.Duration)
+	// Stop releases the resources of the cache.
+	Stop()
+}
+
+// NewCache returns the cache of the given configuration.
+func NewCache(logger log.Logger, reg prometheus.Registerer, config ResponseCacheConfig) (Cache, error) {
+	backendConfig, err := yaml.Marshal(config.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal content of cache backend configuration")
+	}
+
+	var cache Cache
+	switch strings.ToUpper(string(config.Type)) {
+	case string(INMEMORY):
+		cache, err = NewInMemoryCache(logger, reg, backendConfig)
+	case string(MEMCACHED):
+		var memcached cacheutil.MemcachedClient
+		memcached, err = cacheutil.NewMemcachedClient(logger, "query-frontend-cache", backendConfig, reg)
+		if err == nil {
+			cache = &remoteCache{logger: logger, client: memcached}
+		}
+	case string(REDIS):
+		var redis cacheutil.RedisClient
+		redis, err = cacheutil.NewRedisClient(logger, "query-frontend-cache", backendConfig, reg)
+		if err == nil {
+			cache = &remoteCache{logger: logger, client: redis}
+		}
+	default:
+		return nil, errors.Errorf("response cache with type %s is not supported", config.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("create %s response cache", config.Type))
+	}
+	return cache, nil
+}
+
+// remoteClient is implemented by the clients of remote cache backends.
+type remoteClient interface {
+	GetMulti(ctx context.Context, keys []string) map[string][]byte
+	SetAsync(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Stop()
+}
+
+// remoteCache is a Cache backed by memcached or redis.
+type remoteCache struct {
+	logger log.Logger
+	client remoteClient
+}
+
+func (c *remoteCache) Fetch(ctx context.Context, keys []string) map[string][]byte {
+	return c.client.GetMulti(ctx, keys)
+}
+
+func (c *remoteCache) Store(ctx context.Context, key string, data []byte, ttl time.Duration) {
+	// Failures of async operations are tracked by the client.
+	if err := c.client.SetAsync(ctx, key, data, ttl); err != nil {
+		level.Error(c.logger).Log("msg", "failed to cache response", "err", err)
+	}
+}
+
+func (c *remoteCache) Stop() {
+	c.client.Stop()
+}
+
+// InMemoryCacheConfig holds the in-memory response cache config.
+type InMemoryCacheConfig struct {
+	// MaxSize represents overall maximum number of bytes cache can contain.
+	MaxSize model.Bytes `yaml:"max_size"`
+	// MaxItemSize represents maximum size of single item.
+	MaxItemSize model.Bytes `yaml:"max_item_size"`
+}
+
+var DefaultInMemoryCacheConfig = InMemoryCacheConfig{
+	MaxSize:     250 * 1024 * 1024,
+	MaxItemSize: 125 * 1024 * 1024,
+}
+
+type inMemoryItem struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// InMemoryCache is a Cache keeping items in memory, evicting the least recently used ones once the total size of
+// items exceeds the maximum size.
+type InMemoryCache struct {
+	mtx sync.Mutex
+
+	logger      log.Logger
+	lru         *lru.LRU
+	maxSize     uint64
+	maxItemSize uint64
+	curSize     uint64
+
+	evicted  prometheus.Counter
+	overflow prometheus.Counter
+	current  prometheus.Gauge
+	size     prometheus.Gauge
+
+	now func() time.Time
+}
+
+// NewInMemoryCache returns a new InMemoryCache of the given YAML configuration.
+func NewInMemoryCache(logger log.Logger, reg prometheus.Registerer, conf []byte) (*InMemoryCache, error) {
+	config := DefaultInMemoryCacheConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return nil, err
+	}
+	return NewInMemoryCacheWithConfig(logger, reg, config)
+}
+
+// NewInMemoryCacheWithConfig returns a new InMemoryCache of the given configuration.
+func NewInMemoryCacheWithConfig(logger log.Logger, reg prometheus.Registerer, config InMemoryCacheConfig) (*InMemoryCache, error) {
+	if config.MaxItemSize > config.MaxSize {
+		return nil, errors.Errorf("max item size (%v) cannot be bigger than overall cache size (%v)", config.MaxItemSize, config.MaxSize)
+	}
+
+	c := &InMemoryCache{
+		logger:      logger,
+		maxSize:     uint64(config.MaxSize),
+		maxItemSize: uint64(config.MaxItemSize),
+		now:         time.Now,
+	}
+	c.evicted = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_cache_items_evicted_total",
+		Help: "Total number of responses that were evicted from the in-memory cache.",
+	})
+	c.overflow = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_cache_items_overflowed_total",
+		Help: "Total number of responses that could not be added to the in-memory cache due to being too big.",
+	})
+	c.current = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_query_frontend_cache_items",
+		Help: "Current number of responses in the in-memory cache.",
+	})
+	c.size = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_query_frontend_cache_items_size_bytes",
+		Help: "Current byte size of responses in the in-memory cache.",
+	})
+
+	// Evictions are managed based on the stored size using RemoveOldest.
+	l, err := lru.NewLRU(maxInt, c.onEvict)
+	if err != nil {
+		return nil, err
+	}
+	c.lru = l
+	return c, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func (c *InMemoryCache) onEvict(key, val interface{}) {
+	size := uint64(len(val.(inMemoryItem).data))
+	c.evicted.Inc()
+	c.current.Dec()
+	c.size.Sub(float64(size))
+	c.curSize -= size
+}
+
+func (c *InMemoryCache) Fetch(_ context.Context, keys []string) map[string][]byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	found := make(map[string][]byte, len(keys))
+	now := c.now()
+	for _, k := range keys {
+		v, ok := c.lru.Get(k)
+		if !ok {
+			continue
+		}
+		item := v.(inMemoryItem)
+		if !now.Before(item.expiresAt) {
+			c.lru.Remove(k)
+			continue
+		}
+		found[k] = item.data
+	}
+	return found
+}
+
+func (c *InMemoryCache) Store(_ context.Context, key string, data []byte, ttl time.Duration) {
+	size := uint64(len(data))
+	if size > c.maxItemSize {
+		c.overflow.Inc()
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Replaced items are evicted.
+	c.lru.Remove(key)
+	for c.curSize+size > c.maxSize {
+		if _, _, ok := c.lru.RemoveOldest(); !ok {
+			level.Error(c.logger).Log("msg", "LRU has nothing more to evict, but we still cannot allocate the item")
+			return
+		}
+	}
+	c.lru.Add(key, inMemoryItem{data: data, expiresAt: c.now().Add(ttl)})
+	c.current.Inc()
+	c.size.Add(float64(size))
+	c.curSize += size
+}
+
+func (c *InMemoryCache) Stop() {}
@@ -0,0 +1,74 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseResponseCacheConfig(t *testing.T) {
+	cfg, err := ParseResponseCacheConfig([]byte("type: IN-MEMORY"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultResponseCacheConfig.Validity, cfg.Validity)
+	testutil.Equals(t, DefaultResponseCacheConfig.MaxFreshness, cfg.MaxFreshness)
+	testutil.Equals(t, []string{"X-Scope-OrgID", "THANOS-TENANT"}, cfg.TenantHeaders)
+
+	cfg, err = ParseResponseCacheConfig([]byte("type: REDIS\nvalidity: 1h\nmax_freshness: 5m"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, time.Hour, cfg.Validity)
+	testutil.Equals(t, 5*time.Minute, cfg.MaxFreshness)
+
+	cfg, err = ParseResponseCacheConfig([]byte("type: IN-MEMORY\ntenant_headers: [X-Tenant]"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"X-Tenant"}, cfg.TenantHeaders)
+
+	_, err = ParseResponseCacheConfig([]byte("type: IN-MEMORY\nvalidity: 0s"))
+	testutil.NotOk(t, err)
+	_, err = ParseResponseCacheConfig([]byte("type: IN-MEMORY\nunknown: 1"))
+	testutil.NotOk(t, err)
+
+	_, err = NewCache(log.NewNopLogger(), nil, ResponseCacheConfig{Type: "UNKNOWN"})
+	testutil.NotOk(t, err)
+}
+
+func TestInMemoryCache(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewInMemoryCacheWithConfig(log.NewNopLogger(), nil, InMemoryCacheConfig{MaxSize: 1, MaxItemSize: 2})
+	testutil.NotOk(t, err)
+
+	c, err := NewInMemoryCacheWithConfig(log.NewNopLogger(), nil, InMemoryCacheConfig{MaxSize: 10, MaxItemSize: 5})
+	testutil.Ok(t, err)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	c.Store(ctx, "a", []byte("aaaa"), time.Minute)
+	c.Store(ctx, "b", []byte("bbbb"), 2*time.Minute)
+	testutil.Equals(t, map[string][]byte{"a": []byte("aaaa"), "b": []byte("bbbb")}, c.Fetch(ctx, []string{"a", "b", "c"}))
+
+	// Items exceeding the maximum item size are not stored.
+	c.Store(ctx, "c", []byte("cccccc"), time.Minute)
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(c.overflow))
+	testutil.Equals(t, map[string][]byte{}, c.Fetch(ctx, []string{"c"}))
+
+	// The least recently used item is evicted once the maximum size is exceeded.
+	c.Fetch(ctx, []string{"a"})
+	c.Store(ctx, "c", []byte("cccc"), time.Minute)
+	testutil.Equals(t, map[string][]byte{"a": []byte("aaaa"), "c": []byte("cccc")}, c.Fetch(ctx, []string{"a", "b", "c"}))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(c.evicted))
+	testutil.Equals(t, uint64(8), c.curSize)
+
+	// Expired items are not returned.
+	now = now.Add(time.Minute)
+	testutil.Equals(t, map[string][]byte{}, c.Fetch(ctx, []string{"a", "c"}))
+	testutil.Equals(t, uint64(0), c.curSize)
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(c.current))
+}
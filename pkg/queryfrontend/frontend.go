@@ -0,0 +1,87 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package queryfrontend implements a frontend of the query API in front of queriers, which executes range queries
+// through middlewares, e.g. caching their responses, and proxies all other requests.
+package queryfrontend
+
+import (
+	"encoding/json"
+	stdlog "log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const rangeQueryPath = "/api/v1/query_range"
+
+// Frontend serves the query API of a querier.
+type Frontend struct {
+	logger       log.Logger
+	rangeQueries Handler
+	proxy        http.Handler
+}
+
+// NewFrontend returns a new Frontend of the querier at the given URL, sending requests with the given client. Range
+// queries are executed through the given middleware.
+func NewFrontend(logger log.Logger, downstreamURL *url.URL, client *http.Client, middleware Middleware) *Frontend {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(downstreamURL)
+	proxy.Transport = client.Transport
+	proxy.ErrorLog = stdlog.New(log.NewStdlibAdapter(level.Warn(logger)), "", 0)
+
+	return &Frontend{
+		logger:       logger,
+		rangeQueries: middleware(NewDownstream(logger, client, downstreamURL)),
+		proxy:        proxy,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (f *Frontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, rangeQueryPath) {
+		f.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	req, err := ParseRangeRequest(r)
+	if err != nil {
+		f.writeError(w, newError(http.StatusBadRequest, errorBadData, err))
+		return
+	}
+
+	res, err := f.rangeQueries.Do(r.Context(), req)
+	if err != nil {
+		f.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		level.Error(f.logger).Log("msg", "failed to write range query response", "err", err)
+	}
+}
+
+// writeError writes responses of the querier with an error status code as they are, and all other errors as
+// internal errors.
+func (f *Frontend) writeError(w http.ResponseWriter, err error) {
+	e, ok := errors.Cause(err).(*Error)
+	if !ok {
+		level.Warn(f.logger).Log("msg", "range query failed", "err", err)
+		e = newError(http.StatusInternalServerError, errorInternal, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.StatusCode)
+	if _, err := w.Write(e.Body); err != nil {
+		level.Error(f.logger).Log("msg", "failed to write error response", "err", err)
+	}
+}
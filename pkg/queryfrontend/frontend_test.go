@@ -0,0 +1,157 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestFrontend(t *testing.T) {
+	var requests int64
+	querier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		switch r.URL.Path {
+		case "/api/v1/query_range":
+			if r.FormValue("query") == "invalid" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"execution","error":"invalid"}`))
+				return
+			}
+			var warnings []string
+			if r.FormValue("partial_response") == "true" {
+				warnings = []string{"store unavailable"}
+			}
+			_ = json.NewEncoder(w).Encode(&RangeResponse{
+				Status: statusSuccess,
+				Data: RangeData{ResultType: "matrix", Result: model.Matrix{{
+					Metric: model.Metric{"__name__": "up"},
+					Values: []model.SamplePair{{Timestamp: 0, Value: 1}},
+				}}},
+				Warnings: warnings,
+			})
+		case "/api/v1/labels":
+			_, _ = w.Write([]byte(`{"status":"success","data":["__name__"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer querier.Close()
+
+	u, err := url.Parse(querier.URL)
+	testutil.Ok(t, err)
+	cache, err := NewInMemoryCacheWithConfig(log.NewNopLogger(), nil, DefaultInMemoryCacheConfig)
+	testutil.Ok(t, err)
+	config := ResponseCacheConfig{Validity: time.Hour, MaxFreshness: time.Minute, TenantHeaders: []string{"X-Scope-OrgID"}}
+	middleware := NewResultsCacheMiddleware(log.NewNopLogger(), nil, cache, config)
+	frontend := NewFrontend(log.NewNopLogger(), u, &http.Client{}, middleware)
+	rc := middleware(nil).(*resultsCache)
+
+	now := time.Now()
+	getWithHeader := func(header http.Header, path string, params url.Values) (int, []byte) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		frontend.ServeHTTP(rec, req)
+		body, err := ioutil.ReadAll(rec.Body)
+		testutil.Ok(t, err)
+		return rec.Code, body
+	}
+	get := func(path string, params url.Values) (int, []byte) {
+		return getWithHeader(nil, path, params)
+	}
+	rangeQuery := func(query string, end time.Time, extra ...string) url.Values {
+		v := url.Values{
+			"query": {query},
+			"start": {strconv.FormatInt(end.Add(-time.Hour).Unix(), 10)},
+			"end":   {strconv.FormatInt(end.Unix(), 10)},
+			"step":  {"15s"},
+		}
+		for i := 0; i < len(extra); i += 2 {
+			v.Set(extra[i], extra[i+1])
+		}
+		return v
+	}
+	expectRequests := func(expected int64) {
+		t.Helper()
+		testutil.Equals(t, expected, atomic.LoadInt64(&requests))
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		code, first := get("/api/v1/query_range", rangeQuery("up", now.Add(-time.Hour), "timeout", "1m"))
+		testutil.Equals(t, http.StatusOK, code)
+		expectRequests(1)
+
+		// The timeout does not change the result, so the cached response is returned.
+		code, second := get("/api/v1/query_range", rangeQuery("up", now.Add(-time.Hour), "timeout", "2m"))
+		testutil.Equals(t, http.StatusOK, code)
+		testutil.Equals(t, string(first), string(second))
+		expectRequests(1)
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(rc.hits))
+
+		// Other parameters do.
+		get("/api/v1/query_range", rangeQuery("up", now.Add(-time.Hour), "dedup", "false"))
+		expectRequests(2)
+	})
+	t.Run("too fresh", func(t *testing.T) {
+		get("/api/v1/query_range", rangeQuery("fresh", now))
+		get("/api/v1/query_range", rangeQuery("fresh", now))
+		expectRequests(4)
+
+		// Responses of downsampled data are not cached until the max source resolution passed.
+		get("/api/v1/query_range", rangeQuery("downsampled", now.Add(-30*time.Minute), "max_source_resolution", "1h"))
+		get("/api/v1/query_range", rangeQuery("downsampled", now.Add(-30*time.Minute), "max_source_resolution", "1h"))
+		expectRequests(6)
+	})
+	t.Run("partial response", func(t *testing.T) {
+		get("/api/v1/query_range", rangeQuery("partial", now.Add(-time.Hour), "partial_response", "true"))
+		get("/api/v1/query_range", rangeQuery("partial", now.Add(-time.Hour), "partial_response", "true"))
+		expectRequests(8)
+	})
+	t.Run("errors", func(t *testing.T) {
+		code, body := get("/api/v1/query_range", rangeQuery("invalid", now.Add(-time.Hour)))
+		testutil.Equals(t, http.StatusUnprocessableEntity, code)
+		testutil.Equals(t, `{"status":"error","errorType":"execution","error":"invalid"}`, string(body))
+		expectRequests(9)
+
+		code, _ = get("/api/v1/query_range", url.Values{"query": {"up"}, "start": {"a"}})
+		testutil.Equals(t, http.StatusBadRequest, code)
+		expectRequests(9)
+	})
+	t.Run("proxied", func(t *testing.T) {
+		code, body := get("/api/v1/labels", nil)
+		testutil.Equals(t, http.StatusOK, code)
+		testutil.Equals(t, `{"status":"success","data":["__name__"]}`, string(body))
+		expectRequests(10)
+	})
+	t.Run("tenants", func(t *testing.T) {
+		teamA := http.Header{"X-Scope-Orgid": {"team-a"}}
+		getWithHeader(teamA, "/api/v1/query_range", rangeQuery("tenant", now.Add(-time.Hour)))
+		getWithHeader(teamA, "/api/v1/query_range", rangeQuery("tenant", now.Add(-time.Hour)))
+		expectRequests(11)
+
+		// Responses are not shared with other tenants, or with requests authorized differently.
+		getWithHeader(http.Header{"X-Scope-Orgid": {"team-b"}}, "/api/v1/query_range", rangeQuery("tenant", now.Add(-time.Hour)))
+		expectRequests(12)
+		get("/api/v1/query_range", rangeQuery("tenant", now.Add(-time.Hour)))
+		expectRequests(13)
+		getWithHeader(http.Header{"X-Scope-Orgid": {"team-a"}, "Authorization": {"Bearer other"}}, "/api/v1/query_range", rangeQuery("tenant", now.Add(-time.Hour)))
+		expectRequests(14)
+	})
+}
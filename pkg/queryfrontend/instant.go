@@ -0,0 +1,319 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"golang.org/x/sync/errgroup"
+)
+
+const instantQueryPath = "/api/v1/query"
+
+// partStep is the step, in milliseconds, of the range queries executing the parts of split instant queries. As they
+// evaluate a single step, it only has to be small enough not to select downsampled data for max_source_resolution=auto.
+const partStep = 1
+
+// splittableFuncs are the functions over time whose results over a range can be computed from their results over
+// parts of the range, by the function combining them.
+var splittableFuncs = map[string]func(a, b float64) float64{
+	"sum_over_time":   func(a, b float64) float64 { return a + b },
+	"count_over_time": func(a, b float64) float64 { return a + b },
+	"max_over_time":   math.Max,
+	"min_over_time":   math.Min,
+}
+
+// SplittableFunctions returns the functions instant queries can be split by.
+func SplittableFunctions() []string {
+	return []string{"count_over_time", "max_over_time", "min_over_time", "sum_over_time"}
+}
+
+// InstantSplitConfig configures splitting of instant queries.
+type InstantSplitConfig struct {
+	// Interval is the range of the parts of split queries. Queries are split only if their range is longer.
+	Interval time.Duration
+	// Functions are the functions queries are split by.
+	Functions []string
+	// Concurrency is the maximum number of parts of a query executed concurrently.
+	Concurrency int
+}
+
+// InstantResponse is a response of the query API to an instant query returning a vector.
+type InstantResponse struct {
+	Status    string      `json:"status"`
+	Data      InstantData `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Warnings  []string    `json:"warnings,omitempty"`
+}
+
+// InstantData is the result of an instant query returning a vector.
+type InstantData struct {
+	ResultType string       `json:"resultType"`
+	Result     model.Vector `json:"result"`
+}
+
+type instantSplitter struct {
+	logger       log.Logger
+	conf         InstantSplitConfig
+	functions    map[string]struct{}
+	rangeQueries Handler
+	next         http.Handler
+
+	splitQueries prometheus.Counter
+
+	now func() time.Time
+}
+
+// NewInstantSplitter returns a handler splitting instant queries of a function over time of a single series
+// selector, e.g. sum_over_time(http_requests_total[30d]), into queries of the function over consecutive parts of
+// the range, executed concurrently. Their results are combined per series by the function, e.g. summed. All other
+// requests are handled by the next handler.
+//
+// Parts are executed as range queries of a single step by the given handler, so that they pass through the same
+// middlewares as range queries, e.g. are retried and have their responses cached.
+//
+// Only functions whose results can be combined exactly, i.e. sum_over_time, count_over_time, max_over_time and
+// min_over_time, are supported.
+func NewInstantSplitter(logger log.Logger, reg prometheus.Registerer, rangeQueries Handler, conf InstantSplitConfig, next http.Handler) (http.Handler, error) {
+	functions := make(map[string]struct{}, len(conf.Functions))
+	for _, f := range conf.Functions {
+		if _, ok := splittableFuncs[f]; !ok {
+			return nil, errors.Errorf("instant queries cannot be split by function %s", f)
+		}
+		functions[f] = struct{}{}
+	}
+	if conf.Interval <= 0 {
+		return nil, errors.New("split interval must be positive")
+	}
+	if conf.Concurrency <= 0 {
+		return nil, errors.New("split concurrency must be positive")
+	}
+
+	return &instantSplitter{
+		logger:       logger,
+		conf:         conf,
+		functions:    functions,
+		rangeQueries: rangeQueries,
+		next:         next,
+		splitQueries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_split_instant_queries_total",
+			Help: "Total number of queries instant queries were split into.",
+		}),
+		now: time.Now,
+	}, nil
+}
+
+// instantQuery is a split instant query.
+type instantQuery struct {
+	function string
+	selector string
+	rng      time.Duration
+}
+
+func (s *instantSplitter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, instantQueryPath) {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	q, ok := s.analyze(r.Form.Get("query"))
+	if !ok {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+
+	t := timestamp(s.now())
+	if v := r.Form.Get("time"); v != "" {
+		var err error
+		if t, err = parseTime(v); err != nil {
+			// Invalid requests are answered by the querier.
+			s.next.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	res, err := s.do(r.Context(), r, q, t)
+	if err != nil {
+		e, ok := errors.Cause(err).(*Error)
+		if !ok {
+			level.Warn(s.logger).Log("msg", "instant query failed", "err", err)
+			e = newError(http.StatusInternalServerError, errorInternal, err)
+		}
+		writeJSON(s.logger, w, e.StatusCode, e.Body)
+		return
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		e := newError(http.StatusInternalServerError, errorInternal, errors.Wrap(err, "encode response"))
+		writeJSON(s.logger, w, e.StatusCode, e.Body)
+		return
+	}
+	writeJSON(s.logger, w, http.StatusOK, b)
+}
+
+// analyze returns the split query of the given query, if it can be split.
+func (s *instantSplitter) analyze(query string) (instantQuery, bool) {
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return instantQuery{}, false
+	}
+	for {
+		p, ok := expr.(*promql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.Expr
+	}
+
+	call, ok := expr.(*promql.Call)
+	if !ok || len(call.Args) != 1 {
+		return instantQuery{}, false
+	}
+	if _, ok := s.functions[call.Func.Name]; !ok {
+		return instantQuery{}, false
+	}
+	m, ok := call.Args[0].(*promql.MatrixSelector)
+	if !ok || m.Range <= s.conf.Interval {
+		return instantQuery{}, false
+	}
+
+	// Only the part of a matrix selector before its range selects series. Selectors with offset are not split.
+	str := m.String()
+	if !strings.HasSuffix(str, "]") {
+		return instantQuery{}, false
+	}
+	return instantQuery{function: call.Func.Name, selector: str[:strings.LastIndex(str, "[")], rng: m.Range}, true
+}
+
+// do executes the parts of the given query at the given time concurrently and combines their results.
+func (s *instantSplitter) do(ctx context.Context, r *http.Request, q instantQuery, t int64) (*InstantResponse, error) {
+	queries, times := splitInstantQuery(q, t, s.conf.Interval)
+	s.splitQueries.Add(float64(len(queries)))
+
+	var (
+		resps = make([]*InstantResponse, len(queries))
+		sem   = make(chan struct{}, s.conf.Concurrency)
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range queries {
+		req := &RangeRequest{
+			Path:    strings.TrimSuffix(r.URL.Path, instantQueryPath) + rangeQueryPath,
+			Start:   times[i],
+			End:     times[i],
+			Step:    partStep,
+			Query:   queries[i],
+			Params:  url.Values{},
+			Headers: r.Header,
+		}
+		for k, v := range r.Form {
+			if k != "query" && k != "time" {
+				req.Params[k] = v
+			}
+		}
+
+		i := i
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+
+			res, err := s.rangeQueries.Do(gctx, req)
+			if err != nil {
+				return err
+			}
+			if res.Data.ResultType != model.ValMatrix.String() {
+				return errors.Errorf("unexpected result type %s of part of split query", res.Data.ResultType)
+			}
+			resps[i] = instantResponse(res)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return combineInstantResponses(resps, splittableFuncs[q.function], t), nil
+}
+
+// instantResponse returns the response of an instant query of the given response of a range query of a single step.
+func instantResponse(res *RangeResponse) *InstantResponse {
+	inst := &InstantResponse{
+		Status:   res.Status,
+		Data:     InstantData{ResultType: model.ValVector.String()},
+		Warnings: res.Warnings,
+	}
+	for _, s := range res.Data.Result {
+		if len(s.Values) == 0 {
+			continue
+		}
+		v := s.Values[len(s.Values)-1]
+		inst.Data.Result = append(inst.Data.Result, &model.Sample{Metric: s.Metric, Value: v.Value, Timestamp: v.Timestamp})
+	}
+	return inst
+}
+
+// splitInstantQuery returns the queries of consecutive parts of the range of the given query evaluated at the given
+// time in milliseconds, together with the times they are evaluated at. As ranges include both their start and end,
+// all but the last part select one millisecond less than the interval, so that parts do not overlap.
+func splitInstantQuery(q instantQuery, t int64, interval time.Duration) ([]string, []int64) {
+	var (
+		rng     = int64(q.rng / time.Millisecond)
+		step    = int64(interval / time.Millisecond)
+		queries []string
+		times   []int64
+	)
+	for offset := int64(0); offset < rng; offset += step {
+		partRange := step - 1
+		if offset+step >= rng {
+			partRange = rng - offset
+		}
+		queries = append(queries, fmt.Sprintf("%s(%s[%dms])", q.function, q.selector, partRange))
+		times = append(times, t-offset)
+	}
+	return queries, times
+}
+
+// combineInstantResponses combines the results of the parts of a split query per series by the given function.
+func combineInstantResponses(resps []*InstantResponse, combine func(a, b float64) float64, t int64) *InstantResponse {
+	var (
+		res    = &InstantResponse{Status: statusSuccess, Data: InstantData{ResultType: model.ValVector.String()}}
+		series = map[model.Fingerprint]*model.Sample{}
+	)
+	for _, resp := range resps {
+		res.Warnings = append(res.Warnings, resp.Warnings...)
+		for _, s := range resp.Data.Result {
+			fp := s.Metric.Fingerprint()
+			existing, ok := series[fp]
+			if !ok {
+				existing = &model.Sample{Metric: s.Metric, Value: s.Value, Timestamp: model.Time(t)}
+				series[fp] = existing
+				res.Data.Result = append(res.Data.Result, existing)
+				continue
+			}
+			existing.Value = model.SampleValue(combine(float64(existing.Value), float64(s.Value)))
+		}
+	}
+	return res
+}
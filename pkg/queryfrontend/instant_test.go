@@ -0,0 +1,181 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSplitInstantQuery(t *testing.T) {
+	q := instantQuery{function: "sum_over_time", selector: `up{job="a"}`, rng: 50 * time.Hour}
+
+	queries, times := splitInstantQuery(q, 1000*3600*1000, 24*time.Hour)
+	testutil.Equals(t, []string{
+		`sum_over_time(up{job="a"}[86399999ms])`,
+		`sum_over_time(up{job="a"}[86399999ms])`,
+		`sum_over_time(up{job="a"}[7200000ms])`,
+	}, queries)
+	testutil.Equals(t, []int64{1000 * 3600 * 1000, 976 * 3600 * 1000, 952 * 3600 * 1000}, times)
+}
+
+func TestInstantSplitter_Analyze(t *testing.T) {
+	h, err := NewInstantSplitter(log.NewNopLogger(), nil, nil, InstantSplitConfig{
+		Interval:    24 * time.Hour,
+		Functions:   []string{"sum_over_time", "max_over_time"},
+		Concurrency: 1,
+	}, http.NotFoundHandler())
+	testutil.Ok(t, err)
+	s := h.(*instantSplitter)
+
+	for _, tcase := range []struct {
+		query    string
+		expected instantQuery
+		ok       bool
+	}{
+		{query: `sum_over_time(up[7d])`, expected: instantQuery{function: "sum_over_time", selector: "up", rng: 7 * 24 * time.Hour}, ok: true},
+		{query: `(max_over_time(up{job="a"}[2d]))`, expected: instantQuery{function: "max_over_time", selector: `up{job="a"}`, rng: 48 * time.Hour}, ok: true},
+		{query: `sum_over_time(up[1d])`},
+		{query: `sum_over_time(up[7d] offset 1d)`},
+		{query: `min_over_time(up[7d])`},
+		{query: `avg_over_time(up[7d])`},
+		{query: `sum(sum_over_time(up[7d]))`},
+		{query: `sum_over_time(up[7d]) / 2`},
+		{query: `sum_over_time(`},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			q, ok := s.analyze(tcase.query)
+			testutil.Equals(t, tcase.ok, ok)
+			testutil.Equals(t, tcase.expected, q)
+		})
+	}
+
+	_, err = NewInstantSplitter(log.NewNopLogger(), nil, nil, InstantSplitConfig{
+		Interval:    24 * time.Hour,
+		Functions:   []string{"avg_over_time"},
+		Concurrency: 1,
+	}, http.NotFoundHandler())
+	testutil.NotOk(t, err)
+}
+
+func TestInstantSplitter(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		parts []string
+		flaky = map[string]bool{}
+	)
+	querier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Ok(t, r.ParseForm())
+		// Parts are executed as range queries of a single step.
+		testutil.Equals(t, "/api/v1/query_range", r.URL.Path)
+		testutil.Equals(t, r.Form.Get("start"), r.Form.Get("end"))
+		testutil.Equals(t, "true", r.Form.Get("dedup"))
+
+		q, ts := r.Form.Get("query"), r.Form.Get("start")
+		mtx.Lock()
+		parts = append(parts, q+"@"+ts)
+		failed := flaky[q+"@"+ts]
+		flaky[q+"@"+ts] = true
+		mtx.Unlock()
+
+		if strings.HasPrefix(q, "max_over_time(fail") || (strings.HasPrefix(q, "sum_over_time(flaky") && !failed) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"unavailable","error":"no store"}`))
+			return
+		}
+
+		// Only the most recent part has a second series.
+		result := `[{"metric":{"pod":"a"},"values":[[` + ts + `,"2"]]}]`
+		if ts == "360" {
+			result = `[{"metric":{"pod":"a"},"values":[[360,"5"]]},{"metric":{"pod":"b"},"values":[[360,"1"]]}]`
+		}
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":%s}}`, result)
+	}))
+	defer querier.Close()
+
+	u, err := url.Parse(querier.URL)
+	testutil.Ok(t, err)
+
+	var nextCalled bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+		w.WriteHeader(http.StatusTeapot)
+	})
+	retry := NewRetryMiddleware(log.NewNopLogger(), nil, RetryConfig{MaxRetries: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	h, err := NewInstantSplitter(log.NewNopLogger(), nil, retry(NewDownstream(log.NewNopLogger(), querier.Client(), u)), InstantSplitConfig{
+		Interval:    time.Minute,
+		Functions:   SplittableFunctions(),
+		Concurrency: 2,
+	}, next)
+	testutil.Ok(t, err)
+
+	query := func(q string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		params := url.Values{"query": []string{q}, "time": []string{"360"}, "dedup": []string{"true"}}
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/query?"+params.Encode(), nil))
+		return rec
+	}
+
+	t.Run("sum", func(t *testing.T) {
+		parts = nil
+		rec := query(`sum_over_time(up[150s])`)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		testutil.Assert(t, !nextCalled, "split query must not be handled by next handler")
+
+		sort.Strings(parts)
+		testutil.Equals(t, []string{
+			"sum_over_time(up[30000ms])@240",
+			"sum_over_time(up[59999ms])@300",
+			"sum_over_time(up[59999ms])@360",
+		}, parts)
+
+		var res InstantResponse
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		testutil.Equals(t, statusSuccess, res.Status)
+		testutil.Equals(t, 2, len(res.Data.Result))
+		testutil.Equals(t, `{pod="a"} => 9 @[360]`, res.Data.Result[0].String())
+		testutil.Equals(t, `{pod="b"} => 1 @[360]`, res.Data.Result[1].String())
+	})
+	t.Run("max", func(t *testing.T) {
+		rec := query(`max_over_time(up[150s])`)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+
+		var res InstantResponse
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		testutil.Equals(t, `{pod="a"} => 5 @[360]`, res.Data.Result[0].String())
+	})
+	t.Run("retried part", func(t *testing.T) {
+		parts = nil
+		rec := query(`sum_over_time(flaky[150s])`)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		// Every part failed once and was retried through the middlewares.
+		testutil.Equals(t, 6, len(parts))
+
+		var res InstantResponse
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		testutil.Equals(t, `{pod="a"} => 9 @[360]`, res.Data.Result[0].String())
+	})
+	t.Run("failed part", func(t *testing.T) {
+		rec := query(`max_over_time(fail[150s])`)
+		testutil.Equals(t, http.StatusServiceUnavailable, rec.Code)
+		testutil.Equals(t, `{"status":"error","errorType":"unavailable","error":"no store"}`, rec.Body.String())
+	})
+	t.Run("not splittable", func(t *testing.T) {
+		rec := query(`sum_over_time(up[30s])`)
+		testutil.Equals(t, http.StatusTeapot, rec.Code)
+		testutil.Assert(t, nextCalled, "query must be handled by next handler")
+	})
+}
@@ -0,0 +1,249 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metadataCache caches responses of label names, label values and series requests.
+type metadataCache struct {
+	logger        log.Logger
+	cache         Cache
+	alignment     int64
+	validity      time.Duration
+	maxFreshness  time.Duration
+	tenantHeaders []string
+	next          http.Handler
+
+	requests *prometheus.CounterVec
+	hits     *prometheus.CounterVec
+
+	now func() time.Time
+}
+
+// NewMetadataCache returns a handler caching responses of /api/v1/labels, /api/v1/label/<name>/values and
+// /api/v1/series requests in the given cache. All other requests, and requests missing the cache, are handled by
+// the next handler.
+//
+// The time range of requests is extended to multiples of the given alignment, so that requests of the same
+// metadata at slightly different times, e.g. of dashboard variables refreshed every minute, share cache keys. As
+// the alignment extends the range, responses may include metadata of series outside of the requested range.
+//
+// Responses of requests ending more recently than the maximum freshness, or without range, are cached only for the
+// maximum freshness, others for the validity of the cache.
+func NewMetadataCache(logger log.Logger, reg prometheus.Registerer, cache Cache, config ResponseCacheConfig, alignment time.Duration, next http.Handler) http.Handler {
+	m := &metadataCache{
+		logger:        logger,
+		cache:         cache,
+		alignment:     int64(alignment / time.Millisecond),
+		validity:      config.Validity,
+		maxFreshness:  config.MaxFreshness,
+		tenantHeaders: config.TenantHeaders,
+		next:          next,
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_metadata_cache_requests_total",
+			Help: "Total number of metadata requests looked up in the response cache.",
+		}, []string{"endpoint"}),
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_metadata_cache_hits_total",
+			Help: "Total number of metadata requests whose response was found in the response cache.",
+		}, []string{"endpoint"}),
+		now: time.Now,
+	}
+	for _, e := range []string{endpointLabels, endpointLabelValues, endpointSeries} {
+		m.requests.WithLabelValues(e)
+		m.hits.WithLabelValues(e)
+	}
+	return m
+}
+
+const (
+	endpointLabels      = "labels"
+	endpointLabelValues = "label_values"
+	endpointSeries      = "series"
+)
+
+// metadataEndpoint returns the metadata endpoint of the given path, if any.
+func metadataEndpoint(path string) (string, bool) {
+	switch {
+	case strings.HasSuffix(path, "/api/v1/labels"):
+		return endpointLabels, true
+	case strings.HasSuffix(path, "/api/v1/series"):
+		return endpointSeries, true
+	case strings.HasSuffix(path, "/values") && strings.Contains(path, "/api/v1/label/"):
+		return endpointLabelValues, true
+	}
+	return "", false
+}
+
+func (m *metadataCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := metadataEndpoint(r.URL.Path)
+	if !ok || (r.Method != http.MethodGet && r.Method != http.MethodPost) {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	params, end, err := m.align(r.Form)
+	if err != nil {
+		// Invalid requests are answered by the querier.
+		m.next.ServeHTTP(w, r)
+		return
+	}
+	key := metadataCacheKey(r.URL.Path, params, r.Header, m.tenantHeaders)
+
+	m.requests.WithLabelValues(endpoint).Inc()
+	if data, ok := m.cache.Fetch(r.Context(), []string{key})[key]; ok {
+		m.hits.WithLabelValues(endpoint).Inc()
+		writeJSON(m.logger, w, http.StatusOK, data)
+		return
+	}
+
+	// Requests are sent with aligned ranges, so that cached responses are the same for all requests of a key.
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.URL.RawQuery = params.Encode()
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	req.Header.Del("Content-Type")
+	req.Header.Del("Content-Length")
+	// Responses are cached, so they must not be compressed.
+	req.Header.Del("Accept-Encoding")
+
+	rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	m.next.ServeHTTP(rec, req)
+
+	if rec.status == http.StatusOK && cacheableMetadata(rec.body.Bytes()) {
+		ttl := m.validity
+		if end == 0 || end > timestamp(m.now().Add(-m.maxFreshness)) {
+			ttl = m.maxFreshness
+		}
+		if ttl > 0 {
+			m.cache.Store(r.Context(), key, rec.body.Bytes(), ttl)
+		}
+	}
+
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.status)
+	if _, err := w.Write(rec.body.Bytes()); err != nil {
+		level.Error(m.logger).Log("msg", "failed to write metadata response", "err", err)
+	}
+}
+
+// align returns the given parameters with start and end extended to multiples of the alignment, as well as the
+// aligned end in milliseconds, or zero if there is none.
+func (m *metadataCache) align(form url.Values) (url.Values, int64, error) {
+	params := url.Values{}
+	for k, v := range form {
+		params[k] = v
+	}
+
+	var end int64
+	if s := form.Get("start"); s != "" {
+		start, err := parseTime(s)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "param start")
+		}
+		params.Set("start", formatTime(start-mod(start, m.alignment)))
+	}
+	if s := form.Get("end"); s != "" {
+		var err error
+		end, err = parseTime(s)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "param end")
+		}
+		if r := mod(end, m.alignment); r != 0 {
+			end += m.alignment - r
+		}
+		params.Set("end", formatTime(end))
+	}
+	return params, end, nil
+}
+
+// mod returns the non-negative remainder of t divided by the given interval.
+func mod(t, interval int64) int64 {
+	return ((t % interval) + interval) % interval
+}
+
+// cacheableMetadata returns whether the given response is complete, so that it can be cached.
+func cacheableMetadata(body []byte) bool {
+	var res struct {
+		Status   string   `json:"status"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return false
+	}
+	return res.Status == statusSuccess && len(res.Warnings) == 0
+}
+
+// metadataCacheKey returns the key of the response to the request of the given path, parameters and headers, which
+// includes the tenant of the request determined from the given tenant headers.
+func metadataCacheKey(path string, params url.Values, header http.Header, tenantHeaders []string) string {
+	names := make([]string, 0, len(params))
+	for k := range params {
+		if _, ok := uncachedParams[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	_, _ = h.Write([]byte(path))
+	_, _ = h.Write([]byte{0})
+	for _, k := range names {
+		_, _ = h.Write([]byte(k))
+		// The order of series matchers does not change the response.
+		vs := append([]string(nil), params[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			_, _ = h.Write([]byte{1})
+			_, _ = h.Write([]byte(v))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	writeTenant(h, header, tenantHeaders)
+	return "qfe-meta:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder records the response of a handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) { r.status = status }
+
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func writeJSON(logger log.Logger, w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		level.Error(logger).Log("msg", "failed to write response", "err", err)
+	}
+}
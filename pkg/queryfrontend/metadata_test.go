@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type mockCache struct {
+	mtx   sync.Mutex
+	items map[string][]byte
+	ttls  map[string]time.Duration
+}
+
+func newMockCache() *mockCache {
+	return &mockCache{items: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *mockCache) Fetch(_ context.Context, keys []string) map[string][]byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	found := map[string][]byte{}
+	for _, k := range keys {
+		if v, ok := c.items[k]; ok {
+			found[k] = v
+		}
+	}
+	return found
+}
+
+func (c *mockCache) Store(_ context.Context, key string, data []byte, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.items[key] = data
+	c.ttls[key] = ttl
+}
+
+func (c *mockCache) Stop() {}
+
+func TestMetadataCache(t *testing.T) {
+	var requests []*http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Ok(t, r.ParseForm())
+		requests = append(requests, r)
+		switch {
+		case r.Form.Get("match[]") == "partial":
+			_, _ = w.Write([]byte(`{"status":"success","data":[],"warnings":["store unavailable"]}`))
+		case r.URL.Path == "/api/v1/status/flags":
+			_, _ = w.Write([]byte(`{"status":"success","data":{}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":["__name__","pod"]}`))
+		}
+	})
+
+	cache := newMockCache()
+	config := ResponseCacheConfig{Validity: 24 * time.Hour, MaxFreshness: time.Minute, TenantHeaders: []string{"X-Scope-OrgID"}}
+	h := NewMetadataCache(log.NewNopLogger(), nil, cache, config, time.Hour, next).(*metadataCache)
+	now := time.Unix(100*3600, 0)
+	h.now = func() time.Time { return now }
+
+	get := func(path string, params url.Values) string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil))
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	t.Run("aligned", func(t *testing.T) {
+		requests = nil
+		body := get("/api/v1/labels", url.Values{"start": {"36010"}, "end": {"43190.5"}})
+		testutil.Equals(t, `{"status":"success","data":["__name__","pod"]}`, body)
+		testutil.Equals(t, 1, len(requests))
+		testutil.Equals(t, "36000", requests[0].Form.Get("start"))
+		testutil.Equals(t, "43200", requests[0].Form.Get("end"))
+
+		// Requests of the same aligned range share the cached response.
+		testutil.Equals(t, body, get("/api/v1/labels", url.Values{"start": {"36500"}, "end": {"43100"}}))
+		testutil.Equals(t, 1, len(requests))
+
+		for k, ttl := range cache.ttls {
+			testutil.Equals(t, config.Validity, ttl, k)
+		}
+	})
+	t.Run("recent", func(t *testing.T) {
+		requests = nil
+		cache.ttls = map[string]time.Duration{}
+		get("/api/v1/label/pod/values", url.Values{"start": {"356400"}, "end": {"360000"}})
+		get("/api/v1/label/pod/values", nil)
+		testutil.Equals(t, 2, len(requests))
+		testutil.Equals(t, 2, len(cache.ttls))
+		for k, ttl := range cache.ttls {
+			testutil.Equals(t, config.MaxFreshness, ttl, k)
+		}
+	})
+	t.Run("series", func(t *testing.T) {
+		requests = nil
+		post := func(form url.Values) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			testutil.Equals(t, http.StatusOK, rec.Code)
+		}
+		post(url.Values{"match[]": {"up", "down"}, "start": {"0"}, "end": {"3600"}})
+		post(url.Values{"match[]": {"down", "up"}, "start": {"0"}, "end": {"3600"}, "timeout": {"1m"}})
+		testutil.Equals(t, 1, len(requests))
+		testutil.Equals(t, http.MethodGet, requests[0].Method)
+		testutil.Equals(t, []string{"up", "down"}, requests[0].Form["match[]"])
+
+		// Partial responses are not cached.
+		get("/api/v1/series", url.Values{"match[]": {"partial"}, "start": {"0"}, "end": {"3600"}})
+		get("/api/v1/series", url.Values{"match[]": {"partial"}, "start": {"0"}, "end": {"3600"}})
+		testutil.Equals(t, 3, len(requests))
+	})
+	t.Run("tenants", func(t *testing.T) {
+		requests = nil
+		getAs := func(header http.Header) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/labels?start=0&end=3600", nil)
+			for k, v := range header {
+				r.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			testutil.Equals(t, http.StatusOK, rec.Code)
+		}
+		getAs(http.Header{"X-Scope-Orgid": {"team-a"}})
+		getAs(http.Header{"X-Scope-Orgid": {"team-a"}})
+		testutil.Equals(t, 1, len(requests))
+
+		// Responses are not shared with other tenants, or with requests authorized differently.
+		getAs(http.Header{"X-Scope-Orgid": {"team-b"}})
+		testutil.Equals(t, 2, len(requests))
+		getAs(http.Header{"Authorization": {"Bearer token"}})
+		testutil.Equals(t, 3, len(requests))
+		getAs(nil)
+		testutil.Equals(t, 4, len(requests))
+	})
+	t.Run("other", func(t *testing.T) {
+		requests = nil
+		get("/api/v1/status/flags", nil)
+		get("/api/v1/status/flags", nil)
+		testutil.Equals(t, 2, len(requests))
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/querylog"
+)
+
+type slowQueryLogger struct {
+	log  *querylog.SlowQueryLog
+	next http.Handler
+}
+
+// NewSlowQueryLogger returns a handler logging the instant and range queries handled by the next handler to the
+// given log, if they were slow. Queries are logged with the number of series and samples of their result, the same
+// way queriers log them.
+func NewSlowQueryLogger(l *querylog.SlowQueryLog, next http.Handler) http.Handler {
+	return &slowQueryLogger{log: l, next: next}
+}
+
+func (s *slowQueryLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	instant := strings.HasSuffix(r.URL.Path, instantQueryPath)
+	if !instant && !strings.HasSuffix(r.URL.Path, rangeQueryPath) {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	params, err := queryParams(r)
+	if err != nil {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+
+	begin := time.Now()
+	tw := &teeResponseWriter{ResponseWriter: w}
+	s.next.ServeHTTP(tw, r)
+	d := time.Since(begin)
+	if !s.log.Slow(d) {
+		return
+	}
+
+	e := querylog.Entry{Query: params.Get("query"), Duration: d}
+	if instant {
+		t := timestamp(begin)
+		if v := params.Get("time"); v != "" {
+			if t, err = parseTime(v); err != nil {
+				return
+			}
+		}
+		e.Start, e.End = millisToTime(t), millisToTime(t)
+	} else {
+		start, err := parseTime(params.Get("start"))
+		if err != nil {
+			return
+		}
+		end, err := parseTime(params.Get("end"))
+		if err != nil {
+			return
+		}
+		step, err := parseDuration(params.Get("step"))
+		if err != nil {
+			return
+		}
+		e.Start, e.End, e.Step = millisToTime(start), millisToTime(end), time.Duration(step)*time.Millisecond
+	}
+	e.Series, e.Samples = responseStats(tw.Header().Get("Content-Encoding"), tw.body.Bytes())
+	s.log.LogRequest(r, e)
+}
+
+// queryParams returns the parameters of the given query request without consuming its body.
+func queryParams(r *http.Request) (url.Values, error) {
+	params := r.URL.Query()
+	if r.Method != http.MethodPost || r.Body == nil {
+		return params, nil
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/x-www-form-urlencoded" {
+		return params, nil
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+	// Parameters of the body take precedence, as in http.Request.FormValue.
+	for k, v := range params {
+		form[k] = append(form[k], v...)
+	}
+	return form, nil
+}
+
+// responseStats returns the number of series and samples of the result of the given query response, encoded as
+// with the given content encoding. Instant vectors have one sample per series and scalars a single sample without a
+// series, as in querylog.ResultStats.
+func responseStats(encoding string, body []byte) (series, samples int64) {
+	var r io.Reader = bytes.NewReader(body)
+	if encoding == "gzip" {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, 0
+		}
+		r = gr
+	}
+
+	var res struct {
+		Data struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		return 0, 0
+	}
+
+	switch res.Data.ResultType {
+	case model.ValMatrix.String():
+		var m model.Matrix
+		if err := json.Unmarshal(res.Data.Result, &m); err != nil {
+			return 0, 0
+		}
+		for _, s := range m {
+			series++
+			samples += int64(len(s.Values))
+		}
+	case model.ValVector.String():
+		var v model.Vector
+		if err := json.Unmarshal(res.Data.Result, &v); err != nil {
+			return 0, 0
+		}
+		series = int64(len(v))
+		samples = series
+	case model.ValScalar.String():
+		samples = 1
+	}
+	return series, samples
+}
+
+func millisToTime(t int64) time.Time {
+	return time.Unix(0, t*int64(time.Millisecond)).UTC()
+}
+
+// teeResponseWriter writes responses through to the wrapped writer and records their body.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	_, _ = w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/querylog"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSlowQueryLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slow-query-logger")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	path := filepath.Join(dir, "slow.log")
+	l, err := querylog.NewSlowQueryLog(log.NewNopLogger(), nil, querylog.Config{Threshold: time.Nanosecond, Path: path})
+	testutil.Ok(t, err)
+
+	var queries []string
+	logger := NewSlowQueryLogger(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		// The body of the request is left to the next handler.
+		queries = append(queries, r.FormValue("query"))
+		switch r.URL.Path {
+		case "/api/v1/query":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"pod":"a"},"value":[10,"1"]},{"metric":{"pod":"b"},"value":[10,"2"]}]}}`))
+		case "/api/v1/query_range":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+				`{"metric":{"pod":"a"},"values":[[0,"1"],[15,"2"],[30,"3"]]}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":["__name__"]}`))
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	logger.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+url.Values{
+		"query": {"up"}, "start": {"0"}, "end": {"30"}, "step": {"15s"},
+	}.Encode(), nil))
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(url.Values{"query": {"sum(up)"}, "time": {"10"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	logger.ServeHTTP(rec, req)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Assert(t, strings.Contains(rec.Body.String(), `"vector"`), "response not written through")
+
+	// Other requests are not logged.
+	logger.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/labels", nil))
+
+	testutil.Equals(t, []string{"up", "sum(up)", ""}, queries)
+	testutil.Ok(t, l.Close())
+
+	b, err := ioutil.ReadFile(path)
+	testutil.Ok(t, err)
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	testutil.Equals(t, 2, len(lines))
+
+	var entries []map[string]interface{}
+	for _, line := range lines {
+		var e map[string]interface{}
+		testutil.Ok(t, json.Unmarshal(line, &e))
+		entries = append(entries, e)
+	}
+	testutil.Equals(t, "up", entries[0]["query"])
+	testutil.Equals(t, "1970-01-01T00:00:00Z", entries[0]["start"])
+	testutil.Equals(t, "1970-01-01T00:00:30Z", entries[0]["end"])
+	testutil.Equals(t, 15.0, entries[0]["step_seconds"])
+	testutil.Equals(t, 1.0, entries[0]["series"])
+	testutil.Equals(t, 3.0, entries[0]["samples"])
+
+	testutil.Equals(t, "sum(up)", entries[1]["query"])
+	testutil.Equals(t, "1970-01-01T00:00:10Z", entries[1]["start"])
+	testutil.Equals(t, "1970-01-01T00:00:10Z", entries[1]["end"])
+	testutil.Equals(t, 0.0, entries[1]["step_seconds"])
+	testutil.Equals(t, 2.0, entries[1]["series"])
+	testutil.Equals(t, 2.0, entries[1]["samples"])
+}
@@ -0,0 +1,254 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	statusSuccess = "success"
+	statusError   = "error"
+
+	errorBadData  = "bad_data"
+	errorCanceled = "canceled"
+	errorInternal = "internal"
+	errorTimeout  = "timeout"
+)
+
+// RangeRequest is a range query request of the query API.
+type RangeRequest struct {
+	// Path is the path of the request, e.g. /api/v1/query_range.
+	Path string
+	// Start, End and Step are in milliseconds.
+	Start int64
+	End   int64
+	Step  int64
+	Query string
+	// Params are all other parameters of the request, e.g. dedup, partial_response or max_source_resolution. They
+	// are passed to the querier as they are.
+	Params url.Values
+	// Headers are passed to the querier as they are.
+	Headers http.Header
+}
+
+// WithStartEnd returns a copy of the request with the given start and end.
+func (r *RangeRequest) WithStartEnd(start, end int64) *RangeRequest {
+	c := *r
+	c.Start, c.End = start, end
+	return &c
+}
+
+// ParseRangeRequest parses the range query request of the given HTTP request.
+func ParseRangeRequest(r *http.Request) (*RangeRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "parse form")
+	}
+
+	req := &RangeRequest{
+		Path:    r.URL.Path,
+		Query:   r.Form.Get("query"),
+		Params:  url.Values{},
+		Headers: r.Header,
+	}
+	var err error
+	if req.Start, err = parseTime(r.Form.Get("start")); err != nil {
+		return nil, errors.Wrap(err, "param start")
+	}
+	if req.End, err = parseTime(r.Form.Get("end")); err != nil {
+		return nil, errors.Wrap(err, "param end")
+	}
+	if req.End < req.Start {
+		return nil, errors.New("end timestamp must not be before start time")
+	}
+	if req.Step, err = parseDuration(r.Form.Get("step")); err != nil {
+		return nil, errors.Wrap(err, "param step")
+	}
+	if req.Step <= 0 {
+		return nil, errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")
+	}
+
+	for k, v := range r.Form {
+		switch k {
+		case "query", "start", "end", "step":
+			continue
+		}
+		req.Params[k] = v
+	}
+	return req, nil
+}
+
+// Values returns the parameters of the request.
+func (r *RangeRequest) Values() url.Values {
+	v := url.Values{}
+	for k, vs := range r.Params {
+		v[k] = vs
+	}
+	v.Set("query", r.Query)
+	v.Set("start", formatTime(r.Start))
+	v.Set("end", formatTime(r.End))
+	v.Set("step", strconv.FormatFloat(float64(r.Step)/1000, 'f', -1, 64))
+	return v
+}
+
+// RangeResponse is a response of the query API to a range query.
+type RangeResponse struct {
+	Status    string    `json:"status"`
+	Data      RangeData `json:"data,omitempty"`
+	ErrorType string    `json:"errorType,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Warnings  []string  `json:"warnings,omitempty"`
+}
+
+// RangeData is the result of a range query.
+type RangeData struct {
+	ResultType string       `json:"resultType"`
+	Result     model.Matrix `json:"result"`
+}
+
+// Error is returned for responses of the querier with an error status code, so that they can be passed to the
+// client as they are.
+type Error struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	return string(e.Body)
+}
+
+// newError returns an error with a body in the format of the query API.
+func newError(statusCode int, errorType string, err error) *Error {
+	b, _ := json.Marshal(&RangeResponse{Status: statusError, ErrorType: errorType, Error: err.Error()})
+	return &Error{StatusCode: statusCode, Body: b}
+}
+
+// Handler executes range query requests.
+type Handler interface {
+	Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error)
+}
+
+// HandlerFunc is a Handler implemented by a function.
+type HandlerFunc func(ctx context.Context, r *RangeRequest) (*RangeResponse, error)
+
+// Do implements Handler.
+func (f HandlerFunc) Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error) {
+	return f(ctx, r)
+}
+
+// Middleware wraps a Handler, e.g. to cache its responses.
+type Middleware func(Handler) Handler
+
+// MergeMiddlewares returns a Middleware applying the given middlewares in order, the first one being the outermost.
+func MergeMiddlewares(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// downstream executes range query requests against the query API of a querier.
+type downstream struct {
+	logger log.Logger
+	client *http.Client
+	url    *url.URL
+}
+
+// NewDownstream returns a Handler sending range query requests to the querier at the given URL.
+func NewDownstream(logger log.Logger, client *http.Client, u *url.URL) Handler {
+	return &downstream{logger: logger, client: client, url: u}
+}
+
+func (d *downstream) Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error) {
+	res := &RangeResponse{}
+	if err := d.get(ctx, r.Path, r.Values(), r.Headers, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// get sends a GET request of the given path, parameters and headers to the querier and decodes its response into
+// res.
+func (d *downstream) get(ctx context.Context, path string, params url.Values, headers http.Header, res interface{}) error {
+	u := *d.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	// Responses are decoded, so they must not be compressed.
+	req.Header.Del("Accept-Encoding")
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "send request to querier")
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(d.logger, resp.Body, "querier response body")
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response of querier")
+	}
+	if resp.StatusCode/100 != 2 {
+		return &Error{StatusCode: resp.StatusCode, Body: body}
+	}
+
+	if err := json.Unmarshal(body, res); err != nil {
+		return errors.Wrap(err, "decode response of querier")
+	}
+	return nil
+}
+
+// parseTime parses a timestamp the same way the query API does and returns it in milliseconds.
+func parseTime(s string) (int64, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		s, ns := math.Modf(t)
+		ns = math.Round(ns*1000) / 1000
+		return time.Unix(int64(s), int64(ns*float64(time.Second))).UnixNano() / int64(time.Millisecond), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+	return 0, errors.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration parses a duration the same way the query API does and returns it in milliseconds.
+func parseDuration(s string) (int64, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		ts := d * float64(time.Second/time.Millisecond)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, errors.Errorf("cannot parse %q to a valid duration. It overflows int64", s)
+		}
+		return int64(ts), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return int64(time.Duration(d) / time.Millisecond), nil
+	}
+	return 0, errors.Errorf("cannot parse %q to a valid duration", s)
+}
+
+func formatTime(t int64) string {
+	return strconv.FormatFloat(float64(t)/1000, 'f', -1, 64)
+}
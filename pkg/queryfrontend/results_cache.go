@@ -0,0 +1,161 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// uncachedParams are parameters not changing the result of a query, so they are not part of cache keys.
+var uncachedParams = map[string]struct{}{
+	"timeout": {},
+}
+
+type resultsCache struct {
+	logger        log.Logger
+	cache         Cache
+	validity      time.Duration
+	maxFreshness  time.Duration
+	tenantHeaders []string
+	next          Handler
+
+	requests prometheus.Counter
+	hits     prometheus.Counter
+
+	now func() time.Time
+}
+
+// NewResultsCacheMiddleware returns a Middleware caching responses of range queries in the given cache.
+//
+// Only complete responses are cached, so responses with warnings, e.g. partial responses, are not. Responses of
+// queries ending more recently than the maximum freshness or the max_source_resolution of the query are not cached,
+// as they may still change, e.g. because of late samples or blocks yet to be downsampled.
+func NewResultsCacheMiddleware(logger log.Logger, reg prometheus.Registerer, cache Cache, config ResponseCacheConfig) Middleware {
+	requests := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_cache_requests_total",
+		Help: "Total number of range queries looked up in the response cache.",
+	})
+	hits := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_cache_hits_total",
+		Help: "Total number of range queries whose response was found in the response cache.",
+	})
+
+	return func(next Handler) Handler {
+		return &resultsCache{
+			logger:        logger,
+			cache:         cache,
+			validity:      config.Validity,
+			maxFreshness:  config.MaxFreshness,
+			tenantHeaders: config.TenantHeaders,
+			next:          next,
+			requests:      requests,
+			hits:          hits,
+			now:           time.Now,
+		}
+	}
+}
+
+func (c *resultsCache) Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error) {
+	key := cacheKey(r, c.tenantHeaders)
+
+	c.requests.Inc()
+	if data, ok := c.cache.Fetch(ctx, []string{key})[key]; ok {
+		res := &RangeResponse{}
+		if err := json.Unmarshal(data, res); err == nil {
+			c.hits.Inc()
+			return res, nil
+		}
+		level.Warn(c.logger).Log("msg", "failed to decode cached response", "key", key)
+	}
+
+	res, err := c.next.Do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if !c.cacheable(r, res) {
+		return res, nil
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to encode response", "err", err)
+		return res, nil
+	}
+	c.cache.Store(ctx, key, data, c.validity)
+	return res, nil
+}
+
+// cacheable returns whether the response of the given request must not change anymore, so that it can be cached.
+func (c *resultsCache) cacheable(r *RangeRequest, res *RangeResponse) bool {
+	if res.Status != statusSuccess || len(res.Warnings) > 0 {
+		return false
+	}
+
+	freshness := c.maxFreshness
+	if resolution := maxSourceResolution(r); resolution > freshness {
+		freshness = resolution
+	}
+	return r.End <= timestamp(c.now().Add(-freshness))
+}
+
+// maxSourceResolution returns the max_source_resolution of the given request the same way the query API does, or
+// zero if it is not set or invalid.
+func maxSourceResolution(r *RangeRequest) time.Duration {
+	switch v := r.Params.Get("max_source_resolution"); v {
+	case "":
+		return 0
+	case "auto":
+		// The query API fits at least 5 samples between steps.
+		return time.Duration(r.Step/5) * time.Millisecond
+	default:
+		d, err := parseDuration(v)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(d) * time.Millisecond
+	}
+}
+
+// cacheKey returns the key of the response to the given request, which includes the tenant of the request determined
+// from the given headers.
+func cacheKey(r *RangeRequest, tenantHeaders []string) string {
+	params := make([]string, 0, len(r.Params))
+	for k := range r.Params {
+		if _, ok := uncachedParams[k]; !ok {
+			params = append(params, k)
+		}
+	}
+	sort.Strings(params)
+
+	h := sha256.New()
+	for _, s := range []string{r.Path, r.Query, strconv.FormatInt(r.Start, 10), strconv.FormatInt(r.End, 10), strconv.FormatInt(r.Step, 10)} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	for _, k := range params {
+		_, _ = h.Write([]byte(k))
+		for _, v := range r.Params[k] {
+			_, _ = h.Write([]byte{1})
+			_, _ = h.Write([]byte(v))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	writeTenant(h, r.Headers, tenantHeaders)
+	return "qfe:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
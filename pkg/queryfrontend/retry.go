@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RetryConfig configures retries of range queries failed by the querier.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries of a single query. 0 disables retries.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Validate returns error if configuration is invalid.
+func (c RetryConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return errors.New("max retries cannot be negative")
+	}
+	if c.MinBackoff <= 0 || c.MaxBackoff <= 0 {
+		return errors.New("backoff must be positive")
+	}
+	if c.MinBackoff > c.MaxBackoff {
+		return errors.New("min backoff cannot be greater than max backoff")
+	}
+	return nil
+}
+
+type retry struct {
+	logger log.Logger
+	conf   RetryConfig
+	next   Handler
+
+	retries prometheus.Counter
+}
+
+// NewRetryMiddleware returns a Middleware retrying range queries with exponential backoff and jitter, as long as they
+// fail with a retryable error, e.g. because a querier restarts.
+func NewRetryMiddleware(logger log.Logger, reg prometheus.Registerer, conf RetryConfig) Middleware {
+	retries := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_retries_total",
+		Help: "Total number of retried range queries.",
+	})
+
+	return func(next Handler) Handler {
+		return &retry{
+			logger:  logger,
+			conf:    conf,
+			next:    next,
+			retries: retries,
+		}
+	}
+}
+
+func (r *retry) Do(ctx context.Context, req *RangeRequest) (*RangeResponse, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := r.next.Do(ctx, req)
+		if err == nil {
+			return res, nil
+		}
+		if attempt >= r.conf.MaxRetries || !IsRetryableErr(err) {
+			return nil, err
+		}
+
+		backoff := r.backoff(attempt)
+		level.Debug(r.logger).Log("msg", "retrying range query", "query", req.Query, "attempt", attempt+1, "backoff", backoff, "err", err)
+		r.retries.Inc()
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// backoff returns time to wait before the given retry attempt, starting from 0.
+func (r *retry) backoff(attempt int) time.Duration {
+	d := r.conf.MinBackoff
+	for i := 0; i < attempt && d < r.conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.conf.MaxBackoff {
+		d = r.conf.MaxBackoff
+	}
+	// Jitter the backoff to [d/2, d) to not synchronize retries of concurrent queries.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsRetryableErr returns whether a range query failed with the given error may succeed when retried. Errors of
+// requests to the querier, e.g. refused connections of a restarting querier, are retryable, as well as responses
+// with a status code of 429 or 5xx, unless the querier answers that the query was canceled or timed out, as
+// retrying such expensive queries would only add load.
+func IsRetryableErr(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	e, ok := errors.Cause(err).(*Error)
+	if !ok {
+		return true
+	}
+	if e.StatusCode != http.StatusTooManyRequests && e.StatusCode/100 != 5 {
+		return false
+	}
+
+	var res RangeResponse
+	if err := json.Unmarshal(e.Body, &res); err != nil {
+		// Errors of e.g. load balancers in front of queriers are not in the format of the query API.
+		return true
+	}
+	return res.ErrorType != errorCanceled && res.ErrorType != errorTimeout
+}
@@ -0,0 +1,81 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestIsRetryableErr(t *testing.T) {
+	for _, tcase := range []struct {
+		err       error
+		retryable bool
+	}{
+		{err: errors.Wrap(errors.New("connection refused"), "send request to querier"), retryable: true},
+		{err: context.Canceled},
+		{err: errors.Wrap(context.DeadlineExceeded, "send request to querier")},
+		{err: &Error{StatusCode: http.StatusBadGateway, Body: []byte("bad gateway")}, retryable: true},
+		{err: &Error{StatusCode: http.StatusTooManyRequests}, retryable: true},
+		{err: newError(http.StatusInternalServerError, errorInternal, errors.New("internal")), retryable: true},
+		{err: newError(http.StatusServiceUnavailable, errorTimeout, errors.New("timeout"))},
+		{err: newError(http.StatusServiceUnavailable, errorCanceled, errors.New("canceled"))},
+		{err: newError(http.StatusBadRequest, errorBadData, errors.New("bad data"))},
+		{err: &Error{StatusCode: http.StatusUnprocessableEntity}},
+	} {
+		testutil.Equals(t, tcase.retryable, IsRetryableErr(tcase.err), "%v", tcase.err)
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	var attempts int
+	failures := []error{
+		errors.New("connection refused"),
+		&Error{StatusCode: http.StatusBadGateway},
+		newError(http.StatusBadRequest, errorBadData, errors.New("bad data")),
+	}
+	next := HandlerFunc(func(context.Context, *RangeRequest) (*RangeResponse, error) {
+		attempts++
+		if attempts <= len(failures) {
+			return nil, failures[attempts-1]
+		}
+		return &RangeResponse{Status: statusSuccess}, nil
+	})
+	conf := RetryConfig{MaxRetries: 5, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	testutil.Ok(t, conf.Validate())
+	h := NewRetryMiddleware(log.NewNopLogger(), nil, conf)(next).(*retry)
+
+	// Retryable errors are retried until a terminal error.
+	_, err := h.Do(context.Background(), &RangeRequest{})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, failures[2], err)
+	testutil.Equals(t, 3, attempts)
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(h.retries))
+
+	res, err := h.Do(context.Background(), &RangeRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, statusSuccess, res.Status)
+
+	// Retries are limited.
+	attempts = 0
+	failures = []error{errors.New("a"), errors.New("b"), errors.New("c")}
+	h.conf.MaxRetries = 1
+	_, err = h.Do(context.Background(), &RangeRequest{})
+	testutil.Equals(t, failures[1], err)
+	testutil.Equals(t, 2, attempts)
+
+	for i := 0; i < 10; i++ {
+		b := h.backoff(i)
+		testutil.Assert(t, b <= conf.MaxBackoff, "backoff %v exceeds max backoff", b)
+	}
+	testutil.NotOk(t, RetryConfig{MaxRetries: 1, MinBackoff: time.Second, MaxBackoff: time.Millisecond}.Validate())
+}
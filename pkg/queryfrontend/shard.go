@@ -0,0 +1,89 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/thanos-io/thanos/pkg/querysharding"
+)
+
+type sharding struct {
+	logger log.Logger
+	shards uint64
+	next   Handler
+
+	shardedQueries prometheus.Counter
+}
+
+// NewShardingMiddleware returns a Middleware executing range queries whose aggregations group by common labels, e.g.
+// sum by (pod) (rate(http_requests_total[5m])), as the given number of shards in parallel. Every shard selects the
+// series whose values of these labels hash to it, so that the results of shards are disjoint and are concatenated.
+//
+// Queriers must support the shard parameter.
+func NewShardingMiddleware(logger log.Logger, reg prometheus.Registerer, shards int) Middleware {
+	shardedQueries := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_sharded_queries_total",
+		Help: "Total number of range queries executed as shards.",
+	})
+
+	return func(next Handler) Handler {
+		return &sharding{
+			logger:         logger,
+			shards:         uint64(shards),
+			next:           next,
+			shardedQueries: shardedQueries,
+		}
+	}
+}
+
+func (s *sharding) Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error) {
+	if s.shards < 2 || r.Params.Get("shard") != "" {
+		return s.next.Do(ctx, r)
+	}
+
+	by, err := querysharding.ShardLabels(r.Query)
+	if err != nil {
+		// Invalid queries are answered by the querier.
+		level.Debug(s.logger).Log("msg", "failed to analyze query for sharding", "query", r.Query, "err", err)
+		return s.next.Do(ctx, r)
+	}
+	if len(by) == 0 {
+		return s.next.Do(ctx, r)
+	}
+	s.shardedQueries.Inc()
+
+	resps := make([]*RangeResponse, s.shards)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := uint64(0); i < s.shards; i++ {
+		shard := querysharding.Shard{Index: i, Total: s.shards, By: by}
+		req := *r
+		req.Params = url.Values{}
+		for k, v := range r.Params {
+			req.Params[k] = v
+		}
+		req.Params.Set("shard", shard.String())
+
+		i := i
+		g.Go(func() error {
+			resp, err := s.next.Do(gctx, &req)
+			if err != nil {
+				return err
+			}
+			resps[i] = resp
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return mergeResponses(resps), nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/querysharding"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestShardingMiddleware(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		shards []string
+	)
+	next := HandlerFunc(func(_ context.Context, r *RangeRequest) (*RangeResponse, error) {
+		mtx.Lock()
+		shards = append(shards, r.Params.Get("shard"))
+		mtx.Unlock()
+
+		res := &RangeResponse{Status: statusSuccess, Data: RangeData{ResultType: "matrix"}}
+		for _, pod := range []string{"a", "b", "c", "d", "e", "f"} {
+			m := model.Metric{"pod": model.LabelValue(pod)}
+			if s := r.Params.Get("shard"); s != "" {
+				shard, err := querysharding.ParseShard(s)
+				testutil.Ok(t, err)
+				if !shard.Matches(labels.FromStrings("pod", pod)) {
+					continue
+				}
+			}
+			res.Data.Result = append(res.Data.Result, &model.SampleStream{Metric: m, Values: []model.SamplePair{{Timestamp: 0, Value: 1}}})
+		}
+		return res, nil
+	})
+	h := NewShardingMiddleware(log.NewNopLogger(), nil, 3)(next)
+
+	unsharded, err := next.Do(context.Background(), &RangeRequest{Query: "x", Params: url.Values{}})
+	testutil.Ok(t, err)
+	shards = nil
+
+	res, err := h.Do(context.Background(), &RangeRequest{Query: "sum by (pod) (x)", Params: url.Values{"dedup": {"true"}}})
+	testutil.Ok(t, err)
+	sort.Strings(shards)
+	testutil.Equals(t, []string{"0_of_3_by_pod", "1_of_3_by_pod", "2_of_3_by_pod"}, shards)
+	testutil.Equals(t, unsharded.Data.Result, res.Data.Result)
+
+	// Queries which cannot be sharded are executed as they are.
+	shards = nil
+	_, err = h.Do(context.Background(), &RangeRequest{Query: "sum(x)", Params: url.Values{}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{""}, shards)
+}
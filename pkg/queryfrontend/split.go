@@ -0,0 +1,131 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"golang.org/x/sync/errgroup"
+)
+
+type splitByInterval struct {
+	interval    int64
+	concurrency int
+	next        Handler
+
+	splitQueries prometheus.Counter
+}
+
+// NewSplitByIntervalMiddleware returns a Middleware splitting range queries at multiples of the given interval, e.g.
+// days, so that long queries are executed in parallel, by at most the given number of concurrent queries, and the
+// responses of their parts can be cached separately. The responses are merged into one.
+func NewSplitByIntervalMiddleware(reg prometheus.Registerer, interval time.Duration, concurrency int) Middleware {
+	splitQueries := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_frontend_split_queries_total",
+		Help: "Total number of queries range queries were split into.",
+	})
+
+	return func(next Handler) Handler {
+		return &splitByInterval{
+			interval:     int64(interval / time.Millisecond),
+			concurrency:  concurrency,
+			next:         next,
+			splitQueries: splitQueries,
+		}
+	}
+}
+
+func (s *splitByInterval) Do(ctx context.Context, r *RangeRequest) (*RangeResponse, error) {
+	reqs := splitQuery(r, s.interval)
+	s.splitQueries.Add(float64(len(reqs)))
+	if len(reqs) == 1 {
+		return s.next.Do(ctx, reqs[0])
+	}
+
+	var (
+		resps = make([]*RangeResponse, len(reqs))
+		sem   = make(chan struct{}, s.concurrency)
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range reqs {
+		i := i
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+
+			resp, err := s.next.Do(gctx, reqs[i])
+			if err != nil {
+				return err
+			}
+			resps[i] = resp
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return mergeResponses(resps), nil
+}
+
+// splitQuery splits the given request at multiples of the given interval in milliseconds. Parts start at multiples
+// of the step from the start of the request, so that they evaluate the same timestamps as the request.
+func splitQuery(r *RangeRequest, interval int64) []*RangeRequest {
+	if interval <= 0 {
+		return []*RangeRequest{r}
+	}
+
+	var reqs []*RangeRequest
+	for start := r.Start; start <= r.End; {
+		end := nextIntervalBoundary(start, r.Step, interval)
+		if end+r.Step > r.End {
+			end = r.End
+		}
+		reqs = append(reqs, r.WithStartEnd(start, end))
+		start = end + r.Step
+	}
+	return reqs
+}
+
+// nextIntervalBoundary returns the last timestamp, at a multiple of the step from the given one, before the next
+// multiple of the interval.
+func nextIntervalBoundary(t, step, interval int64) int64 {
+	startOfNextInterval := (t/interval + 1) * interval
+	target := startOfNextInterval - (startOfNextInterval-t)%step
+	if target == startOfNextInterval {
+		target -= step
+	}
+	return target
+}
+
+// mergeResponses merges the responses of consecutive parts of a range query.
+func mergeResponses(resps []*RangeResponse) *RangeResponse {
+	var (
+		merged = &RangeResponse{Status: statusSuccess, Data: RangeData{ResultType: model.ValMatrix.String()}}
+		series = map[model.Fingerprint]*model.SampleStream{}
+	)
+	for _, resp := range resps {
+		merged.Warnings = append(merged.Warnings, resp.Warnings...)
+		for _, s := range resp.Data.Result {
+			fp := s.Metric.Fingerprint()
+			existing, ok := series[fp]
+			if !ok {
+				existing = &model.SampleStream{Metric: s.Metric}
+				series[fp] = existing
+				merged.Data.Result = append(merged.Data.Result, existing)
+			}
+			existing.Values = append(existing.Values, s.Values...)
+		}
+	}
+	sort.Sort(merged.Data.Result)
+	return merged
+}
@@ -0,0 +1,115 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSplitQuery(t *testing.T) {
+	const (
+		hour = int64(time.Hour / time.Millisecond)
+		day  = 24 * hour
+	)
+	for _, tcase := range []struct {
+		name       string
+		start, end int64
+		step       int64
+		interval   int64
+		expected   [][2]int64
+	}{
+		{
+			name: "disabled", start: 0, end: 2 * day, step: hour, interval: 0,
+			expected: [][2]int64{{0, 2 * day}},
+		},
+		{
+			name: "within interval", start: hour, end: 2 * hour, step: 15000, interval: day,
+			expected: [][2]int64{{hour, 2 * hour}},
+		},
+		{
+			name: "instant", start: day, end: day, step: 15000, interval: day,
+			expected: [][2]int64{{day, day}},
+		},
+		{
+			name: "aligned", start: 0, end: 2 * day, step: hour, interval: day,
+			expected: [][2]int64{{0, day - hour}, {day, 2*day - hour}, {2 * day, 2 * day}},
+		},
+		{
+			name: "unaligned", start: 12 * hour, end: 36*hour + 1000, step: 5 * hour, interval: day,
+			expected: [][2]int64{{12 * hour, 22 * hour}, {27 * hour, 36*hour + 1000}},
+		},
+		{
+			name: "step larger than interval", start: 0, end: 4 * day, step: 2 * day, interval: day,
+			expected: [][2]int64{{0, 0}, {2 * day, 2 * day}, {4 * day, 4 * day}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			r := &RangeRequest{Query: "up", Start: tcase.start, End: tcase.end, Step: tcase.step}
+
+			var parts [][2]int64
+			for _, p := range splitQuery(r, tcase.interval) {
+				testutil.Equals(t, r.Query, p.Query)
+				parts = append(parts, [2]int64{p.Start, p.End})
+			}
+			testutil.Equals(t, tcase.expected, parts)
+		})
+	}
+}
+
+func TestSplitByIntervalMiddleware(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		parts [][2]int64
+	)
+	next := HandlerFunc(func(_ context.Context, r *RangeRequest) (*RangeResponse, error) {
+		mtx.Lock()
+		parts = append(parts, [2]int64{r.Start, r.End})
+		mtx.Unlock()
+
+		if r.Query == "fail" && r.Start > 0 {
+			return nil, errors.New("failed")
+		}
+		res := &RangeResponse{Status: statusSuccess, Data: RangeData{ResultType: "matrix"}}
+		for t := r.Start; t <= r.End; t += r.Step {
+			res.Data.Result = append(res.Data.Result, &model.SampleStream{
+				Metric: model.Metric{"t": model.LabelValue(model.Time(t).String())},
+				Values: []model.SamplePair{{Timestamp: model.Time(t), Value: 1}},
+			})
+		}
+		if len(res.Data.Result) > 0 {
+			res.Data.Result = append(res.Data.Result, &model.SampleStream{
+				Metric: model.Metric{"a": "b"},
+				Values: []model.SamplePair{{Timestamp: model.Time(r.Start), Value: 2}},
+			})
+		}
+		if r.Start == 20 {
+			res.Warnings = []string{"partial"}
+		}
+		return res, nil
+	})
+	h := NewSplitByIntervalMiddleware(nil, 20*time.Millisecond, 2)(next)
+
+	res, err := h.Do(context.Background(), &RangeRequest{Query: "up", Start: 0, End: 30, Step: 10})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(parts))
+	testutil.Equals(t, []string{"partial"}, res.Warnings)
+	testutil.Equals(t, model.Matrix{
+		{Metric: model.Metric{"a": "b"}, Values: []model.SamplePair{{Timestamp: 0, Value: 2}, {Timestamp: 20, Value: 2}}},
+		{Metric: model.Metric{"t": "0"}, Values: []model.SamplePair{{Timestamp: 0, Value: 1}}},
+		{Metric: model.Metric{"t": "0.01"}, Values: []model.SamplePair{{Timestamp: 10, Value: 1}}},
+		{Metric: model.Metric{"t": "0.02"}, Values: []model.SamplePair{{Timestamp: 20, Value: 1}}},
+		{Metric: model.Metric{"t": "0.03"}, Values: []model.SamplePair{{Timestamp: 30, Value: 1}}},
+	}, res.Data.Result)
+
+	_, err = h.Do(context.Background(), &RangeRequest{Query: "fail", Start: 0, End: 30, Step: 10})
+	testutil.NotOk(t, err)
+}
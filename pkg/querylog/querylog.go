@@ -0,0 +1,222 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package querylog implements a log of slow queries, recording what they queried, how much data they touched and
+// who sent them, for offline analysis.
+package querylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// Entry is a logged slow query.
+type Entry struct {
+	// Fingerprint identifies the query regardless of its formatting, so that entries of the same query can be
+	// grouped.
+	Fingerprint string    `json:"fingerprint"`
+	Query       string    `json:"query"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// Step is zero for instant queries.
+	Step     time.Duration `json:"-"`
+	Duration time.Duration `json:"-"`
+	// Series and Samples are the number of series and samples of the result of the query.
+	Series   int64  `json:"series"`
+	Samples  int64  `json:"samples"`
+	Tenant   string `json:"tenant,omitempty"`
+	SourceIP string `json:"source_ip,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, writing durations in seconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plain Entry
+	return json.Marshal(struct {
+		plain
+		StepSeconds     float64 `json:"step_seconds"`
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{
+		plain:           plain(e),
+		StepSeconds:     e.Step.Seconds(),
+		DurationSeconds: e.Duration.Seconds(),
+	})
+}
+
+// Config configures the slow query log.
+type Config struct {
+	// Threshold is the duration queries are logged from. 0 disables the log.
+	Threshold time.Duration
+	// Path is the file entries are appended to as JSON lines. Entries are logged if empty.
+	Path string
+	// TenantHeader is the HTTP header the tenant of queries is determined from.
+	TenantHeader string
+}
+
+// SlowQueryLog logs queries taking at least a threshold.
+type SlowQueryLog struct {
+	logger log.Logger
+	conf   Config
+
+	mtx    sync.Mutex
+	file   *os.File
+	closed bool
+
+	logged prometheus.Counter
+}
+
+// NewSlowQueryLog returns a new SlowQueryLog of the given configuration.
+func NewSlowQueryLog(logger log.Logger, reg prometheus.Registerer, conf Config) (*SlowQueryLog, error) {
+	if conf.Threshold <= 0 {
+		return nil, errors.New("threshold must be positive")
+	}
+
+	l := &SlowQueryLog{
+		logger: logger,
+		conf:   conf,
+		logged: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_slow_queries_total",
+			Help: "Total number of queries logged as slow.",
+		}),
+	}
+	if conf.Path != "" {
+		f, err := os.OpenFile(conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "open slow query log file")
+		}
+		l.file = f
+	}
+	return l, nil
+}
+
+// Slow returns whether queries of the given duration are logged.
+func (l *SlowQueryLog) Slow(d time.Duration) bool {
+	return d >= l.conf.Threshold
+}
+
+// LogRequest logs the given entry of a query of the given HTTP request if it took at least the threshold. The
+// tenant and source IP of the entry are determined from the request.
+func (l *SlowQueryLog) LogRequest(r *http.Request, e Entry) {
+	if !l.Slow(e.Duration) {
+		return
+	}
+	if l.conf.TenantHeader != "" {
+		e.Tenant = r.Header.Get(l.conf.TenantHeader)
+	}
+	e.SourceIP = sourceIP(r)
+	l.Log(e)
+}
+
+// Log logs the given entry if its query took at least the threshold.
+func (l *SlowQueryLog) Log(e Entry) {
+	if !l.Slow(e.Duration) {
+		return
+	}
+	if e.Fingerprint == "" {
+		e.Fingerprint = Fingerprint(e.Query)
+	}
+
+	if l.file == nil {
+		l.logged.Inc()
+		level.Warn(l.logger).Log(
+			"msg", "slow query",
+			"fingerprint", e.Fingerprint,
+			"query", e.Query,
+			"start", e.Start.Format(time.RFC3339Nano),
+			"end", e.End.Format(time.RFC3339Nano),
+			"step", e.Step,
+			"duration", e.Duration,
+			"series", e.Series,
+			"samples", e.Samples,
+			"tenant", e.Tenant,
+			"source_ip", e.SourceIP,
+		)
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		level.Error(l.logger).Log("msg", "failed to encode slow query", "err", err)
+		return
+	}
+	b = append(b, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return
+	}
+	if _, err := l.file.Write(b); err != nil {
+		level.Error(l.logger).Log("msg", "failed to write slow query", "err", err)
+		return
+	}
+	l.logged.Inc()
+}
+
+// Close closes the file of the log, if any. Entries logged afterwards are dropped.
+func (l *SlowQueryLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.file.Close()
+}
+
+// Fingerprint returns the fingerprint of the given query. Queries differing only in their formatting have the same
+// fingerprint.
+func Fingerprint(query string) string {
+	if expr, err := promql.ParseExpr(query); err == nil {
+		query = expr.String()
+	}
+	return fmt.Sprintf("%016x", xxhash.Sum64String(query))
+}
+
+// sourceIP returns the IP of the client of the given request, preferring the first address of the X-Forwarded-For
+// header set by proxies.
+func sourceIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ResultStats returns the number of series and samples of the given query result. Instant vectors have one sample
+// per series and scalars a single sample without a series.
+func ResultStats(v promql.Value) (series, samples int64) {
+	switch v := v.(type) {
+	case promql.Matrix:
+		for _, s := range v {
+			series++
+			samples += int64(len(s.Points))
+		}
+	case promql.Vector:
+		series = int64(len(v))
+		samples = series
+	case promql.Scalar:
+		samples = 1
+	}
+	return series, samples
+}
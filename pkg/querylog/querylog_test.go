@@ -0,0 +1,108 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package querylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestFingerprint(t *testing.T) {
+	testutil.Equals(t, Fingerprint(`sum by (pod) (rate(x[5m]))`), Fingerprint(`sum  by(pod)(rate(x[5m] ))`))
+	testutil.Assert(t, Fingerprint(`sum by (pod) (rate(x[5m]))`) != Fingerprint(`sum by (pod) (rate(x[1m]))`), "fingerprints of different queries must differ")
+	// Invalid queries are fingerprinted as they are.
+	testutil.Equals(t, Fingerprint(`sum(`), Fingerprint(`sum(`))
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	_, err := NewSlowQueryLog(log.NewNopLogger(), nil, Config{})
+	testutil.NotOk(t, err)
+
+	dir, err := ioutil.TempDir("", "slow-query-log")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	path := filepath.Join(dir, "slow.log")
+	l, err := NewSlowQueryLog(log.NewNopLogger(), nil, Config{Threshold: time.Second, Path: path, TenantHeader: "THANOS-TENANT"})
+	testutil.Ok(t, err)
+
+	r := httptest.NewRequest("GET", "/api/v1/query_range", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("THANOS-TENANT", "team-a")
+	start := time.Unix(1000, 0).UTC()
+	end := time.Unix(4600, 0).UTC()
+
+	l.LogRequest(r, Entry{Query: "up", Start: start, End: end, Step: time.Minute, Duration: time.Millisecond})
+	l.LogRequest(r, Entry{Query: "up", Start: start, End: end, Step: time.Minute, Duration: 2 * time.Second, Series: 3, Samples: 180})
+	r.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.2")
+	l.LogRequest(r, Entry{Query: "sum(up)", Start: end, End: end, Duration: time.Second})
+	testutil.Ok(t, l.Close())
+	// Entries are dropped once the log is closed.
+	l.LogRequest(r, Entry{Query: "up", Start: end, End: end, Duration: time.Second})
+	testutil.Ok(t, l.Close())
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(l.logged))
+
+	b, err := ioutil.ReadFile(path)
+	testutil.Ok(t, err)
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	testutil.Equals(t, 2, len(lines))
+
+	var entries []map[string]interface{}
+	for _, line := range lines {
+		var e map[string]interface{}
+		testutil.Ok(t, json.Unmarshal(line, &e))
+		entries = append(entries, e)
+	}
+	testutil.Equals(t, map[string]interface{}{
+		"fingerprint":      Fingerprint("up"),
+		"query":            "up",
+		"start":            "1970-01-01T00:16:40Z",
+		"end":              "1970-01-01T01:16:40Z",
+		"step_seconds":     60.0,
+		"duration_seconds": 2.0,
+		"series":           3.0,
+		"samples":          180.0,
+		"tenant":           "team-a",
+		"source_ip":        "10.0.0.1",
+	}, entries[0])
+	testutil.Equals(t, "192.168.0.1", entries[1]["source_ip"])
+	testutil.Equals(t, 0.0, entries[1]["step_seconds"])
+}
+
+func TestResultStats(t *testing.T) {
+	series, samples := ResultStats(promql.Matrix{
+		{Metric: labels.FromStrings("pod", "a"), Points: []promql.Point{{T: 0, V: 1}, {T: 1, V: 2}}},
+		{Metric: labels.FromStrings("pod", "b"), Points: []promql.Point{{T: 0, V: 1}}},
+	})
+	testutil.Equals(t, int64(2), series)
+	testutil.Equals(t, int64(3), samples)
+
+	series, samples = ResultStats(promql.Vector{
+		{Metric: labels.FromStrings("pod", "a"), Point: promql.Point{T: 0, V: 1}},
+		{Metric: labels.FromStrings("pod", "b"), Point: promql.Point{T: 0, V: 1}},
+	})
+	testutil.Equals(t, int64(2), series)
+	testutil.Equals(t, int64(2), samples)
+
+	series, samples = ResultStats(promql.Scalar{T: 0, V: 1})
+	testutil.Equals(t, int64(0), series)
+	testutil.Equals(t, int64(1), samples)
+
+	series, samples = ResultStats(nil)
+	testutil.Equals(t, int64(0), series)
+	testutil.Equals(t, int64(0), samples)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package querysharding implements sharding of PromQL queries by the hash of the labels their aggregations group
+// by, so that shards of a query can be evaluated in parallel and their results concatenated.
+package querysharding
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// Shard selects the series whose values of the labels a query is sharded by hash to its index.
+type Shard struct {
+	Index uint64
+	Total uint64
+	By    []string
+}
+
+// String returns the shard in the format parsed by ParseShard, e.g. 1_of_4_by_namespace,pod.
+func (s Shard) String() string {
+	return fmt.Sprintf("%d_of_%d_by_%s", s.Index, s.Total, strings.Join(s.By, ","))
+}
+
+// ParseShard parses a shard in the format returned by Shard.String.
+func ParseShard(s string) (Shard, error) {
+	parts := strings.SplitN(s, "_", 5)
+	if len(parts) != 5 || parts[1] != "of" || parts[3] != "by" || parts[4] == "" {
+		return Shard{}, errors.Errorf("invalid shard %q, expected <index>_of_<total>_by_<label>[,<label>...]", s)
+	}
+
+	index, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Shard{}, errors.Wrapf(err, "parse index of shard %q", s)
+	}
+	total, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return Shard{}, errors.Wrapf(err, "parse total of shard %q", s)
+	}
+	if index >= total {
+		return Shard{}, errors.Errorf("index of shard %q must be lower than its total", s)
+	}
+	return Shard{Index: index, Total: total, By: strings.Split(parts[4], ",")}, nil
+}
+
+// Matches returns whether the series of the given labels belongs to the shard.
+func (s Shard) Matches(lset labels.Labels) bool {
+	b := make([]byte, 0, 1024)
+	for _, name := range s.By {
+		b = append(b, name...)
+		b = append(b, '\xff')
+		b = append(b, lset.Get(name)...)
+		b = append(b, '\xff')
+	}
+	return xxhash.Sum64(b)%s.Total == s.Index
+}
+
+// Proto returns the shard info sending the shard to stores.
+func (s Shard) Proto() *storepb.ShardInfo {
+	return &storepb.ShardInfo{ShardIndex: s.Index, TotalShards: s.Total, By: s.By}
+}
+
+// ShardFromProto returns the shard of the given shard info, if it is set.
+func ShardFromProto(info *storepb.ShardInfo) (Shard, bool) {
+	if info == nil || info.TotalShards == 0 {
+		return Shard{}, false
+	}
+	return Shard{Index: info.ShardIndex, Total: info.TotalShards, By: info.By}, true
+}
+
+type shardKey struct{}
+
+// ContextWithShard returns a context restricting queries to the series of the given shard.
+func ContextWithShard(ctx context.Context, s Shard) context.Context {
+	return context.WithValue(ctx, shardKey{}, s)
+}
+
+// ShardFromContext returns the shard queries of the given context are restricted to, if any.
+func ShardFromContext(ctx context.Context) (Shard, bool) {
+	s, ok := ctx.Value(shardKey{}).(Shard)
+	return s, ok
+}
+
+// nonShardableFuncs are functions whose results are not computed per series or per group of series of the labels
+// a query is sharded by, e.g. because they change labels or do not select any series.
+var nonShardableFuncs = map[string]struct{}{
+	"absent":           {},
+	"absent_over_time": {},
+	"label_join":       {},
+	"label_replace":    {},
+	"scalar":           {},
+	"vector":           {},
+}
+
+// ShardLabels returns the labels the given query can be sharded by, or nil if it cannot be sharded.
+//
+// A query can be sharded by the labels all of its aggregations group by, as long as the series of every group, and
+// of every pair of series matched by binary operations, are in the same shard.
+func ShardLabels(query string) ([]string, error) {
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse query")
+	}
+	if expr.Type() != promql.ValueTypeVector {
+		return nil, nil
+	}
+
+	var (
+		by         map[string]struct{}
+		shardable  = true
+		histograms bool
+		matchingOn [][]string
+		ignoring   [][]string
+	)
+	promql.Inspect(expr, func(node promql.Node, _ []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.AggregateExpr:
+			// count_values adds a label of the value of series.
+			if n.Without || len(n.Grouping) == 0 || n.Op.String() == "count_values" {
+				shardable = false
+				break
+			}
+			grouping := make(map[string]struct{}, len(n.Grouping))
+			for _, l := range n.Grouping {
+				if by == nil {
+					grouping[l] = struct{}{}
+					continue
+				}
+				if _, ok := by[l]; ok {
+					grouping[l] = struct{}{}
+				}
+			}
+			by = grouping
+		case *promql.Call:
+			if _, ok := nonShardableFuncs[n.Func.Name]; ok {
+				shardable = false
+			}
+			// histogram_quantile aggregates the buckets of a histogram.
+			if n.Func.Name == "histogram_quantile" {
+				histograms = true
+			}
+		case *promql.BinaryExpr:
+			if n.VectorMatching == nil || n.LHS.Type() != promql.ValueTypeVector || n.RHS.Type() != promql.ValueTypeVector {
+				break
+			}
+			if n.VectorMatching.On {
+				matchingOn = append(matchingOn, n.VectorMatching.MatchingLabels)
+			} else {
+				ignoring = append(ignoring, n.VectorMatching.MatchingLabels)
+			}
+		}
+		return nil
+	})
+	if histograms {
+		delete(by, "le")
+	}
+	if !shardable || len(by) == 0 {
+		return nil, nil
+	}
+
+	// Series are matched by the labels of on(...) or by all labels not in ignoring(...), so these must include the
+	// labels of the shard.
+	for _, ls := range ignoring {
+		for _, l := range ls {
+			if _, ok := by[l]; ok {
+				return nil, nil
+			}
+		}
+	}
+	for _, ls := range matchingOn {
+		on := make(map[string]struct{}, len(ls))
+		for _, l := range ls {
+			on[l] = struct{}{}
+		}
+		for l := range by {
+			if _, ok := on[l]; !ok {
+				return nil, nil
+			}
+		}
+	}
+
+	shardLabels := make([]string, 0, len(by))
+	for l := range by {
+		shardLabels = append(shardLabels, l)
+	}
+	sort.Strings(shardLabels)
+	return shardLabels, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package querysharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseShard(t *testing.T) {
+	s := Shard{Index: 1, Total: 4, By: []string{"namespace", "pod_name"}}
+	testutil.Equals(t, "1_of_4_by_namespace,pod_name", s.String())
+
+	parsed, err := ParseShard(s.String())
+	testutil.Ok(t, err)
+	testutil.Equals(t, s, parsed)
+
+	fromProto, ok := ShardFromProto(s.Proto())
+	testutil.Assert(t, ok, "shard info must be set")
+	testutil.Equals(t, s, fromProto)
+	_, ok = ShardFromProto(nil)
+	testutil.Assert(t, !ok, "nil shard info must not be set")
+
+	for _, invalid := range []string{"", "1_of_4", "1_of_4_by_", "1_in_4_by_pod", "a_of_4_by_pod", "4_of_4_by_pod"} {
+		_, err := ParseShard(invalid)
+		testutil.NotOk(t, err, invalid)
+	}
+
+	ctx := context.Background()
+	_, ok := ShardFromContext(ctx)
+	testutil.Assert(t, !ok, "unexpected shard")
+	s, ok = ShardFromContext(ContextWithShard(ctx, parsed))
+	testutil.Assert(t, ok, "expected shard")
+	testutil.Equals(t, parsed, s)
+}
+
+func TestShardMatches(t *testing.T) {
+	const total = 4
+	counts := make([]int, total)
+	for i := 0; i < 1000; i++ {
+		pod := fmt.Sprintf("pod-%d", i)
+
+		var matched []uint64
+		for index := uint64(0); index < total; index++ {
+			s := Shard{Index: index, Total: total, By: []string{"pod"}}
+			// Series of the same group are in the same shard, regardless of other labels.
+			a := s.Matches(labels.FromStrings("__name__", "a", "pod", pod, "container", "x"))
+			b := s.Matches(labels.FromStrings("__name__", "b", "pod", pod))
+			testutil.Equals(t, a, b)
+			if a {
+				matched = append(matched, index)
+			}
+		}
+		testutil.Equals(t, 1, len(matched))
+		counts[matched[0]]++
+	}
+	for _, c := range counts {
+		testutil.Assert(t, c > 150, "shards are unbalanced: %v", counts)
+	}
+}
+
+func TestShardLabels(t *testing.T) {
+	for _, tcase := range []struct {
+		query    string
+		expected []string
+	}{
+		{query: `sum by (pod) (rate(http_requests_total[5m]))`, expected: []string{"pod"}},
+		{query: `topk by (namespace, pod) (3, http_requests_total)`, expected: []string{"namespace", "pod"}},
+		{query: `max by (pod) (sum by (pod, container) (x))`, expected: []string{"pod"}},
+		{query: `sum by (pod) (a) / on (pod) sum by (pod, namespace) (b)`, expected: []string{"pod"}},
+		{query: `sum by (pod) (a) / sum by (pod) (b) > 0.5`, expected: []string{"pod"}},
+		{query: `histogram_quantile(0.9, sum by (le, job) (rate(x_bucket[5m])))`, expected: []string{"job"}},
+		{query: `sum by (pod) (a) * ignoring (container) group_left b`, expected: []string{"pod"}},
+
+		// No aggregation or aggregations of all series.
+		{query: `http_requests_total`},
+		{query: `sum(rate(http_requests_total[5m]))`},
+		{query: `max by (pod) (sum by (container) (x))`},
+		{query: `sum without (instance) (x)`},
+		{query: `count_values by (pod) ("value", x)`},
+		// Series matched by labels not including the shard labels.
+		{query: `sum by (pod) (a) / on (namespace) group_left sum by (pod) (b)`},
+		{query: `sum by (pod) (a) / ignoring (pod) sum by (pod) (b)`},
+		// Functions changing labels or not selecting series.
+		{query: `sum by (pod) (label_replace(x, "pod", "$1", "instance", "(.*)"))`},
+		{query: `sum by (pod) (x) or vector(0)`},
+		{query: `scalar(sum by (pod) (x))`},
+		{query: `sum by (pod) (x)[5m:1m]`},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			by, err := ShardLabels(tcase.query)
+			testutil.Ok(t, err)
+			if len(tcase.expected) == 0 {
+				testutil.Equals(t, 0, len(by))
+				return
+			}
+			testutil.Equals(t, tcase.expected, by)
+		})
+	}
+
+	_, err := ShardLabels(`sum by (pod`)
+	testutil.NotOk(t, err)
+}
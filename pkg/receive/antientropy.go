@@ -0,0 +1,613 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	// DefaultAntiEntropyBatchSize is the default number of series compared in a single checksum request.
+	DefaultAntiEntropyBatchSize = 1000
+	// DefaultAntiEntropyMaxTrackedSeries is the default number of recently written series compared with other replicas.
+	DefaultAntiEntropyMaxTrackedSeries = 1000000
+)
+
+// AntiEntropyOptions configures the background process repairing replicas of the same hashring slot.
+// Every Interval, series written locally within [now-Delay-Window, now-Delay] are compared with the other replicas
+// responsible for them and data missing on a replica is written to it again.
+type AntiEntropyOptions struct {
+	Interval time.Duration
+	Window   time.Duration
+	// Delay excludes the most recent data, which may still be in flight, from comparison.
+	Delay     time.Duration
+	BatchSize int
+	// MaxTrackedSeries bounds the number of series remembered for comparison. Series written while the limit is
+	// reached are not compared until older ones are forgotten. Zero means DefaultAntiEntropyMaxTrackedSeries.
+	MaxTrackedSeries int
+}
+
+// ChecksumRequest asks for checksums of samples of the given series of a tenant within [MinTime, MaxTime].
+type ChecksumRequest struct {
+	Tenant  string          `json:"tenant"`
+	MinTime int64           `json:"min_time"`
+	MaxTime int64           `json:"max_time"`
+	Series  []labels.Labels `json:"series"`
+	// Checksums of the samples the requester has for the series, in order, if set. Timestamps of samples are
+	// returned for series with a different checksum, so that the requester can send just the missing samples.
+	Checksums []uint64 `json:"checksums,omitempty"`
+}
+
+// ChecksumResponse contains a checksum for every requested series, in order. Zero means the series has no samples.
+type ChecksumResponse struct {
+	Checksums []uint64 `json:"checksums"`
+	// Timestamps of samples of every requested series, in order, if the request has checksums. They are set only
+	// for series with a checksum different from the requested one.
+	Timestamps [][]int64 `json:"timestamps,omitempty"`
+}
+
+// ChecksumServer is the server API of the anti-entropy service.
+type ChecksumServer interface {
+	Checksum(context.Context, *ChecksumRequest) (*ChecksumResponse, error)
+}
+
+// ChecksumClient is the client API of the anti-entropy service.
+type ChecksumClient interface {
+	Checksum(ctx context.Context, in *ChecksumRequest, opts ...grpc.CallOption) (*ChecksumResponse, error)
+}
+
+// The anti-entropy service is a small internal API between receivers. Instead of generated protobuf code, it is
+// described by hand. Its messages marshal themselves as JSON, which the default gRPC codec uses for messages
+// implementing Marshal and Unmarshal, so no codec is registered for all services of the process.
+const (
+	checksumFullMethod  = "/thanos.receive.AntiEntropy/Checksum"
+	antiEntropyService  = "thanos.receive.AntiEntropy"
+	antiEntropyMetadata = "pkg/receive/antientropy.go"
+)
+
+func (m *ChecksumRequest) Reset()                   { *m = ChecksumRequest{} }
+func (m *ChecksumRequest) String() string           { return jsonString(m) }
+func (*ChecksumRequest) ProtoMessage()              {}
+func (m *ChecksumRequest) Marshal() ([]byte, error) { return json.Marshal(m) }
+func (m *ChecksumRequest) Unmarshal(b []byte) error { return json.Unmarshal(b, m) }
+
+func (m *ChecksumResponse) Reset()                   { *m = ChecksumResponse{} }
+func (m *ChecksumResponse) String() string           { return jsonString(m) }
+func (*ChecksumResponse) ProtoMessage()              {}
+func (m *ChecksumResponse) Marshal() ([]byte, error) { return json.Marshal(m) }
+func (m *ChecksumResponse) Unmarshal(b []byte) error { return json.Unmarshal(b, m) }
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+var antiEntropyServiceDesc = grpc.ServiceDesc{
+	ServiceName: antiEntropyService,
+	HandlerType: (*ChecksumServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Checksum",
+			Handler:    checksumHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: antiEntropyMetadata,
+}
+
+func checksumHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChecksumRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChecksumServer).Checksum(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: checksumFullMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChecksumServer).Checksum(ctx, req.(*ChecksumRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterChecksumServer registers the anti-entropy service on the given gRPC server.
+func RegisterChecksumServer(s *grpc.Server, srv ChecksumServer) {
+	s.RegisterService(&antiEntropyServiceDesc, srv)
+}
+
+type checksumClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewChecksumClient returns a client of the anti-entropy service.
+func NewChecksumClient(cc *grpc.ClientConn) ChecksumClient {
+	return &checksumClient{cc: cc}
+}
+
+func (c *checksumClient) Checksum(ctx context.Context, in *ChecksumRequest, opts ...grpc.CallOption) (*ChecksumResponse, error) {
+	out := new(ChecksumResponse)
+	if err := c.cc.Invoke(ctx, checksumFullMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type checksumServer struct {
+	logger log.Logger
+	db     TenantQueryable
+}
+
+// NewChecksumServer returns a ChecksumServer computing checksums of series stored in the given tenant storage.
+func NewChecksumServer(logger log.Logger, db TenantQueryable) ChecksumServer {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &checksumServer{logger: logger, db: db}
+}
+
+func (s *checksumServer) Checksum(ctx context.Context, r *ChecksumRequest) (*ChecksumResponse, error) {
+	if len(r.Checksums) > 0 && len(r.Checksums) != len(r.Series) {
+		return nil, status.Errorf(codes.InvalidArgument, "expected %d checksums, got %d", len(r.Series), len(r.Checksums))
+	}
+	db, err := s.db.TenantQueryable(r.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	q, err := db.Querier(ctx, r.MinTime, r.MaxTime)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	defer runutil.CloseWithLogOnErr(s.logger, q, "checksum querier")
+	buf, err := tenantOutOfOrderBuffer(s.db, r.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	resp := &ChecksumResponse{Checksums: make([]uint64, 0, len(r.Series))}
+	if len(r.Checksums) > 0 {
+		resp.Timestamps = make([][]int64, len(r.Series))
+	}
+	for i, lset := range r.Series {
+		samples, err := seriesSamples(q, buf, lset, r.MinTime, r.MaxTime)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		sum := checksum(samples)
+		resp.Checksums = append(resp.Checksums, sum)
+		if len(r.Checksums) == 0 || sum == r.Checksums[i] {
+			continue
+		}
+		resp.Timestamps[i] = make([]int64, 0, len(samples))
+		for _, smpl := range samples {
+			resp.Timestamps[i] = append(resp.Timestamps[i], smpl.Timestamp)
+		}
+	}
+	return resp, nil
+}
+
+// tenantOutOfOrderBuffer returns the buffer of out-of-order samples of the tenant, if the storage accepts them.
+// Buffered samples are not queryable until they are written to blocks, but they were accepted already.
+func tenantOutOfOrderBuffer(db TenantQueryable, tenant string) (*outOfOrderBuffer, error) {
+	s, ok := db.(TenantOutOfOrderStorage)
+	if !ok {
+		return nil, nil
+	}
+	app, err := s.TenantOutOfOrderAppender(tenant)
+	if err != nil {
+		return nil, err
+	}
+	buf, _ := app.(*outOfOrderBuffer)
+	return buf, nil
+}
+
+// seriesSamples returns samples of the series with exactly the given labels within [mint, maxt], including samples
+// buffered by the given out-of-order buffer, if it is not nil.
+func seriesSamples(q storage.Querier, buf *outOfOrderBuffer, lset labels.Labels, mint, maxt int64) ([]prompb.Sample, error) {
+	matchers := make([]*labels.Matcher, 0, len(lset))
+	for _, l := range lset {
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, l.Name, l.Value))
+	}
+	set, _, err := q.Select(nil, matchers...)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []prompb.Sample
+	for set.Next() {
+		s := set.At()
+		// Matchers select also series with additional labels.
+		if !labels.Equal(s.Labels(), lset) {
+			continue
+		}
+		it := s.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			if t < mint || t > maxt {
+				continue
+			}
+			samples = append(samples, prompb.Sample{Timestamp: t, Value: v})
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if err := set.Err(); err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return samples, nil
+	}
+	return mergeSamples(samples, buf.samples(lset, mint, maxt)), nil
+}
+
+// mergeSamples merges two lists of samples sorted by timestamp. Samples of a that have the same timestamp as a
+// sample of b are kept.
+func mergeSamples(a, b []prompb.Sample) []prompb.Sample {
+	if len(b) == 0 {
+		return a
+	}
+	res := make([]prompb.Sample, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].Timestamp < b[0].Timestamp:
+			res, a = append(res, a[0]), a[1:]
+		case a[0].Timestamp > b[0].Timestamp:
+			res, b = append(res, b[0]), b[1:]
+		default:
+			res, a, b = append(res, a[0]), a[1:], b[1:]
+		}
+	}
+	res = append(res, a...)
+	return append(res, b...)
+}
+
+// missingSamples returns the given samples with timestamps not in the sorted list of timestamps.
+func missingSamples(samples []prompb.Sample, timestamps []int64) []prompb.Sample {
+	var res []prompb.Sample
+	for _, s := range samples {
+		i := sort.Search(len(timestamps), func(i int) bool { return timestamps[i] >= s.Timestamp })
+		if i < len(timestamps) && timestamps[i] == s.Timestamp {
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// checksum returns a hash of the given samples or zero if there are none.
+func checksum(samples []prompb.Sample) uint64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	d := xxhash.New()
+	b := make([]byte, 16)
+	for _, s := range samples {
+		binary.BigEndian.PutUint64(b[:8], uint64(s.Timestamp))
+		binary.BigEndian.PutUint64(b[8:], math.Float64bits(s.Value))
+		_, _ = d.Write(b)
+	}
+	return d.Sum64()
+}
+
+type trackedSeries struct {
+	tenant string
+	lset   labels.Labels
+	// maxt is the newest timestamp written locally.
+	maxt int64
+}
+
+// seriesTracker remembers the tenants and series that were recently written locally, up to a limit.
+// Tenants are needed to find other replicas of a series in the hashring and to read it from the tenant's TSDB.
+type seriesTracker struct {
+	limit int
+
+	mtx    sync.Mutex
+	series map[uint64]*trackedSeries
+}
+
+func newSeriesTracker(limit int) *seriesTracker {
+	return &seriesTracker{limit: limit, series: map[uint64]*trackedSeries{}}
+}
+
+// add remembers the given series and returns the number of series not remembered because the limit is reached.
+func (t *seriesTracker) add(tenant string, tss []prompb.TimeSeries) (dropped int) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for i := range tss {
+		if len(tss[i].Samples) == 0 {
+			continue
+		}
+		maxt := tss[i].Samples[len(tss[i].Samples)-1].Timestamp
+		key := hash(tenant, &tss[i])
+		if s, ok := t.series[key]; ok {
+			if maxt > s.maxt {
+				s.maxt = maxt
+			}
+			continue
+		}
+		if len(t.series) >= t.limit {
+			dropped++
+			continue
+		}
+		lset := make(labels.Labels, 0, len(tss[i].Labels))
+		for _, l := range tss[i].Labels {
+			lset = append(lset, labels.Label{Name: l.Name, Value: l.Value})
+		}
+		t.series[key] = &trackedSeries{tenant: tenant, lset: lset, maxt: maxt}
+	}
+	return dropped
+}
+
+// prune forgets series not written since mint and returns the remaining ones.
+func (t *seriesTracker) prune(mint int64) []trackedSeries {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	res := make([]trackedSeries, 0, len(t.series))
+	for k, s := range t.series {
+		if s.maxt < mint {
+			delete(t.series, k)
+			continue
+		}
+		res = append(res, *s)
+	}
+	return res
+}
+
+type antiEntropyMetrics struct {
+	trackedSeries    prometheus.Gauge
+	droppedSeries    prometheus.Counter
+	checkedSeries    prometheus.Counter
+	mismatchedSeries prometheus.Counter
+	repairedSamples  prometheus.Counter
+	repairRequests   *prometheus.CounterVec
+	failedRuns       prometheus.Counter
+}
+
+func newAntiEntropyMetrics(reg prometheus.Registerer) *antiEntropyMetrics {
+	return &antiEntropyMetrics{
+		trackedSeries: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_anti_entropy_tracked_series",
+			Help: "Number of recently written series that are compared with other replicas.",
+		}),
+		droppedSeries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_dropped_series_total",
+			Help: "Total number of written series not compared with other replicas because the limit of tracked series was reached.",
+		}),
+		checkedSeries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_checked_series_total",
+			Help: "Total number of series replicas compared with the local data.",
+		}),
+		mismatchedSeries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_mismatched_series_total",
+			Help: "Total number of series replicas with data different from the local data.",
+		}),
+		repairedSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_repaired_samples_total",
+			Help: "Total number of samples missing on other replicas that were written to them.",
+		}),
+		repairRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_repair_requests_total",
+			Help: "Total number of write requests sent to other replicas to repair missing data.",
+		}, []string{"result"}),
+		failedRuns: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_anti_entropy_failed_runs_total",
+			Help: "Total number of anti-entropy runs that failed to compare some replicas.",
+		}),
+	}
+}
+
+// RunAntiEntropy periodically compares recently written series with their other replicas and re-replicates data
+// missing on them until the context is canceled. Local data is read from the given tenant storage.
+//
+// Only series written through this handler are compared. Just the samples missing on a replica are written to it.
+// Samples older than the newest one the replica has for the series fill the gap only if the replica accepts
+// out-of-order samples, otherwise its TSDB rejects them. Series and tails of series are repaired in any case.
+func (h *Handler) RunAntiEntropy(ctx context.Context, db TenantQueryable) error {
+	if h.tracker == nil {
+		return errors.New("anti-entropy is not enabled")
+	}
+	return runutil.Repeat(h.options.AntiEntropy.Interval, ctx.Done(), func() error {
+		if err := h.antiEntropy(ctx, db, time.Now()); err != nil {
+			h.antiEntropyMetrics.failedRuns.Inc()
+			level.Warn(h.logger).Log("msg", "anti-entropy run failed", "err", err)
+		}
+		return nil
+	})
+}
+
+type replicaBatch struct {
+	replicas []uint64
+	series   []labels.Labels
+}
+
+func (h *Handler) antiEntropy(ctx context.Context, db TenantQueryable, now time.Time) error {
+	opts := h.options.AntiEntropy
+	maxt := timestamp.FromTime(now.Add(-opts.Delay))
+	mint := maxt - opts.Window.Milliseconds()
+
+	series := h.tracker.prune(mint)
+	h.antiEntropyMetrics.trackedSeries.Set(float64(len(series)))
+
+	h.mtx.RLock()
+	hashring := h.hashring
+	h.mtx.RUnlock()
+	if hashring == nil {
+		return nil
+	}
+
+	// Group series by tenant and the other replicas responsible for them.
+	batches := map[string]map[string]*replicaBatch{}
+	for _, s := range series {
+		ts := prompb.TimeSeries{Labels: make([]prompb.Label, 0, len(s.lset))}
+		for _, l := range s.lset {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: l.Name, Value: l.Value})
+		}
+		for i := uint64(0); i < h.options.ReplicationFactor; i++ {
+			endpoint, err := hashring.GetN(s.tenant, &ts, i)
+			if err != nil {
+				return err
+			}
+			if endpoint == h.options.Endpoint {
+				continue
+			}
+			if _, ok := batches[s.tenant]; !ok {
+				batches[s.tenant] = map[string]*replicaBatch{}
+			}
+			b, ok := batches[s.tenant][endpoint]
+			if !ok {
+				b = &replicaBatch{}
+				batches[s.tenant][endpoint] = b
+			}
+			b.replicas = append(b.replicas, i)
+			b.series = append(b.series, s.lset)
+		}
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultAntiEntropyBatchSize
+	}
+
+	var lastErr error
+	for tenant, tenantBatches := range batches {
+		if err := h.repairTenant(ctx, db, tenant, tenantBatches, mint, maxt, batchSize); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// repairTenant compares the given series of a tenant with the other replicas responsible for them.
+func (h *Handler) repairTenant(ctx context.Context, db TenantQueryable, tenant string, batches map[string]*replicaBatch, mint, maxt int64, batchSize int) error {
+	tdb, err := db.TenantQueryable(tenant)
+	if err != nil {
+		return errors.Wrapf(err, "get storage of tenant %s", tenant)
+	}
+	q, err := tdb.Querier(ctx, mint, maxt)
+	if err != nil {
+		return errors.Wrapf(err, "get local querier of tenant %s", tenant)
+	}
+	defer runutil.CloseWithLogOnErr(h.logger, q, "anti-entropy querier")
+	buf, err := tenantOutOfOrderBuffer(db, tenant)
+	if err != nil {
+		return errors.Wrapf(err, "get local out-of-order storage of tenant %s", tenant)
+	}
+
+	var lastErr error
+	for endpoint, b := range batches {
+		for i := 0; i < len(b.series); i += batchSize {
+			j := i + batchSize
+			if j > len(b.series) {
+				j = len(b.series)
+			}
+			if err := h.repairReplica(ctx, q, buf, endpoint, tenant, mint, maxt, b.replicas[i:j], b.series[i:j]); err != nil {
+				level.Warn(h.logger).Log("msg", "anti-entropy failed to compare replica", "endpoint", endpoint, "tenant", tenant, "err", err)
+				lastErr = err
+				break
+			}
+		}
+	}
+	return lastErr
+}
+
+// repairReplica compares the given series with the replica at the endpoint and writes local samples missing on
+// the replica to it.
+func (h *Handler) repairReplica(ctx context.Context, q storage.Querier, buf *outOfOrderBuffer, endpoint, tenant string, mint, maxt int64, replicas []uint64, series []labels.Labels) error {
+	local := make([][]prompb.Sample, 0, len(series))
+	sums := make([]uint64, 0, len(series))
+	for _, lset := range series {
+		samples, err := seriesSamples(q, buf, lset, mint, maxt)
+		if err != nil {
+			return errors.Wrap(err, "read local samples")
+		}
+		local = append(local, samples)
+		sums = append(sums, checksum(samples))
+	}
+
+	cl, err := h.peers.getChecksumClient(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	resp, err := cl.Checksum(ctx, &ChecksumRequest{Tenant: tenant, MinTime: mint, MaxTime: maxt, Series: series, Checksums: sums})
+	if err != nil {
+		return errors.Wrap(err, "get checksums")
+	}
+	if len(resp.Checksums) != len(series) || len(resp.Timestamps) != len(series) {
+		return errors.Errorf("expected %d checksums and timestamps, got %d and %d", len(series), len(resp.Checksums), len(resp.Timestamps))
+	}
+	h.antiEntropyMetrics.checkedSeries.Add(float64(len(series)))
+
+	repairs := map[uint64][]prompb.TimeSeries{}
+	for i, lset := range series {
+		if len(local[i]) == 0 || sums[i] == resp.Checksums[i] {
+			continue
+		}
+		h.antiEntropyMetrics.mismatchedSeries.Inc()
+
+		// Samples the replica has with a different value can't be repaired, they are rejected as duplicates.
+		missing := missingSamples(local[i], resp.Timestamps[i])
+		if len(missing) == 0 {
+			continue
+		}
+		ts := prompb.TimeSeries{Labels: make([]prompb.Label, 0, len(lset)), Samples: missing}
+		for _, l := range lset {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: l.Name, Value: l.Value})
+		}
+		repairs[replicas[i]] = append(repairs[replicas[i]], ts)
+	}
+
+	wcl, err := h.peers.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	for replica, tss := range repairs {
+		_, err := wcl.RemoteWrite(ctx, &storepb.WriteRequest{
+			Timeseries: tss,
+			Tenant:     tenant,
+			Replica:    int64(replica + 1), // On-the-wire format is 1-indexed, so the replica stores the data locally.
+		})
+		// Samples older than the newest one the replica has are rejected, unless it accepts out-of-order samples.
+		if err != nil && !isConflict(errors.Cause(err)) {
+			h.antiEntropyMetrics.repairRequests.WithLabelValues("error").Inc()
+			return errors.Wrap(err, "write missing samples")
+		}
+		h.antiEntropyMetrics.repairRequests.WithLabelValues("success").Inc()
+		for _, ts := range tss {
+			h.antiEntropyMetrics.repairedSamples.Add(float64(len(ts.Samples)))
+		}
+		level.Debug(h.logger).Log("msg", "repaired replica", "endpoint", endpoint, "tenant", tenant, "series", len(tss))
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/storage/tsdb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/shipper"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type unavailableWriteClient struct{}
+
+func (unavailableWriteClient) RemoteWrite(context.Context, *storepb.WriteRequest, ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	return nil, status.Error(codes.Unavailable, "unavailable")
+}
+
+type fakeChecksumClient struct {
+	s ChecksumServer
+}
+
+func (f *fakeChecksumClient) Checksum(ctx context.Context, in *ChecksumRequest, _ ...grpc.CallOption) (*ChecksumResponse, error) {
+	return f.s.Checksum(ctx, in)
+}
+
+func openTestStorage(t *testing.T, outOfOrder time.Duration) (*MultiTSDB, func()) {
+	dir, err := ioutil.TempDir("", "anti-entropy")
+	testutil.Ok(t, err)
+
+	db := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+		RetentionDuration: model.Duration(24 * time.Hour),
+		MinBlockDuration:  model.Duration(2 * time.Hour),
+		MaxBlockDuration:  model.Duration(2 * time.Hour),
+		NoLockfile:        true,
+	}, nil, 0, outOfOrder, nil, "tenant_id", nil, shipper.UploadOptions{})
+	testutil.Ok(t, db.Open())
+	return db, func() {
+		testutil.Ok(t, db.Close())
+		testutil.Ok(t, os.RemoveAll(dir))
+	}
+}
+
+func newAntiEntropyHandlers(t *testing.T, outOfOrder time.Duration) ([]*Handler, []*MultiTSDB, *peerGroup, func()) {
+	peers := &peerGroup{
+		cache:         map[string]storepb.WriteableStoreClient{},
+		checksumCache: map[string]ChecksumClient{},
+		m:             sync.RWMutex{},
+		dialer: func(context.Context, string, ...grpc.DialOption) (*grpc.ClientConn, error) {
+			return nil, errors.New("unexpected dial called in testing")
+		},
+	}
+	hashring := simpleHashring{"a", "b"}
+
+	var (
+		handlers []*Handler
+		dbs      []*MultiTSDB
+		closeFns []func()
+	)
+	for _, endpoint := range hashring {
+		db, closeFn := openTestStorage(t, outOfOrder)
+		closeFns = append(closeFns, closeFn)
+
+		h := NewHandler(nil, &Options{
+			Endpoint:          endpoint,
+			ReplicationFactor: 2,
+			Writer:            NewWriter(log.NewNopLogger(), db),
+			AntiEntropy:       &AntiEntropyOptions{Interval: time.Minute, Window: 10 * time.Minute, Delay: time.Minute, BatchSize: 1},
+		})
+		h.peers = peers
+		h.Hashring(hashring)
+		peers.cache[endpoint] = &fakeRemoteWriteGRPCServer{h: h}
+		peers.checksumCache[endpoint] = &fakeChecksumClient{s: NewChecksumServer(nil, db)}
+
+		handlers = append(handlers, h)
+		dbs = append(dbs, db)
+	}
+	return handlers, dbs, peers, func() {
+		for _, fn := range closeFns {
+			fn()
+		}
+	}
+}
+
+func testSeries(name string, base int64, from, to int) prompb.TimeSeries {
+	ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+	for i := from; i < to; i++ {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: base + int64(i)*1000, Value: float64(i)})
+	}
+	return ts
+}
+
+func testChecksums(t *testing.T, db *MultiTSDB, base int64, names ...string) []uint64 {
+	req := &ChecksumRequest{Tenant: "tenant", MinTime: base, MaxTime: base + 100*1000}
+	for _, n := range names {
+		req.Series = append(req.Series, labels.FromStrings("__name__", n))
+	}
+	resp, err := NewChecksumServer(nil, db).Checksum(context.Background(), req)
+	testutil.Ok(t, err)
+	return resp.Checksums
+}
+
+func TestAntiEntropy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	base := timestamp.FromTime(now.Add(-5 * time.Minute))
+
+	handlers, dbs, peers, closeFn := newAntiEntropyHandlers(t, 0)
+	defer closeFn()
+
+	// Both replicas receive the beginning of series a.
+	testutil.Ok(t, handlers[0].handleRequest(ctx, 0, "tenant", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{testSeries("a", base, 0, 5)}}))
+
+	// Forwarding to the second replica fails for the rest of series a and for the whole series b.
+	peers.cache["b"] = unavailableWriteClient{}
+	testutil.NotOk(t, handlers[0].handleRequest(ctx, 0, "tenant", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{testSeries("a", base, 5, 10), testSeries("b", base, 0, 10)}}))
+	peers.cache["b"] = &fakeRemoteWriteGRPCServer{h: handlers[1]}
+
+	before := testChecksums(t, dbs[1], base, "a", "b")
+	testutil.Assert(t, testChecksums(t, dbs[0], base, "a", "b")[0] != before[0], "expected series a to differ before repair")
+	testutil.Equals(t, uint64(0), before[1])
+
+	testutil.Ok(t, handlers[0].antiEntropy(ctx, dbs[0], now))
+	testutil.Equals(t, testChecksums(t, dbs[0], base, "a", "b"), testChecksums(t, dbs[1], base, "a", "b"))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.checkedSeries))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.mismatchedSeries))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.repairRequests.WithLabelValues("success")))
+	// Only samples missing on the replica are written to it.
+	testutil.Equals(t, 15.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.repairedSamples))
+
+	// Replicas are in sync, so nothing is repaired again.
+	testutil.Ok(t, handlers[0].antiEntropy(ctx, dbs[0], now))
+	testutil.Equals(t, 4.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.checkedSeries))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.mismatchedSeries))
+
+	// Series not written within the window are not compared anymore.
+	testutil.Ok(t, handlers[0].antiEntropy(ctx, dbs[0], now.Add(time.Hour)))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.trackedSeries))
+}
+
+func TestAntiEntropy_FillsGaps(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	base := timestamp.FromTime(now.Add(-5 * time.Minute))
+
+	handlers, dbs, peers, closeFn := newAntiEntropyHandlers(t, time.Hour)
+	defer closeFn()
+
+	// The second replica misses the middle of series a.
+	testutil.Ok(t, handlers[0].handleRequest(ctx, 0, "tenant", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{testSeries("a", base, 0, 5)}}))
+	peers.cache["b"] = unavailableWriteClient{}
+	testutil.NotOk(t, handlers[0].handleRequest(ctx, 0, "tenant", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{testSeries("a", base, 5, 10)}}))
+	peers.cache["b"] = &fakeRemoteWriteGRPCServer{h: handlers[1]}
+	testutil.Ok(t, handlers[0].handleRequest(ctx, 0, "tenant", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{testSeries("a", base, 10, 15)}}))
+
+	testutil.Assert(t, testChecksums(t, dbs[0], base, "a")[0] != testChecksums(t, dbs[1], base, "a")[0], "expected series a to differ before repair")
+
+	// The gap is older than the newest sample of the replica, so it is accepted as out of order.
+	testutil.Ok(t, handlers[0].antiEntropy(ctx, dbs[0], now))
+	testutil.Equals(t, testChecksums(t, dbs[0], base, "a"), testChecksums(t, dbs[1], base, "a"))
+	testutil.Equals(t, 5.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.repairedSamples))
+
+	// Buffered out-of-order samples are compared as well, so they are not written again.
+	testutil.Ok(t, handlers[0].antiEntropy(ctx, dbs[0], now))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.mismatchedSeries))
+	testutil.Equals(t, 5.0, promtestutil.ToFloat64(handlers[0].antiEntropyMetrics.repairedSamples))
+}
+
+func TestSeriesTracker_Limit(t *testing.T) {
+	tr := newSeriesTracker(2)
+	testutil.Equals(t, 0, tr.add("tenant", []prompb.TimeSeries{testSeries("a", 0, 0, 1), testSeries("b", 0, 0, 1)}))
+	// Known series are updated, new ones are dropped.
+	testutil.Equals(t, 1, tr.add("tenant", []prompb.TimeSeries{testSeries("a", 0, 1, 2), testSeries("c", 0, 0, 1)}))
+	testutil.Equals(t, 2, len(tr.prune(0)))
+
+	// Forgotten series make room for new ones.
+	testutil.Equals(t, 1, len(tr.prune(1000)))
+	testutil.Equals(t, 0, tr.add("tenant", []prompb.TimeSeries{testSeries("c", 0, 0, 1)}))
+	testutil.Equals(t, 2, len(tr.prune(0)))
+}
+
+func TestChecksumMessages_DefaultCodec(t *testing.T) {
+	codec := encoding.GetCodec("proto")
+
+	req := &ChecksumRequest{Tenant: "tenant", MinTime: 1, MaxTime: 2, Series: []labels.Labels{labels.FromStrings("a", "b")}, Checksums: []uint64{3}}
+	b, err := codec.Marshal(req)
+	testutil.Ok(t, err)
+	gotReq := &ChecksumRequest{}
+	testutil.Ok(t, codec.Unmarshal(b, gotReq))
+	testutil.Equals(t, req, gotReq)
+
+	resp := &ChecksumResponse{Checksums: []uint64{3, 0}, Timestamps: [][]int64{{1, 2}, nil}}
+	b, err = codec.Marshal(resp)
+	testutil.Ok(t, err)
+	gotResp := &ChecksumResponse{}
+	testutil.Ok(t, codec.Unmarshal(b, gotResp))
+	testutil.Equals(t, resp, gotResp)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	// Register the gzip compressor, so that it can be used for forwarding and forwarded requests can be decompressed.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	// NoCompression disables compression of forwarded requests.
+	NoCompression = "none"
+	// SnappyCompression compresses forwarded requests with the snappy framing format.
+	SnappyCompression = "snappy"
+	// GzipCompression compresses forwarded requests with gzip.
+	GzipCompression = "gzip"
+	// ZstdCompression compresses forwarded requests with zstd.
+	ZstdCompression = "zstd"
+)
+
+// ForwardCompressions are the supported compression algorithms of forwarded requests.
+var ForwardCompressions = []string{NoCompression, SnappyCompression, GzipCompression, ZstdCompression}
+
+func init() {
+	encoding.RegisterCompressor(newSnappyCompressor())
+	encoding.RegisterCompressor(newZstdCompressor())
+}
+
+// ForwardOptions configures how write requests are forwarded to other receivers.
+type ForwardOptions struct {
+	// Compression is the algorithm forwarded requests are compressed with. Receivers decompress requests with any
+	// of ForwardCompressions.
+	Compression string
+	// KeepaliveTime is how long a connection to another receiver can be idle before it is checked with a ping, so
+	// that it is kept open for reuse. Zero disables pings.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a response to a ping before the connection is closed.
+	KeepaliveTimeout time.Duration
+}
+
+// dialOptions returns the gRPC dial options for connections to other receivers.
+func (o *ForwardOptions) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if o.Compression != "" && o.Compression != NoCompression {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(o.Compression)))
+	}
+	if o.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepaliveTime,
+			Timeout:             o.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// ServerOptions returns the gRPC server options that accept the pings of other receivers forwarding requests with
+// the same options.
+func (o *ForwardOptions) ServerOptions() []grpc.ServerOption {
+	if o == nil || o.KeepaliveTime <= 0 {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             o.KeepaliveTime,
+		PermitWithoutStream: true,
+	})}
+}
+
+// snappyCompressor implements encoding.Compressor with the snappy framing format, reusing writers and readers.
+type snappyCompressor struct {
+	writerPool sync.Pool
+	readerPool sync.Pool
+}
+
+func newSnappyCompressor() *snappyCompressor {
+	c := &snappyCompressor{}
+	c.writerPool.New = func() interface{} {
+		return &snappyWriter{Writer: snappy.NewBufferedWriter(nil), pool: &c.writerPool}
+	}
+	return c
+}
+
+func (c *snappyCompressor) Name() string {
+	return SnappyCompression
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw := c.writerPool.Get().(*snappyWriter)
+	sw.Reset(w)
+	return sw, nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	sr, ok := c.readerPool.Get().(*snappyReader)
+	if !ok {
+		return &snappyReader{Reader: snappy.NewReader(r), pool: &c.readerPool}, nil
+	}
+	sr.Reset(r)
+	return sr, nil
+}
+
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+// Close flushes the writer and returns it to the pool.
+func (w *snappyWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Writer.Close()
+}
+
+type snappyReader struct {
+	*snappy.Reader
+	pool *sync.Pool
+}
+
+// Read returns the reader to the pool once it is fully read.
+func (r *snappyReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r)
+	}
+	return n, err
+}
+
+// zstdCompressor implements encoding.Compressor with zstd. Messages are compressed and decompressed at once by an
+// encoder and decoder shared by all calls, as streaming ones hold goroutines which pooled ones would leak.
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor() *zstdCompressor {
+	// Neither fails without a reader or writer and with valid options.
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	return &zstdCompressor{encoder: encoder, decoder: decoder}
+}
+
+func (c *zstdCompressor) Name() string {
+	return ZstdCompression
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdWriter{w: w, encoder: c.encoder}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err = c.decoder.DecodeAll(b, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// zstdWriter buffers a message and writes it compressed on Close.
+type zstdWriter struct {
+	bytes.Buffer
+	w       io.Writer
+	encoder *zstd.Encoder
+}
+
+func (w *zstdWriter) Close() error {
+	_, err := w.w.Write(w.encoder.EncodeAll(w.Bytes(), nil))
+	return err
+}
+
+type forwardRPCKey struct{}
+
+// forwardStatsHandler implements stats.Handler, observing the size of forwarded requests before and after
+// compression.
+type forwardStatsHandler struct {
+	uncompressedBytes prometheus.Counter
+	compressedBytes   prometheus.Counter
+	compressionRatio  prometheus.Histogram
+}
+
+func newForwardStatsHandler(reg prometheus.Registerer) *forwardStatsHandler {
+	return &forwardStatsHandler{
+		uncompressedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_forward_uncompressed_bytes_total",
+			Help: "The number of bytes of forwarded requests before compression.",
+		}),
+		compressedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_receive_forward_compressed_bytes_total",
+			Help: "The number of bytes of forwarded requests sent on the wire, after compression.",
+		}),
+		compressionRatio: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "thanos_receive_forward_compression_ratio",
+			Help:    "The ratio of the size of forwarded requests before and after compression.",
+			Buckets: []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 24},
+		}),
+	}
+}
+
+func (h *forwardStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, forwardRPCKey{}, info.FullMethodName == "/thanos.WriteableStore/RemoteWrite")
+}
+
+func (h *forwardStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	p, ok := s.(*stats.OutPayload)
+	if !ok || p.WireLength == 0 {
+		return
+	}
+	if forward, _ := ctx.Value(forwardRPCKey{}).(bool); !forward {
+		return
+	}
+	h.uncompressedBytes.Add(float64(p.Length))
+	h.compressedBytes.Add(float64(p.WireLength))
+	h.compressionRatio.Observe(float64(p.Length) / float64(p.WireLength))
+}
+
+func (h *forwardStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *forwardStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
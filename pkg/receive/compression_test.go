@@ -0,0 +1,39 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCompressors(t *testing.T) {
+	for _, name := range []string{SnappyCompression, GzipCompression, ZstdCompression} {
+		t.Run(name, func(t *testing.T) {
+			c := encoding.GetCompressor(name)
+			testutil.Assert(t, c != nil, "%s compressor not registered", name)
+
+			// Writers and readers may be reused, so compress and decompress more than once.
+			for _, msg := range [][]byte{bytes.Repeat([]byte("series"), 1000), []byte("sample"), {}} {
+				buf := &bytes.Buffer{}
+				w, err := c.Compress(buf)
+				testutil.Ok(t, err)
+				_, err = w.Write(msg)
+				testutil.Ok(t, err)
+				testutil.Ok(t, w.Close())
+
+				r, err := c.Decompress(buf)
+				testutil.Ok(t, err)
+				res, err := ioutil.ReadAll(r)
+				testutil.Ok(t, err)
+				testutil.Equals(t, string(msg), string(res))
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+var errOutOfOrderExemplar = errors.New("out of order exemplar")
+
+// ExemplarAppender appends exemplars of series.
+type ExemplarAppender interface {
+	AddExemplar(lset labels.Labels, e prompb.Exemplar) error
+}
+
+// exemplarStorage keeps the most recent exemplars of a tenant in memory, up to a fixed number. Once it is full, the
+// oldest exemplar is evicted for every new one.
+type exemplarStorage struct {
+	mtx       sync.RWMutex
+	exemplars []exemplarEntry
+	next      int
+	// index holds the exemplars of every series, by series labels.
+	index map[string]*exemplarSeries
+}
+
+// exemplarSeries points to the oldest and newest exemplar of a series.
+type exemplarSeries struct {
+	key    string
+	lset   labels.Labels
+	oldest int
+	newest int
+}
+
+type exemplarEntry struct {
+	// series is nil if the entry was not used yet.
+	series   *exemplarSeries
+	exemplar prompb.Exemplar
+	// next is the index of the next newer exemplar of the same series or -1 if there is none.
+	next int
+}
+
+func newExemplarStorage(size int64) *exemplarStorage {
+	return &exemplarStorage{
+		exemplars: make([]exemplarEntry, size),
+		index:     map[string]*exemplarSeries{},
+	}
+}
+
+// AddExemplar appends an exemplar of the given series. Exemplars of a series must be appended in order of their
+// timestamps. An exemplar equal to the newest exemplar of the series is ignored.
+func (s *exemplarStorage) AddExemplar(lset labels.Labels, e prompb.Exemplar) error {
+	key := lset.String()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if series, ok := s.index[key]; ok {
+		newest := s.exemplars[series.newest].exemplar
+		if e.Timestamp == newest.Timestamp && e.Value == newest.Value && labelsEqual(e.Labels, newest.Labels) {
+			return nil
+		}
+		if e.Timestamp <= newest.Timestamp {
+			return errOutOfOrderExemplar
+		}
+	}
+
+	entry := &s.exemplars[s.next]
+	if entry.series != nil {
+		// Evict the oldest exemplar.
+		if entry.next == -1 {
+			delete(s.index, entry.series.key)
+		} else {
+			entry.series.oldest = entry.next
+		}
+	}
+
+	series, ok := s.index[key]
+	if !ok {
+		series = &exemplarSeries{key: key, lset: lset, oldest: s.next}
+		s.index[key] = series
+	} else {
+		s.exemplars[series.newest].next = s.next
+	}
+	series.newest = s.next
+	*entry = exemplarEntry{series: series, exemplar: e, next: -1}
+
+	s.next = (s.next + 1) % len(s.exemplars)
+	return nil
+}
+
+// Select returns exemplars of series matching any of the given sets of matchers within [mint, maxt], sorted by
+// series labels.
+func (s *exemplarStorage) Select(mint, maxt int64, matchers ...[]*labels.Matcher) ([]*exemplarspb.ExemplarData, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var res []*exemplarspb.ExemplarData
+	for _, series := range s.index {
+		if !matchesAny(series.lset, matchers) {
+			continue
+		}
+
+		d := &exemplarspb.ExemplarData{SeriesLabels: storepb.LabelSet{Labels: storepb.PromLabelsToLabels(series.lset)}}
+		for i := series.oldest; i != -1; i = s.exemplars[i].next {
+			e := s.exemplars[i].exemplar
+			if e.Timestamp < mint {
+				continue
+			}
+			if e.Timestamp > maxt {
+				break
+			}
+			lset := make([]storepb.Label, 0, len(e.Labels))
+			for _, l := range e.Labels {
+				lset = append(lset, storepb.Label{Name: l.Name, Value: l.Value})
+			}
+			d.Exemplars = append(d.Exemplars, exemplarspb.Exemplar{
+				Labels: storepb.LabelSet{Labels: lset},
+				Value:  e.Value,
+				Ts:     e.Timestamp,
+			})
+		}
+		if len(d.Exemplars) > 0 {
+			res = append(res, d)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return storepb.CompareLabels(res[i].SeriesLabels.Labels, res[j].SeriesLabels.Labels) < 0
+	})
+	return res, nil
+}
+
+// matchesAny returns true if the given labels match all matchers of any of the given sets.
+func matchesAny(lset labels.Labels, matchers [][]*labels.Matcher) bool {
+outer:
+	for _, ms := range matchers {
+		for _, m := range ms {
+			if !m.Matches(lset.Get(m.Name)) {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func labelsEqual(a, b []prompb.Label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestExemplarStorage(t *testing.T) {
+	s := newExemplarStorage(3)
+	foo := labels.FromStrings("__name__", "foo")
+	bar := labels.FromStrings("__name__", "bar")
+	traceID := []prompb.Label{{Name: "trace_id", Value: "abc"}}
+
+	testutil.Ok(t, s.AddExemplar(foo, prompb.Exemplar{Labels: traceID, Value: 1, Timestamp: 1}))
+	testutil.Ok(t, s.AddExemplar(bar, prompb.Exemplar{Value: 2, Timestamp: 2}))
+	testutil.Ok(t, s.AddExemplar(foo, prompb.Exemplar{Value: 3, Timestamp: 3}))
+
+	// Resent exemplars are ignored, older ones are rejected.
+	testutil.Ok(t, s.AddExemplar(foo, prompb.Exemplar{Value: 3, Timestamp: 3}))
+	testutil.Equals(t, errOutOfOrderExemplar, s.AddExemplar(foo, prompb.Exemplar{Value: 2, Timestamp: 2}))
+
+	all := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+")}
+	data, err := s.Select(0, 10, all)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*exemplarspb.ExemplarData{
+		{
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__name__", Value: "bar"}}},
+			Exemplars:    []exemplarspb.Exemplar{{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 2, Ts: 2}},
+		},
+		{
+			SeriesLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__name__", Value: "foo"}}},
+			Exemplars: []exemplarspb.Exemplar{
+				{Labels: storepb.LabelSet{Labels: []storepb.Label{{Name: "trace_id", Value: "abc"}}}, Value: 1, Ts: 1},
+				{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 3, Ts: 3},
+			},
+		},
+	}, data)
+
+	// The oldest exemplars are evicted once the storage is full.
+	testutil.Ok(t, s.AddExemplar(foo, prompb.Exemplar{Value: 4, Timestamp: 4}))
+	testutil.Ok(t, s.AddExemplar(foo, prompb.Exemplar{Value: 5, Timestamp: 5}))
+	data, err = s.Select(0, 10, all)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(data))
+	testutil.Equals(t, []exemplarspb.Exemplar{
+		{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 3, Ts: 3},
+		{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 4, Ts: 4},
+		{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 5, Ts: 5},
+	}, data[0].Exemplars)
+
+	// Exemplars are selected by matchers and time range.
+	data, err = s.Select(4, 4, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "foo")})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(data))
+	testutil.Equals(t, []exemplarspb.Exemplar{{Labels: storepb.LabelSet{Labels: []storepb.Label{}}, Value: 4, Ts: 4}}, data[0].Exemplars)
+
+	data, err = s.Select(0, 10, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "bar")})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(data))
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -40,6 +41,10 @@ import (
 const (
 	// DefaultTenantHeader is the default header used to designate the tenant making a write request.
 	DefaultTenantHeader = "THANOS-TENANT"
+	// DefaultTenant is the default value used for when no tenant is passed via the tenant header.
+	DefaultTenant = "default-tenant"
+	// DefaultTenantLabel is the default label name used to announce the tenant of a TSDB.
+	DefaultTenantLabel = "tenant_id"
 	// DefaultReplicaHeader is the default header used to designate the replica count of a write request.
 	DefaultReplicaHeader = "THANOS-REPLICA"
 )
@@ -49,18 +54,38 @@ var conflictErr = errors.New("conflict")
 
 var errBadReplica = errors.New("replica count exceeds replication factor")
 
+// errQuorumNotReached is returned whenever a write request was not stored by a quorum of its replicas.
+// Clients are expected to retry such requests.
+var errQuorumNotReached = errors.New("write quorum not reached")
+
 // Options for the web Handler.
 type Options struct {
 	Writer            *Writer
 	ListenAddress     string
 	Registry          prometheus.Registerer
 	TenantHeader      string
+	DefaultTenantID   string
 	ReplicaHeader     string
 	Endpoint          string
 	ReplicationFactor uint64
 	Tracer            opentracing.Tracer
 	TLSConfig         *tls.Config
 	DialOpts          []grpc.DialOption
+	// AntiEntropy enables tracking of locally written series for RunAntiEntropy, if set.
+	AntiEntropy *AntiEntropyOptions
+	// Limiter enforces ingestion limits of tenants on requests received from clients, if set.
+	Limiter *Limiter
+	// MaxConcurrentRequests is the maximum number of write requests handled at once. Zero means no limit.
+	MaxConcurrentRequests int
+	// MaxRequestBodyBytes is the maximum size of the compressed body of a write request. Zero means no limit.
+	MaxRequestBodyBytes int64
+	// HashringTransitionPeriod is how long time series whose endpoint changed with a new hashring are also
+	// written to their endpoint in the previous hashring. Zero disables dual routing.
+	HashringTransitionPeriod time.Duration
+	// Forward configures compression and connection reuse of requests forwarded to other receivers, if set.
+	Forward *ForwardOptions
+	// Shadows are remote write endpoints that write requests accepted from clients are additionally written to.
+	Shadows []*Shadow
 }
 
 // Handler serves a Prometheus remote write receiving HTTP endpoint.
@@ -73,10 +98,22 @@ type Handler struct {
 
 	mtx      sync.RWMutex
 	hashring Hashring
-	peers    *peerGroup
+	// prevHashring is the hashring replaced by the current one, used for dual routing until transitionEnd.
+	prevHashring  Hashring
+	transitionEnd time.Time
+	// joinedEnd is the end of the transition period of the hashring change the local endpoint joined the hashring with.
+	joinedEnd time.Time
+	peers     *peerGroup
+	tracker   *seriesTracker
+	// inflight holds a token for every write request being handled, if their number is limited.
+	inflight chan struct{}
 
 	// Metrics.
-	forwardRequestsTotal *prometheus.CounterVec
+	forwardRequestsTotal    *prometheus.CounterVec
+	hashringTransitions     prometheus.Counter
+	dualRoutedRequestsTotal *prometheus.CounterVec
+	rejectedRequestsTotal   *prometheus.CounterVec
+	antiEntropyMetrics      *antiEntropyMetrics
 }
 
 func NewHandler(logger log.Logger, o *Options) *Handler {
@@ -84,18 +121,53 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 		logger = log.NewNopLogger()
 	}
 
+	dialOpts := append([]grpc.DialOption{}, o.DialOpts...)
+	if o.Forward != nil {
+		dialOpts = append(dialOpts, o.Forward.dialOptions()...)
+	}
+	dialOpts = append(dialOpts, grpc.WithStatsHandler(newForwardStatsHandler(o.Registry)))
+
 	h := &Handler{
 		logger:  logger,
 		writer:  o.Writer,
 		router:  route.New(),
 		options: o,
-		peers:   newPeerGroup(o.DialOpts...),
+		peers:   newPeerGroup(dialOpts...),
 		forwardRequestsTotal: promauto.With(o.Registry).NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "thanos_receive_forward_requests_total",
 				Help: "The number of forward requests.",
 			}, []string{"result"},
 		),
+		hashringTransitions: promauto.With(o.Registry).NewCounter(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_hashring_transitions_total",
+				Help: "The number of hashring changes that started a transition period with dual routing.",
+			},
+		),
+		dualRoutedRequestsTotal: promauto.With(o.Registry).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_dual_routed_requests_total",
+				Help: "The number of write requests written to both the current and the previous endpoint of their time series during a hashring transition.",
+			}, []string{"result"},
+		),
+		rejectedRequestsTotal: promauto.With(o.Registry).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_rejected_requests_total",
+				Help: "The number of write requests rejected with 429 before they were read, by reason.",
+			}, []string{"reason"},
+		),
+	}
+	if o.MaxConcurrentRequests > 0 {
+		h.inflight = make(chan struct{}, o.MaxConcurrentRequests)
+	}
+	if o.AntiEntropy != nil {
+		limit := o.AntiEntropy.MaxTrackedSeries
+		if limit <= 0 {
+			limit = DefaultAntiEntropyMaxTrackedSeries
+		}
+		h.tracker = newSeriesTracker(limit)
+		h.antiEntropyMetrics = newAntiEntropyMetrics(o.Registry)
 	}
 
 	ins := extpromhttp.NewNopInstrumentationMiddleware()
@@ -111,7 +183,7 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 		return ins.NewHandler(name, http.HandlerFunc(next))
 	}
 
-	h.router.Post("/api/v1/receive", instrf("receive", readyf(h.receiveHTTP)))
+	h.router.Post("/api/v1/receive", instrf("receive", readyf(h.limitRequests(h.receiveHTTP))))
 
 	return h
 }
@@ -130,10 +202,69 @@ func (h *Handler) SetWriter(w *Writer) {
 // The hashring must be set to a non-nil value in order for the
 // handler to be ready and usable.
 // If the hashring is nil, then the handler is marked as not ready.
-func (h *Handler) Hashring(hashring Hashring) {
+// Replacing a hashring starts a transition period, in which time series are
+// also routed by the previous hashring.
+// It returns true if the local endpoint joined the hashring with a transition period, i.e. it was not a node
+// of the replaced hashring. The handler is not converged until the transition period is over then.
+func (h *Handler) Hashring(hashring Hashring) (joined bool) {
 	h.mtx.Lock()
 	defer h.mtx.Unlock()
+
+	h.prevHashring = nil
+	if h.hashring != nil && hashring != nil && h.options.HashringTransitionPeriod > 0 {
+		h.prevHashring = h.hashring
+		h.transitionEnd = time.Now().Add(h.options.HashringTransitionPeriod)
+		h.hashringTransitions.Inc()
+
+		if !hasNode(h.prevHashring, h.options.Endpoint) && hasNode(hashring, h.options.Endpoint) {
+			h.joinedEnd = h.transitionEnd
+			joined = true
+		}
+	}
 	h.hashring = hashring
+	return joined
+}
+
+func hasNode(hashring Hashring, node string) bool {
+	for _, n := range hashring.Nodes() {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// previousHashring returns the previous hashring during a transition period and nil otherwise.
+// It must be called with the lock held.
+func (h *Handler) previousHashring() Hashring {
+	if h.prevHashring == nil || time.Now().After(h.transitionEnd) {
+		return nil
+	}
+	return h.prevHashring
+}
+
+// Converged returns whether the handler is ready and, if the local endpoint joined the hashring with a transition
+// period, the period is over, so that all receivers are assumed to route time series to it.
+// Members of the previous hashring are converged during transitions, as they still receive their time series.
+func (h *Handler) Converged() bool {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.writer != nil && h.hashring != nil && !time.Now().Before(h.joinedEnd)
+}
+
+// previousEndpoint returns the endpoint responsible for the time series in the previous hashring
+// if it differs from the given one, or an empty string otherwise.
+// Requests received from clients are routed to it. Replicated requests are routed only to the local
+// node, so that requests are not forwarded back and forth between receivers in transition.
+func (h *Handler) previousEndpoint(prev Hashring, tenant string, ts *prompb.TimeSeries, r replica, endpoint string) string {
+	p, err := prev.GetN(tenant, ts, r.n)
+	if err != nil || p == endpoint {
+		return ""
+	}
+	if r.replicated && p != h.options.Endpoint {
+		return ""
+	}
+	return p
 }
 
 // Verifies whether the server is ready or not.
@@ -224,6 +355,11 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string,
 		r.n--
 	}
 
+	// Requests without tenant are written to the default tenant.
+	if tenant == "" {
+		tenant = h.options.DefaultTenantID
+	}
+
 	// Forward any time series as necessary. All time series
 	// destined for the local node will be written to the receiver.
 	// Time series will be replicated as necessary.
@@ -231,13 +367,31 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string,
 		if countCause(err, isConflict) > 0 {
 			return conflictErr
 		}
+		if countCause(err, isQuorumNotReached) > 0 {
+			level.Warn(h.logger).Log("msg", "write request was not replicated", "tenant", tenant, "err", err)
+			return errQuorumNotReached
+		}
 		return err
 	}
 	return nil
 }
 
+// tenant returns the tenant of a write request.
+func (h *Handler) tenant(r *http.Request) string {
+	if tenant := r.Header.Get(h.options.TenantHeader); tenant != "" {
+		return tenant
+	}
+	return h.options.DefaultTenantID
+}
+
 func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := h.tenant(r)
+
 	compressed, err := ioutil.ReadAll(r.Body)
+	if err == errRequestBodyTooLarge {
+		h.rejectBodyTooLarge(w, tenant)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -265,16 +419,38 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	tenant := r.Header.Get(h.options.TenantHeader)
+	// Limits are enforced only once, when a request is received from a client and not yet replicated. If only some
+	// series are rejected, the others are written before the request is answered with the limit error.
+	var limitErr error
+	if h.options.Limiter != nil && rep == 0 {
+		if limitErr = h.options.Limiter.Check(tenant, &wreq); limitErr != nil {
+			level.Debug(h.logger).Log("msg", "rejected write request", "tenant", tenant, "err", limitErr)
+			if !isPartialLimitError(limitErr) {
+				http.Error(w, limitErr.Error(), limitStatusCode(limitErr))
+				return
+			}
+		}
+	}
 
 	err = h.handleRequest(r.Context(), rep, tenant, &wreq)
 	switch err {
 	case nil:
+		// Only the receiver that accepted a request from a client shadows it, so that it is shadowed once.
+		if rep == 0 {
+			for _, s := range h.options.Shadows {
+				s.Enqueue(tenant, &wreq)
+			}
+		}
+		if limitErr != nil {
+			http.Error(w, limitErr.Error(), limitStatusCode(limitErr))
+		}
 		return
 	case conflictErr:
 		http.Error(w, err.Error(), http.StatusConflict)
 	case errBadReplica:
 		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errQuorumNotReached:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 	default:
 		level.Error(h.logger).Log("err", err, "msg", "internal server error")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -292,6 +468,7 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *prompb.WriteRequest) error {
 	wreqs := make(map[string]*prompb.WriteRequest)
 	replicas := make(map[string]replica)
+	dualWreqs := make(map[endpointPair]*prompb.WriteRequest)
 
 	// It is possible that hashring is ready in testReady() but unready now,
 	// so need to lock here.
@@ -301,6 +478,14 @@ func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *p
 		return errors.New("hashring is not ready")
 	}
 
+	// During a hashring transition, time series stored by the endpoints selected
+	// here are also routed to their endpoints in the previous hashring. If the
+	// request still needs to be replicated, replicate takes care of this.
+	prev := h.previousHashring()
+	if !r.replicated && h.options.ReplicationFactor > 1 {
+		prev = nil
+	}
+
 	// Batch all of the time series in the write request
 	// into several smaller write requests that are
 	// grouped by target endpoint. This ensures that
@@ -314,6 +499,16 @@ func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *p
 			h.mtx.RUnlock()
 			return err
 		}
+		if prev != nil {
+			if p := h.previousEndpoint(prev, tenant, &wreq.Timeseries[i], r, endpoint); p != "" {
+				k := endpointPair{endpoint: endpoint, previous: p}
+				if _, ok := dualWreqs[k]; !ok {
+					dualWreqs[k] = &prompb.WriteRequest{}
+				}
+				dualWreqs[k].Timeseries = append(dualWreqs[k].Timeseries, wreq.Timeseries[i])
+				continue
+			}
+		}
 		if _, ok := wreqs[endpoint]; !ok {
 			wreqs[endpoint] = &prompb.WriteRequest{}
 			replicas[endpoint] = r
@@ -323,7 +518,60 @@ func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *p
 	}
 	h.mtx.RUnlock()
 
-	return h.parallelizeRequests(ctx, tenant, replicas, wreqs)
+	if len(dualWreqs) == 0 {
+		return h.parallelizeRequests(ctx, tenant, replicas, wreqs)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs terrors.MultiError
+	)
+	for k, wr := range dualWreqs {
+		wg.Add(1)
+		go func(k endpointPair, wr *prompb.WriteRequest) {
+			defer wg.Done()
+			if err := h.writeWithPrevious(ctx, tenant, r, k, wr); err != nil {
+				mtx.Lock()
+				errs.Add(err)
+				mtx.Unlock()
+			}
+		}(k, wr)
+	}
+	if len(wreqs) > 0 {
+		if err := h.parallelizeRequests(ctx, tenant, replicas, wreqs); err != nil {
+			mtx.Lock()
+			errs.Add(err)
+			mtx.Unlock()
+		}
+	}
+	wg.Wait()
+	return errs.Err()
+}
+
+// endpointPair identifies the current and the previous endpoint of time series during a hashring transition.
+type endpointPair struct {
+	endpoint string
+	previous string
+}
+
+// writeWithPrevious writes a request to the current and the previous endpoint of its time series in parallel.
+// It succeeds if any of the writes succeeds and otherwise returns the error of the current endpoint.
+func (h *Handler) writeWithPrevious(ctx context.Context, tenant string, r replica, k endpointPair, wreq *prompb.WriteRequest) error {
+	prevErrC := make(chan error, 1)
+	go func() {
+		prevErrC <- h.parallelizeRequests(ctx, tenant, map[string]replica{k.previous: r}, map[string]*prompb.WriteRequest{k.previous: wreq})
+	}()
+	err := h.parallelizeRequests(ctx, tenant, map[string]replica{k.endpoint: r}, map[string]*prompb.WriteRequest{k.endpoint: wreq})
+	prevErr := <-prevErrC
+
+	if err == nil || prevErr == nil {
+		h.dualRoutedRequestsTotal.WithLabelValues("success").Inc()
+		return nil
+	}
+	h.dualRoutedRequestsTotal.WithLabelValues("error").Inc()
+	level.Debug(h.logger).Log("msg", "writing to previous endpoint failed", "endpoint", k.previous, "err", prevErr)
+	return err
 }
 
 // parallelizeRequests parallelizes a given set of write requests.
@@ -364,9 +612,11 @@ func (h *Handler) parallelizeRequests(ctx context.Context, tenant string, replic
 				} else {
 					// Create a span to track writing the request into TSDB.
 					tracing.DoInSpan(ctx, "receive_tsdb_write", func(ctx context.Context) {
-
-						err = h.writer.Write(wreqs[endpoint])
+						err = h.writer.Write(tenant, wreqs[endpoint])
 					})
+					if h.tracker != nil {
+						h.antiEntropyMetrics.droppedSeries.Add(float64(h.tracker.add(tenant, wreqs[endpoint].Timeseries)))
+					}
 					// When a MultiError is added to another MultiError, the error slices are concatenated, not nested.
 					// To avoid breaking the counting logic, we need to flatten the error.
 					if errs, ok := err.(terrors.MultiError); ok {
@@ -456,6 +706,8 @@ func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.Wri
 		return errors.New("hashring is not ready")
 	}
 
+	prev := h.previousHashring()
+	previous := make(map[string]string)
 	for i = 0; i < h.options.ReplicationFactor; i++ {
 		endpoint, err := h.hashring.GetN(tenant, &wreq.Timeseries[0], i)
 		if err != nil {
@@ -464,20 +716,71 @@ func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.Wri
 		}
 		wreqs[endpoint] = wreq
 		replicas[endpoint] = replica{i, true}
+		if prev != nil {
+			// The request to replicate was received from a client, so it may be routed to any previous endpoint.
+			if p := h.previousEndpoint(prev, tenant, &wreq.Timeseries[0], replica{n: i}, endpoint); p != "" {
+				previous[endpoint] = p
+			}
+		}
 	}
 	h.mtx.RUnlock()
 
-	err := h.parallelizeRequests(ctx, tenant, replicas, wreqs)
-	if errs, ok := err.(terrors.MultiError); ok {
-		if uint64(countCause(errs, isConflict)) >= (h.options.ReplicationFactor+1)/2 {
-			return errors.Wrap(conflictErr, "did not meet replication threshold")
-		}
-		if uint64(len(errs)) >= (h.options.ReplicationFactor+1)/2 {
-			return errors.Wrap(err, "did not meet replication threshold")
-		}
-		return nil
+	var err error
+	if len(previous) == 0 {
+		err = h.parallelizeRequests(ctx, tenant, replicas, wreqs)
+	} else {
+		err = h.parallelizeRequestsWithPrevious(ctx, tenant, replicas, wreqs, previous)
 	}
-	return errors.Wrap(err, "could not replicate write request")
+	errs, ok := err.(terrors.MultiError)
+	if !ok {
+		return errors.Wrap(err, "could not replicate write request")
+	}
+
+	// The write request succeeds once a quorum of replicas stored it, so at most
+	// (replication-factor - quorum) replicas may fail.
+	maxFailures := h.options.ReplicationFactor - h.writeQuorum()
+	if uint64(countCause(errs, isConflict)) > maxFailures {
+		return errors.Wrap(conflictErr, "did not meet replication threshold")
+	}
+	if uint64(len(errs)) > maxFailures {
+		return errors.Wrapf(errQuorumNotReached, "did not meet replication threshold, %d of %d replicas failed (%v)", len(errs), h.options.ReplicationFactor, errs)
+	}
+	return nil
+}
+
+// parallelizeRequestsWithPrevious is like parallelizeRequests, but writes requests also to the previous
+// endpoints given by endpoint. A request succeeds if any of its writes succeeds.
+func (h *Handler) parallelizeRequestsWithPrevious(ctx context.Context, tenant string, replicas map[string]replica, wreqs map[string]*prompb.WriteRequest, previous map[string]string) error {
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs terrors.MultiError
+	)
+	for endpoint := range wreqs {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+
+			var err error
+			if p, ok := previous[endpoint]; ok {
+				err = h.writeWithPrevious(ctx, tenant, replicas[endpoint], endpointPair{endpoint: endpoint, previous: p}, wreqs[endpoint])
+			} else {
+				err = h.parallelizeRequests(ctx, tenant, map[string]replica{endpoint: replicas[endpoint]}, map[string]*prompb.WriteRequest{endpoint: wreqs[endpoint]})
+			}
+			if err != nil {
+				mtx.Lock()
+				errs.Add(err)
+				mtx.Unlock()
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+	return errs.Err()
+}
+
+// writeQuorum returns the number of replicas that must store a write request for it to succeed.
+func (h *Handler) writeQuorum() uint64 {
+	return h.options.ReplicationFactor/2 + 1
 }
 
 // RemoteWrite implements the gRPC remote write handler for storepb.WriteableStore.
@@ -490,6 +793,8 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 		return nil, status.Error(codes.AlreadyExists, err.Error())
 	case errBadReplica:
 		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errQuorumNotReached:
+		return nil, status.Error(codes.Unavailable, err.Error())
 	default:
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -513,6 +818,12 @@ func countCause(err error, f func(error) bool) int {
 	return n
 }
 
+// isQuorumNotReached returns whether or not the given error represents a write request that was
+// not stored by a quorum of its replicas.
+func isQuorumNotReached(err error) bool {
+	return err == errQuorumNotReached
+}
+
 // isConflict returns whether or not the given error represents a conflict.
 func isConflict(err error) bool {
 	if err == nil {
@@ -528,17 +839,19 @@ func isConflict(err error) bool {
 
 func newPeerGroup(dialOpts ...grpc.DialOption) *peerGroup {
 	return &peerGroup{
-		dialOpts: dialOpts,
-		cache:    map[string]storepb.WriteableStoreClient{},
-		m:        sync.RWMutex{},
-		dialer:   grpc.DialContext,
+		dialOpts:      dialOpts,
+		cache:         map[string]storepb.WriteableStoreClient{},
+		checksumCache: map[string]ChecksumClient{},
+		m:             sync.RWMutex{},
+		dialer:        grpc.DialContext,
 	}
 }
 
 type peerGroup struct {
-	dialOpts []grpc.DialOption
-	cache    map[string]storepb.WriteableStoreClient
-	m        sync.RWMutex
+	dialOpts      []grpc.DialOption
+	cache         map[string]storepb.WriteableStoreClient
+	checksumCache map[string]ChecksumClient
+	m             sync.RWMutex
 
 	// dialer is used for testing.
 	dialer func(ctx context.Context, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error)
@@ -569,3 +882,27 @@ func (p *peerGroup) get(ctx context.Context, addr string) (storepb.WriteableStor
 	p.cache[addr] = client
 	return client, nil
 }
+
+func (p *peerGroup) getChecksumClient(ctx context.Context, addr string) (ChecksumClient, error) {
+	p.m.RLock()
+	c, ok := p.checksumCache[addr]
+	p.m.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	c, ok = p.checksumCache[addr]
+	if ok {
+		return c, nil
+	}
+	conn, err := p.dialer(ctx, addr, p.dialOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial peer")
+	}
+
+	client := NewChecksumClient(conn)
+	p.checksumCache[addr] = client
+	return client, nil
+}
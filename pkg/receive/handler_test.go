@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/gogo/protobuf/proto"
@@ -23,6 +24,7 @@ import (
 	terrors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
 	"google.golang.org/grpc"
 )
 
@@ -316,7 +318,7 @@ func TestReceive(t *testing.T) {
 		},
 		{
 			name:              "size 3 commit error with replication",
-			status:            http.StatusInternalServerError,
+			status:            http.StatusServiceUnavailable,
 			replicationFactor: 3,
 			wreq:              wreq1,
 			appendables: []*fakeAppendable{
@@ -333,7 +335,7 @@ func TestReceive(t *testing.T) {
 		},
 		{
 			name:              "size 3 appender error with replication",
-			status:            http.StatusInternalServerError,
+			status:            http.StatusServiceUnavailable,
 			replicationFactor: 3,
 			wreq:              wreq1,
 			appendables: []*fakeAppendable{
@@ -438,7 +440,7 @@ func TestReceive(t *testing.T) {
 		},
 		{
 			name:              "size 3 with replication one conflict and one commit error",
-			status:            http.StatusInternalServerError,
+			status:            http.StatusServiceUnavailable,
 			replicationFactor: 3,
 			wreq:              wreq1,
 			appendables: []*fakeAppendable{
@@ -455,7 +457,7 @@ func TestReceive(t *testing.T) {
 		},
 		{
 			name:              "size 3 with replication two commit errors",
-			status:            http.StatusInternalServerError,
+			status:            http.StatusServiceUnavailable,
 			replicationFactor: 3,
 			wreq:              wreq1,
 			appendables: []*fakeAppendable{
@@ -559,7 +561,7 @@ func makeRequest(h *Handler, tenant string, wreq *prompb.WriteRequest) (int, err
 	req.Header.Add(h.options.TenantHeader, tenant)
 
 	rec := httptest.NewRecorder()
-	h.receiveHTTP(rec, req)
+	h.limitRequests(h.receiveHTTP)(rec, req)
 	rec.Flush()
 
 	return rec.Code, nil
@@ -576,3 +578,83 @@ type fakeRemoteWriteGRPCServer struct {
 func (f *fakeRemoteWriteGRPCServer) RemoteWrite(ctx context.Context, in *storepb.WriteRequest, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
 	return f.h.RemoteWrite(ctx, in)
 }
+
+func TestReceiveHashringTransition(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+	}
+	handlers, _ := newHandlerHashring(appendables, 1)
+
+	// The new hashring swaps the endpoints responsible for every time series.
+	hashring := newMultiHashring([]HashringConfig{{
+		Hashring:  "test",
+		Endpoints: []string{handlers[1].options.Endpoint, handlers[0].options.Endpoint},
+	}})
+	for _, h := range handlers {
+		h.options.HashringTransitionPeriod = time.Minute
+		h.Hashring(hashring)
+	}
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "foo", Value: "bar"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+	endpoint, err := hashring.GetN("test", &wreq.Timeseries[0], 0)
+	testutil.Ok(t, err)
+	current := 0
+	if handlers[1].options.Endpoint == endpoint {
+		current = 1
+	}
+
+	// During the transition, time series are written to their current and previous endpoint.
+	status, err := makeRequest(handlers[0], "test", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, status)
+	for i, a := range appendables {
+		testutil.Assert(t, len(a.appender.(*fakeAppender).samples) > 0, "expected samples in appendable %d", i)
+	}
+
+	// Writes succeed while the previous endpoint stores them.
+	appendables[current].appenderErr = func() error { return errors.New("failed to get appender") }
+	status, err = makeRequest(handlers[0], "test", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, status)
+
+	// Members of the previous hashring stay converged. After the transition, only the current endpoint is used.
+	testutil.Assert(t, handlers[0].Converged(), "handler must be converged during the transition")
+	for _, h := range handlers {
+		h.mtx.Lock()
+		h.transitionEnd = time.Now().Add(-time.Second)
+		h.mtx.Unlock()
+	}
+	status, err = makeRequest(handlers[0], "test", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusInternalServerError, status)
+}
+
+func TestHandlerHashring_Joined(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+	}
+	handlers, hashring := newHandlerHashring(appendables, 1)
+	for _, h := range handlers {
+		h.options.HashringTransitionPeriod = time.Minute
+	}
+
+	// The handler is not in the hashring and joins it with the next change.
+	joining := handlers[1]
+	joining.Hashring(newMultiHashring([]HashringConfig{{Endpoints: []string{handlers[0].options.Endpoint}}}))
+	testutil.Assert(t, joining.Hashring(hashring), "handler must join the hashring")
+	testutil.Assert(t, !joining.Converged(), "joined handler must not be converged during the transition")
+
+	// Hashring changes keeping the handler a member do not affect it.
+	testutil.Assert(t, !handlers[0].Hashring(hashring), "member must not join the hashring")
+	testutil.Assert(t, handlers[0].Converged(), "member must be converged during the transition")
+
+	joining.mtx.Lock()
+	joining.joinedEnd = time.Now().Add(-time.Second)
+	joining.mtx.Unlock()
+	testutil.Assert(t, joining.Converged(), "joined handler must be converged after the transition")
+}
@@ -36,6 +36,8 @@ type Hashring interface {
 	Get(tenant string, timeSeries *prompb.TimeSeries) (string, error)
 	// GetN returns the nth node that should handle the given tenant and time series.
 	GetN(tenant string, timeSeries *prompb.TimeSeries, n uint64) (string, error)
+	// Nodes returns all nodes of the hashring.
+	Nodes() []string
 }
 
 // hash returns a hash for the given tenant and time series.
@@ -71,6 +73,11 @@ func (s SingleNodeHashring) GetN(_ string, _ *prompb.TimeSeries, n uint64) (stri
 	return string(s), nil
 }
 
+// Nodes implements the Hashring interface.
+func (s SingleNodeHashring) Nodes() []string {
+	return []string{string(s)}
+}
+
 // simpleHashring represents a group of nodes handling write requests.
 type simpleHashring []string
 
@@ -87,6 +94,11 @@ func (s simpleHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 	return s[(hash(tenant, ts)+n)%uint64(len(s))], nil
 }
 
+// Nodes returns all targets of the hashring.
+func (s simpleHashring) Nodes() []string {
+	return s
+}
+
 // multiHashring represents a set of hashrings.
 // Which hashring to use for a tenant is determined
 // by the tenants field of the hashring configuration.
@@ -135,6 +147,15 @@ func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 	return "", errors.New("no matching hashring to handle tenant")
 }
 
+// Nodes returns the targets of all hashrings.
+func (m *multiHashring) Nodes() []string {
+	var nodes []string
+	for _, h := range m.hashrings {
+		nodes = append(nodes, h.Nodes()...)
+	}
+	return nodes
+}
+
 // newMultiHashring creates a multi-tenant hashring for a given slice of
 // groups.
 // Which hashring to use for a tenant is determined
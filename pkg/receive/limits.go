@@ -0,0 +1,374 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	limitActiveSeries      = "active_series"
+	limitSamplesPerRequest = "samples_per_request"
+	limitRequestBodySize   = "request_body_size"
+	limitSamplesPerSecond  = "samples_per_second"
+	limitRequestsPerSecond = "requests_per_second"
+
+	// tenantRatesIdleTimeout is how long the rate limiters and limit metrics of a tenant are kept after its last
+	// request. Rate limiters of tenants sending again are created with a full burst.
+	tenantRatesIdleTimeout = time.Hour
+)
+
+var limitNames = []string{limitActiveSeries, limitSamplesPerRequest, limitRequestBodySize, limitSamplesPerSecond, limitRequestsPerSecond}
+
+// TenantLimits are the ingestion limits of a single tenant. Zero value means no limit.
+type TenantLimits struct {
+	// MaxActiveSeries is the maximum number of series of the tenant in the head block of a receiver. Once it is
+	// reached, samples of new series are rejected until series are truncated from the head block. Samples of
+	// existing series are still accepted.
+	MaxActiveSeries uint64 `yaml:"max_active_series"`
+	// MaxSamplesPerRequest is the maximum number of samples in a single remote write request.
+	MaxSamplesPerRequest int `yaml:"max_samples_per_request"`
+	// MaxRequestBodyBytes is the maximum size of the compressed body of a remote write request.
+	MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
+	// SamplesPerSecond is the maximum rate of samples accepted by a receiver.
+	SamplesPerSecond float64 `yaml:"samples_per_second"`
+	// SamplesBurst is the maximum number of samples accepted at once above the rate. It defaults to the rate, or to
+	// MaxSamplesPerRequest if that is bigger, so that every allowed request can be accepted. Requests with more
+	// samples than the burst are rejected, as they could never be accepted.
+	SamplesBurst int `yaml:"samples_burst"`
+	// RequestsPerSecond is the maximum rate of write requests accepted by a receiver. Unlike the other limits, it is
+	// enforced before the request body is read.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// RequestsBurst is the maximum number of requests accepted at once above the rate. It defaults to the rate,
+	// rounded up.
+	RequestsBurst int `yaml:"requests_burst"`
+}
+
+func (l TenantLimits) validate() error {
+	if l.MaxSamplesPerRequest < 0 {
+		return errors.New("max_samples_per_request cannot be negative")
+	}
+	if l.MaxRequestBodyBytes < 0 {
+		return errors.New("max_request_body_bytes cannot be negative")
+	}
+	if l.SamplesPerSecond < 0 {
+		return errors.New("samples_per_second cannot be negative")
+	}
+	if l.SamplesBurst < 0 {
+		return errors.New("samples_burst cannot be negative")
+	}
+	if l.RequestsPerSecond < 0 {
+		return errors.New("requests_per_second cannot be negative")
+	}
+	if l.RequestsBurst < 0 {
+		return errors.New("requests_burst cannot be negative")
+	}
+	if l.SamplesBurst > 0 && l.MaxSamplesPerRequest > l.SamplesBurst {
+		return errors.Errorf("samples_burst %d is smaller than max_samples_per_request %d, bigger requests could never be accepted", l.SamplesBurst, l.MaxSamplesPerRequest)
+	}
+	return nil
+}
+
+func (l TenantLimits) burst() int {
+	if l.SamplesBurst > 0 {
+		return l.SamplesBurst
+	}
+	b := int(math.Ceil(l.SamplesPerSecond))
+	if l.MaxSamplesPerRequest > b {
+		b = l.MaxSamplesPerRequest
+	}
+	return b
+}
+
+func (l TenantLimits) requestsBurst() int {
+	if l.RequestsBurst > 0 {
+		return l.RequestsBurst
+	}
+	return int(math.Ceil(l.RequestsPerSecond))
+}
+
+// LimitsConfig configures the ingestion limits of tenants.
+type LimitsConfig struct {
+	// Default limits applied to every tenant that does not have a dedicated entry in Tenants.
+	Default TenantLimits `yaml:"default"`
+	// Tenants contains limits per tenant. They replace the default limits as a whole.
+	Tenants map[string]TenantLimits `yaml:"tenants"`
+}
+
+// ParseLimitsConfig parses and validates the YAML limits configuration.
+func ParseLimitsConfig(content []byte) (*LimitsConfig, error) {
+	conf := &LimitsConfig{}
+	if err := yaml.UnmarshalStrict(content, conf); err != nil {
+		return nil, errors.Wrap(err, "parse limits configuration")
+	}
+	if err := conf.Default.validate(); err != nil {
+		return nil, errors.Wrap(err, "default")
+	}
+	for tenant, l := range conf.Tenants {
+		if err := l.validate(); err != nil {
+			return nil, errors.Wrapf(err, "tenant %s", tenant)
+		}
+	}
+	return conf, nil
+}
+
+func (c *LimitsConfig) limits(tenant string) TenantLimits {
+	if l, ok := c.Tenants[tenant]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// TenantStats returns statistics of the storage of a tenant.
+type TenantStats interface {
+	TenantActiveSeries(tenantID string) uint64
+	// TenantHasSeries returns true if the head block of the tenant has a series with exactly the given labels.
+	TenantHasSeries(tenantID string, lset labels.Labels) bool
+}
+
+// limitError is returned when a write request exceeds a limit of its tenant.
+type limitError struct {
+	limit string
+	msg   string
+	// partial is set if only some series of the request were rejected. The others are left in the request.
+	partial bool
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %s", e.limit, e.msg)
+}
+
+// statusCode returns the HTTP status code to respond with. Only rate limited requests can succeed if retried, so
+// other limits are answered with a non-retryable client error.
+func (e *limitError) statusCode() int {
+	switch e.limit {
+	case limitSamplesPerSecond, limitRequestsPerSecond:
+		return http.StatusTooManyRequests
+	case limitRequestBodySize:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func isLimitError(err error) bool {
+	_, ok := errors.Cause(err).(*limitError)
+	return ok
+}
+
+// limitStatusCode returns the HTTP status code to respond to a request rejected with the given limit error.
+func limitStatusCode(err error) int {
+	if e, ok := errors.Cause(err).(*limitError); ok {
+		return e.statusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// isPartialLimitError returns true if only some series of the request were rejected.
+func isPartialLimitError(err error) bool {
+	e, ok := errors.Cause(err).(*limitError)
+	return ok && e.partial
+}
+
+// Limiter enforces the ingestion limits of tenants on write requests received from clients.
+type Limiter struct {
+	conf  *LimitsConfig
+	stats TenantStats
+
+	mtx          sync.Mutex
+	rates        map[string]*tenantRates
+	lastEviction time.Time
+
+	limitedRequests *prometheus.CounterVec
+	tenantLimits    *prometheus.GaugeVec
+}
+
+// NewLimiter returns a Limiter enforcing the given limits. The number of active series is read from stats.
+func NewLimiter(reg prometheus.Registerer, conf *LimitsConfig, stats TenantStats) *Limiter {
+	return &Limiter{
+		conf:         conf,
+		stats:        stats,
+		rates:        map[string]*tenantRates{},
+		lastEviction: time.Now(),
+		limitedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_limited_requests_total",
+			Help: "The number of write requests rejected because of a tenant limit.",
+		}, []string{"tenant", "limit"}),
+		tenantLimits: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_limit",
+			Help: "The configured ingestion limits of tenants. Zero means no limit.",
+		}, []string{"tenant", "limit"}),
+	}
+}
+
+// MaxRequestBodyBytes returns the maximum size of a write request body of the given tenant or zero if unlimited.
+func (l *Limiter) MaxRequestBodyBytes(tenant string) int64 {
+	return l.conf.limits(tenant).MaxRequestBodyBytes
+}
+
+// RequestBodyTooLarge records a write request of the given tenant rejected because of its body size and returns the
+// error to respond with.
+func (l *Limiter) RequestBodyTooLarge(tenant string) error {
+	l.limitedRequests.WithLabelValues(tenant, limitRequestBodySize).Inc()
+	return &limitError{limit: limitRequestBodySize, msg: fmt.Sprintf("request body exceeds %d bytes", l.MaxRequestBodyBytes(tenant))}
+}
+
+// Check returns an error if the write request exceeds a limit of the tenant. Samples of accepted requests are
+// counted against the rate limit of the tenant. Once the tenant reaches its active series limit, series not present
+// in its head block yet are removed from the request and a partial limit error is returned if others are left.
+func (l *Limiter) Check(tenant string, wreq *prompb.WriteRequest) error {
+	limits := l.conf.limits(tenant)
+	rl := l.tenantRates(tenant, limits).samples
+
+	samples := countSamples(wreq)
+	if limits.MaxSamplesPerRequest > 0 && samples > limits.MaxSamplesPerRequest {
+		l.limitedRequests.WithLabelValues(tenant, limitSamplesPerRequest).Inc()
+		return &limitError{limit: limitSamplesPerRequest, msg: fmt.Sprintf("request has %d samples, limit is %d", samples, limits.MaxSamplesPerRequest)}
+	}
+	if rl != nil && samples > rl.Burst() {
+		l.limitedRequests.WithLabelValues(tenant, limitSamplesPerRequest).Inc()
+		return &limitError{limit: limitSamplesPerRequest, msg: fmt.Sprintf("request has %d samples, more than the burst of %d samples of the rate limit", samples, rl.Burst())}
+	}
+
+	var seriesErr *limitError
+	if limits.MaxActiveSeries > 0 && l.stats != nil {
+		if active := l.stats.TenantActiveSeries(tenant); active >= limits.MaxActiveSeries {
+			if rejected := l.rejectNewSeries(tenant, wreq); rejected > 0 {
+				l.limitedRequests.WithLabelValues(tenant, limitActiveSeries).Inc()
+				seriesErr = &limitError{
+					limit:   limitActiveSeries,
+					msg:     fmt.Sprintf("tenant has %d active series, limit is %d, rejected samples of %d new series", active, limits.MaxActiveSeries, rejected),
+					partial: len(wreq.Timeseries) > 0,
+				}
+				if !seriesErr.partial {
+					return seriesErr
+				}
+				samples = countSamples(wreq)
+			}
+		}
+	}
+	if rl != nil && !rl.AllowN(time.Now(), samples) {
+		l.limitedRequests.WithLabelValues(tenant, limitSamplesPerSecond).Inc()
+		return &limitError{limit: limitSamplesPerSecond, msg: fmt.Sprintf("rate limit of %v samples per second reached", limits.SamplesPerSecond)}
+	}
+	if seriesErr != nil {
+		return seriesErr
+	}
+	return nil
+}
+
+// rejectNewSeries removes series not present in the head block of the tenant from the request and returns their
+// number.
+func (l *Limiter) rejectNewSeries(tenant string, wreq *prompb.WriteRequest) int {
+	kept := wreq.Timeseries[:0]
+	for _, ts := range wreq.Timeseries {
+		lset := make(labels.Labels, 0, len(ts.Labels))
+		for _, l := range ts.Labels {
+			lset = append(lset, labels.Label{Name: l.Name, Value: l.Value})
+		}
+		sort.Sort(lset)
+		if l.stats.TenantHasSeries(tenant, lset) {
+			kept = append(kept, ts)
+		}
+	}
+	rejected := len(wreq.Timeseries) - len(kept)
+	wreq.Timeseries = kept
+	return rejected
+}
+
+func countSamples(wreq *prompb.WriteRequest) int {
+	samples := 0
+	for _, ts := range wreq.Timeseries {
+		samples += len(ts.Samples)
+	}
+	return samples
+}
+
+// AllowRequest returns an error and how long to wait before retrying if a write request of the tenant exceeds its
+// request rate limit.
+func (l *Limiter) AllowRequest(tenant string) (time.Duration, error) {
+	limits := l.conf.limits(tenant)
+	rl := l.tenantRates(tenant, limits).requests
+	if rl == nil {
+		return 0, nil
+	}
+
+	r := rl.Reserve()
+	if d := r.Delay(); d > 0 {
+		r.Cancel()
+		l.limitedRequests.WithLabelValues(tenant, limitRequestsPerSecond).Inc()
+		return d, &limitError{limit: limitRequestsPerSecond, msg: fmt.Sprintf("rate limit of %v requests per second reached", limits.RequestsPerSecond)}
+	}
+	return 0, nil
+}
+
+// tenantRates holds the rate limiters of a tenant. They are nil if the rate is not limited.
+type tenantRates struct {
+	samples  *rate.Limiter
+	requests *rate.Limiter
+	lastSeen time.Time
+}
+
+// tenantRates returns the rate limiters of the tenant. Limit metrics of the tenant are initialized on its first
+// request. Rate limiters and metrics of tenants idle for tenantRatesIdleTimeout are removed.
+func (l *Limiter) tenantRates(tenant string, limits TenantLimits) *tenantRates {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastEviction) >= tenantRatesIdleTimeout {
+		l.evictIdle(now)
+	}
+
+	r, ok := l.rates[tenant]
+	if ok {
+		r.lastSeen = now
+		return r
+	}
+	r = &tenantRates{lastSeen: now}
+	if limits.SamplesPerSecond > 0 {
+		r.samples = rate.NewLimiter(rate.Limit(limits.SamplesPerSecond), limits.burst())
+	}
+	if limits.RequestsPerSecond > 0 {
+		r.requests = rate.NewLimiter(rate.Limit(limits.RequestsPerSecond), limits.requestsBurst())
+	}
+	l.rates[tenant] = r
+
+	l.tenantLimits.WithLabelValues(tenant, limitActiveSeries).Set(float64(limits.MaxActiveSeries))
+	l.tenantLimits.WithLabelValues(tenant, limitSamplesPerRequest).Set(float64(limits.MaxSamplesPerRequest))
+	l.tenantLimits.WithLabelValues(tenant, limitRequestBodySize).Set(float64(limits.MaxRequestBodyBytes))
+	l.tenantLimits.WithLabelValues(tenant, limitSamplesPerSecond).Set(limits.SamplesPerSecond)
+	l.tenantLimits.WithLabelValues(tenant, limitRequestsPerSecond).Set(limits.RequestsPerSecond)
+	return r
+}
+
+// evictIdle removes rate limiters and limit metrics of tenants without requests for tenantRatesIdleTimeout. It must be
+// called with the lock held.
+func (l *Limiter) evictIdle(now time.Time) {
+	l.lastEviction = now
+	for tenant, r := range l.rates {
+		if now.Sub(r.lastSeen) < tenantRatesIdleTimeout {
+			continue
+		}
+		delete(l.rates, tenant)
+		for _, limit := range limitNames {
+			l.tenantLimits.DeleteLabelValues(tenant, limit)
+			l.limitedRequests.DeleteLabelValues(tenant, limit)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type fakeTenantStats struct {
+	active map[string]uint64
+	series map[string][]labels.Labels
+}
+
+func (f fakeTenantStats) TenantActiveSeries(tenantID string) uint64 {
+	return f.active[tenantID]
+}
+
+func (f fakeTenantStats) TenantHasSeries(tenantID string, lset labels.Labels) bool {
+	for _, s := range f.series[tenantID] {
+		if labels.Equal(s, lset) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseLimitsConfig(t *testing.T) {
+	conf, err := ParseLimitsConfig([]byte(`
+default:
+  max_samples_per_request: 100
+tenants:
+  foo:
+    max_active_series: 10
+    samples_per_second: 0.5
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, TenantLimits{MaxSamplesPerRequest: 100}, conf.limits("bar"))
+	testutil.Equals(t, TenantLimits{MaxActiveSeries: 10, SamplesPerSecond: 0.5}, conf.limits("foo"))
+	testutil.Equals(t, 1, conf.limits("foo").burst())
+
+	_, err = ParseLimitsConfig([]byte(`default: {max_samples_per_request: -1}`))
+	testutil.NotOk(t, err)
+	_, err = ParseLimitsConfig([]byte(`default: {unknown: 1}`))
+	testutil.NotOk(t, err)
+	_, err = ParseLimitsConfig([]byte(`default: {max_samples_per_request: 10, samples_per_second: 1, samples_burst: 5}`))
+	testutil.NotOk(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	series := func(value string, samples int) prompb.TimeSeries {
+		ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "foo", Value: value}}}
+		for i := 0; i < samples; i++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i)})
+		}
+		return ts
+	}
+	wreq := func(samples int) *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("bar", samples)}}
+	}
+
+	l := NewLimiter(nil, &LimitsConfig{
+		Default: TenantLimits{MaxSamplesPerRequest: 10},
+		Tenants: map[string]TenantLimits{
+			"full":   {MaxActiveSeries: 5},
+			"rated":  {SamplesPerSecond: 0.001, SamplesBurst: 15},
+			"bursty": {SamplesPerSecond: 1000, SamplesBurst: 5},
+		},
+	}, fakeTenantStats{
+		active: map[string]uint64{"full": 5},
+		series: map[string][]labels.Labels{"full": {labels.FromStrings("foo", "bar")}},
+	})
+
+	testutil.Ok(t, l.Check("default", wreq(10)))
+	err := l.Check("default", wreq(11))
+	testutil.Assert(t, isLimitError(err), "expected limit error, got %v", err)
+	testutil.Equals(t, http.StatusBadRequest, limitStatusCode(err))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.limitedRequests.WithLabelValues("default", limitSamplesPerRequest)))
+
+	// Tenant limits replace the default ones.
+	testutil.Ok(t, l.Check("rated", wreq(11)))
+	err = l.Check("rated", wreq(5))
+	testutil.Assert(t, isLimitError(err), "expected limit error, got %v", err)
+	testutil.Equals(t, http.StatusTooManyRequests, limitStatusCode(err))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(l.limitedRequests.WithLabelValues("rated", limitSamplesPerSecond)))
+	testutil.Equals(t, 0.001, promtestutil.ToFloat64(l.tenantLimits.WithLabelValues("rated", limitSamplesPerSecond)))
+
+	// Requests bigger than the burst could never be accepted, so they are not rate limited, but rejected.
+	testutil.Ok(t, l.Check("bursty", wreq(5)))
+	err = l.Check("bursty", wreq(6))
+	testutil.Assert(t, isLimitError(err), "expected limit error, got %v", err)
+	testutil.Equals(t, http.StatusBadRequest, limitStatusCode(err))
+
+	t.Run("active series", func(t *testing.T) {
+		// Samples of existing series are accepted at the limit.
+		req := wreq(1)
+		testutil.Ok(t, l.Check("full", req))
+		testutil.Equals(t, 1, len(req.Timeseries))
+
+		// Only samples of new series are rejected.
+		req = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("bar", 1), series("new", 1)}}
+		err := l.Check("full", req)
+		testutil.Assert(t, isPartialLimitError(err), "expected partial limit error, got %v", err)
+		testutil.Equals(t, http.StatusBadRequest, limitStatusCode(err))
+		testutil.Equals(t, []prompb.TimeSeries{series("bar", 1)}, req.Timeseries)
+
+		req = &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("new", 1)}}
+		err = l.Check("full", req)
+		testutil.Assert(t, isLimitError(err) && !isPartialLimitError(err), "expected limit error, got %v", err)
+		testutil.Equals(t, 2.0, promtestutil.ToFloat64(l.limitedRequests.WithLabelValues("full", limitActiveSeries)))
+	})
+
+	t.Run("idle tenants", func(t *testing.T) {
+		l.mtx.Lock()
+		l.lastEviction = time.Now().Add(-2 * tenantRatesIdleTimeout)
+		l.rates["rated"].lastSeen = time.Now().Add(-2 * tenantRatesIdleTimeout)
+		l.mtx.Unlock()
+
+		testutil.Ok(t, l.Check("default", wreq(1)))
+		_, ok := l.rates["rated"]
+		testutil.Assert(t, !ok, "expected rate limiters of idle tenant to be removed")
+		_, ok = l.rates["default"]
+		testutil.Assert(t, ok, "expected rate limiters of active tenant to be kept")
+		testutil.Equals(t, 0.0, promtestutil.ToFloat64(l.limitedRequests.WithLabelValues("rated", limitSamplesPerSecond)))
+
+		// The burst of idle tenants is available again.
+		testutil.Ok(t, l.Check("rated", wreq(5)))
+	})
+}
+
+func TestReceiveLimits(t *testing.T) {
+	appendable := &fakeAppendable{appender: newFakeAppender(nil, nil, nil, nil)}
+	handlers, _ := newHandlerHashring([]*fakeAppendable{appendable}, 1)
+	h := handlers[0]
+	h.options.Limiter = NewLimiter(nil, &LimitsConfig{
+		Default: TenantLimits{MaxSamplesPerRequest: 1},
+		Tenants: map[string]TenantLimits{
+			"small": {MaxRequestBodyBytes: 1},
+		},
+	}, nil)
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "foo", Value: "bar"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}}
+
+	status, err := makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, status)
+
+	status, err = makeRequest(h, "small", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusRequestEntityTooLarge, status)
+
+	wreq.Timeseries[0].Samples = append(wreq.Timeseries[0].Samples, prompb.Sample{Value: 2, Timestamp: 2})
+	status, err = makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusBadRequest, status)
+}
+
+func TestReceiveLimits_ActiveSeries(t *testing.T) {
+	appender := newFakeAppender(nil, nil, nil, nil)
+	handlers, _ := newHandlerHashring([]*fakeAppendable{{appender: appender}}, 1)
+	h := handlers[0]
+	h.options.Limiter = NewLimiter(nil, &LimitsConfig{
+		Default: TenantLimits{MaxActiveSeries: 1},
+	}, fakeTenantStats{
+		active: map[string]uint64{"foo": 1},
+		series: map[string][]labels.Labels{"foo": {labels.FromStrings("foo", "bar")}},
+	})
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{Labels: []prompb.Label{{Name: "foo", Value: "bar"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1}}},
+		{Labels: []prompb.Label{{Name: "foo", Value: "new"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1}}},
+	}}
+
+	// Samples of the existing series are written, but the request is rejected, so that the client does not retry.
+	status, err := makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusBadRequest, status)
+	testutil.Equals(t, 1, len(appender.samples))
+	testutil.Equals(t, 1, len(appender.samples[labels.FromStrings("foo", "bar").String()]))
+}
@@ -0,0 +1,715 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	terrors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/exemplars"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/shipper"
+	"github.com/thanos-io/thanos/pkg/store"
+)
+
+// TenantStorage returns the storage written to for a tenant.
+type TenantStorage interface {
+	TenantAppendable(tenantID string) (Appendable, error)
+}
+
+// TenantQueryable returns the storage read from for a tenant.
+type TenantQueryable interface {
+	TenantQueryable(tenantID string) (storage.Queryable, error)
+}
+
+// TenantOutOfOrderStorage returns the storage of samples rejected by the TSDB head of a tenant.
+type TenantOutOfOrderStorage interface {
+	// TenantOutOfOrderAppender returns nil if out-of-order samples of the tenant are not accepted.
+	TenantOutOfOrderAppender(tenantID string) (OutOfOrderAppender, error)
+}
+
+// TenantExemplarStorage returns the exemplar storage written to for a tenant.
+type TenantExemplarStorage interface {
+	// TenantExemplarAppender returns nil if exemplars of the tenant are not stored.
+	TenantExemplarAppender(tenantID string) (ExemplarAppender, error)
+}
+
+// MultiTSDB manages one TSDB per tenant, each in its own sub-directory of the data directory. The TSDB of a tenant is
+// created on its first write. Blocks of a tenant are shipped and served with the external labels extended by the
+// tenant label.
+type MultiTSDB struct {
+	dataDir         string
+	logger          log.Logger
+	reg             prometheus.Registerer
+	tsdbOpts        *tsdb.Options
+	tenantsConf     *TenantsConfig
+	maxExemplars    int64
+	outOfOrder      time.Duration
+	labels          labels.Labels
+	tenantLabelName string
+	bucket          objstore.Bucket
+	uploadOpts      shipper.UploadOptions
+
+	mtx     sync.RWMutex
+	tenants map[string]*tenant
+	// pruning holds tenants detached by PruneIdle, by tenant. The channel is closed once the tenant is pruned, or
+	// attached again if pruning failed.
+	pruning map[string]chan struct{}
+}
+
+type tenant struct {
+	storage   *FlushableStorage
+	readyS    *tsdb.ReadyStorage
+	storeTSDB *store.TSDBStore
+	ship      *shipper.Shipper
+	labels    labels.Labels
+	dir       string
+	// reg is nil if metrics are not registered. Metrics of the tenant are unregistered once it is pruned.
+	reg *trackingRegisterer
+	// exemplars is nil if exemplars are not stored. Exemplars are kept in memory only, across flushes of the TSDB.
+	exemplars     *exemplarStorage
+	exemplarsTSDB *exemplars.TSDB
+	// outOfOrder is nil if out-of-order samples are not accepted.
+	outOfOrder *outOfOrderBuffer
+	// lastWrite is the Unix time in nanoseconds of the last time the storage of the tenant was requested for writing.
+	lastWrite int64
+
+	// mtx is held for reading by appenders of the tenant until they are committed or rolled back, and for writing
+	// while the tenant is detached for pruning.
+	mtx sync.RWMutex
+	// pruned is set once the tenant is detached by PruneIdle, so that appenders obtained before fail.
+	pruned bool
+}
+
+// NewMultiTSDB returns a new MultiTSDB storing TSDBs in the given data directory. TSDBs are opened with the given
+// options, overridden by the tenants configuration, if it is not nil. Up to maxExemplars most recent exemplars are
+// kept per tenant, none if it is not positive. Samples out of order or too old for the TSDB head, but within the
+// outOfOrder window before the newest sample of a tenant, are written to separate blocks, if the window is positive.
+// Blocks are uploaded to the given bucket by Sync, if it is not nil.
+func NewMultiTSDB(
+	dataDir string,
+	logger log.Logger,
+	reg prometheus.Registerer,
+	tsdbOpts *tsdb.Options,
+	tenantsConf *TenantsConfig,
+	maxExemplars int64,
+	outOfOrder time.Duration,
+	labels labels.Labels,
+	tenantLabelName string,
+	bucket objstore.Bucket,
+	uploadOpts shipper.UploadOptions,
+) *MultiTSDB {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &MultiTSDB{
+		dataDir:         dataDir,
+		logger:          logger,
+		reg:             reg,
+		tsdbOpts:        tsdbOpts,
+		tenantsConf:     tenantsConf,
+		maxExemplars:    maxExemplars,
+		outOfOrder:      outOfOrder,
+		labels:          labels,
+		tenantLabelName: tenantLabelName,
+		bucket:          bucket,
+		uploadOpts:      uploadOpts,
+		tenants:         map[string]*tenant{},
+		pruning:         map[string]chan struct{}{},
+	}
+}
+
+// Open opens the TSDBs of all tenants found in the data directory.
+func (t *MultiTSDB) Open() error {
+	if err := os.MkdirAll(t.dataDir, 0777); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(t.dataDir)
+	if err != nil {
+		return err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var errs terrors.MultiError
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		if _, err := t.openTenant(fi.Name()); err != nil {
+			errs.Add(errors.Wrapf(err, "open tenant %s", fi.Name()))
+		}
+	}
+	return errs.Err()
+}
+
+// Flush flushes the WALs of all tenants to blocks. It leaves their TSDBs closed until the next Open.
+func (t *MultiTSDB) Flush() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var errs terrors.MultiError
+	for id, tenant := range t.tenants {
+		tenant.storeTSDB = nil
+		if err := tenant.storage.Flush(); err != nil {
+			errs.Add(errors.Wrapf(err, "flush tenant %s", id))
+			continue
+		}
+		// Blocks of out-of-order samples are moved into the TSDB when it is opened again.
+		if err := t.flushOutOfOrder(context.Background(), id, tenant, math.MaxInt64); err != nil {
+			errs.Add(errors.Wrapf(err, "flush out-of-order samples of tenant %s", id))
+		}
+	}
+	return errs.Err()
+}
+
+// Close closes the TSDBs of all tenants.
+func (t *MultiTSDB) Close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var errs terrors.MultiError
+	for id, tenant := range t.tenants {
+		tenant.storeTSDB = nil
+		if err := tenant.storage.Close(); err != nil {
+			errs.Add(errors.Wrapf(err, "close tenant %s", id))
+			continue
+		}
+		// Blocks of out-of-order samples are moved into the TSDB when it is opened again.
+		if err := t.flushOutOfOrder(context.Background(), id, tenant, math.MaxInt64); err != nil {
+			errs.Add(errors.Wrapf(err, "flush out-of-order samples of tenant %s", id))
+			continue
+		}
+		if tenant.outOfOrder != nil {
+			if err := tenant.outOfOrder.Close(); err != nil {
+				errs.Add(errors.Wrapf(err, "close out-of-order storage of tenant %s", id))
+			}
+			tenant.outOfOrder = nil
+		}
+	}
+	return errs.Err()
+}
+
+// Sync uploads new blocks of all tenants to the bucket.
+func (t *MultiTSDB) Sync(ctx context.Context) error {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	var errs terrors.MultiError
+	for id, tenant := range t.tenants {
+		if tenant.ship == nil {
+			continue
+		}
+		if uploaded, err := tenant.ship.Sync(ctx); err != nil {
+			errs.Add(errors.Wrapf(err, "upload blocks of tenant %s, uploaded %d", id, uploaded))
+		}
+	}
+	return errs.Err()
+}
+
+// PruneIdle flushes, uploads and closes the TSDBs of tenants not written to within the given duration and deletes
+// their local data. Tenants are pruned only if blocks are uploaded to a bucket, as their data would be lost otherwise.
+// A pruned tenant is created again on its next write. Idle tenants are detached with the lock held and pruned without
+// it, so that other tenants are served meanwhile.
+func (t *MultiTSDB) PruneIdle(ctx context.Context, maxIdle time.Duration) error {
+	if t.bucket == nil {
+		return nil
+	}
+
+	detached := t.detachIdle(maxIdle)
+
+	var errs terrors.MultiError
+	for id, tenant := range detached {
+		if err := t.pruneTenant(ctx, id, tenant); err != nil {
+			errs.Add(err)
+		}
+	}
+	return errs.Err()
+}
+
+// detachIdle removes tenants not written to within the given duration from the served ones, once their appenders are
+// done. Detached tenants are not created again until they are pruned.
+func (t *MultiTSDB) detachIdle(maxIdle time.Duration) map[string]*tenant {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	detached := map[string]*tenant{}
+	for id, tenant := range t.tenants {
+		if time.Since(time.Unix(0, atomic.LoadInt64(&tenant.lastWrite))) < maxIdle {
+			continue
+		}
+		// No appenders are obtained while the lock is held, so waiting for pending ones is enough.
+		tenant.mtx.Lock()
+		tenant.pruned = true
+		tenant.mtx.Unlock()
+
+		tenant.storeTSDB = nil
+		delete(t.tenants, id)
+		t.pruning[id] = make(chan struct{})
+		detached[id] = tenant
+	}
+	return detached
+}
+
+// pruneTenant prunes the given detached tenant. If pruning fails, the tenant is attached again without being served,
+// so that pruning is retried.
+func (t *MultiTSDB) pruneTenant(ctx context.Context, id string, tenant *tenant) (err error) {
+	defer func() {
+		t.mtx.Lock()
+		defer t.mtx.Unlock()
+		if err != nil {
+			t.tenants[id] = tenant
+		}
+		close(t.pruning[id])
+		delete(t.pruning, id)
+	}()
+
+	level.Info(t.logger).Log("msg", "pruning idle tenant", "tenant", id)
+
+	if err := tenant.storage.Flush(); err != nil {
+		return errors.Wrapf(err, "flush idle tenant %s", id)
+	}
+	if err := t.flushOutOfOrder(ctx, id, tenant, math.MaxInt64); err != nil {
+		return errors.Wrapf(err, "flush out-of-order samples of idle tenant %s", id)
+	}
+	if err := t.addOutOfOrderBlocks(ctx, tenant, false); err != nil {
+		return errors.Wrapf(err, "add out-of-order blocks of idle tenant %s", id)
+	}
+	if _, err := tenant.ship.Sync(ctx); err != nil {
+		return errors.Wrapf(err, "upload blocks of idle tenant %s", id)
+	}
+	if err := tenant.storage.Close(); err != nil {
+		return errors.Wrapf(err, "close idle tenant %s", id)
+	}
+	if tenant.outOfOrder != nil {
+		if err := tenant.outOfOrder.Close(); err != nil {
+			return errors.Wrapf(err, "close out-of-order storage of idle tenant %s", id)
+		}
+		// The buffer is created again if the tenant is served again. It is read with the lock held, see
+		// TenantOutOfOrderAppender.
+		t.mtx.Lock()
+		tenant.outOfOrder = nil
+		t.mtx.Unlock()
+	}
+	if err := os.RemoveAll(tenant.dir); err != nil {
+		return errors.Wrapf(err, "delete data of idle tenant %s", id)
+	}
+	if tenant.reg != nil {
+		tenant.reg.UnregisterAll()
+	}
+	return nil
+}
+
+// FlushOutOfOrder writes buffered out-of-order samples of all tenants older than their TSDB head to blocks and adds
+// them to the TSDBs. Samples within the time range of the head are kept until it is cut into a block.
+func (t *MultiTSDB) FlushOutOfOrder(ctx context.Context) error {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	var errs terrors.MultiError
+	for id, tenant := range t.tenants {
+		if tenant.outOfOrder == nil || tenant.storeTSDB == nil {
+			continue
+		}
+
+		// The TSDB compacts overlapping blocks right away, and compacted blocks are not uploaded. Hence all blocks cut
+		// from the head so far are uploaded first, and out-of-order blocks overlapping only them are uploaded before
+		// they are added to the TSDB.
+		maxt := tenant.storage.Get().Head().MinTime()
+		if tenant.ship != nil {
+			if _, err := tenant.ship.Sync(ctx); err != nil {
+				errs.Add(errors.Wrapf(err, "upload blocks of tenant %s", id))
+				continue
+			}
+		}
+		if err := t.flushOutOfOrder(ctx, id, tenant, maxt); err != nil {
+			errs.Add(errors.Wrapf(err, "flush out-of-order samples of tenant %s", id))
+		}
+		if err := t.addOutOfOrderBlocks(ctx, tenant, t.bucket != nil); err != nil {
+			errs.Add(errors.Wrapf(err, "add out-of-order blocks of tenant %s", id))
+		}
+	}
+	return errs.Err()
+}
+
+// flushOutOfOrder writes buffered out-of-order samples of the tenant older than maxt to blocks in its out-of-order
+// staging directory, which addOutOfOrderBlocks moves them from into the TSDB. The samples are dropped from the WAL
+// once the blocks are written.
+func (t *MultiTSDB) flushOutOfOrder(ctx context.Context, tenantID string, tenant *tenant, maxt int64) error {
+	if tenant.outOfOrder == nil {
+		return nil
+	}
+	series := tenant.outOfOrder.cut(maxt)
+	if len(series) == 0 {
+		return nil
+	}
+
+	stagingDir := filepath.Join(tenant.dir, outOfOrderStagingDir)
+	opts := t.tenantsConf.TSDBOptions(tenantID, t.tsdbOpts)
+	blockDuration := int64(time.Duration(opts.MinBlockDuration) / time.Millisecond)
+	ids, err := writeOutOfOrderBlocks(ctx, log.With(t.logger, "tenant", tenantID), stagingDir, series, blockDuration, tenant.labels)
+	if err != nil {
+		// The samples are kept for the next flush, so blocks written already are removed.
+		for _, id := range ids {
+			if rerr := os.RemoveAll(filepath.Join(stagingDir, id.String())); rerr != nil {
+				level.Warn(t.logger).Log("msg", "failed to remove out-of-order block", "tenant", tenantID, "block", id, "err", rerr)
+			}
+		}
+		tenant.outOfOrder.restore(series)
+		return err
+	}
+	level.Info(t.logger).Log("msg", "wrote out-of-order samples to blocks", "tenant", tenantID, "series", len(series), "blocks", len(ids))
+	if err := tenant.outOfOrder.checkpoint(); err != nil {
+		return errors.Wrap(err, "checkpoint out-of-order WAL")
+	}
+	return nil
+}
+
+// addOutOfOrderBlocks moves complete blocks from the out-of-order staging directory of the tenant to its TSDB, uploading
+// them first if requested. Blocks are moved by renaming, so the TSDB never sees partially written blocks. Blocks failing
+// to upload are kept in the staging directory.
+func (t *MultiTSDB) addOutOfOrderBlocks(ctx context.Context, tenant *tenant, upload bool) error {
+	stagingDir := filepath.Join(tenant.dir, outOfOrderStagingDir)
+	fis, err := ioutil.ReadDir(stagingDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs terrors.MultiError
+	for _, fi := range fis {
+		if _, err := ulid.Parse(fi.Name()); err != nil || !fi.IsDir() {
+			continue
+		}
+		bdir := filepath.Join(stagingDir, fi.Name())
+		if upload {
+			if err := block.Upload(ctx, t.logger, t.bucket, bdir); err != nil {
+				errs.Add(errors.Wrapf(err, "upload block %s", fi.Name()))
+				continue
+			}
+		}
+		if err := os.Rename(bdir, filepath.Join(tenant.dir, fi.Name())); err != nil {
+			errs.Add(errors.Wrapf(err, "move block %s", fi.Name()))
+		}
+	}
+	return errs.Err()
+}
+
+// TSDBStores returns the Store API servers of the TSDBs of all open tenants, by tenant.
+func (t *MultiTSDB) TSDBStores() map[string]*store.TSDBStore {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	res := make(map[string]*store.TSDBStore, len(t.tenants))
+	for id, tenant := range t.tenants {
+		if tenant.storeTSDB == nil {
+			continue
+		}
+		res[id] = tenant.storeTSDB
+	}
+	return res
+}
+
+// ExemplarsTSDBs returns the Exemplars API servers of all tenants storing exemplars, by tenant.
+func (t *MultiTSDB) ExemplarsTSDBs() map[string]*exemplars.TSDB {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	res := make(map[string]*exemplars.TSDB, len(t.tenants))
+	for id, tenant := range t.tenants {
+		if tenant.exemplarsTSDB == nil {
+			continue
+		}
+		res[id] = tenant.exemplarsTSDB
+	}
+	return res
+}
+
+// TenantExemplarAppender returns the exemplar storage of the given tenant, creating its TSDB if it does not exist
+// yet. It returns nil if exemplars are not stored.
+func (t *MultiTSDB) TenantExemplarAppender(tenantID string) (ExemplarAppender, error) {
+	tenant, err := t.getOrCreateTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.exemplars == nil {
+		return nil, nil
+	}
+	return tenant.exemplars, nil
+}
+
+// TenantOutOfOrderAppender returns the out-of-order storage of the given tenant, creating its TSDB if it does not
+// exist yet. It returns nil if out-of-order samples are not accepted.
+func (t *MultiTSDB) TenantOutOfOrderAppender(tenantID string) (OutOfOrderAppender, error) {
+	tenant, err := t.getOrCreateTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The buffer is replaced when the tenant is closed or pruned.
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	if tenant.outOfOrder == nil {
+		return nil, nil
+	}
+	return tenant.outOfOrder, nil
+}
+
+// TenantAppendable returns the storage of the given tenant, creating its TSDB if it does not exist yet. The tenant is
+// not pruned while appenders of the storage are neither committed nor rolled back.
+func (t *MultiTSDB) TenantAppendable(tenantID string) (Appendable, error) {
+	tenant, err := t.getOrCreateTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantAppendable{tenant: tenant}, nil
+}
+
+// tenantAppendable returns appenders holding the lock of a tenant until they are committed or rolled back.
+type tenantAppendable struct {
+	tenant *tenant
+}
+
+func (a *tenantAppendable) Appender() (storage.Appender, error) {
+	a.tenant.mtx.RLock()
+	if a.tenant.pruned {
+		a.tenant.mtx.RUnlock()
+		return nil, errors.New("tenant was pruned")
+	}
+	app, err := a.tenant.readyS.Appender()
+	if err != nil {
+		a.tenant.mtx.RUnlock()
+		return nil, err
+	}
+	return &tenantAppender{Appender: app, unlock: a.tenant.mtx.RUnlock}, nil
+}
+
+type tenantAppender struct {
+	storage.Appender
+
+	once   sync.Once
+	unlock func()
+}
+
+func (a *tenantAppender) Commit() error {
+	defer a.once.Do(a.unlock)
+	return a.Appender.Commit()
+}
+
+func (a *tenantAppender) Rollback() error {
+	defer a.once.Do(a.unlock)
+	return a.Appender.Rollback()
+}
+
+// TenantQueryable returns the storage of the given tenant. Tenants without TSDB have no data.
+func (t *MultiTSDB) TenantQueryable(tenantID string) (storage.Queryable, error) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	tenant, ok := t.tenants[tenantID]
+	if !ok || tenant.storeTSDB == nil {
+		return noopQueryable{}, nil
+	}
+	return tenant.readyS, nil
+}
+
+// TenantActiveSeries returns the number of series in the head block of the given tenant.
+func (t *MultiTSDB) TenantActiveSeries(tenantID string) uint64 {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	tenant, ok := t.tenants[tenantID]
+	if !ok || tenant.storeTSDB == nil {
+		return 0
+	}
+	return tenant.storage.Get().Head().NumSeries()
+}
+
+// TenantHasSeries returns true if the head block of the given tenant has a series with exactly the given sorted labels.
+func (t *MultiTSDB) TenantHasSeries(tenantID string, lset labels.Labels) bool {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	tenant, ok := t.tenants[tenantID]
+	if !ok || tenant.storeTSDB == nil || len(lset) == 0 {
+		return false
+	}
+	ir, err := tenant.storage.Get().Head().Index()
+	if err != nil {
+		level.Warn(t.logger).Log("msg", "failed to get head index", "tenant", tenantID, "err", err)
+		return false
+	}
+	defer runutil.CloseWithLogOnErr(t.logger, ir, "head index reader")
+
+	ps := make([]index.Postings, 0, len(lset))
+	for _, l := range lset {
+		p, err := ir.Postings(l.Name, l.Value)
+		if err != nil {
+			level.Warn(t.logger).Log("msg", "failed to get head postings", "tenant", tenantID, "err", err)
+			return false
+		}
+		ps = append(ps, p)
+	}
+
+	var (
+		p    = index.Intersect(ps...)
+		s    labels.Labels
+		chks []chunks.Meta
+	)
+	// Postings of all labels may also match series with additional labels.
+	for p.Next() {
+		if err := ir.Series(p.At(), &s, &chks); err != nil {
+			return false
+		}
+		if labels.Equal(s, lset) {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrCreateTenant returns the given tenant, opening its TSDB if needed, and records it as written to. The write is
+// recorded with the lock held, so that PruneIdle does not prune tenants returned before it started.
+func (t *MultiTSDB) getOrCreateTenant(tenantID string) (*tenant, error) {
+	t.mtx.RLock()
+	tenant, ok := t.tenants[tenantID]
+	if ok && tenant.storeTSDB != nil {
+		atomic.StoreInt64(&tenant.lastWrite, time.Now().UnixNano())
+		t.mtx.RUnlock()
+		return tenant, nil
+	}
+	t.mtx.RUnlock()
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	// A tenant being pruned is created again once its data is deleted.
+	for {
+		done, ok := t.pruning[tenantID]
+		if !ok {
+			break
+		}
+		t.mtx.Unlock()
+		<-done
+		t.mtx.Lock()
+	}
+	tenant, err := t.openTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&tenant.lastWrite, time.Now().UnixNano())
+	return tenant, nil
+}
+
+// openTenant opens the TSDB of the given tenant, creating it if needed. It must be called with the lock held.
+func (t *MultiTSDB) openTenant(tenantID string) (*tenant, error) {
+	if tenantID == "" || tenantID == "." || tenantID == ".." || strings.ContainsAny(tenantID, `/\`) {
+		return nil, errors.Errorf("invalid tenant ID %q", tenantID)
+	}
+
+	opts := t.tenantsConf.TSDBOptions(tenantID, t.tsdbOpts)
+	tn, ok := t.tenants[tenantID]
+	if !ok {
+		var (
+			reg      prometheus.Registerer
+			trackReg *trackingRegisterer
+		)
+		if t.reg != nil {
+			trackReg = newTrackingRegisterer(prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenantID}, t.reg))
+			reg = trackReg
+		}
+		dir := filepath.Join(t.dataDir, tenantID)
+		lset := labels.NewBuilder(t.labels).Set(t.tenantLabelName, tenantID).Labels()
+
+		tn = &tenant{
+			reg:     trackReg,
+			storage: NewFlushableStorage(dir, log.With(t.logger, "tenant", tenantID), reg, opts),
+			readyS:  &tsdb.ReadyStorage{},
+			labels:  lset,
+			dir:     dir,
+		}
+		if t.maxExemplars > 0 {
+			tn.exemplars = newExemplarStorage(t.maxExemplars)
+			tn.exemplarsTSDB = exemplars.NewTSDB(tn.exemplars, lset)
+		}
+		if t.bucket != nil {
+			// Pruned tenants are created again, so shipper metrics of the tenant may already be registered.
+			var shipReg prometheus.Registerer
+			if reg != nil {
+				shipReg = &UnRegisterer{reg}
+			}
+			s, err := shipper.NewWithOptions(log.With(t.logger, "tenant", tenantID), shipReg, dir, t.bucket, func() labels.Labels { return lset }, metadata.ReceiveSource, false, t.uploadOpts)
+			if err != nil {
+				return nil, errors.Wrap(err, "create shipper")
+			}
+			tn.ship = s
+		}
+		t.tenants[tenantID] = tn
+	} else if tn.storeTSDB != nil {
+		return tn, nil
+	}
+
+	if t.outOfOrder > 0 && tn.outOfOrder == nil {
+		fs := tn.storage
+		b, err := newOutOfOrderBuffer(log.With(t.logger, "tenant", tenantID), filepath.Join(tn.dir, outOfOrderStagingDir, outOfOrderWALDir), int64(t.outOfOrder/time.Millisecond), func() int64 {
+			return fs.Get().Head().MaxTime()
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "create out-of-order storage")
+		}
+		tn.outOfOrder = b
+	}
+
+	// Out-of-order blocks not added to the TSDB before, e.g. because their upload failed, are added before it is
+	// opened. The shipper uploads them.
+	if err := t.addOutOfOrderBlocks(context.Background(), tn, false); err != nil {
+		level.Warn(t.logger).Log("msg", "failed to add out-of-order blocks", "tenant", tenantID, "err", err)
+	}
+	if err := tn.storage.Open(); err != nil {
+		return nil, err
+	}
+	// A tenant that was opened counts as written to, so that it is not pruned immediately.
+	atomic.StoreInt64(&tn.lastWrite, time.Now().UnixNano())
+	// Samples older than two min block durations are rejected, as they are not compacted anymore.
+	startTimeMargin := int64(2 * time.Duration(opts.MinBlockDuration).Seconds() * 1000)
+	tn.readyS.Set(tn.storage.Get(), startTimeMargin)
+	tn.storeTSDB = store.NewTSDBStore(log.With(t.logger, "tenant", tenantID), nil, tn.storage.Get(), component.Receive, tn.labels)
+	// A tenant whose pruning failed after its storage was closed is served again.
+	tn.mtx.Lock()
+	tn.pruned = false
+	tn.mtx.Unlock()
+	level.Info(t.logger).Log("msg", "TSDB of tenant is open", "tenant", tenantID)
+	return tn, nil
+}
+
+type noopQueryable struct{}
+
+func (noopQueryable) Querier(context.Context, int64, int64) (storage.Querier, error) {
+	return storage.NoopQuerier(), nil
+}
@@ -0,0 +1,226 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/shipper"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMultiTSDB(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "multi-tsdb")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	newMultiTSDB := func() *MultiTSDB {
+		return NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+			RetentionDuration: model.Duration(time.Hour * 24 * 15),
+			NoLockfile:        true,
+			MinBlockDuration:  model.Duration(time.Hour * 2),
+			MaxBlockDuration:  model.Duration(time.Hour * 2),
+		}, nil, 0, 0, labels.FromStrings("replica", "01"), "tenant_id", nil, shipper.UploadOptions{})
+	}
+
+	m := newMultiTSDB()
+	testutil.Ok(t, m.Open())
+
+	// TSDBs of tenants are created on their first write.
+	testutil.Equals(t, 0, len(m.TSDBStores()))
+	for i, tenant := range []string{"foo", "bar"} {
+		a, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		app, err := a.Appender()
+		testutil.Ok(t, err)
+		_, err = app.Add(labels.FromStrings("a", "1"), 1, float64(i))
+		testutil.Ok(t, err)
+		testutil.Ok(t, app.Commit())
+	}
+
+	_, err = m.TenantAppendable("../foo")
+	testutil.NotOk(t, err)
+
+	stores := m.TSDBStores()
+	testutil.Equals(t, 2, len(stores))
+	var lsets []string
+	for _, s := range stores {
+		info, err := s.Info(ctx, &storepb.InfoRequest{})
+		testutil.Ok(t, err)
+		lsets = append(lsets, storepb.LabelsToPromLabels(info.Labels).String())
+	}
+	sort.Strings(lsets)
+	testutil.Equals(t, []string{`{replica="01", tenant_id="bar"}`, `{replica="01", tenant_id="foo"}`}, lsets)
+
+	testutil.Ok(t, m.Flush())
+	testutil.Equals(t, 0, len(m.TSDBStores()))
+
+	// Flushed data of all tenants is found again after restarting.
+	m = newMultiTSDB()
+	testutil.Ok(t, m.Open())
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+
+	for i, tenant := range []string{"foo", "bar"} {
+		db, err := m.TenantQueryable(tenant)
+		testutil.Ok(t, err)
+		q, err := db.Querier(ctx, 0, 10)
+		testutil.Ok(t, err)
+		samples, err := seriesSamples(q, labels.FromStrings("a", "1"), 0, 10)
+		testutil.Ok(t, err)
+		testutil.Ok(t, q.Close())
+		testutil.Equals(t, 1, len(samples))
+		testutil.Equals(t, float64(i), samples[0].Value)
+	}
+
+	// Unknown tenants have no data.
+	db, err := m.TenantQueryable("baz")
+	testutil.Ok(t, err)
+	q, err := db.Querier(ctx, 0, 10)
+	testutil.Ok(t, err)
+	samples, err := seriesSamples(q, labels.FromStrings("a", "1"), 0, 10)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(samples))
+}
+
+func TestMultiTSDBPruneIdle(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "multi-tsdb-prune")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewRegistry()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), reg, &tsdb.Options{
+		RetentionDuration: model.Duration(time.Hour * 24 * 15),
+		NoLockfile:        true,
+		MinBlockDuration:  model.Duration(time.Hour * 2),
+		MaxBlockDuration:  model.Duration(time.Hour * 2),
+	}, nil, 0, 0, labels.FromStrings("replica", "01"), "tenant_id", bkt, shipper.UploadOptions{})
+	testutil.Ok(t, m.Open())
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	a, err := m.TenantAppendable("foo")
+	testutil.Ok(t, err)
+	app, err := a.Appender()
+	testutil.Ok(t, err)
+	_, err = app.Add(labels.FromStrings("a", "1"), 1, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	// Recently written tenants are kept.
+	testutil.Ok(t, m.PruneIdle(ctx, time.Hour))
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+
+	// Tenants are pruned only once their appenders are committed.
+	app, err = a.Appender()
+	testutil.Ok(t, err)
+	pruned := make(chan error)
+	go func() { pruned <- m.PruneIdle(ctx, 0) }()
+	select {
+	case err := <-pruned:
+		t.Fatalf("tenant with pending appender pruned, err: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = app.Add(labels.FromStrings("a", "1"), 2, 2)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+	testutil.Ok(t, <-pruned)
+	testutil.Equals(t, 0, len(m.TSDBStores()))
+
+	// Appenders of pruned tenants cannot be obtained anymore.
+	_, err = a.Appender()
+	testutil.NotOk(t, err)
+	testutil.Assert(t, len(bkt.Objects()) > 0, "expected blocks of pruned tenant to be uploaded")
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	testutil.Assert(t, os.IsNotExist(err), "expected data of pruned tenant to be deleted, got %v", err)
+	testutil.Equals(t, 0, countTenantMetrics(t, reg, "foo"))
+
+	// Pruned tenants are created again on their next write.
+	_, err = m.TenantAppendable("foo")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+	testutil.Assert(t, countTenantMetrics(t, reg, "foo") > 0, "expected metrics of tenant created again")
+}
+
+func countTenantMetrics(t *testing.T, g prometheus.Gatherer, tenant string) int {
+	mfs, err := g.Gather()
+	testutil.Ok(t, err)
+
+	var n int
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "tenant" && l.GetValue() == tenant {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+func TestMultiTSDBPruneIdle_ServesOtherTenants(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "multi-tsdb-prune")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+		RetentionDuration: model.Duration(time.Hour * 24 * 15),
+		NoLockfile:        true,
+		MinBlockDuration:  model.Duration(time.Hour * 2),
+		MaxBlockDuration:  model.Duration(time.Hour * 2),
+	}, nil, 0, 0, labels.FromStrings("replica", "01"), "tenant_id", bkt, shipper.UploadOptions{})
+	testutil.Ok(t, m.Open())
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	_, err = m.TenantAppendable("foo")
+	testutil.Ok(t, err)
+
+	// Idle tenants are detached with the lock held and pruned without it.
+	detached := m.detachIdle(0)
+	testutil.Equals(t, 1, len(detached))
+	testutil.Equals(t, 0, len(m.TSDBStores()))
+
+	_, err = m.TenantAppendable("bar")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+
+	// Writes to a tenant being pruned wait until it is pruned.
+	created := make(chan error)
+	go func() {
+		_, err := m.TenantAppendable("foo")
+		created <- err
+	}()
+	select {
+	case err := <-created:
+		t.Fatalf("tenant being pruned created again, err: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	testutil.Ok(t, m.pruneTenant(ctx, "foo", detached["foo"]))
+
+	testutil.Ok(t, <-created)
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+}
@@ -0,0 +1,370 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	promtsdb "github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/wal"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// outOfOrderStagingDir is the directory within the data directory of a tenant where blocks of out-of-order samples
+// are written to before they are moved into its TSDB. It holds the WAL of buffered samples in outOfOrderWALDir.
+const (
+	outOfOrderStagingDir = "out-of-order"
+	outOfOrderWALDir     = "wal"
+)
+
+// OutOfOrderAppender appends samples rejected by the TSDB head for being out of order or too old.
+type OutOfOrderAppender interface {
+	// AddOutOfOrder returns storage.ErrOutOfBounds if the sample is older than the out-of-order time window.
+	AddOutOfOrder(lset labels.Labels, t int64, v float64) error
+}
+
+// outOfOrderBuffer keeps out-of-order samples of a tenant in memory until they are written to blocks. Samples are
+// logged to a WAL before they are acknowledged and replayed from it when the buffer is created again.
+type outOfOrderBuffer struct {
+	logger log.Logger
+	window int64
+	// headMaxTime returns the max time of the TSDB head, which the time window is relative to.
+	headMaxTime func() int64
+
+	mtx    sync.Mutex
+	wal    *wal.WAL
+	closed bool
+	series map[string]*outOfOrderSeries
+}
+
+type outOfOrderSeries struct {
+	lset labels.Labels
+	// samples are sorted by timestamp.
+	samples []prompb.Sample
+}
+
+// newOutOfOrderBuffer returns a buffer with the samples logged to the WAL in dir, creating the WAL if needed.
+func newOutOfOrderBuffer(logger log.Logger, dir string, window int64, headMaxTime func() int64) (*outOfOrderBuffer, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	b := &outOfOrderBuffer{
+		logger:      logger,
+		window:      window,
+		headMaxTime: headMaxTime,
+		series:      map[string]*outOfOrderSeries{},
+	}
+	if err := b.replay(dir); err != nil {
+		return nil, errors.Wrap(err, "replay out-of-order WAL")
+	}
+	w, err := wal.New(logger, nil, dir, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "open out-of-order WAL")
+	}
+	b.wal = w
+	return b, nil
+}
+
+// replay adds the samples logged to the WAL in dir to the buffer. A corrupted tail of the WAL, e.g. of a crash while
+// logging, is skipped, as samples of failed writes were not acknowledged.
+func (b *outOfOrderBuffer) replay(dir string) (err error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	sr, err := wal.NewSegmentsReader(dir)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, sr, "out-of-order WAL reader")
+
+	r := wal.NewReader(sr)
+	for r.Next() {
+		lset, t, v, err := decodeOutOfOrderSample(r.Record())
+		if err != nil {
+			return err
+		}
+		b.add(lset, t, v)
+	}
+	if err := r.Err(); err != nil {
+		if _, ok := errors.Cause(err).(*wal.CorruptionErr); !ok {
+			return err
+		}
+		level.Warn(b.logger).Log("msg", "skipping corrupted tail of out-of-order WAL", "err", err)
+	}
+	return nil
+}
+
+// AddOutOfOrder buffers a sample within the time window before the max time of the TSDB head. Resent samples are
+// ignored, samples with a different value for a buffered timestamp are rejected. The sample is logged to the WAL
+// before it is buffered.
+func (b *outOfOrderBuffer) AddOutOfOrder(lset labels.Labels, t int64, v float64) error {
+	// The max time of an empty head is math.MinInt64.
+	if maxt := b.headMaxTime(); maxt != math.MinInt64 && t < maxt-b.window {
+		return storage.ErrOutOfBounds
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return errors.New("out-of-order storage is closed")
+	}
+	if s, ok := b.series[lset.String()]; ok {
+		if i := s.search(t); i < len(s.samples) && s.samples[i].Timestamp == t {
+			if s.samples[i].Value != v {
+				return storage.ErrDuplicateSampleForTimestamp
+			}
+			return nil
+		}
+	}
+	if err := b.wal.Log(encodeOutOfOrderSample(lset, t, v)); err != nil {
+		return errors.Wrap(err, "log out-of-order sample")
+	}
+	b.add(lset, t, v)
+	return nil
+}
+
+// add buffers the given sample, unless a sample with the same timestamp is buffered already.
+// It must be called with the lock held.
+func (b *outOfOrderBuffer) add(lset labels.Labels, t int64, v float64) {
+	key := lset.String()
+	s, ok := b.series[key]
+	if !ok {
+		s = &outOfOrderSeries{lset: lset}
+		b.series[key] = s
+	}
+	i := s.search(t)
+	if i < len(s.samples) && s.samples[i].Timestamp == t {
+		return
+	}
+	s.samples = append(s.samples, prompb.Sample{})
+	copy(s.samples[i+1:], s.samples[i:])
+	s.samples[i] = prompb.Sample{Timestamp: t, Value: v}
+}
+
+// search returns the index of the first sample not older than t.
+func (s *outOfOrderSeries) search(t int64) int {
+	return sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp >= t })
+}
+
+// samples returns a copy of the buffered samples of the series within [mint, maxt].
+func (b *outOfOrderBuffer) samples(lset labels.Labels, mint, maxt int64) []prompb.Sample {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	s, ok := b.series[lset.String()]
+	if !ok {
+		return nil
+	}
+	i, j := s.search(mint), s.search(maxt+1)
+	if i == j {
+		return nil
+	}
+	return append([]prompb.Sample(nil), s.samples[i:j]...)
+}
+
+// cut removes buffered samples older than maxt and returns them. They stay in the WAL until the next checkpoint.
+func (b *outOfOrderBuffer) cut(maxt int64) []*outOfOrderSeries {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var res []*outOfOrderSeries
+	for key, s := range b.series {
+		i := s.search(maxt)
+		if i == 0 {
+			continue
+		}
+		res = append(res, &outOfOrderSeries{lset: s.lset, samples: s.samples[:i]})
+		if i == len(s.samples) {
+			delete(b.series, key)
+			continue
+		}
+		s.samples = append([]prompb.Sample(nil), s.samples[i:]...)
+	}
+	return res
+}
+
+// restore buffers samples cut before again, e.g. if writing them to blocks failed.
+func (b *outOfOrderBuffer) restore(series []*outOfOrderSeries) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, s := range series {
+		for _, smpl := range s.samples {
+			b.add(s.lset, smpl.Timestamp, smpl.Value)
+		}
+	}
+}
+
+// checkpoint rewrites the WAL to hold only the buffered samples, dropping samples cut and written to blocks before.
+// The buffered samples are logged to a new segment before older segments are removed.
+func (b *outOfOrderBuffer) checkpoint() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return errors.New("out-of-order storage is closed")
+	}
+	if err := b.wal.NextSegment(); err != nil {
+		return errors.Wrap(err, "create segment")
+	}
+	var recs [][]byte
+	for _, s := range b.series {
+		for _, smpl := range s.samples {
+			recs = append(recs, encodeOutOfOrderSample(s.lset, smpl.Timestamp, smpl.Value))
+		}
+	}
+	if len(recs) > 0 {
+		if err := b.wal.Log(recs...); err != nil {
+			return errors.Wrap(err, "log buffered samples")
+		}
+	}
+	_, last, err := b.wal.Segments()
+	if err != nil {
+		return errors.Wrap(err, "get segments")
+	}
+	if err := b.wal.Truncate(last); err != nil {
+		return errors.Wrap(err, "truncate")
+	}
+	return nil
+}
+
+// Close closes the WAL. Samples cannot be added afterwards.
+func (b *outOfOrderBuffer) Close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.wal.Close()
+}
+
+// encodeOutOfOrderSample encodes a sample as record of the out-of-order WAL.
+func encodeOutOfOrderSample(lset labels.Labels, t int64, v float64) []byte {
+	e := encoding.Encbuf{}
+	e.PutUvarint(len(lset))
+	for _, l := range lset {
+		e.PutUvarintStr(l.Name)
+		e.PutUvarintStr(l.Value)
+	}
+	e.PutBE64int64(t)
+	e.PutBE64(math.Float64bits(v))
+	return e.Get()
+}
+
+func decodeOutOfOrderSample(rec []byte) (lset labels.Labels, t int64, v float64, err error) {
+	d := encoding.Decbuf{B: rec}
+	n := d.Uvarint()
+	lset = make(labels.Labels, 0, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		lset = append(lset, labels.Label{Name: d.UvarintStr(), Value: d.UvarintStr()})
+	}
+	t = d.Be64int64()
+	v = math.Float64frombits(d.Be64())
+	if d.Err() != nil {
+		return nil, 0, 0, errors.Wrap(d.Err(), "decode out-of-order sample")
+	}
+	if d.Len() > 0 {
+		return nil, 0, 0, errors.Errorf("unexpected %d bytes left in out-of-order sample record", d.Len())
+	}
+	return lset, t, v, nil
+}
+
+// writeOutOfOrderBlocks writes the given samples into new blocks in dir, with the given external labels. Every block
+// holds samples of one blockDuration aligned time range, so that blocks overlap with as few blocks cut from the TSDB
+// head as possible. It returns IDs of the created blocks.
+func writeOutOfOrderBlocks(ctx context.Context, logger log.Logger, dir string, series []*outOfOrderSeries, blockDuration int64, extLset labels.Labels) ([]ulid.ULID, error) {
+	byRange := map[int64][]*outOfOrderSeries{}
+	for _, s := range series {
+		for len(s.samples) > 0 {
+			mint := alignDown(s.samples[0].Timestamp, blockDuration)
+			i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].Timestamp >= mint+blockDuration })
+			byRange[mint] = append(byRange[mint], &outOfOrderSeries{lset: s.lset, samples: s.samples[:i]})
+			s = &outOfOrderSeries{lset: s.lset, samples: s.samples[i:]}
+		}
+	}
+
+	mints := make([]int64, 0, len(byRange))
+	for mint := range byRange {
+		mints = append(mints, mint)
+	}
+	sort.Slice(mints, func(i, j int) bool { return mints[i] < mints[j] })
+
+	var ids []ulid.ULID
+	for _, mint := range mints {
+		id, err := writeOutOfOrderBlock(ctx, logger, dir, byRange[mint], blockDuration, extLset)
+		if err != nil {
+			return ids, errors.Wrapf(err, "write block for time range [%d, %d)", mint, mint+blockDuration)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func writeOutOfOrderBlock(ctx context.Context, logger log.Logger, dir string, series []*outOfOrderSeries, blockDuration int64, extLset labels.Labels) (id ulid.ULID, err error) {
+	// The head accepts samples only within half of its chunk range before its max time, so the chunk range is
+	// twice the block range to accept samples of the whole block range in any order of series.
+	h, err := promtsdb.NewHead(nil, logger, nil, 2*blockDuration)
+	if err != nil {
+		return id, errors.Wrap(err, "create head block")
+	}
+	defer runutil.CloseWithErrCapture(&err, h, "TSDB Head")
+
+	app := h.Appender()
+	for _, s := range series {
+		for _, smpl := range s.samples {
+			if _, err := app.Add(s.lset, smpl.Timestamp, smpl.Value); err != nil {
+				if rerr := app.Rollback(); rerr != nil {
+					err = errors.Wrapf(err, "rollback failed: %v", rerr)
+				}
+				return id, errors.Wrapf(err, "add sample of series %s", s.lset)
+			}
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return id, errors.Wrap(err, "commit")
+	}
+
+	c, err := promtsdb.NewLeveledCompactor(ctx, nil, logger, []int64{blockDuration}, nil)
+	if err != nil {
+		return id, errors.Wrap(err, "create compactor")
+	}
+	id, err = c.Write(dir, h, h.MinTime(), h.MaxTime()+1, nil)
+	if err != nil {
+		return id, errors.Wrap(err, "write block")
+	}
+	if _, err := metadata.InjectThanos(logger, filepath.Join(dir, id.String()), metadata.Thanos{
+		Labels:     extLset.Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.ReceiveSource,
+	}, nil); err != nil {
+		return id, errors.Wrap(err, "inject thanos meta")
+	}
+	return id, nil
+}
+
+// alignDown returns the start of the range of the given width containing t.
+func alignDown(t, width int64) int64 {
+	if t >= 0 {
+		return t - t%width
+	}
+	return -((-t + width - 1) / width) * width
+}
@@ -0,0 +1,112 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestOutOfOrderBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "out-of-order-wal")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	headMaxTime := int64(100)
+	b, err := newOutOfOrderBuffer(nil, dir, 50, func() int64 { return headMaxTime })
+	testutil.Ok(t, err)
+	foo := labels.FromStrings("a", "foo")
+	bar := labels.FromStrings("a", "bar")
+
+	testutil.Ok(t, b.AddOutOfOrder(foo, 80, 3))
+	testutil.Ok(t, b.AddOutOfOrder(foo, 60, 1))
+	testutil.Ok(t, b.AddOutOfOrder(foo, 70, 2))
+	testutil.Ok(t, b.AddOutOfOrder(bar, 90, 1))
+
+	// Samples older than the window are rejected.
+	testutil.Equals(t, storage.ErrOutOfBounds, b.AddOutOfOrder(foo, 49, 1))
+	// Resent samples are ignored, differing ones are rejected.
+	testutil.Ok(t, b.AddOutOfOrder(foo, 70, 2))
+	testutil.Equals(t, storage.ErrDuplicateSampleForTimestamp, b.AddOutOfOrder(foo, 70, 5))
+
+	series := b.cut(75)
+	testutil.Equals(t, 1, len(series))
+	testutil.Equals(t, foo, series[0].lset)
+	testutil.Equals(t, []prompb.Sample{{Timestamp: 60, Value: 1}, {Timestamp: 70, Value: 2}}, series[0].samples)
+
+	// Samples are replayed from the WAL, including cut ones until the next checkpoint.
+	testutil.Ok(t, b.Close())
+	testutil.NotOk(t, b.AddOutOfOrder(foo, 90, 1))
+	b, err = newOutOfOrderBuffer(nil, dir, 50, func() int64 { return headMaxTime })
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(b.cut(75)))
+	testutil.Ok(t, b.checkpoint())
+	testutil.Ok(t, b.Close())
+
+	b, err = newOutOfOrderBuffer(nil, dir, 50, func() int64 { return headMaxTime })
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	testutil.Equals(t, 0, len(b.cut(75)))
+
+	// Samples failed to write to blocks are restored.
+	series = b.cut(100)
+	testutil.Equals(t, 2, len(series))
+	b.restore(series)
+
+	// Remaining samples are kept.
+	testutil.Equals(t, 2, len(b.cut(100)))
+	testutil.Equals(t, 0, len(b.cut(100)))
+}
+
+func TestOutOfOrderSampleEncoding(t *testing.T) {
+	lset := labels.FromStrings("__name__", "up", "a", "1")
+	rec := encodeOutOfOrderSample(lset, -5, 1.5)
+
+	got, ts, v, err := decodeOutOfOrderSample(rec)
+	testutil.Ok(t, err)
+	testutil.Equals(t, lset, got)
+	testutil.Equals(t, int64(-5), ts)
+	testutil.Equals(t, 1.5, v)
+
+	_, _, _, err = decodeOutOfOrderSample(rec[:len(rec)-1])
+	testutil.NotOk(t, err)
+}
+
+func TestWriteOutOfOrderBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "out-of-order")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	extLset := labels.FromStrings("replica", "01", "tenant_id", "foo")
+	ids, err := writeOutOfOrderBlocks(context.Background(), log.NewNopLogger(), dir, []*outOfOrderSeries{
+		{lset: labels.FromStrings("a", "1"), samples: []prompb.Sample{{Timestamp: 10, Value: 1}, {Timestamp: 120, Value: 2}}},
+		{lset: labels.FromStrings("a", "2"), samples: []prompb.Sample{{Timestamp: 20, Value: 1}}},
+	}, 100, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+
+	meta, err := metadata.Read(filepath.Join(dir, ids[0].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(10), meta.MinTime)
+	testutil.Equals(t, int64(21), meta.MaxTime)
+	testutil.Equals(t, uint64(2), meta.Stats.NumSeries)
+	testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+	testutil.Equals(t, metadata.ReceiveSource, meta.Thanos.Source)
+
+	meta, err = metadata.Read(filepath.Join(dir, ids[1].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(120), meta.MinTime)
+	testutil.Equals(t, uint64(1), meta.Stats.NumSamples)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	rejectReasonConcurrency = "concurrency"
+	rejectReasonBodySize    = "body_size"
+	rejectReasonTenantRate  = "tenant_rate"
+
+	// defaultRetryAfter is how long clients are asked to wait before retrying requests rejected because of the
+	// concurrency limit.
+	defaultRetryAfter = time.Second
+)
+
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+// limitRequests rejects write requests exceeding the concurrency limit or a limit of their tenant before they are
+// read, and limits the size of the body of accepted ones. Requests rejected because of concurrency or rate limits are
+// answered with 429 and a Retry-After header, requests with too large bodies with 413, as retrying them cannot
+// succeed.
+func (h *Handler) limitRequests(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.inflight != nil {
+			select {
+			case h.inflight <- struct{}{}:
+				defer func() { <-h.inflight }()
+			default:
+				h.rejectRequest(w, rejectReasonConcurrency, defaultRetryAfter, fmt.Sprintf("more than %d concurrent requests", cap(h.inflight)))
+				return
+			}
+		}
+
+		tenant := h.tenant(r)
+		// Limits of tenants are enforced only once, when a request is received from a client and not yet replicated.
+		if h.options.Limiter != nil && r.Header.Get(h.options.ReplicaHeader) == "" {
+			if retryAfter, err := h.options.Limiter.AllowRequest(tenant); err != nil {
+				h.rejectRequest(w, rejectReasonTenantRate, retryAfter, err.Error())
+				return
+			}
+		}
+
+		if max := h.maxRequestBodyBytes(tenant); max > 0 {
+			if r.ContentLength > max {
+				h.rejectBodyTooLarge(w, tenant)
+				return
+			}
+			r.Body = &limitedBody{ReadCloser: r.Body, remaining: max}
+		}
+		next(w, r)
+	}
+}
+
+// maxRequestBodyBytes returns the maximum size of a write request body of the given tenant or zero if unlimited.
+func (h *Handler) maxRequestBodyBytes(tenant string) int64 {
+	max := h.options.MaxRequestBodyBytes
+	if h.options.Limiter == nil {
+		return max
+	}
+	if l := h.options.Limiter.MaxRequestBodyBytes(tenant); l > 0 && (max == 0 || l < max) {
+		return l
+	}
+	return max
+}
+
+// rejectBodyTooLarge rejects a write request of the given tenant because of its body size. The request is answered
+// with 413 without Retry-After, as it would be rejected again.
+func (h *Handler) rejectBodyTooLarge(w http.ResponseWriter, tenant string) {
+	max := h.maxRequestBodyBytes(tenant)
+	msg := fmt.Sprintf("request body exceeds %d bytes", max)
+	// Record requests exceeding the limit of their tenant as tenant limited as well.
+	if h.options.Limiter != nil && h.options.Limiter.MaxRequestBodyBytes(tenant) == max {
+		msg = h.options.Limiter.RequestBodyTooLarge(tenant).Error()
+	}
+	h.rejectedRequestsTotal.WithLabelValues(rejectReasonBodySize).Inc()
+	level.Debug(h.logger).Log("msg", "rejected write request", "reason", rejectReasonBodySize, "err", msg)
+	http.Error(w, msg, http.StatusRequestEntityTooLarge)
+}
+
+// rejectRequest rejects a write request which can be retried after the given duration.
+func (h *Handler) rejectRequest(w http.ResponseWriter, reason string, retryAfter time.Duration, msg string) {
+	h.rejectedRequestsTotal.WithLabelValues(reason).Inc()
+	level.Debug(h.logger).Log("msg", "rejected write request", "reason", reason, "err", msg)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// limitedBody returns errRequestBodyTooLarge once more than the remaining number of bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errRequestBodyTooLarge
+	}
+	return n, err
+}
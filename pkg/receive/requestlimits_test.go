@@ -0,0 +1,90 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestLimitRequests(t *testing.T) {
+	appendable := &fakeAppendable{appender: newFakeAppender(nil, nil, nil, nil)}
+	handlers, _ := newHandlerHashring([]*fakeAppendable{appendable}, 1)
+	h := handlers[0]
+	h.options.MaxRequestBodyBytes = 1000
+	h.options.Limiter = NewLimiter(nil, &LimitsConfig{
+		Tenants: map[string]TenantLimits{
+			"rated": {RequestsPerSecond: 0.001},
+			"small": {MaxRequestBodyBytes: 1},
+		},
+	}, nil)
+
+	buf, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "foo", Value: "bar"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}})
+	testutil.Ok(t, err)
+	body := snappy.Encode(nil, buf)
+
+	do := func(tenant string, body []byte, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", h.options.Endpoint, bytes.NewReader(body))
+		if chunked {
+			// Hide the length of the body, as for chunked transfer encoding.
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.ContentLength = -1
+		}
+		req.Header.Add(h.options.TenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		h.limitRequests(h.receiveHTTP)(rec, req)
+		return rec
+	}
+
+	testutil.Equals(t, http.StatusOK, do("foo", body, false).Code)
+
+	t.Run("body size", func(t *testing.T) {
+		large := append(append([]byte{}, body...), make([]byte, 1000)...)
+		for _, chunked := range []bool{false, true} {
+			rec := do("foo", large, chunked)
+			testutil.Equals(t, http.StatusRequestEntityTooLarge, rec.Code)
+			testutil.Equals(t, "", rec.Header().Get("Retry-After"))
+
+			testutil.Equals(t, http.StatusRequestEntityTooLarge, do("small", body, chunked).Code)
+		}
+		testutil.Equals(t, 4.0, promtestutil.ToFloat64(h.rejectedRequestsTotal.WithLabelValues(rejectReasonBodySize)))
+		testutil.Equals(t, 2.0, promtestutil.ToFloat64(h.options.Limiter.limitedRequests.WithLabelValues("small", limitRequestBodySize)))
+	})
+
+	t.Run("tenant rate", func(t *testing.T) {
+		testutil.Equals(t, http.StatusOK, do("rated", body, false).Code)
+		rec := do("rated", body, false)
+		testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+		// The next request is allowed in 1000 seconds.
+		testutil.Equals(t, "1000", rec.Header().Get("Retry-After"))
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.rejectedRequestsTotal.WithLabelValues(rejectReasonTenantRate)))
+
+		// Other tenants are not affected.
+		testutil.Equals(t, http.StatusOK, do("foo", body, false).Code)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		h.inflight = make(chan struct{}, 1)
+		h.inflight <- struct{}{}
+		testutil.Equals(t, http.StatusTooManyRequests, do("foo", body, false).Code)
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(h.rejectedRequestsTotal.WithLabelValues(rejectReasonConcurrency)))
+
+		<-h.inflight
+		testutil.Equals(t, http.StatusOK, do("foo", body, false).Code)
+		testutil.Equals(t, 0, len(h.inflight))
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/remotewrite"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// ShadowConfig configures a remote write endpoint, e.g. another Thanos or a vendor, that write requests accepted by
+// a receiver are additionally written to, to evaluate it or to migrate to it.
+type ShadowConfig struct {
+	RemoteWrite remotewrite.Config `yaml:",inline"`
+	// Percentage of series whose samples are shadowed. Series are selected by the hash of their labels, so that
+	// either all or none of the samples of a series are shadowed.
+	Percentage float64 `yaml:"percentage"`
+	// TenantHeader is the HTTP header the tenant of shadowed requests is sent in. The tenant is not sent if empty.
+	TenantHeader string `yaml:"tenant_header"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ShadowConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = ShadowConfig{RemoteWrite: remotewrite.DefaultConfig(), Percentage: 100}
+	type plain ShadowConfig
+	return unmarshal((*plain)(c))
+}
+
+// ParseShadowConfigs parses and validates the YAML list of shadow configurations.
+func ParseShadowConfigs(content []byte) ([]ShadowConfig, error) {
+	var cfgs []ShadowConfig
+	if err := yaml.UnmarshalStrict(content, &cfgs); err != nil {
+		return nil, errors.Wrap(err, "parse shadow configuration")
+	}
+
+	names := map[string]struct{}{}
+	for i := range cfgs {
+		if cfgs[i].RemoteWrite.Name == "" {
+			cfgs[i].RemoteWrite.Name = strconv.Itoa(i)
+		}
+		name := cfgs[i].RemoteWrite.Name
+		if _, ok := names[name]; ok {
+			return nil, errors.Errorf("shadow name %q is duplicated", name)
+		}
+		names[name] = struct{}{}
+
+		if cfgs[i].RemoteWrite.QueueCapacity <= 0 {
+			return nil, errors.Errorf("queue capacity of shadow %q must be positive", name)
+		}
+		if cfgs[i].Percentage <= 0 || cfgs[i].Percentage > 100 {
+			return nil, errors.Errorf("percentage of shadow %q must be in (0, 100]", name)
+		}
+	}
+	return cfgs, nil
+}
+
+// Shadow writes a share of the write requests accepted by a receiver to a remote write endpoint. Requests are
+// queued, so that the endpoint never slows down or fails the write path. Requests exceeding the queue capacity are
+// dropped.
+type Shadow struct {
+	cfg   ShadowConfig
+	queue *remotewrite.Queue
+}
+
+// NewShadow returns a new Shadow writing to the endpoints of the given client.
+func NewShadow(logger log.Logger, reg prometheus.Registerer, cfg ShadowConfig, client *http_util.Client) *Shadow {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Shadow{
+		cfg:   cfg,
+		queue: remotewrite.NewQueue(log.With(logger, "component", "receive-shadow"), reg, "thanos_receive_shadow", cfg.RemoteWrite, client),
+	}
+}
+
+// Run sends queued write requests until the given context is canceled.
+func (s *Shadow) Run(ctx context.Context) {
+	s.queue.Run(ctx)
+}
+
+// Enqueue queues the selected series of the given write request of the tenant.
+func (s *Shadow) Enqueue(tenant string, wreq *prompb.WriteRequest) {
+	req := wreq
+	if s.cfg.Percentage < 100 {
+		req = &prompb.WriteRequest{}
+		for i := range wreq.Timeseries {
+			if float64(hash(tenant, &wreq.Timeseries[i])%10000) < s.cfg.Percentage*100 {
+				req.Timeseries = append(req.Timeseries, wreq.Timeseries[i])
+			}
+		}
+		if len(req.Timeseries) == 0 {
+			return
+		}
+	}
+
+	var headers map[string]string
+	if s.cfg.TenantHeader != "" {
+		headers = map[string]string{s.cfg.TenantHeader: tenant}
+	}
+	// Dropped samples are counted by the queue.
+	s.queue.EnqueueWithHeaders(req, headers)
+}
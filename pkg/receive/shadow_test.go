@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type staticProvider []string
+
+func (p staticProvider) Resolve(context.Context, []string) {}
+func (p staticProvider) Addresses() []string               { return p }
+
+func TestParseShadowConfigs(t *testing.T) {
+	cfgs, err := ParseShadowConfigs([]byte(`
+- static_configs: ["vendor:443"]
+  path_prefix: /push
+- name: sample
+  static_configs: ["receive:19291"]
+  percentage: 10
+  tenant_header: THANOS-TENANT
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(cfgs))
+	testutil.Equals(t, "0", cfgs[0].RemoteWrite.Name)
+	testutil.Equals(t, "/push", cfgs[0].RemoteWrite.EndpointsConfig.PathPrefix)
+	testutil.Equals(t, 1000, cfgs[0].RemoteWrite.QueueCapacity)
+	testutil.Equals(t, 100.0, cfgs[0].Percentage)
+	testutil.Equals(t, "sample", cfgs[1].RemoteWrite.Name)
+	testutil.Equals(t, "/api/v1/receive", cfgs[1].RemoteWrite.EndpointsConfig.PathPrefix)
+	testutil.Equals(t, 10.0, cfgs[1].Percentage)
+	testutil.Equals(t, "THANOS-TENANT", cfgs[1].TenantHeader)
+
+	_, err = ParseShadowConfigs([]byte(`[{percentage: 101}]`))
+	testutil.NotOk(t, err)
+	_, err = ParseShadowConfigs([]byte(`[{name: a}, {name: a}]`))
+	testutil.NotOk(t, err)
+}
+
+func TestShadow(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		received = map[string]int{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		testutil.Equals(t, "foo", r.Header.Get("THANOS-TENANT"))
+		compressed, err := ioutil.ReadAll(r.Body)
+		testutil.Ok(t, err)
+		b, err := snappy.Decode(nil, compressed)
+		testutil.Ok(t, err)
+		var req prompb.WriteRequest
+		testutil.Ok(t, proto.Unmarshal(b, &req))
+		for _, ts := range req.Timeseries {
+			received[ts.Labels[0].Value]++
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	cfgs, err := ParseShadowConfigs([]byte(`[{percentage: 50, tenant_header: THANOS-TENANT}]`))
+	testutil.Ok(t, err)
+	client, err := http_util.NewClient(nil, cfgs[0].RemoteWrite.EndpointsConfig, http.DefaultClient, staticProvider{u.Host})
+	testutil.Ok(t, err)
+	s := NewShadow(nil, nil, cfgs[0], client)
+
+	wreq := &prompb.WriteRequest{}
+	for i := 0; i < 100; i++ {
+		wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "series", Value: fmt.Sprintf("%d", i)}},
+			Samples: []prompb.Sample{{Timestamp: 1, Value: 1}},
+		})
+	}
+	// The same series are selected every time.
+	s.Enqueue("foo", wreq)
+	s.Enqueue("foo", wreq)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	retryCtx, retryCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer retryCancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, retryCtx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, n := range received {
+			if n != 2 {
+				return errors.New("not all requests received yet")
+			}
+		}
+		if len(received) == 0 {
+			return errors.New("nothing received yet")
+		}
+		return nil
+	}))
+	cancel()
+	<-done
+
+	testutil.Assert(t, len(received) > 20 && len(received) < 80, "expected about half of the series to be shadowed, got %d", len(received))
+}
@@ -0,0 +1,95 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/tsdb"
+	"gopkg.in/yaml.v2"
+)
+
+// TenantTSDBConfig overrides TSDB options of tenants. Zero values keep the options they override.
+type TenantTSDBConfig struct {
+	// Retention is how long samples are retained in the local TSDB.
+	Retention model.Duration `yaml:"retention"`
+	// MinBlockDuration and MaxBlockDuration bound the time range of local TSDB blocks.
+	MinBlockDuration model.Duration `yaml:"min_block_duration"`
+	MaxBlockDuration model.Duration `yaml:"max_block_duration"`
+	// WALCompression enables or disables compression of the WAL.
+	WALCompression *bool `yaml:"wal_compression"`
+}
+
+func (c TenantTSDBConfig) validate() error {
+	if c.MinBlockDuration != 0 && c.MaxBlockDuration != 0 && c.MinBlockDuration > c.MaxBlockDuration {
+		return errors.New("min_block_duration cannot be greater than max_block_duration")
+	}
+	return nil
+}
+
+func (c TenantTSDBConfig) apply(opts *tsdb.Options) {
+	if c.Retention != 0 {
+		opts.RetentionDuration = c.Retention
+	}
+	if c.MinBlockDuration != 0 {
+		opts.MinBlockDuration = c.MinBlockDuration
+	}
+	if c.MaxBlockDuration != 0 {
+		opts.MaxBlockDuration = c.MaxBlockDuration
+	}
+	if c.WALCompression != nil {
+		opts.WALCompression = *c.WALCompression
+	}
+}
+
+// TenantsConfig configures the TSDBs of tenants.
+type TenantsConfig struct {
+	// Default overrides the TSDB options given by flags for all tenants.
+	Default TenantTSDBConfig `yaml:"default"`
+	// Tenants contains overrides per tenant, applied on top of the default ones.
+	Tenants map[string]TenantTSDBConfig `yaml:"tenants"`
+}
+
+// ParseTenantsConfig parses and validates the YAML tenants configuration.
+func ParseTenantsConfig(content []byte) (*TenantsConfig, error) {
+	conf := &TenantsConfig{}
+	if err := yaml.UnmarshalStrict(content, conf); err != nil {
+		return nil, errors.Wrap(err, "parse tenants configuration")
+	}
+	if err := conf.Default.validate(); err != nil {
+		return nil, errors.Wrap(err, "default")
+	}
+	for tenant, c := range conf.Tenants {
+		if err := c.validate(); err != nil {
+			return nil, errors.Wrapf(err, "tenant %s", tenant)
+		}
+	}
+	return conf, nil
+}
+
+// TSDBOptions returns the TSDB options of the given tenant, based on the given default options.
+func (c *TenantsConfig) TSDBOptions(tenant string, def *tsdb.Options) *tsdb.Options {
+	opts := *def
+	if c == nil {
+		return &opts
+	}
+	c.Default.apply(&opts)
+	if tc, ok := c.Tenants[tenant]; ok {
+		tc.apply(&opts)
+	}
+	return &opts
+}
+
+// AllTSDBOptions returns the TSDB options of all configured tenants and the default options of other tenants, by
+// tenant. Default options are returned for the empty tenant.
+func (c *TenantsConfig) AllTSDBOptions(def *tsdb.Options) map[string]*tsdb.Options {
+	res := map[string]*tsdb.Options{"": c.TSDBOptions("", def)}
+	if c == nil {
+		return res
+	}
+	for tenant := range c.Tenants {
+		res[tenant] = c.TSDBOptions(tenant, def)
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTenantsConfig(t *testing.T) {
+	def := &tsdb.Options{
+		RetentionDuration: model.Duration(15 * 24 * time.Hour),
+		MinBlockDuration:  model.Duration(2 * time.Hour),
+		MaxBlockDuration:  model.Duration(2 * time.Hour),
+		NoLockfile:        true,
+		WALCompression:    true,
+	}
+
+	conf, err := ParseTenantsConfig([]byte(`
+default:
+  retention: 7d
+tenants:
+  foo:
+    min_block_duration: 1h
+    max_block_duration: 1h
+    wal_compression: false
+`))
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, &tsdb.Options{
+		RetentionDuration: model.Duration(7 * 24 * time.Hour),
+		MinBlockDuration:  model.Duration(2 * time.Hour),
+		MaxBlockDuration:  model.Duration(2 * time.Hour),
+		NoLockfile:        true,
+		WALCompression:    true,
+	}, conf.TSDBOptions("bar", def))
+	testutil.Equals(t, &tsdb.Options{
+		RetentionDuration: model.Duration(7 * 24 * time.Hour),
+		MinBlockDuration:  model.Duration(time.Hour),
+		MaxBlockDuration:  model.Duration(time.Hour),
+		NoLockfile:        true,
+	}, conf.TSDBOptions("foo", def))
+	testutil.Equals(t, 2, len(conf.AllTSDBOptions(def)))
+
+	// Without configuration, tenants get a copy of the default options.
+	var noConf *TenantsConfig
+	opts := noConf.TSDBOptions("foo", def)
+	testutil.Equals(t, def, opts)
+	testutil.Assert(t, opts != def, "expected a copy of the default options")
+
+	_, err = ParseTenantsConfig([]byte(`default: {min_block_duration: 4h, max_block_duration: 2h}`))
+	testutil.NotOk(t, err)
+	_, err = ParseTenantsConfig([]byte(`default: {unknown: 1}`))
+	testutil.NotOk(t, err)
+}
@@ -6,6 +6,8 @@ package receive
 import (
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/go-kit/kit/log"
@@ -58,10 +60,14 @@ func (f *FlushableStorage) open() error {
 	if !f.stopped {
 		return nil
 	}
+	var reg prometheus.Registerer
+	if f.r != nil {
+		reg = &UnRegisterer{f.r}
+	}
 	db, err := tsdb.Open(
 		f.path,
 		log.With(f.l, "component", "tsdb"),
-		&UnRegisterer{f.r},
+		reg,
 		f.opts,
 	)
 	if err != nil {
@@ -139,3 +145,66 @@ func (u *UnRegisterer) MustRegister(cs ...prometheus.Collector) {
 		}
 	}
 }
+
+// trackingRegisterer is a Prometheus registerer that remembers the collectors registered through it, so that they can
+// be unregistered at once, e.g. when the tenant they belong to is pruned. Collectors are tracked by their descriptors,
+// so collectors replacing each other, see UnRegisterer, are tracked once.
+type trackingRegisterer struct {
+	prometheus.Registerer
+
+	mtx        sync.Mutex
+	collectors map[string]prometheus.Collector
+}
+
+func newTrackingRegisterer(reg prometheus.Registerer) *trackingRegisterer {
+	return &trackingRegisterer{Registerer: reg, collectors: map[string]prometheus.Collector{}}
+}
+
+func (r *trackingRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.collectors[collectorKey(c)] = c
+	return nil
+}
+
+func (r *trackingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *trackingRegisterer) Unregister(c prometheus.Collector) bool {
+	r.mtx.Lock()
+	delete(r.collectors, collectorKey(c))
+	r.mtx.Unlock()
+	return r.Registerer.Unregister(c)
+}
+
+// UnregisterAll unregisters all collectors registered so far.
+func (r *trackingRegisterer) UnregisterAll() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for key, c := range r.collectors {
+		r.Registerer.Unregister(c)
+		delete(r.collectors, key)
+	}
+}
+
+func collectorKey(c prometheus.Collector) string {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []string
+	for d := range ch {
+		descs = append(descs, d.String())
+	}
+	sort.Strings(descs)
+	return strings.Join(descs, ",")
+}
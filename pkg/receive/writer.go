@@ -22,25 +22,52 @@ type Appendable interface {
 }
 
 type Writer struct {
-	logger log.Logger
-	append Appendable
+	logger    log.Logger
+	multiTSDB TenantStorage
+	exemplars TenantExemplarStorage
+	ooo       TenantOutOfOrderStorage
 }
 
-func NewWriter(logger log.Logger, app Appendable) *Writer {
+// NewWriter returns a new Writer. Exemplars and out-of-order samples are written only if the given storage stores
+// them as well.
+func NewWriter(logger log.Logger, multiTSDB TenantStorage) *Writer {
+	exemplars, _ := multiTSDB.(TenantExemplarStorage)
+	ooo, _ := multiTSDB.(TenantOutOfOrderStorage)
 	return &Writer{
-		logger: logger,
-		append: app,
+		logger:    logger,
+		multiTSDB: multiTSDB,
+		exemplars: exemplars,
+		ooo:       ooo,
 	}
 }
 
-func (r *Writer) Write(wreq *prompb.WriteRequest) error {
+// Write appends the time series of the write request to the storage of the given tenant.
+func (r *Writer) Write(tenantID string, wreq *prompb.WriteRequest) error {
 	var (
 		numOutOfOrder  = 0
 		numDuplicates  = 0
 		numOutOfBounds = 0
+
+		numExemplarsOutOfOrder = 0
 	)
 
-	app, err := r.append.Appender()
+	s, err := r.multiTSDB.TenantAppendable(tenantID)
+	if err != nil {
+		return errors.Wrap(err, "get tenant appendable")
+	}
+	var oooApp OutOfOrderAppender
+	if r.ooo != nil {
+		if oooApp, err = r.ooo.TenantOutOfOrderAppender(tenantID); err != nil {
+			return errors.Wrap(err, "get tenant out-of-order appender")
+		}
+	}
+	var exApp ExemplarAppender
+	if r.exemplars != nil {
+		if exApp, err = r.exemplars.TenantExemplarAppender(tenantID); err != nil {
+			return errors.Wrap(err, "get tenant exemplar appender")
+		}
+	}
+	app, err := s.Appender()
 	if err != nil {
 		return errors.Wrap(err, "get appender")
 	}
@@ -58,6 +85,9 @@ func (r *Writer) Write(wreq *prompb.WriteRequest) error {
 		// Append as many valid samples as possible, but keep track of the errors.
 		for _, s := range t.Samples {
 			_, err = app.Add(lset, s.Timestamp, s.Value)
+			if oooApp != nil && (err == storage.ErrOutOfOrderSample || err == storage.ErrOutOfBounds) {
+				err = oooApp.AddOutOfOrder(lset, s.Timestamp, s.Value)
+			}
 			switch err {
 			case nil:
 				continue
@@ -72,6 +102,22 @@ func (r *Writer) Write(wreq *prompb.WriteRequest) error {
 				level.Debug(r.logger).Log("msg", "Out of bounds metric", "lset", lset.String(), "sample", s.String())
 			}
 		}
+
+		if exApp == nil {
+			continue
+		}
+		// Exemplars are best effort, failing to store them does not fail the write.
+		for _, e := range t.Exemplars {
+			switch err := exApp.AddExemplar(lset, e); err {
+			case nil:
+				continue
+			case errOutOfOrderExemplar:
+				numExemplarsOutOfOrder++
+				level.Debug(r.logger).Log("msg", "Out of order exemplar", "lset", lset.String(), "exemplar", e.String())
+			default:
+				level.Debug(r.logger).Log("msg", "Error ingesting exemplar", "lset", lset.String(), "exemplar", e.String(), "err", err)
+			}
+		}
 	}
 
 	if numOutOfOrder > 0 {
@@ -87,6 +133,10 @@ func (r *Writer) Write(wreq *prompb.WriteRequest) error {
 		errs.Add(errors.Wrapf(storage.ErrOutOfBounds, "failed to non-fast add %d samples", numOutOfBounds))
 	}
 
+	if numExemplarsOutOfOrder > 0 {
+		level.Warn(r.logger).Log("msg", "Error on ingesting out-of-order exemplars", "num_dropped", numExemplarsOutOfOrder)
+	}
+
 	if err := app.Commit(); err != nil {
 		errs.Add(errors.Wrap(err, "commit samples"))
 	}
@@ -100,6 +150,7 @@ type fakeAppendable struct {
 }
 
 var _ Appendable = &fakeAppendable{}
+var _ TenantStorage = &fakeAppendable{}
 
 func nilErrFn() error {
 	return nil
@@ -113,6 +164,11 @@ func (f *fakeAppendable) Appender() (storage.Appender, error) {
 	return f.appender, errf()
 }
 
+// TenantAppendable returns the fake appendable itself for every tenant.
+func (f *fakeAppendable) TenantAppendable(_ string) (Appendable, error) {
+	return f, nil
+}
+
 type fakeAppender struct {
 	sync.Mutex
 	samples     map[string][]prompb.Sample
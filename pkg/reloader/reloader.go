@@ -81,6 +81,8 @@ import (
 type Reloader struct {
 	logger        log.Logger
 	reloadURL     *url.URL
+	reloadMethod  string
+	httpClient    *http.Client
 	cfgFile       string
 	cfgOutputFile string
 	ruleDirs      []string
@@ -105,6 +107,8 @@ func New(logger log.Logger, reloadURL *url.URL, cfgFile string, cfgOutputFile st
 	return &Reloader{
 		logger:        logger,
 		reloadURL:     reloadURL,
+		reloadMethod:  http.MethodPost,
+		httpClient:    http.DefaultClient,
 		cfgFile:       cfgFile,
 		cfgOutputFile: cfgOutputFile,
 		ruleDirs:      ruleDirs,
@@ -118,6 +122,23 @@ func (r *Reloader) WithWatchInterval(duration time.Duration) {
 	r.watchInterval = duration
 }
 
+// WithRetryInterval sets how often a failed reload is retried. Reload is retried until it succeeds or the next
+// watch interval starts.
+func (r *Reloader) WithRetryInterval(duration time.Duration) {
+	r.retryInterval = duration
+}
+
+// WithReloadMethod sets the HTTP method used to trigger a reload, e.g. PUT. POST is used by default.
+func (r *Reloader) WithReloadMethod(method string) {
+	r.reloadMethod = method
+}
+
+// WithHTTPClient sets the HTTP client used to trigger a reload. This allows to configure TLS and authentication
+// required e.g. by a proxy in front of Prometheus. http.DefaultClient is used by default.
+func (r *Reloader) WithHTTPClient(client *http.Client) {
+	r.httpClient = client
+}
+
 // Watch starts to watch periodically the config file and rules and process them until the context
 // gets canceled. Config file gets env expanded if cfgOutputFile is specified and reload is trigger if
 // config or rules changed.
@@ -190,47 +211,47 @@ func (r *Reloader) apply(ctx context.Context) error {
 		cfgHash  []byte
 		ruleHash []byte
 	)
-	if r.cfgFile != "" {
+	if r.cfgFile != "" && r.cfgOutputFile == "" {
 		h := sha256.New()
 		if err := hashFile(h, r.cfgFile); err != nil {
 			return errors.Wrap(err, "hash file")
 		}
 		cfgHash = h.Sum(nil)
-		if r.cfgOutputFile != "" {
-			b, err := ioutil.ReadFile(r.cfgFile)
-			if err != nil {
-				return errors.Wrap(err, "read file")
-			}
+	}
+	if r.cfgFile != "" && r.cfgOutputFile != "" {
+		b, err := ioutil.ReadFile(r.cfgFile)
+		if err != nil {
+			return errors.Wrap(err, "read file")
+		}
 
-			// Detect and extract gzipped file.
-			if bytes.Equal(b[0:3], firstGzipBytes) {
-				zr, err := gzip.NewReader(bytes.NewReader(b))
-				if err != nil {
-					return errors.Wrap(err, "create gzip reader")
-				}
-				defer runutil.CloseWithLogOnErr(r.logger, zr, "gzip reader close")
-
-				b, err = ioutil.ReadAll(zr)
-				if err != nil {
-					return errors.Wrap(err, "read compressed config file")
-				}
+		// Detect and extract gzipped file.
+		if bytes.HasPrefix(b, firstGzipBytes) {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				return errors.Wrap(err, "create gzip reader")
 			}
+			defer runutil.CloseWithLogOnErr(r.logger, zr, "gzip reader close")
 
-			b, err = expandEnv(b)
+			b, err = ioutil.ReadAll(zr)
 			if err != nil {
-				return errors.Wrap(err, "expand environment variables")
+				return errors.Wrap(err, "read compressed config file")
 			}
+		}
 
-			tmpFile := r.cfgOutputFile + ".tmp"
-			defer func() {
-				_ = os.Remove(tmpFile)
-			}()
-			if err := ioutil.WriteFile(tmpFile, b, 0666); err != nil {
-				return errors.Wrap(err, "write file")
-			}
-			if err := os.Rename(tmpFile, r.cfgOutputFile); err != nil {
-				return errors.Wrap(err, "rename file")
-			}
+		b, err = expandEnv(b)
+		if err != nil {
+			return errors.Wrap(err, "expand environment variables")
+		}
+
+		// Only the substituted content matters, e.g. recompressing the same template must not trigger a reload.
+		h := sha256.New()
+		if _, err := h.Write(b); err != nil {
+			return errors.Wrap(err, "hash substituted config")
+		}
+		cfgHash = h.Sum(nil)
+
+		if err := writeFileIfChanged(r.cfgOutputFile, b); err != nil {
+			return errors.Wrap(err, "write output config")
 		}
 	}
 
@@ -299,6 +320,33 @@ func (r *Reloader) apply(ctx context.Context) error {
 	return nil
 }
 
+// writeFileIfChanged atomically replaces the given file with the given content, unless it already has such content.
+// Content is synced to disk before the file is replaced, so a crash never leaves a partially written file behind.
+func writeFileIfChanged(fn string, b []byte) (err error) {
+	if cur, err := ioutil.ReadFile(fn); err == nil && bytes.Equal(cur, b) {
+		return nil
+	}
+
+	tmpFile := fn + ".tmp"
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Wrap(err, "create file")
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close file")
+
+	if _, err := f.Write(b); err != nil {
+		return errors.Wrap(err, "write file")
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "sync file")
+	}
+	return errors.Wrap(os.Rename(tmpFile, fn), "rename file")
+}
+
 func hashFile(h hash.Hash, fn string) error {
 	f, err := os.Open(fn)
 	if err != nil {
@@ -323,20 +371,20 @@ func hashFile(h hash.Hash, fn string) error {
 }
 
 func (r *Reloader) triggerReload(ctx context.Context) error {
-	req, err := http.NewRequest("POST", r.reloadURL.String(), nil)
+	req, err := http.NewRequest(r.reloadMethod, r.reloadURL.String(), nil)
 	if err != nil {
 		return errors.Wrap(err, "create request")
 	}
 	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := r.httpClient.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "reload request failed")
 	}
 	defer runutil.ExhaustCloseWithLogOnErr(r.logger, resp.Body, "trigger reload resp body")
 
-	if resp.StatusCode != 200 {
-		return errors.Errorf("received non-200 response: %s; have you set `--web.enable-lifecycle` Prometheus flag?", resp.Status)
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("received non-2xx response: %s; have you set `--web.enable-lifecycle` Prometheus flag?", resp.Status)
 	}
 	return nil
 }
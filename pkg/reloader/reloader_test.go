@@ -271,3 +271,92 @@ func TestReloader_RuleApply(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, 5, reloads.Load().(int))
 }
+
+func TestWriteFileIfChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reloader-write-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	fn := path.Join(dir, "out.yaml")
+	testutil.Ok(t, writeFileIfChanged(fn, []byte("a: 1")))
+
+	b, err := ioutil.ReadFile(fn)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "a: 1", string(b))
+
+	// Same content must not touch the file.
+	old := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+	testutil.Ok(t, os.Chtimes(fn, old, old))
+	testutil.Ok(t, writeFileIfChanged(fn, []byte("a: 1")))
+
+	fi, err := os.Stat(fn)
+	testutil.Ok(t, err)
+	testutil.Equals(t, old, fi.ModTime())
+
+	testutil.Ok(t, writeFileIfChanged(fn, []byte("a: 2")))
+	b, err = ioutil.ReadFile(fn)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "a: 2", string(b))
+
+	_, err = os.Stat(fn + ".tmp")
+	testutil.Assert(t, os.IsNotExist(err), "temporary file should be removed")
+}
+
+func TestReloader_TriggerReload(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	var (
+		mtx    sync.Mutex
+		method string
+		auth   string
+		status = http.StatusNoContent
+	)
+	srv := &http.Server{}
+	srv.Handler = http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		method = req.Method
+		auth = req.Header.Get("Authorization")
+		resp.WriteHeader(status)
+	})
+	l, err := net.Listen("tcp", "localhost:0")
+	testutil.Ok(t, err)
+	go func() { _ = srv.Serve(l) }()
+	defer func() { testutil.Ok(t, srv.Close()) }()
+
+	reloadURL, err := url.Parse(fmt.Sprintf("http://%s/-/reload", l.Addr().String()))
+	testutil.Ok(t, err)
+
+	lastRequest := func() (string, string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return method, auth
+	}
+
+	reloader := New(nil, reloadURL, "", "", nil)
+	testutil.Ok(t, reloader.triggerReload(context.Background()))
+	m, a := lastRequest()
+	testutil.Equals(t, http.MethodPost, m)
+	testutil.Equals(t, "", a)
+
+	reloader.WithReloadMethod(http.MethodPut)
+	reloader.WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth("user", "pass")
+		return http.DefaultTransport.RoundTrip(req)
+	})})
+	testutil.Ok(t, reloader.triggerReload(context.Background()))
+	m, a = lastRequest()
+	testutil.Equals(t, http.MethodPut, m)
+	testutil.Equals(t, "Basic dXNlcjpwYXNz", a)
+
+	mtx.Lock()
+	status = http.StatusUnauthorized
+	mtx.Unlock()
+	testutil.NotOk(t, reloader.triggerReload(context.Background()))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
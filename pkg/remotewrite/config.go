@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package remotewrite
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+)
+
+// Config configures an endpoint, e.g. a receive hashring, that samples are remote-written to.
+type Config struct {
+	// Name identifies the endpoint in metrics and logs. Defaults to the index of the configuration.
+	Name             string                    `yaml:"name"`
+	HTTPClientConfig http_util.ClientConfig    `yaml:"http_config"`
+	EndpointsConfig  http_util.EndpointsConfig `yaml:",inline"`
+	// Headers are added to every write request, e.g. the tenant header of receive.
+	Headers       map[string]string `yaml:"headers"`
+	RemoteTimeout model.Duration    `yaml:"remote_timeout"`
+	// QueueCapacity is the number of write requests buffered while the endpoint is unavailable.
+	// Write requests exceeding it are dropped.
+	QueueCapacity int `yaml:"queue_capacity"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		EndpointsConfig: http_util.EndpointsConfig{
+			Scheme:          "http",
+			StaticAddresses: []string{},
+			FileSDConfigs:   []http_util.FileSDConfig{},
+			PathPrefix:      "/api/v1/receive",
+		},
+		RemoteTimeout: model.Duration(30 * time.Second),
+		QueueCapacity: 1000,
+	}
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig()
+	type plain Config
+	return unmarshal((*plain)(c))
+}
+
+// LoadConfigs loads a list of Config from YAML data.
+func LoadConfigs(confYAML []byte) ([]Config, error) {
+	var cfgs []Config
+	if err := yaml.UnmarshalStrict(confYAML, &cfgs); err != nil {
+		return nil, err
+	}
+
+	names := map[string]struct{}{}
+	for i := range cfgs {
+		if cfgs[i].Name == "" {
+			cfgs[i].Name = strconv.Itoa(i)
+		}
+		if _, ok := names[cfgs[i].Name]; ok {
+			return nil, errors.Errorf("remote write name %q is duplicated", cfgs[i].Name)
+		}
+		names[cfgs[i].Name] = struct{}{}
+
+		if cfgs[i].QueueCapacity <= 0 {
+			return nil, errors.Errorf("queue capacity of remote write %q must be positive", cfgs[i].Name)
+		}
+	}
+	return cfgs, nil
+}
@@ -0,0 +1,271 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package remotewrite queues Prometheus remote write requests and sends them to the endpoints of an HTTP client.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+
+	// flushTimeout is how long pending write requests are still sent for on shutdown.
+	flushTimeout = 1 * time.Minute
+)
+
+// recoverableError is an error after which sending the same write request may succeed.
+type recoverableError struct {
+	error
+}
+
+// Queue buffers write requests and sends them to one of the endpoints of an HTTP client, retrying with backoff
+// while the request can still succeed.
+type Queue struct {
+	logger  log.Logger
+	name    string
+	client  *http_util.Client
+	headers map[string]string
+	timeout time.Duration
+
+	reqs chan queuedRequest
+
+	sentSamples     prometheus.Counter
+	failedSamples   prometheus.Counter
+	droppedSamples  prometheus.Counter
+	retries         prometheus.Counter
+	pendingRequests prometheus.Gauge
+}
+
+// queuedRequest is a write request with the headers it is sent with, in addition to the configured ones.
+type queuedRequest struct {
+	req     *prompb.WriteRequest
+	headers map[string]string
+}
+
+// NewQueue returns a new Queue sending write requests to the endpoints of the given client. Names of its metrics start
+// with the given prefix.
+func NewQueue(logger log.Logger, reg prometheus.Registerer, metricsPrefix string, cfg Config, client *http_util.Client) *Queue {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	constLabels := prometheus.Labels{"name": cfg.Name}
+	return &Queue{
+		logger:  log.With(logger, "remote_write", cfg.Name),
+		name:    cfg.Name,
+		client:  client,
+		headers: cfg.Headers,
+		timeout: time.Duration(cfg.RemoteTimeout),
+		reqs:    make(chan queuedRequest, cfg.QueueCapacity),
+		sentSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        metricsPrefix + "_sent_samples_total",
+			Help:        "Total number of samples successfully remote-written.",
+			ConstLabels: constLabels,
+		}),
+		failedSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        metricsPrefix + "_failed_samples_total",
+			Help:        "Total number of samples which failed on remote write with a non-recoverable error.",
+			ConstLabels: constLabels,
+		}),
+		droppedSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        metricsPrefix + "_dropped_samples_total",
+			Help:        "Total number of samples dropped because the remote write queue was full.",
+			ConstLabels: constLabels,
+		}),
+		retries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        metricsPrefix + "_retries_total",
+			Help:        "Total number of retried remote write requests.",
+			ConstLabels: constLabels,
+		}),
+		pendingRequests: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        metricsPrefix + "_pending_requests",
+			Help:        "Number of write requests waiting in the remote write queue.",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+// Name returns the name of the configured endpoint.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Enqueue adds the given write request to the queue. It returns false and drops the request if the queue is full.
+func (q *Queue) Enqueue(req *prompb.WriteRequest) bool {
+	return q.EnqueueWithHeaders(req, nil)
+}
+
+// EnqueueWithHeaders adds the given write request to the queue, to be sent with the given headers in addition to
+// the configured ones. It returns false and drops the request if the queue is full.
+func (q *Queue) EnqueueWithHeaders(req *prompb.WriteRequest, headers map[string]string) bool {
+	return q.enqueue(queuedRequest{req: req, headers: headers})
+}
+
+func (q *Queue) enqueue(r queuedRequest) bool {
+	select {
+	case q.reqs <- r:
+		q.pendingRequests.Inc()
+		return true
+	default:
+		q.droppedSamples.Add(float64(NumSamples(r.req)))
+		return false
+	}
+}
+
+// Run sends queued write requests until the given context is canceled. Requests still queued at that time are
+// sent once more within a flush timeout.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			q.flush()
+			return
+		case r := <-q.reqs:
+			q.pendingRequests.Dec()
+			q.sendWithRetries(ctx, r)
+		}
+	}
+}
+
+func (q *Queue) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case r := <-q.reqs:
+			q.pendingRequests.Dec()
+			if err := q.send(ctx, r); err != nil {
+				level.Warn(q.logger).Log("msg", "failed to flush remote write request on shutdown", "err", err)
+				q.failedSamples.Add(float64(NumSamples(r.req)))
+			} else {
+				q.sentSamples.Add(float64(NumSamples(r.req)))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (q *Queue) sendWithRetries(ctx context.Context, r queuedRequest) {
+	backoff := minBackoff
+	for {
+		err := q.send(ctx, r)
+		if err == nil {
+			q.sentSamples.Add(float64(NumSamples(r.req)))
+			return
+		}
+		if _, ok := err.(recoverableError); !ok {
+			level.Error(q.logger).Log("msg", "non-recoverable error on remote write, dropping samples", "err", err)
+			q.failedSamples.Add(float64(NumSamples(r.req)))
+			return
+		}
+
+		level.Warn(q.logger).Log("msg", "remote write failed, retrying", "backoff", backoff, "err", err)
+		q.retries.Inc()
+		select {
+		case <-ctx.Done():
+			// Flush will try once more.
+			if q.enqueue(r) {
+				return
+			}
+			q.failedSamples.Add(float64(NumSamples(r.req)))
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send sends the write request to endpoints in randomized order until one of them accepts it.
+func (q *Queue) send(ctx context.Context, r queuedRequest) error {
+	b, err := proto.Marshal(r.req)
+	if err != nil {
+		return errors.Wrap(err, "marshal write request")
+	}
+	compressed := snappy.Encode(nil, b)
+
+	endpoints := q.client.Endpoints()
+	if len(endpoints) == 0 {
+		return recoverableError{errors.New("no remote write endpoint discovered")}
+	}
+
+	for _, i := range rand.Perm(len(endpoints)) {
+		if err = q.sendTo(ctx, endpoints[i].String(), compressed, r.headers); err == nil {
+			return nil
+		}
+		if _, ok := err.(recoverableError); !ok {
+			return err
+		}
+		level.Debug(q.logger).Log("msg", "remote write endpoint failed, trying next one", "endpoint", endpoints[i].String(), "err", err)
+	}
+	return err
+}
+
+func (q *Queue) sendTo(ctx context.Context, endpoint string, compressed []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(compressed))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	httpReq.Header.Add("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range q.headers {
+		httpReq.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := q.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return recoverableError{errors.Wrapf(err, "send request to %s", endpoint)}
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(q.logger, resp.Body, "remote write response body")
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	// Best effort read.
+	body, _ := ioutil.ReadAll(resp.Body)
+	err = errors.Errorf("server %s returned HTTP status %s: %s", endpoint, resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 5 {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// NumSamples returns the number of samples of the given write request.
+func NumSamples(req *prompb.WriteRequest) int {
+	n := 0
+	for _, ts := range req.Timeseries {
+		n += len(ts.Samples)
+	}
+	return n
+}
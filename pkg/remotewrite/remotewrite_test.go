@@ -0,0 +1,160 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package remotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type staticProvider []string
+
+func (p staticProvider) Resolve(context.Context, []string) {}
+func (p staticProvider) Addresses() []string               { return p }
+
+func TestLoadConfigs(t *testing.T) {
+	cfgs, err := LoadConfigs([]byte(`
+- static_configs: ["receive:19291"]
+  headers:
+    THANOS-TENANT: rules
+- name: backup
+  static_configs: ["backup:19291"]
+  path_prefix: /write
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(cfgs))
+	testutil.Equals(t, "0", cfgs[0].Name)
+	testutil.Equals(t, "/api/v1/receive", cfgs[0].EndpointsConfig.PathPrefix)
+	testutil.Equals(t, map[string]string{"THANOS-TENANT": "rules"}, cfgs[0].Headers)
+	testutil.Equals(t, 1000, cfgs[0].QueueCapacity)
+	testutil.Equals(t, "backup", cfgs[1].Name)
+	testutil.Equals(t, "/write", cfgs[1].EndpointsConfig.PathPrefix)
+
+	_, err = LoadConfigs([]byte(`
+- name: a
+- name: a
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestQueue_RetriesRecoverableErrors(t *testing.T) {
+	type received struct {
+		path, tenant, shard string
+		req                 prompb.WriteRequest
+	}
+	var (
+		mtx   sync.Mutex
+		reqs  []received
+		fails = 1
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if fails > 0 {
+			fails--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqs = append(reqs, received{path: r.URL.Path, tenant: r.Header.Get("THANOS-TENANT"), shard: r.Header.Get("X-Shard"), req: req})
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	cfg := DefaultConfig()
+	cfg.Name = "test"
+	cfg.Headers = map[string]string{"THANOS-TENANT": "rules"}
+	client, err := http_util.NewClient(nil, cfg.EndpointsConfig, http.DefaultClient, staticProvider{u.Host})
+	testutil.Ok(t, err)
+
+	q := NewQueue(nil, prometheus.NewRegistry(), "test", cfg, client)
+	testutil.Equals(t, "test", q.Name())
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}},
+	}}
+	testutil.Assert(t, q.EnqueueWithHeaders(&prompb.WriteRequest{Timeseries: series}, map[string]string{"X-Shard": "1"}), "request not enqueued")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	retryCtx, retryCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer retryCancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, retryCtx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(reqs) == 0 {
+			return errors.New("nothing received yet")
+		}
+		return nil
+	}))
+	cancel()
+	<-done
+
+	testutil.Equals(t, []received{{
+		path:   "/api/v1/receive",
+		tenant: "rules",
+		shard:  "1",
+		req:    prompb.WriteRequest{Timeseries: series},
+	}}, reqs)
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(q.sentSamples))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(q.retries))
+}
+
+func TestQueue_DropsRequestsWhenFull(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.QueueCapacity = 1
+	client, err := http_util.NewClient(nil, cfg.EndpointsConfig, http.DefaultClient, staticProvider{})
+	testutil.Ok(t, err)
+
+	q := NewQueue(nil, prometheus.NewRegistry(), "test", cfg, client)
+	req := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}}
+	testutil.Assert(t, q.Enqueue(req), "request not enqueued")
+	testutil.Assert(t, !q.Enqueue(req), "request enqueued to full queue")
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(q.droppedSamples))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(q.pendingRequests))
+}
@@ -31,30 +31,46 @@ import (
 	"github.com/thanos-io/thanos/pkg/server/http"
 )
 
-// ParseFlagMatchers parse flag into matchers.
+// ParseFlagMatchers parse flag into matchers. Matchers have the form key="value", key!="value", key=~"regexp" or
+// key!~"regexp".
 func ParseFlagMatchers(s []string) ([]*labels.Matcher, error) {
 	matchers := make([]*labels.Matcher, 0, len(s))
 
 	for _, l := range s {
-		parts := strings.SplitN(l, "=", 2)
-		if len(parts) != 2 {
+		// Label names cannot contain any of the operator characters.
+		i := strings.IndexAny(l, "=!~")
+		if i < 0 {
+			return nil, errors.Errorf("unrecognized label %q", l)
+		}
+
+		labelName, rest := l[:i], l[i:]
+		var matchType labels.MatchType
+		switch {
+		case strings.HasPrefix(rest, "=~"):
+			matchType, rest = labels.MatchRegexp, rest[2:]
+		case strings.HasPrefix(rest, "!="):
+			matchType, rest = labels.MatchNotEqual, rest[2:]
+		case strings.HasPrefix(rest, "!~"):
+			matchType, rest = labels.MatchNotRegexp, rest[2:]
+		case strings.HasPrefix(rest, "="):
+			matchType, rest = labels.MatchEqual, rest[1:]
+		default:
 			return nil, errors.Errorf("unrecognized label %q", l)
 		}
 
-		labelName := parts[0]
 		if !model.LabelName.IsValid(model.LabelName(labelName)) {
 			return nil, errors.Errorf("unsupported format for label %s", l)
 		}
 
-		labelValue, err := strconv.Unquote(parts[1])
+		labelValue, err := strconv.Unquote(rest)
 		if err != nil {
 			return nil, errors.Wrap(err, "unquote label value")
 		}
-		newEqualMatcher, err := labels.NewMatcher(labels.MatchEqual, labelName, labelValue)
+		matcher, err := labels.NewMatcher(matchType, labelName, labelValue)
 		if err != nil {
-			return nil, errors.Wrap(err, "new equal matcher")
+			return nil, errors.Wrapf(err, "new matcher for label %s", l)
 		}
-		matchers = append(matchers, newEqualMatcher)
+		matchers = append(matchers, matcher)
 	}
 
 	return matchers, nil
@@ -69,8 +85,8 @@ func RunReplicate(
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
 	labelSelector labels.Selector,
-	resolution compact.ResolutionLevel,
-	compaction int,
+	resolutions []compact.ResolutionLevel,
+	compactions []int,
 	fromObjStoreConfig *extflag.PathOrContent,
 	toObjStoreConfig *extflag.PathOrContent,
 	singleRun bool,
@@ -159,10 +175,11 @@ func RunReplicate(
 	blockFilter := NewBlockFilter(
 		logger,
 		labelSelector,
-		resolution,
-		compaction,
+		resolutions,
+		compactions,
 	).Filter
 	metrics := newReplicationMetrics(reg)
+	replicated := map[ulid.ULID]struct{}{}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	replicateFn := func() error {
@@ -177,7 +194,7 @@ func RunReplicate(
 		logger := log.With(logger, "replication-run-id", ulid.String())
 		level.Info(logger).Log("msg", "running replication attempt")
 
-		if err := newReplicationScheme(logger, metrics, blockFilter, fetcher, fromBkt, toBkt, reg).execute(ctx); err != nil {
+		if err := newReplicationScheme(logger, metrics, blockFilter, fetcher, fromBkt, toBkt, replicated, reg).execute(ctx); err != nil {
 			return errors.Wrap(err, "replication execute")
 		}
 
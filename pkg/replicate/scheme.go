@@ -6,6 +6,8 @@ package replicate
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"path"
@@ -27,24 +29,25 @@ import (
 
 // BlockFilter is block filter that filters out compacted and unselected blocks.
 type BlockFilter struct {
-	logger          log.Logger
-	labelSelector   labels.Selector
-	resolutionLevel compact.ResolutionLevel
-	compactionLevel int
+	logger           log.Logger
+	labelSelector    labels.Selector
+	resolutionLevels []compact.ResolutionLevel
+	compactionLevels []int
 }
 
-// NewBlockFilter returns block filter.
+// NewBlockFilter returns block filter. Blocks are selected if they match the label selector and any of the given
+// resolution and compaction levels.
 func NewBlockFilter(
 	logger log.Logger,
 	labelSelector labels.Selector,
-	resolutionLevel compact.ResolutionLevel,
-	compactionLevel int,
+	resolutionLevels []compact.ResolutionLevel,
+	compactionLevels []int,
 ) *BlockFilter {
 	return &BlockFilter{
-		labelSelector:   labelSelector,
-		logger:          logger,
-		resolutionLevel: resolutionLevel,
-		compactionLevel: compactionLevel,
+		labelSelector:    labelSelector,
+		logger:           logger,
+		resolutionLevels: resolutionLevels,
+		compactionLevels: compactionLevels,
 	}
 }
 
@@ -77,20 +80,32 @@ func (bf *BlockFilter) Filter(b *metadata.Meta) bool {
 	}
 
 	gotResolution := compact.ResolutionLevel(b.Thanos.Downsample.Resolution)
-	expectedResolution := bf.resolutionLevel
+	expectedResolutions := bf.resolutionLevels
 
-	resolutionMatch := gotResolution == expectedResolution
+	resolutionMatch := false
+	for _, r := range expectedResolutions {
+		if gotResolution == r {
+			resolutionMatch = true
+			break
+		}
+	}
 	if !resolutionMatch {
-		level.Debug(bf.logger).Log("msg", "filtering block", "reason", "resolutions don't match", "got_resolution", gotResolution, "expected_resolution", expectedResolution)
+		level.Debug(bf.logger).Log("msg", "filtering block", "reason", "resolutions don't match", "got_resolution", gotResolution, "expected_resolutions", fmt.Sprintf("%v", expectedResolutions))
 		return false
 	}
 
 	gotCompactionLevel := b.BlockMeta.Compaction.Level
-	expectedCompactionLevel := bf.compactionLevel
+	expectedCompactionLevels := bf.compactionLevels
 
-	compactionMatch := gotCompactionLevel == expectedCompactionLevel
+	compactionMatch := false
+	for _, l := range expectedCompactionLevels {
+		if gotCompactionLevel == l {
+			compactionMatch = true
+			break
+		}
+	}
 	if !compactionMatch {
-		level.Debug(bf.logger).Log("msg", "filtering block", "reason", "compaction levels don't match", "got_compaction_level", gotCompactionLevel, "expected_compaction_level", expectedCompactionLevel)
+		level.Debug(bf.logger).Log("msg", "filtering block", "reason", "compaction levels don't match", "got_compaction_level", gotCompactionLevel, "expected_compaction_levels", fmt.Sprintf("%v", expectedCompactionLevels))
 		return false
 	}
 
@@ -107,6 +122,10 @@ type replicationScheme struct {
 	blockFilter blockFilterFunc
 	fetcher     thanosblock.MetadataFetcher
 
+	// replicated holds blocks known to be fully replicated to the target bucket. It is shared between runs, so that
+	// blocks replicated by previous runs are skipped without reading their meta file from the target bucket again.
+	replicated map[ulid.ULID]struct{}
+
 	logger  log.Logger
 	metrics *replicationMetrics
 
@@ -160,11 +179,15 @@ func newReplicationScheme(
 	fetcher thanosblock.MetadataFetcher,
 	from objstore.InstrumentedBucketReader,
 	to objstore.Bucket,
+	replicated map[ulid.ULID]struct{},
 	reg prometheus.Registerer,
 ) *replicationScheme {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
+	if replicated == nil {
+		replicated = map[ulid.ULID]struct{}{}
+	}
 
 	return &replicationScheme{
 		logger:      logger,
@@ -172,6 +195,7 @@ func newReplicationScheme(
 		fetcher:     fetcher,
 		fromBkt:     from,
 		toBkt:       to,
+		replicated:  replicated,
 		metrics:     metrics,
 		reg:         reg,
 	}
@@ -236,9 +260,15 @@ func (rs *replicationScheme) execute(ctx context.Context) error {
 	})
 
 	for _, b := range candidateBlocks {
+		if _, ok := rs.replicated[b.BlockMeta.ULID]; ok {
+			level.Debug(rs.logger).Log("msg", "skipping block as replicated by previous run", "block_uuid", b.BlockMeta.ULID.String())
+			rs.metrics.blocksAlreadyReplicated.Inc()
+			continue
+		}
 		if err := rs.ensureBlockIsReplicated(ctx, b.BlockMeta.ULID); err != nil {
 			return errors.Wrapf(err, "ensure block %v is replicated", b.BlockMeta.ULID.String())
 		}
+		rs.replicated[b.BlockMeta.ULID] = struct{}{}
 	}
 
 	return nil
@@ -293,8 +323,18 @@ func (rs *replicationScheme) ensureBlockIsReplicated(ctx context.Context, id uli
 		}
 	}
 
+	// Sizes of the block files are known for blocks uploaded with their file stats.
+	var originMeta metadata.Meta
+	if err := json.Unmarshal(originMetaFileContent, &originMeta); err != nil {
+		return errors.Wrap(err, "unmarshal origin meta file")
+	}
+	expectedSizes := make(map[string]int64, len(originMeta.Thanos.Files))
+	for _, f := range originMeta.Thanos.Files {
+		expectedSizes[path.Join(blockID, f.RelPath)] = f.SizeBytes
+	}
+
 	if err := rs.fromBkt.Iter(ctx, chunksDir, func(objectName string) error {
-		err := rs.ensureObjectReplicated(ctx, objectName)
+		err := rs.ensureObjectReplicated(ctx, objectName, expectedSizes)
 		if err != nil {
 			return errors.Wrapf(err, "replicate object %v", objectName)
 		}
@@ -304,7 +344,7 @@ func (rs *replicationScheme) ensureBlockIsReplicated(ctx context.Context, id uli
 		return err
 	}
 
-	if err := rs.ensureObjectReplicated(ctx, indexFile); err != nil {
+	if err := rs.ensureObjectReplicated(ctx, indexFile, expectedSizes); err != nil {
 		return errors.Wrap(err, "replicate index file")
 	}
 
@@ -320,22 +360,36 @@ func (rs *replicationScheme) ensureBlockIsReplicated(ctx context.Context, id uli
 }
 
 // ensureBlockIsReplicated ensures that an object present in the origin bucket
-// is present in the target bucket.
-func (rs *replicationScheme) ensureObjectReplicated(ctx context.Context, objectName string) error {
+// is present in the target bucket with the same size. If the expected size is not
+// given, the size of the object in the origin bucket is used.
+func (rs *replicationScheme) ensureObjectReplicated(ctx context.Context, objectName string, expectedSizes map[string]int64) error {
 	level.Debug(rs.logger).Log("msg", "ensuring object is replicated", "object", objectName)
 
-	exists, err := rs.toBkt.Exists(ctx, objectName)
-	if err != nil {
+	attrs, err := rs.toBkt.Attributes(ctx, objectName)
+	if err != nil && !rs.toBkt.IsObjNotFoundErr(err) {
 		return errors.Wrapf(err, "check if %v exists in target bucket", objectName)
 	}
 
-	// skip if already exists.
-	if exists {
-		level.Debug(rs.logger).Log("msg", "skipping object as already replicated", "object", objectName)
-		return nil
-	}
+	if err == nil {
+		expectedSize, ok := expectedSizes[objectName]
+		if !ok {
+			size, err := rs.fromBkt.ObjectSize(ctx, objectName)
+			if err != nil {
+				return errors.Wrapf(err, "get size of %v in origin bucket", objectName)
+			}
+			expectedSize = int64(size)
+		}
 
-	level.Debug(rs.logger).Log("msg", "object not present in target bucket, replicating", "object", objectName)
+		// skip if already exists with the expected size.
+		if attrs.Size == expectedSize {
+			level.Debug(rs.logger).Log("msg", "skipping object as already replicated", "object", objectName)
+			return nil
+		}
+		// Objects of different size are left by interrupted replication.
+		level.Info(rs.logger).Log("msg", "object size in target bucket differs, replicating again", "object", objectName, "size", attrs.Size, "expected", expectedSize)
+	} else {
+		level.Debug(rs.logger).Log("msg", "object not present in target bucket, replicating", "object", objectName)
+	}
 
 	r, err := rs.fromBkt.Get(ctx, objectName)
 	if err != nil {
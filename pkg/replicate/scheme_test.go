@@ -11,12 +11,14 @@ import (
 	"math/rand"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/ulid"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -63,10 +65,12 @@ func testMeta(ulid ulid.ULID) *metadata.Meta {
 
 func TestReplicationSchemeAll(t *testing.T) {
 	var cases = []struct {
-		name     string
-		selector labels.Selector
-		prepare  func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket)
-		assert   func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket)
+		name        string
+		selector    labels.Selector
+		resolutions []compact.ResolutionLevel
+		compactions []int
+		prepare     func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket)
+		assert      func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket)
 	}{
 		{
 			name:    "EmptyOrigin",
@@ -245,6 +249,37 @@ func TestReplicationSchemeAll(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:        "MultipleResolutionsAndCompactions",
+			resolutions: []compact.ResolutionLevel{compact.ResolutionLevelRaw, compact.ResolutionLevel5m},
+			compactions: []int{1, 2},
+			prepare: func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket) {
+				for i, m := range []func(*metadata.Meta){
+					func(*metadata.Meta) {},
+					func(m *metadata.Meta) { m.Thanos.Downsample.Resolution = int64(compact.ResolutionLevel5m) },
+					func(m *metadata.Meta) { m.BlockMeta.Compaction.Level = 2 },
+					func(m *metadata.Meta) { m.Thanos.Downsample.Resolution = int64(compact.ResolutionLevel1h) },
+					func(m *metadata.Meta) { m.BlockMeta.Compaction.Level = 3 },
+				} {
+					ulid := testULID(int64(i))
+					meta := testMeta(ulid)
+					m(meta)
+
+					b, err := json.Marshal(meta)
+					testutil.Ok(t, err)
+					_ = originBucket.Upload(ctx, path.Join(ulid.String(), "meta.json"), bytes.NewReader(b))
+					_ = originBucket.Upload(ctx, path.Join(ulid.String(), "chunks", "000001"), bytes.NewReader(nil))
+					_ = originBucket.Upload(ctx, path.Join(ulid.String(), "index"), bytes.NewReader(nil))
+				}
+			},
+			assert: func(ctx context.Context, t *testing.T, originBucket, targetBucket *objstore.InMemBucket) {
+				expected := 9
+				got := len(targetBucket.Objects())
+				if got != expected {
+					t.Fatalf("TargetBucket should have three blocks made up of three objects replicated. Got %d but expected %d objects.", got, expected)
+				}
+			},
+		},
 		{
 			name:     "Regression",
 			selector: labels.Selector{},
@@ -311,7 +346,16 @@ func TestReplicationSchemeAll(t *testing.T) {
 			selector = c.selector
 		}
 
-		filter := NewBlockFilter(logger, selector, compact.ResolutionLevelRaw, 1).Filter
+		resolutions := []compact.ResolutionLevel{compact.ResolutionLevelRaw}
+		if c.resolutions != nil {
+			resolutions = c.resolutions
+		}
+		compactions := []int{1}
+		if c.compactions != nil {
+			compactions = c.compactions
+		}
+
+		filter := NewBlockFilter(logger, selector, resolutions, compactions).Filter
 		fetcher, err := block.NewMetaFetcher(logger, 32, objstore.WithNoopInstr(originBucket), "", nil, nil, nil)
 		testutil.Ok(t, err)
 
@@ -323,6 +367,7 @@ func TestReplicationSchemeAll(t *testing.T) {
 			objstore.WithNoopInstr(originBucket),
 			targetBucket,
 			nil,
+			nil,
 		)
 
 		err = r.execute(ctx)
@@ -331,3 +376,72 @@ func TestReplicationSchemeAll(t *testing.T) {
 		c.assert(ctx, t, originBucket, targetBucket)
 	}
 }
+
+func TestReplicationSchemeSkipsReplicatedBlocks(t *testing.T) {
+	ctx := context.Background()
+	originBucket := objstore.NewInMemBucket()
+	targetBucket := objstore.NewInMemBucket()
+	logger := testLogger(t.Name())
+
+	id := testULID(0)
+	b, err := json.Marshal(testMeta(id))
+	testutil.Ok(t, err)
+	testutil.Ok(t, originBucket.Upload(ctx, path.Join(id.String(), "meta.json"), bytes.NewReader(b)))
+	testutil.Ok(t, originBucket.Upload(ctx, path.Join(id.String(), "chunks", "000001"), bytes.NewReader(nil)))
+	testutil.Ok(t, originBucket.Upload(ctx, path.Join(id.String(), "index"), bytes.NewReader(nil)))
+
+	filter := NewBlockFilter(logger, labels.Selector{}, []compact.ResolutionLevel{compact.ResolutionLevelRaw}, []int{1}).Filter
+	fetcher, err := block.NewMetaFetcher(logger, 32, objstore.WithNoopInstr(originBucket), "", nil, nil, nil)
+	testutil.Ok(t, err)
+
+	metrics := newReplicationMetrics(nil)
+	replicated := map[ulid.ULID]struct{}{}
+	for i := 0; i < 2; i++ {
+		r := newReplicationScheme(logger, metrics, filter, fetcher, objstore.WithNoopInstr(originBucket), targetBucket, replicated, nil)
+		testutil.Ok(t, r.execute(ctx))
+	}
+	testutil.Equals(t, 3, len(targetBucket.Objects()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(metrics.blocksReplicated))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(metrics.blocksAlreadyReplicated))
+
+	// Blocks replicated by previous runs are not checked in the target bucket again.
+	testutil.Ok(t, targetBucket.Delete(ctx, path.Join(id.String(), "meta.json")))
+	r := newReplicationScheme(logger, metrics, filter, fetcher, objstore.WithNoopInstr(originBucket), targetBucket, replicated, nil)
+	testutil.Ok(t, r.execute(ctx))
+	testutil.Equals(t, 2, len(targetBucket.Objects()))
+
+	// Without previous runs, the block is replicated again.
+	r = newReplicationScheme(logger, metrics, filter, fetcher, objstore.WithNoopInstr(originBucket), targetBucket, nil, nil)
+	testutil.Ok(t, r.execute(ctx))
+	testutil.Equals(t, 3, len(targetBucket.Objects()))
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(metrics.blocksReplicated))
+}
+
+func TestParseFlagMatchers(t *testing.T) {
+	for _, tcase := range []struct {
+		input    []string
+		expected string
+		err      bool
+	}{
+		{input: []string{`a="1"`}, expected: `{a="1"}`},
+		{input: []string{`a!="1"`, `b=~"2|3"`, `c!~"4.*"`}, expected: `{a!="1", b=~"2|3", c!~"4.*"}`},
+		{input: []string{`a="1=2"`}, expected: `{a="1=2"}`},
+		{input: []string{`a`}, err: true},
+		{input: []string{`a=1`}, err: true},
+		{input: []string{`a-b="1"`}, err: true},
+		{input: []string{`a=~"("`}, err: true},
+	} {
+		matchers, err := ParseFlagMatchers(tcase.input)
+		if tcase.err {
+			testutil.NotOk(t, err)
+			continue
+		}
+		testutil.Ok(t, err)
+
+		var strs []string
+		for _, m := range matchers {
+			strs = append(strs, m.String())
+		}
+		testutil.Equals(t, tcase.expected, "{"+strings.Join(strs, ", ")+"}")
+	}
+}
@@ -77,6 +77,8 @@ func (api *API) rules(r *http.Request) (interface{}, []error, *qapi.ApiError) {
 			Interval:                grp.Interval().Seconds(),
 			Rules:                   []rule{},
 			PartialResponseStrategy: grp.PartialResponseStrategy.String(),
+			EvaluationTime:          grp.GetEvaluationDuration().Seconds(),
+			LastEvaluation:          grp.GetEvaluationTimestamp(),
 		}
 
 		for _, r := range grp.Rules() {
@@ -98,17 +100,21 @@ func (api *API) rules(r *http.Request) (interface{}, []error, *qapi.ApiError) {
 					Alerts:                  rulesAlertsToAPIAlerts(grp.PartialResponseStrategy, rule.ActiveAlerts()),
 					Health:                  rule.Health(),
 					LastError:               lastError,
+					EvaluationTime:          rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation:          rule.GetEvaluationTimestamp(),
 					Type:                    "alerting",
 					PartialResponseStrategy: grp.PartialResponseStrategy.String(),
 				}
 			case *rules.RecordingRule:
 				enrichedRule = recordingRule{
-					Name:      rule.Name(),
-					Query:     rule.Query().String(),
-					Labels:    rule.Labels(),
-					Health:    rule.Health(),
-					LastError: lastError,
-					Type:      "recording",
+					Name:           rule.Name(),
+					Query:          rule.Query().String(),
+					Labels:         rule.Labels(),
+					Health:         rule.Health(),
+					LastError:      lastError,
+					EvaluationTime: rule.GetEvaluationDuration().Seconds(),
+					LastEvaluation: rule.GetEvaluationTimestamp(),
+					Type:           "recording",
 				}
 			default:
 				err := errors.Errorf("rule %q: unsupported type %T", r.Name(), rule)
@@ -124,7 +130,7 @@ func (api *API) rules(r *http.Request) (interface{}, []error, *qapi.ApiError) {
 }
 
 func (api *API) alerts(r *http.Request) (interface{}, []error, *qapi.ApiError) {
-	var alerts []*Alert
+	alerts := []*Alert{}
 	for _, alertingRule := range api.ruleRetriever.AlertingRules() {
 		alerts = append(
 			alerts,
@@ -175,9 +181,11 @@ type RuleGroup struct {
 	// In order to preserve rule ordering, while exposing type (alerting or recording)
 	// specific properties, both alerting and recording rules are exposed in the
 	// same array.
-	Rules                   []rule  `json:"rules"`
-	Interval                float64 `json:"interval"`
-	PartialResponseStrategy string  `json:"partial_response_strategy"`
+	Rules                   []rule    `json:"rules"`
+	Interval                float64   `json:"interval"`
+	EvaluationTime          float64   `json:"evaluationTime"`
+	LastEvaluation          time.Time `json:"lastEvaluation"`
+	PartialResponseStrategy string    `json:"partial_response_strategy"`
 }
 
 type rule interface{}
@@ -191,16 +199,20 @@ type alertingRule struct {
 	Alerts                  []*Alert         `json:"alerts"`
 	Health                  rules.RuleHealth `json:"health"`
 	LastError               string           `json:"lastError,omitempty"`
+	EvaluationTime          float64          `json:"evaluationTime"`
+	LastEvaluation          time.Time        `json:"lastEvaluation"`
 	Type                    string           `json:"type"`
 	PartialResponseStrategy string           `json:"partial_response_strategy"`
 }
 
 type recordingRule struct {
-	Name      string           `json:"name"`
-	Query     string           `json:"query"`
-	Labels    labels.Labels    `json:"labels,omitempty"`
-	Health    rules.RuleHealth `json:"health"`
-	LastError string           `json:"lastError,omitempty"`
+	Name           string           `json:"name"`
+	Query          string           `json:"query"`
+	Labels         labels.Labels    `json:"labels,omitempty"`
+	Health         rules.RuleHealth `json:"health"`
+	LastError      string           `json:"lastError,omitempty"`
+	EvaluationTime float64          `json:"evaluationTime"`
+	LastEvaluation time.Time        `json:"lastEvaluation"`
 	// Type of a recordingRule is always "recording".
 	Type string `json:"type"`
 }
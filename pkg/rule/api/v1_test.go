@@ -235,6 +235,11 @@ func testEndpoints(t *testing.T, api *API) {
 				},
 			},
 		},
+		{
+			endpointFn:   api.alerts,
+			endpointName: "alerts",
+			response:     &AlertDiscovery{Alerts: []*Alert{}},
+		},
 	}
 
 	methods := func(f qapi.ApiFunc) []string {
@@ -0,0 +1,177 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package thanosrule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// RemoteQueryable is a storage.Queryable selecting series through the query API servers of QueryEndpoints. It allows
+// the rule manager to restore the `for` state of alerts from ALERTS_FOR_STATE series when the ruler has no local
+// TSDB, e.g. in stateless mode.
+type RemoteQueryable struct {
+	logger         log.Logger
+	endpoints      *QueryEndpoints
+	externalLabels labels.Labels
+}
+
+// NewRemoteQueryable returns a RemoteQueryable of the given endpoints. The given external labels of the ruler are
+// removed from selected series, so that they match the series written by the rule manager.
+func NewRemoteQueryable(logger log.Logger, endpoints *QueryEndpoints, externalLabels labels.Labels) *RemoteQueryable {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &RemoteQueryable{logger: logger, endpoints: endpoints, externalLabels: externalLabels}
+}
+
+// Querier implements the storage.Queryable interface.
+func (q *RemoteQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &remoteQuerier{ctx: ctx, q: q, mint: mint, maxt: maxt}, nil
+}
+
+type remoteQuerier struct {
+	ctx        context.Context
+	q          *RemoteQueryable
+	mint, maxt int64
+}
+
+// Select selects series matching the given matchers within the time range of the querier with an instant query of
+// a range selector. Stale markers are not returned by the query API, so the last sample of a series is always treated
+// as a regular one.
+func (q *remoteQuerier) Select(_ *storage.SelectParams, ms ...*labels.Matcher) (storage.SeriesSet, storage.Warnings, error) {
+	if q.maxt <= q.mint {
+		return newMatrixSeriesSet(nil, nil), nil, nil
+	}
+
+	selectors := make([]string, 0, len(ms))
+	for _, m := range ms {
+		selectors = append(selectors, m.String())
+	}
+	query := fmt.Sprintf("{%s}[%dms]", strings.Join(selectors, ","), q.maxt-q.mint)
+	t := time.Unix(0, q.maxt*int64(time.Millisecond)).UTC()
+
+	var err error
+	for _, e := range q.q.endpoints.Endpoints() {
+		var (
+			m     model.Matrix
+			warns []string
+		)
+		m, warns, err = promclient.NewClient(q.q.logger, e.Client).QueryInstantMatrix(q.ctx, e.URL, query, t, promclient.QueryOptions{
+			Deduplicate:             true,
+			PartialResponseStrategy: storepb.PartialResponseStrategy_WARN,
+		})
+		q.q.endpoints.Report(e.URL, err)
+		if err != nil {
+			level.Warn(q.q.logger).Log("msg", "selecting series failed", "err", err, "query", query, "endpoint", e.URL.String())
+			continue
+		}
+
+		var warnings storage.Warnings
+		for _, w := range warns {
+			warnings = append(warnings, errors.New(w))
+		}
+		return newMatrixSeriesSet(m, q.q.externalLabels), warnings, nil
+	}
+	if err == nil {
+		return nil, nil, errors.New("no query API server discovered")
+	}
+	return nil, nil, errors.Wrap(err, "no query API server reachable")
+}
+
+// LabelValues implements the storage.Querier interface. It is not used by the rule manager.
+func (q *remoteQuerier) LabelValues(string) ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+// LabelNames implements the storage.Querier interface. It is not used by the rule manager.
+func (q *remoteQuerier) LabelNames() ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (q *remoteQuerier) Close() error { return nil }
+
+type matrixSeriesSet struct {
+	series []*matrixSeries
+	i      int
+}
+
+func newMatrixSeriesSet(m model.Matrix, externalLabels labels.Labels) *matrixSeriesSet {
+	s := &matrixSeriesSet{i: -1}
+	for _, ss := range m {
+		lset := make(labels.Labels, 0, len(ss.Metric))
+		for n, v := range ss.Metric {
+			if externalLabels.Get(string(n)) == string(v) {
+				continue
+			}
+			lset = append(lset, labels.Label{Name: string(n), Value: string(v)})
+		}
+		sort.Sort(lset)
+		s.series = append(s.series, &matrixSeries{lset: lset, samples: ss.Values})
+	}
+	sort.Slice(s.series, func(i, j int) bool {
+		return labels.Compare(s.series[i].lset, s.series[j].lset) < 0
+	})
+	return s
+}
+
+func (s *matrixSeriesSet) Next() bool {
+	s.i++
+	return s.i < len(s.series)
+}
+
+func (s *matrixSeriesSet) At() storage.Series { return s.series[s.i] }
+func (s *matrixSeriesSet) Err() error         { return nil }
+
+type matrixSeries struct {
+	lset    labels.Labels
+	samples []model.SamplePair
+}
+
+func (s *matrixSeries) Labels() labels.Labels { return s.lset }
+
+func (s *matrixSeries) Iterator() storage.SeriesIterator {
+	return &samplePairIterator{samples: s.samples, i: -1}
+}
+
+type samplePairIterator struct {
+	samples []model.SamplePair
+	i       int
+}
+
+func (it *samplePairIterator) Seek(t int64) bool {
+	if it.i < 0 {
+		it.i = 0
+	}
+	for ; it.i < len(it.samples); it.i++ {
+		if int64(it.samples[it.i].Timestamp) >= t {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *samplePairIterator) At() (int64, float64) {
+	return int64(it.samples[it.i].Timestamp), float64(it.samples[it.i].Value)
+}
+
+func (it *samplePairIterator) Next() bool {
+	it.i++
+	return it.i < len(it.samples)
+}
+
+func (it *samplePairIterator) Err() error { return nil }
@@ -0,0 +1,62 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package thanosrule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRemoteQueryable_Select(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/query", r.URL.Path)
+		testutil.Equals(t, `{__name__="ALERTS_FOR_STATE",alertname="Test"}[3600000ms]`, r.URL.Query().Get("query"))
+		testutil.Equals(t, "1970-01-01T02:00:00Z", r.URL.Query().Get("time"))
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"__name__":"ALERTS_FOR_STATE","alertname":"Test","cluster":"eu","severity":"page"},"values":[[6000,"100"],[7000,"100"]]}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	c, err := http_util.NewClient(nil, http_util.EndpointsConfig{Scheme: "http"}, http.DefaultClient, staticProvider{u.Host})
+	testutil.Ok(t, err)
+	endpoints := NewQueryEndpoints(nil, prometheus.NewRegistry(), []*http_util.Client{c}, prometheus.NewCounter(prometheus.CounterOpts{}))
+
+	q, err := NewRemoteQueryable(nil, endpoints, labels.FromStrings("cluster", "eu")).Querier(context.Background(), 3600*1000, 7200*1000)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	set, _, err := q.Select(nil,
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", "ALERTS_FOR_STATE"),
+		labels.MustNewMatcher(labels.MatchEqual, "alertname", "Test"),
+	)
+	testutil.Ok(t, err)
+
+	testutil.Assert(t, set.Next(), "expected series")
+	// External labels of the ruler are removed.
+	testutil.Equals(t, labels.FromStrings("__name__", "ALERTS_FOR_STATE", "alertname", "Test", "severity", "page"), set.At().Labels())
+
+	var samples [][2]float64
+	it := set.At().Iterator()
+	for it.Next() {
+		ts, v := it.At()
+		samples = append(samples, [2]float64{float64(ts), v})
+	}
+	testutil.Ok(t, it.Err())
+	testutil.Equals(t, [][2]float64{{6000000, 100}, {7000000, 100}}, samples)
+
+	testutil.Assert(t, !set.Next(), "expected single series")
+	testutil.Ok(t, set.Err())
+}
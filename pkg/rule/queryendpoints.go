@@ -0,0 +1,183 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package thanosrule
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// QueryEndpoint is a query API server together with the client of the configuration it was discovered by.
+type QueryEndpoint struct {
+	URL    *url.URL
+	Client *http_util.Client
+}
+
+// QueryEndpoints tracks the health of query API servers the ruler evaluates rules against. Endpoints are
+// unhealthy from a query failing on their side or a failed health check until the next successful health check.
+type QueryEndpoints struct {
+	logger  log.Logger
+	clients []*http_util.Client
+
+	mtx       sync.Mutex
+	unhealthy map[string]struct{}
+
+	duplicatedQuery prometheus.Counter
+	queries         *prometheus.CounterVec
+	queryFailures   *prometheus.CounterVec
+	healthy         *prometheus.GaugeVec
+}
+
+// NewQueryEndpoints returns QueryEndpoints of the given query API clients.
+func NewQueryEndpoints(logger log.Logger, reg prometheus.Registerer, clients []*http_util.Client, duplicatedQuery prometheus.Counter) *QueryEndpoints {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &QueryEndpoints{
+		logger:          logger,
+		clients:         clients,
+		unhealthy:       map[string]struct{}{},
+		duplicatedQuery: duplicatedQuery,
+		queries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_query_endpoint_queries_total",
+			Help: "Total number of rule evaluation queries sent to a query API server.",
+		}, []string{"endpoint"}),
+		queryFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_rule_query_endpoint_query_failures_total",
+			Help: "Total number of failed rule evaluation queries sent to a query API server.",
+		}, []string{"endpoint"}),
+		healthy: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_rule_query_endpoint_healthy",
+			Help: "Whether a query API server is considered healthy and used for rule evaluations.",
+		}, []string{"endpoint"}),
+	}
+}
+
+// Endpoints returns the currently discovered, deduplicated endpoints in the order they should be tried in. Healthy
+// endpoints are shuffled to spread evaluations across them. Unhealthy endpoints are only returned, again shuffled,
+// if no endpoint is healthy.
+func (e *QueryEndpoints) Endpoints() []QueryEndpoint {
+	var (
+		seen               = map[string]struct{}{}
+		healthy, unhealthy []QueryEndpoint
+	)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for _, c := range e.clients {
+		for _, u := range c.Endpoints() {
+			if _, ok := seen[u.String()]; ok {
+				level.Warn(e.logger).Log("msg", "duplicate query address is provided", "address", u.String())
+				e.duplicatedQuery.Inc()
+				continue
+			}
+			seen[u.String()] = struct{}{}
+
+			if _, ok := e.unhealthy[u.String()]; ok {
+				unhealthy = append(unhealthy, QueryEndpoint{URL: u, Client: c})
+				continue
+			}
+			healthy = append(healthy, QueryEndpoint{URL: u, Client: c})
+		}
+	}
+
+	if len(healthy) == 0 {
+		healthy = unhealthy
+	}
+	rand.Shuffle(len(healthy), func(i, j int) { healthy[i], healthy[j] = healthy[j], healthy[i] })
+	return healthy
+}
+
+// Report records the result of a query sent to the given endpoint. Endpoints are unhealthy until their next
+// successful health check if the query failed to reach them or they responded with a server error. Queries
+// rejected with a client error, e.g. an invalid expression, or canceled by the caller do not affect health.
+func (e *QueryEndpoints) Report(u *url.URL, err error) {
+	e.queries.WithLabelValues(u.Host).Inc()
+	if err == nil {
+		return
+	}
+	e.queryFailures.WithLabelValues(u.Host).Inc()
+	if isEndpointFailure(err) {
+		e.setHealthy(u, false)
+	}
+}
+
+func isEndpointFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var serr *promclient.StatusError
+	if errors.As(err, &serr) {
+		return serr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// CheckHealth checks the health endpoint of all discovered query API servers.
+func (e *QueryEndpoints) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range e.clients {
+		for _, u := range c.Endpoints() {
+			wg.Add(1)
+			go func(c *http_util.Client, u *url.URL) {
+				defer wg.Done()
+
+				err := checkHealth(ctx, e.logger, c, u)
+				if err != nil {
+					level.Warn(e.logger).Log("msg", "query API server health check failed", "endpoint", u.String(), "err", err)
+				}
+				e.setHealthy(u, err == nil)
+			}(c, u)
+		}
+	}
+	wg.Wait()
+}
+
+func (e *QueryEndpoints) setHealthy(u *url.URL, healthy bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if healthy {
+		delete(e.unhealthy, u.String())
+		e.healthy.WithLabelValues(u.Host).Set(1)
+		return
+	}
+	e.unhealthy[u.String()] = struct{}{}
+	e.healthy.WithLabelValues(u.Host).Set(0)
+}
+
+func checkHealth(ctx context.Context, logger log.Logger, c *http_util.Client, base *url.URL) error {
+	u := *base
+	u.Path = path.Join(u.Path, "/-/healthy")
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "request health of %s", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(logger, resp.Body, "health check body")
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("got non-200 response code: %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package thanosrule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type staticProvider []string
+
+func (p staticProvider) Resolve(context.Context, []string) {}
+func (p staticProvider) Addresses() []string               { return p }
+
+func endpointHosts(endpoints []QueryEndpoint) []string {
+	var hosts []string
+	for _, e := range endpoints {
+		hosts = append(hosts, e.URL.Host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func TestQueryEndpoints(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/-/healthy", r.URL.Path)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not healthy", http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	healthyURL, err := url.Parse(healthy.URL)
+	testutil.Ok(t, err)
+	unhealthyURL, err := url.Parse(unhealthy.URL)
+	testutil.Ok(t, err)
+
+	cfg := http_util.EndpointsConfig{Scheme: "http"}
+	c1, err := http_util.NewClient(nil, cfg, http.DefaultClient, staticProvider{healthyURL.Host, unhealthyURL.Host})
+	testutil.Ok(t, err)
+	c2, err := http_util.NewClient(nil, cfg, http.DefaultClient, staticProvider{healthyURL.Host})
+	testutil.Ok(t, err)
+
+	duplicated := prometheus.NewCounter(prometheus.CounterOpts{})
+	e := NewQueryEndpoints(nil, prometheus.NewRegistry(), []*http_util.Client{c1, c2}, duplicated)
+
+	// Initially all endpoints are tried, duplicates only once.
+	testutil.Equals(t, []string{healthyURL.Host, unhealthyURL.Host}, endpointHosts(e.Endpoints()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(duplicated))
+
+	e.CheckHealth(context.Background())
+	testutil.Equals(t, []string{healthyURL.Host}, endpointHosts(e.Endpoints()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(e.healthy.WithLabelValues(healthyURL.Host)))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(e.healthy.WithLabelValues(unhealthyURL.Host)))
+
+	// Unhealthy endpoints are used if there is no healthy one left.
+	e.Report(healthyURL, errors.New("query failed"))
+	testutil.Equals(t, []string{healthyURL.Host, unhealthyURL.Host}, endpointHosts(e.Endpoints()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(e.queryFailures.WithLabelValues(healthyURL.Host)))
+
+	// Successful health check brings the endpoint back.
+	e.CheckHealth(context.Background())
+	testutil.Equals(t, []string{healthyURL.Host}, endpointHosts(e.Endpoints()))
+
+	e.Report(healthyURL, nil)
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(e.queries.WithLabelValues(healthyURL.Host)))
+}
+
+func TestQueryEndpoints_Report(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		err       error
+		unhealthy bool
+	}{
+		{name: "transport error", err: errors.Wrap(&url.Error{Op: "Get", URL: "http://a", Err: errors.New("connection refused")}, "perform GET request"), unhealthy: true},
+		{name: "server error", err: errors.Wrap(&promclient.StatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}, "query"), unhealthy: true},
+		{name: "client error", err: &promclient.StatusError{StatusCode: http.StatusBadRequest, Err: errors.New("bad_data")}},
+		{name: "canceled", err: errors.Wrap(&url.Error{Op: "Get", URL: "http://a", Err: context.Canceled}, "perform GET request")},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			u := &url.URL{Scheme: "http", Host: "a"}
+			c, err := http_util.NewClient(nil, http_util.EndpointsConfig{Scheme: "http"}, http.DefaultClient, staticProvider{u.Host})
+			testutil.Ok(t, err)
+
+			e := NewQueryEndpoints(nil, nil, []*http_util.Client{c}, prometheus.NewCounter(prometheus.CounterOpts{}))
+			e.Report(u, tcase.err)
+			testutil.Equals(t, 1.0, promtestutil.ToFloat64(e.queryFailures.WithLabelValues(u.Host)))
+
+			_, unhealthy := e.unhealthy[u.String()]
+			testutil.Equals(t, tcase.unhealthy, unhealthy)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package remotewrite implements the storage of the stateless ruler, which remote-writes evaluation results,
+// including ALERTS and ALERTS_FOR_STATE series, instead of storing them in a local TSDB.
+package remotewrite
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/remotewrite"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// Storage implements storage.Storage for the stateless ruler. Committed samples are extended with the external
+// labels of the ruler and enqueued to all remote write queues. Queries are delegated to a queryable, e.g. one
+// reading the remote-written series back, to restore the state of alerts.
+type Storage struct {
+	externalLabels labels.Labels
+	queues         []*remotewrite.Queue
+	queryable      storage.Queryable
+}
+
+// NewStorage returns a new Storage writing to the given queues. If queryable is nil, querying returns no data.
+func NewStorage(externalLabels labels.Labels, queues []*remotewrite.Queue, queryable storage.Queryable) *Storage {
+	return &Storage{externalLabels: externalLabels, queues: queues, queryable: queryable}
+}
+
+// StartTime implements the storage.Storage interface.
+func (s *Storage) StartTime() (int64, error) {
+	return int64(model.Latest), nil
+}
+
+// Querier implements the storage.Storage interface.
+func (s *Storage) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	if s.queryable == nil {
+		return storage.NoopQuerier(), nil
+	}
+	return s.queryable.Querier(ctx, mint, maxt)
+}
+
+// Appender implements the storage.Storage interface.
+func (s *Storage) Appender() (storage.Appender, error) {
+	return &appender{s: s, series: map[uint64]*prompb.TimeSeries{}}, nil
+}
+
+// Close implements the storage.Storage interface. Pending samples are flushed by the queues.
+func (s *Storage) Close() error {
+	return nil
+}
+
+type appender struct {
+	s      *Storage
+	series map[uint64]*prompb.TimeSeries
+	order  []uint64
+}
+
+func (a *appender) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	ref := l.Hash()
+	ts, ok := a.series[ref]
+	if !ok {
+		ts = &prompb.TimeSeries{Labels: a.s.seriesLabels(l)}
+		a.series[ref] = ts
+		a.order = append(a.order, ref)
+	}
+	ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t, Value: v})
+	return ref, nil
+}
+
+func (a *appender) AddFast(ref uint64, t int64, v float64) error {
+	ts, ok := a.series[ref]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t, Value: v})
+	return nil
+}
+
+func (a *appender) Commit() error {
+	if len(a.order) == 0 {
+		return nil
+	}
+
+	req := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(a.order))}
+	for _, ref := range a.order {
+		req.Timeseries = append(req.Timeseries, *a.series[ref])
+	}
+	a.series, a.order = map[uint64]*prompb.TimeSeries{}, nil
+
+	var full []string
+	for _, q := range a.s.queues {
+		if !q.Enqueue(req) {
+			full = append(full, q.Name())
+		}
+	}
+	if len(full) > 0 {
+		return errors.Errorf("remote write queues %v are full, dropped %d samples", full, remotewrite.NumSamples(req))
+	}
+	return nil
+}
+
+func (a *appender) Rollback() error {
+	a.series, a.order = map[uint64]*prompb.TimeSeries{}, nil
+	return nil
+}
+
+// seriesLabels returns the given labels extended with the external labels. Labels of the series take precedence.
+func (s *Storage) seriesLabels(l labels.Labels) []prompb.Label {
+	b := labels.NewBuilder(l)
+	for _, el := range s.externalLabels {
+		if l.Get(el.Name) == "" {
+			b.Set(el.Name, el.Value)
+		}
+	}
+	lset := b.Labels()
+
+	res := make([]prompb.Label, 0, len(lset))
+	for _, l := range lset {
+		res = append(res, prompb.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
@@ -0,0 +1,132 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package remotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/remotewrite"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type staticProvider []string
+
+func (p staticProvider) Resolve(context.Context, []string) {}
+func (p staticProvider) Addresses() []string               { return p }
+
+func TestStorage_RemoteWritesCommittedSamples(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		received []prompb.TimeSeries
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, req.Timeseries...)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	cfg := remotewrite.DefaultConfig()
+	client, err := http_util.NewClient(nil, cfg.EndpointsConfig, http.DefaultClient, staticProvider{u.Host})
+	testutil.Ok(t, err)
+
+	q := remotewrite.NewQueue(nil, prometheus.NewRegistry(), "test", cfg, client)
+	s := NewStorage(labels.FromStrings("replica", "a", "rule", "ext"), []*remotewrite.Queue{q}, nil)
+
+	app, err := s.Appender()
+	testutil.Ok(t, err)
+	ref, err := app.Add(labels.FromStrings("__name__", "ALERTS", "alertname", "Test", "rule", "own"), 1000, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.AddFast(ref, 2000, 1))
+	testutil.Ok(t, app.Commit())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	retryCtx, retryCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer retryCancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, retryCtx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(received) == 0 {
+			return errors.New("nothing received yet")
+		}
+		return nil
+	}))
+	cancel()
+	<-done
+
+	testutil.Equals(t, []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "ALERTS"},
+				{Name: "alertname", Value: "Test"},
+				{Name: "replica", Value: "a"},
+				{Name: "rule", Value: "own"},
+			},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}},
+		},
+	}, received)
+}
+
+func TestStorage_DropsSamplesWhenQueueIsFull(t *testing.T) {
+	cfg := remotewrite.DefaultConfig()
+	cfg.QueueCapacity = 1
+	client, err := http_util.NewClient(nil, cfg.EndpointsConfig, http.DefaultClient, staticProvider{})
+	testutil.Ok(t, err)
+
+	q := remotewrite.NewQueue(nil, prometheus.NewRegistry(), "test", cfg, client)
+	s := NewStorage(nil, []*remotewrite.Queue{q}, nil)
+
+	for i, expectErr := range []bool{false, true} {
+		app, err := s.Appender()
+		testutil.Ok(t, err)
+		_, err = app.Add(labels.FromStrings("__name__", "up"), int64(i), 1)
+		testutil.Ok(t, err)
+		if expectErr {
+			testutil.NotOk(t, app.Commit())
+			continue
+		}
+		testutil.Ok(t, app.Commit())
+	}
+}
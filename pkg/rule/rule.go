@@ -9,14 +9,18 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/rules"
 	tsdberrors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"gopkg.in/yaml.v2"
 )
@@ -93,6 +97,108 @@ func (m *Manager) AlertingRules() []AlertingRule {
 	return res
 }
 
+// Rules implements rulespb.RulesServer. It streams the rule groups of all managers, restricted to rules of the
+// requested type.
+func (m *Manager) Rules(r *rulespb.RulesRequest, s rulespb.Rules_RulesServer) error {
+	groups := m.RuleGroups()
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].OriginalFile() != groups[j].OriginalFile() {
+			return groups[i].OriginalFile() < groups[j].OriginalFile()
+		}
+		return groups[i].Name() < groups[j].Name()
+	})
+
+	for _, grp := range groups {
+		g, err := toProtoGroup(grp, r.Type)
+		if err != nil {
+			return err
+		}
+		if err := s.Send(rulespb.NewRuleGroupRulesResponse(g)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toProtoGroup(grp Group, t rulespb.RulesRequest_Type) (*rulespb.RuleGroup, error) {
+	g := &rulespb.RuleGroup{
+		Name:                    grp.Name(),
+		File:                    grp.OriginalFile(),
+		Interval:                grp.Interval().Seconds(),
+		EvaluationDuration:      grp.GetEvaluationDuration().Seconds(),
+		LastEvaluation:          timestampMs(grp.GetEvaluationTimestamp()),
+		PartialResponseStrategy: grp.PartialResponseStrategy,
+	}
+
+	for _, r := range grp.Rules() {
+		pr := &rulespb.Rule{
+			Name:               r.Name(),
+			Labels:             storepb.LabelSet{Labels: storepb.PromLabelsToLabels(r.Labels())},
+			Health:             toProtoHealth(r.Health()),
+			EvaluationDuration: r.GetEvaluationDuration().Seconds(),
+			LastEvaluation:     timestampMs(r.GetEvaluationTimestamp()),
+		}
+		if r.LastError() != nil {
+			pr.LastError = r.LastError().Error()
+		}
+
+		switch rule := r.(type) {
+		case *rules.AlertingRule:
+			pr.Type = rulespb.Rule_ALERTING
+			pr.Query = rule.Query().String()
+			pr.Duration = rule.Duration().Seconds()
+			pr.Annotations = storepb.LabelSet{Labels: storepb.PromLabelsToLabels(rule.Annotations())}
+			for _, a := range rule.ActiveAlerts() {
+				pr.Alerts = append(pr.Alerts, &rulespb.AlertInstance{
+					Labels:      storepb.LabelSet{Labels: storepb.PromLabelsToLabels(a.Labels)},
+					Annotations: storepb.LabelSet{Labels: storepb.PromLabelsToLabels(a.Annotations)},
+					State:       toProtoAlertState(a.State),
+					ActiveAt:    timestampMs(a.ActiveAt),
+					Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+				})
+			}
+		case *rules.RecordingRule:
+			pr.Type = rulespb.Rule_RECORDING
+			pr.Query = rule.Query().String()
+		default:
+			return nil, errors.Errorf("rule %q: unsupported type %T", r.Name(), rule)
+		}
+
+		if !t.Matches(pr.Type) {
+			continue
+		}
+		g.Rules = append(g.Rules, pr)
+	}
+	return g, nil
+}
+
+func toProtoHealth(h rules.RuleHealth) rulespb.Rule_Health {
+	switch h {
+	case rules.HealthGood:
+		return rulespb.Rule_OK
+	case rules.HealthBad:
+		return rulespb.Rule_ERR
+	}
+	return rulespb.Rule_UNKNOWN
+}
+
+func toProtoAlertState(s rules.AlertState) rulespb.AlertInstance_State {
+	switch s {
+	case rules.StatePending:
+		return rulespb.AlertInstance_PENDING
+	case rules.StateFiring:
+		return rulespb.AlertInstance_FIRING
+	}
+	return rulespb.AlertInstance_INACTIVE
+}
+
+func timestampMs(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return timestamp.FromTime(t)
+}
+
 func (r *RuleGroup) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	rs := struct {
 		String string `yaml:"partial_response_strategy"`
@@ -142,49 +248,42 @@ func (r RuleGroup) MarshalYAML() (interface{}, error) {
 }
 
 // Update updates rules from given files to all managers we hold. We decide which groups should go where, based on
-// special field in RuleGroup file.
+// special field in RuleGroup file. All files are validated first; if any of them is invalid, none of the changes
+// are applied and the previously loaded rules stay active.
 func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 	var (
 		errs            tsdberrors.MultiError
+		groupsByFile    = map[string]map[storepb.PartialResponseStrategy]*rulefmt.RuleGroups{}
 		filesByStrategy = map[storepb.PartialResponseStrategy][]string{}
 		ruleFiles       = map[string]string{}
 	)
 
-	if err := os.RemoveAll(m.workDir); err != nil {
-		return errors.Wrapf(err, "failed to remove %s", m.workDir)
-	}
-	if err := os.MkdirAll(m.workDir, os.ModePerm); err != nil {
-		return errors.Wrapf(err, "failed to create %s", m.workDir)
-	}
-
 	for _, fn := range files {
-		b, err := ioutil.ReadFile(fn)
+		groupsByStrategy, err := m.loadFile(fn)
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
+		groupsByFile[fn] = groupsByStrategy
+	}
+	if err := errs.Err(); err != nil {
+		return errors.Wrap(err, "invalid rule files, keeping previously loaded rules")
+	}
 
-		var rg RuleGroups
-		if err := yaml.Unmarshal(b, &rg); err != nil {
-			errs = append(errs, errors.Wrap(err, fn))
-			continue
-		}
-
-		// NOTE: This is very ugly, but we need to reparse it into tmp dir without the field to have to reuse
-		// rules.Manager. The problem is that it uses yaml.UnmarshalStrict for some reasons.
-		groupsByStrategy := map[storepb.PartialResponseStrategy]*rulefmt.RuleGroups{}
-		for _, rg := range rg.Groups {
-			if _, ok := groupsByStrategy[*rg.PartialResponseStrategy]; !ok {
-				groupsByStrategy[*rg.PartialResponseStrategy] = &rulefmt.RuleGroups{}
-			}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
 
-			groupsByStrategy[*rg.PartialResponseStrategy].Groups = append(
-				groupsByStrategy[*rg.PartialResponseStrategy].Groups,
-				rg.RuleGroup,
-			)
-		}
+	if err := os.RemoveAll(m.workDir); err != nil {
+		return errors.Wrapf(err, "failed to remove %s", m.workDir)
+	}
+	if err := os.MkdirAll(m.workDir, os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create %s", m.workDir)
+	}
 
-		for s, rg := range groupsByStrategy {
+	// NOTE: This is very ugly, but we need to reparse it into tmp dir without the field to have to reuse
+	// rules.Manager. The problem is that it uses yaml.UnmarshalStrict for some reasons.
+	for _, fn := range files {
+		for s, rg := range groupsByFile[fn] {
 			b, err := yaml.Marshal(rg)
 			if err != nil {
 				errs = append(errs, errors.Wrapf(err, "%s: failed to marshal rule groups", fn))
@@ -201,23 +300,58 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 			ruleFiles[newFn] = fn
 		}
 	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
 
-	m.mtx.Lock()
-	for s, fs := range filesByStrategy {
-		mgr, ok := m.mgrs[s]
-		if !ok {
-			errs = append(errs, errors.Errorf("no manager found for %v", s))
-			continue
-		}
+	// Managers without files are updated as well, so that their groups are removed.
+	for s, mgr := range m.mgrs {
 		// We add external labels in `pkg/alert.Queue`.
 		// TODO(bwplotka): Investigate if we should put ext labels here or not.
-		if err := mgr.Update(evalInterval, fs, nil); err != nil {
+		if err := mgr.Update(evalInterval, filesByStrategy[s], nil); err != nil {
 			errs = append(errs, errors.Wrapf(err, "strategy %s", s))
 			continue
 		}
 	}
 	m.ruleFiles = ruleFiles
-	m.mtx.Unlock()
 
 	return errs.Err()
 }
+
+// loadFile parses and validates the given rule file and returns its groups by partial response strategy.
+func (m *Manager) loadFile(fn string) (map[storepb.PartialResponseStrategy]*rulefmt.RuleGroups, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var rg RuleGroups
+	if err := yaml.Unmarshal(b, &rg); err != nil {
+		return nil, errors.Wrap(err, fn)
+	}
+
+	groupsByStrategy := map[storepb.PartialResponseStrategy]*rulefmt.RuleGroups{}
+	for _, rg := range rg.Groups {
+		s := *rg.PartialResponseStrategy
+		if _, ok := m.mgrs[s]; !ok {
+			return nil, errors.Errorf("%s: no manager found for %v", fn, s)
+		}
+		if _, ok := groupsByStrategy[s]; !ok {
+			groupsByStrategy[s] = &rulefmt.RuleGroups{}
+		}
+		groupsByStrategy[s].Groups = append(groupsByStrategy[s].Groups, rg.RuleGroup)
+	}
+
+	// Validate the groups the same way rules.Manager will load them, e.g. for duplicated group names and invalid
+	// expressions.
+	var errs tsdberrors.MultiError
+	for _, rgs := range groupsByStrategy {
+		for _, err := range rgs.Validate() {
+			errs = append(errs, errors.Wrap(err, fn))
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return groupsByStrategy, nil
+}
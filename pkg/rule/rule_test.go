@@ -20,8 +20,10 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
 	"gopkg.in/yaml.v2"
 )
 
@@ -168,7 +170,30 @@ groups:
 	testutil.NotOk(t, err)
 	testutil.Assert(t, strings.Contains(err.Error(), "wrong.yaml: failed to unmarshal 'partial_response_strategy'"), err.Error())
 	testutil.Assert(t, strings.Contains(err.Error(), "non_existing.yaml: no such file or directory"), err.Error())
+	// Nothing is applied if any of the files is invalid.
+	testutil.Equals(t, 0, len(m.RuleGroups()))
 
+	files := []string{
+		filepath.Join(dir, "no_strategy.yaml"),
+		filepath.Join(dir, "abort.yaml"),
+		filepath.Join(dir, "warn.yaml"),
+		filepath.Join(dir, "combined.yaml"),
+		filepath.Join(dir, "subdir", "no_strategy.yaml"),
+	}
+	testutil.Ok(t, m.Update(10*time.Second, files))
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "invalid_expr.yaml"), []byte(`
+groups:
+- name: "something9"
+  rules:
+  - alert: "some"
+    expr: "up{"
+`), os.ModePerm))
+	err = m.Update(10*time.Second, append(files, filepath.Join(dir, "invalid_expr.yaml")))
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "invalid_expr.yaml"), err.Error())
+
+	// Previously loaded rules stay active after a failed update.
 	g := m.RuleGroups()
 	sort.Slice(g, func(i, j int) bool {
 		return g[i].Name() < g[j].Name()
@@ -223,6 +248,13 @@ groups:
 			testutil.Equals(t, exp[i].file, g[i].OriginalFile())
 		})
 	}
+
+	// Groups of strategies without any files left are removed.
+	testutil.Ok(t, m.Update(10*time.Second, []string{filepath.Join(dir, "warn.yaml")}))
+	g = m.RuleGroups()
+	testutil.Equals(t, 1, len(g))
+	testutil.Equals(t, "something3", g[0].Name())
+	testutil.Equals(t, storepb.PartialResponseStrategy_WARN, g[0].PartialResponseStrategy)
 }
 
 func TestRuleGroupMarshalYAML(t *testing.T) {
@@ -272,3 +304,81 @@ func TestRuleGroupMarshalYAML(t *testing.T) {
 
 	testutil.Equals(t, expected, string(b))
 }
+
+type testRulesServer struct {
+	grpc.ServerStream
+	groups []*rulespb.RuleGroup
+}
+
+func (s *testRulesServer) Send(r *rulespb.RulesResponse) error {
+	s.groups = append(s.groups, r.GetGroup())
+	return nil
+}
+
+func TestManager_Rules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_rule_rules")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "rule.yaml"), []byte(`
+groups:
+- name: "b"
+  partial_response_strategy: "warn"
+  rules:
+  - record: "test"
+    expr: "sum(up)"
+- name: "a"
+  interval: 30s
+  rules:
+  - record: "test"
+    expr: "sum(up)"
+  - alert: "TestAlert"
+    expr: "up == 0"
+    for: 5m
+    labels:
+      severity: "page"
+    annotations:
+      summary: "down"
+`), os.ModePerm))
+
+	thanosRuleMgr := NewManager(dir)
+	for _, s := range []storepb.PartialResponseStrategy{storepb.PartialResponseStrategy_ABORT, storepb.PartialResponseStrategy_WARN} {
+		thanosRuleMgr.SetRuleManager(s, rules.NewManager(&rules.ManagerOptions{
+			Logger:     log.NewNopLogger(),
+			Context:    context.Background(),
+			Appendable: nopAppendable{},
+		}))
+	}
+	testutil.Ok(t, thanosRuleMgr.Update(10*time.Second, []string{filepath.Join(dir, "rule.yaml")}))
+
+	srv := &testRulesServer{}
+	testutil.Ok(t, thanosRuleMgr.Rules(&rulespb.RulesRequest{}, srv))
+	testutil.Equals(t, 2, len(srv.groups))
+	testutil.Equals(t, "a", srv.groups[0].Name)
+	testutil.Equals(t, filepath.Join(dir, "rule.yaml"), srv.groups[0].File)
+	testutil.Equals(t, 30.0, srv.groups[0].Interval)
+	testutil.Equals(t, storepb.PartialResponseStrategy_ABORT, srv.groups[0].PartialResponseStrategy)
+	testutil.Equals(t, &rulespb.Rule{
+		Type:   rulespb.Rule_RECORDING,
+		Name:   "test",
+		Query:  "sum(up)",
+		Labels: storepb.LabelSet{Labels: []storepb.Label{}},
+	}, srv.groups[0].Rules[0])
+	testutil.Equals(t, &rulespb.Rule{
+		Type:        rulespb.Rule_ALERTING,
+		Name:        "TestAlert",
+		Query:       "up == 0",
+		Duration:    300,
+		Labels:      storepb.LabelSet{Labels: []storepb.Label{{Name: "severity", Value: "page"}}},
+		Annotations: storepb.LabelSet{Labels: []storepb.Label{{Name: "summary", Value: "down"}}},
+	}, srv.groups[0].Rules[1])
+	testutil.Equals(t, "b", srv.groups[1].Name)
+	testutil.Equals(t, storepb.PartialResponseStrategy_WARN, srv.groups[1].PartialResponseStrategy)
+
+	srv = &testRulesServer{}
+	testutil.Ok(t, thanosRuleMgr.Rules(&rulespb.RulesRequest{Type: rulespb.RulesRequest_ALERTING}, srv))
+	testutil.Equals(t, 2, len(srv.groups))
+	testutil.Equals(t, 1, len(srv.groups[0].Rules))
+	testutil.Equals(t, "TestAlert", srv.groups[0].Rules[0].Name)
+	testutil.Equals(t, 0, len(srv.groups[1].Rules))
+}
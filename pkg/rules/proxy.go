@@ -0,0 +1,173 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// Proxy implements rulespb.RulesServer by merging the rule groups of many Rules API servers, e.g. rulers. Identical
+// groups of HA ruler replicas are deduplicated by keeping the most recently evaluated copy.
+type Proxy struct {
+	logger  log.Logger
+	clients func() []rulespb.RulesClient
+}
+
+// NewProxy returns a new Proxy of the Rules API servers returned by the given function.
+func NewProxy(logger log.Logger, clients func() []rulespb.RulesClient) *Proxy {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Proxy{
+		logger:  logger,
+		clients: clients,
+	}
+}
+
+// Rules streams the deduplicated rule groups of all Rules API servers.
+func (p *Proxy) Rules(r *rulespb.RulesRequest, s rulespb.Rules_RulesServer) error {
+	groups, warnings, err := p.RuleGroups(s.Context(), r)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		if err := s.Send(rulespb.NewWarnRulesResponse(w)); err != nil {
+			return err
+		}
+	}
+	for _, g := range groups {
+		if err := s.Send(rulespb.NewRuleGroupRulesResponse(g)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RuleGroups returns the deduplicated rule groups of all Rules API servers, sorted by file and name. With the warn
+// partial response strategy, errors of single servers are returned as warnings; with abort, the first one fails
+// the request.
+func (p *Proxy) RuleGroups(ctx context.Context, r *rulespb.RulesRequest) ([]*rulespb.RuleGroup, []error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		groups   = map[string]*rulespb.RuleGroup{}
+		warnings []error
+		errs     []error
+	)
+	for _, c := range p.clients() {
+		wg.Add(1)
+		go func(c rulespb.RulesClient) {
+			defer wg.Done()
+
+			res, warns, err := fetchRuleGroups(ctx, c, r)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			warnings = append(warnings, warns...)
+			if err != nil {
+				if r.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT {
+					errs = append(errs, err)
+					cancel()
+					return
+				}
+				level.Warn(p.logger).Log("msg", "fetching rule groups failed", "err", err)
+				warnings = append(warnings, err)
+				return
+			}
+			for _, g := range res {
+				k := groupKey(g)
+				if prev, ok := groups[k]; ok && prev.LastEvaluation >= g.LastEvaluation {
+					continue
+				}
+				groups[k] = g
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+
+	res := make([]*rulespb.RuleGroup, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, g)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].File != res[j].File {
+			return res[i].File < res[j].File
+		}
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return groupKey(res[i]) < groupKey(res[j])
+	})
+	return res, warnings, nil
+}
+
+func fetchRuleGroups(ctx context.Context, c rulespb.RulesClient, r *rulespb.RulesRequest) ([]*rulespb.RuleGroup, []error, error) {
+	stream, err := c.Rules(ctx, r)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fetch rules")
+	}
+
+	var (
+		groups   []*rulespb.RuleGroup
+		warnings []error
+	)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return groups, warnings, nil
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "receive rules")
+		}
+
+		if w := resp.GetWarning(); w != "" {
+			warnings = append(warnings, errors.New(w))
+			continue
+		}
+		if g := resp.GetGroup(); g != nil {
+			groups = append(groups, g)
+		}
+	}
+}
+
+// groupKey identifies a rule group by its name, file, partial response strategy and the definitions of its rules,
+// which are the same for all replicas of a ruler.
+func groupKey(g *rulespb.RuleGroup) string {
+	var b strings.Builder
+	b.WriteString(g.File)
+	b.WriteByte(0)
+	b.WriteString(g.Name)
+	b.WriteByte(0)
+	b.WriteString(g.PartialResponseStrategy.String())
+	for _, r := range g.Rules {
+		b.WriteByte(0)
+		b.WriteString(r.Type.String())
+		b.WriteByte(0)
+		b.WriteString(r.Name)
+		b.WriteByte(0)
+		b.WriteString(r.Query)
+		b.WriteByte(0)
+		b.WriteString(storepb.LabelsToString(r.Labels.Labels))
+	}
+	return b.String()
+}
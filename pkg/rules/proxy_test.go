@@ -0,0 +1,96 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type testRulesClient struct {
+	responses []*rulespb.RulesResponse
+	err       error
+}
+
+func (c *testRulesClient) Rules(context.Context, *rulespb.RulesRequest, ...grpc.CallOption) (rulespb.Rules_RulesClient, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &testRulesStream{responses: c.responses}, nil
+}
+
+type testRulesStream struct {
+	grpc.ClientStream
+	responses []*rulespb.RulesResponse
+}
+
+func (s *testRulesStream) Recv() (*rulespb.RulesResponse, error) {
+	if len(s.responses) == 0 {
+		return nil, io.EOF
+	}
+	r := s.responses[0]
+	s.responses = s.responses[1:]
+	return r, nil
+}
+
+func testGroup(name string, lastEvaluation int64, query string) *rulespb.RuleGroup {
+	return &rulespb.RuleGroup{
+		Name:           name,
+		File:           "rules.yaml",
+		LastEvaluation: lastEvaluation,
+		Rules: []*rulespb.Rule{{
+			Type:           rulespb.Rule_ALERTING,
+			Name:           "TestAlert",
+			Query:          query,
+			Labels:         storepb.LabelSet{Labels: []storepb.Label{{Name: "severity", Value: "page"}}},
+			LastEvaluation: lastEvaluation,
+		}},
+	}
+}
+
+func TestProxy_RuleGroups(t *testing.T) {
+	replica0 := &testRulesClient{responses: []*rulespb.RulesResponse{
+		rulespb.NewRuleGroupRulesResponse(testGroup("a", 2000, "up == 0")),
+		rulespb.NewRuleGroupRulesResponse(testGroup("b", 1000, "up == 0")),
+	}}
+	replica1 := &testRulesClient{responses: []*rulespb.RulesResponse{
+		rulespb.NewRuleGroupRulesResponse(testGroup("a", 1000, "up == 0")),
+		rulespb.NewRuleGroupRulesResponse(testGroup("b", 3000, "up == 0")),
+		rulespb.NewWarnRulesResponse(errors.New("some warning")),
+	}}
+	// Groups with different rules are not deduplicated.
+	other := &testRulesClient{responses: []*rulespb.RulesResponse{
+		rulespb.NewRuleGroupRulesResponse(testGroup("a", 500, "up == 1")),
+	}}
+	failing := &testRulesClient{err: errors.New("unavailable")}
+
+	t.Run("warn", func(t *testing.T) {
+		p := NewProxy(nil, func() []rulespb.RulesClient {
+			return []rulespb.RulesClient{replica0, replica1, other, failing}
+		})
+		groups, warnings, err := p.RuleGroups(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_WARN})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 2, len(warnings))
+
+		testutil.Equals(t, 3, len(groups))
+		testutil.Equals(t, testGroup("a", 2000, "up == 0"), groups[0])
+		testutil.Equals(t, testGroup("a", 500, "up == 1"), groups[1])
+		testutil.Equals(t, testGroup("b", 3000, "up == 0"), groups[2])
+	})
+	t.Run("abort", func(t *testing.T) {
+		p := NewProxy(nil, func() []rulespb.RulesClient {
+			return []rulespb.RulesClient{replica0, failing}
+		})
+		_, _, err := p.RuleGroups(context.Background(), &rulespb.RulesRequest{PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT})
+		testutil.NotOk(t, err)
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rulespb
+
+func NewRuleGroupRulesResponse(group *RuleGroup) *RulesResponse {
+	return &RulesResponse{
+		Result: &RulesResponse_Group{
+			Group: group,
+		},
+	}
+}
+
+func NewWarnRulesResponse(warning error) *RulesResponse {
+	return &RulesResponse{
+		Result: &RulesResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
+
+// Matches returns true if rules of the given type are requested.
+func (t RulesRequest_Type) Matches(rt Rule_Type) bool {
+	switch t {
+	case RulesRequest_ALERTING:
+		return rt == Rule_ALERTING
+	case RulesRequest_RECORDING:
+		return rt == Rule_RECORDING
+	}
+	return true
+}
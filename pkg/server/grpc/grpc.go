@@ -40,7 +40,7 @@ type Server struct {
 	opts options
 }
 
-// New creates a new Server.
+// New creates a new Server. The Store API is not served if storeSrv is nil.
 func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer, comp component.Component, probe *prober.GRPCProbe, storeSrv storepb.StoreServer, opts ...Option) *Server {
 	options := options{}
 	for _, o := range opts {
@@ -79,9 +79,15 @@ func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer
 	if options.tlsConfig != nil {
 		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(options.tlsConfig)))
 	}
+	grpcOpts = append(grpcOpts, options.serverOpts...)
 	s := grpc.NewServer(grpcOpts...)
 
-	storepb.RegisterStoreServer(s, storeSrv)
+	if storeSrv != nil {
+		storepb.RegisterStoreServer(s, storeSrv)
+	}
+	for _, f := range options.registerServerFuncs {
+		f(s)
+	}
 	met.InitializeMetrics(s)
 	reg.MustRegister(met)
 
@@ -6,13 +6,17 @@ package grpc
 import (
 	"crypto/tls"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 type options struct {
 	gracePeriod time.Duration
 	listen      string
 
-	tlsConfig *tls.Config
+	tlsConfig           *tls.Config
+	registerServerFuncs []func(*grpc.Server)
+	serverOpts          []grpc.ServerOption
 }
 
 // Option overrides behavior of Server.
@@ -48,3 +52,18 @@ func WithTLSConfig(cfg *tls.Config) Option {
 		o.tlsConfig = cfg
 	})
 }
+
+// WithServer calls the given function with the underlying gRPC server,
+// so that additional services can be registered on it.
+func WithServer(f func(*grpc.Server)) Option {
+	return optionFunc(func(o *options) {
+		o.registerServerFuncs = append(o.registerServerFuncs, f)
+	})
+}
+
+// WithServerOptions adds options to the underlying gRPC server.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return optionFunc(func(o *options) {
+		o.serverOpts = append(o.serverOpts, opts...)
+	})
+}
@@ -79,6 +79,24 @@ type Shipper struct {
 	labels          func() labels.Labels
 	source          metadata.SourceType
 	uploadCompacted bool
+
+	uploadConcurrency int
+
+	// verified is true once blocks recorded as uploaded by previous runs were verified against the bucket.
+	verified bool
+	// reupload contains blocks found incomplete in the bucket by the verification, which are not uploaded again yet.
+	reupload map[ulid.ULID]struct{}
+}
+
+// UploadOptions configure how the shipper uploads blocks to the bucket.
+type UploadOptions struct {
+	// Concurrency is the maximum number of files of a block uploaded concurrently. Files are uploaded one by one if
+	// lower than 2.
+	Concurrency int
+	// BytesPerSecond is the maximum number of bytes uploaded per second. 0 disables the limit.
+	BytesPerSecond int64
+	// RequestsPerSecond is the maximum number of upload requests issued per second. 0 disables the limit.
+	RequestsPerSecond float64
 }
 
 // New creates a new shipper that detects new TSDB blocks in dir and uploads them
@@ -137,6 +155,45 @@ func NewWithCompacted(
 	}
 }
 
+// NewWithOptions creates a new shipper like New, or like NewWithCompacted if uploadCompacted is true, which uploads
+// blocks according to the given upload options. Uploads are throttled, so initial uploads of big TSDB directories
+// do not saturate the network or hit rate limits of the object storage provider.
+func NewWithOptions(
+	logger log.Logger,
+	r prometheus.Registerer,
+	dir string,
+	bucket objstore.Bucket,
+	lbls func() labels.Labels,
+	source metadata.SourceType,
+	uploadCompacted bool,
+	opts UploadOptions,
+) (*Shipper, error) {
+	conf := objstore.RateLimitConfig{
+		Operations: map[string]objstore.RateLimit{
+			"upload": {
+				OpsPerSecond:   opts.RequestsPerSecond,
+				BytesPerSecond: opts.BytesPerSecond,
+			},
+		},
+	}
+	if conf.Enabled() {
+		rl, err := objstore.NewRateLimitedBucket("shipper", bucket, conf, r)
+		if err != nil {
+			return nil, errors.Wrap(err, "create upload rate limiter")
+		}
+		bucket = rl
+	}
+
+	var s *Shipper
+	if uploadCompacted {
+		s = NewWithCompacted(logger, r, dir, bucket, lbls, source)
+	} else {
+		s = New(logger, r, dir, bucket, lbls, source)
+	}
+	s.uploadConcurrency = opts.Concurrency
+	return s, nil
+}
+
 // Timestamps returns the minimum timestamp for which data is available and the highest timestamp
 // of blocks that were successfully uploaded.
 func (s *Shipper) Timestamps() (minTime, maxSyncTime int64, err error) {
@@ -241,6 +298,19 @@ func (c *lazyOverlapChecker) IsOverlapping(ctx context.Context, newMeta tsdb.Blo
 	return nil
 }
 
+// add registers a block uploaded during the current sync, so that following compacted blocks are checked against it too.
+// Blocks uploaded before the bucket was synced are fetched from the bucket by the sync itself.
+func (c *lazyOverlapChecker) add(m tsdb.BlockMeta) {
+	if !c.synced {
+		return
+	}
+	if _, ok := c.lookupMetas[m.ULID]; ok {
+		return
+	}
+	c.metas = append(c.metas, m)
+	c.lookupMetas[m.ULID] = struct{}{}
+}
+
 // Sync performs a single synchronization, which ensures all non-compacted local blocks have been uploaded
 // to the object bucket once.
 //
@@ -265,6 +335,18 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 		hasUploaded[id] = struct{}{}
 	}
 
+	// Local state is not trusted blindly, blocks recorded as uploaded are verified against the bucket once.
+	if !s.verified {
+		if s.reupload, err = s.verifyUploaded(ctx, hasUploaded); err != nil {
+			s.metrics.dirSyncFailures.Inc()
+			return 0, errors.Wrap(err, "verify uploaded blocks")
+		}
+		s.verified = true
+	}
+	for id := range s.reupload {
+		delete(hasUploaded, id)
+	}
+
 	// Reset the uploaded slice so we can rebuild it only with blocks that still exist locally.
 	meta.Uploaded = nil
 
@@ -287,13 +369,16 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 			return nil
 		}
 
-		// Check against bucket if the meta file for this block exists.
-		ok, err := s.bucket.Exists(ctx, path.Join(m.ULID.String(), block.MetaFilename))
-		if err != nil {
-			return errors.Wrap(err, "check exists")
-		}
-		if ok {
-			return nil
+		// Check against bucket if the meta file for this block exists. Blocks found incomplete by the verification
+		// have meta file, but have to be uploaded again anyway.
+		if _, reupload := s.reupload[m.ULID]; !reupload {
+			ok, err := s.bucket.Exists(ctx, path.Join(m.ULID.String(), block.MetaFilename))
+			if err != nil {
+				return errors.Wrap(err, "check exists")
+			}
+			if ok {
+				return nil
+			}
 		}
 
 		// We only ship of the first compacted block level as normal flow.
@@ -317,6 +402,8 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 			return nil
 		}
 		meta.Uploaded = append(meta.Uploaded, m.ULID)
+		checker.add(m.BlockMeta)
+		delete(s.reupload, m.ULID)
 
 		uploaded++
 		s.metrics.uploads.Inc()
@@ -341,6 +428,51 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 	return uploaded, nil
 }
 
+// verifyUploaded checks local blocks recorded as uploaded in the given map and returns those which are only partially
+// present in the bucket, e.g. because the upload was interrupted by a crash after the shipper meta file was updated.
+// Blocks missing in the bucket completely, or marked for deletion, are assumed to be removed by compaction.
+func (s *Shipper) verifyUploaded(ctx context.Context, hasUploaded map[ulid.ULID]struct{}) (map[ulid.ULID]struct{}, error) {
+	reupload := map[ulid.ULID]struct{}{}
+	if err := s.iterBlockMetas(func(m *metadata.Meta) error {
+		if _, ok := hasUploaded[m.ULID]; !ok {
+			return nil
+		}
+
+		ok, err := block.VerifyUploaded(ctx, s.bucket, filepath.Join(s.dir, m.ULID.String()))
+		if err != nil {
+			return errors.Wrapf(err, "verify block %s", m.ULID)
+		}
+		if ok {
+			return nil
+		}
+
+		deleted, err := s.bucket.Exists(ctx, path.Join(m.ULID.String(), metadata.DeletionMarkFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check deletion mark of block %s", m.ULID)
+		}
+		if deleted {
+			return nil
+		}
+		found := false
+		if err := s.bucket.Iter(ctx, m.ULID.String(), func(string) error {
+			found = true
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "list block %s", m.ULID)
+		}
+		if !found {
+			return nil
+		}
+
+		level.Warn(s.logger).Log("msg", "block recorded as uploaded is incomplete in the bucket; uploading it again", "block", m.ULID)
+		reupload[m.ULID] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return reupload, nil
+}
+
 // sync uploads the block if not exists in remote storage.
 // TODO(khyatisoneji): Double check if block does not have deletion-mark.json for some reason, otherwise log it or return error.
 func (s *Shipper) upload(ctx context.Context, meta *metadata.Meta) error {
@@ -372,10 +504,16 @@ func (s *Shipper) upload(ctx context.Context, meta *metadata.Meta) error {
 		meta.Thanos.Labels = lset.Map()
 	}
 	meta.Thanos.Source = s.source
+	// Record file sizes and hashes, so the compactor can tell byte-identical copies of the block apart.
+	files, err := block.GatherFileStats(updir, true)
+	if err != nil {
+		return errors.Wrap(err, "gather file stats")
+	}
+	meta.Thanos.Files = files
 	if err := metadata.Write(s.logger, updir, meta); err != nil {
 		return errors.Wrap(err, "write meta file")
 	}
-	return block.Upload(ctx, s.logger, s.bucket, updir)
+	return block.UploadConcurrent(ctx, s.logger, s.bucket, updir, s.uploadConcurrency)
 }
 
 // iterBlockMetas calls f with the block meta for each block found in dir
@@ -477,6 +615,11 @@ func WriteMetaFile(logger log.Logger, dir string, meta *Meta) error {
 		runutil.CloseWithLogOnErr(logger, f, "write meta file close")
 		return err
 	}
+	// Persist the content before the rename, otherwise a crash can leave an empty meta file behind.
+	if err := f.Sync(); err != nil {
+		runutil.CloseWithLogOnErr(logger, f, "write meta file close")
+		return err
+	}
 	if err := f.Close(); err != nil {
 		return err
 	}
@@ -6,6 +6,8 @@ package shipper
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"math/rand"
@@ -119,8 +121,13 @@ func TestShipper_SyncBlocks_e2e(t *testing.T) {
 				testutil.Equals(t, 0, b)
 			}
 
-			// The external labels must be attached to the meta file on upload.
+			// The external labels and file stats must be attached to the meta file on upload.
 			meta.Thanos.Labels = extLset.Map()
+			meta.Thanos.Files = []metadata.File{
+				{RelPath: "chunks/0001", SizeBytes: 14, SHA256: sha256Hex("chunkcontents1")},
+				{RelPath: "chunks/0002", SizeBytes: 14, SHA256: sha256Hex("chunkcontents2")},
+				{RelPath: "index", SizeBytes: 13, SHA256: sha256Hex("indexcontents")},
+			}
 
 			var buf bytes.Buffer
 			enc := json.NewEncoder(&buf)
@@ -273,6 +280,11 @@ func TestShipper_SyncBlocksWithMigrating_e2e(t *testing.T) {
 
 			// The external labels must be attached to the meta file on upload.
 			meta.Thanos.Labels = extLset.Map()
+			meta.Thanos.Files = []metadata.File{
+				{RelPath: "chunks/0001", SizeBytes: 14, SHA256: sha256Hex("chunkcontents1")},
+				{RelPath: "chunks/0002", SizeBytes: 14, SHA256: sha256Hex("chunkcontents2")},
+				{RelPath: "index", SizeBytes: 13, SHA256: sha256Hex("indexcontents")},
+			}
 
 			var buf bytes.Buffer
 			enc := json.NewEncoder(&buf)
@@ -322,3 +334,8 @@ func TestShipper_SyncBlocksWithMigrating_e2e(t *testing.T) {
 		testutil.Assert(t, ok == false, "fifth block was reuploaded")
 	})
 }
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
@@ -4,18 +4,23 @@
 package shipper
 
 import (
+	"context"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -175,3 +180,97 @@ func BenchmarkIterBlockMetas(b *testing.B) {
 		testutil.Ok(b, err)
 	}
 }
+
+func TestShipper_SyncCompactedOverlapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer func() {
+		testutil.Ok(t, os.RemoveAll(dir))
+	}()
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	s := NewWithCompacted(nil, nil, dir, bkt, func() labels.Labels { return labels.FromStrings("a", "1") }, metadata.TestSource)
+
+	for _, b := range []struct {
+		id              ulid.ULID
+		mint, maxt      int64
+		compactionLevel int
+	}{
+		{id: ulid.MustNew(1, nil), mint: 0, maxt: 4000, compactionLevel: 2},
+		// Overlaps with the first block uploaded in the same sync.
+		{id: ulid.MustNew(2, nil), mint: 2000, maxt: 6000, compactionLevel: 2},
+		{id: ulid.MustNew(3, nil), mint: 6000, maxt: 8000, compactionLevel: 1},
+	} {
+		createTestBlock(t, dir, b.id, b.mint, b.maxt, b.compactionLevel)
+	}
+
+	uploaded, err := s.Sync(ctx)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 2, uploaded)
+
+	for id, exp := range map[ulid.ULID]bool{ulid.MustNew(1, nil): true, ulid.MustNew(2, nil): false, ulid.MustNew(3, nil): true} {
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp, ok)
+	}
+}
+
+func TestShipper_SyncVerifiesUploaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer func() {
+		testutil.Ok(t, os.RemoveAll(dir))
+	}()
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	s := New(nil, nil, dir, bkt, func() labels.Labels { return labels.FromStrings("a", "1") }, metadata.TestSource)
+
+	complete, partial, removed := ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)
+	for i, id := range []ulid.ULID{complete, partial, removed} {
+		createTestBlock(t, dir, id, int64(i)*2000, int64(i+1)*2000, 1)
+	}
+	testutil.Ok(t, WriteMetaFile(log.NewNopLogger(), dir, &Meta{Version: MetaVersion1, Uploaded: []ulid.ULID{complete, partial, removed}}))
+
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(complete.String(), block.MetaFilename), strings.NewReader("{}")))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(complete.String(), block.IndexFilename), strings.NewReader("indexcontents")))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(complete.String(), block.ChunksDirname, "000001"), strings.NewReader("chunkcontents")))
+	// Chunks of the partial block are missing.
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(partial.String(), block.MetaFilename), strings.NewReader("{}")))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(partial.String(), block.IndexFilename), strings.NewReader("indexcontents")))
+
+	uploaded, err := s.Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, uploaded)
+
+	ok, err := bkt.Exists(ctx, path.Join(partial.String(), block.ChunksDirname, "000001"))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "partial block was not uploaded again")
+
+	// Block removed from the bucket completely is assumed to be compacted and is not uploaded again.
+	ok, err = bkt.Exists(ctx, path.Join(removed.String(), block.MetaFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "removed block was uploaded again")
+
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{complete, partial, removed}, shipMeta.Uploaded)
+}
+
+func createTestBlock(t *testing.T, dir string, id ulid.ULID, mint, maxt int64, compactionLevel int) {
+	bdir := path.Join(dir, id.String())
+	testutil.Ok(t, os.MkdirAll(path.Join(bdir, block.ChunksDirname), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(path.Join(bdir, block.ChunksDirname, "000001"), []byte("chunkcontents"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(path.Join(bdir, block.IndexFilename), []byte("indexcontents"), os.ModePerm))
+	testutil.Ok(t, metadata.Write(log.NewNopLogger(), bdir, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:       id,
+			MinTime:    mint,
+			MaxTime:    maxt,
+			Version:    1,
+			Stats:      tsdb.BlockStats{NumSamples: 1},
+			Compaction: tsdb.BlockMetaCompaction{Level: compactionLevel},
+		},
+	}))
+}
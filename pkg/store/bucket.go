@@ -42,11 +42,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/pool"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	storecache "github.com/thanos-io/thanos/pkg/store/cache"
 	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/strutil"
+	"github.com/thanos-io/thanos/pkg/tombstone"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
@@ -81,7 +83,8 @@ const (
 	// not too small (too much memory).
 	DefaultPostingOffsetInMemorySampling = 32
 
-	partitionerMaxGapSize = 512 * 1024
+	// DefaultPartitionerMaxGapSize represents default value for --store.fetch.max-gap.
+	DefaultPartitionerMaxGapSize = 512 * 1024
 )
 
 type bucketStoreMetrics struct {
@@ -90,6 +93,7 @@ type bucketStoreMetrics struct {
 	blockLoadFailures     prometheus.Counter
 	blockDrops            prometheus.Counter
 	blockDropFailures     prometheus.Counter
+	tombstonesLoaded      prometheus.Gauge
 	seriesDataTouched     *prometheus.SummaryVec
 	seriesDataFetched     *prometheus.SummaryVec
 	seriesDataSizeTouched *prometheus.SummaryVec
@@ -98,8 +102,12 @@ type bucketStoreMetrics struct {
 	seriesGetAllDuration  prometheus.Histogram
 	seriesMergeDuration   prometheus.Histogram
 	resultSeriesCount     prometheus.Summary
+	fetchedRanges         *prometheus.CounterVec
+	fetchRequests         *prometheus.CounterVec
 	chunkSizeBytes        prometheus.Histogram
 	queriesDropped        prometheus.Counter
+	queriesMemoryDropped  prometheus.Counter
+	seriesMemoryUsed      *prometheus.SummaryVec
 	queriesLimit          prometheus.Gauge
 	seriesRefetches       prometheus.Counter
 
@@ -129,6 +137,10 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_block_drop_failures_total",
 		Help: "Total number of local blocks that failed to be dropped.",
 	})
+	m.tombstonesLoaded = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_bucket_store_tombstones_loaded",
+		Help: "Number of global tombstones masking deleted series at query time.",
+	})
 	m.blocksLoaded = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 		Name: "thanos_bucket_store_blocks_loaded",
 		Help: "Number of currently loaded blocks.",
@@ -152,6 +164,15 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Help: "Size of all items of a data type in a block were fetched for a single series request.",
 	}, []string{"data_type"})
 
+	m.fetchedRanges = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_fetched_ranges_total",
+		Help: "Total number of ranges of a data type fetched from object storage, before merging them into requests.",
+	}, []string{"data_type"})
+	m.fetchRequests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_fetch_requests_total",
+		Help: "Total number of object storage GetRange requests issued for a data type, after merging ranges.",
+	}, []string{"data_type"})
+
 	m.seriesBlocksQueried = promauto.With(reg).NewSummary(prometheus.SummaryOpts{
 		Name: "thanos_bucket_store_series_blocks_queried",
 		Help: "Number of blocks in a bucket store that were touched to satisfy a query.",
@@ -183,6 +204,14 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_queries_dropped_total",
 		Help: "Number of queries that were dropped due to the sample limit.",
 	})
+	m.queriesMemoryDropped = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_queries_dropped_memory_limit_total",
+		Help: "Number of queries that were dropped due to the per query memory limit.",
+	})
+	m.seriesMemoryUsed = promauto.With(reg).NewSummaryVec(prometheus.SummaryOpts{
+		Name: "thanos_bucket_store_series_memory_used_bytes",
+		Help: "Approximate number of bytes used by a single series request per processing stage.",
+	}, []string{"stage"})
 	m.queriesLimit = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 		Name: "thanos_bucket_store_queries_concurrent_max",
 		Help: "Number of maximum concurrent queries.",
@@ -236,6 +265,8 @@ type BucketStore struct {
 	mtx       sync.RWMutex
 	blocks    map[ulid.ULID]*bucketBlock
 	blockSets map[uint64]*bucketBlockSet
+	// Global tombstones of the bucket. Samples they delete are masked in Series responses.
+	tombstones []*tombstone.Tombstone
 
 	// Verbose enabled additional logging.
 	debugLogging bool
@@ -247,7 +278,9 @@ type BucketStore struct {
 
 	// samplesLimiter limits the number of samples per each Series() call.
 	samplesLimiter SampleLimiter
-	partitioner    partitioner
+	// maxQueryMemoryBytes limits the approximate number of bytes used by each Series() call.
+	maxQueryMemoryBytes uint64
+	partitioners        blockPartitioners
 
 	filterConfig             *FilterConfig
 	advLabelSets             []storepb.LabelSet
@@ -275,6 +308,7 @@ func NewBucketStore(
 	indexCache storecache.IndexCache,
 	maxChunkPoolBytes uint64,
 	maxSampleCount uint64,
+	maxQueryMemoryBytes uint64,
 	maxConcurrent int,
 	debugLogging bool,
 	blockSyncConcurrency int,
@@ -283,6 +317,7 @@ func NewBucketStore(
 	enableIndexHeader bool,
 	enablePostingsCompression bool,
 	postingOffsetsInMemSampling int,
+	partitionerConfig PartitionerConfig,
 	enableSeriesHints bool, // TODO(pracucci) Thanos 0.12 and below doesn't gracefully handle new fields in SeriesResponse. Drop this flag and always enable hints once we can drop backward compatibility.
 ) (*BucketStore, error) {
 	if logger == nil {
@@ -293,6 +328,10 @@ func NewBucketStore(
 		return nil, errors.Errorf("max concurrency value cannot be lower than 0 (got %v)", maxConcurrent)
 	}
 
+	if err := partitionerConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate partitioner config")
+	}
+
 	chunkPool, err := pool.NewBucketedBytesPool(maxChunkSize, 50e6, 2, maxChunkPoolBytes)
 	if err != nil {
 		return nil, errors.Wrap(err, "create chunk pool")
@@ -316,7 +355,8 @@ func NewBucketStore(
 			extprom.WrapRegistererWithPrefix("thanos_bucket_store_series_", reg),
 		),
 		samplesLimiter:              NewLimiter(maxSampleCount, metrics.queriesDropped),
-		partitioner:                 gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
+		maxQueryMemoryBytes:         maxQueryMemoryBytes,
+		partitioners:                newGapBasedPartitioners(partitionerConfig),
 		enableCompatibilityLabel:    enableCompatibilityLabel,
 		enableIndexHeader:           enableIndexHeader,
 		enablePostingsCompression:   enablePostingsCompression,
@@ -399,9 +439,16 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		s.metrics.blockDrops.Inc()
 	}
 
+	// Sync tombstones. On failure, keep masking with the previously loaded ones.
+	tombstones, tombstonesErr := tombstone.ReadAll(ctx, s.logger, s.bkt)
+
 	// Sync advertise labels.
 	var storeLabels []storepb.Label
 	s.mtx.Lock()
+	if tombstonesErr == nil {
+		s.tombstones = tombstones
+		s.metrics.tombstonesLoaded.Set(float64(len(tombstones)))
+	}
 	s.advLabelSets = s.advLabelSets[:0]
 	for _, bs := range s.blockSets {
 		storeLabels := storeLabels[:0]
@@ -415,6 +462,9 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 	})
 	s.mtx.Unlock()
 
+	if tombstonesErr != nil {
+		return errors.Wrap(tombstonesErr, "sync tombstones")
+	}
 	return nil
 }
 
@@ -501,7 +551,7 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		s.indexCache,
 		s.chunkPool,
 		indexHeaderReader,
-		s.partitioner,
+		s.partitioners,
 		s.metrics.seriesRefetches,
 		s.enablePostingsCompression,
 	)
@@ -633,6 +683,8 @@ type seriesEntry struct {
 	lset []storepb.Label
 	refs []uint64
 	chks []storepb.AggrChunk
+	// tombstones which delete samples of the series.
+	tombstones []*tombstone.Tombstone
 }
 
 type bucketSeriesSet struct {
@@ -669,13 +721,22 @@ func blockSeries(
 	indexr *bucketIndexReader,
 	chunkr *bucketChunkReader,
 	matchers []*labels.Matcher,
+	tombstones []*tombstone.Tombstone,
 	req *storepb.SeriesRequest,
 	samplesLimiter SampleLimiter,
+	memTracker *QueryMemoryTracker,
 ) (storepb.SeriesSet, *queryStats, error) {
 	ps, err := indexr.ExpandedPostings(matchers)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "expanded matching posting")
 	}
+	// Postings are not needed anymore once the series are loaded. Loaded series and chunks are held by the readers
+	// until the query finishes.
+	postingsBytes := uint64(indexr.stats.postingsTouchedSizeSum + 8*len(ps))
+	defer memTracker.Release(postingsBytes)
+	if err := memTracker.Reserve(memoryStagePostings, postingsBytes); err != nil {
+		return nil, nil, errors.Wrap(err, "expand postings")
+	}
 
 	if len(ps) == 0 {
 		return storepb.EmptySeriesSet(), indexr.stats, nil
@@ -694,6 +755,8 @@ func blockSeries(
 		res  []seriesEntry
 		lset labels.Labels
 		chks []chunks.Meta
+
+		shard, sharded = querysharding.ShardFromProto(req.ShardInfo)
 	)
 	for _, id := range ps {
 		if err := indexr.LoadedSeries(id, &lset, &chks); err != nil {
@@ -724,6 +787,18 @@ func blockSeries(
 		sort.Slice(s.lset, func(i, j int) bool {
 			return s.lset[i].Name < s.lset[j].Name
 		})
+		// Skip series of other shards before fetching their chunks.
+		if sharded && !shard.Matches(storepb.LabelsToPromLabelsUnsafe(s.lset)) {
+			continue
+		}
+		if len(tombstones) > 0 {
+			promLset := storepb.LabelsToPromLabelsUnsafe(s.lset)
+			for _, t := range tombstones {
+				if t.Matches(promLset) {
+					s.tombstones = append(s.tombstones, t)
+				}
+			}
+		}
 
 		for _, meta := range chks {
 			if meta.MaxTime < req.MinTime {
@@ -732,6 +807,9 @@ func blockSeries(
 			if meta.MinTime > req.MaxTime {
 				break
 			}
+			if tombstonesCover(s.tombstones, meta.MinTime, meta.MaxTime) {
+				continue
+			}
 
 			if err := chunkr.addPreload(meta.Ref); err != nil {
 				return nil, nil, errors.Wrap(err, "add chunk preload")
@@ -746,13 +824,20 @@ func blockSeries(
 			res = append(res, s)
 		}
 	}
+	if err := memTracker.Reserve(memoryStageSeries, uint64(indexr.stats.seriesTouchedSizeSum)); err != nil {
+		return nil, nil, errors.Wrap(err, "load series")
+	}
 
 	// Preload all chunks that were marked in the previous stage.
 	if err := chunkr.preload(samplesLimiter); err != nil {
 		return nil, nil, errors.Wrap(err, "preload chunks")
 	}
+	if err := memTracker.Reserve(memoryStageChunks, uint64(chunkr.stats.chunksFetchedSizeSum)); err != nil {
+		return nil, nil, errors.Wrap(err, "preload chunks")
+	}
 
-	// Transform all chunks into the response format.
+	// Transform all chunks into the response format. Response chunks refer to the preloaded bytes, so they are not
+	// accounted again.
 	for _, s := range res {
 		for i, ref := range s.refs {
 			chk, err := chunkr.Chunk(ref)
@@ -765,12 +850,107 @@ func blockSeries(
 		}
 	}
 
+	if len(tombstones) > 0 {
+		masked := res[:0]
+		for _, s := range res {
+			chks := s.chks[:0]
+			for _, c := range s.chks {
+				ok, err := maskTombstones(&c, s.tombstones)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "mask tombstones")
+				}
+				if ok {
+					chks = append(chks, c)
+				}
+			}
+			if len(chks) > 0 {
+				s.chks = chks
+				masked = append(masked, s)
+			}
+		}
+		res = masked
+	}
+
 	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats), nil
 }
 
+// tombstonesCover returns true if any of the tombstones deletes all samples within the given inclusive time range.
+func tombstonesCover(tombstones []*tombstone.Tombstone, mint, maxt int64) bool {
+	for _, t := range tombstones {
+		if t.MinTime <= mint && maxt <= t.MaxTime {
+			return true
+		}
+	}
+	return false
+}
+
+// maskTombstones removes samples deleted by the given tombstones from all aggregates of the chunk.
+// Sketches cannot be split, so they are dropped if any of their windows is affected. It returns false
+// if no samples are left in the chunk.
+func maskTombstones(chk *storepb.AggrChunk, tombstones []*tombstone.Tombstone) (bool, error) {
+	var overlapping []*tombstone.Tombstone
+	for _, t := range tombstones {
+		if t.Overlaps(chk.MinTime, chk.MaxTime) {
+			overlapping = append(overlapping, t)
+		}
+	}
+	if len(overlapping) == 0 {
+		return true, nil
+	}
+
+	chk.Sketch = nil
+	left := false
+	for _, c := range []*storepb.Chunk{chk.Raw, chk.Count, chk.Sum, chk.Min, chk.Max, chk.Counter} {
+		if c == nil {
+			continue
+		}
+		n, err := maskXORChunk(c, overlapping)
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			left = true
+		}
+	}
+	return left, nil
+}
+
+// maskXORChunk re-encodes the chunk without samples deleted by the tombstones and returns the number of samples left.
+func maskXORChunk(c *storepb.Chunk, tombstones []*tombstone.Tombstone) (int, error) {
+	if c.Type != storepb.Chunk_XOR {
+		return 0, errors.Errorf("unsupported chunk encoding %s", c.Type)
+	}
+	in, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+	if err != nil {
+		return 0, errors.Wrap(err, "decode chunk")
+	}
+	out := chunkenc.NewXORChunk()
+	app, err := out.Appender()
+	if err != nil {
+		return 0, err
+	}
+
+	it := in.Iterator(nil)
+Samples:
+	for it.Next() {
+		t, v := it.At()
+		for _, ts := range tombstones {
+			if ts.MinTime <= t && t <= ts.MaxTime {
+				continue Samples
+			}
+		}
+		app.Append(t, v)
+	}
+	if err := it.Err(); err != nil {
+		return 0, errors.Wrap(err, "iterate chunk")
+	}
+	c.Data = out.Bytes()
+	return out.NumSamples(), nil
+}
+
 func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr) error {
 	if in.Encoding() == chunkenc.EncXOR {
-		out.Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: in.Bytes()}
+		out.Raw = storepb.NewChunk(storepb.Chunk_XOR, in.Bytes())
 		return nil
 	}
 	if in.Encoding() != downsample.ChunkEncAggr {
@@ -786,31 +966,41 @@ func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Ag
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrCount)
 			}
-			out.Count = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+			out.Count = storepb.NewChunk(storepb.Chunk_XOR, x.Bytes())
 		case storepb.Aggr_SUM:
 			x, err := ac.Get(downsample.AggrSum)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrSum)
 			}
-			out.Sum = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+			out.Sum = storepb.NewChunk(storepb.Chunk_XOR, x.Bytes())
 		case storepb.Aggr_MIN:
 			x, err := ac.Get(downsample.AggrMin)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrMin)
 			}
-			out.Min = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+			out.Min = storepb.NewChunk(storepb.Chunk_XOR, x.Bytes())
 		case storepb.Aggr_MAX:
 			x, err := ac.Get(downsample.AggrMax)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrMax)
 			}
-			out.Max = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+			out.Max = storepb.NewChunk(storepb.Chunk_XOR, x.Bytes())
 		case storepb.Aggr_COUNTER:
 			x, err := ac.Get(downsample.AggrCounter)
 			if err != nil {
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrCounter)
 			}
-			out.Counter = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+			out.Counter = storepb.NewChunk(storepb.Chunk_XOR, x.Bytes())
+		case storepb.Aggr_SKETCH:
+			// Sketches are optional, as they are only computed if enabled during downsampling.
+			x, err := ac.Get(downsample.AggrSketch)
+			if err == downsample.ErrAggrNotExist {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "aggregate %s", downsample.AggrSketch)
+			}
+			out.Sketch = storepb.NewChunk(storepb.Chunk_SKETCH, x.Bytes())
 		}
 	}
 	return nil
@@ -870,12 +1060,13 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	req.MaxTime = s.limitMaxTime(req.MaxTime)
 
 	var (
-		ctx     = srv.Context()
-		stats   = &queryStats{}
-		res     []storepb.SeriesSet
-		mtx     sync.Mutex
-		g, gctx = errgroup.WithContext(ctx)
-		hints   = &hintspb.SeriesResponseHints{}
+		ctx        = srv.Context()
+		stats      = &queryStats{}
+		res        []storepb.SeriesSet
+		mtx        sync.Mutex
+		g, gctx    = errgroup.WithContext(ctx)
+		hints      = &hintspb.SeriesResponseHints{}
+		memTracker = NewQueryMemoryTracker(s.maxQueryMemoryBytes, s.metrics.queriesMemoryDropped)
 	)
 
 	s.mtx.RLock()
@@ -887,6 +1078,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		}
 
 		blocks := bs.getFor(req.MinTime, req.MaxTime, req.MaxResolutionWindow)
+		tombstones := overlappingTombstones(s.tombstones, req.MinTime, req.MaxTime)
 
 		mtx.Lock()
 		stats.blocksQueried += len(blocks)
@@ -898,6 +1090,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 
 		for _, b := range blocks {
 			b := b
+			blockTombstones := overlappingTombstones(tombstones, b.meta.MinTime, b.meta.MaxTime-1)
 
 			if s.enableSeriesHints {
 				// Keep track of queried blocks.
@@ -918,8 +1111,10 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 					indexr,
 					chunkr,
 					blockMatchers,
+					blockTombstones,
 					req,
 					s.samplesLimiter,
+					memTracker,
 				)
 				if err != nil {
 					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
@@ -950,6 +1145,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		s.metrics.seriesDataFetched.WithLabelValues("chunks").Observe(float64(stats.chunksFetched))
 		s.metrics.seriesDataSizeTouched.WithLabelValues("chunks").Observe(float64(stats.chunksTouchedSizeSum))
 		s.metrics.seriesDataSizeFetched.WithLabelValues("chunks").Observe(float64(stats.chunksFetchedSizeSum))
+		s.metrics.fetchedRanges.WithLabelValues("postings").Add(float64(stats.postingsFetched))
+		s.metrics.fetchRequests.WithLabelValues("postings").Add(float64(stats.postingsFetchCount))
+		s.metrics.fetchedRanges.WithLabelValues("series").Add(float64(stats.seriesFetched))
+		s.metrics.fetchRequests.WithLabelValues("series").Add(float64(stats.seriesFetchCount))
+		s.metrics.fetchedRanges.WithLabelValues("chunks").Add(float64(stats.chunksFetched))
+		s.metrics.fetchRequests.WithLabelValues("chunks").Add(float64(stats.chunksFetchCount))
 		s.metrics.resultSeriesCount.Observe(float64(stats.mergedSeriesCount))
 		s.metrics.cachedPostingsCompressions.WithLabelValues("encode").Add(float64(stats.cachedPostingsCompressions))
 		s.metrics.cachedPostingsCompressions.WithLabelValues("decode").Add(float64(stats.cachedPostingsDecompressions))
@@ -960,6 +1161,11 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		s.metrics.cachedPostingsOriginalSizeBytes.Add(float64(stats.cachedPostingsOriginalSizeSum))
 		s.metrics.cachedPostingsCompressedSizeBytes.Add(float64(stats.cachedPostingsCompressedSizeSum))
 
+		stats.memoryUsed = memTracker.Stages()
+		for _, stage := range memoryStages {
+			s.metrics.seriesMemoryUsed.WithLabelValues(stage).Observe(float64(stats.memoryUsed[stage]))
+		}
+
 		level.Debug(s.logger).Log("msg", "stats query processed",
 			"stats", fmt.Sprintf("%+v", stats), "err", err)
 	}()
@@ -971,6 +1177,9 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			err = g.Wait()
 		})
 		if err != nil {
+			if memTracker.Exceeded() {
+				return status.Error(codes.ResourceExhausted, err.Error())
+			}
 			return status.Error(codes.Aborted, err.Error())
 		}
 		stats.getAllDuration = time.Since(begin)
@@ -1031,6 +1240,16 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	return err
 }
 
+// overlappingTombstones returns the tombstones which delete samples within the given inclusive time range.
+func overlappingTombstones(tombstones []*tombstone.Tombstone, mint, maxt int64) (res []*tombstone.Tombstone) {
+	for _, t := range tombstones {
+		if t.Overlaps(mint, maxt) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
 func chunksSize(chks []storepb.AggrChunk) (size int) {
 	for _, chk := range chks {
 		size += chk.Size() // This gets the encoded proto size.
@@ -1121,8 +1340,8 @@ type bucketBlockSet struct {
 	blocks      [][]*bucketBlock // Ordered buckets for the existing resolutions.
 }
 
-// newBucketBlockSet initializes a new set with the known downsampling windows hard-configured.
-// The set currently does not support arbitrary ranges.
+// newBucketBlockSet initializes a new set with the standard downsampling windows.
+// Other resolutions, e.g. produced by custom downsampling levels, are added as blocks with them are added.
 func newBucketBlockSet(lset labels.Labels) *bucketBlockSet {
 	return &bucketBlockSet{
 		labels:      lset,
@@ -1138,9 +1357,16 @@ func (s *bucketBlockSet) add(b *bucketBlock) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	i := int64index(s.resolutions, b.meta.Thanos.Downsample.Resolution)
+	res := b.meta.Thanos.Downsample.Resolution
+	if res < 0 {
+		return errors.Errorf("unsupported downsampling resolution %d", res)
+	}
+	i := int64index(s.resolutions, res)
 	if i < 0 {
-		return errors.Errorf("unsupported downsampling resolution %d", b.meta.Thanos.Downsample.Resolution)
+		// Keep resolutions ordered from high to low.
+		i = sort.Search(len(s.resolutions), func(j int) bool { return s.resolutions[j] < res })
+		s.resolutions = append(s.resolutions[:i], append([]int64{res}, s.resolutions[i:]...)...)
+		s.blocks = append(s.blocks[:i], append([][]*bucketBlock{nil}, s.blocks[i:]...)...)
 	}
 	bs := append(s.blocks[i], b)
 	s.blocks[i] = bs
@@ -1258,7 +1484,7 @@ type bucketBlock struct {
 
 	pendingReaders sync.WaitGroup
 
-	partitioner partitioner
+	partitioners blockPartitioners
 
 	seriesRefetches prometheus.Counter
 
@@ -1274,7 +1500,7 @@ func newBucketBlock(
 	indexCache storecache.IndexCache,
 	chunkPool pool.BytesPool,
 	indexHeadReader indexheader.Reader,
-	p partitioner,
+	p blockPartitioners,
 	seriesRefetches prometheus.Counter,
 	enablePostingsCompression bool,
 ) (b *bucketBlock, err error) {
@@ -1284,7 +1510,7 @@ func newBucketBlock(
 		indexCache:                indexCache,
 		chunkPool:                 chunkPool,
 		dir:                       dir,
-		partitioner:               p,
+		partitioners:              p,
 		meta:                      meta,
 		indexHeaderReader:         indexHeadReader,
 		seriesRefetches:           seriesRefetches,
@@ -1636,7 +1862,7 @@ func (r *bucketIndexReader) fetchPostings(keys []labels.Label) ([]index.Postings
 
 	// TODO(bwplotka): Asses how large in worst case scenario this can be. (e.g fetch for AllPostingsKeys)
 	// Consider sub split if too big.
-	parts := r.block.partitioner.Partition(len(ptrs), func(i int) (start, end uint64) {
+	parts := r.block.partitioners.postings.Partition(len(ptrs), func(i int) (start, end uint64) {
 		return uint64(ptrs[i].ptr.Start), uint64(ptrs[i].ptr.End)
 	})
 
@@ -1790,7 +2016,7 @@ func (r *bucketIndexReader) PreloadSeries(ids []uint64) error {
 		r.loadedSeries[id] = b
 	}
 
-	parts := r.block.partitioner.Partition(len(ids), func(i int) (start, end uint64) {
+	parts := r.block.partitioners.series.Partition(len(ids), func(i int) (start, end uint64) {
 		return ids[i], ids[i] + maxSeriesSize
 	})
 	g, ctx := errgroup.WithContext(r.ctx)
@@ -1863,8 +2089,50 @@ type partitioner interface {
 	Partition(length int, rng func(int) (uint64, uint64)) []part
 }
 
+// PartitionerConfig configures how ranges of index and chunks data are merged into object storage GetRange requests.
+// Merging ranges lowers the number of requests at the cost of fetching bytes in gaps between them.
+type PartitionerConfig struct {
+	// MaxGapSize is the maximum gap in bytes between two ranges that are still merged into a single request.
+	MaxGapSize uint64
+	// SeriesBatchSize is the maximum number of series fetched by a single request. 0 means no limit.
+	SeriesBatchSize int
+	// ChunksBatchSize is the maximum number of chunks fetched by a single request. 0 means no limit.
+	ChunksBatchSize int
+}
+
+// DefaultPartitionerConfig returns the default PartitionerConfig.
+func DefaultPartitionerConfig() PartitionerConfig {
+	return PartitionerConfig{MaxGapSize: DefaultPartitionerMaxGapSize}
+}
+
+// Validate returns error if configuration is invalid.
+func (c PartitionerConfig) Validate() error {
+	if c.SeriesBatchSize < 0 {
+		return errors.Errorf("series batch size cannot be negative (got %v)", c.SeriesBatchSize)
+	}
+	if c.ChunksBatchSize < 0 {
+		return errors.Errorf("chunks batch size cannot be negative (got %v)", c.ChunksBatchSize)
+	}
+	return nil
+}
+
+// blockPartitioners holds partitioners for each type of data fetched from a block.
+type blockPartitioners struct {
+	postings, series, chunks partitioner
+}
+
+func newGapBasedPartitioners(conf PartitionerConfig) blockPartitioners {
+	return blockPartitioners{
+		postings: gapBasedPartitioner{maxGapSize: conf.MaxGapSize},
+		series:   gapBasedPartitioner{maxGapSize: conf.MaxGapSize, maxElements: conf.SeriesBatchSize},
+		chunks:   gapBasedPartitioner{maxGapSize: conf.MaxGapSize, maxElements: conf.ChunksBatchSize},
+	}
+}
+
 type gapBasedPartitioner struct {
 	maxGapSize uint64
+	// maxElements is the maximum number of entries combined into a single range. 0 means no limit.
+	maxElements int
 }
 
 // Partition partitions length entries into n <= length ranges that cover all
@@ -1887,6 +2155,9 @@ func (g gapBasedPartitioner) Partition(length int, rng func(int) (uint64, uint64
 			if p.end+g.maxGapSize < s {
 				break
 			}
+			if g.maxElements > 0 && k-j >= g.maxElements {
+				break
+			}
 
 			if p.end <= e {
 				p.end = e
@@ -1973,7 +2244,7 @@ func (r *bucketChunkReader) preload(samplesLimiter SampleLimiter) error {
 		sort.Slice(offsets, func(i, j int) bool {
 			return offsets[i] < offsets[j]
 		})
-		parts := r.block.partitioner.Partition(len(offsets), func(i int) (start, end uint64) {
+		parts := r.block.partitioners.chunks.Partition(len(offsets), func(i int) (start, end uint64) {
 			return uint64(offsets[i]), uint64(offsets[i]) + maxChunkSize
 		})
 
@@ -2071,6 +2342,17 @@ func (r *bucketChunkReader) Close() error {
 	return nil
 }
 
+// Stages of processing Series request used for accounting memory used by the query.
+const (
+	memoryStagePostings = "postings"
+	memoryStageSeries   = "series"
+	memoryStageChunks   = "chunks"
+	// memoryStageReceive accounts series received by the proxy store, but not yet merged.
+	memoryStageReceive = "receive"
+)
+
+var memoryStages = []string{memoryStagePostings, memoryStageSeries, memoryStageChunks}
+
 type queryStats struct {
 	blocksQueried int
 
@@ -2109,6 +2391,9 @@ type queryStats struct {
 	mergedSeriesCount int
 	mergedChunksCount int
 	mergeDuration     time.Duration
+
+	// memoryUsed is the approximate number of bytes used by the query per stage. It is set once for the whole query.
+	memoryUsed map[string]uint64
 }
 
 func (s queryStats) merge(o *queryStats) *queryStats {
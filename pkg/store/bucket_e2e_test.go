@@ -161,6 +161,7 @@ func prepareStoreWithTestBlocks(t testing.TB, dir string, bkt objstore.Bucket, m
 		s.cache,
 		0,
 		maxSampleCount,
+		0,
 		20,
 		false,
 		20,
@@ -169,13 +170,14 @@ func prepareStoreWithTestBlocks(t testing.TB, dir string, bkt objstore.Bucket, m
 		true,
 		true,
 		DefaultPostingOffsetInMemorySampling,
+		DefaultPartitionerConfig(),
 		true,
 	)
 	testutil.Ok(t, err)
 	s.store = store
 
 	if manyParts {
-		s.store.partitioner = naivePartitioner{}
+		s.store.partitioners = blockPartitioners{postings: naivePartitioner{}, series: naivePartitioner{}, chunks: naivePartitioner{}}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -50,6 +50,9 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"github.com/thanos-io/thanos/pkg/tombstone"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gopkg.in/yaml.v2"
 )
 
@@ -185,6 +188,50 @@ func TestBucketBlock_Property(t *testing.T) {
 	properties.TestingRun(t)
 }
 
+func TestBucketBlockSet_customResolutions(t *testing.T) {
+	set := newBucketBlockSet(labels.Labels{})
+
+	res30m := int64(30 * 60 * 1000)
+	res6h := int64(6 * 60 * 60 * 1000)
+	for _, in := range []struct {
+		mint, maxt int64
+		window     int64
+	}{
+		{window: downsample.ResLevel0, mint: 0, maxt: 100},
+		{window: res30m, mint: 0, maxt: 200},
+		{window: res6h, mint: 0, maxt: 300},
+		{window: downsample.ResLevel1, mint: 200, maxt: 300},
+	} {
+		var m metadata.Meta
+		m.Thanos.Downsample.Resolution = in.window
+		m.MinTime = in.mint
+		m.MaxTime = in.maxt
+		testutil.Ok(t, set.add(&bucketBlock{meta: &m}))
+	}
+	testutil.Equals(t, []int64{res6h, downsample.ResLevel2, res30m, downsample.ResLevel1, downsample.ResLevel0}, set.resolutions)
+
+	var m metadata.Meta
+	m.Thanos.Downsample.Resolution = -1
+	testutil.NotOk(t, set.add(&bucketBlock{meta: &m}))
+
+	// The highest resolution not bigger than the max resolution is chosen.
+	for _, c := range []struct {
+		maxResolution int64
+		windows       []int64
+	}{
+		{maxResolution: 0, windows: []int64{downsample.ResLevel0}},
+		{maxResolution: res30m, windows: []int64{res30m, downsample.ResLevel1}},
+		{maxResolution: downsample.ResLevel2, windows: []int64{res30m, downsample.ResLevel1}},
+		{maxResolution: res6h, windows: []int64{res6h}},
+	} {
+		var windows []int64
+		for _, b := range set.getFor(0, 299, c.maxResolution) {
+			windows = append(windows, b.meta.Thanos.Downsample.Resolution)
+		}
+		testutil.Equals(t, c.windows, windows)
+	}
+}
+
 func TestBucketBlockSet_addGet(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -453,6 +500,16 @@ func TestGapBasedPartitioner_Partition(t *testing.T) {
 		})
 		testutil.Equals(t, c.expected, res)
 	}
+
+	// Batch size limits number of merged ranges, even if they are adjacent.
+	res := gapBasedPartitioner{maxGapSize: maxGapSize, maxElements: 2}.Partition(5, func(i int) (uint64, uint64) {
+		return uint64(i * 10), uint64(i*10 + 5)
+	})
+	testutil.Equals(t, []part{
+		{start: 0, end: 15, elemRng: [2]int{0, 2}},
+		{start: 20, end: 35, elemRng: [2]int{2, 4}},
+		{start: 40, end: 45, elemRng: [2]int{4, 5}},
+	}, res)
 }
 
 func TestBucketStore_Info(t *testing.T) {
@@ -476,6 +533,7 @@ func TestBucketStore_Info(t *testing.T) {
 		2e5,
 		0,
 		0,
+		0,
 		false,
 		20,
 		allowAllFilterConf,
@@ -483,6 +541,7 @@ func TestBucketStore_Info(t *testing.T) {
 		true,
 		true,
 		DefaultPostingOffsetInMemorySampling,
+		DefaultPartitionerConfig(),
 		false,
 	)
 	testutil.Ok(t, err)
@@ -729,6 +788,7 @@ func testSharding(t *testing.T, reuseDisk string, bkt objstore.Bucket, all ...ul
 				noopCache{},
 				0,
 				0,
+				0,
 				99,
 				false,
 				20,
@@ -737,6 +797,7 @@ func testSharding(t *testing.T, reuseDisk string, bkt objstore.Bucket, all ...ul
 				true,
 				true,
 				DefaultPostingOffsetInMemorySampling,
+				DefaultPartitionerConfig(),
 				false,
 			)
 			testutil.Ok(t, err)
@@ -1045,7 +1106,7 @@ func benchmarkExpandedPostings(
 				indexCache:        noopCache{},
 				bkt:               bkt,
 				meta:              &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id}},
-				partitioner:       gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
+				partitioners:      newGapBasedPartitioners(DefaultPartitionerConfig()),
 			}
 
 			indexr := newBucketIndexReader(context.Background(), b)
@@ -1079,7 +1140,7 @@ func newSeries(t testing.TB, lset labels.Labels, smplChunks [][]sample) storepb.
 		ch := storepb.AggrChunk{
 			MinTime: smpls[0].t,
 			MaxTime: smpls[len(smpls)-1].t,
-			Raw:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: c.Bytes()},
+			Raw:     storepb.NewChunk(storepb.Chunk_XOR, c.Bytes()),
 		}
 
 		s.Chunks = append(s.Chunks, ch)
@@ -1290,10 +1351,7 @@ func benchSeries(t testutil.TB, number int, dimension Dimension, cases ...int) {
 					series[0].Chunks = append(series[0].Chunks, storepb.AggrChunk{
 						MaxTime: c.MaxTime,
 						MinTime: c.MinTime,
-						Raw: &storepb.Chunk{
-							Data: raw.Bytes(),
-							Type: storepb.Chunk_XOR,
-						},
+						Raw:     storepb.NewChunk(storepb.Chunk_XOR, raw.Bytes()),
 					})
 				}
 			}
@@ -1308,7 +1366,7 @@ func benchSeries(t testutil.TB, number int, dimension Dimension, cases ...int) {
 			logger:          logger,
 			bkt:             bkt,
 			meta:            meta,
-			partitioner:     gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
+			partitioners:    newGapBasedPartitioners(DefaultPartitionerConfig()),
 			chunkObjs:       []string{filepath.Join(id.String(), "chunks", "000001")},
 			chunkPool:       chunkPool,
 			seriesRefetches: promauto.With(nil).NewCounter(prometheus.CounterOpts{}),
@@ -1517,13 +1575,13 @@ func TestSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(blockDir, id.String())))
 
 		b1 = &bucketBlock{
-			indexCache:  indexCache,
-			logger:      logger,
-			bkt:         bkt,
-			meta:        meta,
-			partitioner: gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
-			chunkObjs:   []string{filepath.Join(id.String(), "chunks", "000001")},
-			chunkPool:   chunkPool,
+			indexCache:   indexCache,
+			logger:       logger,
+			bkt:          bkt,
+			meta:         meta,
+			partitioners: newGapBasedPartitioners(DefaultPartitionerConfig()),
+			chunkObjs:    []string{filepath.Join(id.String(), "chunks", "000001")},
+			chunkPool:    chunkPool,
 		}
 		b1.indexHeaderReader, err = indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, b1.meta.ULID, DefaultPostingOffsetInMemorySampling)
 		testutil.Ok(t, err)
@@ -1555,13 +1613,13 @@ func TestSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(blockDir, id.String())))
 
 		b2 = &bucketBlock{
-			indexCache:  indexCache,
-			logger:      logger,
-			bkt:         bkt,
-			meta:        meta,
-			partitioner: gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
-			chunkObjs:   []string{filepath.Join(id.String(), "chunks", "000001")},
-			chunkPool:   chunkPool,
+			indexCache:   indexCache,
+			logger:       logger,
+			bkt:          bkt,
+			meta:         meta,
+			partitioners: newGapBasedPartitioners(DefaultPartitionerConfig()),
+			chunkObjs:    []string{filepath.Join(id.String(), "chunks", "000001")},
+			chunkPool:    chunkPool,
 		}
 		b2.indexHeaderReader, err = indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, b2.meta.ULID, DefaultPostingOffsetInMemorySampling)
 		testutil.Ok(t, err)
@@ -1681,6 +1739,7 @@ func TestSeries_HintsEnabled(t *testing.T) {
 		indexCache,
 		1000000,
 		10000,
+		0,
 		10,
 		false,
 		10,
@@ -1689,6 +1748,7 @@ func TestSeries_HintsEnabled(t *testing.T) {
 		true,
 		true,
 		DefaultPostingOffsetInMemorySampling,
+		DefaultPartitionerConfig(),
 		true,
 	)
 	testutil.Ok(tb, err)
@@ -1735,3 +1795,140 @@ func TestSeries_HintsEnabled(t *testing.T) {
 
 	benchmarkSeries(tb, store, testCases)
 }
+
+func TestSeries_MemoryLimit(t *testing.T) {
+	tb := testutil.NewTB(t)
+
+	tmpDir, err := ioutil.TempDir("", "test-series-memory-limit")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	bktDir := filepath.Join(tmpDir, "bkt")
+	bkt, err := filesystem.NewBucket(bktDir)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	var (
+		logger   = log.NewNopLogger()
+		instrBkt = objstore.WithNoopInstr(bkt)
+	)
+
+	block1, seriesSet1 := createBlockWithOneSample(tb, bktDir, 0, 100)
+	block2, seriesSet2 := createBlockWithOneSample(tb, bktDir, 1, 100)
+	for _, blockID := range []ulid.ULID{block1, block2} {
+		_, err := metadata.InjectThanos(logger, filepath.Join(bktDir, blockID.String()), metadata.Thanos{
+			Labels:     labels.Labels{{Name: "ext1", Value: "1"}}.Map(),
+			Downsample: metadata.ThanosDownsample{Resolution: 0},
+			Source:     metadata.TestSource,
+		}, nil)
+		testutil.Ok(t, err)
+	}
+
+	newStore := func(reg prometheus.Registerer, limit uint64) *BucketStore {
+		fetcher, err := block.NewMetaFetcher(logger, 10, instrBkt, tmpDir, nil, nil, nil)
+		testutil.Ok(t, err)
+
+		store, err := NewBucketStore(logger, reg, instrBkt, fetcher, tmpDir, noopCache{}, 1000000, 0, limit, 10, false, 10,
+			nil, false, true, true, DefaultPostingOffsetInMemorySampling, DefaultPartitionerConfig(), false)
+		testutil.Ok(t, err)
+		testutil.Ok(t, store.SyncBlocks(context.Background()))
+		return store
+	}
+	req := &storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  200,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"}},
+	}
+
+	// Query without limit to learn the number of bytes reserved per stage.
+	reg := prometheus.NewRegistry()
+	srv := newStoreSeriesServer(context.Background())
+	testutil.Ok(t, newStore(reg, 0).Series(req, srv))
+	testutil.Equals(t, len(seriesSet1)+len(seriesSet2), len(srv.SeriesSet))
+
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+	reserved := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "thanos_bucket_store_series_memory_used_bytes" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			reserved[m.GetLabel()[0].GetValue()] = m.GetSummary().GetSampleSum()
+		}
+	}
+	testutil.Equals(t, 3, len(reserved))
+	for stage, bytes := range reserved {
+		testutil.Assert(t, bytes > 0, "expected bytes reserved by stage %s", stage)
+	}
+
+	// Every series is accounted once, so the query fits into the sum of all stages.
+	store := newStore(nil, uint64(reserved[memoryStagePostings]+reserved[memoryStageSeries]+reserved[memoryStageChunks]))
+	srv = newStoreSeriesServer(context.Background())
+	testutil.Ok(t, store.Series(req, srv))
+	testutil.Equals(t, len(seriesSet1)+len(seriesSet2), len(srv.SeriesSet))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(store.metrics.queriesMemoryDropped))
+
+	// The query fails once the limit is exceeded.
+	store = newStore(nil, uint64(reserved[memoryStagePostings]))
+	err = store.Series(req, newStoreSeriesServer(context.Background()))
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(store.metrics.queriesMemoryDropped))
+}
+
+func TestMaskTombstones(t *testing.T) {
+	newChunk := func(mint, maxt int64) *storepb.Chunk {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		testutil.Ok(t, err)
+		for ts := mint; ts <= maxt; ts++ {
+			app.Append(ts, float64(ts))
+		}
+		return &storepb.Chunk{Type: storepb.Chunk_XOR, Data: c.Bytes()}
+	}
+	timestamps := func(c *storepb.Chunk) (res []int64) {
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+		testutil.Ok(t, err)
+		it := chk.Iterator(nil)
+		for it.Next() {
+			ts, _ := it.At()
+			res = append(res, ts)
+		}
+		testutil.Ok(t, it.Err())
+		return res
+	}
+	newTombstone := func(mint, maxt int64) *tombstone.Tombstone {
+		ts, err := tombstone.NewTombstone(`{job="node"}`, mint, maxt, "", "")
+		testutil.Ok(t, err)
+		return ts
+	}
+
+	testutil.Assert(t, tombstonesCover([]*tombstone.Tombstone{newTombstone(0, 5), newTombstone(0, 10)}, 2, 9), "expected chunk to be covered")
+	testutil.Assert(t, !tombstonesCover([]*tombstone.Tombstone{newTombstone(0, 5), newTombstone(6, 10)}, 2, 9), "unexpected cover")
+
+	// Non overlapping tombstones keep the chunk as is.
+	chk := storepb.AggrChunk{MinTime: 0, MaxTime: 9, Raw: newChunk(0, 9)}
+	ok, err := maskTombstones(&chk, []*tombstone.Tombstone{newTombstone(10, 20)})
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected samples left")
+	testutil.Equals(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, timestamps(chk.Raw))
+
+	ok, err = maskTombstones(&chk, []*tombstone.Tombstone{newTombstone(3, 5), newTombstone(8, 20)})
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected samples left")
+	testutil.Equals(t, []int64{0, 1, 2, 6, 7}, timestamps(chk.Raw))
+
+	// All aggregates are masked and sketches are dropped.
+	chk = storepb.AggrChunk{MinTime: 0, MaxTime: 9, Count: newChunk(0, 9), Sum: newChunk(0, 9), Sketch: &storepb.Chunk{Type: storepb.Chunk_SKETCH}}
+	ok, err = maskTombstones(&chk, []*tombstone.Tombstone{newTombstone(0, 8)})
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected samples left")
+	testutil.Equals(t, []int64{9}, timestamps(chk.Count))
+	testutil.Equals(t, []int64{9}, timestamps(chk.Sum))
+	testutil.Assert(t, chk.Sketch == nil, "expected sketch to be dropped")
+
+	ok, err = maskTombstones(&chk, []*tombstone.Tombstone{newTombstone(9, 9)})
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected no samples left")
+}
@@ -0,0 +1,81 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecache
+
+import (
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/model"
+)
+
+type CompressionType string
+
+const (
+	NOCOMPRESSION CompressionType = "NONE"
+	SNAPPY        CompressionType = "SNAPPY"
+)
+
+const (
+	// compressedKeyPrefix is prepended to keys of items stored with compression enabled, so that items stored
+	// without the encoding header, e.g. before compression was enabled, are never decoded.
+	compressedKeyPrefix = "C:"
+
+	itemEncodingRaw    byte = 0
+	itemEncodingSnappy byte = 1
+)
+
+// CompressionConfig specifies compression of items stored in remote index cache backends.
+type CompressionConfig struct {
+	Type CompressionType `yaml:"type"`
+	// MinItemSize represents minimum size of an item to be compressed. Smaller items are stored as they are.
+	MinItemSize model.Bytes `yaml:"min_item_size"`
+}
+
+func (c CompressionConfig) enabled() bool {
+	return c.Type != "" && strings.ToUpper(string(c.Type)) != string(NOCOMPRESSION)
+}
+
+func (c CompressionConfig) validate() error {
+	switch strings.ToUpper(string(c.Type)) {
+	case "", string(NOCOMPRESSION), string(SNAPPY):
+		return nil
+	default:
+		return errors.Errorf("compression type %s is not supported", c.Type)
+	}
+}
+
+// encodeItem returns v prefixed by the encoding header, compressed if it is at least minSize bytes and
+// compression makes it smaller.
+func encodeItem(v []byte, minSize uint64) (_ []byte, compressed bool) {
+	if uint64(len(v)) >= minSize {
+		buf := make([]byte, 1+snappy.MaxEncodedLen(len(v)))
+		buf[0] = itemEncodingSnappy
+		if enc := snappy.Encode(buf[1:], v); len(enc) < len(v) {
+			return buf[:1+len(enc)], true
+		}
+	}
+
+	buf := make([]byte, 1+len(v))
+	buf[0] = itemEncodingRaw
+	copy(buf[1:], v)
+	return buf, false
+}
+
+// decodeItem returns the original value of an item encoded by encodeItem.
+func decodeItem(v []byte) ([]byte, error) {
+	if len(v) == 0 {
+		return nil, errors.New("missing encoding header")
+	}
+
+	switch v[0] {
+	case itemEncodingRaw:
+		return v[1:], nil
+	case itemEncodingSnappy:
+		return snappy.Decode(nil, v[1:])
+	default:
+		return nil, errors.Errorf("unknown encoding %d", v[0])
+	}
+}
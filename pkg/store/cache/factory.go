@@ -26,6 +26,8 @@ const (
 type IndexCacheConfig struct {
 	Type   IndexCacheProvider `yaml:"type"`
 	Config interface{}        `yaml:"config"`
+	// Compression of items is supported only by remote cache backends.
+	Compression CompressionConfig `yaml:"compression,omitempty"`
 }
 
 // NewIndexCache initializes and returns new index cache.
@@ -44,12 +46,15 @@ func NewIndexCache(logger log.Logger, confContentYaml []byte, reg prometheus.Reg
 	var cache IndexCache
 	switch strings.ToUpper(string(cacheConfig.Type)) {
 	case string(INMEMORY):
+		if cacheConfig.Compression.enabled() {
+			return nil, errors.Errorf("compression is not supported by index cache with type %s", cacheConfig.Type)
+		}
 		cache, err = NewInMemoryIndexCache(logger, reg, backendConfig)
 	case string(MEMCACHED):
 		var memcached cacheutil.MemcachedClient
 		memcached, err = cacheutil.NewMemcachedClient(logger, "index-cache", backendConfig, reg)
 		if err == nil {
-			cache, err = NewMemcachedIndexCache(logger, memcached, reg)
+			cache, err = NewMemcachedIndexCache(logger, memcached, cacheConfig.Compression, reg)
 		}
 	default:
 		return nil, errors.Errorf("index cache with type %s is not supported", cacheConfig.Type)
@@ -25,16 +25,28 @@ type MemcachedIndexCache struct {
 	logger    log.Logger
 	memcached cacheutil.MemcachedClient
 
+	compress            bool
+	compressMinItemSize uint64
+
 	// Metrics.
-	requests *prometheus.CounterVec
-	hits     *prometheus.CounterVec
+	requests           *prometheus.CounterVec
+	hits               *prometheus.CounterVec
+	compressed         *prometheus.CounterVec
+	compressionSavings *prometheus.CounterVec
 }
 
 // NewMemcachedIndexCache makes a new MemcachedIndexCache.
-func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClient, reg prometheus.Registerer) (*MemcachedIndexCache, error) {
+// If compression is enabled, items are transparently compressed before they are stored in memcached.
+func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClient, compression CompressionConfig, reg prometheus.Registerer) (*MemcachedIndexCache, error) {
+	if err := compression.validate(); err != nil {
+		return nil, err
+	}
+
 	c := &MemcachedIndexCache{
-		logger:    logger,
-		memcached: memcached,
+		logger:              logger,
+		memcached:           memcached,
+		compress:            compression.enabled(),
+		compressMinItemSize: uint64(compression.MinItemSize),
 	}
 
 	c.requests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
@@ -51,7 +63,21 @@ func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClie
 	c.hits.WithLabelValues(cacheTypePostings)
 	c.hits.WithLabelValues(cacheTypeSeries)
 
-	level.Info(logger).Log("msg", "created memcached index cache")
+	c.compressed = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_compressed_items_total",
+		Help: "Total number of items compressed before storing them in the cache.",
+	}, []string{"item_type"})
+	c.compressed.WithLabelValues(cacheTypePostings)
+	c.compressed.WithLabelValues(cacheTypeSeries)
+
+	c.compressionSavings = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_compression_saved_bytes_total",
+		Help: "Total number of bytes saved by compressing items before storing them in the cache.",
+	}, []string{"item_type"})
+	c.compressionSavings.WithLabelValues(cacheTypePostings)
+	c.compressionSavings.WithLabelValues(cacheTypeSeries)
+
+	level.Info(logger).Log("msg", "created memcached index cache", "compression", c.compress)
 
 	return c, nil
 }
@@ -60,7 +86,7 @@ func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClie
 // The function enqueues the request and returns immediately: the entry will be
 // asynchronously stored in the cache.
 func (c *MemcachedIndexCache) StorePostings(ctx context.Context, blockID ulid.ULID, l labels.Label, v []byte) {
-	key := cacheKey{blockID, cacheKeyPostings(l)}.string()
+	key, v := c.encode(cacheKey{blockID, cacheKeyPostings(l)}, v)
 
 	if err := c.memcached.SetAsync(ctx, key, v, memcachedDefaultTTL); err != nil {
 		level.Error(c.logger).Log("msg", "failed to cache postings in memcached", "err", err)
@@ -77,7 +103,7 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 	keysMapping := map[labels.Label]string{}
 
 	for _, lbl := range lbls {
-		key := cacheKey{blockID, cacheKeyPostings(lbl)}.string()
+		key := c.key(cacheKey{blockID, cacheKeyPostings(lbl)})
 
 		keys = append(keys, key)
 		keysMapping[lbl] = key
@@ -108,6 +134,14 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 			misses = append(misses, lbl)
 			continue
 		}
+		if c.compress {
+			var err error
+			if value, err = decodeItem(value); err != nil {
+				level.Warn(c.logger).Log("msg", "failed to decode postings from memcached", "label", lbl.Name+":"+lbl.Value, "err", err)
+				misses = append(misses, lbl)
+				continue
+			}
+		}
 
 		hits[lbl] = value
 	}
@@ -120,7 +154,7 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 // The function enqueues the request and returns immediately: the entry will be
 // asynchronously stored in the cache.
 func (c *MemcachedIndexCache) StoreSeries(ctx context.Context, blockID ulid.ULID, id uint64, v []byte) {
-	key := cacheKey{blockID, cacheKeySeries(id)}.string()
+	key, v := c.encode(cacheKey{blockID, cacheKeySeries(id)}, v)
 
 	if err := c.memcached.SetAsync(ctx, key, v, memcachedDefaultTTL); err != nil {
 		level.Error(c.logger).Log("msg", "failed to cache series in memcached", "err", err)
@@ -137,7 +171,7 @@ func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid
 	keysMapping := map[uint64]string{}
 
 	for _, id := range ids {
-		key := cacheKey{blockID, cacheKeySeries(id)}.string()
+		key := c.key(cacheKey{blockID, cacheKeySeries(id)})
 
 		keys = append(keys, key)
 		keysMapping[id] = key
@@ -168,6 +202,14 @@ func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid
 			misses = append(misses, id)
 			continue
 		}
+		if c.compress {
+			var err error
+			if value, err = decodeItem(value); err != nil {
+				level.Warn(c.logger).Log("msg", "failed to decode series from memcached", "id", id, "err", err)
+				misses = append(misses, id)
+				continue
+			}
+		}
 
 		hits[id] = value
 	}
@@ -175,3 +217,25 @@ func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid
 	c.hits.WithLabelValues(cacheTypeSeries).Add(float64(len(hits)))
 	return hits, misses
 }
+
+// key returns the memcached key of the item.
+func (c *MemcachedIndexCache) key(k cacheKey) string {
+	if c.compress {
+		return compressedKeyPrefix + k.string()
+	}
+	return k.string()
+}
+
+// encode returns the memcached key and the value to be stored for the item, compressing the value if enabled.
+func (c *MemcachedIndexCache) encode(k cacheKey, v []byte) (string, []byte) {
+	if !c.compress {
+		return k.string(), v
+	}
+
+	encoded, compressed := encodeItem(v, c.compressMinItemSize)
+	if compressed {
+		c.compressed.WithLabelValues(k.keyType()).Inc()
+		c.compressionSavings.WithLabelValues(k.keyType()).Add(float64(len(v) - len(encoded)))
+	}
+	return compressedKeyPrefix + k.string(), encoded
+}
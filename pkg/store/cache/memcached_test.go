@@ -4,6 +4,7 @@
 package storecache
 
 import (
+	"bytes"
 	"context"
 	"testing"
 	"time"
@@ -85,7 +86,7 @@ func TestMemcachedIndexCache_FetchMultiPostings(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			memcached := newMockedMemcachedClient(testData.mockedErr)
-			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, nil)
+			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, CompressionConfig{}, nil)
 			testutil.Ok(t, err)
 
 			// Store the postings expected before running the test.
@@ -175,7 +176,7 @@ func TestMemcachedIndexCache_FetchMultiSeries(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			memcached := newMockedMemcachedClient(testData.mockedErr)
-			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, nil)
+			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, CompressionConfig{}, nil)
 			testutil.Ok(t, err)
 
 			// Store the series expected before running the test.
@@ -198,6 +199,47 @@ func TestMemcachedIndexCache_FetchMultiSeries(t *testing.T) {
 	}
 }
 
+func TestMemcachedIndexCache_Compression(t *testing.T) {
+	block := ulid.MustNew(1, nil)
+	label := labels.Label{Name: "instance", Value: "a"}
+	postings := bytes.Repeat([]byte{1, 2, 3, 4}, 256)
+	series := []byte{1, 2, 3}
+
+	memcached := newMockedMemcachedClient(nil)
+	c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, CompressionConfig{Type: SNAPPY, MinItemSize: 16}, nil)
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	c.StorePostings(ctx, block, label, postings)
+	c.StoreSeries(ctx, block, 1, series)
+
+	// Only items at least of the min size are compressed.
+	testutil.Equals(t, 1.0, prom_testutil.ToFloat64(c.compressed.WithLabelValues(cacheTypePostings)))
+	testutil.Equals(t, 0.0, prom_testutil.ToFloat64(c.compressed.WithLabelValues(cacheTypeSeries)))
+	testutil.Assert(t, prom_testutil.ToFloat64(c.compressionSavings.WithLabelValues(cacheTypePostings)) > 0, "expected compression to save bytes")
+
+	postingsHits, postingsMisses := c.FetchMultiPostings(ctx, block, []labels.Label{label})
+	testutil.Equals(t, map[labels.Label][]byte{label: postings}, postingsHits)
+	testutil.Equals(t, 0, len(postingsMisses))
+
+	seriesHits, seriesMisses := c.FetchMultiSeries(ctx, block, []uint64{1})
+	testutil.Equals(t, map[uint64][]byte{1: series}, seriesHits)
+	testutil.Equals(t, 0, len(seriesMisses))
+
+	// Items stored without compression are never returned by the cache with compression enabled and vice versa.
+	uncompressed, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, CompressionConfig{Type: NOCOMPRESSION}, nil)
+	testutil.Ok(t, err)
+	uncompressed.StoreSeries(ctx, block, 2, series)
+
+	_, seriesMisses = c.FetchMultiSeries(ctx, block, []uint64{2})
+	testutil.Equals(t, []uint64{2}, seriesMisses)
+	_, seriesMisses = uncompressed.FetchMultiSeries(ctx, block, []uint64{1})
+	testutil.Equals(t, []uint64{1}, seriesMisses)
+
+	_, err = NewMemcachedIndexCache(log.NewNopLogger(), memcached, CompressionConfig{Type: "unknown"}, nil)
+	testutil.NotOk(t, err)
+}
+
 type mockedPostings struct {
 	block ulid.ULID
 	label labels.Label
@@ -4,6 +4,8 @@
 package store
 
 import (
+	"sync"
+
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -36,3 +38,93 @@ func (l *Limiter) Check(num uint64) error {
 	}
 	return nil
 }
+
+// QueryMemoryTracker tracks approximate number of bytes in use by a single query, broken down by the processing
+// stage which allocated them, e.g. fetching postings or receiving series. Bytes are released once the query does
+// not hold them anymore, so the limit applies to bytes in use at the same time. Go-routine safe.
+type QueryMemoryTracker struct {
+	limit uint64
+
+	// Counter metric which we will increase if Reserve() fails for the first time.
+	failedCounter prometheus.Counter
+
+	mtx    sync.Mutex
+	used   uint64
+	peak   uint64
+	stages map[string]uint64
+	failed bool
+}
+
+// NewQueryMemoryTracker returns a new tracker failing reservations above the limit. 0 disables the limit.
+func NewQueryMemoryTracker(limit uint64, ctr prometheus.Counter) *QueryMemoryTracker {
+	return &QueryMemoryTracker{limit: limit, failedCounter: ctr, stages: map[string]uint64{}}
+}
+
+// Reserve accounts the given number of bytes to the stage. It returns an error if the total number of bytes
+// in use by the query exceeds the limit.
+func (t *QueryMemoryTracker) Reserve(stage string, bytes uint64) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.used += bytes
+	t.stages[stage] += bytes
+	if t.used > t.peak {
+		t.peak = t.used
+	}
+
+	if t.limit == 0 || t.used <= t.limit {
+		return nil
+	}
+	if !t.failed {
+		t.failed = true
+		t.failedCounter.Inc()
+	}
+	return errors.Errorf("query memory limit %v violated (got %v, %v in stage %s)", t.limit, t.used, t.stages[stage], stage)
+}
+
+// Release returns the given number of bytes reserved before.
+func (t *QueryMemoryTracker) Release(bytes uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if bytes > t.used {
+		bytes = t.used
+	}
+	t.used -= bytes
+}
+
+// Exceeded returns true if any reservation exceeded the limit.
+func (t *QueryMemoryTracker) Exceeded() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.failed
+}
+
+// Used returns the total number of bytes in use by the query.
+func (t *QueryMemoryTracker) Used() uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.used
+}
+
+// Peak returns the maximum number of bytes in use by the query at the same time.
+func (t *QueryMemoryTracker) Peak() uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.peak
+}
+
+// Stages returns the number of bytes reserved by the query per stage.
+func (t *QueryMemoryTracker) Stages() map[string]uint64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	res := make(map[string]uint64, len(t.stages))
+	for stage, bytes := range t.stages {
+		res[stage] = bytes
+	}
+	return res
+}
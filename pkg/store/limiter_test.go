@@ -0,0 +1,44 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQueryMemoryTracker(t *testing.T) {
+	c := prometheus.NewCounter(prometheus.CounterOpts{})
+
+	tr := NewQueryMemoryTracker(100, c)
+	testutil.Ok(t, tr.Reserve(memoryStagePostings, 40))
+	testutil.Ok(t, tr.Reserve(memoryStageSeries, 60))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(c))
+
+	testutil.NotOk(t, tr.Reserve(memoryStageChunks, 1))
+	testutil.NotOk(t, tr.Reserve(memoryStageChunks, 1))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(c))
+	testutil.Assert(t, tr.Exceeded(), "expected limit to be exceeded")
+
+	// Released bytes can be reserved again.
+	tr.Release(42)
+	testutil.Equals(t, uint64(60), tr.Used())
+	testutil.Ok(t, tr.Reserve(memoryStageChunks, 40))
+	testutil.Equals(t, uint64(100), tr.Used())
+	testutil.Equals(t, uint64(102), tr.Peak())
+	testutil.Equals(t, map[string]uint64{
+		memoryStagePostings: 40,
+		memoryStageSeries:   60,
+		memoryStageChunks:   42,
+	}, tr.Stages())
+
+	// No limit.
+	tr = NewQueryMemoryTracker(0, c)
+	testutil.Ok(t, tr.Reserve(memoryStageChunks, 1<<40))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(c))
+	testutil.Assert(t, !tr.Exceeded(), "expected limit not to be exceeded")
+}
@@ -6,6 +6,7 @@ package store
 import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -54,3 +55,26 @@ func matchersToString(ms []storepb.LabelMatcher) (string, error) {
 
 	return "{" + res + "}", nil
 }
+
+// shardSeriesServer drops the series not belonging to the shard of a request.
+type shardSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	shard querysharding.Shard
+}
+
+// newShardSeriesServer returns a server sending only the series of the shard of the given request, if it has one.
+func newShardSeriesServer(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) storepb.Store_SeriesServer {
+	shard, ok := querysharding.ShardFromProto(r.ShardInfo)
+	if !ok {
+		return srv
+	}
+	return &shardSeriesServer{Store_SeriesServer: srv, shard: shard}
+}
+
+func (s *shardSeriesServer) Send(r *storepb.SeriesResponse) error {
+	if series := r.GetSeries(); series != nil && !s.shard.Matches(storepb.LabelsToPromLabelsUnsafe(series.Labels)) {
+		return nil
+	}
+	return s.Store_SeriesServer.Send(r)
+}
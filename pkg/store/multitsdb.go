@@ -0,0 +1,253 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MultiTSDBStore implements the store API against the TSDBs of many tenants, e.g. of a receiver. Every TSDB is
+// served with its own external labels, so that queries can be scoped to tenants by matching on them.
+type MultiTSDBStore struct {
+	logger     log.Logger
+	component  component.SourceStoreAPI
+	tsdbStores func() map[string]*TSDBStore
+}
+
+// NewMultiTSDBStore creates a new MultiTSDBStore of the TSDBStores returned by the given function, by tenant.
+func NewMultiTSDBStore(logger log.Logger, _ prometheus.Registerer, component component.SourceStoreAPI, tsdbStores func() map[string]*TSDBStore) *MultiTSDBStore {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &MultiTSDBStore{
+		logger:     logger,
+		component:  component,
+		tsdbStores: tsdbStores,
+	}
+}
+
+// sortedStores returns the TSDBStores sorted by tenant.
+func (s *MultiTSDBStore) sortedStores() []*TSDBStore {
+	stores := s.tsdbStores()
+	tenants := make([]string, 0, len(stores))
+	for tenant := range stores {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	res := make([]*TSDBStore, 0, len(stores))
+	for _, tenant := range tenants {
+		res = append(res, stores[tenant])
+	}
+	return res
+}
+
+// Info returns the label sets of all tenants and the time range covered by their TSDBs.
+func (s *MultiTSDBStore) Info(ctx context.Context, r *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	res := &storepb.InfoResponse{
+		StoreType: s.component.ToProto(),
+		MinTime:   math.MaxInt64,
+		MaxTime:   math.MaxInt64,
+		LabelSets: []storepb.LabelSet{},
+	}
+
+	stores := s.sortedStores()
+	if len(stores) == 0 {
+		res.MinTime = 0
+	}
+	for _, st := range stores {
+		info, err := st.Info(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		if info.MinTime < res.MinTime {
+			res.MinTime = info.MinTime
+		}
+		res.LabelSets = append(res.LabelSets, info.LabelSets...)
+	}
+	return res, nil
+}
+
+// Series returns the series of all tenants whose external labels match the request, merged and sorted by labels.
+// Tenants are queried concurrently and their series are merged as they are sent, so that they are not buffered.
+// Like series of a single TSDBStore, series of every tenant are expected to be sorted by labels.
+func (s *MultiTSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	ctx, cancel := context.WithCancel(srv.Context())
+	defer cancel()
+
+	stores := s.sortedStores()
+	sets := make([]storepb.SeriesSet, 0, len(stores))
+	streams := make([]*streamedSeriesSet, 0, len(stores))
+	for _, st := range stores {
+		st := st
+		set := newStreamedSeriesSet(ctx, func(srv storepb.Store_SeriesServer) error { return st.Series(r, srv) })
+		sets = append(sets, set)
+		streams = append(streams, set)
+	}
+	// Stop tenants still sending series, e.g. if sending to the client failed.
+	defer func() {
+		cancel()
+		for _, set := range streams {
+			set.drain()
+		}
+	}()
+
+	set := storepb.MergeSeriesSets(sets...)
+	for set.Next() {
+		lset, chks := set.At()
+		if err := srv.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: lset, Chunks: chks})); err != nil {
+			return status.Error(codes.Aborted, err.Error())
+		}
+	}
+	if err := set.Err(); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, st := range streams {
+		for _, w := range st.warnings {
+			if err := srv.Send(storepb.NewWarnSeriesResponse(errors.New(w))); err != nil {
+				return status.Error(codes.Aborted, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// streamedSeriesSet is a storepb.SeriesSet of the series sent by a Series call running in its own goroutine. Series
+// are handed over one at a time, so the call is blocked until the previous series was consumed. Warnings are
+// collected until the set is exhausted.
+type streamedSeriesSet struct {
+	responses chan *storepb.SeriesResponse
+	// err is the error of the Series call, which is set before responses is closed.
+	err  error
+	done bool
+
+	cur      storepb.Series
+	warnings []string
+}
+
+// newStreamedSeriesSet runs the given Series call in a new goroutine, which stops sending once the context is done.
+// Sets that are not exhausted have to be drained after canceling the context.
+func newStreamedSeriesSet(ctx context.Context, series func(storepb.Store_SeriesServer) error) *streamedSeriesSet {
+	s := &streamedSeriesSet{responses: make(chan *storepb.SeriesResponse)}
+	go func() {
+		s.err = series(&streamedSeriesServer{ctx: ctx, responses: s.responses})
+		close(s.responses)
+	}()
+	return s
+}
+
+func (s *streamedSeriesSet) Next() bool {
+	for r := range s.responses {
+		if w := r.GetWarning(); w != "" {
+			s.warnings = append(s.warnings, w)
+			continue
+		}
+		if series := r.GetSeries(); series != nil {
+			s.cur = *series
+			return true
+		}
+	}
+	s.done = true
+	return false
+}
+
+func (s *streamedSeriesSet) At() ([]storepb.Label, []storepb.AggrChunk) {
+	return s.cur.Labels, s.cur.Chunks
+}
+
+// Err returns the error of the Series call, once it returned.
+func (s *streamedSeriesSet) Err() error {
+	if !s.done {
+		return nil
+	}
+	return s.err
+}
+
+// drain waits for the Series call to return, discarding series not consumed yet.
+func (s *streamedSeriesSet) drain() {
+	for range s.responses {
+	}
+	s.done = true
+}
+
+// streamedSeriesServer hands series sent by a store over to a streamedSeriesSet.
+type streamedSeriesServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.Store_SeriesServer
+	ctx context.Context
+
+	responses chan<- *storepb.SeriesResponse
+}
+
+func (s *streamedSeriesServer) Send(r *storepb.SeriesResponse) error {
+	if series := r.GetSeries(); series != nil {
+		// Stores might reuse the sent series, e.g. TSDBStore reuses the chunks slice.
+		r = storepb.NewSeriesResponse(&storepb.Series{
+			Labels: append([]storepb.Label(nil), series.Labels...),
+			Chunks: append([]storepb.AggrChunk(nil), series.Chunks...),
+		})
+	}
+	select {
+	case s.responses <- r:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *streamedSeriesServer) Context() context.Context {
+	return s.ctx
+}
+
+// LabelNames returns all known label names of all tenants.
+func (s *MultiTSDBStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	names := map[string]struct{}{}
+	for _, st := range s.sortedStores() {
+		res, err := st.LabelNames(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range res.Names {
+			names[n] = struct{}{}
+		}
+	}
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
+}
+
+// LabelValues returns all known label values of all tenants for a given label name.
+func (s *MultiTSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	values := map[string]struct{}{}
+	for _, st := range s.sortedStores() {
+		res, err := st.LabelValues(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range res.Values {
+			values[v] = struct{}{}
+		}
+	}
+	return &storepb.LabelValuesResponse{Values: sortedKeys(values)}, nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
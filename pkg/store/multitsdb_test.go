@@ -0,0 +1,143 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMultiTSDBStore(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stores := map[string]*TSDBStore{}
+	for _, tenant := range []string{"b", "a"} {
+		db, err := e2eutil.NewTSDB()
+		defer func() { testutil.Ok(t, db.Close()) }()
+		testutil.Ok(t, err)
+
+		app := db.Appender()
+		for i := 1; i <= 3; i++ {
+			_, err = app.Add(labels.FromStrings("a", "1"), int64(i), float64(i))
+			testutil.Ok(t, err)
+		}
+		testutil.Ok(t, app.Commit())
+
+		stores[tenant] = NewTSDBStore(nil, nil, db, component.Receive, labels.FromStrings("replica", "0", "tenant_id", tenant))
+	}
+	multiStore := NewMultiTSDBStore(nil, nil, component.Receive, func() map[string]*TSDBStore { return stores })
+
+	info, err := multiStore.Info(ctx, &storepb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, storepb.StoreType_RECEIVE, info.StoreType)
+	testutil.Equals(t, int64(math.MaxInt64), info.MaxTime)
+	testutil.Equals(t, []storepb.LabelSet{
+		{Labels: []storepb.Label{{Name: "replica", Value: "0"}, {Name: "tenant_id", Value: "a"}}},
+		{Labels: []storepb.Label{{Name: "replica", Value: "0"}, {Name: "tenant_id", Value: "b"}}},
+	}, info.LabelSets)
+
+	for _, tc := range []struct {
+		title          string
+		matchers       []storepb.LabelMatcher
+		expectedSeries []rawSeries
+	}{
+		{
+			title:    "all tenants",
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+			expectedSeries: []rawSeries{
+				{
+					lset:   []storepb.Label{{Name: "a", Value: "1"}, {Name: "replica", Value: "0"}, {Name: "tenant_id", Value: "a"}},
+					chunks: [][]sample{{{1, 1}, {2, 2}, {3, 3}}},
+				},
+				{
+					lset:   []storepb.Label{{Name: "a", Value: "1"}, {Name: "replica", Value: "0"}, {Name: "tenant_id", Value: "b"}},
+					chunks: [][]sample{{{1, 1}, {2, 2}, {3, 3}}},
+				},
+			},
+		},
+		{
+			title: "single tenant",
+			matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				{Type: storepb.LabelMatcher_EQ, Name: "tenant_id", Value: "b"},
+			},
+			expectedSeries: []rawSeries{
+				{
+					lset:   []storepb.Label{{Name: "a", Value: "1"}, {Name: "replica", Value: "0"}, {Name: "tenant_id", Value: "b"}},
+					chunks: [][]sample{{{1, 1}, {2, 2}, {3, 3}}},
+				},
+			},
+		},
+		{
+			title: "unknown tenant",
+			matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				{Type: storepb.LabelMatcher_EQ, Name: "tenant_id", Value: "c"},
+			},
+			expectedSeries: []rawSeries{},
+		},
+	} {
+		if ok := t.Run(tc.title, func(t *testing.T) {
+			srv := newStoreSeriesServer(ctx)
+			testutil.Ok(t, multiStore.Series(&storepb.SeriesRequest{MinTime: 1, MaxTime: 3, Matchers: tc.matchers}, srv))
+			seriesEquals(t, tc.expectedSeries, srv.SeriesSet)
+		}); !ok {
+			return
+		}
+	}
+}
+
+type failingSeriesServer struct {
+	storepb.Store_SeriesServer
+	ctx context.Context
+}
+
+func (s *failingSeriesServer) Send(*storepb.SeriesResponse) error { return errors.New("client gone") }
+func (s *failingSeriesServer) Context() context.Context           { return s.ctx }
+
+func TestMultiTSDBStore_SeriesStopsTenantsOnSendFailure(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	stores := map[string]*TSDBStore{}
+	for _, tenant := range []string{"a", "b", "c"} {
+		db, err := e2eutil.NewTSDB()
+		defer func() { testutil.Ok(t, db.Close()) }()
+		testutil.Ok(t, err)
+
+		app := db.Appender()
+		for i := 0; i < 100; i++ {
+			_, err = app.Add(labels.FromStrings("a", "1", "i", strconv.Itoa(i)), 1, float64(i))
+			testutil.Ok(t, err)
+		}
+		testutil.Ok(t, app.Commit())
+
+		stores[tenant] = NewTSDBStore(nil, nil, db, component.Receive, labels.FromStrings("tenant_id", tenant))
+	}
+	multiStore := NewMultiTSDBStore(nil, nil, component.Receive, func() map[string]*TSDBStore { return stores })
+
+	// Tenants blocked on handing over their series are stopped once sending to the client fails.
+	err := multiStore.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  2,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, &failingSeriesServer{ctx: context.Background()})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.Aborted, status.Code(err))
+}
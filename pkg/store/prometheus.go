@@ -62,6 +62,7 @@ type PrometheusStore struct {
 	timestamps     func() (mint int64, maxt int64)
 
 	remoteReadAcceptableResponses []prompb.ReadRequest_ResponseType
+	streamedRemoteRead            func() bool
 }
 
 const (
@@ -105,6 +106,13 @@ func NewPrometheusStore(
 	return p, nil
 }
 
+// WithStreamedRemoteRead sets the function telling whether Prometheus supports streamed remote read. If it returns
+// false, only sampled responses are requested. By default streamed responses are requested and the response type is
+// negotiated.
+func (p *PrometheusStore) WithStreamedRemoteRead(supported func() bool) {
+	p.streamedRemoteRead = supported
+}
+
 // Info returns store information about the Prometheus instance.
 // NOTE(bwplotka): MaxTime & MinTime are not accurate nor adjusted dynamically.
 // This is fine for now, but might be needed in future.
@@ -147,6 +155,7 @@ func (p *PrometheusStore) putBuffer(b *[]byte) {
 
 // Series returns all series for a requested time range and label matcher.
 func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_SeriesServer) error {
+	s = newShardSeriesServer(r, s)
 	externalLabels := p.externalLabels()
 
 	match, newMatchers, err := matchesExternalLabels(r.Matchers, externalLabels)
@@ -337,13 +346,10 @@ func (p *PrometheusStore) handleStreamedPrometheusResponse(s storepb.Store_Serie
 				thanosChks[i] = storepb.AggrChunk{
 					MaxTime: chk.MaxTimeMs,
 					MinTime: chk.MinTimeMs,
-					Raw: &storepb.Chunk{
-						Data: chk.Data,
-						// Prometheus ChunkEncoding vs ours https://github.com/thanos-io/thanos/blob/master/pkg/store/storepb/types.proto#L19
-						// has one difference. Prometheus has Chunk_UNKNOWN Chunk_Encoding = 0 vs we start from
-						// XOR as 0. Compensate for that here:
-						Type: storepb.Chunk_Encoding(chk.Type - 1),
-					},
+					// Prometheus ChunkEncoding vs ours https://github.com/thanos-io/thanos/blob/master/pkg/store/storepb/types.proto#L19
+					// has one difference. Prometheus has Chunk_UNKNOWN Chunk_Encoding = 0 vs we start from
+					// XOR as 0. Compensate for that here:
+					Raw: storepb.NewChunk(storepb.Chunk_Encoding(chk.Type-1), chk.Data),
 				}
 				// Drop the reference to data from non protobuf for GC.
 				series.Chunks[i].Data = nil
@@ -412,7 +418,7 @@ func (p *PrometheusStore) chunkSamples(series *prompb.TimeSeries, maxSamplesPerC
 		chks = append(chks, storepb.AggrChunk{
 			MinTime: int64(samples[0].Timestamp),
 			MaxTime: int64(samples[chunkSize-1].Timestamp),
-			Raw:     &storepb.Chunk{Type: enc, Data: cb},
+			Raw:     storepb.NewChunk(enc, cb),
 		})
 
 		samples = samples[chunkSize:]
@@ -422,9 +428,14 @@ func (p *PrometheusStore) chunkSamples(series *prompb.TimeSeries, maxSamplesPerC
 }
 
 func (p *PrometheusStore) startPromSeries(ctx context.Context, q *prompb.Query) (presp *http.Response, err error) {
+	acceptedResponseTypes := p.remoteReadAcceptableResponses
+	if p.streamedRemoteRead != nil && !p.streamedRemoteRead() {
+		acceptedResponseTypes = []prompb.ReadRequest_ResponseType{prompb.ReadRequest_SAMPLES}
+	}
+
 	reqb, err := proto.Marshal(&prompb.ReadRequest{
 		Queries:               []*prompb.Query{q},
-		AcceptedResponseTypes: p.remoteReadAcceptableResponses,
+		AcceptedResponseTypes: acceptedResponseTypes,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "marshal read request")
@@ -53,12 +53,16 @@ type ProxyStore struct {
 	component      component.StoreAPI
 	selectorLabels labels.Labels
 
-	responseTimeout time.Duration
-	metrics         *proxyStoreMetrics
+	responseTimeout     time.Duration
+	verifyChunkHashes   bool
+	maxQueryMemoryBytes uint64
+	metrics             *proxyStoreMetrics
 }
 
 type proxyStoreMetrics struct {
 	emptyStreamResponses prometheus.Counter
+	chunkHashMismatches  *prometheus.CounterVec
+	queriesMemoryDropped prometheus.Counter
 }
 
 func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
@@ -68,12 +72,23 @@ func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
 		Name: "thanos_proxy_store_empty_stream_responses_total",
 		Help: "Total number of empty responses received.",
 	})
+	m.chunkHashMismatches = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_chunk_hash_mismatches_total",
+		Help: "Total number of series responses with a chunk not matching its hash, by store.",
+	}, []string{"store"})
+	m.queriesMemoryDropped = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_queries_dropped_memory_limit_total",
+		Help: "Number of queries that were dropped due to the per-query memory limit.",
+	})
 
 	return &m
 }
 
 // NewProxyStore returns a new ProxyStore that uses the given clients that implements storeAPI to fan-in all series to the client.
 // Note that there is no deduplication support. Deduplication should be done on the highest level (just before PromQL).
+// If verifyChunkHashes is true, hashes of received chunks are verified and a store sending a chunk not matching its hash
+// is treated as failed for the request. If maxQueryMemoryBytes is not 0, a query merging more than the given
+// approximate number of bytes of series is aborted.
 func NewProxyStore(
 	logger log.Logger,
 	reg prometheus.Registerer,
@@ -81,6 +96,8 @@ func NewProxyStore(
 	component component.StoreAPI,
 	selectorLabels labels.Labels,
 	responseTimeout time.Duration,
+	verifyChunkHashes bool,
+	maxQueryMemoryBytes uint64,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -88,12 +105,14 @@ func NewProxyStore(
 
 	metrics := newProxyStoreMetrics(reg)
 	s := &ProxyStore{
-		logger:          logger,
-		stores:          stores,
-		component:       component,
-		selectorLabels:  selectorLabels,
-		responseTimeout: responseTimeout,
-		metrics:         metrics,
+		logger:              logger,
+		stores:              stores,
+		component:           component,
+		selectorLabels:      selectorLabels,
+		responseTimeout:     responseTimeout,
+		verifyChunkHashes:   verifyChunkHashes,
+		maxQueryMemoryBytes: maxQueryMemoryBytes,
+		metrics:             metrics,
 	}
 	return s
 }
@@ -218,6 +237,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		// Allow to buffer max 10 series response.
 		// Each might be quite large (multi chunk long series given by sidecar).
 		respSender, respRecv, closeFn = newRespCh(gctx, 10)
+		memTracker                    = NewQueryMemoryTracker(s.maxQueryMemoryBytes, s.metrics.queriesMemoryDropped)
 	)
 
 	g.Go(func() error {
@@ -232,6 +252,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				MaxResolutionWindow:     r.MaxResolutionWindow,
 				SkipChunks:              r.SkipChunks,
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				ShardInfo:               r.ShardInfo,
 			}
 			wg = &sync.WaitGroup{}
 		)
@@ -280,8 +301,12 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 
 			// Schedule streamSeriesSet that translates gRPC streamed response
 			// into seriesSet (if series) or respCh if warnings.
+			var chunkHashMismatches prometheus.Counter
+			if s.verifyChunkHashes {
+				chunkHashMismatches = s.metrics.chunkHashMismatches.WithLabelValues(st.Addr())
+			}
 			seriesSet = append(seriesSet, startStreamSeriesSet(seriesCtx, s.logger, closeSeries,
-				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses))
+				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses, chunkHashMismatches, memTracker))
 		}
 
 		level.Debug(s.logger).Log("msg", strings.Join(storeDebugMsgs, ";"))
@@ -310,6 +335,9 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 
 	if err := g.Wait(); err != nil {
 		level.Error(s.logger).Log("err", err)
+		if memTracker.Exceeded() {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return err
 	}
 	return nil
@@ -330,6 +358,7 @@ type streamSeriesSet struct {
 
 	currSeries *storepb.Series
 	recvCh     chan *storepb.Series
+	memTracker *QueryMemoryTracker
 
 	errMtx sync.Mutex
 	err    error
@@ -367,6 +396,8 @@ func startStreamSeriesSet(
 	partialResponse bool,
 	responseTimeout time.Duration,
 	emptyStreamResponses prometheus.Counter,
+	chunkHashMismatches prometheus.Counter,
+	memTracker *QueryMemoryTracker,
 ) *streamSeriesSet {
 	s := &streamSeriesSet{
 		ctx:             ctx,
@@ -375,6 +406,7 @@ func startStreamSeriesSet(
 		stream:          stream,
 		warnCh:          warnCh,
 		recvCh:          make(chan *storepb.Series, 10),
+		memTracker:      memTracker,
 		name:            name,
 		partialResponse: partialResponse,
 		responseTimeout: responseTimeout,
@@ -435,6 +467,20 @@ func startStreamSeriesSet(
 			}
 
 			if series := rr.r.GetSeries(); series != nil {
+				// Chunks are verified only if chunkHashMismatches is set.
+				if chunkHashMismatches != nil {
+					if err := series.VerifyChunkHashes(); err != nil {
+						chunkHashMismatches.Inc()
+						s.handleErr(errors.Wrapf(err, "receive series from %s", s.name), done)
+						return
+					}
+				}
+				// Series are accounted from receiving until the merge moves on to the next series of the stream. The
+				// memory limit aborts the query even with partial response enabled.
+				if err := s.memTracker.Reserve(memoryStageReceive, uint64(series.Size())); err != nil {
+					s.abort(errors.Wrapf(err, "receive series from %s", s.name), done)
+					return
+				}
 				select {
 				case s.recvCh <- series:
 				case <-ctx.Done():
@@ -448,14 +494,22 @@ func startStreamSeriesSet(
 }
 
 func (s *streamSeriesSet) handleErr(err error, done chan struct{}) {
+	if !s.partialResponse {
+		s.abort(err, done)
+		return
+	}
+	defer close(done)
+	s.closeSeries()
+
+	level.Warn(s.logger).Log("err", err, "msg", "returning partial response")
+	s.warnCh.send(storepb.NewWarnSeriesResponse(err))
+}
+
+// abort stops receiving and fails the series set with the given error regardless of the partial response strategy.
+func (s *streamSeriesSet) abort(err error, done chan struct{}) {
 	defer close(done)
 	s.closeSeries()
 
-	if s.partialResponse {
-		level.Warn(s.logger).Log("err", err, "msg", "returning partial response")
-		s.warnCh.send(storepb.NewWarnSeriesResponse(err))
-		return
-	}
 	s.errMtx.Lock()
 	s.err = err
 	s.errMtx.Unlock()
@@ -463,6 +517,9 @@ func (s *streamSeriesSet) handleErr(err error, done chan struct{}) {
 
 // Next blocks until new message is received or stream is closed or operation is timed out.
 func (s *streamSeriesSet) Next() (ok bool) {
+	if s.currSeries != nil {
+		s.memTracker.Release(uint64(s.currSeries.Size()))
+	}
 	s.currSeries, ok = <-s.recvCh
 	return ok
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/component"
@@ -62,6 +63,8 @@ func TestProxyStore_Info(t *testing.T) {
 		func() []Client { return nil },
 		component.Query,
 		nil, 0*time.Second,
+		false,
+		0,
 	)
 
 	resp, err := q.Info(ctx, &storepb.InfoRequest{})
@@ -423,6 +426,8 @@ func TestProxyStore_Series(t *testing.T) {
 				component.Query,
 				tc.selectorLabels,
 				0*time.Second,
+				false,
+				0,
 			)
 
 			s := newStoreSeriesServer(context.Background())
@@ -943,6 +948,8 @@ func TestProxyStore_SeriesSlowStores(t *testing.T) {
 				component.Query,
 				tc.selectorLabels,
 				4*time.Second,
+				false,
+				0,
 			)
 
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -992,6 +999,8 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 		component.Query,
 		nil,
 		0*time.Second,
+		false,
+		0,
 	)
 
 	ctx := context.Background()
@@ -1013,6 +1022,59 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 	testutil.Assert(t, proto.Equal(req, m.LastSeriesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", req, m.LastSeriesReq)
 }
 
+func TestProxyStore_Series_VerifyChunkHashes(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	valid := storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {2, 1}, {3, 2}})
+	valid.GetSeries().Chunks[0].Raw.Hash = storepb.ChunkHash(valid.GetSeries().Chunks[0].Raw.Data)
+	corrupted := storeSeriesResponse(t, labels.FromStrings("a", "2"), []sample{{0, 0}, {2, 1}, {3, 2}})
+	corrupted.GetSeries().Chunks[0].Raw.Hash = storepb.ChunkHash(corrupted.GetSeries().Chunks[0].Raw.Data) + 1
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{valid}},
+			minTime:     1,
+			maxTime:     300,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{corrupted}},
+			minTime:     1,
+			maxTime:     300,
+		},
+	}
+	req := &storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: ".+", Type: storepb.LabelMatcher_RE}},
+	}
+
+	t.Run("verification disabled", func(t *testing.T) {
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, false, 0)
+
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Equals(t, 2, len(s.SeriesSet))
+		testutil.Equals(t, 0, len(s.Warnings))
+	})
+	t.Run("verification enabled", func(t *testing.T) {
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, true, 0)
+
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Equals(t, 1, len(s.SeriesSet))
+		testutil.Equals(t, []storepb.Label{{Name: "a", Value: "1"}}, s.SeriesSet[0].Labels)
+		testutil.Equals(t, 1, len(s.Warnings))
+		testutil.Equals(t, 1.0, promtestutil.ToFloat64(q.metrics.chunkHashMismatches.WithLabelValues("testaddr")))
+	})
+	t.Run("verification enabled, partial response disabled", func(t *testing.T) {
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, true, 0)
+
+		r := *req
+		r.PartialResponseDisabled = true
+		testutil.NotOk(t, q.Series(&r, newStoreSeriesServer(context.Background())))
+	})
+}
+
 func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -1052,6 +1114,8 @@ func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 		component.Query,
 		labels.FromStrings("fed", "a"),
 		0*time.Second,
+		false,
+		0,
 	)
 
 	ctx := context.Background()
@@ -1091,6 +1155,8 @@ func TestProxyStore_LabelValues(t *testing.T) {
 		component.Query,
 		nil,
 		0*time.Second,
+		false,
+		0,
 	)
 
 	ctx := context.Background()
@@ -1195,6 +1261,8 @@ func TestProxyStore_LabelNames(t *testing.T) {
 				component.Query,
 				nil,
 				0*time.Second,
+				false,
+				0,
 			)
 
 			ctx := context.Background()
@@ -7,7 +7,9 @@ import (
 	"strings"
 	"unsafe"
 
+	"github.com/cespare/xxhash"
 	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 )
@@ -20,6 +22,40 @@ var PartialResponseStrategyValues = func() []string {
 	return s
 }()
 
+// NewChunk returns a chunk with the given encoding and data and its hash set.
+func NewChunk(enc Chunk_Encoding, data []byte) *Chunk {
+	return &Chunk{Type: enc, Data: data, Hash: ChunkHash(data)}
+}
+
+// ChunkHash returns the checksum of chunk data as set in the hash field of Chunk.
+func ChunkHash(data []byte) uint64 {
+	return xxhash.Sum64(data)
+}
+
+// VerifyHash returns an error if the chunk has a hash that does not match its data.
+// Chunks without a hash are considered valid.
+func (m *Chunk) VerifyHash() error {
+	if m == nil || m.Hash == 0 {
+		return nil
+	}
+	if h := ChunkHash(m.Data); h != m.Hash {
+		return errors.Errorf("chunk hash mismatch: expected %x, got %x", m.Hash, h)
+	}
+	return nil
+}
+
+// VerifyChunkHashes returns an error if any chunk of the series has a hash that does not match its data.
+func (m *Series) VerifyChunkHashes() error {
+	for _, c := range m.Chunks {
+		for _, chk := range []*Chunk{c.Raw, c.Count, c.Sum, c.Min, c.Max, c.Counter, c.Sketch} {
+			if err := chk.VerifyHash(); err != nil {
+				return errors.Wrapf(err, "series %s, chunk [%d, %d]", LabelsToPromLabels(m.Labels).String(), c.MinTime, c.MaxTime)
+			}
+		}
+	}
+	return nil
+}
+
 func NewWarnSeriesResponse(err error) *SeriesResponse {
 	return &SeriesResponse{
 		Result: &SeriesResponse_Warning{
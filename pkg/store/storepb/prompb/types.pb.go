@@ -53,7 +53,7 @@ func (x LabelMatcher_Type) String() string {
 }
 
 func (LabelMatcher_Type) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{4, 0}
+	return fileDescriptor_d938547f84707355, []int{5, 0}
 }
 
 // We require this to match chunkenc.Encoding.
@@ -79,7 +79,7 @@ func (x Chunk_Encoding) String() string {
 }
 
 func (Chunk_Encoding) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{6, 0}
+	return fileDescriptor_d938547f84707355, []int{7, 0}
 }
 
 type Sample struct {
@@ -134,17 +134,81 @@ func (m *Sample) GetTimestamp() int64 {
 	return 0
 }
 
+type Exemplar struct {
+	// Optional, can be empty.
+	Labels []Label `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels"`
+	Value  float64 `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	// timestamp is in ms format, see pkg/timestamp/timestamp.go for
+	// conversion from time.Time to Prometheus timestamp.
+	Timestamp int64 `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Exemplar) Reset()         { *m = Exemplar{} }
+func (m *Exemplar) String() string { return proto.CompactTextString(m) }
+func (*Exemplar) ProtoMessage()    {}
+func (*Exemplar) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d938547f84707355, []int{1}
+}
+func (m *Exemplar) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Exemplar) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Exemplar.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Exemplar) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Exemplar.Merge(m, src)
+}
+func (m *Exemplar) XXX_Size() int {
+	return m.Size()
+}
+func (m *Exemplar) XXX_DiscardUnknown() {
+	xxx_messageInfo_Exemplar.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Exemplar proto.InternalMessageInfo
+
+func (m *Exemplar) GetLabels() []Label {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Exemplar) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+func (m *Exemplar) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
 // TimeSeries represents samples and labels for a single time series.
 type TimeSeries struct {
-	Labels  []Label  `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels"`
-	Samples []Sample `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples"`
+	Labels    []Label    `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels"`
+	Samples   []Sample   `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples"`
+	Exemplars []Exemplar `protobuf:"bytes,3,rep,name=exemplars,proto3" json:"exemplars"`
 }
 
 func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
 func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
 func (*TimeSeries) ProtoMessage()    {}
 func (*TimeSeries) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{1}
+	return fileDescriptor_d938547f84707355, []int{2}
 }
 func (m *TimeSeries) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -187,6 +251,13 @@ func (m *TimeSeries) GetSamples() []Sample {
 	return nil
 }
 
+func (m *TimeSeries) GetExemplars() []Exemplar {
+	if m != nil {
+		return m.Exemplars
+	}
+	return nil
+}
+
 type Label struct {
 	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
@@ -196,7 +267,7 @@ func (m *Label) Reset()         { *m = Label{} }
 func (m *Label) String() string { return proto.CompactTextString(m) }
 func (*Label) ProtoMessage()    {}
 func (*Label) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{2}
+	return fileDescriptor_d938547f84707355, []int{3}
 }
 func (m *Label) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -247,7 +318,7 @@ func (m *Labels) Reset()         { *m = Labels{} }
 func (m *Labels) String() string { return proto.CompactTextString(m) }
 func (*Labels) ProtoMessage()    {}
 func (*Labels) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{3}
+	return fileDescriptor_d938547f84707355, []int{4}
 }
 func (m *Labels) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -294,7 +365,7 @@ func (m *LabelMatcher) Reset()         { *m = LabelMatcher{} }
 func (m *LabelMatcher) String() string { return proto.CompactTextString(m) }
 func (*LabelMatcher) ProtoMessage()    {}
 func (*LabelMatcher) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{4}
+	return fileDescriptor_d938547f84707355, []int{5}
 }
 func (m *LabelMatcher) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -358,7 +429,7 @@ func (m *ReadHints) Reset()         { *m = ReadHints{} }
 func (m *ReadHints) String() string { return proto.CompactTextString(m) }
 func (*ReadHints) ProtoMessage()    {}
 func (*ReadHints) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{5}
+	return fileDescriptor_d938547f84707355, []int{6}
 }
 func (m *ReadHints) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -449,7 +520,7 @@ func (m *Chunk) Reset()         { *m = Chunk{} }
 func (m *Chunk) String() string { return proto.CompactTextString(m) }
 func (*Chunk) ProtoMessage()    {}
 func (*Chunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{6}
+	return fileDescriptor_d938547f84707355, []int{7}
 }
 func (m *Chunk) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -518,7 +589,7 @@ func (m *ChunkedSeries) Reset()         { *m = ChunkedSeries{} }
 func (m *ChunkedSeries) String() string { return proto.CompactTextString(m) }
 func (*ChunkedSeries) ProtoMessage()    {}
 func (*ChunkedSeries) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d938547f84707355, []int{7}
+	return fileDescriptor_d938547f84707355, []int{8}
 }
 func (m *ChunkedSeries) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -565,6 +636,7 @@ func init() {
 	proto.RegisterEnum("prometheus_copy.LabelMatcher_Type", LabelMatcher_Type_name, LabelMatcher_Type_value)
 	proto.RegisterEnum("prometheus_copy.Chunk_Encoding", Chunk_Encoding_name, Chunk_Encoding_value)
 	proto.RegisterType((*Sample)(nil), "prometheus_copy.Sample")
+	proto.RegisterType((*Exemplar)(nil), "prometheus_copy.Exemplar")
 	proto.RegisterType((*TimeSeries)(nil), "prometheus_copy.TimeSeries")
 	proto.RegisterType((*Label)(nil), "prometheus_copy.Label")
 	proto.RegisterType((*Labels)(nil), "prometheus_copy.Labels")
@@ -577,43 +649,44 @@ func init() {
 func init() { proto.RegisterFile("types.proto", fileDescriptor_d938547f84707355) }
 
 var fileDescriptor_d938547f84707355 = []byte{
-	// 561 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x53, 0xc1, 0x6e, 0xd3, 0x40,
-	0x10, 0xcd, 0xda, 0x89, 0x9d, 0x4c, 0x4a, 0x89, 0x56, 0xa5, 0x35, 0x15, 0x72, 0x2d, 0x9f, 0x7c,
-	0x0a, 0xa2, 0xad, 0xe0, 0x82, 0x38, 0x14, 0x45, 0x42, 0xa2, 0x4e, 0xd5, 0x6d, 0x11, 0x88, 0x4b,
-	0xb4, 0x89, 0x17, 0xc7, 0x22, 0x5e, 0x5b, 0xde, 0x0d, 0x6a, 0xd4, 0x9f, 0xe0, 0xcc, 0x5f, 0xc0,
-	0x57, 0xf4, 0xd8, 0x23, 0x27, 0x84, 0x92, 0x1f, 0x41, 0xbb, 0x76, 0x12, 0x44, 0x73, 0xa2, 0xb7,
-	0x99, 0x79, 0x6f, 0xde, 0x3c, 0xef, 0x8c, 0xa1, 0x2d, 0x67, 0x39, 0x13, 0xdd, 0xbc, 0xc8, 0x64,
-	0x86, 0x1f, 0xe6, 0x45, 0x96, 0x32, 0x39, 0x66, 0x53, 0x31, 0x18, 0x65, 0xf9, 0x6c, 0x7f, 0x27,
-	0xce, 0xe2, 0x4c, 0x63, 0x4f, 0x55, 0x54, 0xd2, 0xfc, 0x97, 0x60, 0x5d, 0xd0, 0x34, 0x9f, 0x30,
-	0xbc, 0x03, 0x8d, 0x2f, 0x74, 0x32, 0x65, 0x0e, 0xf2, 0x50, 0x80, 0x48, 0x99, 0xe0, 0x27, 0xd0,
-	0x92, 0x49, 0xca, 0x84, 0xa4, 0x69, 0xee, 0x18, 0x1e, 0x0a, 0x4c, 0xb2, 0x2e, 0xf8, 0xd7, 0x00,
-	0x97, 0x49, 0xca, 0x2e, 0x58, 0x91, 0x30, 0x81, 0x8f, 0xc1, 0x9a, 0xd0, 0x21, 0x9b, 0x08, 0x07,
-	0x79, 0x66, 0xd0, 0x3e, 0xdc, 0xed, 0xfe, 0xe3, 0xa1, 0x7b, 0xaa, 0xe0, 0x93, 0xfa, 0xcd, 0xaf,
-	0x83, 0x1a, 0xa9, 0xb8, 0xf8, 0x05, 0xd8, 0x42, 0x3b, 0x10, 0x8e, 0xa1, 0xdb, 0xf6, 0xee, 0xb4,
-	0x95, 0x0e, 0xab, 0xbe, 0x25, 0xdb, 0x7f, 0x06, 0x0d, 0xad, 0x87, 0x31, 0xd4, 0x39, 0x4d, 0x4b,
-	0xe3, 0x2d, 0xa2, 0xe3, 0xf5, 0xd7, 0x18, 0xba, 0x58, 0x26, 0xfe, 0x2b, 0xb0, 0x4e, 0xcb, 0xa9,
-	0xff, 0xe5, 0xd5, 0xff, 0x86, 0x60, 0x4b, 0xd7, 0x43, 0x2a, 0x47, 0x63, 0x56, 0xe0, 0xe7, 0x50,
-	0x57, 0x8f, 0xae, 0x47, 0x6f, 0x1f, 0xfa, 0x9b, 0x45, 0x2a, 0x72, 0xf7, 0x72, 0x96, 0x33, 0xa2,
-	0xf9, 0x2b, 0xcb, 0xc6, 0x26, 0xcb, 0xe6, 0xdf, 0x96, 0x03, 0xa8, 0xab, 0x3e, 0x6c, 0x81, 0xd1,
-	0x3b, 0xef, 0xd4, 0xb0, 0x0d, 0x66, 0xbf, 0x77, 0xde, 0x41, 0xaa, 0x40, 0x7a, 0x1d, 0x43, 0x17,
-	0x48, 0xaf, 0x63, 0xfa, 0xdf, 0x11, 0xb4, 0x08, 0xa3, 0xd1, 0x9b, 0x84, 0x4b, 0x81, 0xf7, 0xc0,
-	0x16, 0x92, 0xe5, 0x83, 0x54, 0x68, 0x73, 0x26, 0xb1, 0x54, 0x1a, 0x0a, 0x35, 0xfa, 0xd3, 0x94,
-	0x8f, 0x96, 0xa3, 0x55, 0x8c, 0x1f, 0x43, 0x53, 0x48, 0x5a, 0x48, 0xc5, 0x36, 0x35, 0xdb, 0xd6,
-	0x79, 0x28, 0xf0, 0x23, 0xb0, 0x18, 0x8f, 0x14, 0x50, 0xd7, 0x40, 0x83, 0xf1, 0x28, 0x14, 0x78,
-	0x1f, 0x9a, 0x71, 0x91, 0x4d, 0xf3, 0x84, 0xc7, 0x4e, 0xc3, 0x33, 0x83, 0x16, 0x59, 0xe5, 0x78,
-	0x1b, 0x8c, 0xe1, 0xcc, 0xb1, 0x3c, 0x14, 0x34, 0x89, 0x31, 0x9c, 0x29, 0xf5, 0x82, 0xf2, 0x98,
-	0x29, 0x11, 0xbb, 0x54, 0xd7, 0x79, 0x28, 0xfc, 0x1f, 0x08, 0x1a, 0xaf, 0xc7, 0x53, 0xfe, 0x19,
-	0xbb, 0xd0, 0x4e, 0x13, 0x3e, 0x50, 0xb7, 0xb5, 0xf6, 0xdc, 0x4a, 0x13, 0xae, 0x0e, 0x2c, 0x14,
-	0x1a, 0xa7, 0x57, 0x2b, 0xbc, 0x3a, 0xc5, 0x94, 0x5e, 0x55, 0xf8, 0x51, 0xb5, 0x09, 0x53, 0x6f,
-	0xe2, 0xe0, 0xce, 0x26, 0xf4, 0x94, 0x6e, 0x8f, 0x8f, 0xb2, 0x28, 0xe1, 0xf1, 0x7a, 0x0d, 0x11,
-	0x95, 0x54, 0x7f, 0xda, 0x16, 0xd1, 0xb1, 0xef, 0x41, 0x73, 0xc9, 0xc2, 0x6d, 0xb0, 0xdf, 0xf5,
-	0xdf, 0xf6, 0xcf, 0xde, 0xf7, 0xcb, 0x97, 0xff, 0x70, 0x46, 0x3a, 0xc8, 0xbf, 0x86, 0x07, 0x5a,
-	0x8d, 0x45, 0xf7, 0x3a, 0xfc, 0x63, 0xb0, 0x46, 0x4a, 0x66, 0x79, 0xf7, 0xbb, 0x9b, 0x3d, 0x2f,
-	0xbb, 0x4a, 0xee, 0x89, 0x77, 0x33, 0x77, 0xd1, 0xed, 0xdc, 0x45, 0xbf, 0xe7, 0x2e, 0xfa, 0xba,
-	0x70, 0x6b, 0xb7, 0x0b, 0xb7, 0xf6, 0x73, 0xe1, 0xd6, 0x3e, 0x5a, 0xaa, 0x3d, 0x1f, 0x0e, 0x2d,
-	0xfd, 0x67, 0x1f, 0xfd, 0x09, 0x00, 0x00, 0xff, 0xff, 0x73, 0xda, 0x4a, 0x37, 0x0f, 0x04, 0x00,
-	0x00,
+	// 582 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa5, 0x54, 0xcb, 0x6e, 0x13, 0x31,
+	0x14, 0xcd, 0xbc, 0x33, 0x37, 0xa5, 0x44, 0x56, 0x69, 0xd3, 0x0a, 0xa5, 0xd1, 0xac, 0xb2, 0x0a,
+	0xa2, 0x45, 0xb0, 0x01, 0x16, 0x45, 0x91, 0x90, 0x68, 0x52, 0xe1, 0x16, 0x81, 0xd8, 0x44, 0x4e,
+	0xe2, 0x26, 0x23, 0x32, 0x0f, 0x8d, 0x1d, 0xd4, 0x88, 0x9f, 0x60, 0xcd, 0x5f, 0xc0, 0x92, 0x2f,
+	0xe8, 0xb2, 0x4b, 0x56, 0x08, 0xc1, 0x8f, 0x70, 0xed, 0x99, 0x24, 0xd0, 0x84, 0x4d, 0x59, 0x58,
+	0x73, 0x1f, 0xe7, 0xdc, 0x7b, 0x7c, 0x6d, 0x0f, 0x54, 0xe4, 0x2c, 0xe5, 0xa2, 0x95, 0x66, 0x89,
+	0x4c, 0xc8, 0x6d, 0xfc, 0x44, 0x5c, 0x8e, 0xf9, 0x54, 0xf4, 0x06, 0x49, 0x3a, 0xdb, 0xdb, 0x1a,
+	0x25, 0xa3, 0x44, 0xe7, 0xee, 0x29, 0x2b, 0x87, 0x05, 0x8f, 0xc1, 0x3d, 0x65, 0x51, 0x3a, 0xe1,
+	0x64, 0x0b, 0x9c, 0xf7, 0x6c, 0x32, 0xe5, 0x35, 0xa3, 0x61, 0x34, 0x0d, 0x9a, 0x3b, 0xe4, 0x2e,
+	0xf8, 0x32, 0x8c, 0xb8, 0x90, 0x08, 0xaa, 0x99, 0x98, 0xb1, 0xe8, 0x32, 0x10, 0x48, 0x28, 0xb7,
+	0x2f, 0x38, 0xd2, 0x59, 0x46, 0x1e, 0x80, 0x3b, 0x61, 0x7d, 0x3e, 0x11, 0x58, 0xc0, 0x6a, 0x56,
+	0x0e, 0xb6, 0x5b, 0xd7, 0x14, 0xb4, 0x8e, 0x55, 0xfa, 0xc8, 0xbe, 0xfc, 0xbe, 0x5f, 0xa2, 0x05,
+	0x76, 0xd9, 0xd5, 0xfc, 0x67, 0x57, 0xeb, 0x7a, 0xd7, 0xaf, 0x06, 0xc0, 0x19, 0x7a, 0xa7, 0x3c,
+	0x0b, 0xb9, 0xb8, 0x61, 0xe3, 0x47, 0xe0, 0x09, 0xbd, 0x71, 0x81, 0xad, 0x15, 0x6d, 0x67, 0x85,
+	0x96, 0x0f, 0xa6, 0xe0, 0xcd, 0xd1, 0xe4, 0x09, 0xf8, 0xbc, 0xd8, 0xb3, 0x40, 0x6d, 0x8a, 0xba,
+	0xbb, 0x42, 0x9d, 0x4f, 0xa5, 0x20, 0x2f, 0x19, 0xc1, 0x7d, 0x70, 0xb4, 0x1c, 0x42, 0xc0, 0x8e,
+	0x59, 0x94, 0x8f, 0xdb, 0xa7, 0xda, 0xfe, 0x7b, 0x1a, 0x7e, 0x31, 0x8d, 0xe0, 0x29, 0xb8, 0xc7,
+	0xb9, 0xe8, 0x1b, 0x6d, 0x35, 0xf8, 0x64, 0xc0, 0x86, 0x8e, 0x77, 0x98, 0x1c, 0x8c, 0x79, 0x46,
+	0x1e, 0x82, 0xad, 0xae, 0x8a, 0x6e, 0xbd, 0x79, 0x10, 0xac, 0x2f, 0x52, 0x80, 0x5b, 0x67, 0x88,
+	0xa4, 0x1a, 0xbf, 0x90, 0x6c, 0xae, 0x93, 0x6c, 0xfd, 0x29, 0xb9, 0x09, 0xb6, 0xe2, 0x11, 0x17,
+	0xcc, 0xf6, 0xcb, 0x6a, 0x89, 0x78, 0x60, 0x75, 0xd1, 0x30, 0x54, 0x80, 0xb6, 0xab, 0xa6, 0x0e,
+	0xa0, 0x61, 0x05, 0x9f, 0x0d, 0xf0, 0x29, 0x67, 0xc3, 0xe7, 0x61, 0x2c, 0x05, 0xd9, 0xc1, 0x53,
+	0x91, 0x3c, 0xed, 0x45, 0x42, 0x8b, 0xb3, 0xa8, 0xab, 0xdc, 0x8e, 0x50, 0xad, 0xcf, 0xa7, 0xf1,
+	0x60, 0xde, 0x5a, 0xd9, 0x64, 0x17, 0xca, 0x78, 0x21, 0x32, 0xa9, 0xd0, 0xf9, 0x25, 0xf1, 0xb4,
+	0x8f, 0xf0, 0x3b, 0xe0, 0xf2, 0x78, 0xa8, 0x12, 0xb6, 0x4e, 0x38, 0xe8, 0x61, 0x78, 0x0f, 0xca,
+	0xa3, 0x2c, 0x99, 0xa6, 0x61, 0x3c, 0xaa, 0x39, 0x38, 0x41, 0x9f, 0x2e, 0x7c, 0xb2, 0x09, 0x66,
+	0x7f, 0x56, 0x73, 0x11, 0x5e, 0xa6, 0x68, 0xa9, 0xea, 0x19, 0x8b, 0x47, 0x5c, 0x15, 0xf1, 0xf2,
+	0xea, 0xda, 0xef, 0x88, 0xe0, 0x8b, 0x01, 0xce, 0xb3, 0xf1, 0x34, 0x7e, 0x47, 0xea, 0x50, 0x89,
+	0xc2, 0xb8, 0xa7, 0xee, 0xe6, 0x52, 0xb3, 0x8f, 0x21, 0x75, 0x3f, 0xb1, 0xa1, 0xca, 0xb3, 0x8b,
+	0x45, 0xbe, 0x78, 0x40, 0x18, 0x2a, 0xf2, 0x87, 0xc5, 0x49, 0x58, 0xfa, 0x24, 0xf6, 0x57, 0x4e,
+	0x42, 0x77, 0x69, 0xb5, 0xe3, 0x41, 0x32, 0x44, 0x8d, 0xcb, 0x63, 0x18, 0x32, 0xc9, 0xf4, 0xd6,
+	0x36, 0xa8, 0xb6, 0x83, 0x06, 0xbe, 0xc4, 0x02, 0x45, 0x2a, 0xe0, 0xbd, 0xea, 0xbe, 0xe8, 0x9e,
+	0xbc, 0xee, 0xe6, 0x93, 0x7f, 0x73, 0x42, 0xab, 0x46, 0xf0, 0x01, 0x6e, 0xe9, 0x6a, 0x7c, 0xf8,
+	0x5f, 0xef, 0x06, 0x59, 0x03, 0x55, 0x66, 0xfe, 0x6c, 0xb6, 0xd7, 0x6b, 0x9e, 0xb3, 0x72, 0xec,
+	0x51, 0xe3, 0xf2, 0x67, 0xdd, 0xb8, 0xc2, 0xf5, 0x03, 0xd7, 0xc7, 0x5f, 0xf5, 0xd2, 0x15, 0xae,
+	0x6f, 0xb8, 0xde, 0xba, 0x8a, 0x9e, 0xf6, 0xfb, 0xae, 0xfe, 0x1f, 0x1d, 0xfe, 0x06, 0x32, 0x45,
+	0x76, 0x83, 0xc5, 0x04, 0x00, 0x00,
 }
 
 func (m *Sample) Marshal() (dAtA []byte, err error) {
@@ -650,6 +723,54 @@ func (m *Sample) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *Exemplar) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Exemplar) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Exemplar) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Timestamp != 0 {
+		i = encodeVarintTypes(dAtA, i, uint64(m.Timestamp))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.Value != 0 {
+		i -= 8
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(m.Value))))
+		i--
+		dAtA[i] = 0x11
+	}
+	if len(m.Labels) > 0 {
+		for iNdEx := len(m.Labels) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Labels[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTypes(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *TimeSeries) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -670,6 +791,20 @@ func (m *TimeSeries) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Exemplars) > 0 {
+		for iNdEx := len(m.Exemplars) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Exemplars[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTypes(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
 	if len(m.Samples) > 0 {
 		for iNdEx := len(m.Samples) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1008,6 +1143,27 @@ func (m *Sample) Size() (n int) {
 	return n
 }
 
+func (m *Exemplar) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Labels) > 0 {
+		for _, e := range m.Labels {
+			l = e.Size()
+			n += 1 + l + sovTypes(uint64(l))
+		}
+	}
+	if m.Value != 0 {
+		n += 9
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sovTypes(uint64(m.Timestamp))
+	}
+	return n
+}
+
 func (m *TimeSeries) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1026,6 +1182,12 @@ func (m *TimeSeries) Size() (n int) {
 			n += 1 + l + sovTypes(uint64(l))
 		}
 	}
+	if len(m.Exemplars) > 0 {
+		for _, e := range m.Exemplars {
+			l = e.Size()
+			n += 1 + l + sovTypes(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1247,6 +1409,123 @@ func (m *Sample) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *Exemplar) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Exemplar: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Exemplar: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Labels = append(m.Labels, Label{})
+			if err := m.Labels[len(m.Labels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.Value = float64(math.Float64frombits(v))
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *TimeSeries) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -1344,6 +1623,40 @@ func (m *TimeSeries) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Exemplars", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Exemplars = append(m.Exemplars, Exemplar{})
+			if err := m.Exemplars[len(m.Exemplars)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
@@ -110,6 +110,7 @@ const (
 	Aggr_MIN     Aggr = 3
 	Aggr_MAX     Aggr = 4
 	Aggr_COUNTER Aggr = 5
+	Aggr_SKETCH  Aggr = 6
 )
 
 var Aggr_name = map[int32]string{
@@ -119,6 +120,7 @@ var Aggr_name = map[int32]string{
 	3: "MIN",
 	4: "MAX",
 	5: "COUNTER",
+	6: "SKETCH",
 }
 
 var Aggr_value = map[string]int32{
@@ -128,6 +130,7 @@ var Aggr_value = map[string]int32{
 	"MIN":     3,
 	"MAX":     4,
 	"COUNTER": 5,
+	"SKETCH":  6,
 }
 
 func (x Aggr) String() string {
@@ -341,6 +344,9 @@ type SeriesRequest struct {
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,7,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
 	// skip_chunks controls whether sending chunks or not in series responses.
 	SkipChunks bool `protobuf:"varint,8,opt,name=skip_chunks,json=skipChunks,proto3" json:"skip_chunks,omitempty"`
+	// shard_info restricts the response to the series of one shard of a sharded query, if set.
+	// Stores not supporting it return all series, so clients have to filter them as well.
+	ShardInfo *ShardInfo `protobuf:"bytes,9,opt,name=shard_info,json=shardInfo,proto3" json:"shard_info,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
@@ -629,6 +635,46 @@ func (m *LabelValuesResponse) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_LabelValuesResponse proto.InternalMessageInfo
 
+// ShardInfo selects the series whose values of the given labels hash to the shard index.
+type ShardInfo struct {
+	ShardIndex  uint64   `protobuf:"varint,1,opt,name=shard_index,json=shardIndex,proto3" json:"shard_index,omitempty"`
+	TotalShards uint64   `protobuf:"varint,2,opt,name=total_shards,json=totalShards,proto3" json:"total_shards,omitempty"`
+	By          []string `protobuf:"bytes,3,rep,name=by,proto3" json:"by,omitempty"`
+}
+
+func (m *ShardInfo) Reset()         { *m = ShardInfo{} }
+func (m *ShardInfo) String() string { return proto.CompactTextString(m) }
+func (*ShardInfo) ProtoMessage()    {}
+func (*ShardInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{11}
+}
+func (m *ShardInfo) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ShardInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ShardInfo.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ShardInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShardInfo.Merge(m, src)
+}
+func (m *ShardInfo) XXX_Size() int {
+	return m.Size()
+}
+func (m *ShardInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShardInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShardInfo proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterEnum("thanos.StoreType", StoreType_name, StoreType_value)
 	proto.RegisterEnum("thanos.PartialResponseStrategy", PartialResponseStrategy_name, PartialResponseStrategy_value)
@@ -644,73 +690,78 @@ func init() {
 	proto.RegisterType((*LabelNamesResponse)(nil), "thanos.LabelNamesResponse")
 	proto.RegisterType((*LabelValuesRequest)(nil), "thanos.LabelValuesRequest")
 	proto.RegisterType((*LabelValuesResponse)(nil), "thanos.LabelValuesResponse")
+	proto.RegisterType((*ShardInfo)(nil), "thanos.ShardInfo")
 }
 
 func init() { proto.RegisterFile("rpc.proto", fileDescriptor_77a6da22d6a3feb1) }
 
 var fileDescriptor_77a6da22d6a3feb1 = []byte{
-	// 966 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0x4b, 0x6f, 0x23, 0x45,
-	0x10, 0x9e, 0xf6, 0xf8, 0x59, 0xde, 0x84, 0xd9, 0xce, 0x63, 0x27, 0x5e, 0xc9, 0x89, 0x46, 0x42,
-	0xb2, 0xc2, 0xca, 0x01, 0x23, 0x40, 0x20, 0x2e, 0x4e, 0xd6, 0xab, 0x44, 0x6c, 0x1c, 0x68, 0x27,
-	0x1b, 0x1e, 0x07, 0x6b, 0xec, 0xf4, 0x8e, 0x47, 0x3b, 0x2f, 0xa6, 0xdb, 0x24, 0xbe, 0xc2, 0x1d,
-	0x71, 0xe5, 0x3f, 0xf0, 0x2f, 0xb8, 0xe4, 0xb8, 0x47, 0xb8, 0x20, 0x48, 0xfe, 0x08, 0xea, 0xc7,
-	0x38, 0x9e, 0x25, 0x1b, 0x09, 0xe5, 0x36, 0xf5, 0x7d, 0xd5, 0x5d, 0x55, 0x5f, 0x55, 0x4d, 0x43,
-	0x2d, 0x4d, 0xc6, 0xed, 0x24, 0x8d, 0x79, 0x8c, 0xcb, 0x7c, 0xe2, 0x46, 0x31, 0x6b, 0xd4, 0xf9,
-	0x2c, 0xa1, 0x4c, 0x81, 0x8d, 0x55, 0x2f, 0xf6, 0x62, 0xf9, 0xb9, 0x23, 0xbe, 0x34, 0x8a, 0x93,
-	0x34, 0x0e, 0x93, 0xd1, 0xce, 0xa2, 0xe7, 0x86, 0x17, 0xc7, 0x5e, 0x40, 0x77, 0xa4, 0x35, 0x9a,
-	0xbe, 0xdc, 0x71, 0xa3, 0x99, 0xa2, 0x9c, 0x77, 0x60, 0xe9, 0x34, 0xf5, 0x39, 0x25, 0x94, 0x25,
-	0x71, 0xc4, 0xa8, 0xf3, 0x13, 0x82, 0x07, 0x1a, 0xf9, 0x7e, 0x4a, 0x19, 0xc7, 0x5d, 0x00, 0xee,
-	0x87, 0x94, 0xd1, 0xd4, 0xa7, 0xcc, 0x46, 0x5b, 0x66, 0xab, 0xde, 0x79, 0x2c, 0x4e, 0x87, 0x94,
-	0x4f, 0xe8, 0x94, 0x0d, 0xc7, 0x71, 0x32, 0x6b, 0x1f, 0xfb, 0x21, 0x1d, 0x48, 0x97, 0xdd, 0xe2,
-	0xe5, 0x5f, 0x9b, 0x06, 0x59, 0x38, 0x84, 0xd7, 0xa1, 0xcc, 0x69, 0xe4, 0x46, 0xdc, 0x2e, 0x6c,
-	0xa1, 0x56, 0x8d, 0x68, 0x0b, 0xdb, 0x50, 0x49, 0x69, 0x12, 0xf8, 0x63, 0xd7, 0x36, 0xb7, 0x50,
-	0xcb, 0x24, 0x99, 0xe9, 0x2c, 0x41, 0xfd, 0x20, 0x7a, 0x19, 0xeb, 0x1c, 0x9c, 0x3f, 0x11, 0x3c,
-	0x50, 0xb6, 0xca, 0x12, 0xbf, 0x07, 0xe5, 0xc0, 0x1d, 0xd1, 0x20, 0x4b, 0x68, 0xa9, 0xad, 0x14,
-	0x6a, 0x3f, 0x17, 0xa8, 0x4e, 0x41, 0xbb, 0xe0, 0x0d, 0xa8, 0x86, 0x7e, 0x34, 0x14, 0x09, 0xc9,
-	0x04, 0x4c, 0x52, 0x09, 0xfd, 0x48, 0x64, 0x2c, 0x29, 0xf7, 0x42, 0x51, 0x3a, 0x85, 0xd0, 0xbd,
-	0x90, 0xd4, 0x0e, 0xd4, 0x18, 0x8f, 0x53, 0x7a, 0x3c, 0x4b, 0xa8, 0x5d, 0xdc, 0x42, 0xad, 0xe5,
-	0xce, 0xc3, 0x2c, 0xca, 0x20, 0x23, 0xc8, 0x8d, 0x0f, 0xfe, 0x08, 0x40, 0x06, 0x1c, 0x32, 0xca,
-	0x99, 0x5d, 0x92, 0x79, 0x59, 0xb9, 0xbc, 0x06, 0x94, 0xeb, 0xd4, 0x6a, 0x81, 0xb6, 0x99, 0xf3,
-	0x09, 0x54, 0x33, 0xf2, 0x7f, 0x95, 0xe5, 0xfc, 0x6a, 0xc2, 0x92, 0x92, 0x3c, 0x6b, 0xd5, 0x62,
-	0xa1, 0xe8, 0xed, 0x85, 0x16, 0xf2, 0x85, 0x7e, 0x2c, 0x28, 0x3e, 0x9e, 0xd0, 0x94, 0xd9, 0xa6,
-	0x0c, 0xbb, 0x9a, 0x0b, 0x7b, 0xa8, 0x48, 0x1d, 0x7d, 0xee, 0x8b, 0x3b, 0xb0, 0x26, 0xae, 0x4c,
-	0x29, 0x8b, 0x83, 0x29, 0xf7, 0xe3, 0x68, 0x78, 0xee, 0x47, 0x67, 0xf1, 0xb9, 0x14, 0xcb, 0x24,
-	0x2b, 0xa1, 0x7b, 0x41, 0xe6, 0xdc, 0xa9, 0xa4, 0xf0, 0x13, 0x00, 0xd7, 0xf3, 0x52, 0xea, 0xb9,
-	0x9c, 0x2a, 0x8d, 0x96, 0x3b, 0x0f, 0xb2, 0x68, 0x5d, 0xcf, 0x4b, 0xc9, 0x02, 0x8f, 0x3f, 0x83,
-	0x8d, 0xc4, 0x4d, 0xb9, 0xef, 0x06, 0x22, 0x8a, 0xec, 0xfc, 0xf0, 0xcc, 0x67, 0xee, 0x28, 0xa0,
-	0x67, 0x76, 0x79, 0x0b, 0xb5, 0xaa, 0xe4, 0x91, 0x76, 0xc8, 0x26, 0xe3, 0xa9, 0xa6, 0xf1, 0x77,
-	0xb7, 0x9c, 0x65, 0x3c, 0x75, 0x39, 0xf5, 0x66, 0x76, 0x45, 0xb6, 0x73, 0x33, 0x0b, 0xfc, 0x65,
-	0xfe, 0x8e, 0x81, 0x76, 0xfb, 0xcf, 0xe5, 0x19, 0x81, 0x37, 0xa1, 0xce, 0x5e, 0xf9, 0xc9, 0x70,
-	0x3c, 0x99, 0x46, 0xaf, 0x98, 0x5d, 0x95, 0xa9, 0x80, 0x80, 0xf6, 0x24, 0xe2, 0xfc, 0x8c, 0x60,
-	0x39, 0xeb, 0x8d, 0x1e, 0xd9, 0x16, 0x94, 0xe7, 0x3b, 0x84, 0x5a, 0xf5, 0xce, 0xf2, 0x7c, 0x98,
-	0x24, 0xba, 0x6f, 0x10, 0xcd, 0xe3, 0x06, 0x54, 0xce, 0xdd, 0x34, 0xf2, 0x23, 0x4f, 0xed, 0xcb,
-	0xbe, 0x41, 0x32, 0x00, 0x3f, 0x81, 0xd2, 0xc4, 0x8f, 0x38, 0x93, 0xd3, 0x2a, 0x3a, 0xa5, 0x56,
-	0xbb, 0x9d, 0xad, 0x76, 0xbb, 0x1b, 0xcd, 0xf6, 0x0d, 0xa2, 0x9c, 0x76, 0xab, 0x50, 0x4e, 0x29,
-	0x9b, 0x06, 0xdc, 0xf9, 0x0d, 0xc1, 0x43, 0xd9, 0xcd, 0xbe, 0x1b, 0xde, 0x0c, 0xcc, 0x9d, 0x02,
-	0xa3, 0x7b, 0x08, 0x5c, 0xb8, 0x9f, 0xc0, 0xce, 0x33, 0xc0, 0x8b, 0xd9, 0x6a, 0x09, 0x57, 0xa1,
-	0x14, 0x09, 0x40, 0x6e, 0x47, 0x8d, 0x28, 0x03, 0x37, 0xa0, 0xaa, 0xd5, 0x61, 0x76, 0x41, 0x12,
-	0x73, 0xdb, 0xf9, 0x1d, 0xe9, 0x8b, 0x5e, 0xb8, 0xc1, 0xf4, 0xa6, 0xee, 0x55, 0x28, 0xc9, 0x25,
-	0x92, 0x35, 0xd6, 0x88, 0x32, 0xee, 0x56, 0xa3, 0x70, 0x0f, 0x35, 0xcc, 0x7b, 0xaa, 0x71, 0x00,
-	0x2b, 0xb9, 0x22, 0xb4, 0x1c, 0xeb, 0x50, 0xfe, 0x41, 0x22, 0x5a, 0x0f, 0x6d, 0xdd, 0x25, 0xc8,
-	0x36, 0x81, 0xda, 0xfc, 0xe7, 0x85, 0xeb, 0x50, 0x39, 0xe9, 0x7f, 0xd1, 0x3f, 0x3a, 0xed, 0x5b,
-	0x06, 0xae, 0x41, 0xe9, 0xab, 0x93, 0x1e, 0xf9, 0xc6, 0x42, 0xb8, 0x0a, 0x45, 0x72, 0xf2, 0xbc,
-	0x67, 0x15, 0x84, 0xc7, 0xe0, 0xe0, 0x69, 0x6f, 0xaf, 0x4b, 0x2c, 0x53, 0x78, 0x0c, 0x8e, 0x8f,
-	0x48, 0xcf, 0x2a, 0x0a, 0x9c, 0xf4, 0xf6, 0x7a, 0x07, 0x2f, 0x7a, 0x56, 0x69, 0xbb, 0x0d, 0x8f,
-	0xde, 0x52, 0x92, 0xb8, 0xe9, 0xb4, 0x4b, 0xf4, 0xf5, 0xdd, 0xdd, 0x23, 0x72, 0x6c, 0xa1, 0xed,
-	0x5d, 0x28, 0x8a, 0x55, 0xc7, 0x15, 0x30, 0x49, 0xf7, 0x54, 0x71, 0x7b, 0x47, 0x27, 0xfd, 0x63,
-	0x0b, 0x09, 0x6c, 0x70, 0x72, 0x68, 0x15, 0xc4, 0xc7, 0xe1, 0x41, 0xdf, 0x32, 0xe5, 0x47, 0xf7,
-	0x6b, 0x15, 0x53, 0x7a, 0xf5, 0x88, 0x55, 0xea, 0xfc, 0x58, 0x80, 0x92, 0x2c, 0x04, 0x7f, 0x00,
-	0x45, 0xf1, 0x34, 0xe0, 0x95, 0x4c, 0xde, 0x85, 0x87, 0xa3, 0xb1, 0x9a, 0x07, 0xb5, 0x70, 0x9f,
-	0x42, 0x59, 0x2d, 0x1d, 0x5e, 0xcb, 0x2f, 0x61, 0x76, 0x6c, 0xfd, 0x4d, 0x58, 0x1d, 0x7c, 0x1f,
-	0xe1, 0x3d, 0x80, 0x9b, 0xc1, 0xc4, 0x1b, 0xb9, 0x1f, 0xe5, 0xe2, 0x6a, 0x35, 0x1a, 0xb7, 0x51,
-	0x3a, 0xfe, 0x33, 0xa8, 0x2f, 0xf4, 0x13, 0xe7, 0x5d, 0x73, 0x93, 0xda, 0x78, 0x7c, 0x2b, 0xa7,
-	0xee, 0xe9, 0xf4, 0x61, 0x59, 0x3e, 0xd5, 0x62, 0x04, 0x95, 0x18, 0x9f, 0x43, 0x9d, 0xd0, 0x30,
-	0xe6, 0x54, 0xe2, 0x78, 0x5e, 0xfe, 0xe2, 0x8b, 0xde, 0x58, 0x7b, 0x03, 0xd5, 0x2f, 0xbf, 0xb1,
-	0xfb, 0xee, 0xe5, 0x3f, 0x4d, 0xe3, 0xf2, 0xaa, 0x89, 0x5e, 0x5f, 0x35, 0xd1, 0xdf, 0x57, 0x4d,
-	0xf4, 0xcb, 0x75, 0xd3, 0x78, 0x7d, 0xdd, 0x34, 0xfe, 0xb8, 0x6e, 0x1a, 0xdf, 0x56, 0xe4, 0x53,
-	0x97, 0x8c, 0x46, 0x65, 0xf9, 0xb3, 0xf9, 0xf0, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x74, 0xaa,
-	0x41, 0xe4, 0xa1, 0x08, 0x00, 0x00,
+	// 1029 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa5, 0x56, 0x4b, 0x6f, 0xdb, 0x46,
+	0x10, 0x16, 0xf5, 0xe6, 0xc8, 0x56, 0x99, 0xb5, 0x9d, 0xd0, 0x0a, 0x60, 0xa7, 0x04, 0x0a, 0x18,
+	0x6e, 0x21, 0xa5, 0x2a, 0xda, 0xa2, 0x45, 0x2f, 0xb2, 0xa2, 0x20, 0x42, 0x62, 0xb9, 0x5d, 0x49,
+	0x51, 0xd2, 0x1e, 0x04, 0x4a, 0xda, 0x48, 0x44, 0x28, 0x92, 0xe5, 0xae, 0xea, 0xe8, 0xda, 0xde,
+	0x8b, 0xfe, 0x90, 0xfe, 0x8b, 0x5e, 0x0c, 0xf4, 0x92, 0x63, 0x7b, 0x29, 0xfa, 0xf8, 0x23, 0xdd,
+	0x5d, 0x2e, 0x65, 0x32, 0x75, 0x0c, 0x14, 0x3e, 0x10, 0xda, 0x99, 0x6f, 0x38, 0x8f, 0x6f, 0x66,
+	0x56, 0x04, 0x3d, 0x0c, 0xa6, 0xf5, 0x20, 0xf4, 0x99, 0x8f, 0x8a, 0x6c, 0x61, 0x7b, 0x3e, 0xad,
+	0x55, 0xd8, 0x3a, 0x20, 0x34, 0x52, 0xd6, 0x76, 0xe7, 0xfe, 0xdc, 0x97, 0xc7, 0x86, 0x38, 0x29,
+	0x2d, 0xe2, 0x3f, 0xcb, 0x60, 0xd2, 0x48, 0x5a, 0xee, 0xcf, 0x7d, 0x7f, 0xee, 0x92, 0x86, 0x94,
+	0x26, 0xab, 0x17, 0x0d, 0xdb, 0x5b, 0x47, 0x90, 0xf5, 0x0e, 0x6c, 0x8f, 0x42, 0x87, 0x11, 0x4c,
+	0x68, 0xe0, 0x7b, 0x94, 0x58, 0x3f, 0x68, 0xb0, 0xa5, 0x34, 0xdf, 0xae, 0x08, 0x65, 0xa8, 0x05,
+	0xc0, 0x9c, 0x25, 0xa1, 0x24, 0x74, 0x08, 0x35, 0xb5, 0x7b, 0xb9, 0xa3, 0x4a, 0xf3, 0xae, 0x78,
+	0x7b, 0x49, 0xd8, 0x82, 0xac, 0xe8, 0x78, 0xea, 0x07, 0xeb, 0xfa, 0x80, 0x9b, 0xf4, 0xa5, 0xc9,
+	0x49, 0xfe, 0xe2, 0x8f, 0xc3, 0x0c, 0x4e, 0xbc, 0x84, 0x6e, 0x43, 0x91, 0x11, 0xcf, 0xf6, 0x98,
+	0x99, 0xbd, 0xa7, 0x1d, 0xe9, 0x58, 0x49, 0xc8, 0x84, 0x52, 0x48, 0x02, 0xd7, 0x99, 0xda, 0x66,
+	0x8e, 0x03, 0x39, 0x1c, 0x8b, 0xd6, 0x36, 0x54, 0xba, 0xde, 0x0b, 0x5f, 0xe5, 0x60, 0xfd, 0xce,
+	0x93, 0x8a, 0xe4, 0x28, 0x4b, 0xf4, 0x3e, 0x14, 0x5d, 0x7b, 0x42, 0xdc, 0x38, 0xa1, 0xed, 0x7a,
+	0xc4, 0x50, 0xfd, 0x89, 0xd0, 0xaa, 0x14, 0x94, 0x09, 0xda, 0x87, 0xf2, 0xd2, 0xf1, 0xc6, 0x22,
+	0x21, 0x99, 0x00, 0x8f, 0xc3, 0x65, 0x91, 0xb1, 0x84, 0xec, 0x57, 0x11, 0xa4, 0x52, 0xe0, 0xb2,
+	0x84, 0x1a, 0xa0, 0x53, 0xe6, 0x87, 0x64, 0xc0, 0x89, 0x34, 0xf3, 0x1c, 0xab, 0x36, 0x6f, 0xc5,
+	0x51, 0xfa, 0x31, 0x80, 0x2f, 0x6d, 0xd0, 0xc7, 0x00, 0x32, 0xe0, 0x98, 0x12, 0x46, 0xcd, 0x82,
+	0xcc, 0xcb, 0x48, 0xe5, 0xd5, 0x27, 0x4c, 0xa5, 0xa6, 0xbb, 0x4a, 0xa6, 0xd6, 0xa7, 0x50, 0x8e,
+	0xc1, 0xff, 0x55, 0x96, 0xf5, 0x6b, 0x0e, 0xb6, 0x23, 0xca, 0xe3, 0x56, 0x25, 0x0b, 0xd5, 0xde,
+	0x5e, 0x68, 0x36, 0x5d, 0xe8, 0x27, 0x02, 0x62, 0xd3, 0x05, 0x09, 0x29, 0xe7, 0x40, 0x84, 0xdd,
+	0x4d, 0x85, 0x3d, 0x8d, 0x40, 0x15, 0x7d, 0x63, 0x8b, 0x9a, 0xb0, 0x27, 0x5c, 0x86, 0x84, 0xfa,
+	0xee, 0x8a, 0x39, 0xbe, 0x37, 0x3e, 0x77, 0xbc, 0x99, 0x7f, 0x2e, 0xc9, 0xca, 0xe1, 0x1d, 0x0e,
+	0xe2, 0x0d, 0x36, 0x92, 0x10, 0xfa, 0x00, 0xc0, 0x9e, 0xcf, 0x43, 0x32, 0xb7, 0x19, 0x89, 0x38,
+	0xaa, 0x36, 0xb7, 0xe2, 0x68, 0x2d, 0x8e, 0xe0, 0x04, 0x8e, 0x3e, 0x87, 0xfd, 0xc0, 0x0e, 0x99,
+	0x63, 0xbb, 0x22, 0x8a, 0xec, 0xfc, 0x78, 0xe6, 0x50, 0x7b, 0xe2, 0x92, 0x99, 0x59, 0xe4, 0x51,
+	0xca, 0xf8, 0x8e, 0x32, 0x88, 0x27, 0xe3, 0x81, 0x82, 0xd1, 0x37, 0x57, 0xbc, 0x4b, 0x59, 0xc8,
+	0xfd, 0xce, 0xd7, 0x66, 0x49, 0xb6, 0xf3, 0x30, 0x0e, 0xfc, 0x65, 0xda, 0x47, 0x5f, 0x99, 0xfd,
+	0xc7, 0x79, 0x0c, 0xa0, 0x43, 0xa8, 0xd0, 0x97, 0x4e, 0x30, 0x9e, 0x2e, 0x56, 0xde, 0x4b, 0x6a,
+	0x96, 0x65, 0x2a, 0x20, 0x54, 0x6d, 0xa9, 0x41, 0xf7, 0x01, 0xe8, 0xc2, 0x0e, 0x67, 0x63, 0x87,
+	0x4f, 0xad, 0xa9, 0x73, 0xbc, 0x92, 0x98, 0x1e, 0x81, 0xc8, 0x71, 0xd6, 0x69, 0x7c, 0xb4, 0x7e,
+	0xd4, 0xa0, 0x1a, 0x77, 0x53, 0x0d, 0xf9, 0x11, 0x14, 0x37, 0x5b, 0x27, 0x1c, 0x54, 0x37, 0x0e,
+	0xa4, 0xf6, 0x11, 0x1f, 0x05, 0xb5, 0x60, 0x35, 0x28, 0x9d, 0xdb, 0xa1, 0xe7, 0x78, 0xf3, 0x68,
+	0xc3, 0x38, 0x14, 0x2b, 0x38, 0xe5, 0x85, 0x85, 0xe3, 0x31, 0x2a, 0xe7, 0x5b, 0xf4, 0x36, 0xba,
+	0x0c, 0xea, 0xf1, 0x65, 0x50, 0x6f, 0x79, 0x6b, 0x6e, 0x1f, 0x19, 0x9d, 0x94, 0xa1, 0xc8, 0xe9,
+	0x5a, 0xb9, 0xcc, 0xfa, 0x59, 0x83, 0x5b, 0xb2, 0xff, 0x3d, 0x7b, 0x79, 0x39, 0x62, 0xd7, 0xb6,
+	0x44, 0xbb, 0x41, 0x4b, 0xb2, 0x37, 0x6b, 0x89, 0xf5, 0x10, 0x50, 0x32, 0x5b, 0x45, 0xe1, 0x2e,
+	0x14, 0x3c, 0xa1, 0x90, 0xfb, 0xa4, 0xe3, 0x48, 0xe0, 0x74, 0x95, 0x15, 0x3b, 0x94, 0xc7, 0x15,
+	0xc0, 0x46, 0xb6, 0x7e, 0xd1, 0x94, 0xa3, 0xa7, 0xb6, 0xbb, 0xba, 0xac, 0x9b, 0x3b, 0x92, 0x6b,
+	0x27, 0x6b, 0xe4, 0x8e, 0xa4, 0x70, 0x3d, 0x1b, 0xd9, 0x1b, 0xb0, 0x91, 0xbb, 0x21, 0x1b, 0x5d,
+	0xd8, 0x49, 0x15, 0xa1, 0xe8, 0xe0, 0x17, 0xf1, 0x77, 0x52, 0xa3, 0xf8, 0x50, 0xd2, 0xb5, 0x84,
+	0x8c, 0x41, 0xdf, 0x0c, 0xac, 0x1c, 0x7c, 0x35, 0xd7, 0x33, 0xf2, 0x4a, 0x92, 0x91, 0xc7, 0xa0,
+	0xa6, 0x98, 0x6b, 0xd0, 0xbb, 0xb0, 0xc5, 0x7c, 0xc6, 0x6b, 0x92, 0x3a, 0x2a, 0x49, 0xc8, 0xe3,
+	0x8a, 0xd4, 0x49, 0x37, 0x14, 0x55, 0x21, 0x3b, 0x59, 0xcb, 0x9b, 0x46, 0xc7, 0xfc, 0x74, 0x8c,
+	0x79, 0x80, 0xcd, 0x25, 0x5a, 0x81, 0xd2, 0xb0, 0xf7, 0xb8, 0x77, 0x36, 0xea, 0x19, 0x19, 0xa4,
+	0x43, 0xe1, 0xab, 0x61, 0x07, 0x3f, 0x37, 0x34, 0x54, 0x86, 0x3c, 0x1e, 0x3e, 0xe9, 0x18, 0x59,
+	0x61, 0xd1, 0xef, 0x3e, 0xe8, 0xb4, 0x5b, 0xd8, 0xc8, 0x09, 0x8b, 0xfe, 0xe0, 0x0c, 0x77, 0x8c,
+	0xbc, 0xd0, 0xe3, 0x4e, 0xbb, 0xd3, 0x7d, 0xda, 0x31, 0x0a, 0xc7, 0x75, 0xb8, 0xf3, 0x16, 0xce,
+	0x84, 0xa7, 0x51, 0x0b, 0x2b, 0xf7, 0xad, 0x93, 0x33, 0x3c, 0x30, 0xb4, 0xe3, 0x1e, 0xe4, 0xc5,
+	0xed, 0x83, 0x4a, 0x90, 0xc3, 0xad, 0x51, 0x84, 0xb5, 0xcf, 0x86, 0x3d, 0x8e, 0x09, 0x5d, 0x7f,
+	0x78, 0xca, 0x23, 0xf3, 0xc3, 0x69, 0xb7, 0xc7, 0xa3, 0x8a, 0x43, 0xeb, 0x59, 0x14, 0x53, 0x5a,
+	0x75, 0xb0, 0x51, 0x40, 0x00, 0xc5, 0xfe, 0xe3, 0xce, 0xa0, 0xfd, 0xc8, 0x28, 0x36, 0xbf, 0xcf,
+	0xf2, 0xc4, 0x44, 0x51, 0xe8, 0x43, 0xc8, 0x4b, 0xe6, 0x76, 0xe2, 0x5e, 0x26, 0xfe, 0xd7, 0x6a,
+	0xbb, 0x69, 0xa5, 0xea, 0xd2, 0x67, 0xdc, 0x51, 0xb4, 0xd7, 0x7b, 0xe9, 0x8d, 0x8f, 0x5f, 0xbb,
+	0xfd, 0xa6, 0x3a, 0x7a, 0xf1, 0xbe, 0x86, 0xda, 0x00, 0x97, 0x5b, 0x80, 0xf6, 0x53, 0xf7, 0x78,
+	0x72, 0x8f, 0x6b, 0xb5, 0xab, 0x20, 0x15, 0xff, 0x21, 0x54, 0x12, 0xc3, 0x83, 0xd2, 0xa6, 0xa9,
+	0xb5, 0xa8, 0xdd, 0xbd, 0x12, 0x8b, 0xfc, 0x34, 0x7b, 0x50, 0x95, 0x5f, 0x12, 0x62, 0xde, 0x23,
+	0x32, 0xbe, 0x80, 0x0a, 0x26, 0x4b, 0x9f, 0x11, 0xa9, 0x47, 0x9b, 0xf2, 0x93, 0x1f, 0x1c, 0xb5,
+	0xbd, 0x37, 0xb4, 0xea, 0xc3, 0x24, 0x73, 0xf2, 0xde, 0xc5, 0x5f, 0x07, 0x99, 0x8b, 0xbf, 0x0f,
+	0xb4, 0xd7, 0xfc, 0xf9, 0x93, 0x3f, 0x3f, 0xfd, 0x73, 0x90, 0x79, 0xcd, 0x9f, 0xdf, 0xf8, 0xf3,
+	0x75, 0x49, 0xfe, 0x13, 0x07, 0x93, 0x49, 0x51, 0xde, 0x6c, 0x1f, 0xfd, 0x0b, 0x43, 0xa0, 0xbb,
+	0x1e, 0x40, 0x09, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1243,6 +1294,18 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.ShardInfo != nil {
+		{
+			size, err := m.ShardInfo.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x4a
+	}
 	if m.SkipChunks {
 		i--
 		if m.SkipChunks {
@@ -1571,6 +1634,48 @@ func (m *LabelValuesResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *ShardInfo) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ShardInfo) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ShardInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.By) > 0 {
+		for iNdEx := len(m.By) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.By[iNdEx])
+			copy(dAtA[i:], m.By[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.By[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.TotalShards != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.TotalShards))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.ShardIndex != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.ShardIndex))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintRpc(dAtA []byte, offset int, v uint64) int {
 	offset -= sovRpc(v)
 	base := offset
@@ -1704,6 +1809,10 @@ func (m *SeriesRequest) Size() (n int) {
 	if m.SkipChunks {
 		n += 2
 	}
+	if m.ShardInfo != nil {
+		l = m.ShardInfo.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -1829,6 +1938,27 @@ func (m *LabelValuesResponse) Size() (n int) {
 	return n
 }
 
+func (m *ShardInfo) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ShardIndex != 0 {
+		n += 1 + sovRpc(uint64(m.ShardIndex))
+	}
+	if m.TotalShards != 0 {
+		n += 1 + sovRpc(uint64(m.TotalShards))
+	}
+	if len(m.By) > 0 {
+		for _, s := range m.By {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
 func sovRpc(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -2592,6 +2722,42 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.SkipChunks = bool(v != 0)
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShardInfo", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.ShardInfo == nil {
+				m.ShardInfo = &ShardInfo{}
+			}
+			if err := m.ShardInfo.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -3221,6 +3387,129 @@ func (m *LabelValuesResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ShardInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ShardInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ShardInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShardIndex", wireType)
+			}
+			m.ShardIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ShardIndex |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TotalShards", wireType)
+			}
+			m.TotalShards = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TotalShards |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field By", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.By = append(m.By, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipRpc(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -27,15 +27,18 @@ const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 type Chunk_Encoding int32
 
 const (
-	Chunk_XOR Chunk_Encoding = 0
+	Chunk_XOR    Chunk_Encoding = 0
+	Chunk_SKETCH Chunk_Encoding = 1
 )
 
 var Chunk_Encoding_name = map[int32]string{
 	0: "XOR",
+	1: "SKETCH",
 }
 
 var Chunk_Encoding_value = map[string]int32{
-	"XOR": 0,
+	"XOR":    0,
+	"SKETCH": 1,
 }
 
 func (x Chunk_Encoding) String() string {
@@ -118,6 +121,8 @@ var xxx_messageInfo_Label proto.InternalMessageInfo
 type Chunk struct {
 	Type Chunk_Encoding `protobuf:"varint,1,opt,name=type,proto3,enum=thanos.Chunk_Encoding" json:"type,omitempty"`
 	Data []byte         `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	/// hash is an optional xxHash64 checksum of data. Zero means the store did not compute it.
+	Hash uint64 `protobuf:"varint,3,opt,name=hash,proto3" json:"hash,omitempty"`
 }
 
 func (m *Chunk) Reset()         { *m = Chunk{} }
@@ -200,6 +205,8 @@ type AggrChunk struct {
 	Min     *Chunk `protobuf:"bytes,6,opt,name=min,proto3" json:"min,omitempty"`
 	Max     *Chunk `protobuf:"bytes,7,opt,name=max,proto3" json:"max,omitempty"`
 	Counter *Chunk `protobuf:"bytes,8,opt,name=counter,proto3" json:"counter,omitempty"`
+	/// sketch is an optional chunk of quantile sketches, one per downsampling window.
+	Sketch *Chunk `protobuf:"bytes,9,opt,name=sketch,proto3" json:"sketch,omitempty"`
 }
 
 func (m *AggrChunk) Reset()         { *m = AggrChunk{} }
@@ -288,35 +295,37 @@ func init() {
 func init() { proto.RegisterFile("types.proto", fileDescriptor_d938547f84707355) }
 
 var fileDescriptor_d938547f84707355 = []byte{
-	// 445 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xcd, 0x6e, 0xd3, 0x40,
-	0x10, 0xc7, 0xbd, 0xfe, 0x4c, 0xa7, 0x05, 0x99, 0xa5, 0x42, 0x5b, 0x0e, 0x6e, 0x64, 0x84, 0x88,
-	0x40, 0xb8, 0xa2, 0x3c, 0x01, 0x45, 0xbe, 0xf1, 0xa1, 0x2e, 0x3d, 0x20, 0x84, 0x84, 0x36, 0xe9,
-	0xe2, 0x58, 0xc4, 0xeb, 0xc8, 0x5e, 0x43, 0xfa, 0x16, 0x20, 0x5e, 0x2a, 0xc7, 0x1e, 0x39, 0x21,
-	0x48, 0x5e, 0x04, 0xed, 0xd8, 0xa6, 0xad, 0xe4, 0xdb, 0xec, 0xfc, 0x7f, 0xf3, 0xa1, 0x9d, 0x3f,
-	0xec, 0xea, 0x8b, 0xa5, 0xac, 0x93, 0x65, 0x55, 0xea, 0x92, 0xfa, 0x7a, 0x2e, 0x54, 0x59, 0xdf,
-	0xdf, 0xcf, 0xca, 0xac, 0xc4, 0xd4, 0x91, 0x89, 0x5a, 0x35, 0x7e, 0x06, 0xde, 0x2b, 0x31, 0x95,
-	0x0b, 0x4a, 0xc1, 0x55, 0xa2, 0x90, 0x8c, 0x8c, 0xc9, 0x64, 0x87, 0x63, 0x4c, 0xf7, 0xc1, 0xfb,
-	0x2a, 0x16, 0x8d, 0x64, 0x36, 0x26, 0xdb, 0x47, 0xfc, 0x11, 0xbc, 0x97, 0xf3, 0x46, 0x7d, 0xa1,
-	0x8f, 0xc1, 0x35, 0x83, 0xb0, 0xe4, 0xf6, 0xf1, 0xbd, 0xa4, 0x1d, 0x94, 0xa0, 0x98, 0xa4, 0x6a,
-	0x56, 0x9e, 0xe7, 0x2a, 0xe3, 0xc8, 0x98, 0xf6, 0xe7, 0x42, 0x0b, 0xec, 0xb4, 0xc7, 0x31, 0x8e,
-	0xef, 0xc2, 0xa8, 0xa7, 0x68, 0x00, 0xce, 0xfb, 0xb7, 0x3c, 0xb4, 0xe2, 0xcf, 0xe0, 0xbf, 0x93,
-	0x55, 0x2e, 0x6b, 0xfa, 0x04, 0xfc, 0x85, 0x59, 0xad, 0x66, 0x64, 0xec, 0x4c, 0x76, 0x8f, 0x6f,
-	0xf5, 0x03, 0x70, 0xe1, 0x13, 0x77, 0xfd, 0xfb, 0xd0, 0xe2, 0x1d, 0x42, 0x8f, 0xc0, 0x9f, 0x99,
-	0xb9, 0x35, 0xb3, 0x11, 0xbe, 0xd3, 0xc3, 0x2f, 0xb2, 0xac, 0xc2, 0x8d, 0xfa, 0x82, 0x16, 0x8b,
-	0x7f, 0xda, 0xb0, 0xf3, 0x5f, 0xa3, 0x07, 0x30, 0x2a, 0x72, 0xf5, 0x49, 0xe7, 0xdd, 0x0f, 0x38,
-	0x3c, 0x28, 0x72, 0x75, 0x96, 0x17, 0x12, 0x25, 0xb1, 0x6a, 0x25, 0xbb, 0x93, 0xc4, 0x0a, 0xa5,
-	0x43, 0x70, 0x2a, 0xf1, 0x8d, 0x39, 0x63, 0x72, 0x7d, 0x3d, 0xec, 0xc8, 0x8d, 0x42, 0x1f, 0x80,
-	0x37, 0x2b, 0x1b, 0xa5, 0x99, 0x3b, 0x84, 0xb4, 0x9a, 0xe9, 0x52, 0x37, 0x05, 0xf3, 0x06, 0xbb,
-	0xd4, 0x4d, 0x61, 0x80, 0x22, 0x57, 0xcc, 0x1f, 0x04, 0x8a, 0x5c, 0x21, 0x20, 0x56, 0x2c, 0x18,
-	0x06, 0xc4, 0x8a, 0x3e, 0x82, 0x00, 0x67, 0xc9, 0x8a, 0x8d, 0x86, 0xa0, 0x5e, 0x8d, 0x7f, 0x10,
-	0xd8, 0xc3, 0xef, 0x7d, 0x2d, 0xf4, 0x6c, 0x2e, 0x2b, 0xfa, 0xf4, 0xc6, 0x8d, 0x0f, 0x6e, 0x9c,
-	0xa0, 0x63, 0x92, 0xb3, 0x8b, 0xa5, 0xbc, 0x3a, 0x33, 0xba, 0xc8, 0x1e, 0x72, 0x91, 0x73, 0xdd,
-	0x45, 0x13, 0x70, 0x4d, 0x1d, 0xf5, 0xc1, 0x4e, 0x4f, 0x43, 0xcb, 0x18, 0xe0, 0x4d, 0x7a, 0x1a,
-	0x12, 0x93, 0xe0, 0x69, 0x68, 0x63, 0x82, 0xa7, 0xa1, 0x73, 0xf2, 0x70, 0xfd, 0x37, 0xb2, 0xd6,
-	0x9b, 0x88, 0x5c, 0x6e, 0x22, 0xf2, 0x67, 0x13, 0x91, 0xef, 0xdb, 0xc8, 0xba, 0xdc, 0x46, 0xd6,
-	0xaf, 0x6d, 0x64, 0x7d, 0x08, 0x6a, 0x5d, 0x56, 0x72, 0x39, 0x9d, 0xfa, 0x68, 0xe8, 0xe7, 0xff,
-	0x02, 0x00, 0x00, 0xff, 0xff, 0x61, 0x46, 0x03, 0x25, 0xfd, 0x02, 0x00, 0x00,
+	// 466 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6d, 0x53, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0x8e, 0xff, 0x93, 0x69, 0x41, 0x61, 0x55, 0xa1, 0x6d, 0x0f, 0x09, 0x32, 0xaa, 0x88, 0x40,
+	0xb8, 0x6a, 0xfb, 0x04, 0xb4, 0x8a, 0x84, 0x04, 0x14, 0xb1, 0xe4, 0x80, 0xb8, 0xa0, 0x4d, 0xba,
+	0xd8, 0x51, 0x13, 0x3b, 0xf2, 0x3a, 0x6d, 0x2a, 0xf5, 0x21, 0xe0, 0x75, 0x78, 0x82, 0x1c, 0x7b,
+	0xe4, 0x84, 0xa0, 0x7d, 0x11, 0x66, 0xc7, 0x36, 0xb4, 0x92, 0x0f, 0x23, 0xcd, 0xcc, 0xf7, 0xcd,
+	0xec, 0xb7, 0xde, 0xcf, 0xb0, 0x51, 0x5c, 0x2e, 0x94, 0x8e, 0x16, 0x79, 0x56, 0x64, 0xcc, 0x2f,
+	0x12, 0x99, 0x66, 0x7a, 0x67, 0x2b, 0xce, 0xe2, 0x8c, 0x5a, 0x7b, 0x26, 0x2b, 0xd1, 0x70, 0x1f,
+	0xbc, 0xb7, 0x72, 0xac, 0x66, 0x8c, 0x81, 0x9b, 0xca, 0xb9, 0xe2, 0xd6, 0x13, 0x6b, 0xd0, 0x11,
+	0x94, 0xb3, 0x2d, 0xf0, 0xce, 0xe5, 0x6c, 0xa9, 0xb8, 0x4d, 0xcd, 0xb2, 0x08, 0xaf, 0xc0, 0x3b,
+	0x4e, 0x96, 0xe9, 0x19, 0x7b, 0x0e, 0xae, 0x39, 0x88, 0x46, 0x1e, 0x1e, 0x3c, 0x8e, 0xca, 0x83,
+	0x22, 0x02, 0xa3, 0x61, 0x3a, 0xc9, 0x4e, 0xa7, 0x69, 0x2c, 0x88, 0x63, 0xd6, 0x9f, 0xca, 0x42,
+	0xd2, 0xa6, 0x4d, 0x41, 0xb9, 0xe9, 0x25, 0x52, 0x27, 0xdc, 0xc1, 0x9e, 0x2b, 0x28, 0x0f, 0xfb,
+	0xd0, 0xae, 0x27, 0x59, 0x00, 0xce, 0xa7, 0xf7, 0xa2, 0xdb, 0x62, 0x00, 0xfe, 0xc7, 0x37, 0xc3,
+	0xd1, 0xf1, 0xeb, 0xae, 0x15, 0x7e, 0xc5, 0x5c, 0xe5, 0x53, 0xa5, 0xd9, 0x0b, 0xf0, 0x67, 0x46,
+	0xba, 0x46, 0x01, 0xce, 0x60, 0xe3, 0xe0, 0x41, 0x2d, 0x80, 0x2e, 0x74, 0xe4, 0xae, 0x7f, 0xf5,
+	0x5b, 0xa2, 0xa2, 0xb0, 0x3d, 0xf0, 0x27, 0x46, 0x97, 0x46, 0x05, 0x86, 0xfc, 0xa8, 0x26, 0xbf,
+	0x8a, 0xe3, 0x9c, 0x14, 0xd7, 0x03, 0x25, 0x2d, 0xfc, 0x61, 0x43, 0xe7, 0x1f, 0xc6, 0xb6, 0xa1,
+	0x3d, 0x9f, 0xa6, 0x5f, 0x8a, 0x69, 0xf5, 0x85, 0x1c, 0x11, 0x60, 0x3d, 0xc2, 0x92, 0x20, 0xb9,
+	0x2a, 0x21, 0xbb, 0x82, 0xe4, 0x8a, 0xa0, 0x3e, 0x38, 0xb9, 0xbc, 0xa0, 0xfb, 0xdd, 0x91, 0x47,
+	0x1b, 0x85, 0x41, 0xd8, 0x53, 0xf0, 0x26, 0xd9, 0x32, 0x2d, 0xb8, 0xdb, 0x44, 0x29, 0x31, 0xb3,
+	0x45, 0x2f, 0xe7, 0xdc, 0x6b, 0xdc, 0x82, 0x88, 0x21, 0xa0, 0x18, 0xee, 0x37, 0x12, 0x10, 0x21,
+	0x82, 0x5c, 0xf1, 0xa0, 0x99, 0x20, 0x57, 0xec, 0x19, 0x04, 0x74, 0x96, 0xca, 0x79, 0xbb, 0x89,
+	0x54, 0xa3, 0x6c, 0x17, 0x7c, 0x7d, 0xa6, 0x8a, 0x49, 0xc2, 0x3b, 0x4d, 0xbc, 0x0a, 0x0c, 0xbf,
+	0x5b, 0xb0, 0x49, 0xaf, 0xf0, 0x4e, 0x62, 0x89, 0x73, 0x2f, 0xef, 0x59, 0x65, 0xfb, 0xde, 0x4b,
+	0x55, 0x9c, 0x68, 0x84, 0x84, 0xff, 0x6e, 0x21, 0x33, 0xda, 0x4d, 0x66, 0x74, 0xee, 0x9a, 0x71,
+	0x00, 0xae, 0x99, 0x63, 0x3e, 0xd8, 0xc3, 0x0f, 0x68, 0x15, 0xf4, 0xcc, 0x09, 0x26, 0x96, 0x69,
+	0x88, 0x61, 0xd7, 0xa6, 0x06, 0x26, 0xce, 0xd1, 0xee, 0xfa, 0x4f, 0xaf, 0xb5, 0xbe, 0xe9, 0x59,
+	0xd7, 0x18, 0xbf, 0x31, 0xbe, 0xdd, 0xf6, 0x5a, 0xd7, 0x18, 0x3f, 0x31, 0x3e, 0x07, 0xba, 0xc8,
+	0x72, 0xb5, 0x18, 0x8f, 0x7d, 0xfa, 0x2f, 0x0e, 0xff, 0x02, 0x04, 0x0f, 0x72, 0xcb, 0x44, 0x03,
+	0x00, 0x00,
 }
 
 func (m *Label) Marshal() (dAtA []byte, err error) {
@@ -376,6 +385,11 @@ func (m *Chunk) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Hash != 0 {
+		i = encodeVarintTypes(dAtA, i, uint64(m.Hash))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Data) > 0 {
 		i -= len(m.Data)
 		copy(dAtA[i:], m.Data)
@@ -462,6 +476,18 @@ func (m *AggrChunk) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Sketch != nil {
+		{
+			size, err := m.Sketch.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintTypes(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x4a
+	}
 	if m.Counter != nil {
 		{
 			size, err := m.Counter.MarshalToSizedBuffer(dAtA[:i])
@@ -630,6 +656,9 @@ func (m *Chunk) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovTypes(uint64(l))
 	}
+	if m.Hash != 0 {
+		n += 1 + sovTypes(uint64(m.Hash))
+	}
 	return n
 }
 
@@ -690,6 +719,10 @@ func (m *AggrChunk) Size() (n int) {
 		l = m.Counter.Size()
 		n += 1 + l + sovTypes(uint64(l))
 	}
+	if m.Sketch != nil {
+		l = m.Sketch.Size()
+		n += 1 + l + sovTypes(uint64(l))
+	}
 	return n
 }
 
@@ -918,6 +951,25 @@ func (m *Chunk) Unmarshal(dAtA []byte) error {
 				m.Data = []byte{}
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hash", wireType)
+			}
+			m.Hash = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Hash |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
@@ -1346,6 +1398,42 @@ func (m *AggrChunk) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Sketch", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Sketch == nil {
+				m.Sketch = &Chunk{}
+			}
+			if err := m.Sketch.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
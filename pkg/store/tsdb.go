@@ -15,6 +15,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"google.golang.org/grpc/codes"
@@ -113,10 +114,14 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 
 	var respSeries storepb.Series
 
+	shard, sharded := querysharding.ShardFromProto(r.ShardInfo)
 	for set.Next() {
 		series := set.At()
 
-		respSeries.Labels = s.translateAndExtendLabels(series.Labels(), s.externalLabels)
+		respSeries.Labels = translateAndExtendLabels(series.Labels(), s.externalLabels)
+		if sharded && !shard.Matches(storepb.LabelsToPromLabelsUnsafe(respSeries.Labels)) {
+			continue
+		}
 
 		if !r.SkipChunks {
 			// TODO(fabxc): An improvement over this trivial approach would be to directly
@@ -126,7 +131,7 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 			// NOTE: XOR encoding supports a max size of 2^16 - 1 samples, so we need
 			// to chunk all samples into groups of no more than 2^16 - 1
 			// See: https://github.com/thanos-io/thanos/pull/1038.
-			c, err := s.encodeChunks(series.Iterator(), math.MaxUint16)
+			c, err := encodeChunks(series.Iterator(), math.MaxUint16)
 			if err != nil {
 				return status.Errorf(codes.Internal, "encode chunk: %s", err)
 			}
@@ -141,7 +146,7 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 	return nil
 }
 
-func (s *TSDBStore) encodeChunks(it tsdb.SeriesIterator, maxSamplesPerChunk int) (chks []storepb.AggrChunk, err error) {
+func encodeChunks(it tsdb.SeriesIterator, maxSamplesPerChunk int) (chks []storepb.AggrChunk, err error) {
 	var (
 		chkMint int64
 		chk     *chunkenc.XORChunk
@@ -171,7 +176,7 @@ func (s *TSDBStore) encodeChunks(it tsdb.SeriesIterator, maxSamplesPerChunk int)
 		chks = append(chks, storepb.AggrChunk{
 			MinTime: chkMint,
 			MaxTime: chkMaxt,
-			Raw:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()},
+			Raw:     storepb.NewChunk(storepb.Chunk_XOR, chk.Bytes()),
 		})
 		chk = nil
 	}
@@ -185,7 +190,7 @@ func (s *TSDBStore) encodeChunks(it tsdb.SeriesIterator, maxSamplesPerChunk int)
 
 // translateAndExtendLabels transforms a metrics into a protobuf label set. It additionally
 // attaches the given labels to it, overwriting existing ones on collision.
-func (s *TSDBStore) translateAndExtendLabels(m, extend labels.Labels) []storepb.Label {
+func translateAndExtendLabels(m, extend labels.Labels) []storepb.Label {
 	lset := make([]storepb.Label, 0, len(m)+len(extend))
 
 	for _, l := range m {
@@ -0,0 +1,310 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	tsdberrors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LocalBlocksStore implements the store API on top of another store, e.g. PrometheusStore, and persisted blocks of
+// a local TSDB directory. Series for the time range covered by the blocks are read from the blocks directly from disk,
+// the rest is requested from the wrapped store. Blocks are opened read-only, the head block and WAL are never read.
+// It attaches the provided external labels to all series read from the blocks.
+type LocalBlocksStore struct {
+	storepb.StoreServer
+
+	logger         log.Logger
+	dir            string
+	externalLabels func() labels.Labels
+	pool           chunkenc.Pool
+
+	mtx    sync.RWMutex
+	blocks map[ulid.ULID]*tsdb.Block
+}
+
+// NewLocalBlocksStore returns a new LocalBlocksStore reading blocks from the given TSDB directory and forwarding
+// requests for data not covered by them to the given store. Blocks are loaded by SyncBlocks.
+func NewLocalBlocksStore(logger log.Logger, dir string, upstream storepb.StoreServer, externalLabels func() labels.Labels) *LocalBlocksStore {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &LocalBlocksStore{
+		StoreServer:    upstream,
+		logger:         logger,
+		dir:            dir,
+		externalLabels: externalLabels,
+		pool:           chunkenc.NewPool(),
+		blocks:         map[ulid.ULID]*tsdb.Block{},
+	}
+}
+
+// SyncBlocks opens blocks which appeared in the TSDB directory and closes blocks which were removed from it, e.g. by
+// retention or compaction. Blocks in the process of being replaced by a compacted block are not used anymore.
+func (s *LocalBlocksStore) SyncBlocks() error {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return errors.Wrap(err, "read TSDB dir")
+	}
+
+	found := map[ulid.ULID]struct{}{}
+	for _, fi := range fis {
+		id, ok := block.IsBlockDir(fi.Name())
+		if !ok || !fi.IsDir() {
+			continue
+		}
+		found[id] = struct{}{}
+	}
+
+	s.mtx.RLock()
+	var toOpen []ulid.ULID
+	for id := range found {
+		if _, ok := s.blocks[id]; !ok {
+			toOpen = append(toOpen, id)
+		}
+	}
+	s.mtx.RUnlock()
+
+	opened := map[ulid.ULID]*tsdb.Block{}
+	for _, id := range toOpen {
+		b, err := tsdb.OpenBlock(s.logger, filepath.Join(s.dir, id.String()), s.pool)
+		if err != nil {
+			// Block might be just removed by Prometheus, try again in the next sync.
+			level.Warn(s.logger).Log("msg", "failed to open local block", "block", id, "err", err)
+			continue
+		}
+		opened[id] = b
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for id, b := range opened {
+		s.blocks[id] = b
+	}
+
+	// Compacted blocks replace their parents, which are removed by Prometheus shortly after.
+	for _, b := range s.blocks {
+		for _, p := range b.Meta().Compaction.Parents {
+			delete(found, p.ULID)
+		}
+	}
+
+	var merr tsdberrors.MultiError
+	for id, b := range s.blocks {
+		if _, ok := found[id]; ok {
+			continue
+		}
+		// Close waits for queries reading the block to finish.
+		merr.Add(errors.Wrapf(b.Close(), "close block %s", id))
+		delete(s.blocks, id)
+	}
+	return merr.Err()
+}
+
+// Close closes all loaded blocks.
+func (s *LocalBlocksStore) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var merr tsdberrors.MultiError
+	for id, b := range s.blocks {
+		merr.Add(errors.Wrapf(b.Close(), "close block %s", id))
+		delete(s.blocks, id)
+	}
+	return merr.Err()
+}
+
+// blocksFor returns queriers of the loaded blocks overlapping the given time range and the max time of all loaded
+// blocks, or math.MinInt64 if there are none. Queriers have to be closed by the caller.
+func (s *LocalBlocksStore) blocksFor(mint, maxt int64) (queriers []tsdb.Querier, blocksMaxTime int64, err error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	blocksMaxTime = math.MinInt64
+	for _, b := range s.blocks {
+		meta := b.Meta()
+		if meta.MaxTime > blocksMaxTime {
+			blocksMaxTime = meta.MaxTime
+		}
+		if meta.MinTime > maxt || meta.MaxTime <= mint {
+			continue
+		}
+		q, err := tsdb.NewBlockQuerier(b, mint, maxt)
+		if err != nil {
+			for _, q := range queriers {
+				runutil.CloseWithLogOnErr(s.logger, q, "close block querier")
+			}
+			return nil, 0, errors.Wrapf(err, "open querier for block %s", meta.ULID)
+		}
+		queriers = append(queriers, q)
+	}
+	return queriers, blocksMaxTime, nil
+}
+
+// Info returns store information of the wrapped store, with the min time lowered to the oldest local block if needed.
+func (s *LocalBlocksStore) Info(ctx context.Context, r *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	res, err := s.StoreServer.Info(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for _, b := range s.blocks {
+		if mint := b.Meta().MinTime; mint < res.MinTime {
+			res.MinTime = mint
+		}
+	}
+	return res, nil
+}
+
+// Series returns all series for a requested time range and label matcher. Series of the time range covered by the local
+// blocks are read from the blocks, series of the rest of the time range are requested from the wrapped store.
+func (s *LocalBlocksStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	srv = newShardSeriesServer(r, srv)
+	externalLabels := s.externalLabels()
+
+	match, newMatchers, err := matchesExternalLabels(r.Matchers, externalLabels)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return nil
+	}
+	if len(newMatchers) == 0 {
+		return status.Error(codes.InvalidArgument, "no matchers specified (excluding external labels)")
+	}
+
+	matchers, err := translateMatchers(newMatchers)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	queriers, blocksMaxTime, err := s.blocksFor(r.MinTime, r.MaxTime)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if len(queriers) == 0 {
+		return s.StoreServer.Series(r, srv)
+	}
+	defer func() {
+		for _, q := range queriers {
+			runutil.CloseWithLogOnErr(s.logger, q, "close block querier")
+		}
+	}()
+
+	sets := make([]tsdb.SeriesSet, 0, len(queriers))
+	for _, q := range queriers {
+		set, err := q.Select(matchers...)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		sets = append(sets, set)
+	}
+	blocksSet := &localBlocksSeriesSet{
+		set:            tsdb.NewMergedSeriesSet(sets),
+		externalLabels: externalLabels,
+		skipChunks:     r.SkipChunks,
+	}
+
+	// Data newer than the local blocks is only in the Prometheus head. It is merged with the blocks as it is sent by
+	// the wrapped store, whose series are expected to be sorted by labels like those of all stores.
+	seriesSets := []storepb.SeriesSet{blocksSet}
+	var upstreamSet *streamedSeriesSet
+	if r.MaxTime >= blocksMaxTime {
+		upstreamReq := *r
+		upstreamReq.MinTime = blocksMaxTime
+
+		ctx, cancel := context.WithCancel(srv.Context())
+		upstreamSet = newStreamedSeriesSet(ctx, func(upstreamSrv storepb.Store_SeriesServer) error {
+			return s.StoreServer.Series(&upstreamReq, upstreamSrv)
+		})
+		// Stop the wrapped store if it is still sending series, e.g. if sending to the client failed.
+		defer func() {
+			cancel()
+			upstreamSet.drain()
+		}()
+		seriesSets = append(seriesSets, upstreamSet)
+	}
+
+	set := storepb.MergeSeriesSets(seriesSets...)
+	for set.Next() {
+		lset, chks := set.At()
+		if err := srv.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: lset, Chunks: chks})); err != nil {
+			return status.Error(codes.Aborted, err.Error())
+		}
+	}
+	if err := set.Err(); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	if upstreamSet != nil {
+		for _, w := range upstreamSet.warnings {
+			if err := srv.Send(storepb.NewWarnSeriesResponse(errors.New(w))); err != nil {
+				return status.Error(codes.Aborted, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// localBlocksSeriesSet adapts series read from TSDB blocks to storepb.SeriesSet.
+type localBlocksSeriesSet struct {
+	set            tsdb.SeriesSet
+	externalLabels labels.Labels
+	skipChunks     bool
+
+	lset []storepb.Label
+	chks []storepb.AggrChunk
+	err  error
+}
+
+func (s *localBlocksSeriesSet) Next() bool {
+	if s.err != nil || !s.set.Next() {
+		return false
+	}
+	series := s.set.At()
+	s.lset = translateAndExtendLabels(series.Labels(), s.externalLabels)
+	s.chks = nil
+	if s.skipChunks {
+		return true
+	}
+	// NOTE: XOR encoding supports a max size of 2^16 - 1 samples, so chunks are cut at this size.
+	if s.chks, s.err = encodeChunks(series.Iterator(), math.MaxUint16); s.err != nil {
+		return false
+	}
+	return true
+}
+
+func (s *localBlocksSeriesSet) At() ([]storepb.Label, []storepb.AggrChunk) {
+	return s.lset, s.chks
+}
+
+func (s *localBlocksSeriesSet) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.set.Err()
+}
@@ -0,0 +1,123 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLocalBlocksStore_Series(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "local-blocks-store")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	extLset := labels.FromStrings("region", "eu-west")
+
+	// Persisted block covering [0, 1000).
+	_, err = e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 9, 0, 1000, nil, 0)
+	testutil.Ok(t, err)
+
+	// Head data newer than the block is served by the wrapped store.
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+	app := db.Appender()
+	for _, ts := range []int64{1000, 1001} {
+		_, err = app.Add(labels.FromStrings("a", "1"), ts, float64(ts))
+		testutil.Ok(t, err)
+	}
+	_, err = app.Add(labels.FromStrings("a", "2"), 1000, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	s := NewLocalBlocksStore(nil, dir, NewTSDBStore(nil, nil, db, component.Sidecar, extLset), func() labels.Labels { return extLset })
+	defer func() { testutil.Ok(t, s.Close()) }()
+	testutil.Ok(t, s.SyncBlocks())
+
+	resp, err := s.Info(ctx, &storepb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), resp.MinTime)
+
+	srv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  2000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: "1|2"}},
+	}, srv))
+	testutil.Equals(t, 2, len(srv.SeriesSet))
+
+	testutil.Equals(t, []storepb.Label{{Name: "a", Value: "1"}, {Name: "region", Value: "eu-west"}}, srv.SeriesSet[0].Labels)
+	testutil.Equals(t, 2, len(srv.SeriesSet[0].Chunks))
+	testutil.Assert(t, srv.SeriesSet[0].Chunks[0].MaxTime < 1000, "first chunk should be read from the block")
+	testutil.Equals(t, int64(1000), srv.SeriesSet[0].Chunks[1].MinTime)
+	testutil.Equals(t, int64(1001), srv.SeriesSet[0].Chunks[1].MaxTime)
+
+	testutil.Equals(t, []storepb.Label{{Name: "a", Value: "2"}, {Name: "region", Value: "eu-west"}}, srv.SeriesSet[1].Labels)
+	testutil.Equals(t, 1, len(srv.SeriesSet[1].Chunks))
+
+	// Requests covered by the block only are not forwarded.
+	srv = newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  500,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: "1|2"}},
+	}, srv))
+	testutil.Equals(t, 1, len(srv.SeriesSet))
+	testutil.Equals(t, 1, len(srv.SeriesSet[0].Chunks))
+}
+
+func TestLocalBlocksStore_SeriesStopsUpstreamOnSendFailure(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "local-blocks-store")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	extLset := labels.FromStrings("region", "eu-west")
+	_, err = e2eutil.CreateBlock(ctx, dir, []labels.Labels{labels.FromStrings("a", "1")}, 9, 0, 1000, nil, 0)
+	testutil.Ok(t, err)
+
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+	app := db.Appender()
+	for i := 0; i < 100; i++ {
+		_, err = app.Add(labels.FromStrings("a", "1", "i", strconv.Itoa(i)), 1000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	s := NewLocalBlocksStore(nil, dir, NewTSDBStore(nil, nil, db, component.Sidecar, extLset), func() labels.Labels { return extLset })
+	defer func() { testutil.Ok(t, s.Close()) }()
+	testutil.Ok(t, s.SyncBlocks())
+
+	// The wrapped store, blocked on handing over its series, is stopped once sending to the client fails.
+	err = s.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  2000,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	}, &failingSeriesServer{ctx: ctx})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.Aborted, status.Code(err))
+}
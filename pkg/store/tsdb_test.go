@@ -12,6 +12,7 @@ import (
 	"github.com/fortytw2/leaktest"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/querysharding"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
@@ -163,6 +164,48 @@ func TestTSDBStore_Series(t *testing.T) {
 	}
 }
 
+func TestTSDBStore_Series_Shard(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	tsdbStore := NewTSDBStore(nil, nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+
+	appender := db.Appender()
+	for _, pod := range []string{"a", "b", "c", "d", "e", "f"} {
+		_, err = appender.Add(labels.FromStrings("__name__", "up", "pod", pod), 1, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, appender.Commit())
+
+	for _, by := range [][]string{{"pod"}, {"region"}} {
+		seen := map[string]int{}
+		for i := uint64(0); i < 3; i++ {
+			shard := querysharding.Shard{Index: i, Total: 3, By: by}
+
+			srv := newStoreSeriesServer(ctx)
+			testutil.Ok(t, tsdbStore.Series(&storepb.SeriesRequest{
+				MinTime:   0,
+				MaxTime:   2,
+				Matchers:  []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+				ShardInfo: shard.Proto(),
+			}, srv))
+			for _, s := range srv.SeriesSet {
+				// Shards are computed on the labels including external labels.
+				lset := storepb.LabelsToPromLabels(s.Labels)
+				testutil.Assert(t, shard.Matches(lset), "series %s not in shard %s", lset, shard)
+				seen[lset.Get("pod")]++
+			}
+		}
+		testutil.Equals(t, map[string]int{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1, "f": 1}, seen)
+	}
+}
+
 func TestTSDBStore_LabelNames(t *testing.T) {
 	var err error
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
@@ -0,0 +1,34 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targets
+
+import (
+	"net/url"
+
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+)
+
+// Prometheus implements targetspb.TargetsServer by proxying the targets API of a Prometheus server.
+type Prometheus struct {
+	base   *url.URL
+	client *promclient.Client
+}
+
+// NewPrometheus returns a new Prometheus targets server.
+func NewPrometheus(base *url.URL, client *promclient.Client) *Prometheus {
+	return &Prometheus{
+		base:   base,
+		client: client,
+	}
+}
+
+// Targets returns scrape targets of the Prometheus server.
+func (p *Prometheus) Targets(r *targetspb.TargetsRequest, s targetspb.Targets_TargetsServer) error {
+	targets, err := p.client.TargetsInGRPC(s.Context(), p.base, r.State.QueryParam())
+	if err != nil {
+		return err
+	}
+	return s.Send(targetspb.NewTargetsResponse(targets))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type targetsServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	targetspb.Targets_TargetsServer
+	ctx context.Context
+
+	targets []*targetspb.TargetDiscovery
+}
+
+func (s *targetsServer) Send(r *targetspb.TargetsResponse) error {
+	s.targets = append(s.targets, r.GetTargets())
+	return nil
+}
+
+func (s *targetsServer) Context() context.Context {
+	return s.ctx
+}
+
+func TestPrometheus_Targets(t *testing.T) {
+	var (
+		path  string
+		query url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.Query()
+		_, _ = w.Write([]byte(`{"status":"success","data":{` +
+			`"activeTargets":[{"discoveredLabels":{"__address__":"localhost:9090"},"labels":{"instance":"localhost:9090","job":"prometheus"},` +
+			`"scrapePool":"prometheus","scrapeUrl":"http://localhost:9090/metrics","lastError":"","lastScrape":"2020-09-14T15:22:25.479Z","lastScrapeDuration":0.5,"health":"up"}],` +
+			`"droppedTargets":[{"discoveredLabels":{"__address__":"localhost:9100"}}]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	p := NewPrometheus(u, promclient.NewClient(nil, http.DefaultClient))
+	s := &targetsServer{ctx: context.Background()}
+	testutil.Ok(t, p.Targets(&targetspb.TargetsRequest{State: targetspb.TargetsRequest_ACTIVE}, s))
+
+	testutil.Equals(t, "/api/v1/targets", path)
+	testutil.Equals(t, "active", query.Get("state"))
+	testutil.Equals(t, []*targetspb.TargetDiscovery{{
+		ActiveTargets: []*targetspb.ActiveTarget{{
+			DiscoveredLabels:   storepb.LabelSet{Labels: []storepb.Label{{Name: "__address__", Value: "localhost:9090"}}},
+			Labels:             storepb.LabelSet{Labels: []storepb.Label{{Name: "instance", Value: "localhost:9090"}, {Name: "job", Value: "prometheus"}}},
+			ScrapePool:         "prometheus",
+			ScrapeUrl:          "http://localhost:9090/metrics",
+			LastScrape:         1600096945479,
+			LastScrapeDuration: 0.5,
+			Health:             targetspb.ActiveTarget_UP,
+		}},
+		DroppedTargets: []*targetspb.DroppedTarget{{
+			DiscoveredLabels: storepb.LabelSet{Labels: []storepb.Label{{Name: "__address__", Value: "localhost:9100"}}},
+		}},
+	}}, s.targets)
+}
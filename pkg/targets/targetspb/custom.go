@@ -0,0 +1,27 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targetspb
+
+import "strings"
+
+func NewTargetsResponse(targets *TargetDiscovery) *TargetsResponse {
+	return &TargetsResponse{
+		Result: &TargetsResponse_Targets{
+			Targets: targets,
+		},
+	}
+}
+
+func NewWarnTargetsResponse(warning error) *TargetsResponse {
+	return &TargetsResponse{
+		Result: &TargetsResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
+
+// QueryParam returns the state as accepted by the state parameter of the Prometheus targets API.
+func (s TargetsRequest_State) QueryParam() string {
+	return strings.ToLower(s.String())
+}
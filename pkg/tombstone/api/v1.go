@@ -0,0 +1,118 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	qapi "github.com/thanos-io/thanos/pkg/query/api"
+	"github.com/thanos-io/thanos/pkg/tombstone"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// API lists, adds and deletes global tombstones of a bucket.
+type API struct {
+	logger log.Logger
+	bkt    objstore.Bucket
+}
+
+func NewAPI(logger log.Logger, bkt objstore.Bucket) *API {
+	return &API{
+		logger: logger,
+		bkt:    bkt,
+	}
+}
+
+func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware) {
+	instr := func(name string, f qapi.ApiFunc) http.HandlerFunc {
+		hf := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			qapi.SetCORS(w)
+			if data, warnings, err := f(r); err != nil {
+				qapi.RespondError(w, err, data)
+			} else if data != nil {
+				qapi.Respond(w, data, warnings)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		})
+		return ins.NewHandler(name, tracing.HTTPMiddleware(tracer, name, logger, hf))
+	}
+
+	r.Get("/tombstones", instr("tombstones", api.tombstones))
+	r.Post("/tombstones", instr("add_tombstone", api.addTombstone))
+	r.Del("/tombstones/:id", instr("delete_tombstone", api.deleteTombstone))
+}
+
+func (api *API) tombstones(r *http.Request) (interface{}, []error, *qapi.ApiError) {
+	ts, err := tombstone.ReadAll(r.Context(), api.logger, api.bkt)
+	if err != nil {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorInternal, Err: err}
+	}
+	if ts == nil {
+		ts = []*tombstone.Tombstone{}
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].ID.Compare(ts[j].ID) < 0 })
+	return ts, nil, nil
+}
+
+// addTombstone uploads a tombstone deleting series matching the match[] selector. Samples within the start and end
+// parameters are deleted, all of them by default.
+func (api *API) addTombstone(r *http.Request) (interface{}, []error, *qapi.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: errors.Wrap(err, "parse form")}
+	}
+	if len(r.Form["match[]"]) != 1 {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: errors.New("exactly one match[] selector is required")}
+	}
+
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+	if s := r.FormValue("start"); s != "" {
+		t, err := qapi.ParseTime(s)
+		if err != nil {
+			return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: err}
+		}
+		mint = timestamp.FromTime(t)
+	}
+	if s := r.FormValue("end"); s != "" {
+		t, err := qapi.ParseTime(s)
+		if err != nil {
+			return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: err}
+		}
+		maxt = timestamp.FromTime(t)
+	}
+
+	t, err := tombstone.NewTombstone(r.Form["match[]"][0], mint, maxt, r.FormValue("author"), r.FormValue("reason"))
+	if err != nil {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: err}
+	}
+	if err := tombstone.Upload(r.Context(), api.bkt, t); err != nil {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorInternal, Err: err}
+	}
+	return t, nil, nil
+}
+
+func (api *API) deleteTombstone(r *http.Request) (interface{}, []error, *qapi.ApiError) {
+	id, err := ulid.Parse(route.Param(r.Context(), "id"))
+	if err != nil {
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorBadData, Err: errors.Wrap(err, "parse tombstone ID")}
+	}
+	if err := tombstone.Delete(r.Context(), api.bkt, id); err != nil {
+		if err == tombstone.ErrNotFound {
+			return nil, nil, &qapi.ApiError{Typ: qapi.ErrorNotFound, Err: err}
+		}
+		return nil, nil, &qapi.ApiError{Typ: qapi.ErrorInternal, Err: err}
+	}
+	return nil, nil, nil
+}
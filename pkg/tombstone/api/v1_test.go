@@ -0,0 +1,92 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/common/route"
+
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tombstone"
+)
+
+type tombstonesResponse struct {
+	Status string                 `json:"status"`
+	Data   []*tombstone.Tombstone `json:"data"`
+}
+
+type tombstoneResponse struct {
+	Status string               `json:"status"`
+	Data   *tombstone.Tombstone `json:"data"`
+}
+
+func TestTombstonesAPI(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	router := route.New()
+	NewAPI(log.NewNopLogger(), bkt).Register(router, opentracing.NoopTracer{}, log.NewNopLogger(), extpromhttp.NewNopInstrumentationMiddleware())
+
+	do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func() []*tombstone.Tombstone {
+		rec := do(http.MethodGet, "/tombstones", nil)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		var resp tombstonesResponse
+		testutil.Ok(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp.Data
+	}
+
+	testutil.Equals(t, 0, len(list()))
+
+	// Invalid requests are rejected.
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/tombstones", url.Values{}).Code)
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/tombstones", url.Values{"match[]": {`{job="node"`}}).Code)
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodPost, "/tombstones", url.Values{"match[]": {`{job="node"}`}, "start": {"20"}, "end": {"10"}}).Code)
+	testutil.Equals(t, 0, len(list()))
+
+	rec := do(http.MethodPost, "/tombstones", url.Values{
+		"match[]": {`{job="node"}`},
+		"start":   {"10"},
+		"end":     {"2020-01-01T00:00:00Z"},
+		"author":  {"admin"},
+		"reason":  {"wrong values"},
+	})
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	var added tombstoneResponse
+	testutil.Ok(t, json.NewDecoder(rec.Body).Decode(&added))
+	testutil.Equals(t, `{job="node"}`, added.Data.Matchers)
+	testutil.Equals(t, int64(10000), added.Data.MinTime)
+	testutil.Equals(t, int64(1577836800000), added.Data.MaxTime)
+	testutil.Equals(t, "admin", added.Data.Author)
+
+	// The tombstone is stored in the bucket.
+	stored, err := tombstone.ReadAll(context.Background(), log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(stored))
+	testutil.Equals(t, added.Data.ID, stored[0].ID)
+
+	listed := list()
+	testutil.Equals(t, 1, len(listed))
+	testutil.Equals(t, added.Data.ID, listed[0].ID)
+
+	testutil.Equals(t, http.StatusBadRequest, do(http.MethodDelete, "/tombstones/invalid", nil).Code)
+	testutil.Equals(t, http.StatusNoContent, do(http.MethodDelete, "/tombstones/"+added.Data.ID.String(), nil).Code)
+	testutil.Equals(t, http.StatusNotFound, do(http.MethodDelete, "/tombstones/"+added.Data.ID.String(), nil).Code)
+	testutil.Equals(t, 0, len(list()))
+}
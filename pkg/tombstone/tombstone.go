@@ -0,0 +1,201 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package tombstone implements global tombstones, which delete series matching a selector within a time range
+// from all blocks of the bucket. Store gateways mask tombstoned samples at query time and compactors remove them
+// from blocks while compacting.
+package tombstone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// TombstoneDir is the bucket directory holding global tombstone files.
+	TombstoneDir = "tombstones"
+
+	// TombstoneVersion1 is the version of tombstone files supported by Thanos.
+	TombstoneVersion1 = 1
+)
+
+// Tombstone deletes all samples of series matching a selector within a time range.
+type Tombstone struct {
+	// ID of the tombstone, which is also the name of its file.
+	ID ulid.ULID `json:"id"`
+
+	// Matchers is the series selector of deleted series, e.g. {__name__="up",job="node"}.
+	// Matchers are matched against series labels including external labels of blocks.
+	Matchers string `json:"matchers"`
+
+	// MinTime and MaxTime are the inclusive time range of deleted samples in milliseconds.
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+
+	// CreationTime is a unix timestamp of when the tombstone was created.
+	CreationTime int64 `json:"creation_time"`
+
+	// Author and Reason are human readable details about the deletion.
+	Author string `json:"author,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Version of the file.
+	Version int `json:"version"`
+
+	matchers []*labels.Matcher
+}
+
+// NewTombstone returns a new tombstone for the given series selector and time range.
+func NewTombstone(selector string, minTime, maxTime int64, author, reason string) (*Tombstone, error) {
+	now := time.Now()
+	t := &Tombstone{
+		ID:           ulid.MustNew(ulid.Timestamp(now), rand.New(rand.NewSource(now.UnixNano()))),
+		Matchers:     selector,
+		MinTime:      minTime,
+		MaxTime:      maxTime,
+		CreationTime: now.Unix(),
+		Author:       author,
+		Reason:       reason,
+		Version:      TombstoneVersion1,
+	}
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Tombstone) init() error {
+	if t.Version != TombstoneVersion1 {
+		return errors.Errorf("unexpected tombstone version %d", t.Version)
+	}
+	if t.MinTime > t.MaxTime {
+		return errors.Errorf("tombstone min time %d is after max time %d", t.MinTime, t.MaxTime)
+	}
+	ms, err := promql.ParseMetricSelector(t.Matchers)
+	if err != nil {
+		return errors.Wrapf(err, "parse tombstone matchers %q", t.Matchers)
+	}
+	t.matchers = ms
+	return nil
+}
+
+// LabelMatchers returns the parsed matchers of the tombstone.
+func (t *Tombstone) LabelMatchers() []*labels.Matcher {
+	return t.matchers
+}
+
+// Overlaps returns true if the tombstone deletes samples within the given inclusive time range.
+func (t *Tombstone) Overlaps(mint, maxt int64) bool {
+	return t.MinTime <= maxt && mint <= t.MaxTime
+}
+
+// Matches returns true if the series with the given labels is deleted by the tombstone.
+func (t *Tombstone) Matches(lset labels.Labels) bool {
+	for _, m := range t.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Upload uploads the tombstone to <TombstoneDir>/<ID>.json in the bucket.
+func Upload(ctx context.Context, bkt objstore.Bucket, t *Tombstone) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "json encode tombstone")
+	}
+	name := filename(t.ID)
+	if err := bkt.Upload(ctx, name, bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload file %s to bucket", name)
+	}
+	return nil
+}
+
+// Delete deletes the tombstone with the given ID from the bucket. It returns ErrNotFound if there is no such tombstone.
+func Delete(ctx context.Context, bkt objstore.Bucket, id ulid.ULID) error {
+	name := filename(id)
+	ok, err := bkt.Exists(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "check existence of file %s", name)
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	if err := bkt.Delete(ctx, name); err != nil {
+		return errors.Wrapf(err, "delete file %s from bucket", name)
+	}
+	return nil
+}
+
+// ErrNotFound is returned by Delete if the tombstone does not exist.
+var ErrNotFound = errors.New("tombstone not found")
+
+func filename(id ulid.ULID) string {
+	return path.Join(TombstoneDir, id.String()+".json")
+}
+
+// ReadAll reads all tombstones from the bucket. Invalid tombstone files, e.g. partially uploaded ones, are skipped.
+func ReadAll(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) ([]*Tombstone, error) {
+	var res []*Tombstone
+	err := bkt.Iter(ctx, TombstoneDir+objstore.DirDelim, func(name string) error {
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		t, err := read(ctx, logger, bkt, name)
+		if err != nil {
+			if bkt.IsObjNotFoundErr(errors.Cause(err)) {
+				return nil
+			}
+			if errors.Cause(err) == errInvalidTombstone {
+				level.Warn(logger).Log("msg", "skipping invalid tombstone", "file", name, "err", err)
+				return nil
+			}
+			return err
+		}
+		res = append(res, t)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read tombstones")
+	}
+	return res, nil
+}
+
+var errInvalidTombstone = errors.New("invalid tombstone")
+
+func read(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, name string) (*Tombstone, error) {
+	r, err := bkt.Get(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get file %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close tombstone reader")
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file %s", name)
+	}
+	t := &Tombstone{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrapf(errInvalidTombstone, "file: %s; err: %v", name, err)
+	}
+	if err := t.init(); err != nil {
+		return nil, errors.Wrapf(errInvalidTombstone, "file: %s; err: %v", name, err)
+	}
+	return t, nil
+}
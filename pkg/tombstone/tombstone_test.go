@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package tombstone
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTombstone(t *testing.T) {
+	_, err := NewTombstone(`{job="node"`, 0, 10, "", "")
+	testutil.NotOk(t, err)
+	_, err = NewTombstone(`{job="node"}`, 10, 0, "", "")
+	testutil.NotOk(t, err)
+
+	ts, err := NewTombstone(`{__name__="up", job=~"node|prom"}`, 10, 20, "admin", "wrong values")
+	testutil.Ok(t, err)
+
+	testutil.Assert(t, ts.Matches(labels.FromStrings("__name__", "up", "job", "node", "cluster", "eu1")), "expected match")
+	testutil.Assert(t, !ts.Matches(labels.FromStrings("__name__", "up", "job", "receive")), "unexpected match")
+	testutil.Assert(t, !ts.Matches(labels.FromStrings("job", "node")), "unexpected match")
+
+	testutil.Assert(t, ts.Overlaps(0, 10), "expected overlap")
+	testutil.Assert(t, ts.Overlaps(20, 30), "expected overlap")
+	testutil.Assert(t, ts.Overlaps(12, 15), "expected overlap")
+	testutil.Assert(t, !ts.Overlaps(0, 9), "unexpected overlap")
+	testutil.Assert(t, !ts.Overlaps(21, 30), "unexpected overlap")
+}
+
+func TestUploadReadAll(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	res, err := ReadAll(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(res))
+
+	ts, err := NewTombstone(`{job="node"}`, 10, 20, "", "")
+	testutil.Ok(t, err)
+	testutil.Ok(t, Upload(ctx, bkt, ts))
+
+	// Invalid tombstones, e.g. partially uploaded ones, are skipped.
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(TombstoneDir, "partial.json"), bytes.NewReader([]byte(`{"id":`))))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(TombstoneDir, "version.json"), bytes.NewReader([]byte(`{"matchers":"{job=\"node\"}","version":2}`))))
+
+	res, err = ReadAll(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*Tombstone{ts}, res)
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	ts, err := NewTombstone(`{job="node"}`, 10, 20, "", "")
+	testutil.Ok(t, err)
+	testutil.Ok(t, Upload(ctx, bkt, ts))
+
+	testutil.Ok(t, Delete(ctx, bkt, ts.ID))
+	res, err := ReadAll(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(res))
+
+	testutil.Equals(t, ErrNotFound, Delete(ctx, bkt, ts.ID))
+}
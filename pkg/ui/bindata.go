@@ -4,6 +4,8 @@
 // pkg/ui/templates/alerts.html
 // pkg/ui/templates/bucket.html
 // pkg/ui/templates/bucket_menu.html
+// pkg/ui/templates/compactions.html
+// pkg/ui/templates/flags.html
 // pkg/ui/templates/graph.html
 // pkg/ui/templates/query_menu.html
 // pkg/ui/templates/rule_menu.html
@@ -205,7 +207,7 @@ func pkgUiTemplatesBucketHtml() (*asset, error) {
 	return a, nil
 }
 
-var _pkgUiTemplatesBucket_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6c\x92\x31\x8f\x9c\x40\x0c\x85\xfb\xfd\x15\xd6\xa4\x9e\x9b\x3e\x82\x2d\x52\xa5\x4c\x71\x4a\x1b\x99\x1d\xc3\x5a\xeb\x35\x68\x30\x64\x23\xc4\x7f\x8f\x06\x96\x0b\x4b\xae\x82\x79\x7a\xf6\xf3\xe7\x99\x69\x8a\x54\xb3\x12\x38\xc5\xd1\xcd\xf3\xa9\x50\x1c\xe1\x22\xd8\xf7\x65\x96\x2a\x4c\x50\xf3\x83\xa2\xb7\xb6\x83\x55\xf0\xf4\xe8\x50\xa3\xef\xef\x9b\x10\x31\xdd\xa0\x6a\x96\xaf\x3b\x9f\x00\x00\x8a\xc8\x1f\x7d\x2e\xad\x1a\xb2\x52\xf2\xb5\x0c\x1c\x9f\x8e\xc5\x55\x0d\x66\xad\x82\xfd\xe9\xa8\x74\xeb\xc1\xbd\xc6\x7b\x6b\x9b\x46\x28\x39\x88\x68\xf8\x3c\xe5\x9e\x22\xd8\xf5\xb4\xc9\x98\x1a\xb2\xd2\x7d\x51\x1c\x7d\xce\x23\x35\x07\x98\x18\x9f\xd3\x52\x2c\x5d\x8d\x92\x0b\x16\x35\x7b\x52\x2b\x6b\xcc\xa1\x42\xb0\x22\x29\xdd\xfb\x12\x95\x19\xb9\x41\xe3\x56\x77\x83\x2f\xc3\xf7\x1d\xea\xe7\xc3\x7a\xbe\x64\x7b\x11\xb2\x65\x87\x1b\x56\xc4\x9d\x82\x87\x06\x55\x42\x8d\x0e\xae\x89\xea\xd2\x4d\x13\x74\x68\xd7\x1f\x89\x6a\x7e\xc0\x3c\x07\x77\x7e\xbf\xa2\xb6\x3d\x7c\x1b\x2e\x37\x32\xf8\xc9\xf4\x9b\x52\x11\x70\xd7\x31\x2f\x9e\xe3\x81\xeb\x35\x64\x5b\x1e\x7c\x6c\xf1\x40\x36\xc8\xa1\x22\xbf\x8e\x57\xcf\xe2\x13\xde\xf9\x3c\x1b\xdd\x3f\x71\xfd\xc7\xe9\x85\xf5\xb6\x31\x5e\xcd\xba\xfe\x6b\x08\xb6\x80\xbd\x71\x1b\x1a\x32\x63\x6d\x7c\x6f\x98\x8c\xe2\xdb\x3d\x06\x07\xdb\x05\xff\xaa\x04\xf5\xe6\xce\xdf\x49\xba\x17\xee\x7f\x3b\x16\x3e\xd0\x84\x41\xf6\x77\x10\x79\x7c\xbe\xd1\xf5\xb7\x08\x8a\xe3\xf9\x34\x4d\xa4\x71\x9e\x4f\x7f\x03\x00\x00\xff\xff\x74\xc4\xee\x39\x13\x03\x00\x00")
+var _pkgUiTemplatesBucket_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xad\x53\xb1\x8e\xa3\x30\x10\xed\xf3\x15\x96\xaf\x76\xdc\x9f\x80\x22\xdb\x6c\xb9\xc5\x6a\xdb\xd3\x80\x07\x32\xca\xc4\x20\xdb\xec\xe6\x84\xf2\xef\x6b\x43\xd8\x00\xb9\x3b\x5d\xb1\x34\xc6\xa3\x37\xf3\xde\x1b\x1e\xc3\x60\xb0\x26\x8b\x42\x5a\x78\x97\xd7\xeb\x2e\x8b\xa7\xa8\x18\xbc\xcf\x53\xa9\x04\x27\x6a\xba\xa0\x51\xa1\xed\xc4\x54\x50\x78\xe9\xc0\x1a\xe5\xcf\x73\xc1\x80\x3b\x89\xb2\x19\x4f\x59\xec\x44\x7c\x32\x43\x5f\x73\xaa\xd6\x06\x88\x24\x4e\xd5\xdc\x93\xb9\x21\x46\x54\xd9\x87\xd0\x5a\x11\x7e\x77\x98\xcb\xe9\x22\xd7\xf4\x91\xb8\x69\x18\x9d\x14\x06\x02\xdc\x6e\x69\x26\x33\x74\x1e\xe7\x32\xb8\x06\x43\x2e\x7f\xc4\x26\x95\xf8\xd0\x06\x29\xc0\x11\xdc\xd4\xa2\xc9\x65\x0d\x9c\x1a\xc6\x6a\xc2\xb8\x96\x27\x9a\x4d\x07\x43\x89\x9c\xcb\xd7\x91\x2a\x79\xa4\x06\x02\x45\x65\x77\xe1\xa3\x78\x1f\x07\xff\x59\xac\xa2\x2a\xc1\x33\x9d\x20\x0b\xbb\x7a\xb2\xb8\xa8\xc0\x66\x40\xe9\xa2\x58\x29\x8e\x0e\xeb\x5c\x0e\x83\xe8\x20\x1c\x5f\xe2\x85\x2e\xe2\x7a\xd5\xb2\x78\x3d\x82\x6d\xbd\x38\xf4\xd5\x09\x83\x78\x23\xfc\x40\x97\x69\x58\x4c\x4c\x8b\x27\xb3\xf1\xb5\x26\x99\x97\x27\xbe\xb6\xb8\x71\xd6\xf3\xa6\x23\xa5\x63\x8d\x49\xcf\x30\x50\x2d\xf6\xcf\xe0\x9f\xda\x73\x07\x55\xda\x91\x8f\x19\xda\xc2\x32\xa6\xc5\x38\x45\x01\xcf\x71\x37\x4b\xe7\x8a\xc9\x9e\xfe\xe1\xfa\xc0\x6d\x75\xf2\xc9\x67\xa6\x99\x8a\x6f\x67\xa8\xee\xfa\x65\xb1\x30\xf3\x77\xc6\x61\x40\x6b\xfe\xd7\xeb\x03\xea\xe1\xd3\xaf\xe4\x1d\x43\xe8\xfc\x4f\xad\xc3\xf8\xad\xf7\xd4\xea\x98\xed\x40\xb6\x51\x3e\xe6\x3c\xa0\xd9\x9f\x8d\x96\x62\xce\xfc\xaf\x92\x21\x36\x17\xcf\xc8\xdd\x2a\x0a\xf7\xd8\x6d\x1d\x64\xba\xe7\x65\x2c\x63\x66\x6e\xbf\xed\xf4\x9a\xe9\xa8\xa9\xd8\xcd\x26\x3f\x01\xfd\x0d\x28\x89\x26\x04\x00\x00")
 
 func pkgUiTemplatesBucket_menuHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -220,7 +222,47 @@ func pkgUiTemplatesBucket_menuHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/ui/templates/bucket_menu.html", size: 787, mode: os.FileMode(420), modTime: time.Unix(1583953499, 0)}
+	info := bindataFileInfo{name: "pkg/ui/templates/bucket_menu.html", size: 1062, mode: os.FileMode(420), modTime: time.Unix(1792144445, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _pkgUiTemplatesCompactionsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbd\x56\xdf\x6f\xd3\x30\x10\x7e\xdf\x5f\x61\x59\x7b\xa4\x09\x82\x37\xd4\x14\x01\x02\x84\x40\x53\x05\x12\x0f\xbc\x4c\x6e\x7c\x6d\xac\xb9\x76\x66\x3b\x65\x95\x95\xff\x9d\xb3\x93\x34\x69\x97\xb0\x95\x4d\xf4\x21\xca\xe5\xbe\xbb\xfb\x7c\xbe\x1f\xf5\x9e\xc3\x5a\x28\x20\xb4\x00\xc6\x69\x5d\x5f\xcc\xb7\xe0\x18\x29\x9c\x2b\x67\x70\x5b\x89\x5d\x46\x0d\xac\x0d\xd8\x82\x92\x5c\x2b\x07\xca\x65\xf4\xf5\x4b\x9a\x2e\x2e\xe6\x52\xa8\x1b\xe2\xf6\x25\x64\xd4\xc1\x9d\x4b\x73\x6b\x29\x31\x20\x33\x6a\xdd\x5e\xa2\x09\x80\xa3\xa4\x40\xfb\x8c\x7a\x4f\x4a\xe6\x8a\x25\x0a\xe2\x8e\xd4\x75\x6a\x1d\x73\x22\x0f\x36\xa9\xa9\x10\x9c\xe0\xdb\xdb\x5d\x86\xb8\x55\x25\x24\xff\x09\xc6\x0a\xad\x10\x49\x17\x17\xde\x83\xe2\xc8\x0d\x5f\x3a\xba\x2d\x97\xc8\x98\x8b\x1d\xc9\x25\xb3\x36\x8b\x9f\x19\x02\xcc\x6c\x2d\x2b\xc1\xd1\x96\xe0\x6f\x5e\xbc\x5a\x7c\xd0\xdb\x92\xe5\x0e\x7d\xda\x79\x8a\x72\x54\x78\x2f\xd6\x24\x59\x1a\xbd\xc1\x13\xda\xe4\x87\x63\xc6\x01\x7f\xe7\x92\x2f\xf6\x17\x18\x8d\xce\xa3\x79\xb9\xb8\xd2\x78\xfa\xce\x01\x31\x95\x22\xb6\xc1\x92\x3d\xb8\x64\x9e\x96\x9d\x3f\x90\x16\x7a\xb3\x25\x92\xc2\x8f\x7d\x84\xf0\xa1\xae\x89\x5e\x13\x57\xc0\x94\x4b\xef\xad\x50\x39\x8c\x11\x43\x5b\xb6\xd1\x47\x01\x63\x66\x62\x3c\xc7\x56\x12\xba\x4c\x34\x42\x7c\xce\x56\xda\x70\x30\xd0\xa5\xa3\x01\x87\x0b\x1f\xca\xa6\x17\x5a\xc0\xe2\xb3\xd1\x55\x39\x4f\xf1\xed\x9e\x0a\x19\x39\x18\x57\x7d\x63\x2b\xcc\xc2\xb8\xee\x3b\x58\x2d\xab\x70\xe2\x71\xfd\x7b\xa9\xf3\x9b\x09\xdb\xa5\x64\x4a\x61\x7a\xfe\x86\x69\x13\x35\xae\xfc\x24\x94\xc0\xa2\x9c\xd0\x1e\x15\xc8\x18\xe0\xa3\x31\xda\x1c\xab\x50\x32\x47\xd2\x69\x52\x57\x9a\xef\x7b\xd9\x7b\xc3\xd4\x06\xc8\xe5\x26\x24\x96\xbc\xc9\x06\x57\x1c\x73\x6d\xdb\xab\x9c\xb8\x11\xbe\xf0\xbe\xb1\x4d\xbe\xc2\xbe\xae\x31\x20\xbf\x87\xe9\x0a\x20\x34\x18\xd0\x63\xf5\xa1\xe6\xe1\xb6\x25\x91\xc4\x8b\x24\x94\x6b\x05\x74\x10\xfd\xe0\xd0\x96\x4c\x75\x2e\x99\x04\xe3\x48\x7c\xce\x6c\x95\xe7\xc8\x9b\xc4\x30\xd7\x42\x71\x91\x33\xa7\x0d\x09\x93\x60\x56\x95\x25\x98\x9c\x59\x8c\x7f\x60\x1c\x03\x05\xce\xc1\xe3\x18\xad\xd0\x3a\x64\x8c\x5b\xd7\x26\x6a\x73\x16\x43\xa1\xd6\xfa\x7f\xd0\xfb\xcd\xc4\xd9\xdc\x2c\xe0\xa4\xe2\xcc\xec\x9f\x99\xe0\x39\x1c\x78\xa8\x45\xf3\x9c\x04\x0e\xa3\x68\xd0\x11\xf7\x0b\x74\xcc\xb4\xed\x0b\xc5\xb6\xf0\x82\x5c\xee\x98\xac\x20\xb4\x47\x1b\xb9\x99\x28\x0f\x9d\x6d\xc5\x38\xfa\x88\xcf\x59\x69\xc4\x16\xb3\x1b\xd9\x07\xa7\x75\x1d\x56\x50\xe3\x18\x57\xca\xd3\xcf\x70\xc8\x4a\x3f\xd1\x26\xfa\xb1\x87\x36\x83\x6b\x0a\x36\x9d\x15\xc1\x07\xb9\x08\x53\x70\x2c\x13\xb8\x04\x43\x24\xc1\x83\xff\x20\x3c\xe9\x70\x58\xe7\xfd\xad\x9f\xec\xc4\x2b\xd8\x81\xe9\xca\xad\xdb\x55\xa7\xe8\x66\x51\xb5\x21\x1f\x8e\xd2\x8d\xe6\x47\x86\xe9\xe1\x8f\x8a\xd3\x5a\x0d\x26\xfc\x19\x97\xd0\x93\xc4\x05\xf0\xf4\xfe\x1a\x34\x54\xf4\xf7\xef\xa5\x78\xbc\x7c\x4e\xf1\xa8\xed\x97\x0f\x0a\xe1\x8f\x00\xfe\x67\x6b\x4a\xa3\x03\xff\x01\x5f\x74\x42\xc0\xff\x09\x00\x00")
+
+func pkgUiTemplatesCompactionsHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgUiTemplatesCompactionsHtml,
+		"pkg/ui/templates/compactions.html",
+	)
+}
+
+func pkgUiTemplatesCompactionsHtml() (*asset, error) {
+	bytes, err := pkgUiTemplatesCompactionsHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/ui/templates/compactions.html", size: 2559, mode: os.FileMode(420), modTime: time.Unix(1792144445, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _pkgUiTemplatesFlagsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x55\x90\x3d\x6f\xc3\x20\x10\x86\x77\xff\x8a\x2b\xea\x4a\x2c\x65\xac\x6c\x2f\x95\x3a\x55\x1d\xbb\x63\xdf\x39\x20\x61\x88\x80\xa4\x89\x90\xff\x7b\xc1\x36\x76\xbb\x20\xde\xbb\xe7\xbe\xde\x18\x91\x46\x65\x08\x98\x24\x81\x6c\x9e\x9b\x17\xce\xc1\xa8\x07\x70\xde\xc5\x48\x06\xe7\xb9\xaa\xe2\x4e\x0d\xd6\x04\x32\x21\x81\x15\x40\x83\xea\x0e\x83\x16\xde\xb7\x4b\x42\x24\xc4\xf1\x51\xdf\x14\xb2\x2e\xe5\x13\x21\xcf\xa0\xb0\x65\xa3\x16\x17\xcf\xba\x77\x3b\x4d\xc2\x20\xff\xcc\xbd\x3e\x72\xac\xa9\xe5\x79\x43\x83\xe8\x35\x95\x76\xab\x58\x5e\xee\xa7\xed\xd3\x5b\x87\xe4\x08\x4b\x3c\x38\x75\xdd\x95\xb4\x77\x72\xdb\xd8\xdc\xad\xb7\xf8\x2c\x0a\x20\x46\x27\xcc\x85\xe0\x35\x6f\x02\x6f\x2d\x9c\x96\xf1\xcb\x19\xa5\xc2\x1d\x78\x96\x12\xfc\x60\xaf\xd4\x32\x67\x7f\x58\xf2\x62\x29\x3d\x7d\x89\x89\x92\x4b\x75\x90\xff\x69\xdc\x89\x6f\xa1\x6f\x2b\x82\x07\x92\x94\xfb\xbb\xcd\x6a\xec\x9e\x3b\x96\x4d\x22\x9f\x93\x45\x53\x27\x7f\xbb\xaa\xc0\xbf\x53\xab\x05\x6c\xab\x01\x00\x00")
+
+func pkgUiTemplatesFlagsHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgUiTemplatesFlagsHtml,
+		"pkg/ui/templates/flags.html",
+	)
+}
+
+func pkgUiTemplatesFlagsHtml() (*asset, error) {
+	bytes, err := pkgUiTemplatesFlagsHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/ui/templates/flags.html", size: 427, mode: os.FileMode(420), modTime: time.Unix(1792136549, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -245,7 +287,7 @@ func pkgUiTemplatesGraphHtml() (*asset, error) {
 	return a, nil
 }
 
-var _pkgUiTemplatesQuery_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x54\xb1\x6e\xdc\x30\x0c\xdd\xf3\x15\x84\x02\x74\x73\xb4\xb7\xb6\x87\x2e\x6d\xb7\xa2\xc9\x5e\xd0\x27\xda\x16\x22\x4b\x82\x44\x5f\x53\x18\xfe\xf7\x42\xba\x3b\xe3\xec\x9c\x0f\xc8\xd0\x49\x10\x41\x3e\xbe\x27\x3e\x6a\x9a\x14\xb5\xda\x12\x08\x8b\x47\x31\xcf\x0f\x00\x00\xa5\xc5\x23\x1c\x0c\xc6\x58\xa5\x70\x83\x01\x5a\xfd\x46\xaa\x60\xe7\xe1\x14\x28\xe8\xcd\xa3\x55\x45\x1c\x2e\x01\x85\xe1\x15\x9a\x2e\x9f\xa2\xce\x38\x19\x4b\xe9\x05\xeb\xe0\x2c\xa3\xb6\x14\x8a\xd6\x8c\x5a\x5d\x65\xe5\xcc\x66\x64\x76\x16\xf8\xaf\xa7\x4a\x9c\x2e\x62\x4d\xa3\x60\xd7\x75\x86\x82\x00\x85\x8c\xe7\x5b\xc2\x35\x06\x7d\xa4\x4b\x18\x43\x47\x5c\x89\x47\x8b\xc7\x22\xf5\x24\xcb\x02\x30\x68\x3c\xb3\x26\x55\x89\x16\x4d\x2a\xc8\xd1\x94\x13\x9c\x39\xb5\xd9\x54\x18\x6c\xc8\x54\xe2\x25\xb7\x4a\x5a\x75\x87\xac\x9d\xdd\x90\xcf\x02\xa2\x47\x7b\x9b\x70\xa1\x0f\xa9\xa4\x94\x29\x65\x23\x5b\x9e\xa4\x6e\xa2\xb8\x01\x6a\x02\x5a\x25\xa0\x0f\xd4\x56\x62\x9a\xc0\x23\xf7\x3f\x03\xb5\xfa\x0d\xe6\x59\x8a\xfa\xa5\x47\xeb\x62\x29\x71\x83\x93\x9e\x5f\xab\x8d\xb2\x35\xf4\xe5\xf9\x60\x79\xc7\x1b\xda\x46\xb3\xa9\x4a\x7e\x79\x9f\x97\x73\x8d\xbe\xca\x2d\x34\xd3\x20\xea\x95\xa0\xc2\x68\xfb\xba\x2b\xa6\x0b\xe8\x7b\x51\x7f\x4b\x47\x12\x54\x4a\xa3\xff\x4f\xa7\xc8\x2e\x50\x14\xf5\x73\x3e\x3f\xdc\x0b\x54\x70\x5e\xb9\x3f\xb7\xcc\x70\x35\xc8\x53\xf3\x47\xb1\xa5\xb5\x94\x9f\x5d\xb2\x71\xf5\x02\x0e\xc1\x99\xab\x8d\xc8\xb6\xec\x31\x7a\xe7\x47\x5f\x09\x0e\x23\xed\xb8\xbb\x7e\x66\xe4\x31\xae\x8d\x79\xc0\x40\xbc\x58\xf1\x9d\x61\xde\x99\xe7\x5c\xb6\x70\x1d\xc8\x8e\x77\xf4\xc2\xca\xbc\x4b\x55\x1e\xcd\xfe\x18\x12\x4d\x51\xff\x1a\x2d\xeb\x81\xe0\x13\x0e\xfe\x0b\x7c\x1d\xb5\x51\xf0\xc3\xb6\x2e\x0c\x79\xe5\xee\x73\x95\x4a\x1f\x77\x26\xf7\x31\xff\xdc\x1b\xe5\x8e\xb1\x7a\x66\x1f\x3f\x4b\xc9\x79\x09\x9f\xb4\x93\x1d\x31\x6b\xdb\x15\x91\x31\x30\xa9\xa7\x41\x49\x01\x97\x8f\xe9\x77\x63\xd0\xbe\x8a\xfa\x3b\x19\xbf\x2b\xea\x36\xeb\x52\x8e\x66\xfb\x7f\xac\x84\x5f\x5d\x4b\x69\xf1\x58\x3f\x4c\x13\x59\x35\xcf\x0f\xff\x02\x00\x00\xff\xff\x43\xdf\x18\x28\xeb\x05\x00\x00")
+var _pkgUiTemplatesQuery_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb5\x55\x4d\x8f\xdb\x20\x10\xbd\xe7\x57\x20\x56\xea\xcd\xcb\xbd\xb5\x7d\x68\xa5\x7e\x48\x3d\x54\xed\xde\xab\x71\x18\xdb\x68\x31\x20\xc0\x6d\x2a\x2b\xff\xbd\x80\x13\x2b\x26\x71\x56\x5b\xa9\xb9\x90\x19\xcd\xc7\x7b\xc3\x63\x3c\x4d\x1c\x5b\xa1\x90\x50\x05\xbf\xe8\xf1\xb8\x23\xe1\x57\x86\xff\x64\x2f\xc1\xb9\x2a\xba\x1b\xb0\xa4\x15\x07\xe4\x85\xd7\x86\xcc\x8e\x02\x0f\x06\x14\x2f\xdc\x70\x76\x70\xb0\xcf\xa4\xe9\xd2\x49\xeb\x54\x27\xd5\xe2\x62\xa9\xb5\xd7\xca\x43\x68\x66\x8b\x56\x8e\x82\x5f\x44\xa5\xc8\x66\xf4\x5e\x2b\xe2\xff\x18\xac\xe8\x6c\xd0\x35\x8c\x00\xa0\xeb\x24\x5a\x4a\x38\x78\x38\x59\xb1\xae\x94\x60\x1c\x9e\xdd\x60\x3b\xf4\x15\x7d\x08\x49\x45\xec\x89\xca\x53\x02\x56\xc0\x09\x35\xf2\x8a\xb6\x20\x63\x42\xf2\xc6\x18\xab\xe5\xdc\x26\xcb\x90\xd0\xa0\xac\xe8\x53\x6a\x15\xb9\x8a\x0e\xbc\x08\xc8\xd6\xe0\x13\x01\x17\x8a\xdf\x06\x5c\x88\x7d\x4c\x29\x59\x0c\xc9\x68\xb3\x99\x6a\xe6\x85\xac\x50\x63\x03\x70\x4a\x7a\x8b\x6d\x45\xa7\x89\x18\xf0\xfd\xb7\x60\x88\x03\x39\x1e\x19\xad\x9f\x7a\x50\xda\x95\x0c\xb2\x3a\x71\xfc\x82\x67\xcc\xd6\xa5\xcf\xe3\x23\xcb\x1c\x6f\x70\x1b\x65\x96\x15\xf5\x72\x1d\x97\x62\xa5\xb8\x88\x2d\x84\xc7\x21\x50\xbf\x24\x54\x48\xa1\x9e\x37\xc9\x74\x16\x4c\x4f\xeb\x4f\xf1\x88\x84\x4a\x26\xc5\xff\xe9\xe4\xbc\xb6\xe8\x68\xfd\x23\x9d\xaf\xee\x45\xb8\xd5\x86\xeb\xdf\x6a\x63\x10\xa7\x8b\x9c\x9b\x3f\xd0\x1c\xd6\x92\x7e\x52\x49\xa6\xea\xa5\x38\x09\xda\xbc\x78\x11\x49\x96\x3d\x38\xa3\xcd\x68\x2a\xea\xed\x88\x1b\xea\x0e\xbc\xc0\x8f\x6e\x2d\xcc\x3d\x58\xf4\x8b\x14\xaf\x04\x73\x25\x9e\x53\xda\x82\x75\x40\x35\xde\xe1\xbb\x16\xef\x92\x95\xae\x66\xfb\x1a\x22\x4c\x5a\x7f\x1f\x95\x17\x03\x92\x37\x30\x98\x77\xe4\xfd\x28\x24\x27\x5f\x54\xab\xed\x90\x9e\xdc\x5d\xac\xff\xd2\xb7\x95\xd0\x85\xb6\x1f\xf4\x30\xc4\x5d\xf6\x35\xee\xc1\x8f\xd1\x77\x7f\x2a\x2c\x8c\x65\x43\x23\xaf\x53\xea\xee\x65\x22\xb9\x84\x7b\xef\x8d\x7b\xcb\x98\x4f\xcf\xfd\x51\x68\x16\x56\x9d\x17\xaa\x2b\xc2\x10\xad\x47\xfe\x38\x70\x46\xc9\x79\x05\xfe\x6c\x24\x84\xe4\xfa\x33\x4a\xb3\x49\xea\x36\xea\x92\x8d\x32\xdf\x54\x2b\xe2\x17\x66\xc9\x02\xce\x7a\x37\x4d\xa8\x78\xf8\x86\xfc\x05\x33\xe0\xc7\x55\x55\x06\x00\x00")
 
 func pkgUiTemplatesQuery_menuHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -260,7 +302,7 @@ func pkgUiTemplatesQuery_menuHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/ui/templates/query_menu.html", size: 1515, mode: os.FileMode(420), modTime: time.Unix(1583953499, 0)}
+	info := bindataFileInfo{name: "pkg/ui/templates/query_menu.html", size: 1621, mode: os.FileMode(420), modTime: time.Unix(1792136549, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -305,7 +347,7 @@ func pkgUiTemplatesRulesHtml() (*asset, error) {
 	return a, nil
 }
 
-var _pkgUiTemplatesStatusHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcc\x94\xc1\x8f\xaa\x30\x10\xc6\xef\xfc\x15\xf3\x7a\x47\x12\xcf\xb5\x07\x35\x79\x79\x57\xf3\x5c\xcf\x40\xc7\xed\x64\xb1\x35\x43\x65\xd7\x90\xfe\xef\x1b\x10\x54\x12\x5d\xdd\xe5\xb2\x17\xe8\xd7\xf9\xf2\xfd\xda\x81\xb6\xae\x35\x6e\xc9\x22\x08\x83\xa9\x16\x21\xc8\x3f\x71\x0c\x96\x3e\x20\x8e\x55\x5d\xa3\xd5\x21\x44\xd1\xc5\x95\x3b\xeb\xd1\x7a\x11\x42\x04\x20\x35\x55\x90\x17\x69\x59\xce\xda\x42\x4a\x16\x39\xde\x16\x07\xd2\x42\x45\x00\x00\xd2\x4c\x81\xf4\x4c\xf0\xc1\x7a\xda\xa1\x50\xab\xd3\x00\xfe\xd9\xad\xe3\x5d\xea\xc9\x59\x99\x98\x69\xe7\xf6\x69\x56\x60\x9f\x78\x12\xed\x33\x2e\x77\xdd\x20\x73\xac\x91\x51\xf7\xf3\x9e\x69\x7f\x56\xc6\x55\xc8\x1d\xb9\x49\xcb\x9c\x3e\xf6\xaa\xd1\x7c\x11\x8d\x34\x6a\xbd\x6f\x16\x23\x13\x6f\x86\x15\xad\xea\x7a\x32\x27\xf6\x66\xb2\xfe\xbf\x08\x41\x26\x5e\x5f\x05\x25\xd7\x49\x37\x62\x37\x8e\xdf\xc8\xbe\xc2\x92\x18\x73\xef\xf8\x78\x87\xb0\xd8\x2c\xbf\xca\x96\xc9\xd5\x0e\x64\xd2\xee\x51\x45\x83\xbe\x66\x07\x2a\x34\x5d\x7a\x29\xd4\xbc\x99\xf9\x1d\xed\x85\x32\x77\x7b\x9c\x09\x76\xef\x42\xbd\x20\x97\xed\x6a\x6e\x76\xa2\xab\xf6\xef\xef\x76\x7c\x40\x5a\x61\x45\x4f\xa0\x7a\xdb\x28\xd6\x9c\x53\x9b\x9b\x07\xa4\x93\x69\x1c\xa7\xf9\xaa\xeb\x12\xf9\x11\xaa\xf7\x8d\xa7\x2d\x53\x7f\xef\x64\x0c\x68\x8d\x6f\x14\xed\xaf\x7b\xee\xdf\x38\xfb\x7e\x74\x66\x64\xa2\xa9\x52\x51\x7f\xa5\x7d\x06\x00\x00\xff\xff\xd7\x00\x8e\xa1\xf8\x04\x00\x00")
+var _pkgUiTemplatesStatusHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcd\x95\x4f\x6f\x82\x30\x18\xc6\xef\x7c\x8a\x8e\x3b\x92\x78\xc6\x26\x13\x16\xb2\xc3\xe2\xa2\x32\x77\x05\xfa\x3a\x9a\x61\x6b\x4a\x71\x33\x84\xef\xbe\x16\xf9\x33\x33\x37\x44\x2e\xbb\x40\x9f\xbe\x4f\x9e\x5f\x29\x7d\xd3\xa2\x20\xb0\xa5\x0c\x90\x99\x40\x48\xcc\xb2\x74\xee\x2c\x0b\x31\xfa\x89\x2c\x0b\x17\x05\x30\x52\x96\x86\x51\xb4\xae\x98\x33\x09\x4c\x2a\xa3\x81\x90\x43\xe8\x01\xc5\x69\x98\x65\xb3\xaa\x10\x2a\x8b\xb0\xb6\x69\x4e\x89\x89\x55\x5d\x39\x92\x29\xa2\x64\x66\x8a\x9c\x49\xba\x03\x13\x2f\x4f\x03\xf4\xc8\xb6\x5c\xec\x42\x49\x39\x73\xec\x64\x5a\xbb\x65\x18\xa5\xd0\x24\x9e\x44\xf5\xb4\xb2\x5d\x3d\x88\xb8\x20\x20\x80\x34\xf3\x52\xd0\x7d\xab\x12\x7e\x00\x51\x93\x75\x5a\xc4\xc9\xb1\x51\x5a\x8b\x4e\x68\x99\xe0\x95\x0c\x85\x44\x6b\xb5\x20\xc7\x56\xf2\xac\x4a\xd4\xe7\x4f\xea\xe5\x4e\x2a\xa3\xf6\x4d\x82\xb5\xab\x36\xc9\x56\xe5\x2e\xd8\xfe\x9e\x7c\x01\x13\xec\xe5\xaf\x88\x8c\xb2\x18\xd0\x4f\xd0\x60\xc8\x86\x8b\x77\xca\xde\x90\x47\x05\xc4\x92\x8b\x63\xcf\x27\xb9\x1b\x6f\x30\xc3\xe7\x82\xe7\x52\xfd\xe5\xac\x27\xbc\x35\xba\x5c\xcd\x0c\xe7\x2c\x9e\xee\x5f\x9f\x97\x0b\x77\xd5\xc7\x69\x8d\x37\x30\x7c\xb7\x37\xdd\x77\x6f\xc8\xf5\x1e\xe6\x81\xdf\x1b\x5d\xb9\xfe\x4a\x57\xe3\xee\x00\x2b\xa1\x8f\x38\x36\xce\xda\x2a\xca\x69\x4a\x68\xd7\x4a\x26\x9e\xeb\x99\xff\xd1\x5d\x28\x8b\xf9\x1e\x54\xef\xf3\x0f\x13\xbf\x80\xc8\xaa\xd5\x5c\xdc\x95\xba\xda\xbc\x87\xee\xf9\x19\x69\x09\x07\x7a\x05\xaa\xb1\x8d\x62\xcd\x45\xc8\xe2\xa4\x87\x74\x32\x8d\xe3\xe8\xbf\x1a\x64\x20\xfa\x50\x8d\x6f\x3c\xcd\x0b\x25\x5c\x43\xd3\xbe\x51\x34\x9f\x5f\x77\x36\x5a\xdf\x4d\x3d\xe3\xd8\xea\xae\xc2\x46\x73\xa3\x7d\x01\x89\x74\x4a\x81\xf7\x06\x00\x00")
 
 func pkgUiTemplatesStatusHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -320,12 +362,12 @@ func pkgUiTemplatesStatusHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/ui/templates/status.html", size: 1272, mode: os.FileMode(420), modTime: time.Unix(1583953499, 0)}
+	info := bindataFileInfo{name: "pkg/ui/templates/status.html", size: 1783, mode: os.FileMode(420), modTime: time.Unix(1792136549, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _pkgUiTemplatesStoresHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x56\x41\x6b\xeb\x38\x10\xbe\xe7\x57\x0c\xa2\xd7\xc4\xd0\xcb\xc2\xe2\x78\x59\x96\xc2\x1e\xda\xf2\x20\x7d\xbd\x3e\x14\x6b\x12\x8b\x2a\x92\x91\xc6\x6d\x82\xd0\x7f\x7f\xc8\xb1\x13\xb9\x76\xd2\xf4\x5d\x0c\x1a\xcd\xcc\x37\x99\xef\x9b\x51\xbc\x17\xb8\x91\x1a\x81\x55\xc8\x05\x0b\x61\x96\x2b\xa9\xdf\x80\x0e\x35\x2e\x19\xe1\x9e\xb2\xd2\x39\x06\x16\xd5\x92\x39\x3a\x28\x74\x15\x22\x31\xa8\x2c\x6e\x96\xcc\x7b\xa8\x39\x55\x3f\x2c\x6e\xe4\x1e\x42\xc8\x1c\x71\x92\x65\x8c\xc9\x6c\xa3\xd0\x2d\x4a\xe7\xfe\x79\x5f\x7a\x0f\xeb\x46\x2a\xf1\x8a\xd6\x49\xa3\x21\x04\x56\xcc\xbc\x47\x2d\x42\x98\xcd\xce\x45\x94\x46\x13\x6a\x6a\xeb\x10\xf2\x1d\x4a\xc5\x9d\x5b\xb6\x66\x2e\x35\xda\xf9\x46\x35\x52\xb0\x62\x06\x00\xe0\xbd\xe5\x7a\x8b\x70\xe7\xc8\x58\x7c\x39\xd4\x08\x7f\x2f\x61\xb1\x32\x8d\x2d\xd1\x85\xd0\x39\xc9\x4d\xe2\xd1\x59\xf3\xea\xbe\xf0\x9e\x24\xa9\x34\x7c\xb1\x22\x2b\xf5\x36\x84\x3c\xab\xee\x7b\x0c\x54\x2e\x8d\xfa\xa9\xdf\xb4\xf9\xd0\x10\xfd\x07\x6e\xed\x4f\x69\xbd\x88\xaf\x15\xf6\xa5\x1f\x0f\xed\x77\xbe\x36\x56\xa0\xc5\xbe\xfe\xa3\x73\xec\x7b\x7a\xb6\xe7\x43\xe7\x50\x3c\x68\x51\x1b\xa9\x29\xcf\xa8\x1a\xdf\xae\x88\x53\xe3\xa6\xef\xfe\xd5\xda\x34\xba\x44\x01\x8f\x7c\x8d\x6a\x85\x74\xc1\xf1\x49\x6a\x78\x91\x3b\xbc\x70\xcb\xf7\x57\x6e\x1f\xb9\x23\x58\x35\x65\x89\xce\x6d\x1a\x05\xff\x23\x57\x54\xc1\x7f\x15\x96\x6f\x57\x22\x9e\xd0\x39\xbe\xfd\x94\x33\xcf\xd2\x06\xc4\xbb\x4f\xed\x59\x1b\x71\x38\x9f\x87\x12\x88\xf4\x4b\x2d\x70\x0f\x77\x8b\x55\x34\xb8\x31\xf3\x17\x9a\x2c\x0a\xef\x8f\xbe\x8b\x67\xbe\xc3\x28\x01\x12\x23\xa7\x9e\xd4\xa8\x72\x64\xc3\x6b\xe8\xc5\xa6\x0d\x75\xb0\x8b\xf8\x3b\x1f\xac\x35\x36\x01\x3f\xa5\x73\x35\xd7\x7d\x42\xae\xd0\x12\xb4\xdf\xb9\x3b\x76\x12\x5a\x90\x5f\x52\x0b\x59\x72\x32\x16\xe2\x30\xce\x9b\xba\x46\x5b\x72\x87\xac\x68\xea\x3c\x8b\x39\xa6\xca\x48\x44\x7b\x13\xa6\x88\x5d\xb4\x5f\x42\x0a\xf3\xa1\xaf\x80\x9e\x46\x20\xe1\x6f\xdc\xc4\x71\xe8\xb7\x26\xe6\x1c\x34\x94\xc2\xb9\x8e\x4e\x12\xaa\x57\x7c\x94\xc5\x89\x90\xce\x36\xd5\x9c\xcf\xaa\xb8\x5a\xf3\x18\xaa\x85\x39\x81\x1e\xa1\xa6\x70\x4e\x69\x53\x32\xd6\x5c\x6c\x11\xda\xef\xbc\xb6\x72\xc7\xed\x81\x45\x49\xb6\xf9\x3a\x49\xc6\x75\xdb\x19\x5e\xb9\x6a\x30\x04\x76\x89\x0c\xb8\x40\xc8\x09\x7b\x44\x0c\x8c\x86\xef\xab\x3c\x79\x76\x81\x81\x3c\x6b\xc9\x2b\x6e\x90\x82\xf7\x1b\x63\x77\x9c\xe2\x72\x71\xc4\x77\x75\x4f\xd4\x93\xd4\xd1\x76\x61\x0e\xaf\xc4\xf1\xfd\xf5\x38\x27\x75\x89\xe9\x7c\xb6\x6b\x2a\x04\xe0\x5b\x73\xa3\x5c\x93\x27\xe5\xea\x84\xc3\xf7\x27\x6e\x42\xe7\x47\xc4\x5b\xe1\xfe\x78\x38\x87\xdc\x8f\x36\xc8\xd4\xca\x84\xd2\xa8\x08\xb7\x64\x7f\x4d\xd4\xfd\x6c\xc0\x1d\x77\xb0\xc5\xad\x74\x14\xc7\xf8\x3b\xf8\x83\x7a\x07\x5a\x1b\xe8\x6b\x5c\xe9\x3a\x7d\x40\x92\x3f\x11\x69\xf7\x3f\xb8\xd5\x52\x6f\x59\x31\x55\x65\x9e\x09\xf9\x3e\x7c\xd7\x3b\x53\x7f\xfc\x1d\x00\x00\xff\xff\xff\x5c\x1c\xa9\x36\x09\x00\x00")
+var _pkgUiTemplatesStoresHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x9d\x56\xdf\x8b\xdb\x30\x0c\x7e\xbf\xbf\xc2\x98\x7b\x6d\x03\x7b\x19\x8c\xa6\x63\x8c\x83\x0d\xee\xca\xa0\xdb\x3d\xec\x65\x38\xb1\xda\x98\xba\x76\xb0\x9d\x5e\x8b\xc9\xff\x3e\x39\x3f\x7a\x49\x93\xf4\x7a\xd7\x87\x50\xc9\x92\x3e\x59\xfa\xa4\xc4\x7b\x0e\x1b\xa1\x80\xd0\x0c\x18\xa7\x65\x79\xb7\x90\x42\xed\x88\x3b\xe5\x10\x53\x07\x47\x17\xa5\xd6\x52\x62\x40\xc6\xd4\xba\x93\x04\x9b\x01\x38\x4a\x32\x03\x9b\x98\x7a\x4f\x72\xe6\xb2\x5f\x28\x88\x23\x29\xcb\xc8\x3a\xe6\x44\x1a\x7c\x22\x53\xa0\xf1\x1c\xff\x7d\x3d\xc4\x68\x97\x14\x42\xf2\x67\x30\x56\x68\x85\x96\x74\x79\xe7\x3d\x28\x8e\x88\xf8\xa7\x4d\x22\xd5\xca\x81\x72\x55\x1e\x5c\x1c\x48\x2a\x99\xb5\x71\xa5\x66\x68\x60\x66\x1b\x59\x08\x8e\xbe\x04\x7f\xde\x1b\xa6\xb6\x40\xee\xad\xd3\x06\x7e\x63\xc6\xe4\x4b\x4c\xe6\x6b\x5d\x98\x14\x2c\x86\xa8\x8d\xc4\xa6\x63\xd1\x68\x17\xd9\xa7\xa5\xf7\x4e\x38\xd9\x75\x9f\xaf\x9d\x11\x6a\x5b\x96\x8b\x08\xcf\x1b\x77\x90\xb6\xeb\xf5\x47\xed\x94\x7e\x51\x24\xd8\xf7\xcc\xaa\xab\x54\x56\x8e\x25\x18\xb6\x49\xbd\x16\xaa\xe7\x2c\xd1\x86\x83\x81\x36\xff\xda\x38\xd4\xbd\x2b\x9b\x57\xa1\x31\x58\x3e\x28\x9e\x6b\xa1\xdc\x22\x42\x61\x70\xba\xc6\x92\x17\x76\xfc\xec\x9b\x52\xba\x50\x29\x70\xf2\xc8\x12\x90\x6b\x70\x13\x86\x4f\x02\xaf\x24\xf6\x30\x71\xca\x8e\x57\x4e\x1f\x99\x75\x64\x5d\xa4\x58\x74\xbb\x29\x24\xf9\x01\x4c\xba\x8c\x7c\xcf\x20\xdd\x5d\xf1\x78\x42\x73\xb6\xbd\x88\x89\x92\xe9\x49\x97\xe5\x49\x34\x3f\xbd\xca\x7d\x0a\x84\xf6\x0b\xc5\xe1\x48\xee\xb1\x95\xa8\xb0\xc3\xce\x4f\x14\x99\x23\x1d\x6a\xdb\xf9\x8a\xed\x21\x50\xc0\xf1\x81\x51\xdb\xd4\xc0\x72\xa0\xfd\xe3\x33\xd9\x94\x76\x0d\xec\x3c\xdc\xf3\xc1\x18\x6d\x3a\xe0\xe7\x70\x36\x67\xaa\x0d\xc8\x24\x18\x47\xaa\xe7\xcc\xd6\x95\x24\x15\xc8\x3f\xbc\x8f\x48\x19\x46\x23\x61\x18\x67\x45\x9e\x83\x49\x99\x45\xf4\x22\x5f\x44\x21\xc6\x58\x1a\x1d\xd2\xde\x84\xc9\x43\x15\xcd\x9b\x90\x1c\x99\x7f\x05\xf4\x3c\x02\x9d\xfe\x0d\x8b\x38\x74\x7d\xd7\xc4\x4c\x51\x61\x40\x09\xd9\x32\x3e\xd0\xe2\xdc\x90\x46\x37\x56\x9c\x4b\x56\x5c\xcd\x79\x08\x55\xc1\x9c\x41\x6b\xa8\x31\x9c\xd1\x66\x24\x8c\x63\xa0\xea\x39\xcb\x8d\xd8\x33\x73\xa2\x81\x92\x55\xbc\x86\x92\x61\xdd\x36\x8a\x67\x26\x0b\xd4\xd0\xa9\x66\x4c\x35\x64\xba\x31\xc3\xe1\x7b\x2b\x0e\x5a\x8f\x77\x00\x0f\x42\xf3\x96\x37\x50\xc1\xfb\x8d\x36\x7b\xe6\xc2\x72\x41\xf2\xed\xf3\xb6\x51\xb8\x8f\x82\x6e\x62\x0e\xaf\xf8\xb1\xe3\x75\xbf\xf3\xdb\xa0\x1a\xce\x6a\x47\xcd\x7f\xda\xbf\x60\x74\x59\xae\xe0\x00\xa6\x1d\x1e\xef\xad\xc0\xcd\x39\xb0\x2e\x4b\xc2\xb6\xba\x29\xca\x8d\x04\xbf\x84\x9d\xda\x09\x1f\x98\x51\x3a\xd5\xfc\x5b\xe1\x3e\x3c\xce\x7d\xb6\x0c\x76\xce\xd8\x92\x25\xa9\x96\x01\x2e\xa6\x9f\x47\xf2\x5e\x69\x62\xeb\xad\x6d\x60\x2b\xac\x0b\x83\xff\x1e\xfc\x5e\xbe\x3d\x76\xf6\x18\x39\xcc\x34\xe9\xbe\x72\x3a\x9f\x1d\xdd\xea\xbf\x30\xa3\xf0\xdb\x80\x2e\xc7\xb2\x5c\x44\xe8\xd5\xff\x12\x68\x54\xad\xf8\x1f\x0d\xe7\x13\xaa\x68\x09\x00\x00")
 
 func pkgUiTemplatesStoresHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -340,7 +382,7 @@ func pkgUiTemplatesStoresHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/ui/templates/stores.html", size: 2358, mode: os.FileMode(420), modTime: time.Unix(1585516941, 0)}
+	info := bindataFileInfo{name: "pkg/ui/templates/stores.html", size: 2408, mode: os.FileMode(420), modTime: time.Unix(1792136483, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -1581,6 +1623,8 @@ var _bindata = map[string]func() (*asset, error){
 	"pkg/ui/templates/alerts.html":                                                                   pkgUiTemplatesAlertsHtml,
 	"pkg/ui/templates/bucket.html":                                                                   pkgUiTemplatesBucketHtml,
 	"pkg/ui/templates/bucket_menu.html":                                                              pkgUiTemplatesBucket_menuHtml,
+	"pkg/ui/templates/compactions.html":                                                              pkgUiTemplatesCompactionsHtml,
+	"pkg/ui/templates/flags.html":                                                                    pkgUiTemplatesFlagsHtml,
 	"pkg/ui/templates/graph.html":                                                                    pkgUiTemplatesGraphHtml,
 	"pkg/ui/templates/query_menu.html":                                                               pkgUiTemplatesQuery_menuHtml,
 	"pkg/ui/templates/rule_menu.html":                                                                pkgUiTemplatesRule_menuHtml,
@@ -1799,6 +1843,8 @@ var _bintree = &bintree{nil, map[string]*bintree{
 				"alerts.html":      &bintree{pkgUiTemplatesAlertsHtml, map[string]*bintree{}},
 				"bucket.html":      &bintree{pkgUiTemplatesBucketHtml, map[string]*bintree{}},
 				"bucket_menu.html": &bintree{pkgUiTemplatesBucket_menuHtml, map[string]*bintree{}},
+				"compactions.html": &bintree{pkgUiTemplatesCompactionsHtml, map[string]*bintree{}},
+				"flags.html":       &bintree{pkgUiTemplatesFlagsHtml, map[string]*bintree{}},
 				"graph.html":       &bintree{pkgUiTemplatesGraphHtml, map[string]*bintree{}},
 				"query_menu.html":  &bintree{pkgUiTemplatesQuery_menuHtml, map[string]*bintree{}},
 				"rule_menu.html":   &bintree{pkgUiTemplatesRule_menuHtml, map[string]*bintree{}},
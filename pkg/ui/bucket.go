@@ -7,12 +7,17 @@ import (
 	"encoding/json"
 	"html/template"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	qapi "github.com/thanos-io/thanos/pkg/query/api"
 )
 
 // Bucket is a web UI representing state of buckets as a timeline.
@@ -20,12 +25,33 @@ type Bucket struct {
 	*BaseUI
 
 	externalPrefix, prefixHeader string
+
+	mtx sync.RWMutex
 	// Unique Prometheus label that identifies each shard, used as the title. If
 	// not present, all labels are displayed externally as a legend.
 	Label       string
 	Blocks      template.JS
 	RefreshedAt time.Time
 	Err         error
+
+	blocks   []metadata.Meta
+	progress *compact.Progress
+}
+
+// BlocksInfo is the JSON view of blocks served by the blocks API.
+type BlocksInfo struct {
+	Label       string       `json:"label"`
+	Groups      []BlockGroup `json:"groups"`
+	RefreshedAt time.Time    `json:"refreshedAt"`
+	Err         string       `json:"err,omitempty"`
+}
+
+// BlockGroup contains blocks with the same external labels, resolution and compaction level sorted by min time.
+type BlockGroup struct {
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Level      int               `json:"level"`
+	Blocks     []metadata.Meta   `json:"blocks"`
 }
 
 func NewBucketUI(logger log.Logger, label, externalPrefix, prefixHeader string) *Bucket {
@@ -45,14 +71,116 @@ func (b *Bucket) Register(r *route.Router, ins extpromhttp.InstrumentationMiddle
 	}
 	r.WithPrefix(b.externalPrefix).Get("/", instrf("root", b.root))
 	r.WithPrefix(b.externalPrefix).Get("/static/*filepath", instrf("static", b.serveStaticAsset))
+	r.WithPrefix(b.externalPrefix).Get("/api/v1/blocks", instrf("blocks", b.blocksAPI))
+	if b.progress != nil {
+		r.WithPrefix(b.externalPrefix).Get("/compactions", instrf("compactions", b.compactions))
+		r.WithPrefix(b.externalPrefix).Get("/api/v1/compactions", instrf("compactions_api", b.compactionsAPI))
+	}
+}
+
+// WithCompactionProgress makes the bucket UI serve the progress of the compaction groups of the given compactor.
+// It has to be called before Register.
+func (b *Bucket) WithCompactionProgress(p *compact.Progress) *Bucket {
+	b.progress = p
+	return b
+}
+
+// HasCompactions returns true if the bucket UI serves the progress of compaction groups.
+func (b *Bucket) HasCompactions() bool {
+	return b.progress != nil
 }
 
 // Handle / of bucket UIs.
 func (b *Bucket) root(w http.ResponseWriter, r *http.Request) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
 	b.executeTemplate(w, "bucket.html", GetWebPrefix(b.logger, b.externalPrefix, b.prefixHeader, r), b)
 }
 
+// Handle /api/v1/blocks of bucket UIs.
+func (b *Bucket) blocksAPI(w http.ResponseWriter, _ *http.Request) {
+	qapi.SetCORS(w)
+	qapi.Respond(w, b.BlocksInfo(), nil)
+}
+
+// Handle /compactions of bucket UIs.
+func (b *Bucket) compactions(w http.ResponseWriter, r *http.Request) {
+	b.executeTemplate(w, "compactions.html", GetWebPrefix(b.logger, b.externalPrefix, b.prefixHeader, r), struct {
+		*Bucket
+		Progress *compact.ProgressInfo
+	}{Bucket: b, Progress: b.progress.Info()})
+}
+
+// Handle /api/v1/compactions of bucket UIs.
+func (b *Bucket) compactionsAPI(w http.ResponseWriter, _ *http.Request) {
+	qapi.SetCORS(w)
+	qapi.Respond(w, b.progress.Info(), nil)
+}
+
+// BlocksInfo returns the last view of blocks grouped by external labels, resolution and compaction level.
+func (b *Bucket) BlocksInfo() *BlocksInfo {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	info := &BlocksInfo{
+		Label:       b.Label,
+		Groups:      []BlockGroup{},
+		RefreshedAt: b.RefreshedAt,
+	}
+	if b.Err != nil {
+		info.Err = b.Err.Error()
+	}
+
+	type groupKey struct {
+		labels     string
+		resolution int64
+		level      int
+	}
+	var (
+		groups = map[groupKey]*BlockGroup{}
+		keys   []groupKey
+	)
+	for _, m := range b.blocks {
+		k := groupKey{
+			labels:     labels.FromMap(m.Thanos.Labels).String(),
+			resolution: m.Thanos.Downsample.Resolution,
+			level:      m.Compaction.Level,
+		}
+		g, ok := groups[k]
+		if !ok {
+			g = &BlockGroup{
+				Labels:     m.Thanos.Labels,
+				Resolution: k.resolution,
+				Level:      k.level,
+			}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		g.Blocks = append(g.Blocks, m)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].labels != keys[j].labels {
+			return keys[i].labels < keys[j].labels
+		}
+		if keys[i].resolution != keys[j].resolution {
+			return keys[i].resolution < keys[j].resolution
+		}
+		return keys[i].level < keys[j].level
+	})
+	for _, k := range keys {
+		g := groups[k]
+		sort.Slice(g.Blocks, func(i, j int) bool { return g.Blocks[i].MinTime < g.Blocks[j].MinTime })
+		info.Groups = append(info.Groups, *g)
+	}
+	return info
+}
+
 func (b *Bucket) Set(blocks []metadata.Meta, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
 	if err != nil {
 		// Last view is maintained.
 		b.RefreshedAt = time.Now()
@@ -69,4 +197,5 @@ func (b *Bucket) Set(blocks []metadata.Meta, err error) {
 	b.RefreshedAt = time.Now()
 	b.Blocks = template.JS(data)
 	b.Err = err
+	b.blocks = blocks
 }
@@ -0,0 +1,93 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBucket_BlocksInfo(t *testing.T) {
+	meta := func(id uint64, lset map[string]string, res int64, lvl int, mint int64) metadata.Meta {
+		return metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(id, nil),
+				MinTime:    mint,
+				MaxTime:    mint + 100,
+				Compaction: tsdb.BlockMetaCompaction{Level: lvl},
+			},
+			Thanos: metadata.Thanos{
+				Labels:     lset,
+				Downsample: metadata.ThanosDownsample{Resolution: res},
+			},
+		}
+	}
+	a := map[string]string{"cluster": "a"}
+	b := map[string]string{"cluster": "b"}
+
+	bucket := NewBucketUI(log.NewNopLogger(), "cluster", "", "")
+	testutil.Equals(t, &BlocksInfo{Label: "cluster", Groups: []BlockGroup{}}, bucket.BlocksInfo())
+
+	bucket.Set([]metadata.Meta{
+		meta(1, b, 0, 1, 200),
+		meta(2, a, 0, 1, 100),
+		meta(3, a, 300000, 2, 0),
+		meta(4, a, 0, 1, 0),
+		meta(5, a, 0, 2, 0),
+	}, nil)
+
+	info := bucket.BlocksInfo()
+	testutil.Equals(t, "", info.Err)
+	testutil.Equals(t, []BlockGroup{
+		{Labels: a, Resolution: 0, Level: 1, Blocks: []metadata.Meta{meta(4, a, 0, 1, 0), meta(2, a, 0, 1, 100)}},
+		{Labels: a, Resolution: 0, Level: 2, Blocks: []metadata.Meta{meta(5, a, 0, 2, 0)}},
+		{Labels: a, Resolution: 300000, Level: 2, Blocks: []metadata.Meta{meta(3, a, 300000, 2, 0)}},
+		{Labels: b, Resolution: 0, Level: 1, Blocks: []metadata.Meta{meta(1, b, 0, 1, 200)}},
+	}, info.Groups)
+
+	// Last view is maintained on error.
+	bucket.Set(nil, errors.New("fetch failed"))
+	info = bucket.BlocksInfo()
+	testutil.Equals(t, "fetch failed", info.Err)
+	testutil.Equals(t, 4, len(info.Groups))
+}
+
+func TestBucket_CompactionsPage(t *testing.T) {
+	get := func(b *Bucket, path string) (int, string) {
+		r := route.New()
+		b.Register(r, extpromhttp.NewNopInstrumentationMiddleware())
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	// Bucket UIs without a compactor serve no compactions page.
+	code, body := get(NewBucketUI(log.NewNopLogger(), "", "/loaded", ""), "/loaded/")
+	testutil.Equals(t, http.StatusOK, code)
+	testutil.Assert(t, !strings.Contains(body, `href="/loaded/compactions"`), "menu must not link to missing compactions page")
+	code, _ = get(NewBucketUI(log.NewNopLogger(), "", "/loaded", ""), "/loaded/compactions")
+	testutil.Equals(t, http.StatusNotFound, code)
+
+	b := NewBucketUI(log.NewNopLogger(), "", "/loaded", "").WithCompactionProgress(compact.NewProgress())
+	code, body = get(b, "/loaded/")
+	testutil.Equals(t, http.StatusOK, code)
+	testutil.Assert(t, strings.Contains(body, `href="/loaded/compactions"`), "menu must link to compactions page with external prefix")
+
+	code, body = get(b, "/loaded/compactions")
+	testutil.Equals(t, http.StatusOK, code)
+	testutil.Assert(t, strings.Contains(body, "No compaction run started yet."), "compactions page must show the state of the run")
+	testutil.Assert(t, strings.Contains(body, "<th>Planned Blocks</th>"), "compactions page must list groups")
+}
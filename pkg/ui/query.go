@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
@@ -25,6 +26,7 @@ import (
 type Query struct {
 	*BaseUI
 	storeSet *query.StoreSet
+	flags    []flag
 
 	externalPrefix, prefixHeader string
 
@@ -34,6 +36,21 @@ type Query struct {
 	now   func() model.Time
 }
 
+// flag is a command-line flag of the querier and its value.
+type flag struct {
+	Name  string
+	Value string
+}
+
+type runtimeInfo struct {
+	StartTime      time.Time
+	CWD            string
+	GoroutineCount int
+	GOMAXPROCS     int
+	GOGC           string
+	GODEBUG        string
+}
+
 type thanosVersion struct {
 	Version   string `json:"version"`
 	Revision  string `json:"revision"`
@@ -43,14 +60,24 @@ type thanosVersion struct {
 	GoVersion string `json:"goVersion"`
 }
 
-func NewQueryUI(logger log.Logger, reg prometheus.Registerer, storeSet *query.StoreSet, externalPrefix, prefixHeader string) *Query {
+// NewQueryUI returns the UI of the querier. The given flags, mapped from their names to their values, are shown on
+// the flags page.
+func NewQueryUI(logger log.Logger, reg prometheus.Registerer, storeSet *query.StoreSet, flagsMap map[string]string, externalPrefix, prefixHeader string) *Query {
 	cwd, err := os.Getwd()
 	if err != nil {
 		cwd = "<error retrieving current working directory>"
 	}
+
+	flags := make([]flag, 0, len(flagsMap))
+	for name, value := range flagsMap {
+		flags = append(flags, flag{Name: name, Value: value})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
 	return &Query{
 		BaseUI:         NewBaseUI(logger, "query_menu.html", queryTmplFuncs()),
 		storeSet:       storeSet,
+		flags:          flags,
 		externalPrefix: externalPrefix,
 		prefixHeader:   prefixHeader,
 		cwd:            cwd,
@@ -82,6 +109,7 @@ func (q *Query) Register(r *route.Router, ins extpromhttp.InstrumentationMiddlew
 	r.Get("/graph", instrf("graph", q.graph))
 	r.Get("/stores", instrf("stores", q.stores))
 	r.Get("/status", instrf("status", q.status))
+	r.Get("/flags", instrf("flags", q.flagsPage))
 
 	r.Get("/static/*filepath", instrf("static", q.serveStaticAsset))
 	// TODO(bplotka): Consider adding more Thanos related data e.g:
@@ -106,12 +134,17 @@ func (q *Query) status(w http.ResponseWriter, r *http.Request) {
 	prefix := GetWebPrefix(q.logger, q.externalPrefix, q.prefixHeader, r)
 
 	q.executeTemplate(w, "status.html", prefix, struct {
-		Birth   time.Time
-		CWD     string
+		Runtime runtimeInfo
 		Version thanosVersion
 	}{
-		Birth: q.birth,
-		CWD:   q.cwd,
+		Runtime: runtimeInfo{
+			StartTime:      q.birth,
+			CWD:            q.cwd,
+			GoroutineCount: runtime.NumGoroutine(),
+			GOMAXPROCS:     runtime.GOMAXPROCS(0),
+			GOGC:           os.Getenv("GOGC"),
+			GODEBUG:        os.Getenv("GODEBUG"),
+		},
 		Version: thanosVersion{
 			Version:   version.Version,
 			Revision:  version.Revision,
@@ -123,6 +156,16 @@ func (q *Query) status(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (q *Query) flagsPage(w http.ResponseWriter, r *http.Request) {
+	prefix := GetWebPrefix(q.logger, q.externalPrefix, q.prefixHeader, r)
+
+	q.executeTemplate(w, "flags.html", prefix, struct {
+		Flags []flag
+	}{
+		Flags: q.flags,
+	})
+}
+
 func (q *Query) stores(w http.ResponseWriter, r *http.Request) {
 	prefix := GetWebPrefix(q.logger, q.externalPrefix, q.prefixHeader, r)
 	statuses := make(map[component.StoreAPI][]query.StoreStatus)
@@ -0,0 +1,44 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/route"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQuery_StatusPages(t *testing.T) {
+	q := NewQueryUI(log.NewNopLogger(), nil, nil, map[string]string{
+		"query.timeout": "2m",
+		"grpc-address":  "0.0.0.0:10901",
+	}, "/thanos", "")
+	r := route.New()
+	q.Register(r, extpromhttp.NewNopInstrumentationMiddleware())
+
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		testutil.Equals(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	flags := get("/flags")
+	testutil.Assert(t, strings.Contains(flags, `href="/thanos/flags"`), "menu must link to flags page with external prefix")
+	grpc, timeout := strings.Index(flags, "grpc-address"), strings.Index(flags, "query.timeout")
+	testutil.Assert(t, grpc >= 0 && timeout >= 0, "flags page must list all flags")
+	testutil.Assert(t, grpc < timeout, "flags must be sorted by name")
+	testutil.Assert(t, strings.Contains(flags, "0.0.0.0:10901"), "flags page must show values of flags")
+
+	status := get("/status")
+	for _, s := range []string{"Working Directory", "Goroutines", "GOMAXPROCS", "Build Information"} {
+		testutil.Assert(t, strings.Contains(status, s), "status page must show %s", s)
+	}
+}
@@ -39,90 +39,103 @@ func IndexIssue(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bac
 
 	for id, meta := range metas {
 		if idMatcher != nil && !idMatcher(id) {
-			return nil
+			continue
 		}
 
-		tmpdir, err := ioutil.TempDir("", fmt.Sprintf("index-issue-block-%s-", id))
-		if err != nil {
+		if err := verifyIndexIssue(ctx, logger, bkt, backupBkt, repair, meta, deleteDelay, metrics); err != nil {
 			return err
 		}
-		defer func() {
-			if err := os.RemoveAll(tmpdir); err != nil {
-				level.Warn(logger).Log("msg", "failed to delete dir", "tmpdir", tmpdir, "err", err)
-			}
-		}()
-
-		if err = objstore.DownloadFile(ctx, logger, bkt, path.Join(id.String(), block.IndexFilename), filepath.Join(tmpdir, block.IndexFilename)); err != nil {
-			return errors.Wrapf(err, "download index file %s", path.Join(id.String(), block.IndexFilename))
-		}
+	}
 
-		stats, err := block.GatherIndexIssueStats(logger, filepath.Join(tmpdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
-		if err != nil {
-			return errors.Wrapf(err, "gather index issues %s", id)
-		}
+	level.Info(logger).Log("msg", "verified issue", "with-repair", repair, "issue", IndexIssueID)
+	return nil
+}
+
+// verifyIndexIssue verifies the index of a single block and, if repair is true, replaces the block with a repaired one
+// with a new ULID. The broken block is backed up to backupBkt before it is deleted.
+func verifyIndexIssue(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, repair bool, meta *metadata.Meta, deleteDelay time.Duration, metrics *verifierMetrics) error {
+	id := meta.ULID
 
-		if err = stats.AnyErr(); err == nil {
-			return nil
+	tmpdir, err := ioutil.TempDir("", fmt.Sprintf("index-issue-block-%s-", id))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpdir); err != nil {
+			level.Warn(logger).Log("msg", "failed to delete dir", "tmpdir", tmpdir, "err", err)
 		}
+	}()
 
-		level.Warn(logger).Log("msg", "detected issue", "id", id, "err", err, "issue", IndexIssueID)
+	if err = objstore.DownloadFile(ctx, logger, bkt, path.Join(id.String(), block.IndexFilename), filepath.Join(tmpdir, block.IndexFilename)); err != nil {
+		return errors.Wrapf(err, "download index file %s", path.Join(id.String(), block.IndexFilename))
+	}
 
-		if !repair {
-			// Only verify.
-			return nil
-		}
+	stats, err := block.GatherIndexIssueStats(logger, filepath.Join(tmpdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrapf(err, "gather index issues %s", id)
+	}
 
-		if stats.OutOfOrderChunks > stats.DuplicatedChunks {
-			level.Warn(logger).Log("msg", "detected overlaps are not entirely by duplicated chunks. We are able to repair only duplicates", "id", id, "issue", IndexIssueID)
-		}
+	if err = stats.AnyErr(); err == nil {
+		return nil
+	}
 
-		if stats.OutsideChunks > (stats.CompleteOutsideChunks + stats.Issue347OutsideChunks) {
-			level.Warn(logger).Log("msg", "detected outsiders are not all 'complete' outsiders or outsiders from https://github.com/prometheus/tsdb/issues/347. We can safely delete only these outsiders", "id", id, "issue", IndexIssueID)
-		}
+	level.Warn(logger).Log("msg", "detected issue", "id", id, "err", err, "issue", IndexIssueID)
 
-		if meta.Thanos.Downsample.Resolution > 0 {
-			return errors.New("cannot repair downsampled blocks")
-		}
+	if !repair {
+		// Only verify.
+		return nil
+	}
+	if backupBkt == nil {
+		return errors.Errorf("repair of block %s requires backup bucket", id)
+	}
 
-		level.Info(logger).Log("msg", "downloading block for repair", "id", id, "issue", IndexIssueID)
-		if err = block.Download(ctx, logger, bkt, id, path.Join(tmpdir, id.String())); err != nil {
-			return errors.Wrapf(err, "download block %s", id)
-		}
-		level.Info(logger).Log("msg", "downloaded block to be repaired", "id", id, "issue", IndexIssueID)
-
-		level.Info(logger).Log("msg", "repairing block", "id", id, "issue", IndexIssueID)
-		resid, err := block.Repair(
-			logger,
-			tmpdir,
-			id,
-			metadata.BucketRepairSource,
-			block.IgnoreCompleteOutsideChunk,
-			block.IgnoreDuplicateOutsideChunk,
-			block.IgnoreIssue347OutsideChunk,
-		)
-		if err != nil {
-			return errors.Wrapf(err, "repair failed for block %s", id)
-		}
-		level.Info(logger).Log("msg", "verifying repaired block", "id", id, "newID", resid, "issue", IndexIssueID)
+	if stats.OutOfOrderChunks > stats.DuplicatedChunks {
+		level.Warn(logger).Log("msg", "detected overlaps are not entirely by duplicated chunks. We are able to repair only duplicates", "id", id, "issue", IndexIssueID)
+	}
 
-		// Verify repaired block before uploading it.
-		if err := block.VerifyIndex(logger, filepath.Join(tmpdir, resid.String(), block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
-			return errors.Wrapf(err, "repaired block is invalid %s", resid)
-		}
+	if stats.OutsideChunks > (stats.CompleteOutsideChunks + stats.Issue347OutsideChunks) {
+		level.Warn(logger).Log("msg", "detected outsiders are not all 'complete' outsiders or outsiders from https://github.com/prometheus/tsdb/issues/347. We can safely delete only these outsiders", "id", id, "issue", IndexIssueID)
+	}
 
-		level.Info(logger).Log("msg", "uploading repaired block", "newID", resid, "issue", IndexIssueID)
-		if err = block.Upload(ctx, logger, bkt, filepath.Join(tmpdir, resid.String())); err != nil {
-			return errors.Wrapf(err, "upload of %s failed", resid)
-		}
+	if meta.Thanos.Downsample.Resolution > 0 {
+		return errors.New("cannot repair downsampled blocks")
+	}
 
-		level.Info(logger).Log("msg", "safe deleting broken block", "id", id, "issue", IndexIssueID)
-		if err := BackupAndDeleteDownloaded(ctx, logger, filepath.Join(tmpdir, id.String()), bkt, backupBkt, id, deleteDelay, metrics.blocksMarkedForDeletion); err != nil {
-			return errors.Wrapf(err, "safe deleting old block %s failed", id)
-		}
-		level.Info(logger).Log("msg", "all good, continuing", "id", id, "issue", IndexIssueID)
-		return nil
+	level.Info(logger).Log("msg", "downloading block for repair", "id", id, "issue", IndexIssueID)
+	if err = block.Download(ctx, logger, bkt, id, path.Join(tmpdir, id.String())); err != nil {
+		return errors.Wrapf(err, "download block %s", id)
+	}
+	level.Info(logger).Log("msg", "downloaded block to be repaired", "id", id, "issue", IndexIssueID)
+
+	level.Info(logger).Log("msg", "repairing block", "id", id, "issue", IndexIssueID)
+	resid, err := block.Repair(
+		logger,
+		tmpdir,
+		id,
+		metadata.BucketRepairSource,
+		block.IgnoreCompleteOutsideChunk,
+		block.IgnoreDuplicateOutsideChunk,
+		block.IgnoreIssue347OutsideChunk,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "repair failed for block %s", id)
 	}
+	level.Info(logger).Log("msg", "verifying repaired block", "id", id, "newID", resid, "issue", IndexIssueID)
 
-	level.Info(logger).Log("msg", "verified issue", "with-repair", repair, "issue", IndexIssueID)
+	// Verify repaired block before uploading it.
+	if err := block.VerifyIndex(logger, filepath.Join(tmpdir, resid.String(), block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		return errors.Wrapf(err, "repaired block is invalid %s", resid)
+	}
+
+	level.Info(logger).Log("msg", "uploading repaired block", "newID", resid, "issue", IndexIssueID)
+	if err = block.Upload(ctx, logger, bkt, filepath.Join(tmpdir, resid.String())); err != nil {
+		return errors.Wrapf(err, "upload of %s failed", resid)
+	}
+
+	level.Info(logger).Log("msg", "safe deleting broken block", "id", id, "issue", IndexIssueID)
+	if err := BackupAndDeleteDownloaded(ctx, logger, filepath.Join(tmpdir, id.String()), bkt, backupBkt, id, deleteDelay, metrics.blocksMarkedForDeletion); err != nil {
+		return errors.Wrapf(err, "safe deleting old block %s failed", id)
+	}
+	level.Info(logger).Log("msg", "all good, continuing", "id", id, "issue", IndexIssueID)
 	return nil
 }
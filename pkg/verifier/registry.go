@@ -0,0 +1,67 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package verifier
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Registry holds issues that can be verified (and optionally repaired) identified by their IDs.
+type Registry struct {
+	issues map[string]Issue
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{issues: map[string]Issue{}}
+}
+
+// DefaultRegistry returns a Registry with all issues known by the verifier.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for id, issue := range map[string]Issue{
+		IndexIssueID:                IndexIssue,
+		OverlappedBlocksIssueID:     OverlappedBlocksIssue,
+		DuplicatedCompactionIssueID: DuplicatedCompactionIssue,
+	} {
+		// IDs are unique, so registering cannot fail.
+		_ = r.Register(id, issue)
+	}
+	return r
+}
+
+// Register adds the issue under the given ID. It returns an error if an issue with the same ID is already registered.
+func (r *Registry) Register(id string, issue Issue) error {
+	if _, ok := r.issues[id]; ok {
+		return errors.Errorf("issue %s already registered", id)
+	}
+	r.issues[id] = issue
+	return nil
+}
+
+// Issues returns issues registered under the given IDs in the same order.
+// It returns an error if any of the IDs is not registered.
+func (r *Registry) Issues(ids ...string) ([]Issue, error) {
+	issues := make([]Issue, 0, len(ids))
+	for _, id := range ids {
+		issue, ok := r.issues[id]
+		if !ok {
+			return nil, errors.Errorf("no such issue name %s", id)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// IDs returns sorted IDs of all registered issues.
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.issues))
+	for id := range r.issues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,41 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package verifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRegistry(t *testing.T) {
+	r := DefaultRegistry()
+	testutil.Equals(t, []string{DuplicatedCompactionIssueID, IndexIssueID, OverlappedBlocksIssueID}, r.IDs())
+
+	var called []string
+	issue := func(id string) Issue {
+		return func(context.Context, log.Logger, objstore.Bucket, objstore.Bucket, bool, func(ulid.ULID) bool, block.MetadataFetcher, time.Duration, *verifierMetrics) error {
+			called = append(called, id)
+			return nil
+		}
+	}
+	testutil.Ok(t, r.Register("custom", issue("custom")))
+	testutil.NotOk(t, r.Register("custom", issue("custom")))
+	testutil.NotOk(t, r.Register(IndexIssueID, issue(IndexIssueID)))
+
+	issues, err := r.Issues("custom")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(issues))
+	testutil.Ok(t, issues[0](context.Background(), nil, nil, nil, false, nil, nil, 0, nil))
+	testutil.Equals(t, []string{"custom"}, called)
+
+	_, err = r.Issues(IndexIssueID, "unknown")
+	testutil.NotOk(t, err)
+}
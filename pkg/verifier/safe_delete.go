@@ -77,6 +77,7 @@ func BackupAndDelete(ctx context.Context, logger log.Logger, bkt, backupBkt objs
 		if err := block.Delete(ctx, logger, bkt, id); err != nil {
 			return errors.Wrap(err, "delete from source")
 		}
+		return nil
 	}
 
 	level.Info(logger).Log("msg", "Marking block as deleted", "id", id.String())
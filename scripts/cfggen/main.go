@@ -23,10 +23,12 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore/cos"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/objstore/gcs"
+	"github.com/thanos-io/thanos/pkg/objstore/hdfs"
 	"github.com/thanos-io/thanos/pkg/objstore/oss"
 	"github.com/thanos-io/thanos/pkg/objstore/s3"
 	"github.com/thanos-io/thanos/pkg/objstore/swift"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/remotewrite"
 	storecache "github.com/thanos-io/thanos/pkg/store/cache"
 	trclient "github.com/thanos-io/thanos/pkg/tracing/client"
 	"github.com/thanos-io/thanos/pkg/tracing/elasticapm"
@@ -45,6 +47,7 @@ var (
 		client.SWIFT:      swift.SwiftConfig{},
 		client.COS:        cos.Config{},
 		client.ALIYUNOSS:  oss.Config{},
+		client.HDFS:       hdfs.Config{},
 		client.FILESYSTEM: filesystem.Config{},
 	}
 	tracingConfigs = map[trclient.TracingProvider]interface{}{
@@ -104,6 +107,13 @@ func main() {
 		level.Error(logger).Log("msg", "failed to generate", "type", "rule_query", "err", err)
 		os.Exit(1)
 	}
+
+	remoteWriteCfg := remotewrite.DefaultConfig()
+	remoteWriteCfg.EndpointsConfig.FileSDConfigs = []http_util.FileSDConfig{{}}
+	if err := generate([]remotewrite.Config{remoteWriteCfg}, "rule_remote_write", *outputDir); err != nil {
+		level.Error(logger).Log("msg", "failed to generate", "type", "rule_remote_write", "err", err)
+		os.Exit(1)
+	}
 	logger.Log("msg", "success")
 }
 
@@ -24,7 +24,10 @@ GO111MODULE=on go install "github.com/gogo/protobuf/protoc-gen-gogofast"
 GOGOPROTO_ROOT="$(GO111MODULE=on go list -f '{{ .Dir }}' -m github.com/gogo/protobuf)"
 GOGOPROTO_PATH="${GOGOPROTO_ROOT}:${GOGOPROTO_ROOT}/protobuf"
 
-DIRS="pkg/store/storepb pkg/store/storepb/prompb pkg/store/hintspb"
+PKG_PATH="$(pwd)/pkg"
+STOREPB_PATH="${PKG_PATH}/store/storepb"
+
+DIRS="pkg/store/storepb pkg/store/storepb/prompb pkg/store/hintspb pkg/metadata/metadatapb pkg/exemplars/exemplarspb pkg/targets/targetspb pkg/rules/rulespb"
 
 echo "generating code"
 for dir in ${DIRS}; do
@@ -32,9 +35,12 @@ for dir in ${DIRS}; do
 		${PROTOC_BIN} --gogofast_out=\
 Mgoogle/protobuf/any.proto=github.com/gogo/protobuf/types,\
 Mprompb/types.proto=github.com/thanos-io/thanos/pkg/store/storepb/prompb,\
+Mstore/storepb/rpc.proto=github.com/thanos-io/thanos/pkg/store/storepb,\
 plugins=grpc:. \
 		  -I=. \
 			-I="${GOGOPROTO_PATH}" \
+			-I="${PKG_PATH}" \
+			-I="${STOREPB_PATH}" \
 			*.proto
 
 		${GOIMPORTS_BIN} -w *.pb.go